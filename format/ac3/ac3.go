@@ -0,0 +1,51 @@
+package ac3
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+)
+
+var ac3Frame decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.AC3,
+		Description: "Dolby Digital (AC-3/E-AC-3) stream",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte{0x0b, 0x77}}},
+		DecodeFn:    ac3Decode,
+		RootArray:   true,
+		RootName:    "frames",
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.AC3_FRAME}, Group: &ac3Frame},
+		},
+	})
+}
+
+func ac3Decode(d *decode.D, in interface{}) interface{} {
+	validFrames := 0
+	var firstFrame *decode.Value
+	for !d.End() {
+		dv, _, _ := d.TryFieldFormat("frame", ac3Frame, nil)
+		if dv == nil {
+			break
+		}
+		if firstFrame == nil {
+			firstFrame = dv
+		}
+		validFrames++
+	}
+
+	switch {
+	case validFrames == 0:
+		d.Fatalf("no valid frames")
+	case validFrames == 1:
+		// sync word alone is weak, a single frame also needs a valid crc
+		if c := firstFrame.Child("crc2"); c == nil || c.Checksum == nil || !c.Checksum.Valid() {
+			d.Fatalf("single frame with invalid crc")
+		}
+	}
+
+	return nil
+}
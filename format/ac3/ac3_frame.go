@@ -0,0 +1,612 @@
+package ac3
+
+// https://www.atsc.org/wp-content/uploads/2015/03/A52-201212-17.pdf
+// https://www.etsi.org/deliver/etsi_ts/102300_102399/102366/01.04.01_60/ts_102366v010401p.pdf
+// https://github.com/FFmpeg/FFmpeg/blob/master/libavcodec/ac3_parser.c
+
+// TODO: decode audio blocks, length of each block is only known after exponent and bit allocation decoding
+// TODO: AHT with frame based exponent strategies
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/checksum"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.AC3_FRAME,
+		Description: "Dolby Digital (AC-3/E-AC-3) syncframe",
+		DecodeFn:    ac3FrameDecode,
+	})
+}
+
+const syncWord = 0x0b77
+
+var sampleRateNames = scalar.UToSymU{
+	0: 48000,
+	1: 44100,
+	2: 32000,
+}
+
+// E-AC-3 reduced sample rates
+var sampleRate2Names = scalar.UToSymU{
+	0: 24000,
+	1: 22050,
+	2: 16000,
+}
+
+// bitrate in kbit/s indexed by frmsizecod/2
+var bitRates = []uint64{
+	32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 448, 512, 576, 640,
+}
+
+var frameSizeCodeNames = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	u, ok := s.Actual.(uint64)
+	if !ok || u/2 >= uint64(len(bitRates)) {
+		return s, nil
+	}
+	s.Sym = bitRates[u/2] * 1000
+	return s, nil
+})
+
+var bsmodNames = scalar.UToSymStr{
+	0: "main_complete",
+	1: "main_music_and_effects",
+	2: "associated_visually_impaired",
+	3: "associated_hearing_impaired",
+	4: "associated_dialogue",
+	5: "associated_commentary",
+	6: "associated_emergency",
+	7: "associated_voice_over",
+}
+
+var acmodNames = scalar.UToScalar{
+	0: {Sym: "1+1", Description: "Dual mono, Ch1 Ch2"},
+	1: {Sym: "1/0", Description: "C"},
+	2: {Sym: "2/0", Description: "L R"},
+	3: {Sym: "3/0", Description: "L C R"},
+	4: {Sym: "2/1", Description: "L R S"},
+	5: {Sym: "3/1", Description: "L C R S"},
+	6: {Sym: "2/2", Description: "L R SL SR"},
+	7: {Sym: "3/2", Description: "L C R SL SR"},
+}
+
+// number of full bandwidth channels indexed by acmod
+var acmodChannels = []int{2, 1, 2, 3, 3, 4, 4, 5}
+
+var cmixlevNames = scalar.UToSymStr{
+	0: "-3.0 dB",
+	1: "-4.5 dB",
+	2: "-6.0 dB",
+	3: "reserved",
+}
+
+var surmixlevNames = scalar.UToSymStr{
+	0: "-3 dB",
+	1: "-6 dB",
+	2: "0",
+	3: "reserved",
+}
+
+var dsurmodNames = scalar.UToSymStr{
+	0: "not_indicated",
+	1: "not_dolby_surround",
+	2: "dolby_surround",
+	3: "reserved",
+}
+
+var roomtypNames = scalar.UToSymStr{
+	0: "not_indicated",
+	1: "large_room",
+	2: "small_room",
+	3: "reserved",
+}
+
+const (
+	streamTypeIndependent = 0
+	streamTypeDependent   = 1
+	streamTypeAC3Convert  = 2
+)
+
+var strmtypNames = scalar.UToSymStr{
+	streamTypeIndependent: "independent",
+	streamTypeDependent:   "dependent",
+	streamTypeAC3Convert:  "ac3_convert",
+	3:                     "reserved",
+}
+
+// number of audio blocks indexed by numblkscod
+var numBlocks = []int{1, 2, 3, 6}
+
+var numblkscodNames = scalar.UToSymU{
+	0: 1,
+	1: 2,
+	2: 3,
+	3: 6,
+}
+
+var expstrNames = scalar.UToSymStr{
+	0: "reuse",
+	1: "d15",
+	2: "d25",
+	3: "d45",
+}
+
+// frame size in bytes
+func ac3FrameSize(fscod uint64, frmsizecod uint64) int64 {
+	if frmsizecod/2 >= uint64(len(bitRates)) {
+		return 0
+	}
+	bitRate := int64(bitRates[frmsizecod/2])
+	switch fscod {
+	case 0:
+		return bitRate * 4
+	case 1:
+		// 44.1kHz is not evenly divisible, odd codes has one extra word
+		return (bitRate*96000/44100 + int64(frmsizecod&1)) * 2
+	case 2:
+		return bitRate * 6
+	default:
+		return 0
+	}
+}
+
+func fieldDialogNorm(d *decode.D, name string) {
+	d.FieldU5(name, scalar.Fn(func(s scalar.S) (scalar.S, error) {
+		if u, ok := s.Actual.(uint64); ok && u != 0 {
+			s.Sym = -int64(u)
+		}
+		return s, nil
+	}))
+}
+
+// optional field preceded by an exists flag
+func fieldOptional(d *decode.D, existsName string, name string, nBits int) {
+	if d.FieldBool(existsName) {
+		d.FieldU(name, nBits)
+	}
+}
+
+func decodeAC3BSI(d *decode.D, bsid uint64) {
+	d.FieldU5("bsid")
+	d.FieldU3("bsmod", bsmodNames)
+	acmod := d.FieldU3("acmod", acmodNames)
+	if acmod&1 != 0 && acmod != 1 {
+		d.FieldU2("cmixlev", cmixlevNames)
+	}
+	if acmod&4 != 0 {
+		d.FieldU2("surmixlev", surmixlevNames)
+	}
+	if acmod == 2 {
+		d.FieldU2("dsurmod", dsurmodNames)
+	}
+	d.FieldBool("lfeon")
+	fieldDialogNorm(d, "dialnorm")
+	fieldOptional(d, "compre", "compr", 8)
+	fieldOptional(d, "langcode", "langcod", 8)
+	if d.FieldBool("audprodie") {
+		d.FieldU5("mixlevel", scalar.UAdd(80))
+		d.FieldU2("roomtyp", roomtypNames)
+	}
+	if acmod == 0 {
+		fieldDialogNorm(d, "dialnorm2")
+		fieldOptional(d, "compr2e", "compr2", 8)
+		fieldOptional(d, "langcod2e", "langcod2", 8)
+		if d.FieldBool("audprodi2e") {
+			d.FieldU5("mixlevel2", scalar.UAdd(80))
+			d.FieldU2("roomtyp2", roomtypNames)
+		}
+	}
+	d.FieldBool("copyrightb")
+	d.FieldBool("origbs")
+	if bsid == 6 {
+		// alternate bit stream syntax
+		if d.FieldBool("xbsi1e") {
+			d.FieldU2("dmixmod")
+			d.FieldU3("ltrtcmixlev")
+			d.FieldU3("ltrtsurmixlev")
+			d.FieldU3("lorocmixlev")
+			d.FieldU3("lorosurmixlev")
+		}
+		if d.FieldBool("xbsi2e") {
+			d.FieldU2("dsurexmod")
+			d.FieldU2("dheadphonmod")
+			d.FieldBool("adconvtyp")
+			d.FieldU8("xbsi2")
+			d.FieldBool("encinfo")
+		}
+	} else {
+		fieldOptional(d, "timecod1e", "timecod1", 14)
+		fieldOptional(d, "timecod2e", "timecod2", 14)
+	}
+	if d.FieldBool("addbsie") {
+		addbsil := d.FieldU6("addbsil", scalar.UAdd(1))
+		d.FieldRawLen("addbsi", int64(addbsil)*8)
+	}
+}
+
+type eac3BSI struct {
+	strmtyp   uint64
+	frameSize int64
+	numBlocks int
+	acmod     uint64
+	nfchans   int
+	lfeon     bool
+}
+
+func decodeEAC3BSI(d *decode.D) eac3BSI {
+	var b eac3BSI
+
+	b.strmtyp = d.FieldU2("strmtyp", strmtypNames)
+	d.FieldU3("substreamid")
+	frmsiz := d.FieldU11("frmsiz", scalar.UAdd(1), scalar.Description("words"))
+	b.frameSize = int64(frmsiz) * 2
+	fscod := d.FieldU2("fscod", sampleRateNames)
+	numblkscod := uint64(3)
+	if fscod == 3 {
+		d.FieldU2("fscod2", sampleRate2Names)
+	} else {
+		numblkscod = d.FieldU2("numblkscod", numblkscodNames)
+	}
+	b.numBlocks = numBlocks[numblkscod]
+	b.acmod = d.FieldU3("acmod", acmodNames)
+	b.nfchans = acmodChannels[b.acmod]
+	b.lfeon = d.FieldBool("lfeon")
+	d.FieldU5("bsid")
+	fieldDialogNorm(d, "dialnorm")
+	fieldOptional(d, "compre", "compr", 8)
+	if b.acmod == 0 {
+		fieldDialogNorm(d, "dialnorm2")
+		fieldOptional(d, "compr2e", "compr2", 8)
+	}
+	if b.strmtyp == streamTypeDependent {
+		fieldOptional(d, "chanmape", "chanmap", 16)
+	}
+	if d.FieldBool("mixmdate") {
+		if b.acmod > 2 {
+			d.FieldU2("dmixmod")
+		}
+		if b.acmod&1 != 0 && b.acmod > 2 {
+			d.FieldU3("ltrtcmixlev")
+			d.FieldU3("lorocmixlev")
+		}
+		if b.acmod&4 != 0 {
+			d.FieldU3("ltrtsurmixlev")
+			d.FieldU3("lorosurmixlev")
+		}
+		if b.lfeon {
+			fieldOptional(d, "lfemixlevcode", "lfemixlevcod", 5)
+		}
+		if b.strmtyp == streamTypeIndependent {
+			fieldOptional(d, "pgmscle", "pgmscl", 6)
+			if b.acmod == 0 {
+				fieldOptional(d, "pgmscl2e", "pgmscl2", 6)
+			}
+			fieldOptional(d, "extpgmscle", "extpgmscl", 6)
+			switch d.FieldU2("mixdef") {
+			case 1:
+				d.FieldU1("premixcmpsel")
+				d.FieldU1("drcsrc")
+				d.FieldU3("premixcmpscl")
+			case 2:
+				d.FieldU12("mixdata")
+			case 3:
+				mixdeflen := d.FieldU5("mixdeflen", scalar.UAdd(2))
+				d.FieldRawLen("mixdata", int64(mixdeflen)*8)
+			}
+			if b.acmod < 2 {
+				fieldOptional(d, "paninfoe", "paninfo", 14)
+				if b.acmod == 0 {
+					fieldOptional(d, "paninfo2e", "paninfo2", 14)
+				}
+			}
+			if d.FieldBool("frmmixcfginfoe") {
+				d.FieldArray("blkmixcfginfo", func(d *decode.D) {
+					if b.numBlocks == 1 {
+						d.FieldU5("blkmixcfginfo")
+						return
+					}
+					for i := 0; i < b.numBlocks; i++ {
+						d.FieldStruct("block", func(d *decode.D) {
+							fieldOptional(d, "blkmixcfginfoe", "blkmixcfginfo", 5)
+						})
+					}
+				})
+			}
+		}
+	}
+	if d.FieldBool("infomdate") {
+		d.FieldU3("bsmod", bsmodNames)
+		d.FieldBool("copyrightb")
+		d.FieldBool("origbs")
+		if b.acmod == 2 {
+			d.FieldU2("dsurmod", dsurmodNames)
+			d.FieldU2("dheadphonmod")
+		}
+		if b.acmod >= 6 {
+			d.FieldU2("dsurexmod")
+		}
+		if d.FieldBool("audprodie") {
+			d.FieldU5("mixlevel", scalar.UAdd(80))
+			d.FieldU2("roomtyp", roomtypNames)
+			d.FieldBool("adconvtyp")
+		}
+		if b.acmod == 0 {
+			if d.FieldBool("audprodi2e") {
+				d.FieldU5("mixlevel2", scalar.UAdd(80))
+				d.FieldU2("roomtyp2", roomtypNames)
+				d.FieldBool("adconvtyp2")
+			}
+		}
+		if fscod < 3 {
+			d.FieldBool("sourcefscod")
+		}
+	}
+	if b.strmtyp == streamTypeIndependent && numblkscod != 3 {
+		d.FieldBool("convsync")
+	}
+	if b.strmtyp == streamTypeAC3Convert {
+		blkid := numblkscod == 3
+		if !blkid {
+			blkid = d.FieldBool("blkid")
+		}
+		if blkid {
+			d.FieldU6("frmsizecod", frameSizeCodeNames)
+		}
+	}
+	if d.FieldBool("addbsie") {
+		addbsil := d.FieldU6("addbsil", scalar.UAdd(1))
+		d.FieldRawLen("addbsi", int64(addbsil)*8)
+	}
+
+	return b
+}
+
+func decodeEAC3AudioFrame(d *decode.D, b eac3BSI) {
+	expstre := true
+	ahte := false
+	if b.numBlocks == 6 {
+		expstre = d.FieldBool("expstre")
+		ahte = d.FieldBool("ahte")
+	}
+	snroffststr := d.FieldU2("snroffststr")
+	transproce := d.FieldBool("transproce")
+	d.FieldBool("blkswe")
+	d.FieldBool("dithflage")
+	d.FieldBool("bamode")
+	d.FieldBool("frmfgaincode")
+	d.FieldBool("dbaflde")
+	d.FieldBool("skipflde")
+	spxattene := d.FieldBool("spxattene")
+
+	cplinu := make([]bool, b.numBlocks)
+	if b.acmod > 1 {
+		d.FieldArray("coupling_strategies", func(d *decode.D) {
+			for blk := 0; blk < b.numBlocks; blk++ {
+				d.FieldStruct("block", func(d *decode.D) {
+					// first block always has a new strategy
+					cplstre := blk == 0
+					if blk > 0 {
+						cplstre = d.FieldBool("cplstre")
+					}
+					if cplstre {
+						cplinu[blk] = d.FieldBool("cplinu")
+					} else {
+						cplinu[blk] = cplinu[blk-1]
+					}
+				})
+			}
+		})
+	}
+	ncplblks := 0
+	for _, u := range cplinu {
+		if u {
+			ncplblks++
+		}
+	}
+
+	// number of blocks with new exponents, used by AHT
+	ncplregs := 0
+	nchregs := make([]int, b.nfchans)
+	nlferegs := 0
+	if expstre {
+		d.FieldArray("exponent_strategies", func(d *decode.D) {
+			for blk := 0; blk < b.numBlocks; blk++ {
+				d.FieldStruct("block", func(d *decode.D) {
+					if cplinu[blk] {
+						if d.FieldU2("cplexpstr", expstrNames) != 0 {
+							ncplregs++
+						}
+					}
+					d.FieldArray("chexpstr", func(d *decode.D) {
+						for ch := 0; ch < b.nfchans; ch++ {
+							if d.FieldU2("chexpstr", expstrNames) != 0 {
+								nchregs[ch]++
+							}
+						}
+					})
+				})
+			}
+		})
+	} else {
+		if b.acmod > 1 && ncplblks > 0 {
+			d.FieldU5("frmcplexpstr")
+		}
+		d.FieldArray("frmchexpstr", func(d *decode.D) {
+			for ch := 0; ch < b.nfchans; ch++ {
+				d.FieldU5("frmchexpstr")
+			}
+		})
+	}
+	if b.lfeon {
+		d.FieldArray("lfeexpstr", func(d *decode.D) {
+			for blk := 0; blk < b.numBlocks; blk++ {
+				if d.FieldBool("lfeexpstr") {
+					nlferegs++
+				}
+			}
+		})
+	}
+	if b.strmtyp == streamTypeIndependent {
+		convexpstre := true
+		if b.numBlocks != 6 {
+			convexpstre = d.FieldBool("convexpstre")
+		}
+		if convexpstre {
+			d.FieldArray("convexpstr", func(d *decode.D) {
+				for ch := 0; ch < b.nfchans; ch++ {
+					d.FieldU5("convexpstr")
+				}
+			})
+		}
+	}
+	if ahte {
+		if !expstre {
+			// rest of audio frame is decoded as part of audio blocks
+			return
+		}
+		if ncplblks == 6 && ncplregs == 1 {
+			d.FieldBool("cplahtinu")
+		}
+		d.FieldArray("chahtinu", func(d *decode.D) {
+			for ch := 0; ch < b.nfchans; ch++ {
+				if nchregs[ch] == 1 {
+					d.FieldBool("chahtinu")
+				}
+			}
+		})
+		if b.lfeon && nlferegs == 1 {
+			d.FieldBool("lfeahtinu")
+		}
+	}
+	if snroffststr == 0 {
+		d.FieldU6("frmcsnroffst")
+		d.FieldU4("frmfsnroffst")
+	}
+	if transproce {
+		d.FieldArray("transient_processing", func(d *decode.D) {
+			for ch := 0; ch < b.nfchans; ch++ {
+				d.FieldStruct("channel", func(d *decode.D) {
+					if d.FieldBool("chintransproc") {
+						d.FieldU10("transprocloc")
+						d.FieldU8("transproclen")
+					}
+				})
+			}
+		})
+	}
+	if spxattene {
+		d.FieldArray("spectral_extension_attenuation", func(d *decode.D) {
+			for ch := 0; ch < b.nfchans; ch++ {
+				d.FieldStruct("channel", func(d *decode.D) {
+					fieldOptional(d, "chinspxatten", "spxattencod", 5)
+				})
+			}
+		})
+	}
+	if b.numBlocks > 1 && d.FieldBool("blkstrtinfoe") {
+		// 4 + ceil(log2(words)) bits per block except the first
+		words := b.frameSize / 2
+		n := 0
+		for (int64(1) << n) < words {
+			n++
+		}
+		d.FieldRawLen("blkstrtinfo", int64(b.numBlocks-1)*int64(4+n))
+	}
+}
+
+// auxiliary data and error check are read backwards from the end of the frame
+func decodeAuxDataAndErrorCheck(d *decode.D, frameEnd int64) {
+	// auxdatae, crcrsv and crc2
+	auxEnd := frameEnd - 18
+	auxLen := int64(0)
+	auxdatalLen := int64(0)
+	pos := d.Pos()
+	d.SeekAbs(auxEnd)
+	if d.Bool() {
+		auxdatalLen = 14
+		d.SeekAbs(auxEnd - auxdatalLen)
+		auxLen = int64(d.U14())
+	}
+	d.SeekAbs(pos)
+	auxStart := auxEnd - auxdatalLen - auxLen
+	if auxStart < d.Pos() {
+		d.Fatalf("invalid auxdatal %d", auxLen)
+	}
+
+	d.FieldRawLen("audio_blocks", auxStart-d.Pos())
+	if auxLen > 0 {
+		d.FieldRawLen("auxbits", auxLen)
+	}
+	if auxdatalLen > 0 {
+		d.FieldU14("auxdatal")
+	}
+	d.FieldBool("auxdatae")
+	d.FieldBool("crcrsv")
+}
+
+func ac3FrameDecode(d *decode.D, in interface{}) interface{} {
+	// bsid is at the same position for both AC-3 and E-AC-3
+	bsid := d.PeekBits(45) & 0x1f
+
+	var frameSize int64
+	switch {
+	case bsid <= 10:
+		// fscod and frmsizecod are after crc1
+		fscodFrmsizecod := d.PeekBits(40) & 0xff
+		fscod := fscodFrmsizecod >> 6
+		frmsizecod := fscodFrmsizecod & 0x3f
+		frameSize = ac3FrameSize(fscod, frmsizecod)
+		if frameSize == 0 {
+			d.Fatalf("invalid fscod %d or frmsizecod %d", fscod, frmsizecod)
+		}
+
+		// crc1 is calculated so that the first 5/8 of the frame excluding
+		// syncword has a zero crc
+		frameSize58 := ((frameSize >> 2) + (frameSize >> 4)) << 1
+		crc1Hash := &checksum.CRC{Bits: 16, Table: checksum.ANSI16Table}
+		d.MustCopy(crc1Hash, d.BitBufRange(2*8, (frameSize58-2)*8))
+
+		d.FieldStruct("syncinfo", func(d *decode.D) {
+			d.FieldU16("syncword", d.AssertU(syncWord), scalar.Hex)
+			d.FieldU16("crc1", scalar.Hex, scalar.Fn(func(s scalar.S) (scalar.S, error) {
+				s.Description = "invalid"
+				if crc1Hash.Current == 0 {
+					s.Description = "valid"
+				}
+				return s, nil
+			}))
+			d.FieldU2("fscod", sampleRateNames)
+			d.FieldU6("frmsizecod", frameSizeCodeNames)
+		})
+		d.FieldValueU("frame_size", uint64(frameSize))
+		d.FieldStruct("bsi", func(d *decode.D) { decodeAC3BSI(d, bsid) })
+	case bsid <= 16:
+		var b eac3BSI
+		d.FieldStruct("syncinfo", func(d *decode.D) {
+			d.FieldU16("syncword", d.AssertU(syncWord), scalar.Hex)
+		})
+		d.FieldStruct("bsi", func(d *decode.D) { b = decodeEAC3BSI(d) })
+		frameSize = b.frameSize
+		d.FieldValueU("frame_size", uint64(frameSize))
+		d.FieldValueU("num_blocks", uint64(b.numBlocks))
+		d.FieldStruct("audfrm", func(d *decode.D) { decodeEAC3AudioFrame(d, b) })
+	default:
+		d.Fatalf("unknown bsid %d", bsid)
+	}
+
+	frameEnd := frameSize * 8
+	if d.Pos() > frameEnd-18 {
+		d.Fatalf("frame size %d too small", frameSize)
+	}
+	decodeAuxDataAndErrorCheck(d, frameEnd)
+
+	crcHash := &checksum.CRC{Bits: 16, Table: checksum.ANSI16Table}
+	d.MustCopy(crcHash, d.BitBufRange(2*8, frameEnd-4*8))
+	d.FieldChecksumU("crc2", 16, "crc16", crcHash.Sum64(), scalar.Hex)
+
+	return nil
+}
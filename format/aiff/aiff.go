@@ -0,0 +1,211 @@
+package aiff
+
+// http://www-mmsp.ece.mcgill.ca/Documents/AudioFormats/AIFF/Docs/AIFF-1.3.pdf
+// http://www-mmsp.ece.mcgill.ca/Documents/AudioFormats/AIFF/Docs/AIFF-C.9.26.91.pdf
+// https://github.com/FFmpeg/FFmpeg/blob/master/libavformat/aiffdec.c
+
+import (
+	"embed"
+	"math"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed *.jq
+var aiffFS embed.FS
+
+var id3v2Format decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.AIFF,
+		Description: "Audio Interchange File Format",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte("FORM")}},
+		DecodeFn:    aiffDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.ID3V2}, Group: &id3v2Format},
+		},
+		Files: aiffFS,
+	})
+}
+
+var compressionTypeNames = scalar.StrToSymStr{
+	"NONE": "none",
+	"sowt": "pcm_s16le",
+	"fl32": "pcm_f32be",
+	"FL32": "pcm_f32be",
+	"fl64": "pcm_f64be",
+	"FL64": "pcm_f64be",
+	"alaw": "pcm_alaw",
+	"ALAW": "pcm_alaw",
+	"ulaw": "pcm_mulaw",
+	"ULAW": "pcm_mulaw",
+	"ima4": "adpcm_ima_qt",
+	"MAC3": "mace3",
+	"MAC6": "mace6",
+	"GSM ": "gsm",
+	"QDMC": "qdmc",
+	"QDM2": "qdm2",
+	"QCLP": "qcelp",
+	"in24": "pcm_s24be",
+	"in32": "pcm_s32be",
+}
+
+var playModeNames = scalar.UToSymStr{
+	0: "no_looping",
+	1: "forward_looping",
+	2: "forward_backward_looping",
+}
+
+// IEEE 754 80 bit extended precision, explicit integer bit in mantissa
+func float80(d *decode.D) float64 {
+	sign := d.U1()
+	exponent := int(d.U15())
+	mantissa := d.U64()
+	if exponent == 0 && mantissa == 0 {
+		return 0
+	}
+	if exponent == 0x7fff {
+		if mantissa<<1 == 0 {
+			return math.Inf(1 - 2*int(sign))
+		}
+		return math.NaN()
+	}
+	f := math.Ldexp(float64(mantissa), exponent-16383-63)
+	if sign == 1 {
+		f = -f
+	}
+	return f
+}
+
+// pascal string padded to even total length
+func fieldPString(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		length := d.FieldU8("length")
+		d.FieldUTF8("value", int(length))
+		if length%2 == 0 {
+			d.FieldRawLen("align", 8)
+		}
+	})
+}
+
+func decodeLoop(d *decode.D) {
+	d.FieldU16("play_mode", playModeNames)
+	d.FieldS16("begin_loop")
+	d.FieldS16("end_loop")
+}
+
+func decodeChunk(d *decode.D, expectedChunkID string, isAIFC bool) {
+	chunks := map[string]func(d *decode.D){
+		"FORM": func(d *decode.D) {
+			formType := d.FieldUTF8("form_type", 4, d.AssertStr("AIFF", "AIFC"))
+			isAIFC = formType == "AIFC"
+			d.FieldStructArrayLoop("chunks", "chunk", d.NotEnd, func(d *decode.D) {
+				decodeChunk(d, "", isAIFC)
+			})
+		},
+		"COMM": func(d *decode.D) {
+			d.FieldS16("num_channels")
+			d.FieldU32("num_sample_frames")
+			d.FieldS16("sample_size")
+			d.FieldFFn("sample_rate", float80)
+			if isAIFC && d.NotEnd() {
+				d.FieldUTF8("compression_type", 4, compressionTypeNames)
+				fieldPString(d, "compression_name")
+			}
+		},
+		"FVER": func(d *decode.D) {
+			d.FieldU32("timestamp")
+		},
+		"SSND": func(d *decode.D) {
+			d.FieldU32("offset")
+			d.FieldU32("block_size")
+			d.FieldRawLen("samples", d.BitsLeft())
+		},
+		"MARK": func(d *decode.D) {
+			numMarkers := d.FieldU16("num_markers")
+			d.FieldArray("markers", func(d *decode.D) {
+				for i := uint64(0); i < numMarkers; i++ {
+					d.FieldStruct("marker", func(d *decode.D) {
+						d.FieldS16("id")
+						d.FieldU32("position")
+						fieldPString(d, "name")
+					})
+				}
+			})
+		},
+		"INST": func(d *decode.D) {
+			d.FieldS8("base_note")
+			d.FieldS8("detune")
+			d.FieldS8("low_note")
+			d.FieldS8("high_note")
+			d.FieldS8("low_velocity")
+			d.FieldS8("high_velocity")
+			d.FieldS16("gain")
+			d.FieldStruct("sustain_loop", decodeLoop)
+			d.FieldStruct("release_loop", decodeLoop)
+		},
+		"COMT": func(d *decode.D) {
+			numComments := d.FieldU16("num_comments")
+			d.FieldArray("comments", func(d *decode.D) {
+				for i := uint64(0); i < numComments; i++ {
+					d.FieldStruct("comment", func(d *decode.D) {
+						d.FieldU32("timestamp")
+						d.FieldS16("marker_id")
+						count := d.FieldU16("count")
+						d.FieldUTF8("text", int(count))
+						if count%2 != 0 {
+							d.FieldRawLen("align", 8)
+						}
+					})
+				}
+			})
+		},
+		"APPL": func(d *decode.D) {
+			d.FieldUTF8("signature", 4)
+			d.FieldRawLen("data", d.BitsLeft())
+		},
+		"ID3": func(d *decode.D) {
+			d.FieldFormatLen("data", d.BitsLeft(), id3v2Format, nil)
+		},
+	}
+	stringChunks := map[string]bool{
+		"NAME": true,
+		"AUTH": true,
+		"(c)":  true,
+		"ANNO": true,
+	}
+
+	chunkID := d.FieldStrFn("id", func(d *decode.D) string {
+		return d.UTF8(4)
+	}, scalar.TrimSpace)
+	if expectedChunkID != "" && chunkID != expectedChunkID {
+		d.Errorf("expected chunk id %q found %q", expectedChunkID, chunkID)
+	}
+	chunkLen := int64(d.FieldU32("size"))
+
+	if fn, ok := chunks[chunkID]; ok {
+		d.LenFn(chunkLen*8, fn)
+	} else if stringChunks[chunkID] {
+		if chunkLen*8 > d.BitsLeft() {
+			d.Fatalf("chunk size %d larger than input", chunkLen)
+		}
+		d.FieldUTF8("data", int(chunkLen))
+	} else {
+		d.FieldRawLen("data", chunkLen*8)
+	}
+
+	if chunkLen%2 != 0 && d.NotEnd() {
+		d.FieldRawLen("align", 8)
+	}
+}
+
+func aiffDecode(d *decode.D, in interface{}) interface{} {
+	decodeChunk(d, "FORM", false)
+
+	return nil
+}
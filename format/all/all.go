@@ -3,34 +3,94 @@
 package all
 
 import (
+	_ "github.com/wader/fq/format/ac3"
+	_ "github.com/wader/fq/format/aiff"
+	_ "github.com/wader/fq/format/android"
 	_ "github.com/wader/fq/format/ape"
 	_ "github.com/wader/fq/format/av1"
+	_ "github.com/wader/fq/format/bencode"
+	_ "github.com/wader/fq/format/bitcoin"
+	_ "github.com/wader/fq/format/bluetooth"
+	_ "github.com/wader/fq/format/bmp"
+	_ "github.com/wader/fq/format/bplist"
+	_ "github.com/wader/fq/format/bson"
 	_ "github.com/wader/fq/format/bzip2"
+	_ "github.com/wader/fq/format/can"
+	_ "github.com/wader/fq/format/cassandra"
+	_ "github.com/wader/fq/format/chrome"
+	_ "github.com/wader/fq/format/cue"
+	_ "github.com/wader/fq/format/dbus"
 	_ "github.com/wader/fq/format/dns"
+	_ "github.com/wader/fq/format/dtb"
+	_ "github.com/wader/fq/format/edid"
 	_ "github.com/wader/fq/format/elf"
+	_ "github.com/wader/fq/format/ethereum"
+	_ "github.com/wader/fq/format/evtx"
+	_ "github.com/wader/fq/format/ffmetadata"
+	_ "github.com/wader/fq/format/firefox"
 	_ "github.com/wader/fq/format/flac"
+	_ "github.com/wader/fq/format/gb"
 	_ "github.com/wader/fq/format/gif"
+	_ "github.com/wader/fq/format/git"
+	_ "github.com/wader/fq/format/gvariant"
 	_ "github.com/wader/fq/format/gzip"
+	_ "github.com/wader/fq/format/http2"
 	_ "github.com/wader/fq/format/icc"
+	_ "github.com/wader/fq/format/ico"
 	_ "github.com/wader/fq/format/id3"
 	_ "github.com/wader/fq/format/inet"
+	_ "github.com/wader/fq/format/intelhex"
+	_ "github.com/wader/fq/format/ipsec"
+	_ "github.com/wader/fq/format/iso9660"
 	_ "github.com/wader/fq/format/jpeg"
 	_ "github.com/wader/fq/format/json"
+	_ "github.com/wader/fq/format/lnk"
+	_ "github.com/wader/fq/format/lucene"
+	_ "github.com/wader/fq/format/m3u8"
 	_ "github.com/wader/fq/format/matroska"
+	_ "github.com/wader/fq/format/memcached"
+	_ "github.com/wader/fq/format/midi"
+	_ "github.com/wader/fq/format/minidump"
 	_ "github.com/wader/fq/format/mp3"
 	_ "github.com/wader/fq/format/mp4"
+	_ "github.com/wader/fq/format/mpd"
 	_ "github.com/wader/fq/format/mpeg"
+	_ "github.com/wader/fq/format/nes"
 	_ "github.com/wader/fq/format/ogg"
+	_ "github.com/wader/fq/format/opentype"
+	_ "github.com/wader/fq/format/openvpn"
 	_ "github.com/wader/fq/format/opus"
+	_ "github.com/wader/fq/format/ostree"
+	_ "github.com/wader/fq/format/otpauth"
 	_ "github.com/wader/fq/format/pcap"
+	_ "github.com/wader/fq/format/pgs"
 	_ "github.com/wader/fq/format/png"
 	_ "github.com/wader/fq/format/protobuf"
+	_ "github.com/wader/fq/format/psd"
+	_ "github.com/wader/fq/format/quic"
 	_ "github.com/wader/fq/format/raw"
+	_ "github.com/wader/fq/format/redis"
+	_ "github.com/wader/fq/format/regf"
+	_ "github.com/wader/fq/format/rtp"
+	_ "github.com/wader/fq/format/rtsp"
+	_ "github.com/wader/fq/format/sdp"
+	_ "github.com/wader/fq/format/squashfs"
+	_ "github.com/wader/fq/format/srec"
+	_ "github.com/wader/fq/format/stun"
 	_ "github.com/wader/fq/format/tar"
 	_ "github.com/wader/fq/format/tiff"
+	_ "github.com/wader/fq/format/tls"
+	_ "github.com/wader/fq/format/uboot"
+	_ "github.com/wader/fq/format/uf2"
+	_ "github.com/wader/fq/format/usb"
+	_ "github.com/wader/fq/format/vobsub"
 	_ "github.com/wader/fq/format/vorbis"
 	_ "github.com/wader/fq/format/vpx"
 	_ "github.com/wader/fq/format/wav"
 	_ "github.com/wader/fq/format/webp"
+	_ "github.com/wader/fq/format/websocket"
+	_ "github.com/wader/fq/format/wiredtiger"
+	_ "github.com/wader/fq/format/wireguard"
+	_ "github.com/wader/fq/format/woff"
 	_ "github.com/wader/fq/format/zip"
 )
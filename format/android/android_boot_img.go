@@ -0,0 +1,208 @@
+package android
+
+// https://android.googlesource.com/platform/system/tools/mkbootimg/+/refs/heads/master/include/bootimg/bootimg.h
+// https://android.googlesource.com/platform/system/tools/mkbootimg/+/refs/heads/master/mkbootimg.py
+// https://source.android.com/docs/core/architecture/bootloader/boot-image-header
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var probeFormat decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:          format.ANDROID_BOOT_IMG,
+		Description:   "Android boot image",
+		Groups:        []string{format.PROBE},
+		Magic:         []decode.Magic{{Bytes: []byte(bootMagic)}},
+		DecodeFn:      bootImgDecode,
+		EmbeddedFiles: bootImgEmbeddedFiles,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.PROBE}, Group: &probeFormat},
+		},
+	})
+}
+
+const bootMagic = "ANDROID!"
+
+const (
+	bootNameSize      = 16
+	bootArgsSize      = 512
+	bootExtraArgsSize = 1024
+	bootIDSize        = 32
+)
+
+// header version 3 and later have fixed page size
+const v3PageSize = 4096
+
+// header size up to and including fields for header version 0, 1 and 2
+var v0HeaderSizes = []int{1632, 1648, 1660}
+
+// os version is A.B.C (7 bits each) and patch level year-2000 (7 bits) and month (4 bits)
+var osVersionMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	uv, ok := s.Actual.(uint64)
+	if !ok || uv == 0 {
+		return s, nil
+	}
+	version := uv >> 11
+	patch := uv & 0x7ff
+	s.Description = fmt.Sprintf("%d.%d.%d %04d-%02d",
+		version>>14, (version>>7)&0x7f, version&0x7f, 2000+patch>>4, patch&0xf,
+	)
+	return s, nil
+})
+
+// image component stored after header, each starts at a page boundary
+type section struct {
+	name string
+	size uint64
+}
+
+func alignUp(n uint64, align uint64) uint64 {
+	return (n + align - 1) / align * align
+}
+
+// id is sha1 of each component followed by its size as 32 bit little endian
+func bootImgID(d *decode.D, pageSize uint64, sections []section) []byte {
+	h := sha1.New()
+	pos := pageSize
+	for _, s := range sections {
+		if pos*8+s.size*8 > uint64(d.Len()) {
+			d.Fatalf("%s: size %d outside image", s.name, s.size)
+		}
+		h.Write(d.BytesRange(int64(pos)*8, int(s.size)))
+		var sizeBuf [4]byte
+		binary.LittleEndian.PutUint32(sizeBuf[:], uint32(s.size))
+		h.Write(sizeBuf[:])
+		pos += alignUp(s.size, pageSize)
+	}
+	id := make([]byte, bootIDSize)
+	copy(id, h.Sum(nil))
+	return id
+}
+
+func decodeHeaderV0(d *decode.D, headerVersion uint64) (uint64, []section) {
+	hb := d.PeekBytes(v0HeaderSizes[headerVersion])
+	le32 := func(off int) uint64 { return uint64(binary.LittleEndian.Uint32(hb[off : off+4])) }
+	pageSize := le32(36)
+	if pageSize == 0 {
+		d.Fatalf("zero page size")
+	}
+	sections := []section{
+		{"kernel", le32(8)},
+		{"ramdisk", le32(16)},
+		{"second", le32(24)},
+	}
+	if headerVersion >= 1 {
+		sections = append(sections, section{"recovery_dtbo", le32(1632)})
+	}
+	if headerVersion >= 2 {
+		sections = append(sections, section{"dtb", le32(1648)})
+	}
+	id := bootImgID(d, pageSize, sections)
+
+	d.FieldUTF8("magic", len(bootMagic), d.AssertStr(bootMagic))
+	d.FieldU32("kernel_size")
+	d.FieldU32("kernel_addr", scalar.Hex)
+	d.FieldU32("ramdisk_size")
+	d.FieldU32("ramdisk_addr", scalar.Hex)
+	d.FieldU32("second_size")
+	d.FieldU32("second_addr", scalar.Hex)
+	d.FieldU32("tags_addr", scalar.Hex)
+	d.FieldU32("page_size")
+	d.FieldU32("header_version")
+	d.FieldU32("os_version", osVersionMap)
+	d.FieldUTF8NullFixedLen("name", bootNameSize)
+	d.FieldUTF8NullFixedLen("cmdline", bootArgsSize)
+	d.FieldChecksumRawLen("id", bootIDSize*8, "sha1", id)
+	d.FieldUTF8NullFixedLen("extra_cmdline", bootExtraArgsSize)
+	if headerVersion >= 1 {
+		d.FieldU32("recovery_dtbo_size")
+		d.FieldU64("recovery_dtbo_offset")
+		d.FieldU32("header_size")
+	}
+	if headerVersion >= 2 {
+		d.FieldU32("dtb_size")
+		d.FieldU64("dtb_addr", scalar.Hex)
+	}
+
+	return pageSize, sections
+}
+
+func decodeHeaderV3(d *decode.D, headerVersion uint64) (uint64, []section) {
+	d.FieldUTF8("magic", len(bootMagic), d.AssertStr(bootMagic))
+	kernelSize := d.FieldU32("kernel_size")
+	ramdiskSize := d.FieldU32("ramdisk_size")
+	d.FieldU32("os_version", osVersionMap)
+	d.FieldU32("header_size")
+	d.FieldRawLen("reserved", 4*32)
+	d.FieldU32("header_version")
+	d.FieldUTF8NullFixedLen("cmdline", bootArgsSize+bootExtraArgsSize)
+	sections := []section{
+		{"kernel", kernelSize},
+		{"ramdisk", ramdiskSize},
+	}
+	if headerVersion >= 4 {
+		signatureSize := d.FieldU32("signature_size")
+		sections = append(sections, section{"boot_signature", signatureSize})
+	}
+
+	return v3PageSize, sections
+}
+
+func fieldPadding(d *decode.D, name string, pageSize uint64) {
+	if n := d.AlignBits(int(pageSize * 8)); n > 0 {
+		d.FieldRawLen(name, int64(n))
+	}
+}
+
+func bootImgDecode(d *decode.D, in interface{}) interface{} {
+	d.Endian = decode.LittleEndian
+
+	headerVersion := uint64(binary.LittleEndian.Uint32(d.PeekBytes(44)[40:44]))
+	if headerVersion > 4 {
+		d.Fatalf("unsupported header version %d", headerVersion)
+	}
+
+	var pageSize uint64
+	var sections []section
+	d.FieldStruct("header", func(d *decode.D) {
+		if headerVersion < 3 {
+			pageSize, sections = decodeHeaderV0(d, headerVersion)
+		} else {
+			pageSize, sections = decodeHeaderV3(d, headerVersion)
+		}
+	})
+	fieldPadding(d, "header_padding", pageSize)
+
+	for _, s := range sections {
+		if s.size == 0 {
+			continue
+		}
+		nBits := int64(s.size) * 8
+		if dv, _, _ := d.TryFieldFormatLen(s.name, nBits, probeFormat, nil); dv == nil {
+			d.FieldRawLen(s.name, nBits)
+		}
+		fieldPadding(d, s.name+"_padding", pageSize)
+	}
+
+	return nil
+}
+
+func bootImgEmbeddedFiles(v *decode.Value) ([]decode.EmbeddedFile, error) {
+	var efs []decode.EmbeddedFile
+	for _, name := range []string{"kernel", "ramdisk", "second", "recovery_dtbo", "dtb", "boot_signature"} {
+		if dv := v.Child(name); dv != nil {
+			efs = append(efs, decode.EmbeddedFile{Name: name, Range: dv.Range})
+		}
+	}
+	return efs, nil
+}
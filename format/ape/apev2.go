@@ -1,11 +1,17 @@
 package ape
 
 // http://wiki.hydrogenaud.io/index.php?title=APE_Tags_Header
+// http://wiki.hydrogenaud.io/index.php?title=APE_Tags_Flags
+// http://wiki.hydrogenaud.io/index.php?title=APE_Tag_Item
 
 import (
+	"encoding/binary"
+	"strings"
+
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/registry"
 	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
 )
 
 var imageFormat decode.Group
@@ -21,59 +27,119 @@ func init() {
 	})
 }
 
-func apev2Decode(d *decode.D, in interface{}) interface{} {
-	d.Endian = decode.LittleEndian
+const (
+	preamble         = "APETAGEX"
+	headerFooterLen  = 32
+	itemCountOffset  = 16
+	maxItemCount     = 1000
+	itemTypeUTF8     = 0
+	itemTypeBinary   = 1
+	itemTypeExternal = 2
+	itemTypeReserved = 3
+)
+
+var itemTypeNames = scalar.UToSymStr{
+	itemTypeUTF8:     "utf8",
+	itemTypeBinary:   "binary",
+	itemTypeExternal: "external",
+	itemTypeReserved: "reserved",
+}
+
+type flags struct {
+	itemType         uint64
+	containsNoFooter bool
+}
+
+// flags are little endian, bit 0 is lowest bit of first byte
+func flagsFn(d *decode.D, name string, headerFooter bool) flags {
+	var f flags
+	d.FieldStruct(name, func(d *decode.D) {
+		d.FieldU5("unused0")
+		f.itemType = d.FieldU2("item_type", itemTypeNames)
+		d.FieldBool("read_only")
+		d.FieldU16("unused1")
+		if headerFooter {
+			d.FieldBool("contains_header")
+			f.containsNoFooter = d.FieldBool("contains_no_footer")
+			d.FieldBool("is_header")
+			d.FieldU5("unused2")
+		} else {
+			d.FieldU8("unused2")
+		}
+	})
+	return f
+}
 
-	headerFooterFn := func(d *decode.D, name string) uint64 {
-		var tagCount uint64
-		d.FieldStruct(name, func(d *decode.D) {
-			d.FieldUTF8("preamble", 8, d.AssertStr("APETAGEX"))
-			d.FieldU32("version")
-			d.FieldU32("tag_size")
-			tagCount = d.FieldU32("item_count")
-			d.FieldU32("flags")
-			d.FieldRawLen("reserved", 64, d.BitBufIsZero())
+func headerFooterFn(d *decode.D, name string) (uint64, flags) {
+	var itemCount uint64
+	var f flags
+	d.FieldStruct(name, func(d *decode.D) {
+		d.FieldUTF8("preamble", 8, d.AssertStr(preamble))
+		d.FieldU32("version", scalar.UToSymStr{1000: "apev1", 2000: "apev2"})
+		d.FieldU32("tag_size")
+		itemCount = d.FieldU32("item_count")
+		f = flagsFn(d, "flags", true)
+		d.FieldRawLen("reserved", 64, d.BitBufIsZero())
+	})
+	return itemCount, f
+}
+
+func itemFn(d *decode.D) {
+	itemSize := d.FieldU32("item_size")
+	f := flagsFn(d, "item_flags", false)
+	keyLen := d.PeekFindByte(0, -1)
+	key := d.FieldUTF8("key", int(keyLen))
+	d.FieldU8("key_terminator")
+	switch f.itemType {
+	case itemTypeUTF8, itemTypeExternal:
+		// multiple values are separated by a zero byte
+		d.FieldUTF8("value", int(itemSize))
+	default:
+		d.LenFn(int64(itemSize)*8, func(d *decode.D) {
+			// by convention cover art is a filename followed by image data
+			if strings.HasPrefix(strings.ToLower(key), "cover art") {
+				d.FieldUTF8Null("filename")
+				if dv, _, _ := d.TryFieldFormat("value", imageFormat, nil); dv != nil {
+					return
+				}
+			}
+			d.FieldRawLen("value", d.BitsLeft())
 		})
-		return tagCount
 	}
+}
+
+// tag is an optional header, items and an optional footer. APEv1 and some
+// APEv2 tags have no header so then item count is read from the footer.
+func apev2Decode(d *decode.D, in interface{}) interface{} {
+	d.Endian = decode.LittleEndian
 
-	tagCount := headerFooterFn(d, "header")
-	if tagCount > 1000 {
-		d.Fatalf("too many tags %d", tagCount)
+	var itemCount uint64
+	hasFooter := true
+	if string(d.PeekBytes(len(preamble))) == preamble {
+		var f flags
+		itemCount, f = headerFooterFn(d, "header")
+		hasFooter = !f.containsNoFooter
+	} else {
+		d.AssertAtLeastBitsLeft(headerFooterLen * 8)
+		fb := d.BytesRange(d.Len()-headerFooterLen*8, headerFooterLen)
+		if string(fb[0:len(preamble)]) != preamble {
+			d.Fatalf("no header or footer found")
+		}
+		itemCount = uint64(binary.LittleEndian.Uint32(fb[itemCountOffset:]))
+	}
+	if itemCount > maxItemCount {
+		d.Fatalf("too many items %d", itemCount)
 	}
 
 	d.FieldArray("tags", func(d *decode.D) {
-		for i := uint64(0); i < tagCount; i++ {
-			d.FieldStruct("tag", func(d *decode.D) {
-				itemSize := d.FieldU32("item_size")
-				var binaryItem bool
-				d.FieldStruct("item_flags", func(d *decode.D) {
-					d.FieldU6("unused0")
-					binaryItem = d.FieldBool("binary")
-					d.FieldU25("unused1")
-				})
-				keyLen := d.PeekFindByte(0, -1)
-				d.FieldUTF8("key", int(keyLen))
-				d.FieldU8("key_terminator")
-				if binaryItem {
-					d.LenFn(int64(itemSize)*8, func(d *decode.D) {
-						d.FieldUTF8Null("filename")
-						// assume image if binary
-						dv, _, _ := d.TryFieldFormat("value", imageFormat, nil)
-						if dv == nil {
-							// TODO: framed and unknown instead?
-							d.FieldRawLen("value", d.BitsLeft())
-						}
-					})
-				} else {
-					d.FieldUTF8("value", int(itemSize))
-				}
-			})
+		for i := uint64(0); i < itemCount; i++ {
+			d.FieldStruct("tag", itemFn)
 		}
 	})
 
-	// TODO: check footer flag
-	headerFooterFn(d, "footer")
+	if hasFooter {
+		headerFooterFn(d, "footer")
+	}
 
 	return nil
 }
@@ -5,6 +5,8 @@ package av1
 // https://cdn.rawgit.com/AOMediaCodec/av1-isobmff/v1.0.0/
 
 import (
+	"fmt"
+
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/registry"
 	"github.com/wader/fq/pkg/decode"
@@ -16,6 +18,9 @@ func init() {
 		Name:        format.AV1_CCR,
 		Description: "AV1 Codec Configuration Record",
 		DecodeFn:    ccrDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.AV1_OBU}, Group: &obuFormat},
+		},
 	})
 }
 
@@ -38,9 +43,21 @@ func ccrDecode(d *decode.D, in interface{}) interface{} {
 	} else {
 		d.FieldU4("reserved")
 	}
+	var out format.AV1CCROut
 	if d.BitsLeft() > 0 {
-		d.FieldRawLen("config_obus", d.BitsLeft())
+		d.FieldArray("config_obus", func(d *decode.D) {
+			for d.NotEnd() {
+				dv, v := d.FieldFormat("obu", obuFormat, nil)
+				obuOut, ok := v.(format.AV1OBUOut)
+				if dv != nil && !ok {
+					panic(fmt.Sprintf("expected AV1OBUOut got %#+v", v))
+				}
+				if obuOut.SequenceHeader != nil {
+					out.SequenceHeader = obuOut.SequenceHeader
+				}
+			}
+		})
 	}
 
-	return nil
+	return out
 }
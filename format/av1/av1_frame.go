@@ -5,6 +5,8 @@ package av1
 // "The OBUs in the Block follow the [Low Overhead Bitstream Format syntax]. They MUST have the [obu_has_size_field] set to 1 except for the last OBU in the frame, for which [obu_has_size_field] MAY be set to 0, in which case it is assumed to fill the remainder of the frame."
 
 import (
+	"fmt"
+
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/registry"
 	"github.com/wader/fq/pkg/decode"
@@ -26,8 +28,20 @@ func init() {
 }
 
 func frameDecode(d *decode.D, in interface{}) interface{} {
+	var sh *format.AV1SequenceHeader
+	if fi, ok := in.(format.AV1FrameIn); ok {
+		sh = fi.SequenceHeader
+	}
+
 	for d.NotEnd() {
-		d.FieldFormat("obu", obuFormat, nil)
+		dv, v := d.FieldFormat("obu", obuFormat, format.AV1OBUIn{SequenceHeader: sh})
+		obuOut, ok := v.(format.AV1OBUOut)
+		if dv != nil && !ok {
+			panic(fmt.Sprintf("expected AV1OBUOut got %#+v", v))
+		}
+		if obuOut.SequenceHeader != nil {
+			sh = obuOut.SequenceHeader
+		}
 	}
 
 	return nil
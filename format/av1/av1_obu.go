@@ -1,6 +1,8 @@
 package av1
 
 import (
+	"fmt"
+
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/registry"
 	"github.com/wader/fq/pkg/decode"
@@ -40,6 +42,63 @@ var obuTypeNames = scalar.UToSymStr{
 	OBU_PADDING:                "OBU_PADDING",
 }
 
+//nolint:revive
+const (
+	KEY_FRAME        = 0
+	INTER_FRAME      = 1
+	INTRA_ONLY_FRAME = 2
+	SWITCH_FRAME     = 3
+)
+
+var frameTypeNames = scalar.UToSymStr{
+	KEY_FRAME:        "KEY_FRAME",
+	INTER_FRAME:      "INTER_FRAME",
+	INTRA_ONLY_FRAME: "INTRA_ONLY_FRAME",
+	SWITCH_FRAME:     "SWITCH_FRAME",
+}
+
+var seqProfileNames = scalar.UToSymStr{
+	0: "main",
+	1: "high",
+	2: "professional",
+}
+
+// seq_level_idx 0-23 is level 2.0-7.3, 31 is no level restrictions
+var seqLevelIdxMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	u, ok := s.Actual.(uint64)
+	if !ok {
+		return s, nil
+	}
+	switch {
+	case u == 31:
+		s.Sym = "max"
+	case u <= 23:
+		s.Sym = fmt.Sprintf("%d.%d", 2+u>>2, u&3)
+	}
+	return s, nil
+})
+
+var chromaSamplePositionNames = scalar.UToScalar{
+	0: {Sym: "unknown", Description: "Unknown (in this case the source video transfer function must be signaled outside the AV1 bitstream)"},
+	1: {Sym: "vertical", Description: "Horizontally co-located with (0, 0) luma sample, vertical position in the middle between two luma samples"},
+	2: {Sym: "colocated", Description: "co-located with (0, 0) luma sample"},
+	3: {Sym: "reserved"},
+}
+
+const (
+	selectScreenContentTools = 2
+	selectIntegerMV          = 2
+	primaryRefNone           = 7
+	allFrames                = 0xff
+	numRefFrames             = 8
+	superresNum              = 8
+	superresDenomMin         = 9
+	superresDenomBits        = 3
+	colorPrimariesBT709      = 1
+	transferSRGB             = 13
+	matrixIdentity           = 0
+)
+
 func decodeLeb128(d *decode.D) uint64 {
 	var v uint64
 	for i := 0; i < 8; i++ {
@@ -52,21 +111,360 @@ func decodeLeb128(d *decode.D) uint64 {
 	return v
 }
 
+// variable length unsigned n-bit number
+func decodeUvlc(d *decode.D) uint64 {
+	leadingZeros := 0
+	for !d.Bool() {
+		leadingZeros++
+	}
+	if leadingZeros >= 32 {
+		return (1 << 32) - 1
+	}
+	return d.U(leadingZeros) + (1 << leadingZeros) - 1
+}
+
+func decodeTimingInfo(d *decode.D, sh *format.AV1SequenceHeader) {
+	d.FieldStruct("timing_info", func(d *decode.D) {
+		d.FieldU32("num_units_in_display_tick")
+		d.FieldU32("time_scale")
+		sh.EqualPictureInterval = d.FieldBool("equal_picture_interval")
+		if sh.EqualPictureInterval {
+			d.FieldUFn("num_ticks_per_picture", decodeUvlc, scalar.UAdd(1))
+		}
+	})
+}
+
+func decodeDecoderModelInfo(d *decode.D, sh *format.AV1SequenceHeader) int {
+	var bufferDelayLength int
+	d.FieldStruct("decoder_model_info", func(d *decode.D) {
+		bufferDelayLength = int(d.FieldU5("buffer_delay_length", scalar.UAdd(1)))
+		d.FieldU32("num_units_in_decoding_tick")
+		sh.BufferRemovalTimeLength = int(d.FieldU5("buffer_removal_time_length", scalar.UAdd(1)))
+		sh.FramePresentationTimeLength = int(d.FieldU5("frame_presentation_time_length", scalar.UAdd(1)))
+	})
+	return bufferDelayLength
+}
+
+func decodeColorConfig(d *decode.D, seqProfile uint64) {
+	d.FieldStruct("color_config", func(d *decode.D) {
+		bitDepth := 8
+		highBitdepth := d.FieldBool("high_bitdepth")
+		if seqProfile == 2 && highBitdepth {
+			if d.FieldBool("twelve_bit") {
+				bitDepth = 12
+			} else {
+				bitDepth = 10
+			}
+		} else if highBitdepth {
+			bitDepth = 10
+		}
+		d.FieldValueU("bit_depth", uint64(bitDepth))
+
+		monoChrome := false
+		if seqProfile != 1 {
+			monoChrome = d.FieldBool("mono_chrome")
+		}
+
+		colorPrimaries := uint64(2)
+		transferCharacteristics := uint64(2)
+		matrixCoefficients := uint64(2)
+		if d.FieldBool("color_description_present_flag") {
+			colorPrimaries = d.FieldU8("color_primaries", format.ISO_23091_2_ColourPrimariesMap)
+			transferCharacteristics = d.FieldU8("transfer_characteristics", format.ISO_23091_2_TransferCharacteristicMap)
+			matrixCoefficients = d.FieldU8("matrix_coefficients", format.ISO_23091_2_MatrixCoefficients)
+		}
+
+		switch {
+		case monoChrome:
+			d.FieldU1("color_range")
+			d.FieldValueU("subsampling_x", 1)
+			d.FieldValueU("subsampling_y", 1)
+			return
+		case colorPrimaries == colorPrimariesBT709 &&
+			transferCharacteristics == transferSRGB &&
+			matrixCoefficients == matrixIdentity:
+			d.FieldValueU("color_range", 1)
+			d.FieldValueU("subsampling_x", 0)
+			d.FieldValueU("subsampling_y", 0)
+		default:
+			d.FieldU1("color_range")
+			var subsamplingX, subsamplingY uint64
+			switch {
+			case seqProfile == 0:
+				subsamplingX, subsamplingY = 1, 1
+				d.FieldValueU("subsampling_x", subsamplingX)
+				d.FieldValueU("subsampling_y", subsamplingY)
+			case seqProfile == 1:
+				d.FieldValueU("subsampling_x", subsamplingX)
+				d.FieldValueU("subsampling_y", subsamplingY)
+			case bitDepth == 12:
+				subsamplingX = d.FieldU1("subsampling_x")
+				if subsamplingX == 1 {
+					subsamplingY = d.FieldU1("subsampling_y")
+				} else {
+					d.FieldValueU("subsampling_y", subsamplingY)
+				}
+			default:
+				subsamplingX = 1
+				d.FieldValueU("subsampling_x", subsamplingX)
+				d.FieldValueU("subsampling_y", subsamplingY)
+			}
+			if subsamplingX == 1 && subsamplingY == 1 {
+				d.FieldU2("chroma_sample_position", chromaSamplePositionNames)
+			}
+		}
+		d.FieldBool("separate_uv_delta_q")
+	})
+}
+
+func decodeSequenceHeader(d *decode.D) *format.AV1SequenceHeader {
+	sh := &format.AV1SequenceHeader{
+		SeqForceScreenContentTools: selectScreenContentTools,
+		SeqForceIntegerMV:          selectIntegerMV,
+	}
+
+	seqProfile := d.FieldU3("seq_profile", seqProfileNames)
+	d.FieldBool("still_picture")
+	sh.ReducedStillPictureHeader = d.FieldBool("reduced_still_picture_header")
+	if sh.ReducedStillPictureHeader {
+		d.FieldU5("seq_level_idx", seqLevelIdxMap)
+		sh.OperatingPointIDC = []uint64{0}
+		sh.DecoderModelPresentForOp = []bool{false}
+	} else {
+		bufferDelayLength := 0
+		if d.FieldBool("timing_info_present_flag") {
+			decodeTimingInfo(d, sh)
+			sh.DecoderModelInfoPresent = d.FieldBool("decoder_model_info_present_flag")
+			if sh.DecoderModelInfoPresent {
+				bufferDelayLength = decodeDecoderModelInfo(d, sh)
+			}
+		}
+		initialDisplayDelayPresent := d.FieldBool("initial_display_delay_present_flag")
+		operatingPointsCnt := d.FieldU5("operating_points_cnt", scalar.UAdd(1))
+		d.FieldArray("operating_points", func(d *decode.D) {
+			for i := uint64(0); i < operatingPointsCnt; i++ {
+				d.FieldStruct("operating_point", func(d *decode.D) {
+					sh.OperatingPointIDC = append(sh.OperatingPointIDC, d.FieldU12("idc", scalar.Hex))
+					seqLevelIdx := d.FieldU5("seq_level_idx", seqLevelIdxMap)
+					if seqLevelIdx > 7 {
+						d.FieldU1("seq_tier")
+					}
+					decoderModelPresent := false
+					if sh.DecoderModelInfoPresent {
+						decoderModelPresent = d.FieldBool("decoder_model_present_for_this_op")
+						if decoderModelPresent {
+							d.FieldStruct("operating_parameters_info", func(d *decode.D) {
+								d.FieldU("decoder_buffer_delay", bufferDelayLength)
+								d.FieldU("encoder_buffer_delay", bufferDelayLength)
+								d.FieldBool("low_delay_mode_flag")
+							})
+						}
+					}
+					sh.DecoderModelPresentForOp = append(sh.DecoderModelPresentForOp, decoderModelPresent)
+					if initialDisplayDelayPresent {
+						if d.FieldBool("initial_display_delay_present_for_this_op") {
+							d.FieldU4("initial_display_delay", scalar.UAdd(1))
+						}
+					}
+				})
+			}
+		})
+	}
+
+	sh.FrameWidthBits = int(d.FieldU4("frame_width_bits", scalar.UAdd(1)))
+	sh.FrameHeightBits = int(d.FieldU4("frame_height_bits", scalar.UAdd(1)))
+	sh.MaxFrameWidth = d.FieldU("max_frame_width", sh.FrameWidthBits, scalar.UAdd(1))
+	sh.MaxFrameHeight = d.FieldU("max_frame_height", sh.FrameHeightBits, scalar.UAdd(1))
+	if !sh.ReducedStillPictureHeader {
+		sh.FrameIDNumbersPresent = d.FieldBool("frame_id_numbers_present_flag")
+	}
+	if sh.FrameIDNumbersPresent {
+		deltaFrameIDLength := d.FieldU4("delta_frame_id_length", scalar.UAdd(2))
+		additionalFrameIDLength := d.FieldU3("additional_frame_id_length", scalar.UAdd(1))
+		sh.IDLen = int(additionalFrameIDLength + deltaFrameIDLength)
+	}
+	d.FieldBool("use_128x128_superblock")
+	d.FieldBool("enable_filter_intra")
+	d.FieldBool("enable_intra_edge_filter")
+	if !sh.ReducedStillPictureHeader {
+		d.FieldBool("enable_interintra_compound")
+		d.FieldBool("enable_masked_compound")
+		d.FieldBool("enable_warped_motion")
+		d.FieldBool("enable_dual_filter")
+		sh.EnableOrderHint = d.FieldBool("enable_order_hint")
+		if sh.EnableOrderHint {
+			d.FieldBool("enable_jnt_comp")
+			d.FieldBool("enable_ref_frame_mvs")
+		}
+		if !d.FieldBool("seq_choose_screen_content_tools") {
+			sh.SeqForceScreenContentTools = d.FieldU1("seq_force_screen_content_tools")
+		}
+		if sh.SeqForceScreenContentTools > 0 {
+			if !d.FieldBool("seq_choose_integer_mv") {
+				sh.SeqForceIntegerMV = d.FieldU1("seq_force_integer_mv")
+			}
+		}
+		if sh.EnableOrderHint {
+			sh.OrderHintBits = int(d.FieldU3("order_hint_bits", scalar.UAdd(1)))
+		}
+	}
+	sh.EnableSuperres = d.FieldBool("enable_superres")
+	d.FieldBool("enable_cdef")
+	d.FieldBool("enable_restoration")
+	decodeColorConfig(d, seqProfile)
+	d.FieldBool("film_grain_params_present")
+
+	return sh
+}
+
+// returns true if using superres
+func decodeFrameSize(d *decode.D, sh *format.AV1SequenceHeader, frameSizeOverride bool) bool {
+	frameWidth := sh.MaxFrameWidth
+	if frameSizeOverride {
+		frameWidth = d.FieldU("frame_width", sh.FrameWidthBits, scalar.UAdd(1))
+		d.FieldU("frame_height", sh.FrameHeightBits, scalar.UAdd(1))
+	} else {
+		d.FieldValueU("frame_width", sh.MaxFrameWidth)
+		d.FieldValueU("frame_height", sh.MaxFrameHeight)
+	}
+
+	useSuperres := false
+	if sh.EnableSuperres {
+		useSuperres = d.FieldBool("use_superres")
+	}
+	if useSuperres {
+		superresDenom := d.FieldU("coded_denom", superresDenomBits, scalar.UAdd(superresDenomMin))
+		d.FieldValueU("downscaled_width", (frameWidth*superresNum+superresDenom/2)/superresDenom)
+	}
+
+	if d.FieldBool("render_and_frame_size_different") {
+		d.FieldU16("render_width", scalar.UAdd(1))
+		d.FieldU16("render_height", scalar.UAdd(1))
+	}
+
+	return useSuperres
+}
+
+// decodes uncompressed header up to and including frame size for intra frames
+func decodeFrameHeader(d *decode.D, sh *format.AV1SequenceHeader, temporalID uint64, spatialID uint64) {
+	frameType := uint64(KEY_FRAME)
+	showFrame := true
+	errorResilientMode := true
+
+	temporalPointInfo := func(d *decode.D) {
+		if sh.DecoderModelInfoPresent && !sh.EqualPictureInterval {
+			d.FieldU("frame_presentation_time", sh.FramePresentationTimeLength)
+		}
+	}
+
+	if !sh.ReducedStillPictureHeader {
+		if d.FieldBool("show_existing_frame") {
+			d.FieldU3("frame_to_show_map_idx")
+			temporalPointInfo(d)
+			if sh.FrameIDNumbersPresent {
+				d.FieldU("display_frame_id", sh.IDLen)
+			}
+			// rest depends on state from previous frames
+			return
+		}
+		frameType = d.FieldU2("frame_type", frameTypeNames)
+		showFrame = d.FieldBool("show_frame")
+		if showFrame {
+			temporalPointInfo(d)
+		} else {
+			d.FieldBool("showable_frame")
+		}
+		if !(frameType == SWITCH_FRAME || (frameType == KEY_FRAME && showFrame)) {
+			errorResilientMode = d.FieldBool("error_resilient_mode")
+		}
+	}
+	frameIsIntra := frameType == INTRA_ONLY_FRAME || frameType == KEY_FRAME
+
+	d.FieldBool("disable_cdf_update")
+	allowScreenContentTools := sh.SeqForceScreenContentTools
+	if allowScreenContentTools == selectScreenContentTools {
+		allowScreenContentTools = d.FieldU1("allow_screen_content_tools")
+	}
+	if allowScreenContentTools > 0 && sh.SeqForceIntegerMV == selectIntegerMV {
+		d.FieldU1("force_integer_mv")
+	}
+	if sh.FrameIDNumbersPresent {
+		d.FieldU("current_frame_id", sh.IDLen)
+	}
+	frameSizeOverride := false
+	if frameType == SWITCH_FRAME {
+		frameSizeOverride = true
+	} else if !sh.ReducedStillPictureHeader {
+		frameSizeOverride = d.FieldBool("frame_size_override_flag")
+	}
+	if sh.OrderHintBits > 0 {
+		d.FieldU("order_hint", sh.OrderHintBits)
+	}
+	if !frameIsIntra && !errorResilientMode {
+		d.FieldU3("primary_ref_frame", scalar.UToSymStr{primaryRefNone: "none"})
+	}
+
+	if sh.DecoderModelInfoPresent {
+		if d.FieldBool("buffer_removal_time_present_flag") {
+			d.FieldArray("buffer_removal_times", func(d *decode.D) {
+				for i, idc := range sh.OperatingPointIDC {
+					if !sh.DecoderModelPresentForOp[i] {
+						continue
+					}
+					inTemporalLayer := (idc>>temporalID)&1 == 1
+					inSpatialLayer := (idc>>(spatialID+8))&1 == 1
+					if idc == 0 || (inTemporalLayer && inSpatialLayer) {
+						d.FieldU("buffer_removal_time", sh.BufferRemovalTimeLength)
+					}
+				}
+			})
+		}
+	}
+
+	refreshFrameFlags := uint64(allFrames)
+	if !(frameType == SWITCH_FRAME || (frameType == KEY_FRAME && showFrame)) {
+		refreshFrameFlags = d.FieldU8("refresh_frame_flags", scalar.Bin)
+	}
+	if (!frameIsIntra || refreshFrameFlags != allFrames) && errorResilientMode && sh.EnableOrderHint {
+		d.FieldArray("ref_order_hints", func(d *decode.D) {
+			for i := 0; i < numRefFrames; i++ {
+				d.FieldU("ref_order_hint", sh.OrderHintBits)
+			}
+		})
+	}
+
+	if !frameIsIntra {
+		// rest depends on reference frame state
+		return
+	}
+	useSuperres := decodeFrameSize(d, sh, frameSizeOverride)
+	// upscaled width equals frame width only when not using superres
+	if allowScreenContentTools > 0 && !useSuperres {
+		d.FieldBool("allow_intrabc")
+	}
+}
+
 func obuDecode(d *decode.D, in interface{}) interface{} {
+	var sh *format.AV1SequenceHeader
+	if oi, ok := in.(format.AV1OBUIn); ok {
+		sh = oi.SequenceHeader
+	}
+
 	var obuType uint64
 	var obuSize int64
-	hasExtension := false
+	var temporalID uint64
+	var spatialID uint64
 	hasSizeField := false
 
 	d.FieldStruct("header", func(d *decode.D) {
 		d.FieldU1("forbidden_bit")
 		obuType = d.FieldU4("type", obuTypeNames)
-		hasExtension = d.FieldBool("extension_flag")
+		hasExtension := d.FieldBool("extension_flag")
 		hasSizeField = d.FieldBool("has_size_field")
 		d.FieldU1("reserved_1bit")
 		if hasExtension {
-			d.FieldU3("temporal_id")
-			d.FieldU2("spatial_id")
+			temporalID = d.FieldU3("temporal_id")
+			spatialID = d.FieldU2("spatial_id")
 			d.FieldU3("extension_header_reserved_3bits")
 		}
 	})
@@ -75,16 +473,28 @@ func obuDecode(d *decode.D, in interface{}) interface{} {
 		obuSize = int64(d.FieldUFn("size", decodeLeb128))
 	} else {
 		obuSize = d.BitsLeft() / 8
-		if hasExtension {
-			obuSize--
-		}
 	}
 
-	_ = obuType
-
-	if d.BitsLeft() > 0 {
-		d.FieldRawLen("data", obuSize*8)
-	}
+	var out format.AV1OBUOut
+	d.LenFn(obuSize*8, func(d *decode.D) {
+		switch {
+		case obuType == OBU_SEQUENCE_HEADER:
+			d.FieldStruct("sequence_header", func(d *decode.D) {
+				out.SequenceHeader = decodeSequenceHeader(d)
+			})
+			if d.BitsLeft() > 0 {
+				d.FieldRawLen("trailing_bits", d.BitsLeft())
+			}
+		case sh != nil &&
+			(obuType == OBU_FRAME_HEADER || obuType == OBU_REDUNDANT_FRAME_HEADER || obuType == OBU_FRAME):
+			d.FieldStruct("frame_header", func(d *decode.D) {
+				decodeFrameHeader(d, sh, temporalID, spatialID)
+			})
+		}
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
 
-	return nil
+	return out
 }
@@ -0,0 +1,134 @@
+package bencode
+
+// https://www.bittorrent.org/beps/bep_0003.html#bencoding
+
+import (
+	"embed"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed *.jq
+var bencodeFS embed.FS
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.BENCODE,
+		Description: "BitTorrent bencoding",
+		DecodeFn:    bencodeDecode,
+		Files:       bencodeFS,
+	})
+}
+
+const (
+	typeDictionary = "d"
+	typeInteger    = "i"
+	typeList       = "l"
+	end            = 'e'
+	separator      = ':'
+)
+
+var typeNames = scalar.StrToSymStr{
+	typeDictionary: "dictionary",
+	typeInteger:    "integer",
+	typeList:       "list",
+}
+
+// int64 as text with sign
+const maxIntegerLen = 20
+
+// decodeStrIntUntil reads a decimal integer up to but not including b
+func decodeStrIntUntil(b byte) func(d *decode.D) int64 {
+	return func(d *decode.D) int64 {
+		n := d.PeekFindByte(b, maxIntegerLen+1)
+		if n < 1 {
+			d.Fatalf("integer not terminated by %q", b)
+		}
+		s := d.UTF8(int(n))
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			d.Fatalf("invalid integer %q: %s", s, err)
+		}
+		return v
+	}
+}
+
+type decoder struct {
+	// mappers for dictionary keys
+	keyMappers []scalar.Mapper
+	// mappers for integer and string values of dictionary keys
+	valueMappers map[string]scalar.Mapper
+	// decode string values of dictionary keys, ex split into fields
+	stringFns map[string]func(d *decode.D, length int64)
+}
+
+func (dr decoder) decodeString(d *decode.D, key string, sms ...scalar.Mapper) string {
+	length := d.FieldSFn("length", decodeStrIntUntil(separator))
+	d.FieldUTF8("separator", 1, d.AssertStr(string(separator)))
+	if length < 0 || length*8 > d.BitsLeft() {
+		d.Fatalf("invalid string length %d", length)
+	}
+	if fn, ok := dr.stringFns[key]; ok {
+		fn(d, length)
+		return ""
+	}
+	// binary strings, ex piece hashes, are raw. mappers expect strings so are only used for UTF-8
+	if !utf8.Valid(d.PeekBytes(int(length))) {
+		d.FieldRawLen("value", length*8)
+		return ""
+	}
+	return d.FieldUTF8("value", int(length), sms...)
+}
+
+// decodeValue decodes a value, key is the dictionary key for the value if any.
+// Returns keys if value is a dictionary.
+func (dr decoder) decodeValue(d *decode.D, key string) map[string]bool {
+	var sms []scalar.Mapper
+	if m, ok := dr.valueMappers[key]; ok {
+		sms = append(sms, m)
+	}
+
+	// strings start with their length
+	if c := d.PeekBits(8); c >= '0' && c <= '9' {
+		d.FieldValueStr("type", "string")
+		dr.decodeString(d, key, sms...)
+		return nil
+	}
+
+	var keys map[string]bool
+	switch typ := d.FieldUTF8("type", 1, typeNames); typ {
+	case typeDictionary:
+		keys = map[string]bool{}
+		d.FieldStructArrayLoop("pairs", "pair", func() bool { return d.PeekBits(8) != end }, func(d *decode.D) {
+			var key string
+			d.FieldStruct("key", func(d *decode.D) {
+				d.FieldValueStr("type", "string")
+				key = dr.decodeString(d, "", dr.keyMappers...)
+			})
+			keys[key] = true
+			d.FieldStruct("value", func(d *decode.D) { dr.decodeValue(d, key) })
+		})
+	case typeInteger:
+		d.FieldSFn("value", decodeStrIntUntil(end), sms...)
+	case typeList:
+		d.FieldStructArrayLoop("values", "value", func() bool { return d.PeekBits(8) != end }, func(d *decode.D) {
+			dr.decodeValue(d, "")
+		})
+	default:
+		d.Fatalf("unknown type %q", typ)
+	}
+	d.FieldUTF8("end", 1, d.AssertStr(string(end)))
+
+	return keys
+}
+
+func bencodeDecode(d *decode.D, in interface{}) interface{} {
+	decoder{}.decodeValue(d, "")
+
+	return nil
+}
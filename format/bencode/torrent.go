@@ -0,0 +1,84 @@
+package bencode
+
+// https://www.bittorrent.org/beps/bep_0003.html#metainfo-files
+// https://www.bittorrent.org/beps/bep_0012.html
+
+import (
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.TORRENT,
+		Description: "BitTorrent metainfo file",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte("d")}},
+		DecodeFn:    torrentDecode,
+	})
+}
+
+const pieceHashLen = 20
+
+var torrentKeyNames = scalar.StrToScalar{
+	"announce":      {Description: "Tracker URL"},
+	"announce-list": {Description: "Tracker URL tiers"},
+	"comment":       {Description: "Comment"},
+	"created by":    {Description: "Creating program"},
+	"creation date": {Description: "Creation time"},
+	"encoding":      {Description: "String encoding"},
+	"files":         {Description: "Files in multi-file torrent"},
+	"info":          {Description: "Info dictionary"},
+	"length":        {Description: "File length in bytes"},
+	"md5sum":        {Description: "File MD5"},
+	"name":          {Description: "Suggested file or directory name"},
+	"path":          {Description: "File path components"},
+	"piece length":  {Description: "Bytes per piece"},
+	"pieces":        {Description: "SHA-1 hashes of pieces"},
+	"private":       {Description: "Private torrent"},
+	"url-list":      {Description: "Web seed URLs"},
+}
+
+var unixTimeMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	sv, ok := s.Actual.(int64)
+	if !ok {
+		return s, nil
+	}
+	s.Description = time.Unix(sv, 0).UTC().Format(time.RFC3339)
+	return s, nil
+})
+
+var torrentDecoder = decoder{
+	keyMappers: []scalar.Mapper{torrentKeyNames},
+	valueMappers: map[string]scalar.Mapper{
+		"creation date": unixTimeMap,
+	},
+	stringFns: map[string]func(d *decode.D, length int64){
+		"pieces": func(d *decode.D, length int64) {
+			if length%pieceHashLen != 0 {
+				d.Fatalf("pieces length %d not a multiple of %d", length, pieceHashLen)
+			}
+			d.FieldArray("pieces", func(d *decode.D) {
+				for i := int64(0); i < length/pieceHashLen; i++ {
+					d.FieldRawLen("piece", pieceHashLen*8, scalar.RawHex)
+				}
+			})
+		},
+	},
+}
+
+func torrentDecode(d *decode.D, in interface{}) interface{} {
+	if d.PeekBits(8) != 'd' {
+		d.Fatalf("not a dictionary")
+	}
+	keys := torrentDecoder.decodeValue(d, "")
+	if !keys["info"] {
+		d.Fatalf("no info dictionary")
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package bitcoin
+
+// https://developer.bitcoin.org/reference/block_chain.html
+// https://en.bitcoin.it/wiki/Protocol_documentation
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+const hashLen = 32
+
+var unixTimeMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	uv, ok := s.Actual.(uint64)
+	if !ok || uv == 0 {
+		return s, nil
+	}
+	s.Description = time.Unix(int64(uv), 0).UTC().Format(time.RFC3339)
+	return s, nil
+})
+
+var satoshiMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	uv, ok := s.Actual.(uint64)
+	if !ok {
+		return s, nil
+	}
+	s.Description = fmt.Sprintf("%d.%08d BTC", uv/100_000_000, uv%100_000_000)
+	return s, nil
+})
+
+// compact size unsigned integer
+func readVarint(d *decode.D) uint64 {
+	switch n := d.U8(); n {
+	case 0xfd:
+		return d.U16LE()
+	case 0xfe:
+		return d.U32LE()
+	case 0xff:
+		return d.U64LE()
+	default:
+		return n
+	}
+}
+
+// hash used for block hashes and transaction ids, sha256 twice
+func doubleSHA256(bs ...[]byte) []byte {
+	h := sha256.New()
+	for _, b := range bs {
+		h.Write(b)
+	}
+	s := sha256.Sum256(h.Sum(nil))
+	return s[:]
+}
+
+// hexTextLen returns number of bytes if input is hex text with optional trailing
+// whitespace, ex a raw block or transaction copied from a block explorer
+func hexTextLen(d *decode.D) int {
+	const minLen = 8
+	if d.BitsLeft() < minLen*8 || d.BitsLeft()%8 != 0 {
+		return 0
+	}
+	b := d.PeekBytes(int(d.BitsLeft() / 8))
+	b = bytes.TrimRight(b, " \t\r\n")
+	if len(b) < minLen || len(b)%2 != 0 {
+		return 0
+	}
+	for _, c := range b {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return 0
+		}
+	}
+	return len(b)
+}
+
+// decodes hex text into a new root buffer and decodes it with fn
+func decodeHexText(d *decode.D, n int, fn func(d *decode.D)) {
+	hexBB := d.FieldRawLen("hex", int64(n)*8)
+	if d.NotEnd() {
+		d.FieldRawLen("trailing_whitespace", d.BitsLeft())
+	}
+	hexBytes, err := hexBB.Bytes()
+	if err != nil {
+		d.IOPanic(err, "hex")
+	}
+	b := make([]byte, hex.DecodedLen(len(hexBytes)))
+	if _, err := hex.Decode(b, hexBytes); err != nil {
+		d.Fatalf("invalid hex: %s", err)
+	}
+	d.FieldStructRootBitBufFn("decoded", bitio.NewBufferFromBytes(b, -1), func(d *decode.D) {
+		d.Endian = decode.LittleEndian
+		fn(d)
+	})
+}
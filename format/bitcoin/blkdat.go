@@ -0,0 +1,47 @@
+package bitcoin
+
+// blk*.dat files written by Bitcoin Core, blocks prefixed with network magic and size
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+)
+
+var blockFormat decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.BITCOIN_BLKDAT,
+		Description: "Bitcoin blk*.dat block file",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    blkdatDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.BITCOIN_BLOCK}, Group: &blockFormat},
+		},
+	})
+}
+
+func blkdatDecode(d *decode.D, in interface{}) interface{} {
+	d.Endian = decode.LittleEndian
+
+	var blockCount int
+	d.FieldArray("blocks", func(d *decode.D) {
+		for d.BitsLeft() >= 32 {
+			// files are preallocated and end with zeros
+			if d.PeekBits(32) == 0 {
+				break
+			}
+			d.FieldFormat("block", blockFormat, format.BitcoinBlockIn{HasHeader: true})
+			blockCount++
+		}
+	})
+	if blockCount == 0 {
+		d.Fatalf("no blocks found")
+	}
+	if d.NotEnd() {
+		d.FieldRawLen("padding", d.BitsLeft(), d.BitBufIsZero())
+	}
+
+	return nil
+}
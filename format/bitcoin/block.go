@@ -0,0 +1,80 @@
+package bitcoin
+
+// https://developer.bitcoin.org/reference/block_chain.html#block-headers
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var transactionFormat decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.BITCOIN_BLOCK,
+		Description: "Bitcoin block",
+		DecodeFn:    blockDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.BITCOIN_TRANSACTION}, Group: &transactionFormat},
+		},
+	})
+}
+
+const blockHeaderLen = 80
+
+var networkMagicNames = scalar.UToSymStr{
+	0xd9b4bef9: "mainnet",
+	0x0709110b: "testnet3",
+	0x283f161c: "testnet4",
+	0x40cf030a: "signet",
+	0xdab5bffa: "regtest",
+}
+
+func decodeBlock(d *decode.D) {
+	headerStart := d.Pos()
+	d.FieldStruct("header", func(d *decode.D) {
+		// bit field since BIP9
+		d.FieldU32("version", scalar.Hex)
+		d.FieldRawLen("previous_block_hash", hashLen*8, scalar.RawHexReverse)
+		d.FieldRawLen("merkle_root", hashLen*8, scalar.RawHexReverse)
+		d.FieldU32("time", unixTimeMap)
+		d.FieldU32("bits", scalar.Hex)
+		d.FieldU32("nonce")
+	})
+	d.FieldValueRaw("hash", doubleSHA256(bytesRange(d, headerStart, blockHeaderLen*8)), scalar.RawHexReverse)
+
+	transactionCount := d.FieldUFn("transaction_count", readVarint)
+	d.FieldArray("transactions", func(d *decode.D) {
+		for i := uint64(0); i < transactionCount; i++ {
+			d.FieldFormat("transaction", transactionFormat, nil)
+		}
+	})
+}
+
+func blockDecode(d *decode.D, in interface{}) interface{} {
+	d.Endian = decode.LittleEndian
+
+	bi, _ := in.(format.BitcoinBlockIn)
+	if bi.HasHeader {
+		d.FieldU32("magic", networkMagicNames, d.AssertU(
+			0xd9b4bef9,
+			0x0709110b,
+			0x283f161c,
+			0x40cf030a,
+			0xdab5bffa,
+		), scalar.Hex)
+		size := d.FieldU32("size")
+		d.LenFn(int64(size)*8, decodeBlock)
+		return nil
+	}
+
+	if n := hexTextLen(d); n > 0 {
+		decodeHexText(d, n, decodeBlock)
+		return nil
+	}
+	decodeBlock(d)
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package bitcoin
+
+// https://developer.bitcoin.org/reference/transactions.html
+// https://github.com/bitcoin/bips/blob/master/bip-0144.mediawiki
+
+import (
+	"bytes"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var scriptFormat decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.BITCOIN_TRANSACTION,
+		Description: "Bitcoin transaction",
+		DecodeFn:    transactionDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.BITCOIN_SCRIPT}, Group: &scriptFormat},
+		},
+	})
+}
+
+const coinbaseVout = 0xffffffff
+
+// lock time below is a block height otherwise unix time
+const lockTimeThreshold = 500_000_000
+
+var lockTimeMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	uv, ok := s.Actual.(uint64)
+	if !ok || uv == 0 {
+		return s, nil
+	}
+	if uv < lockTimeThreshold {
+		s.Description = "block height"
+		return s, nil
+	}
+	return unixTimeMap(s)
+})
+
+func bytesRange(d *decode.D, firstBit int64, nBits int64) []byte {
+	b, err := d.BitBufRange(firstBit, nBits).Bytes()
+	if err != nil {
+		d.IOPanic(err, "bytesRange")
+	}
+	return b
+}
+
+// script is decoded if valid otherwise raw, output scripts can be anything
+func fieldScript(d *decode.D, name string, length uint64) {
+	if length == 0 {
+		return
+	}
+	if _, _, err := d.TryFieldFormatLen(name, int64(length)*8, scriptFormat, nil); err != nil {
+		d.FieldRawLen(name, int64(length)*8)
+	}
+}
+
+func decodeTransaction(d *decode.D) {
+	start := d.Pos()
+	d.FieldS32("version")
+	var segwit bool
+	// marker is zero which would otherwise be input count
+	if d.PeekBits(8) == 0 {
+		d.FieldU8("marker")
+		d.FieldU8("flag", d.AssertU(1))
+		segwit = true
+	}
+
+	inputsStart := d.Pos()
+	inputCount := d.FieldUFn("input_count", readVarint)
+	d.FieldArray("inputs", func(d *decode.D) {
+		for i := uint64(0); i < inputCount; i++ {
+			d.FieldStruct("input", func(d *decode.D) {
+				txid := bytesRange(d, d.Pos(), hashLen*8)
+				d.FieldRawLen("txid", hashLen*8, scalar.RawHexReverse)
+				vout := d.FieldU32("vout")
+				scriptLength := d.FieldUFn("script_sig_length", readVarint)
+				if vout == coinbaseVout && bytes.Equal(txid, make([]byte, hashLen)) {
+					d.FieldRawLen("coinbase", int64(scriptLength)*8)
+				} else {
+					fieldScript(d, "script_sig", scriptLength)
+				}
+				d.FieldU32("sequence", scalar.Hex)
+			})
+		}
+	})
+	outputCount := d.FieldUFn("output_count", readVarint)
+	d.FieldArray("outputs", func(d *decode.D) {
+		for i := uint64(0); i < outputCount; i++ {
+			d.FieldStruct("output", func(d *decode.D) {
+				d.FieldU64("value", satoshiMap)
+				scriptLength := d.FieldUFn("script_pubkey_length", readVarint)
+				fieldScript(d, "script_pubkey", scriptLength)
+			})
+		}
+	})
+	inputsEnd := d.Pos()
+
+	if segwit {
+		// one witness per input
+		d.FieldArray("witnesses", func(d *decode.D) {
+			for i := uint64(0); i < inputCount; i++ {
+				d.FieldStruct("witness", func(d *decode.D) {
+					itemCount := d.FieldUFn("item_count", readVarint)
+					d.FieldArray("items", func(d *decode.D) {
+						for j := uint64(0); j < itemCount; j++ {
+							d.FieldStruct("item", func(d *decode.D) {
+								length := d.FieldUFn("length", readVarint)
+								d.FieldRawLen("data", int64(length)*8)
+							})
+						}
+					})
+				})
+			}
+		})
+	}
+
+	lockTimeStart := d.Pos()
+	d.FieldU32("lock_time", lockTimeMap)
+
+	// txid is hash of serialization without marker, flag and witnesses
+	d.FieldValueRaw("txid", doubleSHA256(
+		bytesRange(d, start, 32),
+		bytesRange(d, inputsStart, inputsEnd-inputsStart),
+		bytesRange(d, lockTimeStart, 32),
+	), scalar.RawHexReverse)
+	if segwit {
+		d.FieldValueRaw("wtxid", doubleSHA256(bytesRange(d, start, d.Pos()-start)), scalar.RawHexReverse)
+	}
+}
+
+func transactionDecode(d *decode.D, in interface{}) interface{} {
+	d.Endian = decode.LittleEndian
+
+	if n := hexTextLen(d); n > 0 {
+		decodeHexText(d, n, decodeTransaction)
+		return nil
+	}
+	decodeTransaction(d)
+
+	return nil
+}
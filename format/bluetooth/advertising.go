@@ -0,0 +1,211 @@
+package bluetooth
+
+// https://www.bluetooth.com/specifications/specs/core-specification-supplement/ Part A
+// https://www.bluetooth.com/specifications/assigned-numbers/ 2.3 Common Data Types
+
+import (
+	"fmt"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+const (
+	adTypeFlags                   = 0x01
+	adTypeIncomplete16BitUUIDs    = 0x02
+	adTypeComplete16BitUUIDs      = 0x03
+	adTypeIncomplete32BitUUIDs    = 0x04
+	adTypeComplete32BitUUIDs      = 0x05
+	adTypeIncomplete128BitUUIDs   = 0x06
+	adTypeComplete128BitUUIDs     = 0x07
+	adTypeShortenedLocalName      = 0x08
+	adTypeCompleteLocalName       = 0x09
+	adTypeTxPowerLevel            = 0x0a
+	adTypeClassOfDevice           = 0x0d
+	adTypePeripheralConnInterval  = 0x12
+	adTypeSolicitation16BitUUIDs  = 0x14
+	adTypeSolicitation128BitUUIDs = 0x15
+	adTypeServiceData16BitUUID    = 0x16
+	adTypePublicTargetAddress     = 0x17
+	adTypeRandomTargetAddress     = 0x18
+	adTypeAppearance              = 0x19
+	adTypeAdvertisingInterval     = 0x1a
+	adTypeSolicitation32BitUUIDs  = 0x1f
+	adTypeServiceData32BitUUID    = 0x20
+	adTypeServiceData128BitUUID   = 0x21
+	adTypeURI                     = 0x24
+	adTypeManufacturerData        = 0xff
+)
+
+var adTypeNames = scalar.UToSymStr{
+	adTypeFlags:                   "flags",
+	adTypeIncomplete16BitUUIDs:    "incomplete_16bit_service_uuids",
+	adTypeComplete16BitUUIDs:      "complete_16bit_service_uuids",
+	adTypeIncomplete32BitUUIDs:    "incomplete_32bit_service_uuids",
+	adTypeComplete32BitUUIDs:      "complete_32bit_service_uuids",
+	adTypeIncomplete128BitUUIDs:   "incomplete_128bit_service_uuids",
+	adTypeComplete128BitUUIDs:     "complete_128bit_service_uuids",
+	adTypeShortenedLocalName:      "shortened_local_name",
+	adTypeCompleteLocalName:       "complete_local_name",
+	adTypeTxPowerLevel:            "tx_power_level",
+	adTypeClassOfDevice:           "class_of_device",
+	0x0e:                          "simple_pairing_hash_c192",
+	0x0f:                          "simple_pairing_randomizer_r192",
+	0x10:                          "security_manager_tk_value",
+	0x11:                          "security_manager_oob_flags",
+	adTypePeripheralConnInterval:  "peripheral_connection_interval_range",
+	adTypeSolicitation16BitUUIDs:  "16bit_service_solicitation_uuids",
+	adTypeSolicitation128BitUUIDs: "128bit_service_solicitation_uuids",
+	adTypeServiceData16BitUUID:    "service_data_16bit_uuid",
+	adTypePublicTargetAddress:     "public_target_address",
+	adTypeRandomTargetAddress:     "random_target_address",
+	adTypeAppearance:              "appearance",
+	adTypeAdvertisingInterval:     "advertising_interval",
+	0x1b:                          "le_bluetooth_device_address",
+	0x1c:                          "le_role",
+	adTypeSolicitation32BitUUIDs:  "32bit_service_solicitation_uuids",
+	adTypeServiceData32BitUUID:    "service_data_32bit_uuid",
+	adTypeServiceData128BitUUID:   "service_data_128bit_uuid",
+	adTypeURI:                     "uri",
+	0x27:                          "le_supported_features",
+	0x2a:                          "mesh_message",
+	0x2b:                          "mesh_beacon",
+	0x30:                          "broadcast_name",
+	adTypeManufacturerData:        "manufacturer_specific_data",
+}
+
+// some common 16 bit service UUIDs
+var uuid16Names = scalar.UToSymStr{
+	0x1800: "generic_access",
+	0x1801: "generic_attribute",
+	0x180a: "device_information",
+	0x180d: "heart_rate",
+	0x180f: "battery",
+	0x1812: "human_interface_device",
+	0x181a: "environmental_sensing",
+	0x181c: "user_data",
+	0xfd6f: "exposure_notification",
+	0xfe9f: "google",
+	0xfeaa: "eddystone",
+}
+
+var coreVersionNames = scalar.UToSymStr{
+	0:  "1.0b",
+	1:  "1.1",
+	2:  "1.2",
+	3:  "2.0",
+	4:  "2.1",
+	5:  "3.0",
+	6:  "4.0",
+	7:  "4.1",
+	8:  "4.2",
+	9:  "5.0",
+	10: "5.1",
+	11: "5.2",
+	12: "5.3",
+	13: "5.4",
+}
+
+var dBmMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	s.Description = fmt.Sprintf("%d dBm", s.ActualS())
+	return s, nil
+})
+
+func decodeFlags(d *decode.D) {
+	// bits are numbered from least significant
+	d.FieldU3("reserved")
+	d.FieldBool("simultaneous_le_bredr_host")
+	d.FieldBool("simultaneous_le_bredr_controller")
+	d.FieldBool("bredr_not_supported")
+	d.FieldBool("le_general_discoverable_mode")
+	d.FieldBool("le_limited_discoverable_mode")
+	if d.NotEnd() {
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+}
+
+func decodeADData(d *decode.D, adType uint64) {
+	switch adType {
+	case adTypeFlags:
+		decodeFlags(d)
+	case adTypeIncomplete16BitUUIDs,
+		adTypeComplete16BitUUIDs,
+		adTypeSolicitation16BitUUIDs:
+		d.FieldArray("uuids", func(d *decode.D) {
+			for d.BitsLeft() >= 16 {
+				d.FieldU16("uuid", uuid16Names, scalar.Hex)
+			}
+		})
+	case adTypeIncomplete32BitUUIDs,
+		adTypeComplete32BitUUIDs,
+		adTypeSolicitation32BitUUIDs:
+		d.FieldArray("uuids", func(d *decode.D) {
+			for d.BitsLeft() >= 32 {
+				d.FieldU32("uuid", scalar.Hex)
+			}
+		})
+	case adTypeIncomplete128BitUUIDs,
+		adTypeComplete128BitUUIDs,
+		adTypeSolicitation128BitUUIDs:
+		d.FieldArray("uuids", func(d *decode.D) {
+			for d.BitsLeft() >= 128 {
+				fieldUUID128(d, "uuid")
+			}
+		})
+	case adTypeShortenedLocalName,
+		adTypeCompleteLocalName,
+		adTypeURI:
+		d.FieldUTF8("value", int(d.BitsLeft()/8))
+	case adTypeTxPowerLevel:
+		d.FieldS8("tx_power_level", dBmMap)
+	case adTypeClassOfDevice:
+		d.FieldU24("class_of_device", scalar.Hex)
+	case adTypePeripheralConnInterval:
+		d.FieldU16("connection_interval_min", connIntervalMap)
+		d.FieldU16("connection_interval_max", connIntervalMap)
+	case adTypeServiceData16BitUUID:
+		d.FieldU16("uuid", uuid16Names, scalar.Hex)
+		d.FieldRawLen("service_data", d.BitsLeft())
+	case adTypeServiceData32BitUUID:
+		d.FieldU32("uuid", scalar.Hex)
+		d.FieldRawLen("service_data", d.BitsLeft())
+	case adTypeServiceData128BitUUID:
+		fieldUUID128(d, "uuid")
+		d.FieldRawLen("service_data", d.BitsLeft())
+	case adTypePublicTargetAddress,
+		adTypeRandomTargetAddress:
+		d.FieldArray("addresses", func(d *decode.D) {
+			for d.BitsLeft() >= 48 {
+				fieldBDAddr(d, "address")
+			}
+		})
+	case adTypeAppearance:
+		d.FieldU16("appearance", scalar.Hex)
+	case adTypeAdvertisingInterval:
+		d.FieldU16("advertising_interval", intervalMap)
+	case adTypeManufacturerData:
+		d.FieldU16("company_identifier", companyIDNames, scalar.Hex)
+		d.FieldRawLen("manufacturer_data", d.BitsLeft())
+	}
+	if d.NotEnd() {
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+}
+
+// advertising and extended inquiry response data, sequence of length, type
+// and data. Zero length ends significant part and rest is padding.
+func decodeADStructures(d *decode.D) {
+	for d.NotEnd() {
+		if d.PeekBits(8) == 0 {
+			d.FieldRawLen("padding", d.BitsLeft())
+			break
+		}
+		d.FieldStruct("ad_structure", func(d *decode.D) {
+			length := d.FieldU8("length")
+			adType := d.FieldU8("type", adTypeNames, scalar.Hex)
+			d.LenFn(int64(length-1)*8, func(d *decode.D) {
+				decodeADData(d, adType)
+			})
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package bluetooth
+
+// https://fte.com/webhelpii/hsu/Content/Technical_Information/BT_Snoop_File_Format.htm
+// RFC 1761 snoop format with bluetooth specific datalink types
+
+import (
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var btsnoopHCIFormat decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.BTSNOOP,
+		Description: "Bluetooth HCI snoop log",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte("btsnoop\x00")}},
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.BLUETOOTH_HCI}, Group: &btsnoopHCIFormat},
+		},
+		DecodeFn: decodeBTSnoop,
+	})
+}
+
+var btsnoopMagic = []byte("btsnoop\x00")
+
+const (
+	datalinkH1           = 1001
+	datalinkH4           = 1002
+	datalinkBCSP         = 1003
+	datalinkH5           = 1004
+	datalinkLinuxMonitor = 2001
+)
+
+var datalinkNames = scalar.UToSymStr{
+	datalinkH1:           "h1",
+	datalinkH4:           "h4",
+	datalinkBCSP:         "bcsp",
+	datalinkH5:           "h5",
+	datalinkLinuxMonitor: "linux_monitor",
+}
+
+var commandOrDataNames = scalar.UToSymStr{
+	0: "data",
+	1: "command_or_event",
+}
+
+// microseconds since midnight January 1st year 0
+const btsnoopUnixEpochOffset = 0x00dcddb30f2f8000
+
+var btsnoopTimestampMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	us := s.ActualS() - btsnoopUnixEpochOffset
+	s.Description = time.Unix(us/1e6, us%1e6*1e3).UTC().Format(time.RFC3339Nano)
+	return s, nil
+})
+
+func decodeBTSnoop(d *decode.D, in interface{}) interface{} {
+	d.FieldRawLen("magic", int64(len(btsnoopMagic))*8, d.AssertBitBuf(btsnoopMagic))
+	d.FieldU32("version")
+	datalink := d.FieldU32("datalink", datalinkNames)
+
+	d.FieldArray("records", func(d *decode.D) {
+		for !d.End() {
+			d.FieldStruct("record", func(d *decode.D) {
+				d.FieldU32("original_length")
+				includedLength := d.FieldU32("included_length")
+				var commandOrData uint64
+				var direction uint64
+				d.FieldStruct("packet_flags", func(d *decode.D) {
+					d.FieldU30("reserved")
+					commandOrData = d.FieldU1("command_or_data", commandOrDataNames)
+					direction = d.FieldU1("direction", directionNames)
+				})
+				d.FieldU32("cumulative_drops")
+				d.FieldS64("timestamp", btsnoopTimestampMap)
+
+				var hciIn format.BluetoothHCIIn
+				switch datalink {
+				case datalinkH4:
+				case datalinkH1:
+					// no packet type indicator, sent commands, received events or ACL data
+					switch {
+					case commandOrData == 1 && direction == 0:
+						hciIn.PacketType = packetTypeCommand
+					case commandOrData == 1 && direction == 1:
+						hciIn.PacketType = packetTypeEvent
+					default:
+						hciIn.PacketType = packetTypeACLData
+					}
+				default:
+					d.FieldRawLen("packet", int64(includedLength)*8)
+					return
+				}
+				if dv, _, _ := d.TryFieldFormatLen("packet", int64(includedLength)*8, btsnoopHCIFormat, hciIn); dv == nil {
+					d.FieldRawLen("packet", int64(includedLength)*8)
+				}
+			})
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,199 @@
+package bluetooth
+
+// https://www.bluetooth.com/specifications/specs/core-specification/ Vol 4 Part E 7
+
+import (
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+// opcode group field is upper 6 bits and command field lower 10 bits
+const (
+	ogfLinkControl           = 0x01
+	ogfLinkPolicy            = 0x02
+	ogfControllerBaseband    = 0x03
+	ogfInformationalParams   = 0x04
+	ogfStatusParams          = 0x05
+	ogfTesting               = 0x06
+	ogfLEController          = 0x08
+	ogfVendorSpecific        = 0x3f
+	opcodeDisconnect         = 0x0406
+	opcodeReadLocalVersion   = 0x1001
+	opcodeReadBDAddr         = 0x1009
+	opcodeLESetRandomAddress = 0x2005
+	opcodeLESetAdvParams     = 0x2006
+	opcodeLESetAdvData       = 0x2008
+	opcodeLESetScanRespData  = 0x2009
+	opcodeLESetAdvEnable     = 0x200a
+	opcodeLESetScanParams    = 0x200b
+	opcodeLESetScanEnable    = 0x200c
+	opcodeLECreateConnection = 0x200d
+)
+
+var ogfNames = scalar.UToSymStr{
+	ogfLinkControl:         "link_control",
+	ogfLinkPolicy:          "link_policy",
+	ogfControllerBaseband:  "controller_baseband",
+	ogfInformationalParams: "informational_parameters",
+	ogfStatusParams:        "status_parameters",
+	ogfTesting:             "testing",
+	ogfLEController:        "le_controller",
+	ogfVendorSpecific:      "vendor_specific",
+}
+
+var opcodeNames = scalar.UToSymStr{
+	0x0000:                   "nop",
+	0x0401:                   "inquiry",
+	0x0402:                   "inquiry_cancel",
+	0x0405:                   "create_connection",
+	opcodeDisconnect:         "disconnect",
+	0x0409:                   "accept_connection_request",
+	0x040b:                   "link_key_request_reply",
+	0x040c:                   "link_key_request_negative_reply",
+	0x0411:                   "authentication_requested",
+	0x0413:                   "set_connection_encryption",
+	0x0419:                   "remote_name_request",
+	0x041b:                   "read_remote_supported_features",
+	0x041d:                   "read_remote_version_information",
+	0x0c01:                   "set_event_mask",
+	0x0c03:                   "reset",
+	0x0c05:                   "set_event_filter",
+	0x0c13:                   "write_local_name",
+	0x0c14:                   "read_local_name",
+	0x0c1a:                   "write_scan_enable",
+	0x0c24:                   "write_class_of_device",
+	0x0c45:                   "write_inquiry_mode",
+	0x0c52:                   "write_extended_inquiry_response",
+	0x0c56:                   "write_simple_pairing_mode",
+	0x0c6d:                   "write_le_host_support",
+	opcodeReadLocalVersion:   "read_local_version_information",
+	0x1002:                   "read_local_supported_commands",
+	0x1003:                   "read_local_supported_features",
+	0x1005:                   "read_buffer_size",
+	opcodeReadBDAddr:         "read_bd_addr",
+	0x2001:                   "le_set_event_mask",
+	0x2002:                   "le_read_buffer_size",
+	0x2003:                   "le_read_local_supported_features",
+	opcodeLESetRandomAddress: "le_set_random_address",
+	opcodeLESetAdvParams:     "le_set_advertising_parameters",
+	0x2007:                   "le_read_advertising_physical_channel_tx_power",
+	opcodeLESetAdvData:       "le_set_advertising_data",
+	opcodeLESetScanRespData:  "le_set_scan_response_data",
+	opcodeLESetAdvEnable:     "le_set_advertising_enable",
+	opcodeLESetScanParams:    "le_set_scan_parameters",
+	opcodeLESetScanEnable:    "le_set_scan_enable",
+	opcodeLECreateConnection: "le_create_connection",
+	0x200e:                   "le_create_connection_cancel",
+	0x200f:                   "le_read_filter_accept_list_size",
+	0x2010:                   "le_clear_filter_accept_list",
+	0x2011:                   "le_add_device_to_filter_accept_list",
+	0x2012:                   "le_remove_device_from_filter_accept_list",
+	0x2013:                   "le_connection_update",
+	0x2016:                   "le_read_remote_features",
+	0x2017:                   "le_encrypt",
+	0x2018:                   "le_rand",
+	0x2019:                   "le_enable_encryption",
+	0x201a:                   "le_long_term_key_request_reply",
+	0x201b:                   "le_long_term_key_request_negative_reply",
+	0x201c:                   "le_read_supported_states",
+	0x2036:                   "le_set_extended_advertising_parameters",
+	0x2037:                   "le_set_extended_advertising_data",
+	0x2038:                   "le_set_extended_scan_response_data",
+	0x2039:                   "le_set_extended_advertising_enable",
+	0x2041:                   "le_set_extended_scan_parameters",
+	0x2042:                   "le_set_extended_scan_enable",
+	0x2043:                   "le_extended_create_connection",
+}
+
+var advertisingTypeNames = scalar.UToSymStr{
+	0x00: "adv_ind",
+	0x01: "adv_direct_ind_high_duty_cycle",
+	0x02: "adv_scan_ind",
+	0x03: "adv_nonconn_ind",
+	0x04: "adv_direct_ind_low_duty_cycle",
+}
+
+var scanTypeNames = scalar.UToSymStr{
+	0x00: "passive",
+	0x01: "active",
+}
+
+// opcode and derived group and command fields
+func fieldOpcode(d *decode.D, name string) uint64 {
+	opcode := d.FieldU16(name, opcodeNames, scalar.Hex)
+	d.FieldValueU(name+"_group", opcode>>10, ogfNames)
+	d.FieldValueU(name+"_command", opcode&0x3ff, scalar.Hex)
+	return opcode
+}
+
+// advertising and scan response data is a length and fixed size 31 bytes
+func decodeAdvertisingDataParam(d *decode.D) {
+	length := d.FieldU8("data_length")
+	d.FieldArray("data", func(d *decode.D) {
+		d.LenFn(int64(length)*8, decodeADStructures)
+	})
+	if d.NotEnd() {
+		d.FieldRawLen("unused", d.BitsLeft())
+	}
+}
+
+func decodeCommandParameters(d *decode.D, opcode uint64) {
+	switch opcode {
+	case opcodeDisconnect:
+		d.FieldU16("connection_handle")
+		d.FieldU8("reason", errorCodeNames)
+	case opcodeLESetRandomAddress:
+		fieldBDAddr(d, "random_address")
+	case opcodeLESetAdvParams:
+		d.FieldU16("advertising_interval_min", intervalMap)
+		d.FieldU16("advertising_interval_max", intervalMap)
+		d.FieldU8("advertising_type", advertisingTypeNames)
+		d.FieldU8("own_address_type", addressTypeNames)
+		d.FieldU8("peer_address_type", addressTypeNames)
+		fieldBDAddr(d, "peer_address")
+		d.FieldU8("advertising_channel_map", scalar.Bin)
+		d.FieldU8("advertising_filter_policy")
+	case opcodeLESetAdvData,
+		opcodeLESetScanRespData:
+		decodeAdvertisingDataParam(d)
+	case opcodeLESetAdvEnable:
+		d.FieldU8("advertising_enable")
+	case opcodeLESetScanParams:
+		d.FieldU8("le_scan_type", scanTypeNames)
+		d.FieldU16("le_scan_interval", intervalMap)
+		d.FieldU16("le_scan_window", intervalMap)
+		d.FieldU8("own_address_type", addressTypeNames)
+		d.FieldU8("scanning_filter_policy")
+	case opcodeLESetScanEnable:
+		d.FieldU8("le_scan_enable")
+		d.FieldU8("filter_duplicates")
+	case opcodeLECreateConnection:
+		d.FieldU16("le_scan_interval", intervalMap)
+		d.FieldU16("le_scan_window", intervalMap)
+		d.FieldU8("initiator_filter_policy")
+		d.FieldU8("peer_address_type", addressTypeNames)
+		fieldBDAddr(d, "peer_address")
+		d.FieldU8("own_address_type", addressTypeNames)
+		d.FieldU16("connection_interval_min", connIntervalMap)
+		d.FieldU16("connection_interval_max", connIntervalMap)
+		d.FieldU16("max_latency")
+		d.FieldU16("supervision_timeout", supervisionTimeoutMap)
+		d.FieldU16("min_ce_length", intervalMap)
+		d.FieldU16("max_ce_length", intervalMap)
+	default:
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+}
+
+func decodeCommand(d *decode.D) {
+	opcode := fieldOpcode(d, "opcode")
+	length := d.FieldU8("parameter_total_length")
+	if length == 0 {
+		return
+	}
+	d.FieldStruct("parameters", func(d *decode.D) {
+		d.LenFn(int64(length)*8, func(d *decode.D) {
+			decodeCommandParameters(d, opcode)
+		})
+	})
+}
@@ -0,0 +1,309 @@
+package bluetooth
+
+// https://www.bluetooth.com/specifications/specs/core-specification/ Vol 4 Part E 7.7
+// https://www.bluetooth.com/specifications/specs/core-specification/ Vol 1 Part F error codes
+
+import (
+	"fmt"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+const (
+	eventConnectionComplete        = 0x03
+	eventDisconnectionComplete     = 0x05
+	eventEncryptionChange          = 0x08
+	eventCommandComplete           = 0x0e
+	eventCommandStatus             = 0x0f
+	eventHardwareError             = 0x10
+	eventNumberOfCompletedPackets  = 0x13
+	eventLEMeta                    = 0x3e
+	leSubeventConnectionComplete   = 0x01
+	leSubeventAdvertisingReport    = 0x02
+	leSubeventConnUpdateComplete   = 0x03
+	leSubeventLongTermKeyRequest   = 0x05
+	leSubeventExtAdvertisingReport = 0x0d
+)
+
+var eventCodeNames = scalar.UToSymStr{
+	0x01:                          "inquiry_complete",
+	0x02:                          "inquiry_result",
+	eventConnectionComplete:       "connection_complete",
+	0x04:                          "connection_request",
+	eventDisconnectionComplete:    "disconnection_complete",
+	0x06:                          "authentication_complete",
+	0x07:                          "remote_name_request_complete",
+	eventEncryptionChange:         "encryption_change",
+	0x0b:                          "read_remote_supported_features_complete",
+	0x0c:                          "read_remote_version_information_complete",
+	eventCommandComplete:          "command_complete",
+	eventCommandStatus:            "command_status",
+	eventHardwareError:            "hardware_error",
+	eventNumberOfCompletedPackets: "number_of_completed_packets",
+	0x1a:                          "data_buffer_overflow",
+	0x2f:                          "extended_inquiry_result",
+	0x30:                          "encryption_key_refresh_complete",
+	eventLEMeta:                   "le_meta",
+	0xff:                          "vendor_specific",
+}
+
+var leSubeventNames = scalar.UToSymStr{
+	leSubeventConnectionComplete:   "le_connection_complete",
+	leSubeventAdvertisingReport:    "le_advertising_report",
+	leSubeventConnUpdateComplete:   "le_connection_update_complete",
+	0x04:                           "le_read_remote_features_complete",
+	leSubeventLongTermKeyRequest:   "le_long_term_key_request",
+	0x0a:                           "le_enhanced_connection_complete",
+	leSubeventExtAdvertisingReport: "le_extended_advertising_report",
+}
+
+var errorCodeNames = scalar.UToSymStr{
+	0x00: "success",
+	0x01: "unknown_hci_command",
+	0x02: "unknown_connection_identifier",
+	0x03: "hardware_failure",
+	0x04: "page_timeout",
+	0x05: "authentication_failure",
+	0x06: "pin_or_key_missing",
+	0x07: "memory_capacity_exceeded",
+	0x08: "connection_timeout",
+	0x09: "connection_limit_exceeded",
+	0x0a: "synchronous_connection_limit_exceeded",
+	0x0b: "connection_already_exists",
+	0x0c: "command_disallowed",
+	0x0d: "connection_rejected_limited_resources",
+	0x0e: "connection_rejected_security_reasons",
+	0x0f: "connection_rejected_unacceptable_bd_addr",
+	0x10: "connection_accept_timeout_exceeded",
+	0x11: "unsupported_feature_or_parameter_value",
+	0x12: "invalid_hci_command_parameters",
+	0x13: "remote_user_terminated_connection",
+	0x14: "remote_device_terminated_connection_low_resources",
+	0x15: "remote_device_terminated_connection_power_off",
+	0x16: "connection_terminated_by_local_host",
+	0x1a: "unsupported_remote_feature",
+	0x1f: "unspecified_error",
+	0x22: "lmp_ll_response_timeout",
+	0x28: "instant_passed",
+	0x3b: "unacceptable_connection_parameters",
+	0x3c: "advertising_timeout",
+	0x3d: "connection_terminated_mic_failure",
+	0x3e: "connection_failed_to_be_established",
+}
+
+var roleNames = scalar.UToSymStr{
+	0x00: "central",
+	0x01: "peripheral",
+}
+
+var linkTypeNames = scalar.UToSymStr{
+	0x00: "sco",
+	0x01: "acl",
+	0x02: "esco",
+}
+
+var legacyAdvEventTypeNames = scalar.UToSymStr{
+	0x00: "adv_ind",
+	0x01: "adv_direct_ind",
+	0x02: "adv_scan_ind",
+	0x03: "adv_nonconn_ind",
+	0x04: "scan_rsp",
+}
+
+var phyNames = scalar.UToSymStr{
+	0x00: "none",
+	0x01: "le_1m",
+	0x02: "le_2m",
+	0x03: "le_coded",
+}
+
+// some common manufacturer and company identifiers
+var companyIDNames = scalar.UToSymStr{
+	0x0000: "ericsson",
+	0x0002: "intel",
+	0x0006: "microsoft",
+	0x000a: "qualcomm",
+	0x000d: "texas_instruments",
+	0x000f: "broadcom",
+	0x001d: "qualcomm",
+	0x004c: "apple",
+	0x0059: "nordic_semiconductor",
+	0x0075: "samsung",
+	0x0087: "garmin",
+	0x00e0: "google",
+	0x0131: "cypress",
+	0x02e5: "espressif",
+}
+
+func unitMap(unit float64, unitName string) scalar.Mapper {
+	return scalar.Fn(func(s scalar.S) (scalar.S, error) {
+		s.Description = fmt.Sprintf("%g %s", float64(s.ActualU())*unit, unitName)
+		return s, nil
+	})
+}
+
+var (
+	intervalMap           = unitMap(0.625, "ms")
+	connIntervalMap       = unitMap(1.25, "ms")
+	supervisionTimeoutMap = unitMap(10, "ms")
+)
+
+func decodeCommandComplete(d *decode.D) {
+	d.FieldU8("num_hci_command_packets")
+	opcode := fieldOpcode(d, "command_opcode")
+	if !d.NotEnd() {
+		return
+	}
+	d.FieldStruct("return_parameters", func(d *decode.D) {
+		d.FieldU8("status", errorCodeNames)
+		switch opcode {
+		case opcodeReadLocalVersion:
+			d.FieldU8("hci_version", coreVersionNames)
+			d.FieldU16("hci_subversion")
+			d.FieldU8("lmp_version", coreVersionNames)
+			d.FieldU16("company_identifier", companyIDNames, scalar.Hex)
+			d.FieldU16("lmp_subversion")
+		case opcodeReadBDAddr:
+			fieldBDAddr(d, "bd_addr")
+		default:
+			if d.NotEnd() {
+				d.FieldRawLen("data", d.BitsLeft())
+			}
+		}
+	})
+}
+
+func decodeLEAdvertisingReport(d *decode.D) {
+	numReports := d.FieldU8("num_reports")
+	d.FieldArray("reports", func(d *decode.D) {
+		for i := uint64(0); i < numReports; i++ {
+			d.FieldStruct("report", func(d *decode.D) {
+				d.FieldU8("event_type", legacyAdvEventTypeNames)
+				d.FieldU8("address_type", addressTypeNames)
+				fieldBDAddr(d, "address")
+				length := d.FieldU8("data_length")
+				d.FieldArray("data", func(d *decode.D) {
+					d.LenFn(int64(length)*8, decodeADStructures)
+				})
+				d.FieldS8("rssi", dBmMap)
+			})
+		}
+	})
+}
+
+func decodeLEExtendedAdvertisingReport(d *decode.D) {
+	numReports := d.FieldU8("num_reports")
+	d.FieldArray("reports", func(d *decode.D) {
+		for i := uint64(0); i < numReports; i++ {
+			d.FieldStruct("report", func(d *decode.D) {
+				eventType := d.FieldU16("event_type", scalar.Bin)
+				d.FieldValueBool("connectable", eventType&0x01 != 0)
+				d.FieldValueBool("scannable", eventType&0x02 != 0)
+				d.FieldValueBool("directed", eventType&0x04 != 0)
+				d.FieldValueBool("scan_response", eventType&0x08 != 0)
+				d.FieldValueBool("legacy", eventType&0x10 != 0)
+				d.FieldU8("address_type", addressTypeNames)
+				fieldBDAddr(d, "address")
+				d.FieldU8("primary_phy", phyNames)
+				d.FieldU8("secondary_phy", phyNames)
+				d.FieldU8("advertising_sid")
+				d.FieldS8("tx_power", dBmMap)
+				d.FieldS8("rssi", dBmMap)
+				d.FieldU16("periodic_advertising_interval", connIntervalMap)
+				d.FieldU8("direct_address_type", addressTypeNames)
+				fieldBDAddr(d, "direct_address")
+				length := d.FieldU8("data_length")
+				d.FieldArray("data", func(d *decode.D) {
+					d.LenFn(int64(length)*8, decodeADStructures)
+				})
+			})
+		}
+	})
+}
+
+func decodeLEMeta(d *decode.D) {
+	subevent := d.FieldU8("subevent_code", leSubeventNames, scalar.Hex)
+	switch subevent {
+	case leSubeventConnectionComplete:
+		d.FieldU8("status", errorCodeNames)
+		d.FieldU16("connection_handle")
+		d.FieldU8("role", roleNames)
+		d.FieldU8("peer_address_type", addressTypeNames)
+		fieldBDAddr(d, "peer_address")
+		d.FieldU16("connection_interval", connIntervalMap)
+		d.FieldU16("peripheral_latency")
+		d.FieldU16("supervision_timeout", supervisionTimeoutMap)
+		d.FieldU8("central_clock_accuracy")
+	case leSubeventAdvertisingReport:
+		decodeLEAdvertisingReport(d)
+	case leSubeventConnUpdateComplete:
+		d.FieldU8("status", errorCodeNames)
+		d.FieldU16("connection_handle")
+		d.FieldU16("connection_interval", connIntervalMap)
+		d.FieldU16("peripheral_latency")
+		d.FieldU16("supervision_timeout", supervisionTimeoutMap)
+	case leSubeventLongTermKeyRequest:
+		d.FieldU16("connection_handle")
+		d.FieldU64("random_number", scalar.Hex)
+		d.FieldU16("encrypted_diversifier", scalar.Hex)
+	case leSubeventExtAdvertisingReport:
+		decodeLEExtendedAdvertisingReport(d)
+	default:
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+}
+
+func decodeEventParameters(d *decode.D, eventCode uint64) {
+	switch eventCode {
+	case eventConnectionComplete:
+		d.FieldU8("status", errorCodeNames)
+		d.FieldU16("connection_handle")
+		fieldBDAddr(d, "bd_addr")
+		d.FieldU8("link_type", linkTypeNames)
+		d.FieldU8("encryption_enabled")
+	case eventDisconnectionComplete:
+		d.FieldU8("status", errorCodeNames)
+		d.FieldU16("connection_handle")
+		d.FieldU8("reason", errorCodeNames)
+	case eventEncryptionChange:
+		d.FieldU8("status", errorCodeNames)
+		d.FieldU16("connection_handle")
+		d.FieldU8("encryption_enabled")
+	case eventCommandComplete:
+		decodeCommandComplete(d)
+	case eventCommandStatus:
+		d.FieldU8("status", errorCodeNames)
+		d.FieldU8("num_hci_command_packets")
+		fieldOpcode(d, "command_opcode")
+	case eventHardwareError:
+		d.FieldU8("hardware_code", scalar.Hex)
+	case eventNumberOfCompletedPackets:
+		numHandles := d.FieldU8("num_handles")
+		d.FieldArray("handles", func(d *decode.D) {
+			for i := uint64(0); i < numHandles; i++ {
+				d.FieldStruct("handle", func(d *decode.D) {
+					d.FieldU16("connection_handle")
+					d.FieldU16("num_completed_packets")
+				})
+			}
+		})
+	case eventLEMeta:
+		decodeLEMeta(d)
+	default:
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+}
+
+func decodeEvent(d *decode.D) {
+	eventCode := d.FieldU8("event_code", eventCodeNames, scalar.Hex)
+	length := d.FieldU8("parameter_total_length")
+	if length == 0 {
+		return
+	}
+	d.FieldStruct("parameters", func(d *decode.D) {
+		d.LenFn(int64(length)*8, func(d *decode.D) {
+			decodeEventParameters(d, eventCode)
+		})
+	})
+}
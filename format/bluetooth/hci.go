@@ -0,0 +1,184 @@
+package bluetooth
+
+// https://www.bluetooth.com/specifications/specs/core-specification/ Vol 4 Part A and Vol 4 Part E
+// https://www.tcpdump.org/linktypes/LINKTYPE_BLUETOOTH_HCI_H4_WITH_PHDR.html
+
+// TODO: decode L2CAP signaling, ATT and SMP payloads
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.BLUETOOTH_HCI,
+		Description: "Bluetooth HCI packet",
+		Groups:      []string{format.LINK_FRAME},
+		DecodeFn:    decodeHCI,
+	})
+}
+
+// H4 UART packet indicators
+const (
+	packetTypeCommand = 0x01
+	packetTypeACLData = 0x02
+	packetTypeSCOData = 0x03
+	packetTypeEvent   = 0x04
+	packetTypeISOData = 0x05
+)
+
+var packetTypeNames = scalar.UToSymStr{
+	packetTypeCommand: "command",
+	packetTypeACLData: "acl_data",
+	packetTypeSCOData: "sco_data",
+	packetTypeEvent:   "event",
+	packetTypeISOData: "iso_data",
+}
+
+var directionNames = scalar.UToSymStr{
+	0: "sent",
+	1: "received",
+}
+
+var packetBoundaryFlagNames = scalar.UToSymStr{
+	0b00: "first_non_automatically_flushable",
+	0b01: "continuing_fragment",
+	0b10: "first_automatically_flushable",
+	0b11: "complete",
+}
+
+var broadcastFlagNames = scalar.UToSymStr{
+	0b00: "point_to_point",
+	0b01: "bredr_broadcast",
+}
+
+var l2capChannelNames = scalar.UToSymStr{
+	0x0001: "l2cap_signaling",
+	0x0002: "connectionless",
+	0x0003: "amp_manager",
+	0x0004: "att",
+	0x0005: "le_l2cap_signaling",
+	0x0006: "smp",
+	0x0007: "bredr_smp",
+}
+
+var addressTypeNames = scalar.UToSymStr{
+	0x00: "public",
+	0x01: "random",
+	0x02: "public_identity",
+	0x03: "random_identity",
+}
+
+// device address is little endian, show most significant byte first
+var bdAddrMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], s.ActualU())
+	s.Sym = fmt.Sprintf("%.2x:%.2x:%.2x:%.2x:%.2x:%.2x", b[2], b[3], b[4], b[5], b[6], b[7])
+	return s, nil
+})
+
+func fieldBDAddr(d *decode.D, name string) {
+	d.FieldU48(name, bdAddrMap, scalar.Hex)
+}
+
+// 128 bit UUID is little endian, show as usual UUID string
+func fieldUUID128(d *decode.D, name string) {
+	d.FieldStrFn(name, func(d *decode.D) string {
+		b := d.BytesLen(16)
+		var r [16]byte
+		for i := range b {
+			r[15-i] = b[i]
+		}
+		return fmt.Sprintf("%x-%x-%x-%x-%x", r[0:4], r[4:6], r[6:8], r[8:10], r[10:16])
+	})
+}
+
+func decodeACLData(d *decode.D) {
+	flags := d.FieldU16("handle_and_flags", scalar.Hex)
+	d.FieldValueU("connection_handle", flags&0xfff)
+	packetBoundary := flags >> 12 & 0b11
+	d.FieldValueU("packet_boundary_flag", packetBoundary, packetBoundaryFlagNames)
+	d.FieldValueU("broadcast_flag", flags>>14&0b11, broadcastFlagNames)
+	length := d.FieldU16("data_total_length")
+
+	// start of L2CAP PDU has a basic header, continuing fragments are raw
+	if packetBoundary == 0b01 || length < 4 {
+		d.FieldRawLen("data", int64(length)*8)
+		return
+	}
+	d.FieldStruct("l2cap", func(d *decode.D) {
+		d.LenFn(int64(length)*8, func(d *decode.D) {
+			d.FieldU16("length")
+			d.FieldU16("channel_id", l2capChannelNames, scalar.Hex)
+			d.FieldRawLen("payload", d.BitsLeft())
+		})
+	})
+}
+
+func decodeSCOData(d *decode.D) {
+	flags := d.FieldU16("handle_and_flags", scalar.Hex)
+	d.FieldValueU("connection_handle", flags&0xfff)
+	d.FieldValueU("packet_status_flag", flags>>12&0b11)
+	length := d.FieldU8("data_total_length")
+	d.FieldRawLen("data", int64(length)*8)
+}
+
+func decodeISOData(d *decode.D) {
+	flags := d.FieldU16("handle_and_flags", scalar.Hex)
+	d.FieldValueU("connection_handle", flags&0xfff)
+	d.FieldValueU("packet_boundary_flag", flags>>12&0b11)
+	d.FieldValueU("timestamp_flag", flags>>14&0b1)
+	length := d.FieldU16("data_total_length") & 0x3fff
+	d.FieldRawLen("data", int64(length)*8)
+}
+
+func decodeHCIPacket(d *decode.D, packetType uint64) {
+	// all multi byte HCI fields are little endian
+	d.Endian = decode.LittleEndian
+
+	switch packetType {
+	case packetTypeCommand:
+		decodeCommand(d)
+	case packetTypeACLData:
+		decodeACLData(d)
+	case packetTypeSCOData:
+		decodeSCOData(d)
+	case packetTypeEvent:
+		decodeEvent(d)
+	case packetTypeISOData:
+		decodeISOData(d)
+	default:
+		d.Fatalf("unknown packet type %d", packetType)
+	}
+}
+
+func decodeHCI(d *decode.D, in interface{}) interface{} {
+	switch in := in.(type) {
+	case format.LinkFrameIn:
+		switch in.Type {
+		case format.LinkTypeBLUETOOTH_HCI_H4:
+		case format.LinkTypeBLUETOOTH_HCI_H4_WITH_PHDR:
+			d.FieldU32("direction", directionNames)
+		default:
+			d.Fatalf("wrong link type %d", in.Type)
+		}
+	case format.BluetoothHCIIn:
+		// packet type is known from outside, ex btsnoop H1 flags
+		if in.PacketType != 0 {
+			d.FieldValueU("packet_type", uint64(in.PacketType), packetTypeNames)
+			decodeHCIPacket(d, uint64(in.PacketType))
+			return nil
+		}
+	}
+
+	packetType := d.FieldU8("packet_type", packetTypeNames)
+	decodeHCIPacket(d, packetType)
+
+	return nil
+}
@@ -0,0 +1,287 @@
+package bmp
+
+// https://docs.microsoft.com/en-us/windows/win32/gdi/bitmap-storage
+// https://docs.microsoft.com/en-us/windows/win32/api/wingdi/ns-wingdi-bitmapv5header
+// https://en.wikipedia.org/wiki/BMP_file_format
+
+// TODO: decode RLE pixel data
+// TODO: OS/2 BITMAPINFOHEADER2
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var iccProfileFormat decode.Group
+var jpegFormat decode.Group
+var pngFormat decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.BMP,
+		Description: "Windows bitmap",
+		Groups:      []string{format.PROBE, format.IMAGE},
+		Magic:       []decode.Magic{{Bytes: []byte("BM")}},
+		DecodeFn:    bmpDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.ICC_PROFILE}, Group: &iccProfileFormat},
+			{Names: []string{format.JPEG}, Group: &jpegFormat},
+			{Names: []string{format.PNG}, Group: &pngFormat},
+		},
+	})
+}
+
+const (
+	headerLenCore = 12
+	headerLenInfo = 40
+	headerLenV2   = 52
+	headerLenV3   = 56
+	headerLenV4   = 108
+	headerLenV5   = 124
+)
+
+var headerLenNames = scalar.UToSymStr{
+	headerLenCore: "bitmapcoreheader",
+	headerLenInfo: "bitmapinfoheader",
+	headerLenV2:   "bitmapv2infoheader",
+	headerLenV3:   "bitmapv3infoheader",
+	headerLenV4:   "bitmapv4header",
+	headerLenV5:   "bitmapv5header",
+}
+
+const (
+	compressionRGB       = 0
+	compressionRLE8      = 1
+	compressionRLE4      = 2
+	compressionBitfields = 3
+	compressionJPEG      = 4
+	compressionPNG       = 5
+	compressionAlpha     = 6
+)
+
+var compressionNames = scalar.UToSymStr{
+	compressionRGB:       "rgb",
+	compressionRLE8:      "rle8",
+	compressionRLE4:      "rle4",
+	compressionBitfields: "bitfields",
+	compressionJPEG:      "jpeg",
+	compressionPNG:       "png",
+	compressionAlpha:     "alpha_bitfields",
+}
+
+const (
+	colorSpaceCalibratedRGB = 0
+	colorSpaceSRGB          = 0x73524742 // sRGB
+	colorSpaceWindows       = 0x57696e20 // Win
+	colorSpaceLinked        = 0x4c494e4b // LINK
+	colorSpaceEmbedded      = 0x4d424544 // MBED
+)
+
+var colorSpaceNames = scalar.UToSymStr{
+	colorSpaceCalibratedRGB: "calibrated_rgb",
+	colorSpaceSRGB:          "srgb",
+	colorSpaceWindows:       "windows_color_space",
+	colorSpaceLinked:        "profile_linked",
+	colorSpaceEmbedded:      "profile_embedded",
+}
+
+var intentNames = scalar.UToSymStr{
+	1: "business",
+	2: "graphics",
+	4: "images",
+	8: "abs_colorimetric",
+}
+
+type dibHeader struct {
+	core         bool
+	width        int64
+	height       int64
+	bitCount     uint64
+	compression  uint64
+	imageSize    uint64
+	colorsUsed   uint64
+	hasMasks     bool
+	colorSpace   uint64
+	profileStart int64
+	profileLen   int64
+}
+
+func decodeCIEXYZ(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		d.FieldFP("x", 32, 30)
+		d.FieldFP("y", 32, 30)
+		d.FieldFP("z", 32, 30)
+	})
+}
+
+func decodeDIBHeader(d *decode.D) dibHeader {
+	var h dibHeader
+
+	headerStart := d.Pos()
+	headerLen := d.FieldU32("size", headerLenNames)
+	switch headerLen {
+	case headerLenCore:
+		h.core = true
+		h.width = int64(d.FieldU16("width"))
+		h.height = int64(d.FieldU16("height"))
+		d.FieldU16("planes", d.AssertU(1))
+		h.bitCount = d.FieldU16("bit_count")
+		return h
+	case headerLenInfo, headerLenV2, headerLenV3, headerLenV4, headerLenV5:
+	default:
+		d.Fatalf("unknown header size %d", headerLen)
+	}
+
+	h.width = d.FieldS32("width")
+	// negative height means top-down row order
+	h.height = d.FieldS32("height")
+	d.FieldU16("planes", d.AssertU(1))
+	h.bitCount = d.FieldU16("bit_count")
+	h.compression = d.FieldU32("compression", compressionNames)
+	h.imageSize = d.FieldU32("image_size")
+	d.FieldS32("x_pixels_per_meter")
+	d.FieldS32("y_pixels_per_meter")
+	h.colorsUsed = d.FieldU32("colors_used")
+	d.FieldU32("colors_important")
+
+	if headerLen >= headerLenV2 {
+		d.FieldU32("red_mask", scalar.Hex)
+		d.FieldU32("green_mask", scalar.Hex)
+		d.FieldU32("blue_mask", scalar.Hex)
+	}
+	if headerLen >= headerLenV3 {
+		d.FieldU32("alpha_mask", scalar.Hex)
+	}
+	if headerLen >= headerLenV4 {
+		h.colorSpace = d.FieldU32("color_space_type", colorSpaceNames, scalar.Hex)
+		d.FieldStruct("endpoints", func(d *decode.D) {
+			decodeCIEXYZ(d, "red")
+			decodeCIEXYZ(d, "green")
+			decodeCIEXYZ(d, "blue")
+		})
+		d.FieldFP32("gamma_red")
+		d.FieldFP32("gamma_green")
+		d.FieldFP32("gamma_blue")
+	}
+	if headerLen >= headerLenV5 {
+		d.FieldU32("intent", intentNames)
+		// offset is relative to start of header
+		h.profileStart = headerStart + int64(d.FieldU32("profile_data"))*8
+		h.profileLen = int64(d.FieldU32("profile_size")) * 8
+		d.FieldU32("reserved")
+	}
+	// masks follows header if not part of it
+	h.hasMasks = headerLen == headerLenInfo &&
+		(h.compression == compressionBitfields || h.compression == compressionAlpha)
+
+	return h
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// rows are padded to 4 bytes
+func stride(width int64, bitCount uint64) int64 {
+	return ((width*int64(bitCount) + 31) / 32) * 4
+}
+
+func bmpDecode(d *decode.D, in interface{}) interface{} {
+	d.Endian = decode.LittleEndian
+
+	bi, _ := in.(format.BMPIn)
+
+	start := d.Pos()
+	var pixelDataOffset int64 = -1
+	if !bi.Icon {
+		d.FieldStruct("file_header", func(d *decode.D) {
+			d.FieldUTF8("signature", 2, d.AssertStr("BM"))
+			d.FieldU32("size")
+			d.FieldU16("reserved1")
+			d.FieldU16("reserved2")
+			pixelDataOffset = int64(d.FieldU32("pixel_data_offset"))
+		})
+	}
+
+	var h dibHeader
+	d.FieldStruct("header", func(d *decode.D) { h = decodeDIBHeader(d) })
+
+	if h.hasMasks {
+		d.FieldStruct("masks", func(d *decode.D) {
+			d.FieldU32("red", scalar.Hex)
+			d.FieldU32("green", scalar.Hex)
+			d.FieldU32("blue", scalar.Hex)
+			if h.compression == compressionAlpha {
+				d.FieldU32("alpha", scalar.Hex)
+			}
+		})
+	}
+
+	if h.bitCount >= 1 && h.bitCount <= 8 {
+		numColors := h.colorsUsed
+		if numColors == 0 {
+			numColors = 1 << h.bitCount
+		}
+		d.FieldArray("color_table", func(d *decode.D) {
+			for i := uint64(0); i < numColors; i++ {
+				d.FieldStruct("color", func(d *decode.D) {
+					d.FieldU8("blue")
+					d.FieldU8("green")
+					d.FieldU8("red")
+					// core header uses RGBTRIPLE instead of RGBQUAD
+					if !h.core {
+						d.FieldU8("reserved")
+					}
+				})
+			}
+		})
+	}
+
+	if pixelDataOffset != -1 {
+		if gap := start + pixelDataOffset*8 - d.Pos(); gap > 0 {
+			d.FieldRawLen("gap", gap)
+		}
+	}
+
+	height := abs(h.height)
+	if bi.Icon {
+		// height includes the AND mask
+		height /= 2
+	}
+
+	pixelDataLen := stride(h.width, h.bitCount) * height * 8
+	if h.compression != compressionRGB && h.compression != compressionBitfields && h.compression != compressionAlpha {
+		pixelDataLen = int64(h.imageSize) * 8
+	}
+	switch h.compression {
+	case compressionJPEG:
+		d.FieldFormatLen("pixel_data", pixelDataLen, jpegFormat, nil)
+	case compressionPNG:
+		d.FieldFormatLen("pixel_data", pixelDataLen, pngFormat, nil)
+	default:
+		d.FieldRawLen("pixel_data", pixelDataLen)
+	}
+
+	if bi.Icon {
+		d.FieldRawLen("mask", stride(h.width, 1)*height*8)
+	}
+
+	// linked profile is a filename and embedded profile is usually after pixel data
+	if h.colorSpace == colorSpaceEmbedded && h.profileLen > 0 {
+		if h.profileStart >= d.Pos() {
+			if gap := h.profileStart - d.Pos(); gap > 0 {
+				d.FieldRawLen("gap", gap)
+			}
+			d.FieldFormatLen("icc_profile", h.profileLen, iccProfileFormat, nil)
+		} else {
+			d.FieldFormatRange("icc_profile", h.profileStart, h.profileLen, iccProfileFormat, nil)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,222 @@
+package bplist
+
+// https://opensource.apple.com/source/CF/CF-1153.18/CFBinaryPList.c
+// https://github.com/python/cpython/blob/main/Lib/plistlib.py
+
+import (
+	"embed"
+	"math"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed *.jq
+var bplistFS embed.FS
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.BPLIST,
+		Description: "Apple binary property list",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte(headerMagic)}},
+		DecodeFn:    bplistDecode,
+		Files:       bplistFS,
+	})
+}
+
+const headerMagic = "bplist00"
+
+const trailerSize = 32
+
+const (
+	typeSingleton   = 0x0
+	typeInt         = 0x1
+	typeReal        = 0x2
+	typeDate        = 0x3
+	typeData        = 0x4
+	typeASCIIString = 0x5
+	typeUTF16String = 0x6
+	typeUID         = 0x8
+	typeArray       = 0xa
+	typeOrdset      = 0xb
+	typeSet         = 0xc
+	typeDict        = 0xd
+)
+
+var typeNames = scalar.UToSymStr{
+	typeSingleton:   "singleton",
+	typeInt:         "int",
+	typeReal:        "real",
+	typeDate:        "date",
+	typeData:        "data",
+	typeASCIIString: "ascii_string",
+	typeUTF16String: "utf16_string",
+	typeUID:         "uid",
+	typeArray:       "array",
+	typeOrdset:      "ordset",
+	typeSet:         "set",
+	typeDict:        "dict",
+}
+
+var singletonNames = scalar.UToSymStr{
+	0x0: "null",
+	0x8: "false",
+	0x9: "true",
+	0xf: "fill",
+}
+
+// size in info nibble, 0xf means size follows as an int object
+const sizeFollows = 0xf
+
+// dates are seconds since 2001-01-01 00:00:00 UTC
+var dateEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var dateMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	f, ok := s.Actual.(float64)
+	if !ok || math.IsNaN(f) || math.IsInf(f, 0) {
+		return s, nil
+	}
+	sec, frac := math.Modf(f)
+	s.Description = dateEpoch.Add(time.Duration(sec)*time.Second + time.Duration(frac*1e9)).Format(time.RFC3339Nano)
+	return s, nil
+})
+
+type trailer struct {
+	offsetIntSize     int
+	objectRefSize     int
+	numObjects        uint64
+	topObject         uint64
+	offsetTableOffset uint64
+}
+
+// decodeInt decodes int of 1, 2, 4, 8 or 16 bytes, 8 byte ints are signed and
+// 16 byte ints are used for unsigned 64 bit values
+func decodeInt(d *decode.D, name string, exp uint64) {
+	switch exp {
+	case 0, 1, 2:
+		d.FieldU(name, 8<<exp)
+	case 3:
+		d.FieldS64(name)
+	case 4:
+		d.FieldS64(name + "_high")
+		d.FieldU64(name)
+	default:
+		d.Fatalf("unsupported int size exponent %d", exp)
+	}
+}
+
+func decodeSize(d *decode.D, info uint64) int64 {
+	if info != sizeFollows {
+		return int64(info)
+	}
+	d.FieldU4("size_type", d.AssertU(typeInt), typeNames)
+	exp := d.FieldU4("size_exp")
+	if exp > 3 {
+		d.Fatalf("unsupported size exponent %d", exp)
+	}
+	return int64(d.FieldU("size", 8<<exp))
+}
+
+func decodeRefs(d *decode.D, t trailer, name string, elemName string, n int64) {
+	if n*int64(t.objectRefSize) > d.BitsLeft()/8 {
+		d.Fatalf("%s: %d refs outside buffer", name, n)
+	}
+	d.FieldArray(name, func(d *decode.D) {
+		for i := int64(0); i < n; i++ {
+			d.FieldU(elemName, t.objectRefSize*8, d.ValidateURange(0, t.numObjects-1))
+		}
+	})
+}
+
+func decodeObject(d *decode.D, t trailer) {
+	typ := d.FieldU4("type", typeNames)
+	switch typ {
+	case typeSingleton:
+		d.FieldU4("info", singletonNames)
+	case typeInt:
+		exp := d.FieldU4("info")
+		decodeInt(d, "value", exp)
+	case typeReal:
+		exp := d.FieldU4("info")
+		switch exp {
+		case 2, 3:
+			d.FieldF("value", 8<<exp)
+		default:
+			d.Fatalf("unsupported real size exponent %d", exp)
+		}
+	case typeDate:
+		d.FieldU4("info", d.AssertU(3))
+		d.FieldF64("value", dateMap)
+	case typeData:
+		size := decodeSize(d, d.FieldU4("info"))
+		d.FieldRawLen("value", size*8)
+	case typeASCIIString:
+		size := decodeSize(d, d.FieldU4("info"))
+		d.FieldUTF8("value", int(size))
+	case typeUTF16String:
+		size := decodeSize(d, d.FieldU4("info"))
+		d.FieldUTF16BE("value", int(size)*2)
+	case typeUID:
+		n := d.FieldU4("info")
+		if n > 7 {
+			d.Fatalf("unsupported uid size %d", n+1)
+		}
+		d.FieldU("value", int(n+1)*8)
+	case typeArray, typeOrdset, typeSet:
+		size := decodeSize(d, d.FieldU4("info"))
+		decodeRefs(d, t, "entries", "entry", size)
+	case typeDict:
+		size := decodeSize(d, d.FieldU4("info"))
+		decodeRefs(d, t, "keys", "key", size)
+		decodeRefs(d, t, "values", "value", size)
+	default:
+		d.Fatalf("unknown object type %d", typ)
+	}
+}
+
+func bplistDecode(d *decode.D, in interface{}) interface{} {
+	d.FieldUTF8("magic", len(headerMagic), d.AssertStr(headerMagic))
+
+	if d.Len() < int64(len(headerMagic)+trailerSize)*8 {
+		d.Fatalf("too short for trailer")
+	}
+
+	var t trailer
+	d.SeekAbs(d.Len() - trailerSize*8)
+	d.FieldStruct("trailer", func(d *decode.D) {
+		d.FieldRawLen("unused", 5*8)
+		d.FieldU8("sort_version")
+		t.offsetIntSize = int(d.FieldU8("offset_int_size", d.AssertURange(1, 8)))
+		t.objectRefSize = int(d.FieldU8("object_ref_size", d.AssertURange(1, 8)))
+		t.numObjects = d.FieldU64("num_objects")
+		t.topObject = d.FieldU64("top_object")
+		t.offsetTableOffset = d.FieldU64("offset_table_offset")
+	})
+	if t.numObjects == 0 || t.topObject >= t.numObjects {
+		d.Fatalf("invalid top object %d of %d objects", t.topObject, t.numObjects)
+	}
+	if (t.offsetTableOffset+t.numObjects*uint64(t.offsetIntSize))*8 > uint64(d.Len()-trailerSize*8) {
+		d.Fatalf("offset table outside buffer")
+	}
+
+	var offsets []uint64
+	d.SeekAbs(int64(t.offsetTableOffset) * 8)
+	d.FieldArray("offset_table", func(d *decode.D) {
+		for i := uint64(0); i < t.numObjects; i++ {
+			offsets = append(offsets, d.FieldU("offset", t.offsetIntSize*8, d.AssertURange(uint64(len(headerMagic)), t.offsetTableOffset-1)))
+		}
+	})
+
+	d.FieldArray("objects", func(d *decode.D) {
+		for _, o := range offsets {
+			d.SeekAbs(int64(o) * 8)
+			d.FieldStruct("object", func(d *decode.D) { decodeObject(d, t) })
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package bson
+
+// https://bsonspec.org/spec.html
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.BSON,
+		Description: "Binary JSON",
+		DecodeFn:    bsonDecode,
+	})
+}
+
+const (
+	elementTypeDouble     = 0x01
+	elementTypeString     = 0x02
+	elementTypeDocument   = 0x03
+	elementTypeArray      = 0x04
+	elementTypeBinary     = 0x05
+	elementTypeUndefined  = 0x06
+	elementTypeObjectID   = 0x07
+	elementTypeBoolean    = 0x08
+	elementTypeDatetime   = 0x09
+	elementTypeNull       = 0x0a
+	elementTypeRegexp     = 0x0b
+	elementTypeDBPointer  = 0x0c
+	elementTypeJavaScript = 0x0d
+	elementTypeSymbol     = 0x0e
+	elementTypeCodeWScope = 0x0f
+	elementTypeInt32      = 0x10
+	elementTypeTimestamp  = 0x11
+	elementTypeInt64      = 0x12
+	elementTypeDecimal128 = 0x13
+	elementTypeMinKey     = 0xff
+	elementTypeMaxKey     = 0x7f
+)
+
+var elementTypeNames = scalar.UToSymStr{
+	elementTypeDouble:     "double",
+	elementTypeString:     "string",
+	elementTypeDocument:   "document",
+	elementTypeArray:      "array",
+	elementTypeBinary:     "binary",
+	elementTypeUndefined:  "undefined",
+	elementTypeObjectID:   "object_id",
+	elementTypeBoolean:    "boolean",
+	elementTypeDatetime:   "datetime",
+	elementTypeNull:       "null",
+	elementTypeRegexp:     "regexp",
+	elementTypeDBPointer:  "db_pointer",
+	elementTypeJavaScript: "javascript",
+	elementTypeSymbol:     "symbol",
+	elementTypeCodeWScope: "javascript_with_scope",
+	elementTypeInt32:      "int32",
+	elementTypeTimestamp:  "timestamp",
+	elementTypeInt64:      "int64",
+	elementTypeDecimal128: "decimal128",
+	elementTypeMinKey:     "min_key",
+	elementTypeMaxKey:     "max_key",
+}
+
+var binarySubtypeNames = scalar.UToSymStr{
+	0x00: "generic",
+	0x01: "function",
+	0x02: "binary_old",
+	0x03: "uuid_old",
+	0x04: "uuid",
+	0x05: "md5",
+	0x06: "encrypted",
+	0x07: "compressed_time_series",
+	0x80: "user_defined",
+}
+
+// int32 length including null terminator followed by string
+func decodeString(d *decode.D) string {
+	length := d.S32()
+	if length < 1 || length-1 > d.BitsLeft()/8 {
+		d.Fatalf("invalid string length %d", length)
+	}
+	s := d.UTF8(int(length) - 1)
+	d.U8()
+	return s
+}
+
+func fieldString(d *decode.D, name string) string {
+	return d.FieldStrFn(name, decodeString)
+}
+
+func decodeValue(d *decode.D, typ uint64) {
+	switch typ {
+	case elementTypeDouble:
+		d.FieldF64("value")
+	case elementTypeString, elementTypeJavaScript, elementTypeSymbol:
+		fieldString(d, "value")
+	case elementTypeDocument, elementTypeArray:
+		d.FieldStruct("value", decodeDocument)
+	case elementTypeBinary:
+		length := d.FieldS32("length")
+		d.FieldU8("subtype", binarySubtypeNames)
+		if length < 0 || length > d.BitsLeft()/8 {
+			d.Fatalf("invalid binary length %d", length)
+		}
+		d.FieldRawLen("value", length*8)
+	case elementTypeUndefined, elementTypeNull, elementTypeMinKey, elementTypeMaxKey:
+	case elementTypeObjectID:
+		d.FieldRawLen("value", 12*8, scalar.RawHex)
+	case elementTypeBoolean:
+		d.FieldU8("value", scalar.UToSymStr{0: "false", 1: "true"})
+	case elementTypeDatetime:
+		// milliseconds since unix epoch
+		d.FieldS64("value")
+	case elementTypeRegexp:
+		d.FieldUTF8Null("pattern")
+		d.FieldUTF8Null("options")
+	case elementTypeDBPointer:
+		fieldString(d, "namespace")
+		d.FieldRawLen("id", 12*8, scalar.RawHex)
+	case elementTypeCodeWScope:
+		d.FieldS32("length")
+		fieldString(d, "code")
+		d.FieldStruct("scope", decodeDocument)
+	case elementTypeInt32:
+		d.FieldS32("value")
+	case elementTypeTimestamp:
+		d.FieldU32("increment")
+		d.FieldU32("seconds")
+	case elementTypeInt64:
+		d.FieldS64("value")
+	case elementTypeDecimal128:
+		d.FieldRawLen("value", 16*8)
+	default:
+		d.Fatalf("unknown element type %d", typ)
+	}
+}
+
+func decodeDocument(d *decode.D) {
+	size := d.FieldS32("size")
+	if size < 5 {
+		d.Fatalf("invalid document size %d", size)
+	}
+	d.LenFn((size-4)*8, func(d *decode.D) {
+		d.FieldArray("elements", func(d *decode.D) {
+			for d.BitsLeft() > 8 {
+				d.FieldStruct("element", func(d *decode.D) {
+					typ := d.FieldU8("type", elementTypeNames)
+					d.FieldUTF8Null("name")
+					decodeValue(d, typ)
+				})
+			}
+		})
+		d.FieldU8("terminator", d.ValidateU(0))
+	})
+}
+
+func bsonDecode(d *decode.D, in interface{}) interface{} {
+	d.Endian = decode.LittleEndian
+
+	decodeDocument(d)
+
+	return nil
+}
@@ -25,6 +25,7 @@ func init() {
 		Name:        format.BZIP2,
 		Description: "bzip2 compression",
 		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte("BZ")}},
 		DecodeFn:    bzip2Decode,
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.PROBE}, Group: &probeGroup},
@@ -117,7 +118,7 @@ func bzip2Decode(d *decode.D, in interface{}) interface{} {
 		blockCRC32W := crc32.NewIEEE()
 		d.MustCopy(blockCRC32W, bitFlipReader{uncompressedBB.Clone()})
 		blockCRC32N := bits.Reverse32(binary.BigEndian.Uint32(blockCRC32W.Sum(nil)))
-		_ = blockCRCValue.TryScalarFn(d.ValidateU(uint64(blockCRC32N)))
+		d.ValueChecksumU(blockCRCValue, "crc32", uint64(blockCRC32N))
 		streamCRCN = blockCRC32N ^ ((streamCRCN << 1) | (streamCRCN >> 31))
 
 		// HACK: bzip2.NewReader will read from start of whole buffer and then we figure out compressedSize ourself
@@ -138,7 +139,7 @@ func bzip2Decode(d *decode.D, in interface{}) interface{} {
 		d.FieldStruct("footer", func(d *decode.D) {
 			d.FieldU48("magic", d.AssertU(footerMagic), scalar.Hex)
 			// TODO: crc of block crcs
-			d.FieldU32("crc", scalar.Hex, d.ValidateU(uint64(streamCRCN)))
+			d.FieldChecksumU("crc", 32, "crc32", uint64(streamCRCN), scalar.Hex)
 			d.FieldRawLen("padding", int64(d.ByteAlignBits()))
 		})
 	}
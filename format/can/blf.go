@@ -0,0 +1,360 @@
+package can
+
+// https://bitbucket.org/tobylorenz/vector_blf
+// https://github.com/hardbyte/python-can/blob/develop/can/io/blf.py
+
+// TODO: objects split across log containers
+// TODO: more object types, LIN, FlexRay, ethernet etc
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io/ioutil"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.BLF,
+		Description: "Vector binary logging format",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte("LOGG")}},
+		DecodeFn:    blfDecode,
+	})
+}
+
+const blfObjectHeaderBaseLen = 16
+
+const (
+	blfObjectTypeCANMessage     = 1
+	blfObjectTypeLogContainer   = 10
+	blfObjectTypeCANErrorExt    = 73
+	blfObjectTypeCANMessage2    = 86
+	blfObjectTypeCANFDMessage   = 100
+	blfObjectTypeCANFDMessage64 = 101
+)
+
+var blfObjectTypeNames = scalar.UToSymStr{
+	blfObjectTypeCANMessage:     "can_message",
+	2:                           "can_error",
+	3:                           "can_overload",
+	4:                           "can_statistic",
+	5:                           "app_trigger",
+	6:                           "env_integer",
+	7:                           "env_double",
+	8:                           "env_string",
+	9:                           "env_data",
+	blfObjectTypeLogContainer:   "log_container",
+	11:                          "lin_message",
+	65:                          "app_text",
+	blfObjectTypeCANErrorExt:    "can_error_ext",
+	blfObjectTypeCANMessage2:    "can_message2",
+	92:                          "global_marker",
+	blfObjectTypeCANFDMessage:   "can_fd_message",
+	blfObjectTypeCANFDMessage64: "can_fd_message_64",
+	104:                         "can_fd_error_64",
+}
+
+const (
+	blfCompressionNone = 0
+	blfCompressionZlib = 2
+)
+
+var blfCompressionNames = scalar.UToSymStr{
+	blfCompressionNone: "none",
+	blfCompressionZlib: "zlib",
+}
+
+var blfTimestampFlagsNames = scalar.UToSymStr{
+	1: "ten_microseconds",
+	2: "nanoseconds",
+}
+
+var blfDirectionNames = scalar.UToSymStr{
+	0: "rx",
+	1: "tx",
+	2: "tx_request",
+}
+
+// CAN FD 64 message flags
+const (
+	blfFD64FlagRemote = 0x0010
+	blfFD64FlagEDL    = 0x1000
+	blfFD64FlagBRS    = 0x2000
+	blfFD64FlagESI    = 0x4000
+)
+
+func decodeSystemTime(d *decode.D) {
+	d.FieldU16("year")
+	d.FieldU16("month")
+	d.FieldU16("day_of_week")
+	d.FieldU16("day")
+	d.FieldU16("hour")
+	d.FieldU16("minute")
+	d.FieldU16("second")
+	d.FieldU16("milliseconds")
+}
+
+// CAN_MSG_FLAGS, used by CAN message and CAN FD message
+func decodeCANMessageFlags(d *decode.D) bool {
+	var remote bool
+	d.FieldStruct("flags", func(d *decode.D) {
+		remote = d.FieldBool("remote")
+		d.FieldBool("wake_up")
+		d.FieldBool("nerr")
+		d.FieldU1("reserved")
+		d.FieldU4("direction", blfDirectionNames)
+	})
+	return remote
+}
+
+// id with extended flag in bit 31
+func fieldBLFID(d *decode.D) {
+	id := d.FieldU32("id", scalar.Hex)
+	extended := id&canEFFFlag != 0
+	d.FieldValueBool("extended", extended)
+	fieldArbitrationID(d, id, extended)
+}
+
+// data field with fixed size where only n bytes are valid
+func fieldBLFData(d *decode.D, n int, size int) {
+	if n > size {
+		n = size
+	}
+	d.FieldRawLen("data", int64(n)*8)
+	if size > n {
+		d.FieldRawLen("unused", int64(size-n)*8)
+	}
+}
+
+func decodeCANMessage(d *decode.D, objectType uint64) {
+	d.FieldU16("channel")
+	remote := decodeCANMessageFlags(d)
+	dlc := d.FieldU8("dlc")
+	fieldBLFID(d)
+	n := dlcLength(dlc, false)
+	if remote {
+		n = 0
+	}
+	fieldBLFData(d, n, 8)
+	if objectType == blfObjectTypeCANMessage2 {
+		d.FieldU32("frame_length")
+		d.FieldU8("bit_count")
+		d.FieldU8("reserved0")
+		d.FieldU16("reserved1")
+	}
+}
+
+func decodeCANFDMessage(d *decode.D) {
+	d.FieldU16("channel")
+	remote := decodeCANMessageFlags(d)
+	d.FieldU8("dlc")
+	fieldBLFID(d)
+	d.FieldU32("frame_length")
+	d.FieldU8("bit_count")
+	d.FieldStruct("fd_flags", func(d *decode.D) {
+		d.FieldU5("reserved")
+		d.FieldBool("esi")
+		d.FieldBool("brs")
+		d.FieldBool("edl")
+	})
+	validDataBytes := d.FieldU8("valid_data_bytes")
+	d.FieldRawLen("reserved", 5*8)
+	n := int(validDataBytes)
+	if remote {
+		n = 0
+	}
+	fieldBLFData(d, n, 64)
+}
+
+func decodeCANFDMessage64(d *decode.D) {
+	d.FieldU8("channel")
+	d.FieldU8("dlc")
+	validDataBytes := d.FieldU8("valid_data_bytes")
+	d.FieldU8("tx_count")
+	fieldBLFID(d)
+	d.FieldU32("frame_length")
+	flags := d.FieldU32("flags", scalar.Hex)
+	d.FieldValueBool("remote", flags&blfFD64FlagRemote != 0)
+	d.FieldValueBool("edl", flags&blfFD64FlagEDL != 0)
+	d.FieldValueBool("brs", flags&blfFD64FlagBRS != 0)
+	d.FieldValueBool("esi", flags&blfFD64FlagESI != 0)
+	d.FieldU32("btr_cfg_arb", scalar.Hex)
+	d.FieldU32("btr_cfg_data", scalar.Hex)
+	d.FieldU32("time_offset_brs_ns")
+	d.FieldU32("time_offset_crc_del_ns")
+	d.FieldU16("bit_count")
+	d.FieldU8("direction", blfDirectionNames)
+	d.FieldU8("ext_data_offset")
+	d.FieldU32("crc", scalar.Hex)
+
+	// optional extended data after data ends up as unknown
+	n := int64(validDataBytes)
+	if left := d.BitsLeft() / 8; n > left {
+		n = left
+	}
+	d.FieldRawLen("data", n*8)
+}
+
+func decodeCANErrorExt(d *decode.D) {
+	d.FieldU16("channel")
+	length := d.FieldU16("length")
+	d.FieldU32("flags", scalar.Hex)
+	d.FieldU8("ecc", scalar.Hex)
+	d.FieldU8("position")
+	dlc := d.FieldU8("dlc")
+	d.FieldU8("reserved0")
+	d.FieldU32("frame_length")
+	fieldBLFID(d)
+	d.FieldU16("flags_ext", scalar.Hex)
+	d.FieldU16("reserved1")
+	n := dlcLength(dlc, false)
+	if int(length) < n {
+		n = int(length)
+	}
+	fieldBLFData(d, n, 8)
+}
+
+func decodeLogContainer(d *decode.D) {
+	compression := d.FieldU16("compression", blfCompressionNames)
+	d.FieldRawLen("reserved0", 6*8)
+	d.FieldU32("uncompressed_size")
+	d.FieldRawLen("reserved1", 4*8)
+
+	dataLen := d.BitsLeft()
+	switch compression {
+	case blfCompressionNone:
+		d.FieldStructArrayLoop("objects", "object", d.NotEnd, decodeBLFObject)
+	case blfCompressionZlib:
+		b := d.BytesLen(int(dataLen / 8))
+		d.SeekRel(-dataLen)
+		d.FieldRawLen("compressed", dataLen)
+		zr, err := zlib.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return
+		}
+		ub, err := ioutil.ReadAll(zr)
+		if err != nil {
+			return
+		}
+		d.FieldStructRootBitBufFn("uncompressed", bitio.NewBufferFromBytes(ub, -1), func(d *decode.D) {
+			d.FieldStructArrayLoop("objects", "object", func() bool { return blfObjectFits(d) }, decodeBLFObject)
+			// rest of an object that continues in next container
+			if d.NotEnd() {
+				d.FieldRawLen("partial_object", d.BitsLeft())
+			}
+		})
+	default:
+		d.FieldRawLen("compressed", dataLen)
+	}
+}
+
+// object header and object is within buffer
+func blfObjectFits(d *decode.D) bool {
+	if d.BitsLeft() < blfObjectHeaderBaseLen*8 {
+		return false
+	}
+	objectSize := binary.LittleEndian.Uint32(d.PeekBytes(blfObjectHeaderBaseLen)[8:12])
+	return int64(objectSize)*8 <= d.BitsLeft()
+}
+
+func decodeBLFObject(d *decode.D) {
+	var objectSize uint64
+	var objectType uint64
+	var headerSize uint64
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldUTF8("signature", 4, d.AssertStr("LOBJ"))
+		headerSize = d.FieldU16("header_size")
+		headerVersion := d.FieldU16("header_version")
+		objectSize = d.FieldU32("object_size")
+		objectType = d.FieldU32("object_type", blfObjectTypeNames)
+
+		if objectSize < blfObjectHeaderBaseLen || headerSize < blfObjectHeaderBaseLen || headerSize > objectSize {
+			d.Fatalf("invalid object size")
+		}
+		d.LenFn(int64(headerSize-blfObjectHeaderBaseLen)*8, func(d *decode.D) {
+			switch {
+			// log container has no header after base header
+			case objectType == blfObjectTypeLogContainer:
+			case headerVersion == 1:
+				d.FieldU32("timestamp_flags", blfTimestampFlagsNames)
+				d.FieldU16("client_index")
+				d.FieldU16("object_version")
+				d.FieldU64("timestamp")
+			case headerVersion == 2:
+				d.FieldU32("timestamp_flags", blfTimestampFlagsNames)
+				d.FieldU8("timestamp_status")
+				d.FieldU8("reserved")
+				d.FieldU16("object_version")
+				d.FieldU64("timestamp")
+				d.FieldU64("original_timestamp")
+			}
+			if d.NotEnd() {
+				d.FieldRawLen("unknown", d.BitsLeft())
+			}
+		})
+	})
+
+	d.LenFn(int64(objectSize-headerSize)*8, func(d *decode.D) {
+		switch objectType {
+		case blfObjectTypeLogContainer:
+			decodeLogContainer(d)
+		case blfObjectTypeCANMessage, blfObjectTypeCANMessage2:
+			decodeCANMessage(d, objectType)
+		case blfObjectTypeCANFDMessage:
+			decodeCANFDMessage(d)
+		case blfObjectTypeCANFDMessage64:
+			decodeCANFDMessage64(d)
+		case blfObjectTypeCANErrorExt:
+			decodeCANErrorExt(d)
+		}
+		if d.NotEnd() {
+			d.FieldRawLen("unknown", d.BitsLeft())
+		}
+	})
+
+	// objects are padded to 4 byte alignment by object size
+	if padding := int64(objectSize % 4); padding > 0 && d.BitsLeft() >= padding*8 {
+		d.FieldRawLen("padding", padding*8, d.BitBufIsZero())
+	}
+}
+
+func blfDecode(d *decode.D, in interface{}) interface{} {
+	d.Endian = decode.LittleEndian
+
+	var headerSize uint64
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldUTF8("signature", 4, d.AssertStr("LOGG"))
+		headerSize = d.FieldU32("header_size")
+		d.FieldU8("application_id")
+		d.FieldU8("application_major")
+		d.FieldU8("application_minor")
+		d.FieldU8("application_build")
+		d.FieldU8("bin_log_major")
+		d.FieldU8("bin_log_minor")
+		d.FieldU8("bin_log_build")
+		d.FieldU8("bin_log_patch")
+		d.FieldU64("file_size")
+		d.FieldU64("uncompressed_size")
+		d.FieldU32("object_count")
+		d.FieldU32("objects_read")
+		d.FieldStruct("start_time", decodeSystemTime)
+		d.FieldStruct("stop_time", decodeSystemTime)
+		if left := int64(headerSize)*8 - d.Pos(); left > 0 {
+			d.FieldRawLen("reserved", left)
+		}
+	})
+
+	d.FieldStructArrayLoop("objects", "object", func() bool { return blfObjectFits(d) }, decodeBLFObject)
+	if d.NotEnd() {
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+
+	return nil
+}
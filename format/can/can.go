@@ -0,0 +1,38 @@
+package can
+
+// https://www.kernel.org/doc/html/latest/networking/can.html
+
+import (
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+// SocketCAN can_id flags, also used by candump for 8 digit ids
+const (
+	canEFFFlag = 0x80000000
+	canERRFlag = 0x20000000
+	canEFFMask = 0x1fffffff
+	canSFFMask = 0x000007ff
+)
+
+// CAN FD data length code to number of bytes
+var fdDLCLengths = [16]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 12, 16, 20, 24, 32, 48, 64}
+
+func dlcLength(dlc uint64, fd bool) int {
+	if dlc > 15 {
+		return 0
+	}
+	if !fd && dlc > 8 {
+		return 8
+	}
+	return fdDLCLengths[dlc]
+}
+
+// derived arbitration id without flags
+func fieldArbitrationID(d *decode.D, id uint64, extended bool) {
+	if extended {
+		d.FieldValueU("arbitration_id", id&canEFFMask, scalar.Hex)
+	} else {
+		d.FieldValueU("arbitration_id", id&canSFFMask, scalar.Hex)
+	}
+}
@@ -0,0 +1,169 @@
+package can
+
+// https://github.com/linux-can/can-utils/blob/master/lib.c
+// https://github.com/linux-can/can-utils/blob/master/candump.c
+
+// TODO: CAN XL frames, "123###..."
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strconv"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.CANDUMP,
+		Description: "Linux SocketCAN candump log",
+		DecodeFn:    candumpDecode,
+	})
+}
+
+// max length of a token in a log line, longest is 128 hex digits of CAN FD data
+const maxTokenLen = 256
+
+// CANFD_BRS, CANFD_ESI and CANFD_FDF
+const (
+	candumpFDFlagBRS = 0x1
+	candumpFDFlagESI = 0x2
+)
+
+var candumpDirectionNames = scalar.StrToSymStr{
+	"R": "rx",
+	"T": "tx",
+}
+
+// reads a token up to but not including one of the bytes in stop
+func candumpToken(d *decode.D, stop string) string {
+	n := d.BitsLeft() / 8
+	if n > maxTokenLen {
+		n = maxTokenLen
+	}
+	i := bytes.IndexAny(d.PeekBytes(int(n)), stop)
+	if i == -1 {
+		d.Fatalf("expected one of %q", stop)
+	}
+	return d.UTF8(i)
+}
+
+func candumpHexU(d *decode.D, s string) uint64 {
+	n, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		d.Fatalf("invalid hex %q", s)
+	}
+	return n
+}
+
+// reads "(1436509052.249713) "
+func candumpTimestamp(d *decode.D) float64 {
+	s := candumpToken(d, " ")
+	d.UTF8(1)
+	if len(s) < 3 || s[0] != '(' || s[len(s)-1] != ')' {
+		d.Fatalf("invalid timestamp %q", s)
+	}
+	f, err := strconv.ParseFloat(s[1:len(s)-1], 64)
+	if err != nil {
+		d.Fatalf("invalid timestamp %q", s)
+	}
+	return f
+}
+
+// reads a one hex digit field with a prefix, ex "_9"
+func candumpPrefixedNibble(d *decode.D) uint64 {
+	d.UTF8(1)
+	return candumpHexU(d, d.UTF8(1))
+}
+
+func decodeCandumpFrame(d *decode.D) {
+	d.FieldFFn("timestamp", candumpTimestamp)
+	d.FieldStrFn("interface", func(d *decode.D) string {
+		s := candumpToken(d, " ")
+		d.UTF8(1)
+		return s
+	})
+
+	var idDigits int
+	id := d.FieldUFn("id", func(d *decode.D) uint64 {
+		s := candumpToken(d, "#")
+		d.UTF8(1)
+		idDigits = len(s)
+		return candumpHexU(d, s)
+	}, scalar.Hex)
+	// 8 digit ids are extended or error frames, error frames have CAN_ERR_FLAG set
+	isError := idDigits == 8 && id&canERRFlag != 0
+	extended := idDigits == 8 && !isError
+	d.FieldValueBool("extended", extended)
+	d.FieldValueBool("error", isError)
+	fieldArbitrationID(d, id, idDigits == 8)
+
+	fd := d.PeekBits(8) == '#'
+	d.FieldValueBool("fd", fd)
+	remote := !fd && d.PeekBits(8) == 'R'
+	d.FieldValueBool("remote", remote)
+
+	var dlc uint64
+	switch {
+	case remote:
+		d.FieldUTF8("rtr", 1, d.AssertStr("R"))
+		if c := d.PeekBits(8); c >= '0' && c <= '9' {
+			dlc = d.FieldUFn("rtr_length", func(d *decode.D) uint64 {
+				return candumpHexU(d, d.UTF8(1))
+			})
+		}
+		d.FieldRootBitBuf("data", bitio.NewBufferFromBytes(nil, -1))
+	default:
+		if fd {
+			fdFlags := d.FieldUFn("fd_flags", candumpPrefixedNibble, scalar.Hex)
+			d.FieldValueBool("brs", fdFlags&candumpFDFlagBRS != 0)
+			d.FieldValueBool("esi", fdFlags&candumpFDFlagESI != 0)
+		}
+		var b []byte
+		if c := d.PeekBits(8); c != '_' && c != ' ' && c != '\n' {
+			s := d.FieldStrFn("data_hex", func(d *decode.D) string { return candumpToken(d, "_ \n") })
+			var err error
+			if b, err = hex.DecodeString(s); err != nil {
+				d.Fatalf("invalid data %q", s)
+			}
+		}
+		d.FieldRootBitBuf("data", bitio.NewBufferFromBytes(b, -1))
+		dlc = uint64(len(b))
+		if fd {
+			for i, l := range fdDLCLengths {
+				if l >= len(b) {
+					dlc = uint64(i)
+					break
+				}
+			}
+		}
+	}
+
+	// classic CAN with len8_dlc, dlc 9-15 for 8 bytes of data
+	if d.PeekBits(8) == '_' {
+		dlc = d.FieldUFn("len8_dlc", candumpPrefixedNibble)
+	}
+	d.FieldValueU("dlc", dlc)
+
+	if d.PeekBits(8) == ' ' {
+		d.FieldStrFn("direction", func(d *decode.D) string {
+			d.UTF8(1)
+			return candumpToken(d, "\n")
+		}, candumpDirectionNames)
+	}
+	d.FieldUTF8("newline", 1, d.AssertStr("\n"))
+}
+
+func candumpDecode(d *decode.D, in interface{}) interface{} {
+	if d.PeekBits(8) != '(' {
+		d.Fatalf("not a candump log line")
+	}
+
+	d.FieldStructArrayLoop("frames", "frame", d.NotEnd, decodeCandumpFrame)
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package cassandra
+
+// https://github.com/apache/cassandra/blob/trunk/src/java/org/apache/cassandra/utils/vint/VIntCoding.java
+
+import (
+	"math/bits"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+// unsigned variable length integer, number of leading one bits in first
+// byte is number of extra bytes
+func uvint(d *decode.D) uint64 {
+	first := d.U8()
+	extraBytes := bits.LeadingZeros8(^uint8(first))
+	v := first & (0xff >> extraBytes)
+	for i := 0; i < extraBytes; i++ {
+		v = v<<8 | d.U8()
+	}
+	return v
+}
+
+func fieldUVint(d *decode.D, name string, sms ...scalar.Mapper) uint64 {
+	return d.FieldUFn(name, uvint, sms...)
+}
+
+// UTF-8 string with unsigned vint length prefix
+func fieldVintUTF8(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		length := fieldUVint(d, "length")
+		d.FieldUTF8("value", int(length))
+	})
+}
@@ -0,0 +1,159 @@
+package cassandra
+
+// https://github.com/apache/cassandra/blob/trunk/src/java/org/apache/cassandra/db/rows/UnfilteredSerializer.java
+// https://github.com/apache/cassandra/blob/trunk/src/java/org/apache/cassandra/db/DeletionTime.java
+// https://thelastpickle.com/blog/2016/03/04/introductiont-to-the-apache-cassandra-3-storage-engine.html
+
+// TODO: clustering values and cells, requires types from Statistics.db serialization header
+// TODO: compressed Data.db using CompressionInfo.db
+// TODO: pre 3.0 formats
+
+import (
+	"math"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.CASSANDRA_DATA,
+		Description: "Cassandra SSTable Data.db (3.0 and later, no clustering columns)",
+		DecodeFn:    dataDecode,
+	})
+}
+
+var localDeletionTimeMap = scalar.UToScalar{math.MaxInt32: {Description: "live"}}
+var markedForDeleteAtMap = scalar.SToScalar{math.MinInt64: {Description: "live"}}
+
+func decodeDeletionTime(d *decode.D) {
+	d.FieldU32("local_deletion_time", localDeletionTimeMap)
+	d.FieldS64("marked_for_delete_at", markedForDeleteAtMap)
+}
+
+// delta encoded relative to serialization header minimum values
+func decodeDeletionTimeDelta(d *decode.D) {
+	fieldUVint(d, "marked_for_delete_at_delta")
+	fieldUVint(d, "local_deletion_time_delta")
+}
+
+const (
+	boundKindExclEndBound             = 0
+	boundKindInclStartBound           = 1
+	boundKindExclEndInclStartBoundary = 2
+	boundKindStaticClustering         = 3
+	boundKindClustering               = 4
+	boundKindInclEndExclStartBoundary = 5
+	boundKindInclEndBound             = 6
+	boundKindExclStartBound           = 7
+)
+
+var boundKindNames = scalar.UToSymStr{
+	boundKindExclEndBound:             "excl_end_bound",
+	boundKindInclStartBound:           "incl_start_bound",
+	boundKindExclEndInclStartBoundary: "excl_end_incl_start_boundary",
+	boundKindStaticClustering:         "static_clustering",
+	boundKindClustering:               "clustering",
+	boundKindInclEndExclStartBoundary: "incl_end_excl_start_boundary",
+	boundKindInclEndBound:             "incl_end_bound",
+	boundKindExclStartBound:           "excl_start_bound",
+}
+
+type unfilteredFlags struct {
+	endOfPartition bool
+	isMarker       bool
+	hasTimestamp   bool
+	hasTTL         bool
+	hasDeletion    bool
+	extension      bool
+}
+
+func decodeUnfiltered(d *decode.D) bool {
+	var f unfilteredFlags
+	var boundKind uint64
+	d.FieldStruct("flags", func(d *decode.D) {
+		f.extension = d.FieldBool("extension_flag")
+		d.FieldBool("has_complex_deletion")
+		d.FieldBool("has_all_columns")
+		f.hasDeletion = d.FieldBool("has_deletion")
+		f.hasTTL = d.FieldBool("has_ttl")
+		f.hasTimestamp = d.FieldBool("has_timestamp")
+		f.isMarker = d.FieldBool("is_marker")
+		f.endOfPartition = d.FieldBool("end_of_partition")
+	})
+	if f.endOfPartition {
+		return false
+	}
+	if f.extension {
+		d.FieldStruct("extended_flags", func(d *decode.D) {
+			d.FieldU6("unused")
+			d.FieldBool("has_shadowable_deletion")
+			d.FieldBool("is_static")
+		})
+	}
+	if f.isMarker {
+		d.FieldStruct("bound", func(d *decode.D) {
+			boundKind = d.FieldU8("kind", boundKindNames)
+			size := d.FieldU16("size")
+			if size != 0 {
+				d.Fatalf("range tombstone marker with clustering values not supported")
+			}
+		})
+	}
+
+	rowSize := fieldUVint(d, "size")
+	prevStart := d.Pos()
+	fieldUVint(d, "previous_unfiltered_size")
+	bodyLen := int64(rowSize)*8 - (d.Pos() - prevStart)
+	if bodyLen < 0 {
+		d.Fatalf("invalid size")
+	}
+
+	d.LenFn(bodyLen, func(d *decode.D) {
+		if f.isMarker {
+			// boundary markers have both end and start deletion time
+			if boundKind == boundKindExclEndInclStartBoundary || boundKind == boundKindInclEndExclStartBoundary {
+				d.FieldStruct("end_deletion", decodeDeletionTimeDelta)
+				d.FieldStruct("start_deletion", decodeDeletionTimeDelta)
+			} else {
+				d.FieldStruct("deletion", decodeDeletionTimeDelta)
+			}
+			return
+		}
+		if f.hasTimestamp {
+			fieldUVint(d, "timestamp_delta")
+		}
+		if f.hasTTL {
+			fieldUVint(d, "ttl_delta")
+			fieldUVint(d, "local_deletion_time_delta")
+		}
+		if f.hasDeletion {
+			d.FieldStruct("deletion", decodeDeletionTimeDelta)
+		}
+		if d.NotEnd() {
+			d.FieldRawLen("cells", d.BitsLeft())
+		}
+	})
+
+	return true
+}
+
+func decodePartition(d *decode.D) {
+	d.FieldStruct("key", func(d *decode.D) {
+		length := d.FieldU16("length")
+		d.FieldRawLen("value", int64(length)*8)
+	})
+	d.FieldStruct("deletion_time", decodeDeletionTime)
+	more := true
+	d.FieldStructArrayLoop("unfiltereds", "unfiltered", func() bool { return more }, func(d *decode.D) {
+		more = decodeUnfiltered(d)
+	})
+}
+
+func dataDecode(d *decode.D, in interface{}) interface{} {
+	d.FieldStructArrayLoop("partitions", "partition", d.NotEnd, decodePartition)
+
+	return nil
+}
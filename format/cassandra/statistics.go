@@ -0,0 +1,234 @@
+package cassandra
+
+// https://github.com/apache/cassandra/blob/trunk/src/java/org/apache/cassandra/io/sstable/metadata/MetadataSerializer.java
+// https://github.com/apache/cassandra/blob/trunk/src/java/org/apache/cassandra/io/sstable/metadata/StatsMetadata.java
+// https://github.com/apache/cassandra/blob/trunk/src/java/org/apache/cassandra/db/SerializationHeader.java
+
+// TODO: version specific stats fields after total_rows
+
+import (
+	"hash/crc32"
+	"sort"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.CASSANDRA_STATISTICS,
+		Description: "Cassandra SSTable Statistics.db (3.0 and later)",
+		DecodeFn:    statisticsDecode,
+	})
+}
+
+const (
+	metadataValidation = 0
+	metadataCompaction = 1
+	metadataStats      = 2
+	metadataHeader     = 3
+)
+
+var metadataTypeNames = scalar.UToSymStr{
+	metadataValidation: "validation",
+	metadataCompaction: "compaction",
+	metadataStats:      "stats",
+	metadataHeader:     "header",
+}
+
+// encoding stats are stored as deltas to these epochs
+const (
+	timestampEpoch    = 1442880000000000 // 2015-09-22T00:00:00Z in microseconds
+	deletionTimeEpoch = 1442880000       // 2015-09-22T00:00:00Z in seconds
+)
+
+func decodeEstimatedHistogram(d *decode.D) {
+	size := d.FieldS32("size")
+	d.FieldArray("buckets", func(d *decode.D) {
+		for i := int64(0); i < size; i++ {
+			d.FieldStruct("bucket", func(d *decode.D) {
+				d.FieldS64("offset")
+				d.FieldS64("count")
+			})
+		}
+	})
+}
+
+func decodeClusteringValues(d *decode.D) {
+	count := d.FieldS32("count")
+	d.FieldArray("values", func(d *decode.D) {
+		for i := int64(0); i < count; i++ {
+			d.FieldStruct("value", func(d *decode.D) {
+				length := d.FieldU16("length")
+				d.FieldRawLen("value", int64(length)*8)
+			})
+		}
+	})
+}
+
+func decodeValidation(d *decode.D) {
+	length := d.FieldU16("partitioner_length")
+	d.FieldUTF8("partitioner", int(length))
+	d.FieldF64("bloom_filter_fp_chance")
+}
+
+func decodeCompaction(d *decode.D) {
+	length := d.FieldU32("cardinality_length")
+	// serialized HyperLogLogPlus
+	d.FieldRawLen("cardinality", int64(length)*8)
+}
+
+func decodeStats(d *decode.D) {
+	d.FieldStruct("estimated_partition_size", decodeEstimatedHistogram)
+	d.FieldStruct("estimated_column_count", decodeEstimatedHistogram)
+	d.FieldStruct("commit_log_upper_bound", func(d *decode.D) {
+		d.FieldS64("segment_id")
+		d.FieldS32("position")
+	})
+	d.FieldS64("min_timestamp")
+	d.FieldS64("max_timestamp")
+	d.FieldU32("min_local_deletion_time", localDeletionTimeMap)
+	d.FieldU32("max_local_deletion_time", localDeletionTimeMap)
+	d.FieldS32("min_ttl")
+	d.FieldS32("max_ttl")
+	// -1 if not compressed
+	d.FieldF64("compression_ratio")
+	d.FieldStruct("estimated_tombstone_drop_time", func(d *decode.D) {
+		d.FieldS32("max_bin_size")
+		size := d.FieldS32("size")
+		d.FieldArray("bins", func(d *decode.D) {
+			for i := int64(0); i < size; i++ {
+				d.FieldStruct("bin", func(d *decode.D) {
+					d.FieldF64("point")
+					d.FieldS64("value")
+				})
+			}
+		})
+	})
+	d.FieldS32("sstable_level")
+	d.FieldS64("repaired_at")
+	d.FieldStruct("min_clustering_values", decodeClusteringValues)
+	d.FieldStruct("max_clustering_values", decodeClusteringValues)
+	d.FieldU8("has_legacy_counter_shards")
+	d.FieldS64("total_columns_set")
+	d.FieldS64("total_rows")
+	if d.NotEnd() {
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+}
+
+func decodeColumns(d *decode.D) {
+	count := fieldUVint(d, "count")
+	d.FieldArray("columns", func(d *decode.D) {
+		for i := uint64(0); i < count; i++ {
+			d.FieldStruct("column", func(d *decode.D) {
+				fieldVintUTF8(d, "name")
+				fieldVintUTF8(d, "type")
+			})
+		}
+	})
+}
+
+func decodeSerializationHeader(d *decode.D) {
+	d.FieldStruct("stats", func(d *decode.D) {
+		d.FieldUFn("min_timestamp", func(d *decode.D) uint64 { return uvint(d) + timestampEpoch })
+		d.FieldUFn("min_local_deletion_time", func(d *decode.D) uint64 { return uvint(d) + deletionTimeEpoch })
+		fieldUVint(d, "min_ttl")
+	})
+	fieldVintUTF8(d, "key_type")
+	clusteringCount := fieldUVint(d, "clustering_types_count")
+	d.FieldArray("clustering_types", func(d *decode.D) {
+		for i := uint64(0); i < clusteringCount; i++ {
+			fieldVintUTF8(d, "type")
+		}
+	})
+	d.FieldStruct("static_columns", decodeColumns)
+	d.FieldStruct("regular_columns", decodeColumns)
+}
+
+func statisticsDecode(d *decode.D, in interface{}) interface{} {
+	type component struct {
+		typ    uint64
+		offset int64
+	}
+	var components []component
+
+	count := d.FieldU32("count")
+	if count == 0 || count > 16 {
+		d.Fatalf("invalid component count %d", count)
+	}
+	d.FieldArray("toc", func(d *decode.D) {
+		for i := uint64(0); i < count; i++ {
+			d.FieldStruct("entry", func(d *decode.D) {
+				typ := d.FieldU32("type", metadataTypeNames)
+				offset := int64(d.FieldU32("offset"))
+				components = append(components, component{typ: typ, offset: offset * 8})
+			})
+		}
+	})
+
+	// 4.0 and later checksums table of contents and each component with CRC-32
+	tocEnd := d.Pos()
+	checksummed := components[0].offset == tocEnd+32
+	if checksummed {
+		d.FieldChecksumU("toc_crc", 32, "crc32", uint64(crc32.ChecksumIEEE(d.BytesRange(0, int(tocEnd/8)))), scalar.Hex)
+	}
+
+	sort.Slice(components, func(i, j int) bool { return components[i].offset < components[j].offset })
+
+	prevEnd := tocEnd
+	if checksummed {
+		prevEnd += 32
+	}
+	for _, c := range components {
+		if c.offset < prevEnd || c.offset >= d.Len() {
+			d.Fatalf("invalid component offset %d", c.offset/8)
+		}
+		// offsets must be increasing and components at least one byte
+		prevEnd = c.offset + 8
+		if checksummed {
+			prevEnd += 32
+		}
+	}
+	if prevEnd > d.Len() {
+		d.Fatalf("invalid component offset %d", components[len(components)-1].offset/8)
+	}
+
+	d.FieldArray("components", func(d *decode.D) {
+		for i, c := range components {
+			end := d.Len()
+			if i+1 < len(components) {
+				end = components[i+1].offset
+			}
+			length := end - c.offset
+			if checksummed {
+				length -= 32
+			}
+			d.SeekAbs(c.offset)
+			d.FieldStruct("component", func(d *decode.D) {
+				d.FieldValueU("type", c.typ, metadataTypeNames)
+				d.LenFn(length, func(d *decode.D) {
+					switch c.typ {
+					case metadataValidation:
+						decodeValidation(d)
+					case metadataCompaction:
+						decodeCompaction(d)
+					case metadataStats:
+						decodeStats(d)
+					case metadataHeader:
+						decodeSerializationHeader(d)
+					default:
+						d.FieldRawLen("data", d.BitsLeft())
+					}
+				})
+				if checksummed {
+					d.FieldChecksumU("crc", 32, "crc32", uint64(crc32.ChecksumIEEE(d.BytesRange(c.offset, int(length/8)))), scalar.Hex)
+				}
+			})
+		}
+	})
+
+	return nil
+}
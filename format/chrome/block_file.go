@@ -0,0 +1,259 @@
+package chrome
+
+// https://chromium.googlesource.com/chromium/src/+/main/net/disk_cache/blockfile/disk_format.h
+// https://chromium.googlesource.com/chromium/src/+/main/net/disk_cache/blockfile/disk_format_base.h
+// https://chromium.googlesource.com/chromium/src/+/main/net/disk_cache/blockfile/addr.h
+
+// TODO: index file
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.CHROME_BLOCK_FILE,
+		Description: "Chrome disk cache block file",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    blockFileDecode,
+	})
+}
+
+const (
+	blockMagic          = 0xc104cac3
+	blockHeaderLen      = 8192
+	blockHeaderFieldLen = 80
+
+	entryStoreLen     = 256
+	entryStoreKeyLen  = 160
+	entryStoreHashLen = 92
+	rankingsNodeLen   = 36
+	rankingsHashLen   = 32
+)
+
+var fileTypeNames = scalar.UToSymStr{
+	0: "external",
+	1: "rankings",
+	2: "block_256",
+	3: "block_1k",
+	4: "block_4k",
+	5: "block_files",
+	6: "block_entries",
+	7: "block_evicted",
+}
+
+var entryStateNames = scalar.SToScalar{
+	0: {Sym: "normal"},
+	1: {Sym: "evicted"},
+	2: {Sym: "doomed"},
+}
+
+var entryFlagsNames = scalar.UToSymStr{
+	0: "none",
+	1: "parent_entry",
+	2: "child_entry",
+}
+
+// cache address, initialized bit, file type and location
+var cacheAddrMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	v, ok := s.Actual.(uint64)
+	if !ok {
+		return s, nil
+	}
+	if v&0x8000_0000 == 0 {
+		s.Description = "not initialized"
+		return s, nil
+	}
+	fileType := (v >> 28) & 0x7
+	switch fileType {
+	case 0:
+		s.Description = fmt.Sprintf("f_%06x", v&0x0fff_ffff)
+	case 1, 2, 3, 4:
+		s.Description = fmt.Sprintf("%s data_%d block %d count %d",
+			fileTypeNames[fileType], (v>>16)&0xff, v&0xffff, (v>>24)&0x3+1)
+	default:
+		s.Description = fileTypeNames[fileType]
+	}
+	return s, nil
+})
+
+// Paul Hsieh's SuperFastHash as used by Chromium
+func superFastHash(b []byte) uint32 {
+	if len(b) == 0 {
+		return 0
+	}
+	get16 := func(b []byte) uint32 { return uint32(b[0]) | uint32(b[1])<<8 }
+	hash := uint32(len(b))
+	rem := len(b) & 3
+	n := len(b) >> 2
+	for ; n > 0; n-- {
+		hash += get16(b)
+		tmp := (get16(b[2:]) << 11) ^ hash
+		hash = (hash << 16) ^ tmp
+		b = b[4:]
+		hash += hash >> 11
+	}
+	switch rem {
+	case 3:
+		hash += get16(b)
+		hash ^= hash << 16
+		hash ^= uint32(int32(int8(b[2]))) << 18
+		hash += hash >> 11
+	case 2:
+		hash += get16(b)
+		hash ^= hash << 11
+		hash += hash >> 17
+	case 1:
+		hash += uint32(int32(int8(b[0])))
+		hash ^= hash << 10
+		hash += hash >> 1
+	}
+	hash ^= hash << 3
+	hash += hash >> 5
+	hash ^= hash << 4
+	hash += hash >> 17
+	hash ^= hash << 25
+	hash += hash >> 6
+	return hash
+}
+
+// blocks in files with 256 byte entries can be entries or data, entries has a
+// hash of itself
+func isEntryStore(d *decode.D, pos int64) bool {
+	selfHash := binary.LittleEndian.Uint32(d.BytesRange(pos+entryStoreHashLen*8, 4))
+	return superFastHash(d.BytesRange(pos, entryStoreHashLen)) == selfHash
+}
+
+func fieldCacheAddr(d *decode.D, name string) {
+	d.FieldU32(name, cacheAddrMap, scalar.Hex)
+}
+
+func decodeEntryStore(d *decode.D, nBlocks int64) {
+	d.FieldU32("hash", scalar.Hex)
+	fieldCacheAddr(d, "next")
+	fieldCacheAddr(d, "rankings_node")
+	d.FieldS32("reuse_count")
+	d.FieldS32("refetch_count")
+	d.FieldS32("state", entryStateNames)
+	// microseconds since 1601-01-01
+	d.FieldU64("creation_time")
+	keyLen := d.FieldS32("key_length")
+	fieldCacheAddr(d, "long_key")
+	d.FieldArray("data_sizes", func(d *decode.D) {
+		for i := 0; i < 4; i++ {
+			d.FieldS32("data_size")
+		}
+	})
+	d.FieldArray("data_addrs", func(d *decode.D) {
+		for i := 0; i < 4; i++ {
+			fieldCacheAddr(d, "data_addr")
+		}
+	})
+	d.FieldU32("flags", entryFlagsNames)
+	d.FieldRawLen("pad", 4*4*8)
+	d.FieldChecksumU("self_hash", 32, "superfasthash", uint64(superFastHash(d.BytesRange(d.Pos()-entryStoreHashLen*8, entryStoreHashLen))), scalar.Hex)
+	// key continues into following blocks if it does not fit
+	keyBytes := entryStoreKeyLen + (nBlocks-1)*entryStoreLen
+	if keyLen >= 0 && keyLen < keyBytes {
+		d.FieldUTF8("key", int(keyLen))
+		d.FieldRawLen("key_padding", (keyBytes-keyLen)*8)
+	} else {
+		d.FieldRawLen("key", keyBytes*8)
+	}
+}
+
+func decodeRankingsNode(d *decode.D) {
+	d.FieldU64("last_used")
+	d.FieldU64("last_modified")
+	fieldCacheAddr(d, "next")
+	fieldCacheAddr(d, "prev")
+	fieldCacheAddr(d, "contents")
+	d.FieldS32("dirty")
+	d.FieldChecksumU("self_hash", 32, "superfasthash", uint64(superFastHash(d.BytesRange(d.Pos()-rankingsHashLen*8, rankingsHashLen))), scalar.Hex)
+}
+
+func blockFileDecode(d *decode.D, in interface{}) interface{} {
+	d.Endian = decode.LittleEndian
+
+	var entrySize int64
+	var allocationMap []byte
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldU32("magic", d.AssertU(blockMagic), scalar.Hex)
+		d.FieldU32("version", scalar.Hex)
+		d.FieldS16("this_file")
+		d.FieldS16("next_file")
+		entrySize = d.FieldS32("entry_size")
+		d.FieldS32("num_entries")
+		d.FieldS32("max_entries")
+		d.FieldArray("empty", func(d *decode.D) {
+			for i := 0; i < 4; i++ {
+				d.FieldS32("count")
+			}
+		})
+		d.FieldArray("hints", func(d *decode.D) {
+			for i := 0; i < 4; i++ {
+				d.FieldS32("hint")
+			}
+		})
+		d.FieldS32("updating")
+		d.FieldArray("user", func(d *decode.D) {
+			for i := 0; i < 5; i++ {
+				d.FieldS32("value")
+			}
+		})
+		allocationMap = d.BytesRange(d.Pos(), blockHeaderLen-blockHeaderFieldLen)
+		d.FieldRawLen("allocation_map", (blockHeaderLen-blockHeaderFieldLen)*8)
+	})
+	if entrySize <= 0 {
+		d.Fatalf("invalid entry size %d", entrySize)
+	}
+
+	isAllocated := func(i int64) bool {
+		return i/8 < int64(len(allocationMap)) && allocationMap[i/8]&(1<<(i%8)) != 0
+	}
+
+	numBlocks := (d.Len()/8 - blockHeaderLen) / entrySize
+	d.FieldArray("blocks", func(d *decode.D) {
+		for i := int64(0); i < numBlocks; i++ {
+			if !isAllocated(i) {
+				continue
+			}
+			blockPos := (blockHeaderLen + i*entrySize) * 8
+			d.SeekAbs(blockPos)
+
+			switch {
+			case entrySize == entryStoreLen && isEntryStore(d, blockPos):
+				// key can continue into up to 3 more blocks
+				keyLen := int64(int32(binary.LittleEndian.Uint32(d.BytesRange(blockPos+32*8, 4))))
+				n := int64(1)
+				for n < 4 && entryStoreLen*n-(entryStoreLen-entryStoreKeyLen) <= keyLen && i+n < numBlocks && isAllocated(i+n) {
+					n++
+				}
+				d.FieldStruct("entry", func(d *decode.D) {
+					d.FieldValueU("block", uint64(i))
+					decodeEntryStore(d, n)
+				})
+				i += n - 1
+			case entrySize == rankingsNodeLen:
+				d.FieldStruct("rankings_node", func(d *decode.D) {
+					d.FieldValueU("block", uint64(i))
+					decodeRankingsNode(d)
+				})
+			default:
+				d.FieldStruct("data", func(d *decode.D) {
+					d.FieldValueU("block", uint64(i))
+					d.FieldRawLen("data", entrySize*8)
+				})
+			}
+		}
+	})
+	d.SeekAbs(d.Len())
+
+	return nil
+}
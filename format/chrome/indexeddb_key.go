@@ -0,0 +1,249 @@
+package chrome
+
+// https://chromium.googlesource.com/chromium/src/+/main/content/browser/indexed_db/docs/leveldb_coding_scheme.md
+// https://chromium.googlesource.com/chromium/src/+/main/content/browser/indexed_db/indexed_db_leveldb_coding.cc
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.INDEXEDDB_KEY,
+		Description: "Chrome IndexedDB LevelDB key",
+		DecodeFn:    indexedDBKeyDecode,
+	})
+}
+
+const (
+	indexIDObjectStoreData = 1
+	indexIDExists          = 2
+	indexIDBlobEntry       = 3
+	indexIDMin             = 30
+)
+
+var indexIDNames = scalar.UToSymStr{
+	indexIDObjectStoreData: "object_store_data",
+	indexIDExists:          "exists_entry",
+	indexIDBlobEntry:       "blob_entry",
+}
+
+const (
+	globalMetaDatabaseFreeList = 100
+	globalMetaDatabaseName     = 201
+)
+
+var globalMetaTypeNames = scalar.UToSymStr{
+	0:                          "schema_version",
+	1:                          "max_database_id",
+	2:                          "data_version",
+	3:                          "recovery_blob_journal",
+	4:                          "active_blob_journal",
+	5:                          "earliest_sweep",
+	6:                          "earliest_compaction_time",
+	50:                         "scopes_prefix",
+	globalMetaDatabaseFreeList: "database_free_list",
+	globalMetaDatabaseName:     "database_name",
+}
+
+const (
+	databaseMetaObjectStoreMeta     = 50
+	databaseMetaIndexMeta           = 51
+	databaseMetaObjectStoreFreeList = 150
+	databaseMetaIndexFreeList       = 151
+	databaseMetaObjectStoreNames    = 200
+	databaseMetaIndexNames          = 201
+)
+
+var databaseMetaTypeNames = scalar.UToSymStr{
+	0:                               "origin_name",
+	1:                               "database_name",
+	2:                               "user_string_version",
+	3:                               "max_object_store_id",
+	4:                               "user_version",
+	5:                               "blob_key_generator_current_number",
+	databaseMetaObjectStoreMeta:     "object_store_meta_data",
+	databaseMetaIndexMeta:           "index_meta_data",
+	databaseMetaObjectStoreFreeList: "object_store_free_list",
+	databaseMetaIndexFreeList:       "index_free_list",
+	databaseMetaObjectStoreNames:    "object_store_names",
+	databaseMetaIndexNames:          "index_names",
+}
+
+var objectStoreMetaTypeNames = scalar.UToSymStr{
+	0: "name",
+	1: "key_path",
+	2: "auto_increment",
+	3: "evictable",
+	4: "last_version",
+	5: "max_index_id",
+	6: "has_key_path",
+	7: "key_generator_current_number",
+}
+
+var indexMetaTypeNames = scalar.UToSymStr{
+	0: "name",
+	1: "unique",
+	2: "key_path",
+	3: "multi_entry",
+}
+
+const (
+	idbKeyNull   = 0
+	idbKeyString = 1
+	idbKeyDate   = 2
+	idbKeyNumber = 3
+	idbKeyArray  = 4
+	idbKeyMin    = 5
+	idbKeyBinary = 6
+)
+
+var idbKeyTypeNames = scalar.UToSymStr{
+	idbKeyNull:   "null",
+	idbKeyString: "string",
+	idbKeyDate:   "date",
+	idbKeyNumber: "number",
+	idbKeyArray:  "array",
+	idbKeyMin:    "min_key",
+	idbKeyBinary: "binary",
+}
+
+// varint, 7 bits per byte least significant group first
+func varInt(d *decode.D) uint64 {
+	var v uint64
+	for shift := 0; ; shift += 7 {
+		if shift > 63 {
+			d.Fatalf("varint too long")
+		}
+		b := d.U8()
+		v |= (b & 0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	return v
+}
+
+func fieldVarInt(d *decode.D, name string, sms ...scalar.Mapper) uint64 {
+	return d.FieldUFn(name, varInt, sms...)
+}
+
+// length is number of UTF-16 code units
+func fieldUTF16BEWithLength(d *decode.D, name string, length uint64) string {
+	if length > uint64(d.BitsLeft()/16) {
+		d.Fatalf("string length %d larger than input", length)
+	}
+	return d.FieldUTF16BE(name, int(length)*2)
+}
+
+// varint number of UTF-16 code units followed by UTF-16BE string
+func fieldStringWithLength(d *decode.D, name string) string {
+	var s string
+	d.FieldStruct(name, func(d *decode.D) {
+		length := fieldVarInt(d, "length")
+		s = fieldUTF16BEWithLength(d, "value", length)
+	})
+	return s
+}
+
+func decodeIDBKey(d *decode.D) {
+	typ := d.FieldU8("type", idbKeyTypeNames)
+	switch typ {
+	case idbKeyString:
+		length := fieldVarInt(d, "length")
+		fieldUTF16BEWithLength(d, "value", length)
+	case idbKeyDate:
+		// milliseconds since unix epoch
+		d.FieldF64LE("value")
+	case idbKeyNumber:
+		d.FieldF64LE("value")
+	case idbKeyArray:
+		length := fieldVarInt(d, "length")
+		d.FieldArray("values", func(d *decode.D) {
+			for i := uint64(0); i < length; i++ {
+				d.FieldStruct("value", decodeIDBKey)
+			}
+		})
+	case idbKeyBinary:
+		length := fieldVarInt(d, "length")
+		if length > uint64(d.BitsLeft()/8) {
+			d.Fatalf("binary length %d larger than input", length)
+		}
+		d.FieldRawLen("value", int64(length)*8)
+	case idbKeyNull, idbKeyMin:
+	default:
+		d.Fatalf("unknown key type %d", typ)
+	}
+}
+
+func decodeGlobalMetaData(d *decode.D) {
+	typ := d.FieldU8("type", globalMetaTypeNames)
+	switch typ {
+	case globalMetaDatabaseFreeList:
+		fieldVarInt(d, "database_id")
+	case globalMetaDatabaseName:
+		fieldStringWithLength(d, "origin")
+		fieldStringWithLength(d, "database_name")
+	}
+}
+
+func decodeDatabaseMetaData(d *decode.D) {
+	typ := d.FieldU8("type", databaseMetaTypeNames)
+	switch typ {
+	case databaseMetaObjectStoreMeta:
+		fieldVarInt(d, "object_store_id")
+		d.FieldU8("meta_data_type", objectStoreMetaTypeNames)
+	case databaseMetaIndexMeta:
+		fieldVarInt(d, "object_store_id")
+		fieldVarInt(d, "index_id")
+		d.FieldU8("meta_data_type", indexMetaTypeNames)
+	case databaseMetaObjectStoreFreeList:
+		fieldVarInt(d, "object_store_id")
+	case databaseMetaIndexFreeList:
+		fieldVarInt(d, "object_store_id")
+		fieldVarInt(d, "index_id")
+	case databaseMetaObjectStoreNames:
+		fieldStringWithLength(d, "object_store_name")
+	case databaseMetaIndexNames:
+		fieldVarInt(d, "object_store_id")
+		fieldStringWithLength(d, "index_name")
+	}
+}
+
+func indexedDBKeyDecode(d *decode.D, in interface{}) interface{} {
+	var databaseID, objectStoreID, indexID uint64
+	d.FieldStruct("prefix", func(d *decode.D) {
+		// byte lengths minus one of the little endian ids that follows
+		databaseIDLen := d.FieldU3("database_id_length", scalar.UAdd(1))
+		objectStoreIDLen := d.FieldU3("object_store_id_length", scalar.UAdd(1))
+		indexIDLen := d.FieldU2("index_id_length", scalar.UAdd(1))
+		databaseID = d.FieldUFn("database_id", func(d *decode.D) uint64 { return d.UE(int(databaseIDLen)*8, decode.LittleEndian) })
+		objectStoreID = d.FieldUFn("object_store_id", func(d *decode.D) uint64 { return d.UE(int(objectStoreIDLen)*8, decode.LittleEndian) })
+		indexID = d.FieldUFn("index_id", func(d *decode.D) uint64 { return d.UE(int(indexIDLen)*8, decode.LittleEndian) }, indexIDNames)
+	})
+
+	switch {
+	case databaseID == 0 && objectStoreID == 0 && indexID == 0:
+		d.FieldStruct("global_meta_data", decodeGlobalMetaData)
+	case objectStoreID == 0 && indexID == 0:
+		d.FieldStruct("database_meta_data", decodeDatabaseMetaData)
+	case indexID == indexIDObjectStoreData, indexID == indexIDExists, indexID == indexIDBlobEntry:
+		d.FieldStruct("user_key", decodeIDBKey)
+	case indexID >= indexIDMin:
+		d.FieldStruct("index_key", decodeIDBKey)
+		if d.NotEnd() {
+			fieldVarInt(d, "sequence_number")
+		}
+		if d.NotEnd() {
+			d.FieldStruct("primary_key", decodeIDBKey)
+		}
+	}
+	if d.NotEnd() {
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+
+	return nil
+}
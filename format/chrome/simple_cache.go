@@ -0,0 +1,216 @@
+package chrome
+
+// https://chromium.googlesource.com/chromium/src/+/main/net/disk_cache/simple/simple_entry_format.h
+// https://chromium.googlesource.com/chromium/src/+/main/net/http/http_response_info.cc
+// https://www.chromium.org/developers/design-documents/network-stack/disk-cache/very-simple-backend/
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.CHROME_SIMPLE_CACHE,
+		Description: "Chrome simple cache entry file",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    simpleCacheDecode,
+	})
+}
+
+const (
+	simpleInitialMagic     = 0xfcfb6d1ba7725c30
+	simpleFinalMagic       = 0xf4fa6f45970d41d8
+	simpleSparseRangeMagic = 0xeb97bf016553676b
+
+	simpleEOFLen = 24
+	keySHA256Len = 32
+)
+
+const (
+	eofFlagHasCRC32     = 0x1
+	eofFlagHasKeySHA256 = 0x2
+)
+
+// HttpResponseInfo pickle flags
+const (
+	responseInfoHasExtraFlags             = 1 << 31
+	responseExtraInfoOriginalResponseTime = 1 << 0
+)
+
+type simpleEOF struct {
+	flags      uint64
+	streamSize int64
+}
+
+func peekSimpleEOF(d *decode.D, pos int64) (simpleEOF, bool) {
+	b := d.BytesRange(pos, simpleEOFLen)
+	if binary.LittleEndian.Uint64(b[0:8]) != simpleFinalMagic {
+		return simpleEOF{}, false
+	}
+	return simpleEOF{
+		flags:      uint64(binary.LittleEndian.Uint32(b[8:12])),
+		streamSize: int64(binary.LittleEndian.Uint32(b[16:20])),
+	}, true
+}
+
+// computedCRC is crc32 of the stream before the record
+func decodeSimpleEOF(d *decode.D, computedCRC uint64) {
+	d.FieldU64("final_magic", d.AssertU(simpleFinalMagic), scalar.Hex)
+	var flags uint64
+	d.FieldStruct("flags", func(d *decode.D) {
+		flags = d.FieldU32("value", scalar.Hex)
+		d.FieldValueBool("has_crc32", flags&eofFlagHasCRC32 != 0)
+		d.FieldValueBool("has_key_sha256", flags&eofFlagHasKeySHA256 != 0)
+	})
+	if flags&eofFlagHasCRC32 != 0 {
+		d.FieldChecksumU("data_crc32", 32, "crc32", computedCRC, scalar.Hex)
+	} else {
+		d.FieldU32("data_crc32", scalar.Hex)
+	}
+	d.FieldU32("stream_size")
+	d.FieldU32("unused_padding")
+}
+
+// pickle string, int32 length and data padded to 4 bytes
+func fieldPickleString(d *decode.D, name string, fn func(d *decode.D)) {
+	d.FieldStruct(name, func(d *decode.D) {
+		length := d.FieldS32("length")
+		d.FieldStruct("value", func(d *decode.D) {
+			d.LenFn(length*8, fn)
+		})
+		if padLen := (4 - length%4) % 4; padLen > 0 {
+			d.FieldRawLen("padding", padLen*8)
+		}
+	})
+}
+
+// stream 0 is HTTP response info and headers
+func decodeResponseInfo(d *decode.D) {
+	d.FieldU32("payload_size")
+	flags := d.FieldU32("flags", scalar.Hex)
+	d.FieldValueU("version", flags&0xff)
+	var extraFlags uint64
+	if flags&responseInfoHasExtraFlags != 0 {
+		extraFlags = d.FieldU32("extra_flags", scalar.Hex)
+	}
+	// microseconds since 1601-01-01
+	d.FieldS64("request_time")
+	d.FieldS64("response_time")
+	if extraFlags&responseExtraInfoOriginalResponseTime != 0 {
+		d.FieldS64("original_response_time")
+	}
+	fieldPickleString(d, "headers", func(d *decode.D) {
+		// status line and headers separated by null
+		d.FieldArray("lines", func(d *decode.D) {
+			for d.NotEnd() && d.PeekBits(8) != 0 {
+				d.FieldUTF8Null("line")
+			}
+		})
+		if d.NotEnd() {
+			d.FieldRawLen("terminator", d.BitsLeft())
+		}
+	})
+	if d.NotEnd() {
+		d.FieldRawLen("rest", d.BitsLeft())
+	}
+}
+
+// returns crc32 of stream data, validated by the following EOF record
+func fieldStream(d *decode.D, name string, nBits int64, fn func(d *decode.D)) uint64 {
+	if nBits < 0 {
+		d.Fatalf("invalid stream size")
+	}
+	computedCRC := uint64(crc32.ChecksumIEEE(d.BytesRange(d.Pos(), int(nBits/8))))
+	d.FieldStruct(name, func(d *decode.D) {
+		d.LenFn(nBits, func(d *decode.D) {
+			if fn != nil && nBits > 0 {
+				fn(d)
+			} else {
+				d.FieldRawLen("data", d.BitsLeft())
+			}
+		})
+	})
+	return computedCRC
+}
+
+func simpleCacheDecode(d *decode.D, in interface{}) interface{} {
+	d.Endian = decode.LittleEndian
+
+	var keyLen int64
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldU64("initial_magic", d.AssertU(simpleInitialMagic), scalar.Hex)
+		d.FieldU32("version")
+		keyLen = int64(d.FieldU32("key_length"))
+		d.FieldU32("key_hash", scalar.Hex)
+		d.FieldU32("unused_padding")
+	})
+	if keyLen > d.BitsLeft()/8 {
+		d.Fatalf("key length %d larger than input", keyLen)
+	}
+	d.FieldUTF8("key", int(keyLen))
+
+	// sparse file (_s) has ranges after key
+	if d.BitsLeft() >= 64 && d.PeekBits(64) == simpleSparseRangeMagic {
+		d.FieldStructArrayLoop("sparse_ranges", "sparse_range", d.NotEnd, func(d *decode.D) {
+			d.FieldU64("magic", d.AssertU(simpleSparseRangeMagic), scalar.Hex)
+			d.FieldS64("offset")
+			length := d.FieldS64("length")
+			if length < 0 || length*8 > d.BitsLeft()-64 {
+				d.Fatalf("invalid sparse range length %d", length)
+			}
+			// data is after crc and padding
+			d.FieldChecksumU("data_crc32", 32, "crc32", uint64(crc32.ChecksumIEEE(d.BytesRange(d.Pos()+64, int(length)))), scalar.Hex)
+			d.FieldU32("unused_padding")
+			d.FieldRawLen("data", length*8)
+		})
+		return nil
+	}
+
+	// each stream is followed by an EOF record. _0 file has stream 1 and then stream 0
+	// with optional key SHA-256, only EOF record for stream 0 has stream size.
+	// _1 file has only stream 2.
+	keyEnd := d.Pos()
+	lastEOFPos := d.Len() - simpleEOFLen*8
+	if lastEOFPos < keyEnd {
+		d.Fatalf("file too short for EOF record")
+	}
+	lastEOF, ok := peekSimpleEOF(d, lastEOFPos)
+	if !ok {
+		d.Fatalf("EOF record not found")
+	}
+	lastStreamEnd := lastEOFPos
+	if lastEOF.flags&eofFlagHasKeySHA256 != 0 {
+		lastStreamEnd -= keySHA256Len * 8
+	}
+	stream0Start := lastStreamEnd - lastEOF.streamSize*8
+	firstEOFPos := stream0Start - simpleEOFLen*8
+	hasStream0 := false
+	if lastEOF.streamSize > 0 && firstEOFPos >= keyEnd {
+		_, hasStream0 = peekSimpleEOF(d, firstEOFPos)
+	}
+
+	var lastCRC uint64
+	if hasStream0 {
+		stream1CRC := fieldStream(d, "stream1", firstEOFPos-keyEnd, nil)
+		d.FieldStruct("stream1_eof", func(d *decode.D) { decodeSimpleEOF(d, stream1CRC) })
+		lastCRC = fieldStream(d, "stream0", lastEOF.streamSize*8, decodeResponseInfo)
+	} else {
+		lastCRC = fieldStream(d, "stream2", lastStreamEnd-keyEnd, nil)
+	}
+	if lastEOF.flags&eofFlagHasKeySHA256 != 0 {
+		d.FieldRawLen("key_sha256", keySHA256Len*8, scalar.RawHex)
+	}
+	if hasStream0 {
+		d.FieldStruct("stream0_eof", func(d *decode.D) { decodeSimpleEOF(d, lastCRC) })
+	} else {
+		d.FieldStruct("stream2_eof", func(d *decode.D) { decodeSimpleEOF(d, lastCRC) })
+	}
+
+	return nil
+}
@@ -0,0 +1,331 @@
+package cue
+
+// https://wiki.hydrogenaud.io/index.php?title=Cue_sheet
+// https://www.gnu.org/software/ccd2cue/manual/html_node/CUE-sheet-format.html
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/internal/lineparse"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.CUE,
+		Description: "CUE sheet",
+		DecodeFn:    cueDecode,
+	})
+}
+
+// CD frames, sectors, per second
+const framesPerSecond = 75
+
+var fileTypeNames = scalar.StrToScalar{
+	"BINARY":   {Description: "Intel binary, little endian"},
+	"MOTOROLA": {Description: "Motorola binary, big endian"},
+	"AIFF":     {Description: "Audio AIFF"},
+	"WAVE":     {Description: "Audio WAVE"},
+	"MP3":      {Description: "Audio MP3"},
+	"FLAC":     {Description: "Audio FLAC"},
+}
+
+var trackTypeNames = scalar.StrToScalar{
+	"AUDIO":      {Description: "Audio/Music (2352)"},
+	"CDG":        {Description: "Karaoke CD+G (2448)"},
+	"MODE1/2048": {Description: "CD-ROM Mode 1 data (cooked)"},
+	"MODE1/2352": {Description: "CD-ROM Mode 1 data (raw)"},
+	"MODE2/2336": {Description: "CD-ROM XA Mode 2 data"},
+	"MODE2/2352": {Description: "CD-ROM XA Mode 2 data (raw)"},
+	"CDI/2336":   {Description: "CD-I Mode 2 data"},
+	"CDI/2352":   {Description: "CD-I Mode 2 data (raw)"},
+}
+
+var flagNames = scalar.StrToScalar{
+	"DCP":  {Description: "Digital copy permitted"},
+	"4CH":  {Description: "Four channel audio"},
+	"PRE":  {Description: "Pre-emphasis enabled"},
+	"SCMS": {Description: "Serial copy management system"},
+}
+
+// commands with one string argument, rest of line
+var stringCommands = map[string]string{
+	"CATALOG":    "catalog",
+	"CDTEXTFILE": "cdtextfile",
+	"ISRC":       "isrc",
+	"PERFORMER":  "performer",
+	"SONGWRITER": "songwriter",
+	"TITLE":      "title",
+}
+
+type line struct {
+	lineparse.Line // tokens are arguments after keyword
+	keyword        string
+}
+
+// rest merges argument i and all following into one token using the raw text
+func (l line) rest(b []byte, i int) line {
+	if i >= len(l.Tokens) {
+		return l
+	}
+	first := l.Tokens[i]
+	last := l.Tokens[len(l.Tokens)-1]
+	value := first.Value
+	if i != len(l.Tokens)-1 {
+		value = string(bytes.TrimSpace(b[first.Start:last.End]))
+	}
+	l.Tokens = append(l.Tokens[0:i:i], lineparse.Token{Start: first.Start, End: last.End, Value: value})
+	return l
+}
+
+func parseLine(b []byte, start int, end int) line {
+	l := line{Line: lineparse.Line{Start: start, End: end}}
+	s := b[start:end]
+	i := 0
+	for {
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\r' || s[i] == '\n') {
+			i++
+		}
+		if i >= len(s) {
+			break
+		}
+		t := lineparse.Token{Start: start + i}
+		if s[i] == '"' {
+			j := bytes.IndexByte(s[i+1:], '"')
+			if j == -1 {
+				j = len(bytes.TrimRight(s[i+1:], "\r\n"))
+				t.Value = string(s[i+1 : i+1+j])
+				i = i + 1 + j
+			} else {
+				t.Value = string(s[i+1 : i+1+j])
+				i = i + 1 + j + 1
+			}
+		} else {
+			j := bytes.IndexAny(s[i:], " \t\r\n")
+			if j == -1 {
+				j = len(s) - i
+			}
+			t.Value = string(s[i : i+j])
+			i += j
+		}
+		t.End = start + i
+		if l.keyword == "" {
+			l.keyword = strings.ToUpper(t.Value)
+			continue
+		}
+		l.Tokens = append(l.Tokens, t)
+	}
+	return l
+}
+
+// parses "mm:ss:ff" into number of frames
+func parseTime(s string) (uint64, bool) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	var n [3]uint64
+	for i, p := range parts {
+		v, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		n[i] = v
+	}
+	if n[1] >= 60 || n[2] >= framesPerSecond {
+		return 0, false
+	}
+	return (n[0]*60+n[1])*framesPerSecond + n[2], true
+}
+
+func fieldArgTime(d *decode.D, l line, i int) {
+	s := lineparse.FieldToken(d, l.Line, i, "time")
+	frames, ok := parseTime(s)
+	if !ok {
+		d.Fatalf("%s: invalid time %q", l.keyword, s)
+	}
+	d.FieldValueU("frames", frames)
+	d.FieldValueFloat("seconds", float64(frames)/framesPerSecond)
+}
+
+// commands shared between top level, file and track
+type commands struct {
+	remarks []line
+	strings []line
+}
+
+func (c *commands) add(b []byte, l line) bool {
+	switch {
+	case l.keyword == "REM":
+		c.remarks = append(c.remarks, l.rest(b, 1))
+	case stringCommands[l.keyword] != "":
+		c.strings = append(c.strings, l.rest(b, 0))
+	default:
+		return false
+	}
+	return true
+}
+
+func (c *commands) fields(d *decode.D) {
+	if len(c.remarks) > 0 {
+		d.FieldArray("remarks", func(d *decode.D) {
+			for _, l := range c.remarks {
+				d.FieldStruct("remark", func(d *decode.D) {
+					lineparse.FieldToken(d, l.Line, 0, "key")
+					if len(l.Tokens) > 1 {
+						lineparse.FieldToken(d, l.Line, 1, "value")
+					}
+				})
+			}
+		})
+	}
+	for _, l := range c.strings {
+		lineparse.FieldToken(d, l.Line, 0, stringCommands[l.keyword])
+	}
+}
+
+type track struct {
+	line    line
+	flags   []line
+	pregap  []line
+	postgap []line
+	indexes []line
+	commands
+}
+
+type file struct {
+	line   line
+	tracks []*track
+	commands
+}
+
+func cueDecode(d *decode.D, in interface{}) interface{} {
+	b := d.BytesLen(int(d.Len() / 8))
+	d.SeekAbs(0)
+
+	var root commands
+	var files []*file
+	var currentFile *file
+	var currentTrack *track
+
+	pos := 0
+	if bytes.HasPrefix(b, []byte("\xef\xbb\xbf")) {
+		d.FieldUTF8("bom", 3)
+		pos = 3
+	}
+
+	for pos < len(b) {
+		end := len(b)
+		if i := bytes.IndexByte(b[pos:], '\n'); i != -1 {
+			end = pos + i + 1
+		}
+		l := parseLine(b, pos, end)
+		pos = end
+
+		switch {
+		case l.keyword == "":
+			// empty line
+		case l.keyword == "FILE":
+			if len(l.Tokens) < 2 {
+				d.Fatalf("FILE: missing arguments")
+			}
+			// unquoted filename can contain spaces, type is last argument
+			fileType := l.Tokens[len(l.Tokens)-1]
+			l = l.rest(b, 0)
+			l.Tokens[0].End = fileType.Start
+			l.Tokens[0].Value = strings.TrimSpace(string(b[l.Tokens[0].Start:fileType.Start]))
+			l.Tokens[0].Value = strings.Trim(l.Tokens[0].Value, `"`)
+			l.Tokens = append(l.Tokens, fileType)
+			currentFile = &file{line: l}
+			currentTrack = nil
+			files = append(files, currentFile)
+		case l.keyword == "TRACK":
+			if currentFile == nil {
+				d.Fatalf("TRACK before FILE")
+			}
+			currentTrack = &track{line: l}
+			currentFile.tracks = append(currentFile.tracks, currentTrack)
+		case l.keyword == "INDEX" || l.keyword == "PREGAP" || l.keyword == "POSTGAP" || l.keyword == "FLAGS":
+			if currentTrack == nil {
+				d.Fatalf("%s outside TRACK", l.keyword)
+			}
+			switch l.keyword {
+			case "INDEX":
+				currentTrack.indexes = append(currentTrack.indexes, l)
+			case "PREGAP":
+				currentTrack.pregap = append(currentTrack.pregap, l)
+			case "POSTGAP":
+				currentTrack.postgap = append(currentTrack.postgap, l)
+			case "FLAGS":
+				currentTrack.flags = append(currentTrack.flags, l)
+			}
+		default:
+			c := &root
+			if currentTrack != nil {
+				c = &currentTrack.commands
+			} else if currentFile != nil {
+				c = &currentFile.commands
+			}
+			if !c.add(b, l) {
+				if len(files) == 0 && len(root.remarks) == 0 && len(root.strings) == 0 {
+					d.Fatalf("unknown command %q", l.keyword)
+				}
+				// unknown command, ends up as unknown gap
+			}
+		}
+	}
+
+	if len(files) == 0 {
+		d.Fatalf("no FILE found")
+	}
+
+	root.fields(d)
+	d.FieldArray("files", func(d *decode.D) {
+		for _, f := range files {
+			d.FieldStruct("file", func(d *decode.D) {
+				lineparse.FieldToken(d, f.line.Line, 0, "filename")
+				lineparse.FieldToken(d, f.line.Line, 1, "file_type", fileTypeNames)
+				f.commands.fields(d)
+				d.FieldArray("tracks", func(d *decode.D) {
+					for _, t := range f.tracks {
+						d.FieldStruct("track", func(d *decode.D) {
+							lineparse.FieldTokenU(d, t.line.Line, 0, "number")
+							lineparse.FieldToken(d, t.line.Line, 1, "track_type", trackTypeNames)
+							t.commands.fields(d)
+							if len(t.flags) > 0 {
+								d.FieldArray("flags", func(d *decode.D) {
+									for _, l := range t.flags {
+										for i := range l.Tokens {
+											lineparse.FieldToken(d, l.Line, i, "flag", flagNames)
+										}
+									}
+								})
+							}
+							for _, l := range t.pregap {
+								d.FieldStruct("pregap", func(d *decode.D) { fieldArgTime(d, l, 0) })
+							}
+							d.FieldArray("indexes", func(d *decode.D) {
+								for _, l := range t.indexes {
+									d.FieldStruct("index", func(d *decode.D) {
+										lineparse.FieldTokenU(d, l.Line, 0, "number")
+										fieldArgTime(d, l, 1)
+									})
+								}
+							})
+							for _, l := range t.postgap {
+								d.FieldStruct("postgap", func(d *decode.D) { fieldArgTime(d, l, 0) })
+							}
+						})
+					}
+				})
+			})
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,17 @@
+REM GENRE "Electronic"
+REM DATE 2022
+REM REPLAYGAIN_ALBUM_GAIN -7.89 dB
+PERFORMER "Test Artist"
+TITLE "Test Album"
+FILE "Test Album.flac" WAVE
+  TRACK 01 AUDIO
+    TITLE "First"
+    PERFORMER "Test Artist"
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    TITLE "Second song"
+    FLAGS DCP PRE
+    ISRC USABC2200001
+    INDEX 00 03:58:40
+    INDEX 01 04:00:00
+    POSTGAP 00:02:00
@@ -0,0 +1,314 @@
+package dbus
+
+// https://dbus.freedesktop.org/doc/dbus-specification.html#message-protocol
+// https://dbus.freedesktop.org/doc/dbus-specification.html#auth-protocol
+
+// TODO: unix fds
+
+import (
+	"bytes"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/ranges"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.DBUS_MESSAGE,
+		Description: "D-Bus messages",
+		Groups: []string{
+			format.TCP_STREAM,
+		},
+		DecodeFn: dbusDecode,
+	})
+}
+
+const (
+	maxDepth       = 64
+	maxArrayLength = 64 * 1024 * 1024
+)
+
+var endianNames = scalar.StrToSymStr{
+	"l": "little_endian",
+	"B": "big_endian",
+}
+
+const (
+	messageTypeMethodCall   = 1
+	messageTypeMethodReturn = 2
+	messageTypeError        = 3
+	messageTypeSignal       = 4
+)
+
+var messageTypeNames = scalar.UToSymStr{
+	0:                       "invalid",
+	messageTypeMethodCall:   "method_call",
+	messageTypeMethodReturn: "method_return",
+	messageTypeError:        "error",
+	messageTypeSignal:       "signal",
+}
+
+const (
+	headerFieldPath        = 1
+	headerFieldInterface   = 2
+	headerFieldMember      = 3
+	headerFieldErrorName   = 4
+	headerFieldReplySerial = 5
+	headerFieldDestination = 6
+	headerFieldSender      = 7
+	headerFieldSignature   = 8
+	headerFieldUnixFDs     = 9
+)
+
+var headerFieldNames = scalar.UToSymStr{
+	0:                      "invalid",
+	headerFieldPath:        "path",
+	headerFieldInterface:   "interface",
+	headerFieldMember:      "member",
+	headerFieldErrorName:   "error_name",
+	headerFieldReplySerial: "reply_serial",
+	headerFieldDestination: "destination",
+	headerFieldSender:      "sender",
+	headerFieldSignature:   "signature",
+	headerFieldUnixFDs:     "unix_fds",
+}
+
+type decoder struct {
+	// start of message, alignment is relative to it
+	start int64
+}
+
+// skip alignment padding, is not added as a field as arrays and structs would
+// get extra elements. Gaps are added as alignment fields to message afterwards.
+func (dr decoder) align(d *decode.D, n int64) {
+	if rem := ((d.Pos() - dr.start) / 8) % n; rem != 0 {
+		d.SeekRel((n - rem) * 8)
+	}
+}
+
+func (dr decoder) str(d *decode.D) string {
+	dr.align(d, 4)
+	length := d.U32()
+	if int64(length)*8 > d.BitsLeft() {
+		d.Fatalf("string length %d larger than input", length)
+	}
+	s := d.UTF8(int(length))
+	d.U8()
+	return s
+}
+
+func signature(d *decode.D) string {
+	length := d.U8()
+	s := d.UTF8(int(length))
+	d.U8()
+	return s
+}
+
+func (dr decoder) decodeValue(d *decode.D, name string, t *dbusType, depth int) {
+	if depth > maxDepth {
+		d.Fatalf("value nested too deep")
+	}
+
+	dr.align(d, t.align())
+	switch t.kind {
+	case 'y':
+		d.FieldU8(name)
+	case 'b':
+		d.FieldBoolFn(name, func(d *decode.D) bool { return d.U32() != 0 })
+	case 'n':
+		d.FieldS16(name)
+	case 'q':
+		d.FieldU16(name)
+	case 'i':
+		d.FieldS32(name)
+	case 'u':
+		d.FieldU32(name)
+	case 'h':
+		d.FieldU32(name, scalar.Description("unix fd index"))
+	case 'x':
+		d.FieldS64(name)
+	case 't':
+		d.FieldU64(name)
+	case 'd':
+		d.FieldF64(name)
+	case 's', 'o':
+		d.FieldStrFn(name, dr.str)
+	case 'g':
+		d.FieldStrFn(name, signature)
+	case 'v':
+		d.FieldStruct(name, func(d *decode.D) {
+			sig := d.FieldStrFn("signature", signature)
+			vt, rest, err := parseType(sig, depth)
+			if err != nil || rest != "" {
+				d.Fatalf("invalid variant signature %q", sig)
+			}
+			dr.decodeValue(d, "value", vt, depth+1)
+		})
+	case 'a':
+		elemName := "element"
+		if t.elem.kind == '{' {
+			elemName = "entry"
+		}
+		d.FieldStruct(name, func(d *decode.D) {
+			length := int64(d.FieldU32("length"))
+			if length > maxArrayLength {
+				d.Fatalf("array length %d too large", length)
+			}
+			// padding to element alignment is not part of length
+			if rem := ((d.Pos() - dr.start) / 8) % t.elem.align(); rem != 0 {
+				d.FieldRawLen("padding", (t.elem.align()-rem)*8, d.BitBufIsZero())
+			}
+			if t.elem.kind == 'y' {
+				d.FieldRawLen("value", length*8, scalar.RawHex)
+				return
+			}
+			end := d.Pos() + length*8
+			d.FieldArray("elements", func(d *decode.D) {
+				for d.Pos() < end {
+					dr.decodeValue(d, elemName, t.elem, depth+1)
+				}
+			})
+		})
+	case '(':
+		// structs are positional
+		d.FieldArray(name, func(d *decode.D) {
+			for _, m := range t.members {
+				dr.decodeValue(d, "member", m, depth+1)
+			}
+		})
+	case '{':
+		d.FieldStruct(name, func(d *decode.D) {
+			dr.decodeValue(d, "key", t.members[0], depth+1)
+			dr.decodeValue(d, "value", t.members[1], depth+1)
+		})
+	}
+}
+
+func decodeMessage(d *decode.D) {
+	dr := decoder{start: d.Pos()}
+
+	switch d.FieldUTF8("endian", 1, endianNames) {
+	case "l":
+		d.Endian = decode.LittleEndian
+	case "B":
+		d.Endian = decode.BigEndian
+	default:
+		d.Fatalf("unknown endian")
+	}
+	messageType := d.FieldU8("type", messageTypeNames)
+	d.FieldStruct("flags", func(d *decode.D) {
+		d.FieldU5("unused")
+		d.FieldBool("allow_interactive_authorization")
+		d.FieldBool("no_auto_start")
+		d.FieldBool("no_reply_expected")
+	})
+	d.FieldU8("version", d.AssertU(1))
+	bodyLength := d.FieldU32("body_length")
+	d.FieldU32("serial")
+
+	var bodySignature string
+	headerFieldsLength := d.FieldU32("header_fields_length")
+	dr.align(d, 8)
+	headerFieldsEnd := d.Pos() + int64(headerFieldsLength)*8
+	d.FieldArray("header_fields", func(d *decode.D) {
+		for d.Pos() < headerFieldsEnd {
+			dr.align(d, 8)
+			d.FieldStruct("header_field", func(d *decode.D) {
+				code := d.FieldU8("code", headerFieldNames)
+				d.FieldStruct("value", func(d *decode.D) {
+					sig := d.FieldStrFn("signature", signature)
+					vt, rest, err := parseType(sig, 0)
+					if err != nil || rest != "" {
+						d.Fatalf("invalid header field signature %q", sig)
+					}
+					if code == headerFieldSignature && vt.kind == 'g' {
+						bodySignature = d.FieldStrFn("value", signature)
+					} else {
+						dr.decodeValue(d, "value", vt, 1)
+					}
+				})
+			})
+		}
+	})
+	// body starts at 8 byte boundary
+	if rem := ((d.Pos() - dr.start) / 8) % 8; rem != 0 {
+		d.FieldRawLen("header_padding", (8-rem)*8, d.BitBufIsZero())
+	}
+
+	d.FieldStruct("body", func(d *decode.D) {
+		d.LenFn(int64(bodyLength)*8, func(d *decode.D) {
+			if messageType == messageTypeError && bodySignature == "" {
+				return
+			}
+			types, err := parseSignature(bodySignature)
+			if err != nil {
+				d.Fatalf("invalid body signature %q: %s", bodySignature, err)
+			}
+			d.FieldArray("arguments", func(d *decode.D) {
+				for _, t := range types {
+					dr.decodeValue(d, "argument", t, 0)
+				}
+			})
+			if d.NotEnd() {
+				d.FieldRawLen("unknown", d.BitsLeft())
+			}
+		})
+	})
+
+	d.FillGaps(ranges.Range{Start: dr.start, Len: d.Pos() - dr.start}, "alignment")
+}
+
+// authentication is line based and done before any messages, client sends a
+// zero byte and then commands. Commands are uppercase so can be told apart from
+// messages that starts with endian byte.
+func isAuthLine(d *decode.D) bool {
+	if d.BitsLeft() < 8 {
+		return false
+	}
+	c := d.PeekBits(8)
+	return c >= 'A' && c <= 'Z'
+}
+
+func decodeAuth(d *decode.D) {
+	if d.PeekBits(8) == 0 {
+		d.FieldU8("credentials_byte")
+	}
+	d.FieldArray("lines", func(d *decode.D) {
+		for isAuthLine(d) {
+			b := d.BytesRange(d.Pos(), int(d.BitsLeft()/8))
+			n := bytes.Index(b, []byte("\r\n"))
+			if n < 0 {
+				d.Fatalf("unterminated auth line")
+			}
+			line := d.FieldUTF8("line", n+2, scalar.TrimSpace)
+			if line == "BEGIN" {
+				break
+			}
+		}
+	})
+}
+
+func dbusDecode(d *decode.D, in interface{}) interface{} {
+	if _, ok := in.(format.TCPStreamIn); ok {
+		// there is no standard port, require authentication exchange
+		var prefix []byte
+		if d.BitsLeft() >= 8*8 {
+			prefix = d.PeekBytes(8)
+		}
+		if !bytes.HasPrefix(prefix, []byte("\x00AUTH")) &&
+			!bytes.HasPrefix(prefix, []byte("OK ")) &&
+			!bytes.HasPrefix(prefix, []byte("REJECTED")) {
+			d.Fatalf("no authentication exchange")
+		}
+	}
+
+	if d.PeekBits(8) == 0 || isAuthLine(d) {
+		d.FieldStruct("auth", decodeAuth)
+	}
+	d.FieldStructArrayLoop("messages", "message", d.NotEnd, decodeMessage)
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package dbus
+
+import "fmt"
+
+type dbusType struct {
+	kind    byte
+	elem    *dbusType
+	members []*dbusType
+}
+
+func (t *dbusType) align() int64 {
+	switch t.kind {
+	case 'n', 'q':
+		return 2
+	case 'b', 'i', 'u', 'h', 's', 'o', 'a':
+		return 4
+	case 'x', 't', 'd', '(', '{':
+		return 8
+	default:
+		// y, g and v
+		return 1
+	}
+}
+
+func parseType(sig string, depth int) (*dbusType, string, error) {
+	if sig == "" {
+		return nil, "", fmt.Errorf("unexpected end of signature")
+	}
+	if depth > maxDepth {
+		return nil, "", fmt.Errorf("signature nested too deep")
+	}
+
+	t := &dbusType{kind: sig[0]}
+	rest := sig[1:]
+	switch t.kind {
+	case 'y', 'b', 'n', 'q', 'i', 'u', 'x', 't', 'd', 'h', 's', 'o', 'g', 'v':
+	case 'a':
+		elem, r, err := parseType(rest, depth+1)
+		if err != nil {
+			return nil, "", err
+		}
+		t.elem = elem
+		rest = r
+	case '(', '{':
+		end := byte(')')
+		if t.kind == '{' {
+			end = '}'
+		}
+		for {
+			if rest == "" {
+				return nil, "", fmt.Errorf("unterminated %c", t.kind)
+			}
+			if rest[0] == end {
+				rest = rest[1:]
+				break
+			}
+			m, r, err := parseType(rest, depth+1)
+			if err != nil {
+				return nil, "", err
+			}
+			t.members = append(t.members, m)
+			rest = r
+		}
+		if t.kind == '(' && len(t.members) == 0 {
+			return nil, "", fmt.Errorf("empty struct")
+		}
+		if t.kind == '{' && len(t.members) != 2 {
+			return nil, "", fmt.Errorf("dict entry must have two members")
+		}
+	default:
+		return nil, "", fmt.Errorf("unknown type %q", t.kind)
+	}
+
+	return t, rest, nil
+}
+
+// signature is a sequence of complete types
+func parseSignature(sig string) ([]*dbusType, error) {
+	var types []*dbusType
+	for sig != "" {
+		t, rest, err := parseType(sig, 0)
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+		sig = rest
+	}
+	return types, nil
+}
@@ -44,63 +44,67 @@ var classNames = scalar.URangeToScalar{
 }
 
 const (
-	typeA     = 1
-	typeNS    = 2
-	typeCNAME = 5
-	typeSOA   = 6
-	typePTR   = 12
-	typeTXT   = 16
-	typeAAAA  = 28
+	typeA      = 1
+	typeNS     = 2
+	typeCNAME  = 5
+	typeSOA    = 6
+	typePTR    = 12
+	typeTXT    = 16
+	typeAAAA   = 28
+	typeSRV    = 33
+	typeDNSKEY = 48
 )
 
 var typeNames = scalar.UToSymStr{
-	typeA:     "A",
-	typeAAAA:  "AAAA",
-	18:        "AFSDB",
-	42:        "APL",
-	257:       "CAA",
-	60:        "CDNSKEY",
-	59:        "CDS",
-	37:        "CERT",
-	typeCNAME: "CNAME",
-	62:        "CSYNC",
-	49:        "DHCID",
-	32769:     "DLV",
-	39:        "DNAME",
-	48:        "DNSKEY",
-	43:        "DS",
-	108:       "EUI48",
-	109:       "EUI64",
-	13:        "HINFO",
-	55:        "HIP",
-	45:        "IPSECKEY",
-	25:        "KEY",
-	36:        "KX",
-	29:        "LOC",
-	15:        "MX",
-	35:        "NAPTR",
-	typeNS:    "NS",
-	47:        "NSEC",
-	50:        "NSEC3",
-	51:        "NSEC3PARAM",
-	61:        "OPENPGPKEY",
-	typePTR:   "PTR",
-	46:        "RRSIG",
-	17:        "RP",
-	24:        "SIG",
-	53:        "SMIMEA",
-	typeSOA:   "SOA",
-	33:        "SRV",
-	44:        "SSHFP",
-	32768:     "TA",
-	249:       "TKEY",
-	52:        "TLSA",
-	250:       "TSIG",
-	typeTXT:   "TXT",
-	256:       "URI",
-	63:        "ZONEMD",
-	64:        "SVCB",
-	65:        "HTTPS",
+	typeA:      "A",
+	typeAAAA:   "AAAA",
+	18:         "AFSDB",
+	42:         "APL",
+	257:        "CAA",
+	60:         "CDNSKEY",
+	59:         "CDS",
+	37:         "CERT",
+	typeCNAME:  "CNAME",
+	62:         "CSYNC",
+	49:         "DHCID",
+	32769:      "DLV",
+	39:         "DNAME",
+	typeDNSKEY: "DNSKEY",
+	43:         "DS",
+	108:        "EUI48",
+	109:        "EUI64",
+	13:         "HINFO",
+	55:         "HIP",
+	45:         "IPSECKEY",
+	25:         "KEY",
+	36:         "KX",
+	29:         "LOC",
+	15:         "MX",
+	35:         "NAPTR",
+	typeNS:     "NS",
+	47:         "NSEC",
+	50:         "NSEC3",
+	51:         "NSEC3PARAM",
+	61:         "OPENPGPKEY",
+	typePTR:    "PTR",
+	46:         "RRSIG",
+	17:         "RP",
+	24:         "SIG",
+	53:         "SMIMEA",
+	typeSOA:    "SOA",
+	typeSRV:    "SRV",
+	44:         "SSHFP",
+	32768:      "TA",
+	249:        "TKEY",
+	52:         "TLSA",
+	250:        "TSIG",
+	typeTXT:    "TXT",
+	256:        "URI",
+	63:         "ZONEMD",
+	64:         "SVCB",
+	65:         "HTTPS",
+	41:         "OPT",
+	255:        "ANY",
 }
 
 var rcodeNames = scalar.UToScalar{
@@ -125,6 +129,40 @@ var rcodeNames = scalar.UToScalar{
 	21: {Sym: "BADALG", Description: "Algorithm not supported"},       // RFC 2930
 }
 
+// https://www.iana.org/assignments/dns-sec-alg-numbers/dns-sec-alg-numbers.xhtml
+var dnssecAlgorithmNames = scalar.UToScalar{
+	1:  {Sym: "RSAMD5", Description: "RSA/MD5"},
+	3:  {Sym: "DSA", Description: "DSA/SHA1"},
+	5:  {Sym: "RSASHA1", Description: "RSA/SHA-1"},
+	6:  {Sym: "DSA-NSEC3-SHA1", Description: "DSA-NSEC3-SHA1"},
+	7:  {Sym: "RSASHA1-NSEC3-SHA1", Description: "RSASHA1-NSEC3-SHA1"},
+	8:  {Sym: "RSASHA256", Description: "RSA/SHA-256"},
+	10: {Sym: "RSASHA512", Description: "RSA/SHA-512"},
+	12: {Sym: "ECC-GOST", Description: "GOST R 34.10-2001"},
+	13: {Sym: "ECDSAP256SHA256", Description: "ECDSA Curve P-256 with SHA-256"},
+	14: {Sym: "ECDSAP384SHA384", Description: "ECDSA Curve P-384 with SHA-384"},
+	15: {Sym: "ED25519", Description: "Ed25519"},
+	16: {Sym: "ED448", Description: "Ed448"},
+}
+
+// key tag as described in RFC 4034 appendix B
+func dnskeyKeyTag(rdata []byte) uint64 {
+	// RSA/MD5 uses most significant 16 bits of the least significant 24 bits of modulus
+	if len(rdata) > 4 && rdata[3] == 1 {
+		return uint64(rdata[len(rdata)-3])<<8 | uint64(rdata[len(rdata)-2])
+	}
+	var ac uint64
+	for i, b := range rdata {
+		if i&1 == 1 {
+			ac += uint64(b)
+		} else {
+			ac += uint64(b) << 8
+		}
+	}
+	ac += (ac >> 16) & 0xffff
+	return ac & 0xffff
+}
+
 func decodeAStr(d *decode.D) string {
 	return net.IP(d.BytesLen(4)).String()
 }
@@ -215,6 +253,26 @@ func dnsDecodeRR(d *decode.D, pointerOffset int64, resp bool, count uint64, name
 							})
 						case class == classIN && typ == typeAAAA:
 							d.FieldStrFn("address", decodeAAAAStr)
+						case typ == typeSRV:
+							// RFC 2782
+							d.FieldU16("priority")
+							d.FieldU16("weight")
+							d.FieldU16("port")
+							// target is not allowed to be compressed but be liberal
+							fieldDecodeLabel(d, pointerOffset, "target")
+						case typ == typeDNSKEY:
+							// RFC 4034
+							d.FieldValueU("key_tag", dnskeyKeyTag(d.PeekBytes(int(rdLength))))
+							d.FieldStruct("flags", func(d *decode.D) {
+								d.FieldU7("unused0")
+								d.FieldBool("zone_key")
+								d.FieldBool("revoke") // RFC 5011
+								d.FieldU6("unused1")
+								d.FieldBool("secure_entry_point")
+							})
+							d.FieldU8("protocol")
+							d.FieldU8("algorithm", dnssecAlgorithmNames)
+							d.FieldRawLen("public_key", d.BitsLeft())
 						default:
 							d.FieldUTF8("rdata", int(rdLength))
 						}
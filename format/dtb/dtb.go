@@ -0,0 +1,258 @@
+package dtb
+
+// https://github.com/devicetree-org/devicetree-specification/releases (chapter 5, Flattened Devicetree (DTB) Format)
+// https://git.kernel.org/pub/scm/utils/dtc/dtc.git/tree/libfdt/fdt.h
+
+import (
+	"bytes"
+	"embed"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed *.jq
+var dtbFS embed.FS
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.DTB,
+		Description: "Devicetree blob",
+		Groups:      []string{format.PROBE},
+		ProbeOrder:  10, // after uboot_image, FIT images are devicetree blobs
+		Magic:       []decode.Magic{{Bytes: []byte{0xd0, 0x0d, 0xfe, 0xed}}},
+		DecodeFn:    dtbDecode,
+		Files:       dtbFS,
+	})
+}
+
+const headerMagic = 0xd00dfeed
+
+const headerSize = 40
+
+// latest version in devicetree specification, later versions are backwards compatible
+// with last_comp_version
+const latestVersion = 17
+
+const (
+	tokenBeginNode = 0x1
+	tokenEndNode   = 0x2
+	tokenProp      = 0x3
+	tokenNop       = 0x4
+	tokenEnd       = 0x9
+)
+
+var tokenNames = scalar.UToSymStr{
+	tokenBeginNode: "begin_node",
+	tokenEndNode:   "end_node",
+	tokenProp:      "prop",
+	tokenNop:       "nop",
+	tokenEnd:       "end",
+}
+
+// guard against stack exhaustion, real trees are a few levels deep
+const maxNodeDepth = 256
+
+// property values that are one or more printable null terminated strings,
+// same heuristics as dtc uses when decompiling
+func isStringList(b []byte) bool {
+	if len(b) == 0 || b[len(b)-1] != 0 {
+		return false
+	}
+	for _, s := range bytes.Split(b[:len(b)-1], []byte{0}) {
+		if len(s) == 0 {
+			return false
+		}
+		for _, c := range s {
+			if c < 0x20 || c > 0x7e {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func fieldPadding(d *decode.D) {
+	if n := d.AlignBits(32); n > 0 {
+		d.FieldRawLen("padding", int64(n), d.BitBufIsZero())
+	}
+}
+
+type decodeContext struct {
+	strings    []byte
+	properties []format.DTBProperty
+}
+
+// name of property at offset into strings block
+func (dc *decodeContext) stringAt(d *decode.D, off uint64) string {
+	if off >= uint64(len(dc.strings)) {
+		d.Fatalf("property name offset %d outside strings block", off)
+	}
+	s := dc.strings[off:]
+	if i := bytes.IndexByte(s, 0); i != -1 {
+		s = s[:i]
+	}
+	return string(s)
+}
+
+func decodeProperty(d *decode.D, dc *decodeContext, path string) {
+	d.FieldU32("token", tokenNames)
+	length := d.FieldU32("len")
+	nameOff := d.FieldU32("nameoff")
+	name := dc.stringAt(d, nameOff)
+	d.FieldValueStr("name", name)
+
+	if int64(length)*8 > d.BitsLeft() {
+		d.Fatalf("property length %d larger than struct block", length)
+	}
+	value := d.PeekBytes(int(length))
+	dc.properties = append(dc.properties, format.DTBProperty{
+		Path:  path,
+		Name:  name,
+		Pos:   d.Pos(),
+		Value: value,
+	})
+	switch {
+	case length == 0:
+		// boolean property, present or not
+	case isStringList(value):
+		if bytes.Count(value, []byte{0}) == 1 {
+			d.FieldUTF8Null("string")
+		} else {
+			d.FieldArray("strings", func(d *decode.D) {
+				for end := d.Pos() + int64(length)*8; d.Pos() < end; {
+					d.FieldUTF8Null("string")
+				}
+			})
+		}
+	case length%4 == 0:
+		d.FieldArray("cells", func(d *decode.D) {
+			for i := uint64(0); i < length/4; i++ {
+				d.FieldU32("cell", scalar.Hex)
+			}
+		})
+	default:
+		d.FieldRawLen("value", int64(length)*8)
+	}
+	fieldPadding(d)
+}
+
+func decodeNode(d *decode.D, dc *decodeContext, parentPath string, depth int) {
+	if depth > maxNodeDepth {
+		d.Fatalf("node depth above %d", maxNodeDepth)
+	}
+
+	d.FieldU32("token", tokenNames, d.AssertU(tokenBeginNode))
+	name := d.FieldUTF8Null("name")
+	fieldPadding(d)
+
+	path := "/"
+	switch {
+	case depth == 0:
+	case parentPath == "/":
+		path = "/" + name
+	default:
+		path = parentPath + "/" + name
+	}
+
+	propertiesD := d.FieldArrayValue("properties")
+	nodesD := d.FieldArrayValue("nodes")
+	// nop tokens end up in properties or nodes depending on position
+	nopD := propertiesD
+	for {
+		switch token := d.PeekBits(32); token {
+		case tokenProp:
+			propertiesD.FieldStruct("property", func(d *decode.D) { decodeProperty(d, dc, path) })
+		case tokenBeginNode:
+			nodesD.FieldStruct("node", func(d *decode.D) { decodeNode(d, dc, path, depth+1) })
+			nopD = nodesD
+		case tokenNop:
+			nopD.FieldStruct("nop", func(d *decode.D) { d.FieldU32("token", tokenNames) })
+		case tokenEndNode:
+			d.FieldU32("end_token", tokenNames)
+			return
+		default:
+			d.Fatalf("unexpected token %d", token)
+		}
+	}
+}
+
+func dtbDecode(d *decode.D, in interface{}) interface{} {
+	var offDtStruct, offDtStrings, offMemRsvmap uint64
+	var sizeDtStrings, sizeDtStruct uint64
+	var totalSize uint64
+
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldU32("magic", d.AssertU(headerMagic), scalar.Hex)
+		totalSize = d.FieldU32("totalsize")
+		if totalSize < headerSize || totalSize*8 > uint64(d.Len()) {
+			d.Fatalf("invalid totalsize %d", totalSize)
+		}
+		offDtStruct = d.FieldU32("off_dt_struct")
+		offDtStrings = d.FieldU32("off_dt_strings")
+		offMemRsvmap = d.FieldU32("off_mem_rsvmap")
+		version := d.FieldU32("version")
+		if version < 17 {
+			d.Fatalf("unsupported version %d", version)
+		}
+		lastCompVersion := d.FieldU32("last_comp_version")
+		if version > latestVersion {
+			d.FieldWarnf("version", decode.WarningUnknownVersion, "version %d newer than latest known %d, backwards compatible with %d", version, latestVersion, lastCompVersion)
+		}
+		d.FieldU32("boot_cpuid_phys")
+		sizeDtStrings = d.FieldU32("size_dt_strings")
+		sizeDtStruct = d.FieldU32("size_dt_struct")
+
+		for _, r := range [][2]uint64{
+			{offDtStruct, sizeDtStruct},
+			{offDtStrings, sizeDtStrings},
+			{offMemRsvmap, 0},
+		} {
+			if r[0] < headerSize || r[0]+r[1] > totalSize {
+				d.Fatalf("block at %d size %d outside totalsize %d", r[0], r[1], totalSize)
+			}
+		}
+	})
+
+	dc := &decodeContext{}
+	dc.strings = d.BytesRange(int64(offDtStrings)*8, int(sizeDtStrings))
+
+	d.SeekAbs(int64(offMemRsvmap) * 8)
+	d.FieldArray("mem_rsvmap", func(d *decode.D) {
+		for {
+			var address, size uint64
+			d.FieldStruct("entry", func(d *decode.D) {
+				address = d.FieldU64("address", scalar.Hex)
+				size = d.FieldU64("size", scalar.Hex)
+			})
+			// terminated by zero entry
+			if address == 0 && size == 0 {
+				break
+			}
+		}
+	})
+
+	d.SeekAbs(int64(offDtStruct) * 8)
+	d.LenFn(int64(sizeDtStruct)*8, func(d *decode.D) {
+		d.FieldStruct("structure", func(d *decode.D) {
+			for d.PeekBits(32) == tokenNop {
+				d.FieldU32("nop", tokenNames)
+			}
+			d.FieldStruct("root", func(d *decode.D) { decodeNode(d, dc, "", 0) })
+			d.FieldU32("end_token", tokenNames, d.AssertU(tokenEnd))
+		})
+	})
+
+	d.SeekAbs(int64(offDtStrings) * 8)
+	d.LenFn(int64(sizeDtStrings)*8, func(d *decode.D) {
+		d.FieldArray("strings", func(d *decode.D) {
+			for !d.End() {
+				d.FieldUTF8Null("string")
+			}
+		})
+	})
+
+	return format.DTBOut{TotalSize: totalSize, Properties: dc.properties}
+}
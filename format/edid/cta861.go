@@ -0,0 +1,297 @@
+package edid
+
+// CTA-861-G extension block
+
+import (
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+const (
+	extensionCTA861 = 0x02
+)
+
+var extensionTagNames = scalar.UToScalar{
+	extensionCTA861: {Sym: "cta861", Description: "CTA-861 extension"},
+	0x10:            {Sym: "vtb", Description: "Video timing block extension"},
+	0x40:            {Sym: "di", Description: "Display information extension"},
+	0x50:            {Sym: "ls", Description: "Localized string extension"},
+	0x60:            {Sym: "dpvl", Description: "Digital packet video link extension"},
+	0x70:            {Sym: "displayid", Description: "DisplayID extension"},
+	0xf0:            {Sym: "block_map", Description: "Extension block map"},
+	0xff:            {Sym: "manufacturer", Description: "Manufacturer defined extension"},
+}
+
+const (
+	dataBlockAudio             = 1
+	dataBlockVideo             = 2
+	dataBlockVendorSpecific    = 3
+	dataBlockSpeakerAllocation = 4
+	dataBlockVESADisplayTiming = 5
+	dataBlockExtended          = 7
+)
+
+var dataBlockTagNames = scalar.UToSymStr{
+	dataBlockAudio:             "audio",
+	dataBlockVideo:             "video",
+	dataBlockVendorSpecific:    "vendor_specific",
+	dataBlockSpeakerAllocation: "speaker_allocation",
+	dataBlockVESADisplayTiming: "vesa_display_transfer_characteristic",
+	dataBlockExtended:          "extended",
+}
+
+var extendedTagNames = scalar.UToSymStr{
+	0:   "video_capability",
+	1:   "vendor_specific_video",
+	2:   "vesa_display_device",
+	3:   "vesa_video_timing",
+	5:   "colorimetry",
+	6:   "hdr_static_metadata",
+	7:   "hdr_dynamic_metadata",
+	13:  "video_format_preference",
+	14:  "ycbcr420_video",
+	15:  "ycbcr420_capability_map",
+	17:  "vendor_specific_audio",
+	18:  "hdmi_audio",
+	19:  "room_configuration",
+	20:  "speaker_location",
+	32:  "infoframe",
+	120: "hdmi_forum_edid_extension_override",
+	121: "hdmi_forum_sink_capability",
+}
+
+const audioFormatLPCM = 1
+
+var audioFormatNames = scalar.UToSymStr{
+	audioFormatLPCM: "lpcm",
+	2:               "ac3",
+	3:               "mpeg1",
+	4:               "mp3",
+	5:               "mpeg2",
+	6:               "aac_lc",
+	7:               "dts",
+	8:               "atrac",
+	9:               "one_bit_audio",
+	10:              "enhanced_ac3",
+	11:              "dts_hd",
+	12:              "mat",
+	13:              "dst",
+	14:              "wma_pro",
+	15:              "extended",
+}
+
+const (
+	ouiHDMI      = 0x000c03
+	ouiHDMIForum = 0xc45dd8
+)
+
+var ouiNames = scalar.UToSymStr{
+	ouiHDMI:      "hdmi",
+	ouiHDMIForum: "hdmi_forum",
+	0x00001a:     "amd",
+	0x00044b:     "nvidia",
+	0x90848b:     "hdr10_plus",
+	0x00d046:     "dolby",
+}
+
+// https://www.cta.tech CTA-861-G table 3
+var vicNames = scalar.UToSymStr{
+	1:   "640x480p@60 4:3",
+	2:   "720x480p@60 4:3",
+	3:   "720x480p@60 16:9",
+	4:   "1280x720p@60 16:9",
+	5:   "1920x1080i@60 16:9",
+	6:   "720(1440)x480i@60 4:3",
+	7:   "720(1440)x480i@60 16:9",
+	8:   "720(1440)x240p@60 4:3",
+	9:   "720(1440)x240p@60 16:9",
+	10:  "2880x480i@60 4:3",
+	11:  "2880x480i@60 16:9",
+	12:  "2880x240p@60 4:3",
+	13:  "2880x240p@60 16:9",
+	14:  "1440x480p@60 4:3",
+	15:  "1440x480p@60 16:9",
+	16:  "1920x1080p@60 16:9",
+	17:  "720x576p@50 4:3",
+	18:  "720x576p@50 16:9",
+	19:  "1280x720p@50 16:9",
+	20:  "1920x1080i@50 16:9",
+	21:  "720(1440)x576i@50 4:3",
+	22:  "720(1440)x576i@50 16:9",
+	23:  "720(1440)x288p@50 4:3",
+	24:  "720(1440)x288p@50 16:9",
+	25:  "2880x576i@50 4:3",
+	26:  "2880x576i@50 16:9",
+	27:  "2880x288p@50 4:3",
+	28:  "2880x288p@50 16:9",
+	29:  "1440x576p@50 4:3",
+	30:  "1440x576p@50 16:9",
+	31:  "1920x1080p@50 16:9",
+	32:  "1920x1080p@24 16:9",
+	33:  "1920x1080p@25 16:9",
+	34:  "1920x1080p@30 16:9",
+	60:  "1280x720p@24 16:9",
+	61:  "1280x720p@25 16:9",
+	62:  "1280x720p@30 16:9",
+	63:  "1920x1080p@120 16:9",
+	64:  "1920x1080p@100 16:9",
+	93:  "3840x2160p@24 16:9",
+	94:  "3840x2160p@25 16:9",
+	95:  "3840x2160p@30 16:9",
+	96:  "3840x2160p@50 16:9",
+	97:  "3840x2160p@60 16:9",
+	98:  "4096x2160p@24 256:135",
+	99:  "4096x2160p@25 256:135",
+	100: "4096x2160p@30 256:135",
+	101: "4096x2160p@50 256:135",
+	102: "4096x2160p@60 256:135",
+}
+
+func decodeSADs(d *decode.D) {
+	d.FieldStructArrayLoop("descriptors", "descriptor", d.NotEnd, func(d *decode.D) {
+		d.FieldU1("reserved")
+		format := d.FieldU4("format", audioFormatNames)
+		d.FieldU3("channels", scalar.UAdd(1))
+		d.FieldStruct("sample_rates", func(d *decode.D) {
+			d.FieldU1("reserved")
+			d.FieldBool("192khz")
+			d.FieldBool("176_4khz")
+			d.FieldBool("96khz")
+			d.FieldBool("88_2khz")
+			d.FieldBool("48khz")
+			d.FieldBool("44_1khz")
+			d.FieldBool("32khz")
+		})
+		if format == audioFormatLPCM {
+			d.FieldStruct("bit_depths", func(d *decode.D) {
+				d.FieldU5("reserved")
+				d.FieldBool("24bit")
+				d.FieldBool("20bit")
+				d.FieldBool("16bit")
+			})
+		} else {
+			d.FieldU8("format_specific")
+		}
+	})
+}
+
+func decodeSVDs(d *decode.D) {
+	d.FieldStructArrayLoop("descriptors", "descriptor", d.NotEnd, func(d *decode.D) {
+		svd := d.FieldU8("svd")
+		// 129-192 are native VIC 1-64, 193-253 are VIC as is
+		native := svd >= 129 && svd <= 192
+		vic := svd
+		if native {
+			vic = svd - 128
+		}
+		d.FieldValueBool("native", native)
+		d.FieldValueU("vic", vic, vicNames)
+	})
+}
+
+func decodeVendorSpecific(d *decode.D) {
+	oui := d.FieldU24LE("oui", ouiNames, scalar.Hex)
+	if oui == ouiHDMI && d.BitsLeft() >= 16 {
+		d.FieldStruct("physical_address", func(d *decode.D) {
+			d.FieldU4("a")
+			d.FieldU4("b")
+			d.FieldU4("c")
+			d.FieldU4("d")
+		})
+	}
+	if d.NotEnd() {
+		d.FieldRawLen("payload", d.BitsLeft())
+	}
+}
+
+func decodeSpeakerAllocation(d *decode.D) {
+	d.FieldBool("flw_frw")
+	d.FieldBool("rlc_rrc")
+	d.FieldBool("flc_frc")
+	d.FieldBool("rc")
+	d.FieldBool("rl_rr")
+	d.FieldBool("fc")
+	d.FieldBool("lfe")
+	d.FieldBool("fl_fr")
+	if d.NotEnd() {
+		d.FieldRawLen("reserved", d.BitsLeft())
+	}
+}
+
+func decodeDataBlock(d *decode.D) {
+	tag := d.FieldU3("tag", dataBlockTagNames)
+	length := d.FieldU5("length")
+	d.LenFn(int64(length)*8, func(d *decode.D) {
+		switch tag {
+		case dataBlockAudio:
+			decodeSADs(d)
+		case dataBlockVideo:
+			decodeSVDs(d)
+		case dataBlockVendorSpecific:
+			decodeVendorSpecific(d)
+		case dataBlockSpeakerAllocation:
+			decodeSpeakerAllocation(d)
+		case dataBlockExtended:
+			d.FieldU8("extended_tag", extendedTagNames)
+			if d.NotEnd() {
+				d.FieldRawLen("data", d.BitsLeft())
+			}
+		default:
+			if d.NotEnd() {
+				d.FieldRawLen("data", d.BitsLeft())
+			}
+		}
+	})
+}
+
+func decodeCTA861(d *decode.D, start int64) {
+	end := start + (blockLen-1)*8
+
+	d.FieldU8("revision")
+	dtdOffset := d.FieldU8("dtd_offset")
+	// 0 means no data blocks and no detailed timings
+	if dtdOffset != 0 && (dtdOffset < 4 || dtdOffset >= blockLen-1) {
+		d.Fatalf("invalid dtd_offset %d", dtdOffset)
+	}
+	d.FieldStruct("flags", func(d *decode.D) {
+		d.FieldBool("underscan")
+		d.FieldBool("basic_audio")
+		d.FieldBool("ycbcr444")
+		d.FieldBool("ycbcr422")
+		d.FieldU4("native_dtds")
+	})
+
+	if dtdOffset != 0 {
+		d.FieldArray("data_blocks", func(d *decode.D) {
+			d.LenFn(int64(dtdOffset-4)*8, func(d *decode.D) {
+				for d.NotEnd() {
+					d.FieldStruct("data_block", decodeDataBlock)
+				}
+			})
+		})
+		d.FieldArray("detailed_timings", func(d *decode.D) {
+			// zero pixel clock ends list
+			for d.Pos()+descriptorLen*8 <= end && d.PeekBits(16) != 0 {
+				d.FieldStruct("detailed_timing", decodeDetailedTiming)
+			}
+		})
+	}
+
+	if d.Pos() < end {
+		d.FieldRawLen("padding", end-d.Pos())
+	}
+}
+
+func decodeExtension(d *decode.D) {
+	start := d.Pos()
+
+	tag := d.FieldU8("tag", extensionTagNames, scalar.Hex)
+	switch tag {
+	case extensionCTA861:
+		decodeCTA861(d, start)
+	default:
+		d.FieldRawLen("data", (blockLen-2)*8)
+	}
+
+	fieldChecksum(d, start)
+}
@@ -0,0 +1,401 @@
+package edid
+
+// https://en.wikipedia.org/wiki/Extended_Display_Identification_data
+// VESA Enhanced EDID Standard release A, revision 2
+// CTA-861-G
+
+import (
+	"fmt"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.EDID,
+		Description: "Extended Display Identification Data",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: headerMagic}},
+		DecodeFn:    edidDecode,
+	})
+}
+
+const (
+	blockLen      = 128
+	descriptorLen = 18
+)
+
+var headerMagic = []byte{0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00}
+
+var digitalInterfaceNames = scalar.UToSymStr{
+	0: "undefined",
+	1: "dvi",
+	2: "hdmi_a",
+	3: "hdmi_b",
+	4: "mddi",
+	5: "displayport",
+}
+
+var digitalBitDepthNames = scalar.UToSymStr{
+	0: "undefined",
+	1: "6",
+	2: "8",
+	3: "10",
+	4: "12",
+	5: "14",
+	6: "16",
+	7: "reserved",
+}
+
+var analogLevelNames = scalar.UToSymStr{
+	0: "+0.7/-0.3 V",
+	1: "+0.714/-0.286 V",
+	2: "+1.0/-0.4 V",
+	3: "+0.7/0 V",
+}
+
+var aspectRatioNames = scalar.UToSymStr{
+	0: "16:10",
+	1: "4:3",
+	2: "5:4",
+	3: "16:9",
+}
+
+var establishedTimingNames = []string{
+	"720x400_70hz",
+	"720x400_88hz",
+	"640x480_60hz",
+	"640x480_67hz",
+	"640x480_72hz",
+	"640x480_75hz",
+	"800x600_56hz",
+	"800x600_60hz",
+	"800x600_72hz",
+	"800x600_75hz",
+	"832x624_75hz",
+	"1024x768_87hz_interlaced",
+	"1024x768_60hz",
+	"1024x768_70hz",
+	"1024x768_75hz",
+	"1280x1024_75hz",
+	"1152x870_75hz",
+}
+
+var chromaticityNames = []string{
+	"red_x",
+	"red_y",
+	"green_x",
+	"green_y",
+	"blue_x",
+	"blue_y",
+	"white_x",
+	"white_y",
+}
+
+const (
+	descriptorSerial       = 0xff
+	descriptorText         = 0xfe
+	descriptorRangeLimits  = 0xfd
+	descriptorName         = 0xfc
+	descriptorColorPoint   = 0xfb
+	descriptorStdTimings   = 0xfa
+	descriptorDCM          = 0xf9
+	descriptorCVT          = 0xf8
+	descriptorEstTimings3  = 0xf7
+	descriptorDummy        = 0x10
+	descriptorManufacturer = 0x0f
+)
+
+var descriptorTagNames = scalar.URangeToScalar{
+	{0x00, descriptorManufacturer}:                 {Sym: "manufacturer_specified"},
+	{descriptorDummy, descriptorDummy}:             {Sym: "dummy"},
+	{descriptorEstTimings3, descriptorEstTimings3}: {Sym: "established_timings_3"},
+	{descriptorCVT, descriptorCVT}:                 {Sym: "cvt_timing_codes"},
+	{descriptorDCM, descriptorDCM}:                 {Sym: "color_management_data"},
+	{descriptorStdTimings, descriptorStdTimings}:   {Sym: "standard_timings"},
+	{descriptorColorPoint, descriptorColorPoint}:   {Sym: "color_point"},
+	{descriptorName, descriptorName}:               {Sym: "display_name"},
+	{descriptorRangeLimits, descriptorRangeLimits}: {Sym: "range_limits"},
+	{descriptorText, descriptorText}:               {Sym: "text"},
+	{descriptorSerial, descriptorSerial}:           {Sym: "serial_number"},
+}
+
+// stereo bits 6-5 and 0 of features
+var stereoNames = scalar.UToSymStr{
+	0b000: "none",
+	0b001: "none",
+	0b010: "field_sequential_right",
+	0b100: "field_sequential_left",
+	0b011: "interleaved_2way_right",
+	0b101: "interleaved_2way_left",
+	0b110: "interleaved_4way",
+	0b111: "side_by_side",
+}
+
+const (
+	syncAnalogComposite        = 0
+	syncBipolarAnalogComposite = 1
+	syncDigitalComposite       = 2
+	syncDigitalSeparate        = 3
+)
+
+var syncTypeNames = scalar.UToSymStr{
+	syncAnalogComposite:        "analog_composite",
+	syncBipolarAnalogComposite: "bipolar_analog_composite",
+	syncDigitalComposite:       "digital_composite",
+	syncDigitalSeparate:        "digital_separate",
+}
+
+// text is terminated by newline and padded with spaces
+var textTrim = scalar.Trim("\n ")
+
+var gammaMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	if s.ActualU() == 0xff {
+		s.Description = "defined in extension"
+		return s, nil
+	}
+	s.Sym = float64(s.ActualU()+100) / 100
+	return s, nil
+})
+
+// three 5 bit letters where 1 is A
+func manufacturerID(d *decode.D) string {
+	d.FieldU1("reserved")
+	var id []byte
+	for i := 0; i < 3; i++ {
+		id = append(id, byte('A'-1+d.U5()))
+	}
+	return string(id)
+}
+
+// value split into low bits and high bits stored elsewhere
+func fieldSplitValue(d *decode.D, name string, low uint64, lowBits int, high uint64, sms ...scalar.Mapper) {
+	d.FieldValueU(name, high<<lowBits|low, sms...)
+}
+
+func decodeDetailedTiming(d *decode.D) {
+	d.FieldU16LE("pixel_clock", scalar.Fn(func(s scalar.S) (scalar.S, error) {
+		s.Description = fmt.Sprintf("%.2f MHz", float64(s.ActualU())/100)
+		return s, nil
+	}))
+	hActiveLow := d.FieldU8("horizontal_active_low")
+	hBlankLow := d.FieldU8("horizontal_blanking_low")
+	hActiveHigh := d.FieldU4("horizontal_active_high")
+	hBlankHigh := d.FieldU4("horizontal_blanking_high")
+	vActiveLow := d.FieldU8("vertical_active_low")
+	vBlankLow := d.FieldU8("vertical_blanking_low")
+	vActiveHigh := d.FieldU4("vertical_active_high")
+	vBlankHigh := d.FieldU4("vertical_blanking_high")
+	hSyncOffsetLow := d.FieldU8("horizontal_sync_offset_low")
+	hSyncWidthLow := d.FieldU8("horizontal_sync_width_low")
+	vSyncOffsetLow := d.FieldU4("vertical_sync_offset_low")
+	vSyncWidthLow := d.FieldU4("vertical_sync_width_low")
+	hSyncOffsetHigh := d.FieldU2("horizontal_sync_offset_high")
+	hSyncWidthHigh := d.FieldU2("horizontal_sync_width_high")
+	vSyncOffsetHigh := d.FieldU2("vertical_sync_offset_high")
+	vSyncWidthHigh := d.FieldU2("vertical_sync_width_high")
+	hSizeLow := d.FieldU8("horizontal_image_size_low")
+	vSizeLow := d.FieldU8("vertical_image_size_low")
+	hSizeHigh := d.FieldU4("horizontal_image_size_high")
+	vSizeHigh := d.FieldU4("vertical_image_size_high")
+	d.FieldU8("horizontal_border")
+	d.FieldU8("vertical_border")
+	d.FieldStruct("features", func(d *decode.D) {
+		d.FieldBool("interlaced")
+		stereoHigh := d.FieldU2("stereo_high")
+		syncType := d.FieldU2("sync_type", syncTypeNames)
+		switch syncType {
+		case syncDigitalSeparate:
+			d.FieldBool("vertical_sync_positive")
+			d.FieldBool("horizontal_sync_positive")
+		case syncDigitalComposite:
+			d.FieldBool("serration")
+			d.FieldBool("horizontal_sync_positive")
+		default:
+			d.FieldBool("serration")
+			d.FieldBool("sync_on_rgb")
+		}
+		stereoLow := d.FieldU1("stereo_low")
+		d.FieldValueU("stereo", stereoHigh<<1|stereoLow, stereoNames)
+	})
+
+	fieldSplitValue(d, "horizontal_active", hActiveLow, 8, hActiveHigh)
+	fieldSplitValue(d, "horizontal_blanking", hBlankLow, 8, hBlankHigh)
+	fieldSplitValue(d, "vertical_active", vActiveLow, 8, vActiveHigh)
+	fieldSplitValue(d, "vertical_blanking", vBlankLow, 8, vBlankHigh)
+	fieldSplitValue(d, "horizontal_sync_offset", hSyncOffsetLow, 8, hSyncOffsetHigh)
+	fieldSplitValue(d, "horizontal_sync_width", hSyncWidthLow, 8, hSyncWidthHigh)
+	fieldSplitValue(d, "vertical_sync_offset", vSyncOffsetLow, 4, vSyncOffsetHigh)
+	fieldSplitValue(d, "vertical_sync_width", vSyncWidthLow, 4, vSyncWidthHigh)
+	fieldSplitValue(d, "horizontal_image_size", hSizeLow, 8, hSizeHigh, scalar.Description("mm"))
+	fieldSplitValue(d, "vertical_image_size", vSizeLow, 8, vSizeHigh, scalar.Description("mm"))
+}
+
+func fieldStructNArray(d *decode.D, name string, structName string, n int, fn func(d *decode.D)) {
+	d.FieldArray(name, func(d *decode.D) {
+		for i := 0; i < n; i++ {
+			d.FieldStruct(structName, fn)
+		}
+	})
+}
+
+func decodeStandardTiming(d *decode.D) {
+	// 0x0101 is unused
+	if d.PeekBits(16) == 0x0101 {
+		d.FieldU16("unused", scalar.Hex)
+		return
+	}
+	d.FieldU8("horizontal_active", scalar.Fn(func(s scalar.S) (scalar.S, error) {
+		s.Actual = (s.ActualU() + 31) * 8
+		return s, nil
+	}))
+	d.FieldU2("aspect_ratio", aspectRatioNames)
+	d.FieldU6("refresh_rate", scalar.UAdd(60))
+}
+
+func decodeDisplayDescriptor(d *decode.D) {
+	d.FieldU16("zero", d.AssertU(0))
+	d.FieldU8("reserved0")
+	tag := d.FieldU8("tag", descriptorTagNames, scalar.Hex)
+	switch tag {
+	case descriptorSerial, descriptorText, descriptorName:
+		d.FieldU8("reserved1")
+		d.FieldUTF8("text", 13, textTrim)
+	case descriptorRangeLimits:
+		d.FieldStruct("offsets", func(d *decode.D) {
+			d.FieldU4("reserved")
+			d.FieldU2("horizontal")
+			d.FieldU2("vertical")
+		})
+		d.FieldU8("vertical_min", scalar.Description("Hz"))
+		d.FieldU8("vertical_max", scalar.Description("Hz"))
+		d.FieldU8("horizontal_min", scalar.Description("kHz"))
+		d.FieldU8("horizontal_max", scalar.Description("kHz"))
+		d.FieldU8("pixel_clock_max", scalar.Fn(func(s scalar.S) (scalar.S, error) {
+			s.Actual = s.ActualU() * 10
+			s.Description = "MHz"
+			return s, nil
+		}))
+		d.FieldU8("timing_support", scalar.UToSymStr{
+			0x00: "default_gtf",
+			0x01: "range_limits_only",
+			0x02: "secondary_gtf",
+			0x04: "cvt",
+		})
+		d.FieldRawLen("timing_data", 7*8)
+	case descriptorStdTimings:
+		d.FieldU8("reserved1")
+		fieldStructNArray(d, "standard_timings", "standard_timing", 6, decodeStandardTiming)
+		d.FieldU8("reserved2")
+	default:
+		d.FieldU8("reserved1")
+		d.FieldRawLen("data", 13*8)
+	}
+}
+
+func decodeDescriptor(d *decode.D) {
+	if d.PeekBits(16) != 0 {
+		d.FieldValueStr("type", "detailed_timing")
+		decodeDetailedTiming(d)
+		return
+	}
+	d.FieldValueStr("type", "display_descriptor")
+	decodeDisplayDescriptor(d)
+}
+
+// checksum makes sum of all bytes in the block zero
+func fieldChecksum(d *decode.D, start int64) {
+	b := d.BytesRange(start, blockLen-1)
+	var sum byte
+	for _, c := range b {
+		sum += c
+	}
+	d.FieldChecksumU("checksum", 8, "sum8", uint64(-sum), scalar.Hex)
+}
+
+func decodeBaseBlock(d *decode.D) uint64 {
+	start := d.Pos()
+
+	d.FieldRawLen("header", int64(len(headerMagic))*8, d.AssertBitBuf(headerMagic))
+	d.FieldStrFn("manufacturer_id", manufacturerID)
+	d.FieldU16LE("product_code", scalar.Hex)
+	d.FieldU32LE("serial_number")
+	week := d.FieldU8("week")
+	d.FieldU8("year", scalar.UAdd(1990), scalar.Fn(func(s scalar.S) (scalar.S, error) {
+		if week == 0xff {
+			s.Description = "model year"
+		}
+		return s, nil
+	}))
+	d.FieldU8("version")
+	d.FieldU8("revision")
+
+	d.FieldStruct("basic_display_parameters", func(d *decode.D) {
+		digital := d.FieldBool("digital")
+		if digital {
+			d.FieldU3("bit_depth", digitalBitDepthNames)
+			d.FieldU4("interface", digitalInterfaceNames)
+		} else {
+			d.FieldU2("video_white_sync_levels", analogLevelNames)
+			d.FieldBool("blank_to_black_setup")
+			d.FieldBool("separate_sync")
+			d.FieldBool("composite_sync")
+			d.FieldBool("sync_on_green")
+			d.FieldBool("vsync_serrated")
+		}
+		d.FieldU8("horizontal_size", scalar.Description("cm"))
+		d.FieldU8("vertical_size", scalar.Description("cm"))
+		d.FieldU8("gamma", gammaMap)
+		d.FieldStruct("features", func(d *decode.D) {
+			d.FieldBool("dpms_standby")
+			d.FieldBool("dpms_suspend")
+			d.FieldBool("dpms_active_off")
+			d.FieldU2("display_type")
+			d.FieldBool("srgb")
+			d.FieldBool("preferred_timing_mode")
+			d.FieldBool("continuous_timings")
+		})
+	})
+
+	d.FieldStruct("chromaticity", func(d *decode.D) {
+		// low 2 bits of all coordinates first and then high 8 bits
+		lows := make([]uint64, len(chromaticityNames))
+		for i, n := range chromaticityNames {
+			lows[i] = d.FieldU2(n + "_low")
+		}
+		for i, n := range chromaticityNames {
+			high := d.FieldU8(n + "_high")
+			d.FieldValueFloat(n, float64(high<<2|lows[i])/1024)
+		}
+	})
+
+	d.FieldStruct("established_timings", func(d *decode.D) {
+		for _, n := range establishedTimingNames {
+			d.FieldBool(n)
+		}
+		d.FieldU7("manufacturer")
+	})
+
+	fieldStructNArray(d, "standard_timings", "standard_timing", 8, decodeStandardTiming)
+	fieldStructNArray(d, "descriptors", "descriptor", 4, decodeDescriptor)
+
+	extensionCount := d.FieldU8("extension_count")
+	fieldChecksum(d, start)
+
+	return extensionCount
+}
+
+func edidDecode(d *decode.D, in interface{}) interface{} {
+	extensionCount := decodeBaseBlock(d)
+
+	d.FieldArray("extensions", func(d *decode.D) {
+		for i := uint64(0); i < extensionCount && d.NotEnd(); i++ {
+			d.FieldStruct("extension", decodeExtension)
+		}
+	})
+
+	return nil
+}
@@ -20,6 +20,7 @@ func init() {
 		Name:        format.ELF,
 		Description: "Executable and Linkable Format",
 		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte("\x7fELF")}},
 		DecodeFn:    elfDecode,
 	})
 }
@@ -168,7 +169,7 @@ func elfDecode(d *decode.D, in interface{}) interface{} {
 
 	// TODO: hex functions?
 
-	d.FieldU16("type", scalar.UToSymStr{
+	elfType := d.FieldU16("type", scalar.UToSymStr{
 		0x00:   "None",
 		0x01:   "Rel",
 		0x02:   "Exec",
@@ -180,7 +181,7 @@ func elfDecode(d *decode.D, in interface{}) interface{} {
 		0xffff: "Hiproc",
 	}, scalar.Hex)
 
-	d.FieldU16("machine", scalar.UToSymStr{
+	machine := d.FieldU16("machine", scalar.UToSymStr{
 		0x00:  "No specific instruction set",
 		0x01:  "AT&T WE 32100",
 		0x02:  "SPARC",
@@ -277,7 +278,7 @@ func elfDecode(d *decode.D, in interface{}) interface{} {
 				0x00000001: "PT_LOAD",
 				0x00000002: "PT_DYNAMIC",
 				0x00000003: "PT_INTERP",
-				0x00000004: "PT_NOTE",
+				PT_NOTE:    "PT_NOTE",
 				0x00000005: "PT_SHLIB",
 				0x00000006: "PT_PHDR",
 				0x00000007: "PT_TLS",
@@ -305,12 +306,13 @@ func elfDecode(d *decode.D, in interface{}) interface{} {
 			}
 
 			d.FieldStruct("program_header", func(d *decode.D) {
+				var typ uint64
 				var offset uint64
 				var size uint64
 
 				switch archBits {
 				case 32:
-					d.FieldUFn("p_type", func(d *decode.D) uint64 { return d.U32() & 0xf }, pTypeNames)
+					typ = d.FieldUFn("p_type", func(d *decode.D) uint64 { return d.U32() & 0xf }, pTypeNames)
 					offset = d.FieldU("p_offset", archBits)
 					d.FieldU("p_vaddr", archBits)
 					d.FieldU("p_paddr", archBits)
@@ -319,7 +321,7 @@ func elfDecode(d *decode.D, in interface{}) interface{} {
 					pFlags(d)
 					d.FieldU32("p_align")
 				case 64:
-					d.FieldUFn("p_type", func(d *decode.D) uint64 { return d.U32() & 0xf }, pTypeNames)
+					typ = d.FieldUFn("p_type", func(d *decode.D) uint64 { return d.U32() & 0xf }, pTypeNames)
 					pFlags(d)
 					offset = d.FieldU("p_offset", archBits)
 					d.FieldU("p_vaddr", archBits)
@@ -330,6 +332,10 @@ func elfDecode(d *decode.D, in interface{}) interface{} {
 				}
 
 				d.RangeFn(int64(offset*8), int64(size*8), func(d *decode.D) {
+					if elfType == ET_CORE && typ == PT_NOTE {
+						decodeNotes(d, archBits, machine)
+						return
+					}
 					d.FieldRawLen("data", d.BitsLeft())
 				})
 			})
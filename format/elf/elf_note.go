@@ -0,0 +1,284 @@
+package elf
+
+// https://github.com/torvalds/linux/blob/master/include/uapi/linux/elfcore.h
+// https://github.com/torvalds/linux/blob/master/include/uapi/linux/auxvec.h
+// https://github.com/torvalds/linux/blob/master/fs/binfmt_elf.c
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//nolint:revive
+const (
+	ET_CORE = 0x04
+)
+
+//nolint:revive
+const (
+	PT_NOTE = 0x04
+)
+
+//nolint:revive
+const (
+	EM_386     = 0x03
+	EM_X86_64  = 0x3e
+	EM_AARCH64 = 0xb7
+)
+
+//nolint:revive
+const (
+	NT_PRSTATUS   = 1
+	NT_PRFPREG    = 2
+	NT_PRPSINFO   = 3
+	NT_TASKSTRUCT = 4
+	NT_AUXV       = 6
+	NT_X86_XSTATE = 0x202
+	NT_SIGINFO    = 0x53494749
+	NT_FILE       = 0x46494c45
+)
+
+var coreNoteTypeNames = scalar.UToSymStr{
+	NT_PRSTATUS:   "NT_PRSTATUS",
+	NT_PRFPREG:    "NT_PRFPREG",
+	NT_PRPSINFO:   "NT_PRPSINFO",
+	NT_TASKSTRUCT: "NT_TASKSTRUCT",
+	NT_AUXV:       "NT_AUXV",
+	NT_X86_XSTATE: "NT_X86_XSTATE",
+	NT_SIGINFO:    "NT_SIGINFO",
+	NT_FILE:       "NT_FILE",
+}
+
+//nolint:revive
+const (
+	AT_NULL = 0
+)
+
+var auxvTypeNames = scalar.UToSymStr{
+	AT_NULL: "AT_NULL",
+	1:       "AT_IGNORE",
+	2:       "AT_EXECFD",
+	3:       "AT_PHDR",
+	4:       "AT_PHENT",
+	5:       "AT_PHNUM",
+	6:       "AT_PAGESZ",
+	7:       "AT_BASE",
+	8:       "AT_FLAGS",
+	9:       "AT_ENTRY",
+	10:      "AT_NOTELF",
+	11:      "AT_UID",
+	12:      "AT_EUID",
+	13:      "AT_GID",
+	14:      "AT_EGID",
+	15:      "AT_PLATFORM",
+	16:      "AT_HWCAP",
+	17:      "AT_CLKTCK",
+	23:      "AT_SECURE",
+	24:      "AT_BASE_PLATFORM",
+	25:      "AT_RANDOM",
+	26:      "AT_HWCAP2",
+	31:      "AT_EXECFN",
+	32:      "AT_SYSINFO",
+	33:      "AT_SYSINFO_EHDR",
+	51:      "AT_MINSIGSTKSZ",
+}
+
+// elf_gregset_t as struct user_regs_struct per machine
+var prRegNames = map[uint64][]string{
+	EM_386: {
+		"ebx", "ecx", "edx", "esi", "edi", "ebp", "eax", "ds", "es", "fs", "gs",
+		"orig_eax", "eip", "cs", "eflags", "esp", "ss",
+	},
+	EM_X86_64: {
+		"r15", "r14", "r13", "r12", "rbp", "rbx", "r11", "r10", "r9", "r8", "rax",
+		"rcx", "rdx", "rsi", "rdi", "orig_rax", "rip", "cs", "eflags", "rsp", "ss",
+		"fs_base", "gs_base", "ds", "es", "fs", "gs",
+	},
+	EM_AARCH64: func() []string {
+		var ns []string
+		for i := 0; i < 31; i++ {
+			ns = append(ns, fmt.Sprintf("x%d", i))
+		}
+		return append(ns, "sp", "pc", "pstate")
+	}(),
+}
+
+var prStateNames = scalar.StrToScalar{
+	"R": {Description: "Running"},
+	"S": {Description: "Sleeping"},
+	"D": {Description: "Disk sleep"},
+	"T": {Description: "Stopped"},
+	"t": {Description: "Tracing stop"},
+	"Z": {Description: "Zombie"},
+	"X": {Description: "Dead"},
+}
+
+func fieldTimeval(d *decode.D, name string, archBits int) {
+	d.FieldStruct(name, func(d *decode.D) {
+		d.FieldS("tv_sec", archBits)
+		d.FieldS("tv_usec", archBits)
+	})
+}
+
+// struct elf_prstatus
+func decodeNotePrStatus(d *decode.D, archBits int, machine uint64) {
+	d.FieldStruct("pr_info", func(d *decode.D) {
+		d.FieldS32("si_signo")
+		d.FieldS32("si_code")
+		d.FieldS32("si_errno")
+	})
+	d.FieldU16("pr_cursig")
+	d.FieldRawLen("padding0", 16)
+	d.FieldU("pr_sigpend", archBits, scalar.Hex)
+	d.FieldU("pr_sighold", archBits, scalar.Hex)
+	d.FieldU32("pr_pid")
+	d.FieldU32("pr_ppid")
+	d.FieldU32("pr_pgrp")
+	d.FieldU32("pr_sid")
+	fieldTimeval(d, "pr_utime", archBits)
+	fieldTimeval(d, "pr_stime", archBits)
+	fieldTimeval(d, "pr_cutime", archBits)
+	fieldTimeval(d, "pr_cstime", archBits)
+
+	// pr_reg size depends on machine, pr_fpvalid is an int padded to long alignment
+	regsBits := d.BitsLeft() - int64(archBits)
+	if regsBits < 0 {
+		d.FieldRawLen("unknown0", d.BitsLeft())
+		return
+	}
+	regNames := prRegNames[machine]
+	if int64(len(regNames)*archBits) == regsBits {
+		d.FieldStruct("pr_reg", func(d *decode.D) {
+			for _, n := range regNames {
+				d.FieldU(n, archBits, scalar.Hex)
+			}
+		})
+	} else {
+		d.FieldRawLen("pr_reg", regsBits)
+	}
+	d.FieldU32("pr_fpvalid")
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("padding1", d.BitsLeft())
+	}
+}
+
+// struct elf_prpsinfo
+func decodeNotePrPsInfo(d *decode.D, archBits int) {
+	d.FieldS8("pr_state")
+	d.FieldUTF8("pr_sname", 1, prStateNames)
+	d.FieldU8("pr_zomb")
+	d.FieldS8("pr_nice")
+	// TODO: uid/gid width is per arch, this is what x86 and arm uses
+	uidBits := 16
+	if archBits == 64 {
+		d.FieldRawLen("padding0", 32)
+		uidBits = 32
+	}
+	d.FieldU("pr_flag", archBits, scalar.Hex)
+	d.FieldU("pr_uid", uidBits)
+	d.FieldU("pr_gid", uidBits)
+	d.FieldU32("pr_pid")
+	d.FieldU32("pr_ppid")
+	d.FieldU32("pr_pgrp")
+	d.FieldU32("pr_sid")
+	d.FieldUTF8NullFixedLen("pr_fname", 16)
+	d.FieldUTF8NullFixedLen("pr_psargs", 80)
+}
+
+// see fill_files_note in binfmt_elf.c
+func decodeNoteFile(d *decode.D, archBits int) {
+	count := d.FieldU("count", archBits)
+	pageSize := d.FieldU("page_size", archBits)
+	namesPos := d.Pos() + int64(count)*3*int64(archBits)
+	d.FieldArray("files", func(d *decode.D) {
+		for i := uint64(0); i < count; i++ {
+			d.FieldStruct("file", func(d *decode.D) {
+				d.FieldU("start", archBits, scalar.Hex)
+				d.FieldU("end", archBits, scalar.Hex)
+				d.FieldU("file_offset", archBits, scalar.Fn(func(s scalar.S) (scalar.S, error) {
+					if v, ok := s.Actual.(uint64); ok {
+						s.Description = fmt.Sprintf("%d bytes", v*pageSize)
+					}
+					return s, nil
+				}))
+
+				pos := d.Pos()
+				d.SeekAbs(namesPos)
+				d.FieldUTF8Null("name")
+				namesPos = d.Pos()
+				d.SeekAbs(pos)
+			})
+		}
+	})
+	d.SeekAbs(namesPos)
+}
+
+func decodeNoteAuxv(d *decode.D, archBits int) {
+	d.FieldArray("auxv", func(d *decode.D) {
+		for d.BitsLeft() >= int64(archBits)*2 {
+			var aType uint64
+			d.FieldStruct("entry", func(d *decode.D) {
+				aType = d.FieldU("a_type", archBits, auxvTypeNames)
+				d.FieldU("a_val", archBits, scalar.Hex)
+			})
+			if aType == AT_NULL {
+				break
+			}
+		}
+	})
+}
+
+func decodeNotes(d *decode.D, archBits int, machine uint64) {
+	d.FieldArray("notes", func(d *decode.D) {
+		for d.BitsLeft() >= 12*8 {
+			d.FieldStruct("note", func(d *decode.D) {
+				nameSize := d.FieldU32("n_namesz")
+				descSize := d.FieldU32("n_descsz")
+				nameBits := int64(nameSize) * 8
+				descBits := int64(descSize) * 8
+
+				// name is after type but decides how to interpret type
+				var typ uint64
+				var name string
+				if nameBits+32 <= d.BitsLeft() {
+					name = strings.TrimRight(string(d.BytesRange(d.Pos()+32, int(nameSize))), "\x00")
+				}
+				switch name {
+				case "CORE", "LINUX":
+					typ = d.FieldU32("n_type", coreNoteTypeNames, scalar.Hex)
+				default:
+					typ = d.FieldU32("n_type", scalar.Hex)
+				}
+				d.FieldUTF8NullFixedLen("name", int(nameSize))
+				if n := d.AlignBits(32); n > 0 {
+					d.FieldRawLen("name_padding", int64(n), d.BitBufIsZero())
+				}
+
+				d.LenFn(descBits, func(d *decode.D) {
+					if name != "CORE" {
+						d.FieldRawLen("desc", d.BitsLeft())
+						return
+					}
+					switch typ {
+					case NT_PRSTATUS:
+						d.FieldStruct("desc", func(d *decode.D) { decodeNotePrStatus(d, archBits, machine) })
+					case NT_PRPSINFO:
+						d.FieldStruct("desc", func(d *decode.D) { decodeNotePrPsInfo(d, archBits) })
+					case NT_FILE:
+						d.FieldStruct("desc", func(d *decode.D) { decodeNoteFile(d, archBits) })
+					case NT_AUXV:
+						d.FieldStruct("desc", func(d *decode.D) { decodeNoteAuxv(d, archBits) })
+					default:
+						d.FieldRawLen("desc", d.BitsLeft())
+					}
+				})
+				if n := d.AlignBits(32); n > 0 && d.BitsLeft() >= int64(n) {
+					d.FieldRawLen("desc_padding", int64(n), d.BitBufIsZero())
+				}
+			})
+		}
+	})
+}
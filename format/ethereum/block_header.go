@@ -0,0 +1,57 @@
+package ethereum
+
+// https://ethereum.github.io/yellowpaper/paper.pdf section 4.3
+// https://eips.ethereum.org/EIPS/eip-1559
+// https://eips.ethereum.org/EIPS/eip-4895
+// https://eips.ethereum.org/EIPS/eip-4844
+// https://eips.ethereum.org/EIPS/eip-4788
+// https://eips.ethereum.org/EIPS/eip-7685
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.ETHEREUM_BLOCK_HEADER,
+		Description: "Ethereum block header",
+		DecodeFn:    blockHeaderDecode,
+	})
+}
+
+var blockHeaderFields = []field{
+	bytesField("parent_hash", scalar.RawHex),
+	bytesField("ommers_hash", scalar.RawHex),
+	bytesField("beneficiary", scalar.RawHex),
+	bytesField("state_root", scalar.RawHex),
+	bytesField("transactions_root", scalar.RawHex),
+	bytesField("receipts_root", scalar.RawHex),
+	bytesField("logs_bloom", scalar.RawHex),
+	uintField("difficulty"),
+	uintField("number"),
+	uintField("gas_limit"),
+	uintField("gas_used"),
+	uintField("timestamp", unixTimeMap),
+	bytesField("extra_data"),
+	bytesField("mix_hash", scalar.RawHex),
+	bytesField("nonce", scalar.RawHex),
+	// london
+	optional(uintField("base_fee_per_gas")),
+	// shanghai
+	optional(bytesField("withdrawals_root", scalar.RawHex)),
+	// cancun
+	optional(uintField("blob_gas_used")),
+	optional(uintField("excess_blob_gas")),
+	optional(bytesField("parent_beacon_block_root", scalar.RawHex)),
+	// prague
+	optional(bytesField("requests_hash", scalar.RawHex)),
+}
+
+func blockHeaderDecode(d *decode.D, in interface{}) interface{} {
+	decodeList(d, blockHeaderFields)
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package ethereum
+
+// decoding of RLP lists with known item names and types
+
+import (
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+type kind int
+
+const (
+	kindBytes  kind = iota
+	kindUint        // big endian without leading zeros
+	kindList        // list with named items
+	kindListOf      // list of same kind of items
+)
+
+type field struct {
+	name     string
+	kind     kind
+	fields   []field // kindList
+	elem     *field  // kindListOf
+	optional bool    // can be missing at end of list, added by later forks
+	sms      []scalar.Mapper
+}
+
+func bytesField(name string, sms ...scalar.Mapper) field {
+	return field{name: name, kind: kindBytes, sms: sms}
+}
+
+func uintField(name string, sms ...scalar.Mapper) field {
+	return field{name: name, kind: kindUint, sms: sms}
+}
+
+func listField(name string, fields ...field) field {
+	return field{name: name, kind: kindList, fields: fields}
+}
+
+func listOfField(name string, elem field) field {
+	return field{name: name, kind: kindListOf, elem: &elem}
+}
+
+func optional(f field) field {
+	f.optional = true
+	return f
+}
+
+var accessListField = listOfField("access_list",
+	listField("entry",
+		bytesField("address", scalar.RawHex),
+		listOfField("storage_keys", bytesField("storage_key", scalar.RawHex)),
+	),
+)
+
+// decodeList decodes a list header and its named items into current struct
+func decodeList(d *decode.D, fields []field) {
+	isList, length := fieldHeader(d)
+	if !isList {
+		d.Fatalf("expected list")
+	}
+	d.LenFn(length*8, func(d *decode.D) {
+		for _, f := range fields {
+			if !d.NotEnd() {
+				if f.optional {
+					break
+				}
+				d.Fatalf("%s: missing", f.name)
+			}
+			decodeField(d, f)
+		}
+		if d.NotEnd() {
+			d.FieldArray("extra_items", func(d *decode.D) {
+				for d.NotEnd() {
+					d.FieldStruct("item", decodeItem)
+				}
+			})
+		}
+	})
+}
+
+func decodeField(d *decode.D, f field) {
+	d.FieldStruct(f.name, func(d *decode.D) {
+		switch f.kind {
+		case kindList:
+			decodeList(d, f.fields)
+		case kindListOf:
+			isList, length := fieldHeader(d)
+			if !isList {
+				d.Fatalf("%s: expected list", f.name)
+			}
+			d.FieldArray("items", func(d *decode.D) {
+				d.LenFn(length*8, func(d *decode.D) {
+					for d.NotEnd() {
+						decodeField(d, *f.elem)
+					}
+				})
+			})
+		case kindBytes, kindUint:
+			isList, length := fieldHeader(d)
+			if isList {
+				d.Fatalf("%s: expected string", f.name)
+			}
+			if f.kind == kindUint {
+				fieldUint(d, length, f.sms...)
+				return
+			}
+			if length > 0 {
+				d.FieldRawLen("data", length*8, f.sms...)
+			}
+		}
+	})
+}
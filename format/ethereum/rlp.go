@@ -0,0 +1,113 @@
+package ethereum
+
+// https://ethereum.org/en/developers/docs/data-structures-and-encoding/rlp/
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.RLP,
+		Description: "Recursive Length Prefix",
+		DecodeFn:    rlpDecode,
+	})
+}
+
+const (
+	prefixString     = 0x80
+	prefixLongString = 0xb8
+	prefixList       = 0xc0
+	prefixLongList   = 0xf8
+)
+
+var prefixNames = scalar.URangeToScalar{
+	{0x80, 0xb7}: {Sym: "string"},
+	{0xb8, 0xbf}: {Sym: "long_string"},
+	{0xc0, 0xf7}: {Sym: "list"},
+	{0xf8, 0xff}: {Sym: "long_list"},
+}
+
+var unixTimeMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	uv, ok := s.Actual.(uint64)
+	if !ok || uv == 0 {
+		return s, nil
+	}
+	s.Description = time.Unix(int64(uv), 0).UTC().Format(time.RFC3339)
+	return s, nil
+})
+
+// fieldHeader decodes prefix and length of an item and returns if it's a list
+// and length of its payload in bytes. Bytes below 0x80 are their own payload
+// so nothing is decoded for them.
+func fieldHeader(d *decode.D) (bool, int64) {
+	if d.PeekBits(8) < prefixString {
+		return false, 1
+	}
+
+	prefix := d.FieldU8("prefix", prefixNames, scalar.Hex)
+	var isList bool
+	var length uint64
+	switch {
+	case prefix < prefixLongString:
+		length = prefix - prefixString
+	case prefix < prefixList:
+		length = d.FieldU("length", int(prefix-prefixLongString+1)*8)
+	case prefix < prefixLongList:
+		isList = true
+		length = prefix - prefixList
+	default:
+		isList = true
+		length = d.FieldU("length", int(prefix-prefixLongList+1)*8)
+	}
+	if length > uint64(d.BitsLeft()/8) {
+		d.Fatalf("length %d outside of input", length)
+	}
+
+	return isList, int64(length)
+}
+
+// fieldUint decodes a big endian integer without leading zeros, integers wider
+// than 64 bits are decimal strings
+func fieldUint(d *decode.D, length int64, sms ...scalar.Mapper) {
+	if length == 0 {
+		d.FieldValueU("value", 0, sms...)
+		return
+	}
+	b := d.BytesRange(d.Pos(), int(length))
+	d.FieldRawLen("data", length*8, scalar.RawHex)
+	if length <= 8 {
+		d.FieldValueU("value", new(big.Int).SetBytes(b).Uint64(), sms...)
+		return
+	}
+	d.FieldValueStr("value", new(big.Int).SetBytes(b).String())
+}
+
+func decodeItem(d *decode.D) {
+	isList, length := fieldHeader(d)
+	if !isList {
+		if length > 0 {
+			d.FieldRawLen("data", length*8)
+		}
+		return
+	}
+	d.FieldArray("items", func(d *decode.D) {
+		d.LenFn(length*8, func(d *decode.D) {
+			for d.NotEnd() {
+				d.FieldStruct("item", decodeItem)
+			}
+		})
+	})
+}
+
+func rlpDecode(d *decode.D, in interface{}) interface{} {
+	decodeItem(d)
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package ethereum
+
+// https://eips.ethereum.org/EIPS/eip-2718
+// https://eips.ethereum.org/EIPS/eip-155
+// https://eips.ethereum.org/EIPS/eip-2930
+// https://eips.ethereum.org/EIPS/eip-1559
+// https://eips.ethereum.org/EIPS/eip-4844
+// https://eips.ethereum.org/EIPS/eip-7702
+
+import (
+	"fmt"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.ETHEREUM_TRANSACTION,
+		Description: "Ethereum transaction",
+		DecodeFn:    transactionDecode,
+	})
+}
+
+const (
+	txTypeAccessList = 0x01
+	txTypeDynamicFee = 0x02
+	txTypeBlob       = 0x03
+	txTypeSetCode    = 0x04
+)
+
+var txTypeNames = scalar.UToSymStr{
+	txTypeAccessList: "access_list",
+	txTypeDynamicFee: "dynamic_fee",
+	txTypeBlob:       "blob",
+	txTypeSetCode:    "set_code",
+}
+
+// v is chain_id*2+35+y_parity since EIP-155 otherwise 27+y_parity
+var legacyVMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	uv, ok := s.Actual.(uint64)
+	if !ok {
+		return s, nil
+	}
+	switch {
+	case uv >= 35:
+		s.Description = fmt.Sprintf("chain id %d", (uv-35)/2)
+	case uv == 27 || uv == 28:
+		s.Description = "no chain id"
+	}
+	return s, nil
+})
+
+var legacyFields = []field{
+	uintField("nonce"),
+	uintField("gas_price"),
+	uintField("gas_limit"),
+	bytesField("to", scalar.RawHex),
+	uintField("value"),
+	bytesField("data", scalar.RawHex),
+	uintField("v", legacyVMap),
+	bytesField("r", scalar.RawHex),
+	bytesField("s", scalar.RawHex),
+}
+
+var txTypeFields = map[uint64][]field{
+	txTypeAccessList: {
+		uintField("chain_id"),
+		uintField("nonce"),
+		uintField("gas_price"),
+		uintField("gas_limit"),
+		bytesField("to", scalar.RawHex),
+		uintField("value"),
+		bytesField("data", scalar.RawHex),
+		accessListField,
+		uintField("y_parity"),
+		bytesField("r", scalar.RawHex),
+		bytesField("s", scalar.RawHex),
+	},
+	txTypeDynamicFee: {
+		uintField("chain_id"),
+		uintField("nonce"),
+		uintField("max_priority_fee_per_gas"),
+		uintField("max_fee_per_gas"),
+		uintField("gas_limit"),
+		bytesField("to", scalar.RawHex),
+		uintField("value"),
+		bytesField("data", scalar.RawHex),
+		accessListField,
+		uintField("y_parity"),
+		bytesField("r", scalar.RawHex),
+		bytesField("s", scalar.RawHex),
+	},
+	txTypeBlob: {
+		uintField("chain_id"),
+		uintField("nonce"),
+		uintField("max_priority_fee_per_gas"),
+		uintField("max_fee_per_gas"),
+		uintField("gas_limit"),
+		bytesField("to", scalar.RawHex),
+		uintField("value"),
+		bytesField("data", scalar.RawHex),
+		accessListField,
+		uintField("max_fee_per_blob_gas"),
+		listOfField("blob_versioned_hashes", bytesField("blob_versioned_hash", scalar.RawHex)),
+		uintField("y_parity"),
+		bytesField("r", scalar.RawHex),
+		bytesField("s", scalar.RawHex),
+	},
+	txTypeSetCode: {
+		uintField("chain_id"),
+		uintField("nonce"),
+		uintField("max_priority_fee_per_gas"),
+		uintField("max_fee_per_gas"),
+		uintField("gas_limit"),
+		bytesField("to", scalar.RawHex),
+		uintField("value"),
+		bytesField("data", scalar.RawHex),
+		accessListField,
+		listOfField("authorization_list",
+			listField("authorization",
+				uintField("chain_id"),
+				bytesField("address", scalar.RawHex),
+				uintField("nonce"),
+				uintField("y_parity"),
+				bytesField("r", scalar.RawHex),
+				bytesField("s", scalar.RawHex),
+			),
+		),
+		uintField("y_parity"),
+		bytesField("r", scalar.RawHex),
+		bytesField("s", scalar.RawHex),
+	},
+}
+
+func transactionDecode(d *decode.D, in interface{}) interface{} {
+	// legacy transactions are a plain list, typed ones are a type byte followed by payload
+	if d.PeekBits(8) >= prefixList {
+		d.FieldValueStr("type", "legacy")
+		decodeList(d, legacyFields)
+		return nil
+	}
+
+	txType := d.FieldU8("type", txTypeNames, scalar.Hex)
+	fields, ok := txTypeFields[txType]
+	if !ok {
+		d.Fatalf("unknown transaction type %d", txType)
+	}
+	decodeList(d, fields)
+
+	return nil
+}
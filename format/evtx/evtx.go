@@ -0,0 +1,611 @@
+package evtx
+
+// https://github.com/libyal/libevtx/blob/main/documentation/Windows%20XML%20Event%20Log%20(EVTX).asciidoc
+// https://github.com/williballenthin/python-evtx
+// https://learn.microsoft.com/en-us/windows/win32/api/winevt/ne-winevt-evt_variant_type
+
+// TODO: resolve common string offsets table
+// TODO: evt_handle and evt_xml substitution values
+
+import (
+	"embed"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed *.jq
+var evtxFS embed.FS
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.EVTX,
+		Description: "Windows XML Event Log",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte(fileMagic)}},
+		DecodeFn:    evtxDecode,
+		Files:       evtxFS,
+	})
+}
+
+const (
+	fileMagic   = "ElfFile\x00"
+	chunkMagic  = "ElfChnk\x00"
+	recordMagic = "**\x00\x00"
+)
+
+const latestMajorVersion = 3
+
+const (
+	fileHeaderSize  = 128
+	chunkSize       = 0x10000
+	chunkHeaderSize = 512
+	// signature, size, identifier and written time before event and size copy after
+	recordHeaderSize = 24
+	recordMinSize    = recordHeaderSize + 4
+	// header checksum covers header except flags and checksum
+	checksumCoverSize = 120
+)
+
+const (
+	tokenEndOfStream          = 0x00
+	tokenOpenStartElement     = 0x01
+	tokenCloseStartElement    = 0x02
+	tokenCloseEmptyElement    = 0x03
+	tokenEndElement           = 0x04
+	tokenValue                = 0x05
+	tokenAttribute            = 0x06
+	tokenCDATASection         = 0x07
+	tokenCharRef              = 0x08
+	tokenEntityRef            = 0x09
+	tokenPITarget             = 0x0a
+	tokenPIData               = 0x0b
+	tokenTemplateInstance     = 0x0c
+	tokenNormalSubstitution   = 0x0d
+	tokenOptionalSubstitution = 0x0e
+	tokenFragmentHeader       = 0x0f
+)
+
+// 0x40 flag means element has attributes, attribute is followed by more attributes
+// or value is followed by more data
+const tokenHasMore = 0x40
+
+var tokenNames = map[uint64]string{
+	tokenEndOfStream:          "end_of_stream",
+	tokenOpenStartElement:     "open_start_element",
+	tokenCloseStartElement:    "close_start_element",
+	tokenCloseEmptyElement:    "close_empty_element",
+	tokenEndElement:           "end_element",
+	tokenValue:                "value",
+	tokenAttribute:            "attribute",
+	tokenCDATASection:         "cdata_section",
+	tokenCharRef:              "char_ref",
+	tokenEntityRef:            "entity_ref",
+	tokenPITarget:             "pi_target",
+	tokenPIData:               "pi_data",
+	tokenTemplateInstance:     "template_instance",
+	tokenNormalSubstitution:   "normal_substitution",
+	tokenOptionalSubstitution: "optional_substitution",
+	tokenFragmentHeader:       "fragment_header",
+}
+
+var tokenMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	uv, ok := s.Actual.(uint64)
+	if !ok {
+		return s, nil
+	}
+	if n, ok := tokenNames[uv&0x0f]; ok {
+		s.Sym = n
+	}
+	return s, nil
+})
+
+const (
+	valueTypeNull       = 0x00
+	valueTypeString     = 0x01
+	valueTypeANSIString = 0x02
+	valueTypeInt8       = 0x03
+	valueTypeUint8      = 0x04
+	valueTypeInt16      = 0x05
+	valueTypeUint16     = 0x06
+	valueTypeInt32      = 0x07
+	valueTypeUint32     = 0x08
+	valueTypeInt64      = 0x09
+	valueTypeUint64     = 0x0a
+	valueTypeFloat32    = 0x0b
+	valueTypeFloat64    = 0x0c
+	valueTypeBool       = 0x0d
+	valueTypeBinary     = 0x0e
+	valueTypeGUID       = 0x0f
+	valueTypeSizeT      = 0x10
+	valueTypeFileTime   = 0x11
+	valueTypeSystemTime = 0x12
+	valueTypeSID        = 0x13
+	valueTypeHexInt32   = 0x14
+	valueTypeHexInt64   = 0x15
+	valueTypeEvtHandle  = 0x20
+	valueTypeBinXML     = 0x21
+	valueTypeEvtXML     = 0x23
+)
+
+// 0x80 flag means array of type
+const valueTypeArray = 0x80
+
+var valueTypeNames = map[uint64]string{
+	valueTypeNull:       "null",
+	valueTypeString:     "string",
+	valueTypeANSIString: "ansi_string",
+	valueTypeInt8:       "int8",
+	valueTypeUint8:      "uint8",
+	valueTypeInt16:      "int16",
+	valueTypeUint16:     "uint16",
+	valueTypeInt32:      "int32",
+	valueTypeUint32:     "uint32",
+	valueTypeInt64:      "int64",
+	valueTypeUint64:     "uint64",
+	valueTypeFloat32:    "float32",
+	valueTypeFloat64:    "float64",
+	valueTypeBool:       "bool",
+	valueTypeBinary:     "binary",
+	valueTypeGUID:       "guid",
+	valueTypeSizeT:      "size_t",
+	valueTypeFileTime:   "filetime",
+	valueTypeSystemTime: "systemtime",
+	valueTypeSID:        "sid",
+	valueTypeHexInt32:   "hex_int32",
+	valueTypeHexInt64:   "hex_int64",
+	valueTypeEvtHandle:  "evt_handle",
+	valueTypeBinXML:     "binxml",
+	valueTypeEvtXML:     "evt_xml",
+}
+
+var valueTypeMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	uv, ok := s.Actual.(uint64)
+	if !ok {
+		return s, nil
+	}
+	if n, ok := valueTypeNames[uv&^valueTypeArray]; ok {
+		if uv&valueTypeArray != 0 {
+			n += "_array"
+		}
+		s.Sym = n
+	}
+	return s, nil
+})
+
+// FILETIME is 100ns intervals since 1601-01-01 00:00:00 UTC
+const fileTimeUnixDelta = 11644473600
+
+var fileTimeMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	uv, ok := s.Actual.(uint64)
+	if !ok || uv == 0 {
+		return s, nil
+	}
+	s.Description = time.Unix(int64(uv/10_000_000)-fileTimeUnixDelta, int64(uv%10_000_000)*100).UTC().Format(time.RFC3339Nano)
+	return s, nil
+})
+
+// GUID with first three groups in little endian
+func fieldGUID(d *decode.D, name string) {
+	b := d.PeekBytes(16)
+	d.FieldRawLen(name, 16*8, scalar.Sym(fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(b[0:4]),
+		binary.LittleEndian.Uint16(b[4:6]),
+		binary.LittleEndian.Uint16(b[6:8]),
+		b[8:10],
+		b[10:16],
+	)))
+}
+
+func decodeSID(d *decode.D) {
+	revision := d.FieldU8("revision")
+	n := d.FieldU8("num_sub_authorities")
+	authority := d.FieldU48BE("identifier_authority")
+	subAuthorities := []string{}
+	d.FieldArray("sub_authorities", func(d *decode.D) {
+		for i := uint64(0); i < n; i++ {
+			subAuthorities = append(subAuthorities, fmt.Sprint(d.FieldU32("sub_authority")))
+		}
+	})
+	d.FieldValueStr("string", fmt.Sprintf("S-%d-%d-%s", revision, authority, strings.Join(subAuthorities, "-")))
+}
+
+func decodeSystemTime(d *decode.D) {
+	year := d.FieldU16("year")
+	month := d.FieldU16("month")
+	d.FieldU16("day_of_week")
+	day := d.FieldU16("day")
+	hour := d.FieldU16("hour")
+	minute := d.FieldU16("minute")
+	second := d.FieldU16("second")
+	ms := d.FieldU16("milliseconds")
+	d.FieldValueStr("string", fmt.Sprintf("%04d-%02d-%02dT%02d:%02d:%02d.%03dZ", year, month, day, hour, minute, second, ms))
+}
+
+// binary XML decoding context, names and template definitions are referenced
+// by offset relative to chunk start
+type binXMLContext struct {
+	chunkStart int64
+	// dependency identifier is not present in binary XML substitution values
+	hasDependencyID bool
+}
+
+func (c binXMLContext) offset(d *decode.D) uint64 {
+	return uint64((d.Pos() - c.chunkStart) / 8)
+}
+
+// name is next offset, hash, character count and null terminated UTF-16 string
+func (c binXMLContext) readName(d *decode.D, offset uint64) (string, bool) {
+	pos := c.chunkStart + int64(offset)*8
+	if pos+8*8 > d.Len() {
+		return "", false
+	}
+	n := int64(binary.LittleEndian.Uint16(d.BytesRange(pos+6*8, 2)))
+	if pos+(8+n*2)*8 > d.Len() {
+		return "", false
+	}
+	b := d.BytesRange(pos+8*8, int(n*2))
+	u := make([]uint16, n)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(u)), true
+}
+
+func (c binXMLContext) fieldName(d *decode.D) {
+	offset := d.FieldU32("name_offset", scalar.Fn(func(s scalar.S) (scalar.S, error) {
+		uv, ok := s.Actual.(uint64)
+		if !ok {
+			return s, nil
+		}
+		if n, ok := c.readName(d, uv); ok {
+			s.Sym = n
+		}
+		return s, nil
+	}))
+	// name is stored inline the first time it is used in a chunk
+	if offset == c.offset(d) {
+		d.FieldStruct("name", func(d *decode.D) {
+			d.FieldU32("next_offset")
+			d.FieldU16("hash", scalar.Hex)
+			n := d.FieldU16("character_count")
+			d.FieldUTF16LE("value", int(n)*2)
+			d.FieldU16("terminator", d.AssertU(0))
+		})
+	}
+}
+
+func peekToken(d *decode.D) uint64 {
+	return d.PeekBits(8) & 0x0f
+}
+
+func fieldUTF16String(d *decode.D) {
+	n := d.FieldU16("character_count")
+	d.FieldUTF16LE("value", int(n)*2)
+}
+
+// value, substitution and reference tokens that make up character data
+func isCharacterDataToken(t uint64) bool {
+	switch t {
+	case tokenValue,
+		tokenCDATASection,
+		tokenCharRef,
+		tokenEntityRef,
+		tokenNormalSubstitution,
+		tokenOptionalSubstitution:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c binXMLContext) decodeElement(d *decode.D, hasAttributes bool) {
+	if c.hasDependencyID {
+		d.FieldU16("dependency_id", scalar.Hex)
+	}
+	d.FieldU32("data_size")
+	c.fieldName(d)
+	if hasAttributes {
+		d.FieldU32("attribute_list_size")
+		d.FieldArray("attributes", func(d *decode.D) {
+			for d.BitsLeft() >= 8 && peekToken(d) == tokenAttribute {
+				d.FieldStruct("attribute", func(d *decode.D) {
+					d.FieldU8("token", tokenMap, scalar.Hex)
+					c.fieldName(d)
+					c.decodeNodes(d, "value", isCharacterDataToken)
+				})
+			}
+		})
+	}
+	closeToken := d.FieldU8("close_token", tokenMap, scalar.Hex)
+	switch closeToken & 0x0f {
+	case tokenCloseStartElement:
+		c.decodeNodes(d, "content", func(t uint64) bool { return t != tokenEndElement && t != tokenEndOfStream })
+		d.FieldU8("end_token", tokenMap, scalar.Hex, d.AssertU(tokenEndElement))
+	case tokenCloseEmptyElement:
+	default:
+		d.Fatalf("unexpected close element token %d", closeToken)
+	}
+}
+
+func (c binXMLContext) decodeTemplateInstance(d *decode.D) {
+	d.FieldU8("unknown0")
+	d.FieldU32("template_id", scalar.Hex)
+	definitionOffset := d.FieldU32("template_definition_offset")
+	// definition is stored inline the first time it is used in a chunk
+	if definitionOffset == c.offset(d) {
+		d.FieldStruct("template_definition", func(d *decode.D) {
+			d.FieldU32("next_offset")
+			fieldGUID(d, "guid")
+			size := d.FieldU32("data_size")
+			d.LenFn(int64(size)*8, c.decodeFragment)
+		})
+	}
+
+	type descriptor struct {
+		size uint64
+		typ  uint64
+	}
+	var descriptors []descriptor
+	n := d.FieldU32("number_of_values")
+	if int64(n)*4*8 > d.BitsLeft() {
+		d.Fatalf("%d value descriptors outside buffer", n)
+	}
+	d.FieldArray("value_descriptors", func(d *decode.D) {
+		for i := uint64(0); i < n; i++ {
+			d.FieldStruct("value_descriptor", func(d *decode.D) {
+				size := d.FieldU16("size")
+				typ := d.FieldU8("type", valueTypeMap, scalar.Hex)
+				d.FieldU8("unknown0")
+				descriptors = append(descriptors, descriptor{size: size, typ: typ})
+			})
+		}
+	})
+	d.FieldArray("values", func(d *decode.D) {
+		for _, vd := range descriptors {
+			d.LenFn(int64(vd.size)*8, func(d *decode.D) { c.decodeSubstitutionValue(d, vd.typ) })
+		}
+	})
+}
+
+// string array elements are null terminated
+func fieldUTF16LENull(d *decode.D, name string) {
+	b := d.PeekBytes(int(d.BitsLeft() / 8))
+	for i := 0; i+1 < len(b); i += 2 {
+		if b[i] == 0 && b[i+1] == 0 {
+			d.FieldUTF16LE(name, i+2, scalar.Trim("\x00"))
+			return
+		}
+	}
+	d.FieldRawLen(name, d.BitsLeft())
+}
+
+func (c binXMLContext) decodeSubstitutionValue(d *decode.D, typ uint64) {
+	if typ&valueTypeArray != 0 {
+		typ &^= valueTypeArray
+		d.FieldArray("value", func(d *decode.D) {
+			for !d.End() {
+				if typ == valueTypeString {
+					fieldUTF16LENull(d, "value")
+				} else {
+					c.decodeSubstitutionValue(d, typ)
+				}
+			}
+		})
+		return
+	}
+
+	switch typ {
+	case valueTypeString:
+		d.FieldUTF16LE("value", int(d.BitsLeft()/8), scalar.Trim("\x00"))
+	case valueTypeANSIString:
+		d.FieldUTF8("value", int(d.BitsLeft()/8), scalar.Trim("\x00"))
+	case valueTypeInt8:
+		d.FieldS8("value")
+	case valueTypeUint8:
+		d.FieldU8("value")
+	case valueTypeInt16:
+		d.FieldS16("value")
+	case valueTypeUint16:
+		d.FieldU16("value")
+	case valueTypeInt32:
+		d.FieldS32("value")
+	case valueTypeUint32:
+		d.FieldU32("value")
+	case valueTypeInt64:
+		d.FieldS64("value")
+	case valueTypeUint64:
+		d.FieldU64("value")
+	case valueTypeFloat32:
+		d.FieldF32("value")
+	case valueTypeFloat64:
+		d.FieldF64("value")
+	case valueTypeBool:
+		d.FieldU32("value", scalar.UToSymStr{0: "false", 1: "true"})
+	case valueTypeGUID:
+		fieldGUID(d, "value")
+	case valueTypeSizeT,
+		valueTypeHexInt32,
+		valueTypeHexInt64:
+		d.FieldU("value", int(d.BitsLeft()), scalar.Hex)
+	case valueTypeFileTime:
+		d.FieldU64("value", fileTimeMap)
+	case valueTypeSystemTime:
+		d.FieldStruct("value", decodeSystemTime)
+	case valueTypeSID:
+		d.FieldStruct("value", decodeSID)
+	case valueTypeBinXML:
+		sub := c
+		sub.hasDependencyID = false
+		d.FieldStruct("value", sub.decodeFragment)
+	default:
+		d.FieldRawLen("value", d.BitsLeft())
+	}
+}
+
+func (c binXMLContext) decodeNode(d *decode.D) {
+	token := d.FieldU8("token", tokenMap, scalar.Hex)
+	switch token & 0x0f {
+	case tokenEndOfStream,
+		tokenCloseStartElement,
+		tokenCloseEmptyElement,
+		tokenEndElement:
+	case tokenOpenStartElement:
+		c.decodeElement(d, token&tokenHasMore != 0)
+	case tokenValue:
+		typ := d.FieldU8("value_type", valueTypeMap, scalar.Hex)
+		if typ != valueTypeString {
+			d.Fatalf("unsupported value type %d", typ)
+		}
+		fieldUTF16String(d)
+	case tokenAttribute:
+		c.fieldName(d)
+	case tokenCDATASection,
+		tokenPIData:
+		fieldUTF16String(d)
+	case tokenCharRef:
+		d.FieldU16("value")
+	case tokenEntityRef,
+		tokenPITarget:
+		c.fieldName(d)
+	case tokenTemplateInstance:
+		c.decodeTemplateInstance(d)
+	case tokenNormalSubstitution,
+		tokenOptionalSubstitution:
+		d.FieldU16("substitution_id")
+		d.FieldU8("value_type", valueTypeMap, scalar.Hex)
+	case tokenFragmentHeader:
+		d.FieldU8("major_version")
+		d.FieldU8("minor_version")
+		d.FieldU8("flags")
+	default:
+		d.Fatalf("unknown token %d", token)
+	}
+}
+
+func (c binXMLContext) decodeNodes(d *decode.D, name string, whileFn func(t uint64) bool) {
+	d.FieldArray(name, func(d *decode.D) {
+		for d.BitsLeft() >= 8 && whileFn(peekToken(d)) {
+			d.FieldStruct("node", c.decodeNode)
+		}
+	})
+}
+
+// fragment is nodes up to and including end of stream
+func (c binXMLContext) decodeFragment(d *decode.D) {
+	d.FieldArray("nodes", func(d *decode.D) {
+		for d.BitsLeft() >= 8 {
+			t := peekToken(d)
+			d.FieldStruct("node", c.decodeNode)
+			if t == tokenEndOfStream {
+				break
+			}
+		}
+	})
+}
+
+func decodeRecord(d *decode.D, chunkStart int64) {
+	d.FieldUTF8("signature", len(recordMagic), d.AssertStr(recordMagic))
+	size := d.FieldU32("size", d.AssertURange(recordMinSize, chunkSize-chunkHeaderSize))
+	d.FieldU64("event_record_identifier")
+	d.FieldU64("written_time", fileTimeMap)
+	c := binXMLContext{chunkStart: chunkStart, hasDependencyID: true}
+	d.FieldStruct("event", func(d *decode.D) {
+		d.LenFn(int64(size-recordMinSize)*8, c.decodeFragment)
+	})
+	d.FieldU32("size_copy", d.ValidateU(size))
+}
+
+func decodeChunk(d *decode.D) {
+	chunkStart := d.Pos()
+
+	hb := d.PeekBytes(chunkHeaderSize)
+	headerCRC := crc32.NewIEEE()
+	headerCRC.Write(hb[0:checksumCoverSize])
+	headerCRC.Write(hb[fileHeaderSize:chunkHeaderSize])
+
+	var freeSpaceOffset uint64
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldUTF8("signature", len(chunkMagic), d.AssertStr(chunkMagic))
+		d.FieldU64("first_event_record_number")
+		d.FieldU64("last_event_record_number")
+		d.FieldU64("first_event_record_identifier")
+		d.FieldU64("last_event_record_identifier")
+		d.FieldU32("header_size")
+		d.FieldU32("last_event_record_offset")
+		freeSpaceOffset = d.FieldU32("free_space_offset", d.AssertURange(chunkHeaderSize, chunkSize))
+		recordsCRC := crc32.ChecksumIEEE(d.BytesRange(chunkStart+chunkHeaderSize*8, int(freeSpaceOffset-chunkHeaderSize)))
+		d.FieldChecksumU("event_records_checksum", 32, "crc32", uint64(recordsCRC), scalar.Hex)
+		d.FieldRawLen("unknown0", 64*8)
+		d.FieldU32("flags", scalar.Hex)
+		d.FieldChecksumU("header_checksum", 32, "crc32", uint64(headerCRC.Sum32()), scalar.Hex)
+		d.FieldArray("common_string_offsets", func(d *decode.D) {
+			for i := 0; i < 64; i++ {
+				d.FieldU32("offset")
+			}
+		})
+		d.FieldArray("template_pointers", func(d *decode.D) {
+			for i := 0; i < 32; i++ {
+				d.FieldU32("offset")
+			}
+		})
+	})
+
+	recordsEnd := chunkStart + int64(freeSpaceOffset)*8
+	d.FieldArray("records", func(d *decode.D) {
+		for d.Pos() < recordsEnd && string(d.PeekBytes(len(recordMagic))) == recordMagic {
+			d.FieldStruct("record", func(d *decode.D) { decodeRecord(d, chunkStart) })
+		}
+	})
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("unused", d.BitsLeft())
+	}
+}
+
+func evtxDecode(d *decode.D, in interface{}) interface{} {
+	d.Endian = decode.LittleEndian
+
+	fileCRC := crc32.ChecksumIEEE(d.PeekBytes(checksumCoverSize))
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldUTF8("signature", len(fileMagic), d.AssertStr(fileMagic))
+		d.FieldU64("first_chunk_number")
+		d.FieldU64("last_chunk_number")
+		d.FieldU64("next_record_identifier")
+		d.FieldU32("header_size", d.AssertU(fileHeaderSize))
+		d.FieldU16("minor_version")
+		majorVersion := d.FieldU16("major_version")
+		if majorVersion > latestMajorVersion {
+			d.FieldWarnf("major_version", decode.WarningUnknownVersion, "major version %d newer than latest known %d", majorVersion, latestMajorVersion)
+		}
+		blockSize := d.FieldU16("header_block_size", d.AssertURange(fileHeaderSize, chunkSize))
+		d.FieldU16("number_of_chunks")
+		d.FieldRawLen("unknown0", 76*8)
+		d.FieldStruct("file_flags", func(d *decode.D) {
+			// TODO: 32LE, should have some kind of native endian flag reader helper?
+			d.FieldU6("unused0")
+			d.FieldBool("full")
+			d.FieldBool("dirty")
+			d.FieldU24("unused1")
+		})
+		d.FieldChecksumU("checksum", 32, "crc32", uint64(fileCRC), scalar.Hex)
+		d.FieldRawLen("unknown1", int64(blockSize-fileHeaderSize)*8)
+	})
+
+	d.FieldArray("chunks", func(d *decode.D) {
+		for d.BitsLeft() >= chunkSize*8 && string(d.PeekBytes(len(chunkMagic))) == chunkMagic {
+			d.FieldStruct("chunk", func(d *decode.D) {
+				d.LenFn(chunkSize*8, decodeChunk)
+			})
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,220 @@
+package ffmetadata
+
+// https://ffmpeg.org/ffmpeg-formats.html#Metadata-1
+// https://github.com/FFmpeg/FFmpeg/blob/master/libavformat/ffmetadec.c
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/internal/lineparse"
+	"github.com/wader/fq/pkg/decode"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.FFMETADATA,
+		Description: "FFmpeg metadata",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte(headerMagic)}},
+		DecodeFn:    ffmetadataDecode,
+	})
+}
+
+const headerMagic = ";FFMETADATA"
+
+// default chapter timebase if no TIMEBASE key
+const defaultTimebaseDen = 1_000_000_000
+
+type line struct {
+	start int // byte offset in input
+	end   int // including newline
+	// for key/value lines
+	keyEnd int // including "="
+	key    string
+	value  string
+}
+
+// reads a line, escaped newlines continues the line
+func readLine(b []byte, start int) line {
+	l := line{start: start, end: len(b)}
+	var sb strings.Builder
+	escaped := false
+	for i := start; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case escaped:
+			sb.WriteByte(c)
+			escaped = false
+			continue
+		case c == '\\':
+			escaped = true
+			continue
+		case c == '=' && l.keyEnd == 0:
+			l.keyEnd = i + 1
+			l.key = sb.String()
+			sb.Reset()
+			continue
+		case c == '\n':
+			l.end = i + 1
+		default:
+			sb.WriteByte(c)
+			continue
+		}
+		break
+	}
+	if l.keyEnd != 0 {
+		l.value = strings.TrimSuffix(sb.String(), "\r")
+	} else {
+		l.key = strings.TrimSuffix(sb.String(), "\r")
+	}
+	return l
+}
+
+func fieldSpanU(d *decode.D, l line, name string) uint64 {
+	n, err := strconv.ParseUint(strings.TrimSpace(l.value), 10, 64)
+	if err != nil {
+		d.Fatalf("%s: invalid number %q", l.key, l.value)
+	}
+	return lineparse.FieldU(d, l.start, l.end, name, n)
+}
+
+func fieldMetadata(d *decode.D, lines []line) {
+	d.FieldArray("metadata", func(d *decode.D) {
+		for _, l := range lines {
+			d.FieldStruct("entry", func(d *decode.D) {
+				lineparse.FieldStr(d, l.start, l.keyEnd, "key", l.key)
+				lineparse.FieldStr(d, l.keyEnd, l.end, "value", l.value)
+			})
+		}
+	})
+}
+
+type section struct {
+	name     string
+	line     line
+	metadata []line
+	timebase *line
+	start    *line
+	end      *line
+}
+
+func ffmetadataDecode(d *decode.D, in interface{}) interface{} {
+	b := d.BytesLen(int(d.Len() / 8))
+	d.SeekAbs(0)
+
+	header := readLine(b, 0)
+	if !strings.HasPrefix(header.key, headerMagic) || header.keyEnd != 0 {
+		d.Fatalf("no %s header", headerMagic)
+	}
+
+	var comments []line
+	var global section
+	var chapters []*section
+	var streams []*section
+	current := &global
+
+	for pos := header.end; pos < len(b); {
+		// comments are not escaped
+		if b[pos] == ';' || b[pos] == '#' {
+			end := len(b)
+			if i := bytes.IndexByte(b[pos:], '\n'); i != -1 {
+				end = pos + i + 1
+			}
+			comments = append(comments, line{
+				start: pos,
+				end:   end,
+				key:   strings.TrimRight(string(b[pos+1:end]), "\r\n"),
+			})
+			pos = end
+			continue
+		}
+
+		l := readLine(b, pos)
+		pos = l.end
+
+		switch {
+		case l.keyEnd == 0 && l.key == "":
+			// empty line
+		case l.keyEnd == 0 && strings.HasPrefix(l.key, "[") && strings.HasSuffix(l.key, "]"):
+			s := &section{name: l.key[1 : len(l.key)-1], line: l}
+			switch s.name {
+			case "CHAPTER":
+				chapters = append(chapters, s)
+			case "STREAM":
+				streams = append(streams, s)
+			default:
+				d.Fatalf("unknown section %q", s.name)
+			}
+			current = s
+		case l.keyEnd == 0:
+			d.Fatalf("line without key/value %q", l.key)
+		case current.name == "CHAPTER" && l.key == "TIMEBASE":
+			current.timebase = &l
+		case current.name == "CHAPTER" && l.key == "START":
+			current.start = &l
+		case current.name == "CHAPTER" && l.key == "END":
+			current.end = &l
+		default:
+			current.metadata = append(current.metadata, l)
+		}
+	}
+
+	lineparse.FieldStr(d, header.start, header.end, "header", header.key)
+	if len(comments) > 0 {
+		d.FieldArray("comments", func(d *decode.D) {
+			for _, l := range comments {
+				lineparse.FieldStr(d, l.start, l.end, "comment", l.key)
+			}
+		})
+	}
+	fieldMetadata(d, global.metadata)
+	d.FieldArray("chapters", func(d *decode.D) {
+		for _, s := range chapters {
+			d.FieldStruct("chapter", func(d *decode.D) {
+				lineparse.FieldStr(d, s.line.start, s.line.end, "section", s.name)
+
+				num, den := uint64(1), uint64(defaultTimebaseDen)
+				if s.timebase != nil {
+					l := *s.timebase
+					tb := strings.TrimSpace(l.value)
+					parts := strings.Split(tb, "/")
+					var err0, err1 error
+					if len(parts) == 2 {
+						num, err0 = strconv.ParseUint(parts[0], 10, 64)
+						den, err1 = strconv.ParseUint(parts[1], 10, 64)
+					}
+					if len(parts) != 2 || err0 != nil || err1 != nil || num == 0 || den == 0 {
+						d.Fatalf("invalid timebase %q", tb)
+					}
+					lineparse.FieldStr(d, l.start, l.end, "timebase", tb)
+				} else {
+					d.FieldValueStr("timebase", "1/"+strconv.FormatUint(den, 10))
+				}
+				if s.start == nil || s.end == nil {
+					d.Fatalf("chapter without START or END")
+				}
+				start := fieldSpanU(d, *s.start, "start")
+				end := fieldSpanU(d, *s.end, "end")
+				d.FieldValueFloat("start_time", float64(start)*float64(num)/float64(den))
+				d.FieldValueFloat("end_time", float64(end)*float64(num)/float64(den))
+				fieldMetadata(d, s.metadata)
+			})
+		}
+	})
+	if len(streams) > 0 {
+		d.FieldArray("streams", func(d *decode.D) {
+			for _, s := range streams {
+				d.FieldStruct("stream", func(d *decode.D) {
+					lineparse.FieldStr(d, s.line.start, s.line.end, "section", s.name)
+					fieldMetadata(d, s.metadata)
+				})
+			}
+		})
+	}
+
+	return nil
+}
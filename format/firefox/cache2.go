@@ -0,0 +1,96 @@
+package firefox
+
+// https://searchfox.org/mozilla-central/source/netwerk/cache2/CacheFileMetadata.h
+// https://searchfox.org/mozilla-central/source/netwerk/cache2/CacheFileMetadata.cpp
+
+// TODO: validate hashes, uses Jenkins lookup2 hash
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.FIREFOX_CACHE2,
+		Description: "Firefox cache2 entry file",
+		DecodeFn:    cache2Decode,
+	})
+}
+
+const chunkSize = 256 * 1024
+
+const (
+	flagAnonymous = 1 << 0
+	flagPinned    = 1 << 1
+)
+
+var unixTimeMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	uv, ok := s.Actual.(uint64)
+	if !ok || uv == 0 {
+		return s, nil
+	}
+	s.Description = time.Unix(int64(uv), 0).UTC().Format(time.RFC3339)
+	return s, nil
+})
+
+func cache2Decode(d *decode.D, in interface{}) interface{} {
+	if d.Len() < 4*8 {
+		d.Fatalf("file too short")
+	}
+	metaOffset := int64(binary.BigEndian.Uint32(d.BytesRange(d.Len()-4*8, 4)))
+	if metaOffset*8 > d.Len()-4*8 {
+		d.Fatalf("invalid metadata offset %d", metaOffset)
+	}
+	numChunks := (metaOffset + chunkSize - 1) / chunkSize
+
+	d.FieldRawLen("data", metaOffset*8)
+	d.FieldStruct("metadata", func(d *decode.D) {
+		d.FieldU32("hash", scalar.Hex)
+		d.FieldArray("chunk_hashes", func(d *decode.D) {
+			for i := int64(0); i < numChunks; i++ {
+				d.FieldU16("hash", scalar.Hex)
+			}
+		})
+		var keySize uint64
+		d.FieldStruct("header", func(d *decode.D) {
+			version := d.FieldU32("version")
+			d.FieldU32("fetch_count")
+			d.FieldU32("last_fetched", unixTimeMap)
+			d.FieldU32("last_modified", unixTimeMap)
+			d.FieldU32("frecency")
+			d.FieldU32("expiration_time", unixTimeMap)
+			keySize = d.FieldU32("key_size")
+			if version >= 2 {
+				d.FieldStruct("flags", func(d *decode.D) {
+					flags := d.FieldU32("value", scalar.Hex)
+					d.FieldValueBool("anonymous", flags&flagAnonymous != 0)
+					d.FieldValueBool("pinned", flags&flagPinned != 0)
+				})
+			}
+		})
+		if keySize*8 > uint64(d.BitsLeft()) {
+			d.Fatalf("invalid key size %d", keySize)
+		}
+		d.FieldUTF8("key", int(keySize))
+		d.FieldU8("key_terminator", d.AssertU(0))
+		// null terminated key value pairs
+		d.FieldArray("elements", func(d *decode.D) {
+			for d.BitsLeft() > 4*8 {
+				d.FieldStruct("element", func(d *decode.D) {
+					d.FieldUTF8Null("key")
+					d.FieldUTF8Null("value")
+				})
+			}
+		})
+		// same offset as read to find metadata
+		d.FieldU32("offset", d.AssertU(uint64(metaOffset)))
+	})
+
+	return nil
+}
@@ -9,6 +9,7 @@ package flac
 import (
 	"bytes"
 	"crypto/md5"
+	"embed"
 	"fmt"
 
 	"github.com/wader/fq/format"
@@ -19,6 +20,9 @@ import (
 	"github.com/wader/fq/pkg/scalar"
 )
 
+//go:embed *.jq
+var flacFS embed.FS
+
 var flacMetadatablocksFormat decode.Group
 var flacFrameFormat decode.Group
 
@@ -27,11 +31,13 @@ func init() {
 		Name:        format.FLAC,
 		Description: "Free Lossless Audio Codec file",
 		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte("fLaC")}},
 		DecodeFn:    flacDecode,
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.FLAC_METADATABLOCKS}, Group: &flacMetadatablocksFormat},
 			{Names: []string{format.FLAC_FRAME}, Group: &flacFrameFormat},
 		},
+		Files: flacFS,
 	})
 }
 
@@ -55,6 +61,13 @@ func flacDecode(d *decode.D, in interface{}) interface{} {
 		flacFrameIn = format.FlacFrameIn{StreamInfo: streamInfo}
 	}
 
+	// decoded samples are only kept if asked for, ex by pcm_samples etc
+	decodePCM, _ := d.Options.FormatOptions["decode_pcm"].(bool)
+	var pcmSamples *bytes.Buffer
+	if decodePCM {
+		pcmSamples = &bytes.Buffer{}
+	}
+
 	md5Samples := md5.New()
 	d.FieldArray("frames", func(d *decode.D) {
 		for d.NotEnd() {
@@ -73,6 +86,9 @@ func flacDecode(d *decode.D, in interface{}) interface{} {
 			framesNDecodedSamples += ffo.Samples
 
 			d.MustCopy(md5Samples, bytes.NewReader(frameStreamSamplesBuf))
+			if pcmSamples != nil {
+				pcmSamples.Write(frameStreamSamplesBuf)
+			}
 			streamDecodedSamples += ffo.Samples
 
 			// reuse buffer if possible
@@ -82,7 +98,13 @@ func flacDecode(d *decode.D, in interface{}) interface{} {
 
 	md5CalcValue := d.FieldRootBitBuf("md5_calculated", bitio.NewBufferFromBytes(md5Samples.Sum(nil), -1))
 	_ = md5CalcValue.TryScalarFn(d.ValidateBitBuf(streamInfo.MD5), scalar.RawHex)
+	// calculated value is a field so register expected from streaminfo
+	md5CalcValue.Checksum = &decode.Checksum{Algorithm: "md5", Expected: streamInfo.MD5, Computed: md5Samples.Sum(nil)}
 	d.FieldValueU("decoded_samples", framesNDecodedSamples)
+	if pcmSamples != nil {
+		// interleaved little endian samples, sample size rounded up to whole bytes
+		d.FieldRootBitBuf("decoded_pcm", bitio.NewBufferFromBytes(pcmSamples.Bytes(), -1))
+	}
 
 	return nil
 }
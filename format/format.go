@@ -1,5 +1,7 @@
 package format
 
+import "github.com/wader/fq/pkg/bitio"
+
 //nolint:revive
 const (
 	ALL = "all"
@@ -8,30 +10,90 @@ const (
 	IMAGE       = "image"
 	TCP_STREAM  = "tcp_stream"
 	UDP_PAYLOAD = "udp_payload"
+	LINK_FRAME  = "link_frame"
+
+	RAW      = "raw"
+	JSON     = "json"
+	BSON     = "bson"
+	BENCODE  = "bencode"
+	BPLIST   = "bplist"
+	GVARIANT = "gvariant"
 
-	RAW  = "raw"
-	JSON = "json"
+	BLUETOOTH_HCI     = "bluetooth_hci"
+	DNS               = "dns"
+	DNS_TCP           = "dns_tcp"
+	ETHER8023_FRAME   = "ether8023_frame"
+	SLL_PACKET        = "sll_packet"
+	SLL2_PACKET       = "sll2_packet"
+	USB_PACKET        = "usb_packet"
+	IPV4_PACKET       = "ipv4_packet"
+	UDP_DATAGRAM      = "udp_datagram"
+	TCP_SEGMENT       = "tcp_segment"
+	ICMP              = "icmp"
+	ESP               = "esp"
+	IKEV2             = "ikev2"
+	OPENVPN           = "openvpn"
+	OPENVPN_TCP       = "openvpn_tcp"
+	WIREGUARD         = "wireguard"
+	STUN              = "stun"
+	TURN_CHANNEL_DATA = "turn_channel_data"
+	DTLS              = "dtls"
+	TLS               = "tls"
+	HTTP2             = "http2"
+	QUIC              = "quic"
+	WEBSOCKET         = "websocket"
+	RTCP              = "rtcp"
+	RTP               = "rtp"
+	RTSP              = "rtsp"
+	SRTP              = "srtp"
+	MEMCACHED         = "memcached"
+	DBUS_MESSAGE      = "dbus_message"
 
-	DNS             = "dns"
-	DNS_TCP         = "dns_tcp"
-	ETHER8023_FRAME = "ether8023_frame"
-	SLL_PACKET      = "sll_packet"
-	SLL2_PACKET     = "sll2_packet"
-	IPV4_PACKET     = "ipv4_packet"
-	UDP_DATAGRAM    = "udp_datagram"
-	TCP_SEGMENT     = "tcp_segment"
-	ICMP            = "icmp"
+	ANDROID_BOOT_IMG      = "android_boot_img"
+	AOF                   = "aof"
+	BITCOIN_BLKDAT        = "bitcoin_blkdat"
+	BITCOIN_BLOCK         = "bitcoin_block"
+	BITCOIN_SCRIPT        = "bitcoin_script"
+	BITCOIN_TRANSACTION   = "bitcoin_transaction"
+	BLF                   = "blf"
+	BTSNOOP               = "btsnoop"
+	CANDUMP               = "candump"
+	CASSANDRA_DATA        = "cassandra_data"
+	CASSANDRA_STATISTICS  = "cassandra_statistics"
+	CHROME_BLOCK_FILE     = "chrome_block_file"
+	CHROME_SIMPLE_CACHE   = "chrome_simple_cache"
+	ETHEREUM_BLOCK_HEADER = "ethereum_block_header"
+	ETHEREUM_TRANSACTION  = "ethereum_transaction"
+	FIREFOX_CACHE2        = "firefox_cache2"
+	GIT_INDEX             = "git_index"
+	GIT_PACK              = "git_pack"
+	GIT_PACK_IDX          = "git_pack_idx"
+	INDEXEDDB_KEY         = "indexeddb_key"
+	LUCENE                = "lucene"
+	RDB                   = "rdb"
+	RLP                   = "rlp"
+	TORRENT               = "torrent"
+	WIREDTIGER            = "wiredtiger"
 
 	AAC_FRAME           = "aac_frame"
+	AC3                 = "ac3"
+	AC3_FRAME           = "ac3_frame"
 	ADTS                = "adts"
 	ADTS_FRAME          = "adts_frame"
+	AIFF                = "aiff"
 	APEV2               = "apev2"
 	AV1_CCR             = "av1_ccr"
 	AV1_FRAME           = "av1_frame"
 	AV1_OBU             = "av1_obu"
+	BMP                 = "bmp"
 	BZIP2               = "bzip2"
+	CUE                 = "cue"
+	DTB                 = "dtb"
+	EDID                = "edid"
 	ELF                 = "elf"
+	EVTX                = "evtx"
 	EXIF                = "exif"
+	FFMETADATA          = "ffmetadata"
 	FLAC                = "flac"
 	FLAC_FRAME          = "flac_frame"
 	FLAC_METADATABLOCK  = "flac_metadatablock"
@@ -39,18 +101,29 @@ const (
 	FLAC_STREAMINFO     = "flac_streaminfo"
 	FLAC_PICTURE        = "flac_picture"
 	FLV                 = "flv" // TODO:
+	GB                  = "gb"
 	GIF                 = "gif"
 	GZIP                = "gzip"
 	ICC_PROFILE         = "icc_profile"
+	ICO                 = "ico"
 	ID3V1               = "id3v1"
 	ID3V11              = "id3v11"
 	ID3V2               = "id3v2"
+	INTEL_HEX           = "intel_hex"
+	ISO9660             = "iso9660"
 	JPEG                = "jpeg"
+	LNK                 = "lnk"
+	LYRICS3             = "lyrics3"
+	M3U8                = "m3u8"
 	MATROSKA            = "matroska"
+	MIDI                = "midi"
+	MINIDUMP            = "minidump"
 	MP3                 = "mp3"
 	MP3_FRAME           = "mp3_frame"
 	XING                = "xing"
+	VBRI                = "vbri"
 	MP4                 = "mp4"
+	MPD                 = "mpd"
 	MPEG_ASC            = "mpeg_asc"
 	AVC_ANNEXB          = "avc_annexb"
 	AVC_DCR             = "avc_dcr"
@@ -63,22 +136,43 @@ const (
 	HEVC_AU             = "hevc_au"
 	HEVC_NALU           = "hevc_nalu"
 	HEVC_DCR            = "hevc_dcr"
+	HEVC_VPS            = "hevc_vps"
+	HEVC_SPS            = "hevc_sps"
+	HEVC_PPS            = "hevc_pps"
 	MPEG_ES             = "mpeg_es"
 	MPEG_PES            = "mpeg_pes"
 	MPEG_PES_PACKET     = "mpeg_pes_packet"
 	MPEG_SPU            = "mpeg_spu"
 	MPEG_TS             = "mpeg_ts"
+	MPEG_TS_PACKET      = "mpeg_ts_packet"
+	NES                 = "nes"
 	OGG                 = "ogg"
 	OGG_PAGE            = "ogg_page"
+	OPENTYPE            = "opentype"
 	OPUS_PACKET         = "opus_packet"
+	OSTREE_COMMIT       = "ostree_commit"
+	OSTREE_DIRMETA      = "ostree_dirmeta"
+	OSTREE_DIRTREE      = "ostree_dirtree"
+	OTPAUTH             = "otpauth"
+	OTPAUTH_MIGRATION   = "otpauth_migration"
 	PCAP                = "pcap"
 	PCAPNG              = "pcapng"
+	PGS                 = "pgs"
 	PNG                 = "png"
 	PROTOBUF            = "protobuf"
 	PROTOBUF_WIDEVINE   = "protobuf_widevine"
+	PSD                 = "psd"
 	PSSH_PLAYREADY      = "pssh_playready"
+	REGF                = "regf"
+	SDP                 = "sdp"
+	SQUASHFS            = "squashfs"
+	SREC                = "srec"
 	TAR                 = "tar"
 	TIFF                = "tiff"
+	TX3G_SAMPLE         = "tx3g_sample"
+	UBOOT_IMAGE         = "uboot_image"
+	UF2                 = "uf2"
+	VOBSUB_IDX          = "vobsub_idx"
 	VORBIS_COMMENT      = "vorbis_comment"
 	VORBIS_PACKET       = "vorbis_packet"
 	VP8_FRAME           = "vp8_frame"
@@ -87,6 +181,9 @@ const (
 	VPX_CCR             = "vpx_ccr"
 	WAV                 = "wav"
 	WEBP                = "webp"
+	WOFF                = "woff"
+	WOFF2               = "woff2"
+	WVTT_SAMPLE         = "wvtt_sample"
 	ZIP                 = "zip"
 )
 
@@ -138,7 +235,7 @@ type OggPageOut struct {
 	IsContinuedPacket  bool
 	StreamSerialNumber uint32
 	SequenceNo         uint32
-	Segments           [][]byte
+	Segments           []*bitio.Buffer
 }
 
 type AvcIn struct {
@@ -157,10 +254,31 @@ type HevcDcrOut struct {
 	LengthSize uint64
 }
 
+// HevcNALUIn is state shared by NALUs in a stream, slice segment header
+// syntax depends on the referenced picture parameter set
+type HevcNALUIn struct {
+	// num_extra_slice_header_bits by pps_pic_parameter_set_id
+	NumExtraSliceHeaderBits map[uint64]uint64
+}
+
+type HevcPPSOut struct {
+	PicParameterSetID       uint64
+	NumExtraSliceHeaderBits uint64
+}
+
 type ProtoBufIn struct {
 	Message ProtoBufMessage
 }
 
+type GVariantIn struct {
+	// type signature of value, default is "v"
+	Signature string
+	// field names for members of top level tuple
+	Names []string
+	// integer values are stored big endian, as done by ostree
+	BigEndian bool
+}
+
 type MpegDecoderConfig struct {
 	ObjectType    int
 	ASCObjectType int
@@ -187,6 +305,28 @@ type MP3FrameOut struct {
 	ChannelModeIndex int
 }
 
+type BMPIn struct {
+	// device independent bitmap without file header and with an AND mask as used by ICO
+	Icon bool
+}
+
+// LinkFrameIn is passed to link_frame decoders, Type is a LinkType* constant
+type LinkFrameIn struct {
+	Type int
+}
+
+// BluetoothHCIIn is passed to bluetooth_hci, PacketType is the H4 packet type
+// indicator if packet has none, zero if packet starts with one
+type BluetoothHCIIn struct {
+	PacketType int
+}
+
+// BitcoinBlockIn is passed to bitcoin_block, HasHeader is true if block
+// starts with network magic and size as in blk*.dat files
+type BitcoinBlockIn struct {
+	HasHeader bool
+}
+
 type UDPDatagramIn struct {
 	SourcePort      int
 	DestinationPort int
@@ -196,3 +336,103 @@ type TCPStreamIn struct {
 	SourcePort      int
 	DestinationPort int
 }
+
+// AV1SequenceHeader is the sequence header state needed to decode AV1 frame headers
+type AV1SequenceHeader struct {
+	ReducedStillPictureHeader   bool
+	DecoderModelInfoPresent     bool
+	EqualPictureInterval        bool
+	BufferRemovalTimeLength     int
+	FramePresentationTimeLength int
+	OperatingPointIDC           []uint64
+	DecoderModelPresentForOp    []bool
+	FrameWidthBits              int
+	FrameHeightBits             int
+	MaxFrameWidth               uint64
+	MaxFrameHeight              uint64
+	FrameIDNumbersPresent       bool
+	IDLen                       int
+	SeqForceScreenContentTools  uint64
+	SeqForceIntegerMV           uint64
+	EnableOrderHint             bool
+	OrderHintBits               int
+	EnableSuperres              bool
+}
+
+type AV1OBUIn struct {
+	SequenceHeader *AV1SequenceHeader
+}
+
+// AV1OBUOut has SequenceHeader set if the OBU was a sequence header
+type AV1OBUOut struct {
+	SequenceHeader *AV1SequenceHeader
+}
+
+type AV1FrameIn struct {
+	SequenceHeader *AV1SequenceHeader
+}
+
+type AV1CCROut struct {
+	SequenceHeader *AV1SequenceHeader
+}
+
+// VP9FrameIn has reference frame slot sizes from previous frames, zero if unknown
+type VP9FrameIn struct {
+	RefFrameWidth  [8]uint64
+	RefFrameHeight [8]uint64
+}
+
+// VP9FrameOut has reference frame slot sizes after the frame
+type VP9FrameOut struct {
+	RefFrameWidth  [8]uint64
+	RefFrameHeight [8]uint64
+}
+
+// SDPRTPMap is a rtpmap attribute, payload type to encoding mapping
+type SDPRTPMap struct {
+	EncodingName       string
+	ClockRate          int
+	EncodingParameters string
+}
+
+type SDPMedia struct {
+	Media   string
+	Port    int
+	Proto   string
+	Formats []string
+	Control string
+	// keyed by payload type
+	RTPMaps map[int]SDPRTPMap
+	// fmtp parameters keyed by payload type, parameter names are lower case
+	FMTPs map[int]map[string]string
+}
+
+type SDPOut struct {
+	Media []SDPMedia
+}
+
+// RTPOut has header values and payload without padding of a RTP packet
+type RTPOut struct {
+	PayloadType    int
+	Marker         bool
+	SequenceNumber uint16
+	Timestamp      uint32
+	SSRC           uint32
+	Payload        []byte
+}
+
+// DTBProperty is a devicetree property, Path is the path of the node it
+// belongs to, "/" for root, and Pos the bit position of the value relative to
+// the start of the blob
+type DTBProperty struct {
+	Path  string
+	Name  string
+	Pos   int64
+	Value []byte
+}
+
+// DTBOut has size of the blob and all properties in structure block order
+type DTBOut struct {
+	TotalSize  uint64
+	Properties []DTBProperty
+}
@@ -0,0 +1,155 @@
+package gb
+
+// https://gbdev.io/pandocs/The_Cartridge_Header.html
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.GB,
+		Description: "Game Boy ROM image",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Offset: headerOffset + 4, Bytes: nintendoLogo}},
+		DecodeFn:    gbDecode,
+	})
+}
+
+const (
+	headerOffset = 0x100
+	headerBytes  = 0x50
+	// header checksum covers title to mask rom version
+	checksumStart = 0x134
+	checksumEnd   = 0x14d
+	// global checksum is stored at end of header
+	globalChecksumOffset = 0x14e
+)
+
+// boot rom compares this with the logo in the header and locks up if different
+var nintendoLogo = []byte{
+	0xce, 0xed, 0x66, 0x66, 0xcc, 0x0d, 0x00, 0x0b, 0x03, 0x73, 0x00, 0x83, 0x00, 0x0c, 0x00, 0x0d,
+	0x00, 0x08, 0x11, 0x1f, 0x88, 0x89, 0x00, 0x0e, 0xdc, 0xcc, 0x6e, 0xe6, 0xdd, 0xdd, 0xd9, 0x99,
+	0xbb, 0xbb, 0x67, 0x63, 0x6e, 0x0e, 0xec, 0xcc, 0xdd, 0xdc, 0x99, 0x9f, 0xbb, 0xb9, 0x33, 0x3e,
+}
+
+var cgbFlagNames = scalar.UToScalar{
+	0x80: {Sym: "cgb_enhanced", Description: "Supports Game Boy Color functions, works on older"},
+	0xc0: {Sym: "cgb_only", Description: "Game Boy Color only"},
+}
+
+var sgbFlagNames = scalar.UToScalar{
+	0x00: {Sym: "none"},
+	0x03: {Sym: "sgb", Description: "Supports Super Game Boy functions"},
+}
+
+var cartridgeTypeNames = scalar.UToSymStr{
+	0x00: "rom_only",
+	0x01: "mbc1",
+	0x02: "mbc1_ram",
+	0x03: "mbc1_ram_battery",
+	0x05: "mbc2",
+	0x06: "mbc2_battery",
+	0x08: "rom_ram",
+	0x09: "rom_ram_battery",
+	0x0b: "mmm01",
+	0x0c: "mmm01_ram",
+	0x0d: "mmm01_ram_battery",
+	0x0f: "mbc3_timer_battery",
+	0x10: "mbc3_timer_ram_battery",
+	0x11: "mbc3",
+	0x12: "mbc3_ram",
+	0x13: "mbc3_ram_battery",
+	0x19: "mbc5",
+	0x1a: "mbc5_ram",
+	0x1b: "mbc5_ram_battery",
+	0x1c: "mbc5_rumble",
+	0x1d: "mbc5_rumble_ram",
+	0x1e: "mbc5_rumble_ram_battery",
+	0x20: "mbc6",
+	0x22: "mbc7_sensor_rumble_ram_battery",
+	0xfc: "pocket_camera",
+	0xfd: "bandai_tama5",
+	0xfe: "huc3",
+	0xff: "huc1_ram_battery",
+}
+
+var romSizeNames = scalar.UToScalar{
+	0x00: {Sym: uint64(32 * 1024), Description: "2 banks"},
+	0x01: {Sym: uint64(64 * 1024), Description: "4 banks"},
+	0x02: {Sym: uint64(128 * 1024), Description: "8 banks"},
+	0x03: {Sym: uint64(256 * 1024), Description: "16 banks"},
+	0x04: {Sym: uint64(512 * 1024), Description: "32 banks"},
+	0x05: {Sym: uint64(1024 * 1024), Description: "64 banks"},
+	0x06: {Sym: uint64(2048 * 1024), Description: "128 banks"},
+	0x07: {Sym: uint64(4096 * 1024), Description: "256 banks"},
+	0x08: {Sym: uint64(8192 * 1024), Description: "512 banks"},
+}
+
+var ramSizeNames = scalar.UToScalar{
+	0x00: {Sym: uint64(0), Description: "No RAM"},
+	0x01: {Sym: uint64(2 * 1024), Description: "Unused"},
+	0x02: {Sym: uint64(8 * 1024), Description: "1 bank"},
+	0x03: {Sym: uint64(32 * 1024), Description: "4 banks"},
+	0x04: {Sym: uint64(128 * 1024), Description: "16 banks"},
+	0x05: {Sym: uint64(64 * 1024), Description: "8 banks"},
+}
+
+var destinationCodeNames = scalar.UToSymStr{
+	0x00: "japan",
+	0x01: "overseas",
+}
+
+var oldLicenseeCodeNames = scalar.UToScalar{
+	0x33: {Description: "Use new licensee code"},
+}
+
+func gbDecode(d *decode.D, in interface{}) interface{} {
+	if d.Len() < (headerOffset+headerBytes)*8 {
+		d.Fatalf("too short for header")
+	}
+	b := d.BytesLen(int(d.Len() / 8))
+	d.SeekAbs(0)
+
+	var headerChecksum uint8
+	for _, c := range b[checksumStart:checksumEnd] {
+		headerChecksum = headerChecksum - c - 1
+	}
+	var globalChecksum uint16
+	for i, c := range b {
+		if i == globalChecksumOffset || i == globalChecksumOffset+1 {
+			continue
+		}
+		globalChecksum += uint16(c)
+	}
+
+	// restart and interrupt vectors
+	d.FieldRawLen("vectors", headerOffset*8)
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldRawLen("entry_point", 4*8)
+		d.FieldRawLen("logo", int64(len(nintendoLogo))*8, d.AssertBitBuf(nintendoLogo))
+		cgbFlag := b[0x143]
+		if cgbFlag&0x80 != 0 {
+			d.FieldUTF8NullFixedLen("title", 15)
+			d.FieldU8("cgb_flag", cgbFlagNames, scalar.Hex)
+		} else {
+			d.FieldUTF8NullFixedLen("title", 16)
+		}
+		d.FieldUTF8("new_licensee_code", 2)
+		d.FieldU8("sgb_flag", sgbFlagNames, scalar.Hex)
+		d.FieldU8("cartridge_type", cartridgeTypeNames, scalar.Hex)
+		d.FieldU8("rom_size", romSizeNames)
+		d.FieldU8("ram_size", ramSizeNames)
+		d.FieldU8("destination_code", destinationCodeNames)
+		d.FieldU8("old_licensee_code", oldLicenseeCodeNames, scalar.Hex)
+		d.FieldU8("mask_rom_version")
+		d.FieldChecksumU("header_checksum", 8, "sum8", uint64(headerChecksum), scalar.Hex)
+		d.FieldChecksumU("global_checksum", 16, "sum16", uint64(globalChecksum), scalar.Hex)
+	})
+	d.FieldRawLen("data", d.BitsLeft())
+
+	return nil
+}
@@ -1,17 +1,22 @@
 package gif
 
 // https://www.w3.org/Graphics/GIF/spec-gif87.txt
+// https://www.w3.org/Graphics/GIF/spec-gif89a.txt
 // https://en.wikipedia.org/wiki/GIF
 // https://web.archive.org/web/20160304075538/http://qalle.net/gif89a.php#graphiccontrolextension
+// http://www.vurdalakov.net/misc/gif/netscape-looping-application-extension
 
-// TODO: local color map
-// TODO: bit depth done correct?
+// TODO: plain text extension
 
 import (
 	"bytes"
+	"compress/lzw"
+	"io"
+	"io/ioutil"
 
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/bitio"
 	"github.com/wader/fq/pkg/decode"
 	"github.com/wader/fq/pkg/scalar"
 )
@@ -21,6 +26,7 @@ func init() {
 		Name:        format.GIF,
 		Description: "Graphics Interchange Format",
 		Groups:      []string{format.PROBE, format.IMAGE},
+		Magic:       []decode.Magic{{Bytes: []byte("GIF8")}},
 		DecodeFn:    gifDecode,
 	})
 }
@@ -39,6 +45,23 @@ var extensionNames = scalar.UToSymStr{
 	extensionApplication:      "Application",
 }
 
+var disposalMethodNames = scalar.UToSymStr{
+	0: "unspecified",
+	1: "do_not_dispose",
+	2: "restore_to_background",
+	3: "restore_to_previous",
+}
+
+const (
+	netscapeSubBlockLoop   = 1
+	netscapeSubBlockBuffer = 2
+)
+
+var netscapeSubBlockNames = scalar.UToSymStr{
+	netscapeSubBlockLoop:   "loop",
+	netscapeSubBlockBuffer: "buffer",
+}
+
 func fieldColorMap(d *decode.D, name string, bitDepth int) {
 	d.FieldArray(name, func(d *decode.D) {
 		for i := 0; i < 1<<bitDepth; i++ {
@@ -51,6 +74,33 @@ func fieldColorMap(d *decode.D, name string, bitDepth int) {
 	})
 }
 
+// decode data sub-blocks until zero length terminator, fn is called with a
+// decoder limited to each sub-block data, return concatenated data
+func fieldDataSubBlocks(d *decode.D, name string, fn func(d *decode.D, i int)) []byte {
+	dataBytes := &bytes.Buffer{}
+	d.FieldArray(name, func(d *decode.D) {
+		for i := 0; ; i++ {
+			if d.PeekBits(8) == 0 {
+				break
+			}
+			d.FieldStruct("data_sub_block", func(d *decode.D) {
+				byteCount := d.FieldU8("byte_count")
+				d.MustCopy(dataBytes, d.BitBufRange(d.Pos(), int64(byteCount)*8))
+				d.LenFn(int64(byteCount)*8, func(d *decode.D) {
+					fn(d, i)
+				})
+			})
+		}
+	})
+	d.FieldU8("terminator")
+
+	return dataBytes.Bytes()
+}
+
+func fieldRawSubBlock(d *decode.D, i int) {
+	d.FieldRawLen("data", d.BitsLeft())
+}
+
 func gifDecode(d *decode.D, in interface{}) interface{} {
 	d.Endian = decode.LittleEndian
 
@@ -60,7 +110,7 @@ func gifDecode(d *decode.D, in interface{}) interface{} {
 	d.FieldU16("height")
 	gcpFollows := d.FieldBool("gcp_follows")
 	d.FieldUFn("color_resolution", func(d *decode.D) uint64 { return d.U3() + 1 })
-	d.FieldU1("zero")
+	d.FieldBool("sort")
 	bitDepth := d.FieldUFn("bit_depth", func(d *decode.D) uint64 { return d.U3() + 1 })
 	d.FieldU8("black_color")
 	d.FieldU8("pixel_aspect_ratio")
@@ -80,68 +130,79 @@ func gifDecode(d *decode.D, in interface{}) interface{} {
 					d.FieldU8("introducer")
 					functionCode := d.FieldU8("function_code", extensionNames, scalar.Hex)
 
-					dataBytes := &bytes.Buffer{}
-
-					d.FieldArray("func_data_bytes", func(d *decode.D) {
-						seenTerminator := false
-						for !seenTerminator {
-
-							d.FieldStruct("func_data_byte", func(d *decode.D) {
-								byteCount := d.FieldU8("byte_count")
-								b := d.FieldRawLen("data", int64(byteCount*8))
-								if d.PeekBits(8) == 0 {
-									d.FieldU8("terminator")
-									seenTerminator = true
+					switch functionCode {
+					case extensionGraphicalControl:
+						fieldDataSubBlocks(d, "func_data_bytes", func(d *decode.D, i int) {
+							if i != 0 {
+								fieldRawSubBlock(d, i)
+								return
+							}
+							d.FieldU3("reserved")
+							d.FieldU3("disposal_method", disposalMethodNames)
+							d.FieldBool("user_input")
+							d.FieldBool("transparent_color")
+							d.FieldU16("delay_time")
+							d.FieldU8("transparent_color_index")
+						})
+					case extensionApplication:
+						var applicationID string
+						fieldDataSubBlocks(d, "func_data_bytes", func(d *decode.D, i int) {
+							switch {
+							case i == 0:
+								applicationID = d.FieldUTF8("application_identifier", 8)
+								d.FieldUTF8("authentication_code", 3)
+							case applicationID == "NETSCAPE" || applicationID == "ANIMEXTS":
+								subBlockID := d.FieldU8("sub_block_id", netscapeSubBlockNames)
+								switch subBlockID {
+								case netscapeSubBlockLoop:
+									d.FieldU16("loop_count", scalar.UToScalar{0: {Description: "infinite"}})
+								case netscapeSubBlockBuffer:
+									d.FieldU32("buffer_size")
+								default:
+									fieldRawSubBlock(d, i)
 								}
-								d.MustCopy(dataBytes, b.Clone())
-							})
-						}
-					})
-
-					_ = functionCode
-
-					// TODO: need a FieldStructBitBuf or something
-					// switch functionCode {
-					// case extensionGraphicalControl:
-					// 	d.FieldFormatBitBuf(
-					// 		"graphics_control",
-					// 		bitio.NewBufferFromBytes(dataBytes.Bytes(), -1),
-					// 	)
-
-					// }
+							default:
+								fieldRawSubBlock(d, i)
+							}
+						})
+					case extensionComment:
+						fieldDataSubBlocks(d, "func_data_bytes", func(d *decode.D, i int) {
+							d.FieldUTF8("comment", int(d.BitsLeft()/8))
+						})
+					default:
+						fieldDataSubBlocks(d, "func_data_bytes", fieldRawSubBlock)
+					}
 				})
 			case 0x2c: /* "," */
 				d.FieldStruct("image", func(d *decode.D) {
 					d.FieldU8("separator_character")
 					d.FieldU16("left")
 					d.FieldU16("top")
-					d.FieldU16("width")
-					d.FieldU16("height")
+					width := d.FieldU16("width")
+					height := d.FieldU16("height")
 
 					localFollows := d.FieldBool("local_color_map_follows")
 					d.FieldBool("image_interlaced")
-					d.FieldU3("zero")
-					d.FieldUFn("bit_depth", func(d *decode.D) uint64 { return d.U3() + 1 })
-					d.FieldU8("code_size")
+					d.FieldBool("sort")
+					d.FieldU2("zero")
+					localBitDepth := d.FieldUFn("bit_depth", func(d *decode.D) uint64 { return d.U3() + 1 })
 
 					if localFollows {
-						fieldColorMap(d, "local_color_map", int(bitDepth))
+						fieldColorMap(d, "local_color_map", int(localBitDepth))
 					}
 
-					d.FieldArray("image_bytes", func(d *decode.D) {
-						seenTerminator := false
-						for !seenTerminator {
-
-							d.FieldStruct("func_data_byte", func(d *decode.D) {
-								byteCount := d.FieldU8("byte_count")
-								d.FieldRawLen("data", int64(byteCount*8))
-								if d.PeekBits(8) == 0 {
-									d.FieldU8("terminator")
-									seenTerminator = true
-								}
-							})
-						}
-					})
+					codeSize := d.FieldU8("code_size")
+					lzwBytes := fieldDataSubBlocks(d, "image_bytes", fieldRawSubBlock)
+
+					// lzw reader only supports 2-8 bits literal width
+					if codeSize >= 2 && codeSize <= 8 {
+						zr := lzw.NewReader(bytes.NewReader(lzwBytes), lzw.LSB, int(codeSize))
+						// ignore error, can be trailing bytes after end of information code
+						// one byte per pixel so ignore excess, protects against crafted data expanding a lot
+						uncompressed, _ := ioutil.ReadAll(io.LimitReader(zr, int64(width)*int64(height)))
+						zr.Close()
+						d.FieldRootBitBuf("uncompressed", bitio.NewBufferFromBytes(uncompressed, -1))
+					}
 				})
 			default:
 				d.Fatalf("unknown block")
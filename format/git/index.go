@@ -0,0 +1,318 @@
+package git
+
+// https://git-scm.com/docs/index-format
+// https://github.com/git/git/blob/master/Documentation/technical/index-format.txt
+
+// TODO: link, FSMN, EOIE, IEOT and sdir extensions
+
+import (
+	"crypto/sha1" //nolint:gosec
+	"math/bits"
+	"strconv"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.GIT_INDEX,
+		Description: "Git index (dircache)",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte("DIRC")}},
+		DecodeFn:    indexDecode,
+	})
+}
+
+const (
+	indexEntryFixedLen         = 62
+	indexEntryExtendedFixedLen = 64
+)
+
+var indexObjectTypeNames = scalar.UToSymStr{
+	0b1000: "regular_file",
+	0b1010: "symlink",
+	0b1110: "gitlink",
+}
+
+var indexStageNames = scalar.UToSymStr{
+	0: "normal",
+	1: "base",
+	2: "ours",
+	3: "theirs",
+}
+
+var indexExtensionNames = scalar.StrToSymStr{
+	"TREE": "cache_tree",
+	"REUC": "resolve_undo",
+	"link": "split_index",
+	"UNTR": "untracked_cache",
+	"FSMN": "fsmonitor",
+	"EOIE": "end_of_index_entry",
+	"IEOT": "index_entry_offset_table",
+	"sdir": "sparse_directory",
+}
+
+var unixTimeMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	uv, ok := s.Actual.(uint64)
+	if !ok || uv == 0 {
+		return s, nil
+	}
+	s.Description = time.Unix(int64(uv), 0).UTC().Format(time.RFC3339)
+	return s, nil
+})
+
+// reads ascii number terminated by term
+func readASCIIInt(d *decode.D, term byte, base int) int64 {
+	n := d.PeekFindByte(term, 32)
+	if n < 0 {
+		d.Fatalf("number not terminated by %q", term)
+	}
+	s := d.UTF8(int(n) + 1)
+	i, err := strconv.ParseInt(s[:len(s)-1], base, 64)
+	if err != nil {
+		d.Fatalf("invalid number: %s", err)
+	}
+	return i
+}
+
+func decodeIndexTime(d *decode.D) {
+	d.FieldU32("seconds", unixTimeMap)
+	d.FieldU32("nanoseconds")
+}
+
+// cached stat data used by untracked cache, same as entry but without mode
+func decodeStatData(d *decode.D) {
+	d.FieldStruct("ctime", decodeIndexTime)
+	d.FieldStruct("mtime", decodeIndexTime)
+	d.FieldU32("dev")
+	d.FieldU32("ino")
+	d.FieldU32("uid")
+	d.FieldU32("gid")
+	d.FieldU32("size")
+}
+
+func decodeIndexEntry(d *decode.D, version uint64, prevPath string) string {
+	entryStart := d.Pos()
+
+	d.FieldStruct("ctime", decodeIndexTime)
+	d.FieldStruct("mtime", decodeIndexTime)
+	d.FieldU32("dev")
+	d.FieldU32("ino")
+	d.FieldStruct("mode", func(d *decode.D) {
+		d.FieldU16("unused0")
+		d.FieldU4("object_type", indexObjectTypeNames)
+		d.FieldU3("unused1")
+		d.FieldU9("permissions", scalar.Oct)
+	})
+	d.FieldU32("uid")
+	d.FieldU32("gid")
+	d.FieldU32("size")
+	d.FieldRawLen("object", objectIDLen*8, scalar.RawHex)
+	var extended bool
+	d.FieldStruct("flags", func(d *decode.D) {
+		d.FieldBool("assume_valid")
+		extended = d.FieldBool("extended")
+		d.FieldU2("stage", indexStageNames)
+		// 0xfff means path is 0xfff or longer
+		d.FieldU12("name_length")
+	})
+	fixedLen := int64(indexEntryFixedLen)
+	if extended {
+		if version < 3 {
+			d.Fatalf("extended flag set in version %d", version)
+		}
+		d.FieldStruct("extended_flags", func(d *decode.D) {
+			d.FieldU1("reserved")
+			d.FieldBool("skip_worktree")
+			d.FieldBool("intent_to_add")
+			d.FieldU13("unused")
+		})
+		fixedLen = indexEntryExtendedFixedLen
+	}
+
+	var path string
+	if version == 4 {
+		// prefix compressed, remove n bytes from previous path and append suffix
+		strip := d.FieldUFn("path_strip_length", readOffsetVarint)
+		if strip > uint64(len(prevPath)) {
+			d.Fatalf("path strip length %d longer than previous path", strip)
+		}
+		suffix := d.FieldUTF8Null("path_suffix")
+		path = prevPath[:uint64(len(prevPath))-strip] + suffix
+		d.FieldValueStr("path", path)
+	} else {
+		path = d.FieldUTF8Null("path")
+		// entry is padded with 1-8 nul bytes to multiple of 8 bytes, includes path terminator
+		entryLen := (fixedLen + int64(len(path)) + 8) &^ 7
+		paddingLen := entryLen - (d.Pos()-entryStart)/8
+		if paddingLen > 0 {
+			d.FieldRawLen("padding", paddingLen*8, d.BitBufIsZero())
+		}
+	}
+
+	return path
+}
+
+func decodeCacheTree(d *decode.D) {
+	d.FieldStructArrayLoop("entries", "entry", d.NotEnd, func(d *decode.D) {
+		d.FieldUTF8Null("path")
+		// -1 means invalid and has no object
+		entryCount := d.FieldSFn("entry_count", func(d *decode.D) int64 { return readASCIIInt(d, ' ', 10) })
+		d.FieldSFn("subtree_count", func(d *decode.D) int64 { return readASCIIInt(d, '\n', 10) })
+		if entryCount >= 0 {
+			d.FieldRawLen("object", objectIDLen*8, scalar.RawHex)
+		}
+	})
+}
+
+func decodeResolveUndo(d *decode.D) {
+	d.FieldStructArrayLoop("entries", "entry", d.NotEnd, func(d *decode.D) {
+		d.FieldUTF8Null("path")
+		// one mode per stage, zero means stage is missing and has no object
+		var objectCount int
+		d.FieldArray("modes", func(d *decode.D) {
+			for i := 0; i < 3; i++ {
+				if d.FieldSFn("mode", func(d *decode.D) int64 { return readASCIIInt(d, 0, 8) }, scalar.Oct) != 0 {
+					objectCount++
+				}
+			}
+		})
+		d.FieldArray("objects", func(d *decode.D) {
+			for i := 0; i < objectCount; i++ {
+				d.FieldRawLen("object", objectIDLen*8, scalar.RawHex)
+			}
+		})
+	})
+}
+
+// https://github.com/git/git/blob/master/Documentation/technical/bitmap-format.txt
+// returns number of set bits
+func decodeEWAH(d *decode.D) uint64 {
+	bitSize := d.FieldU32("bit_size")
+	wordCount := d.FieldU32("word_count")
+	var setBits uint64
+	d.FieldArray("words", func(d *decode.D) {
+		for i := uint64(0); i < wordCount; {
+			// run length word followed by literal words
+			var literalWords uint64
+			d.FieldStruct("rlw", func(d *decode.D) {
+				literalWords = d.FieldU31("literal_words")
+				runningLength := d.FieldU32("running_length")
+				if d.FieldU1("running_bit") == 1 {
+					setBits += runningLength * 64
+				}
+			})
+			i++
+			for j := uint64(0); j < literalWords && i < wordCount; j++ {
+				setBits += uint64(bits.OnesCount64(d.FieldU64("literal", scalar.Hex)))
+				i++
+			}
+		}
+	})
+	d.FieldU32("rlw_position")
+
+	if setBits > bitSize {
+		setBits = bitSize
+	}
+
+	return setBits
+}
+
+func decodeUntrackedCache(d *decode.D) {
+	identLen := d.FieldUFn("ident_length", readOffsetVarint)
+	d.FieldArray("idents", func(d *decode.D) {
+		d.LenFn(int64(identLen)*8, func(d *decode.D) {
+			for d.NotEnd() {
+				d.FieldUTF8Null("ident")
+			}
+		})
+	})
+	d.FieldStruct("info_exclude_stat", decodeStatData)
+	d.FieldStruct("excludes_file_stat", decodeStatData)
+	d.FieldU32("dir_flags", scalar.Hex)
+	// zero object means file does not exist
+	d.FieldRawLen("info_exclude_object", objectIDLen*8, scalar.RawHex)
+	d.FieldRawLen("excludes_file_object", objectIDLen*8, scalar.RawHex)
+	d.FieldUTF8Null("exclude_per_dir")
+	dirCount := d.FieldUFn("dir_count", readOffsetVarint)
+	if dirCount == 0 {
+		return
+	}
+
+	// directories in depth first order
+	d.FieldArray("dirs", func(d *decode.D) {
+		for i := uint64(0); i < dirCount; i++ {
+			d.FieldStruct("dir", func(d *decode.D) {
+				untrackedCount := d.FieldUFn("untracked_count", readOffsetVarint)
+				d.FieldUFn("subdir_count", readOffsetVarint)
+				d.FieldUTF8Null("name")
+				d.FieldArray("untracked", func(d *decode.D) {
+					for j := uint64(0); j < untrackedCount; j++ {
+						d.FieldUTF8Null("name")
+					}
+				})
+			})
+		}
+	})
+
+	// bit n is for directory n
+	var validCount, objectCount uint64
+	d.FieldStruct("valid", func(d *decode.D) { validCount = decodeEWAH(d) })
+	d.FieldStruct("check_only", func(d *decode.D) { decodeEWAH(d) })
+	d.FieldStruct("object_valid", func(d *decode.D) { objectCount = decodeEWAH(d) })
+	d.FieldArray("stats", func(d *decode.D) {
+		for i := uint64(0); i < validCount; i++ {
+			d.FieldStruct("stat", decodeStatData)
+		}
+	})
+	d.FieldArray("exclude_objects", func(d *decode.D) {
+		for i := uint64(0); i < objectCount; i++ {
+			d.FieldRawLen("object", objectIDLen*8, scalar.RawHex)
+		}
+	})
+	d.FieldU8("terminator", d.AssertU(0))
+}
+
+func indexDecode(d *decode.D, in interface{}) interface{} {
+	d.FieldUTF8("signature", 4, d.AssertStr("DIRC"))
+	version := d.FieldU32("version", d.AssertU(2, 3, 4))
+	entryCount := d.FieldU32("entry_count")
+
+	d.FieldArray("entries", func(d *decode.D) {
+		var path string
+		for i := uint64(0); i < entryCount; i++ {
+			d.FieldStruct("entry", func(d *decode.D) {
+				path = decodeIndexEntry(d, version, path)
+			})
+		}
+	})
+
+	d.FieldStructArrayLoop("extensions", "extension", func() bool {
+		return d.BitsLeft() > objectIDLen*8
+	}, func(d *decode.D) {
+		signature := d.FieldUTF8("signature", 4, indexExtensionNames)
+		size := d.FieldU32("size")
+		d.LenFn(int64(size)*8, func(d *decode.D) {
+			switch signature {
+			case "TREE":
+				decodeCacheTree(d)
+			case "REUC":
+				decodeResolveUndo(d)
+			case "UNTR":
+				decodeUntrackedCache(d)
+			default:
+				d.FieldRawLen("data", d.BitsLeft())
+			}
+		})
+	})
+
+	sha1W := sha1.New()
+	d.MustCopy(sha1W, d.BitBufRange(0, d.Pos()))
+	d.FieldChecksumRawLen("checksum", objectIDLen*8, "sha1", sha1W.Sum(nil), scalar.RawHex)
+
+	return nil
+}
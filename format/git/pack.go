@@ -0,0 +1,286 @@
+package git
+
+// https://git-scm.com/docs/pack-format
+// https://github.com/git/git/blob/master/Documentation/technical/pack-format.txt
+
+// TODO: sha256 repositories, object id length is hardcoded to sha1
+
+import (
+	"compress/flate"
+	"crypto/sha1" //nolint:gosec
+	"hash/adler32"
+	"io"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.GIT_PACK,
+		Description: "Git packfile",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte("PACK")}},
+		DecodeFn:    packDecode,
+	})
+}
+
+const objectIDLen = 20
+
+const (
+	objectTypeCommit   = 1
+	objectTypeTree     = 2
+	objectTypeBlob     = 3
+	objectTypeTag      = 4
+	objectTypeOfsDelta = 6
+	objectTypeRefDelta = 7
+)
+
+var objectTypeNames = scalar.UToSymStr{
+	objectTypeCommit:   "commit",
+	objectTypeTree:     "tree",
+	objectTypeBlob:     "blob",
+	objectTypeTag:      "tag",
+	objectTypeOfsDelta: "ofs_delta",
+	objectTypeRefDelta: "ref_delta",
+}
+
+var treeModeNames = scalar.StrToSymStr{
+	"40000":  "tree",
+	"100644": "blob",
+	"100755": "executable",
+	"120000": "symlink",
+	"160000": "gitlink",
+}
+
+var deltaInstructionNames = scalar.UToSymStr{
+	0: "insert",
+	1: "copy",
+}
+
+// little endian base 128, used for sizes in delta data
+func readVarint(d *decode.D) uint64 {
+	var n uint64
+	for shift := 0; ; shift += 7 {
+		b := d.U8()
+		n |= (b & 0x7f) << shift
+		if b&0x80 == 0 {
+			return n
+		}
+	}
+}
+
+// big endian base 128 that adds one for each continuation byte, used for
+// ofs_delta offsets and in index files
+func readOffsetVarint(d *decode.D) uint64 {
+	b := d.U8()
+	n := b & 0x7f
+	for b&0x80 != 0 {
+		b = d.U8()
+		n = ((n + 1) << 7) | (b & 0x7f)
+	}
+	return n
+}
+
+// reads a line terminated by newline and returns it without terminator
+func readLine(d *decode.D) string {
+	n := d.PeekFindByte('\n', d.BitsLeft()/8)
+	if n < 0 {
+		d.Fatalf("line not terminated by newline")
+	}
+	s := d.UTF8(int(n) + 1)
+	return s[:len(s)-1]
+}
+
+// header value, lines starting with space are continuations, ex gpgsig
+func readHeaderValue(d *decode.D) string {
+	s := readLine(d)
+	for d.NotEnd() && d.PeekBits(8) == ' ' {
+		d.U8()
+		s += "\n" + readLine(d)
+	}
+	return s
+}
+
+// commit and tag objects, header lines, empty line and message
+func decodeCommitOrTag(d *decode.D, in interface{}) interface{} {
+	d.FieldStructArrayLoop("headers", "header", func() bool {
+		return d.NotEnd() && d.PeekBits(8) != '\n'
+	}, func(d *decode.D) {
+		d.FieldStrFn("key", func(d *decode.D) string {
+			n := d.PeekFindByte(' ', d.BitsLeft()/8)
+			if n < 0 {
+				d.Fatalf("header key not terminated by space")
+			}
+			s := d.UTF8(int(n) + 1)
+			return s[:len(s)-1]
+		})
+		d.FieldStrFn("value", readHeaderValue)
+	})
+	if d.NotEnd() {
+		d.FieldUTF8("separator", 1, d.AssertStr("\n"))
+		d.FieldUTF8("message", int(d.BitsLeft()/8))
+	}
+
+	return nil
+}
+
+func decodeTree(d *decode.D, in interface{}) interface{} {
+	d.FieldStructArrayLoop("entries", "entry", d.NotEnd, func(d *decode.D) {
+		d.FieldStrFn("mode", func(d *decode.D) string {
+			n := d.PeekFindByte(' ', 8)
+			if n < 0 {
+				d.Fatalf("mode not terminated by space")
+			}
+			s := d.UTF8(int(n) + 1)
+			return s[:len(s)-1]
+		}, treeModeNames)
+		d.FieldUTF8Null("name")
+		d.FieldRawLen("object", objectIDLen*8, scalar.RawHex)
+	})
+
+	return nil
+}
+
+func decodeBlob(d *decode.D, in interface{}) interface{} {
+	d.FieldRawLen("data", d.BitsLeft())
+
+	return nil
+}
+
+func decodeDelta(d *decode.D, in interface{}) interface{} {
+	d.FieldUFn("base_size", readVarint)
+	d.FieldUFn("result_size", readVarint)
+	d.FieldStructArrayLoop("instructions", "instruction", d.NotEnd, func(d *decode.D) {
+		if d.FieldU1("type", deltaInstructionNames) == 1 {
+			// bit set means byte is present, offset is 4 bytes and size 3 bytes little endian
+			var offsetBits, sizeBits uint64
+			d.FieldStruct("present", func(d *decode.D) {
+				sizeBits = d.FieldU3("size", scalar.Bin)
+				offsetBits = d.FieldU4("offset", scalar.Bin)
+			})
+			d.FieldUFn("offset", func(d *decode.D) uint64 {
+				var n uint64
+				for i := 0; i < 4; i++ {
+					if offsetBits&(1<<i) != 0 {
+						n |= d.U8() << (i * 8)
+					}
+				}
+				return n
+			})
+			d.FieldUFn("size", func(d *decode.D) uint64 {
+				var n uint64
+				for i := 0; i < 3; i++ {
+					if sizeBits&(1<<i) != 0 {
+						n |= d.U8() << (i * 8)
+					}
+				}
+				// zero means 0x10000
+				if n == 0 {
+					n = 0x10000
+				}
+				return n
+			})
+		} else {
+			size := d.FieldU7("size")
+			if size == 0 {
+				d.Fatalf("reserved delta instruction")
+			}
+			d.FieldRawLen("data", int64(size)*8)
+		}
+	})
+
+	return nil
+}
+
+var objectTypeFormats = map[uint64]decode.Group{
+	objectTypeCommit:   decode.FormatFn(decodeCommitOrTag),
+	objectTypeTree:     decode.FormatFn(decodeTree),
+	objectTypeBlob:     decode.FormatFn(decodeBlob),
+	objectTypeTag:      decode.FormatFn(decodeCommitOrTag),
+	objectTypeOfsDelta: decode.FormatFn(decodeDelta),
+	objectTypeRefDelta: decode.FormatFn(decodeDelta),
+}
+
+// zlib stream, header, deflate data and adler32 of uncompressed data
+func decodeZlib(d *decode.D, objectType uint64) {
+	d.FieldStruct("zlib_header", func(d *decode.D) {
+		d.FieldU4("compression_info")
+		d.FieldU4("compression_method", d.AssertU(8))
+		d.FieldU2("level")
+		if d.FieldBool("dictionary") {
+			d.Fatalf("preset dictionary not supported")
+		}
+		d.FieldU5("check")
+	})
+
+	group, ok := objectTypeFormats[objectType]
+	if !ok {
+		group = decode.FormatFn(decodeBlob)
+	}
+	// *bitio.Buffer implements io.ByteReader so that deflate don't do own
+	// buffering and might read more than needed messing up knowing compressed size
+	readCompressedSize, uncompressedBB, dv, _, _ := d.TryFieldReaderRangeFormat(
+		"uncompressed",
+		d.Pos(),
+		d.BitsLeft(),
+		func(r io.Reader) io.Reader { return flate.NewReader(r) },
+		group,
+		nil,
+	)
+	if uncompressedBB == nil {
+		d.Fatalf("failed to inflate")
+	}
+	if dv == nil {
+		d.FieldRootBitBuf("uncompressed", uncompressedBB)
+	}
+	d.FieldRawLen("compressed", readCompressedSize)
+	adler32W := adler32.New()
+	d.MustCopy(adler32W, uncompressedBB.Clone())
+	d.FieldChecksumU("adler32", 32, "adler32", uint64(adler32W.Sum32()), scalar.Hex)
+}
+
+func decodeObject(d *decode.D) {
+	objectStart := d.Pos() / 8
+
+	var objectType uint64
+	d.FieldStruct("header", func(d *decode.D) {
+		more := d.FieldBool("more")
+		objectType = d.FieldU3("type", objectTypeNames)
+		size := d.FieldU4("size_low")
+		if more {
+			size |= d.FieldUFn("size_high", readVarint) << 4
+		}
+		d.FieldValueU("size", size)
+	})
+
+	switch objectType {
+	case objectTypeOfsDelta:
+		baseOffset := d.FieldUFn("base_offset", readOffsetVarint)
+		d.FieldValueU("base_position", uint64(objectStart)-baseOffset)
+	case objectTypeRefDelta:
+		d.FieldRawLen("base_object", objectIDLen*8, scalar.RawHex)
+	}
+
+	decodeZlib(d, objectType)
+}
+
+func packDecode(d *decode.D, in interface{}) interface{} {
+	d.FieldUTF8("signature", 4, d.AssertStr("PACK"))
+	d.FieldU32("version", d.AssertU(2, 3))
+	objectCount := d.FieldU32("object_count")
+
+	d.FieldArray("objects", func(d *decode.D) {
+		for i := uint64(0); i < objectCount; i++ {
+			d.FieldStruct("object", decodeObject)
+		}
+	})
+
+	sha1W := sha1.New()
+	d.MustCopy(sha1W, d.BitBufRange(0, d.Pos()))
+	d.FieldChecksumRawLen("checksum", objectIDLen*8, "sha1", sha1W.Sum(nil), scalar.RawHex)
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package git
+
+// https://git-scm.com/docs/pack-format#_version_2_pack_idx_files_support_packs_larger_than_4_gib_and
+
+// TODO: version 1 idx files, no signature
+
+import (
+	"crypto/sha1" //nolint:gosec
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.GIT_PACK_IDX,
+		Description: "Git pack index",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte("\xfftOc")}},
+		DecodeFn:    packIdxDecode,
+	})
+}
+
+// offset has most significant bit set if it's a index into large offsets
+const largeOffsetFlag = 0x80000000
+
+func packIdxDecode(d *decode.D, in interface{}) interface{} {
+	d.FieldRawLen("signature", 4*8, d.AssertBitBuf([]byte("\xfftOc")))
+	d.FieldU32("version", d.AssertU(2))
+
+	var objectCount uint64
+	d.FieldArray("fanout", func(d *decode.D) {
+		for i := 0; i < 256; i++ {
+			objectCount = d.FieldU32("count")
+		}
+	})
+	d.FieldArray("object_ids", func(d *decode.D) {
+		for i := uint64(0); i < objectCount; i++ {
+			d.FieldRawLen("object_id", objectIDLen*8, scalar.RawHex)
+		}
+	})
+	d.FieldArray("crc32s", func(d *decode.D) {
+		for i := uint64(0); i < objectCount; i++ {
+			d.FieldU32("crc32", scalar.Hex)
+		}
+	})
+	var largeOffsetCount uint64
+	d.FieldArray("offsets", func(d *decode.D) {
+		for i := uint64(0); i < objectCount; i++ {
+			if d.FieldU32("offset")&largeOffsetFlag != 0 {
+				largeOffsetCount++
+			}
+		}
+	})
+	if largeOffsetCount > 0 {
+		d.FieldArray("large_offsets", func(d *decode.D) {
+			for i := uint64(0); i < largeOffsetCount; i++ {
+				d.FieldU64("offset")
+			}
+		})
+	}
+
+	d.FieldRawLen("pack_checksum", objectIDLen*8, scalar.RawHex)
+	sha1W := sha1.New()
+	d.MustCopy(sha1W, d.BitBufRange(0, d.Pos()))
+	d.FieldChecksumRawLen("checksum", objectIDLen*8, "sha1", sha1W.Sum(nil), scalar.RawHex)
+
+	return nil
+}
@@ -0,0 +1,315 @@
+package gvariant
+
+// https://developer.gnome.org/glib/stable/gvariant-format-strings.html
+// https://people.gnome.org/~desrt/gvariant-serialisation.pdf
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.GVARIANT,
+		Description: "GVariant serialized value",
+		DecodeFn:    gvariantDecode,
+	})
+}
+
+const maxDepth = 64
+
+type gvType struct {
+	sig     string
+	kind    byte
+	elem    *gvType
+	members []*gvType
+	align   int64
+	// zero if not fixed size
+	fixedSize int64
+}
+
+func alignUp(n int64, align int64) int64 {
+	return (n + align - 1) / align * align
+}
+
+func parseType(sig string, depth int) (*gvType, string, error) {
+	if sig == "" {
+		return nil, "", fmt.Errorf("unexpected end of signature")
+	}
+	if depth > maxDepth {
+		return nil, "", fmt.Errorf("signature nested too deep")
+	}
+
+	t := &gvType{kind: sig[0]}
+	rest := sig[1:]
+	switch t.kind {
+	case 'b', 'y':
+		t.align, t.fixedSize = 1, 1
+	case 'n', 'q':
+		t.align, t.fixedSize = 2, 2
+	case 'i', 'u', 'h':
+		t.align, t.fixedSize = 4, 4
+	case 'x', 't', 'd':
+		t.align, t.fixedSize = 8, 8
+	case 's', 'o', 'g':
+		t.align = 1
+	case 'v':
+		t.align = 8
+	case 'a', 'm':
+		elem, r, err := parseType(rest, depth+1)
+		if err != nil {
+			return nil, "", err
+		}
+		t.elem = elem
+		t.align = elem.align
+		rest = r
+	case '(', '{':
+		end := byte(')')
+		if t.kind == '{' {
+			end = '}'
+		}
+		t.align = 1
+		fixed := true
+		for {
+			if rest == "" {
+				return nil, "", fmt.Errorf("unterminated %c", t.kind)
+			}
+			if rest[0] == end {
+				rest = rest[1:]
+				break
+			}
+			m, r, err := parseType(rest, depth+1)
+			if err != nil {
+				return nil, "", err
+			}
+			t.members = append(t.members, m)
+			if m.align > t.align {
+				t.align = m.align
+			}
+			if m.fixedSize == 0 {
+				fixed = false
+			}
+			rest = r
+		}
+		if t.kind == '{' && len(t.members) != 2 {
+			return nil, "", fmt.Errorf("dict entry must have two members")
+		}
+		if fixed {
+			if len(t.members) == 0 {
+				// unit type
+				t.fixedSize = 1
+			} else {
+				n := int64(0)
+				for _, m := range t.members {
+					n = alignUp(n, m.align) + m.fixedSize
+				}
+				t.fixedSize = alignUp(n, t.align)
+			}
+		}
+	default:
+		return nil, "", fmt.Errorf("unknown type %q", t.kind)
+	}
+	t.sig = sig[:len(sig)-len(rest)]
+
+	return t, rest, nil
+}
+
+// size of framing offsets depends on size of container
+func offsetSize(n int64) int64 {
+	switch {
+	case n == 0:
+		return 0
+	case n <= 0xff:
+		return 1
+	case n <= 0xffff:
+		return 2
+	case n <= 0xffff_ffff:
+		return 4
+	default:
+		return 8
+	}
+}
+
+type decoder struct {
+	bigEndian bool
+}
+
+// framing offsets are always little endian, they are not added as fields as
+// arrays and tuples would get an extra element
+func readOffset(d *decode.D, pos int64, size int64) int64 {
+	d.SeekAbs(pos * 8)
+	return int64(d.UE(int(size)*8, decode.LittleEndian))
+}
+
+func (dr decoder) decodeTupleMembers(d *decode.D, t *gvType, start int64, end int64, names []string, depth int) {
+	osz := offsetSize(end - start)
+	offsetsEnd := end
+	pos := start
+	for i, m := range t.members {
+		pos = start + alignUp(pos-start, m.align)
+		var memberEnd int64
+		switch {
+		case m.fixedSize > 0:
+			memberEnd = pos + m.fixedSize
+		case i == len(t.members)-1:
+			memberEnd = offsetsEnd
+		default:
+			// offsets for non-fixed size members are stored backwards from the end
+			offsetsEnd -= osz
+			memberEnd = start + readOffset(d, offsetsEnd, osz)
+		}
+		name := "member"
+		if i < len(names) {
+			name = names[i]
+		}
+		dr.decodeValue(d, name, m, pos, memberEnd, depth+1)
+		pos = memberEnd
+	}
+}
+
+func (dr decoder) decodeValue(d *decode.D, name string, t *gvType, start int64, end int64, depth int) {
+	if depth > maxDepth {
+		d.Fatalf("value nested too deep")
+	}
+	if end < start {
+		d.Fatalf("invalid value range %d-%d", start, end)
+	}
+	if t.fixedSize > 0 && end-start != t.fixedSize {
+		d.Fatalf("%s: size %d, expected %d", t.sig, end-start, t.fixedSize)
+	}
+
+	var endian decode.Endian = decode.LittleEndian
+	if dr.bigEndian {
+		endian = decode.BigEndian
+	}
+
+	d.SeekAbs(start * 8)
+	switch t.kind {
+	case 'b':
+		d.FieldBoolFn(name, func(d *decode.D) bool { return d.U8() != 0 })
+	case 'y':
+		d.FieldU8(name)
+	case 'n':
+		d.FieldSFn(name, func(d *decode.D) int64 { return d.SE(16, endian) })
+	case 'q':
+		d.FieldUFn(name, func(d *decode.D) uint64 { return d.UE(16, endian) })
+	case 'i':
+		d.FieldSFn(name, func(d *decode.D) int64 { return d.SE(32, endian) })
+	case 'u':
+		d.FieldUFn(name, func(d *decode.D) uint64 { return d.UE(32, endian) })
+	case 'h':
+		d.FieldUFn(name, func(d *decode.D) uint64 { return d.UE(32, endian) }, scalar.Description("handle"))
+	case 'x':
+		d.FieldSFn(name, func(d *decode.D) int64 { return d.SE(64, endian) })
+	case 't':
+		d.FieldUFn(name, func(d *decode.D) uint64 { return d.UE(64, endian) })
+	case 'd':
+		d.FieldFFn(name, func(d *decode.D) float64 { return d.FE(64, endian) })
+	case 's', 'o', 'g':
+		// null terminated
+		if end == start {
+			d.Fatalf("%s: empty string", t.sig)
+		}
+		d.FieldUTF8NullFixedLen(name, int(end-start))
+	case 'v':
+		// value followed by zero byte and type signature
+		b := d.BytesRange(start*8, int(end-start))
+		i := bytes.LastIndexByte(b, 0)
+		if i < 0 {
+			d.Fatalf("variant without signature")
+		}
+		sig := string(b[i+1:])
+		vt, rest, err := parseType(sig, depth)
+		if err != nil || rest != "" {
+			d.Fatalf("invalid variant signature %q", sig)
+		}
+		d.FieldStruct(name, func(d *decode.D) {
+			dr.decodeValue(d, "value", vt, start, start+int64(i), depth+1)
+			d.SeekAbs((start + int64(i)) * 8)
+			d.FieldU8("separator", d.AssertU(0))
+			d.FieldUTF8("signature", len(sig))
+		})
+	case 'm':
+		switch {
+		case end == start:
+			d.FieldValueStr(name, "nothing")
+		case t.elem.fixedSize > 0:
+			dr.decodeValue(d, name, t.elem, start, end, depth+1)
+		default:
+			// variable size element has a trailing zero byte
+			dr.decodeValue(d, name, t.elem, start, end-1, depth+1)
+		}
+	case 'a':
+		elemName := "element"
+		if t.elem.kind == '{' {
+			elemName = "entry"
+		}
+		if t.elem.kind == 'y' {
+			d.FieldRawLen(name, (end-start)*8, scalar.RawHex)
+			return
+		}
+		d.FieldArray(name, func(d *decode.D) {
+			if t.elem.fixedSize > 0 {
+				if (end-start)%t.elem.fixedSize != 0 {
+					d.Fatalf("%s: size %d not multiple of element size %d", t.sig, end-start, t.elem.fixedSize)
+				}
+				for pos := start; pos < end; pos += t.elem.fixedSize {
+					dr.decodeValue(d, elemName, t.elem, pos, pos+t.elem.fixedSize, depth+1)
+				}
+				return
+			}
+			if end == start {
+				return
+			}
+			osz := offsetSize(end - start)
+			offsetsStart := start + readOffset(d, end-osz, osz)
+			if offsetsStart < start || offsetsStart > end || (end-offsetsStart)%osz != 0 {
+				d.Fatalf("%s: invalid framing offset", t.sig)
+			}
+			n := (end - offsetsStart) / osz
+			pos := start
+			for i := int64(0); i < n; i++ {
+				elemEnd := start + readOffset(d, offsetsStart+i*osz, osz)
+				pos = start + alignUp(pos-start, t.elem.align)
+				dr.decodeValue(d, elemName, t.elem, pos, elemEnd, depth+1)
+				pos = elemEnd
+			}
+		})
+	case '(':
+		// tuples are positional
+		d.FieldArray(name, func(d *decode.D) { dr.decodeTupleMembers(d, t, start, end, nil, depth) })
+	case '{':
+		d.FieldStruct(name, func(d *decode.D) { dr.decodeTupleMembers(d, t, start, end, []string{"key", "value"}, depth) })
+	}
+}
+
+func gvariantDecode(d *decode.D, in interface{}) interface{} {
+	gi, _ := in.(format.GVariantIn)
+	sig := gi.Signature
+	if sig == "" {
+		sig = "v"
+	}
+	t, rest, err := parseType(sig, 0)
+	if err != nil || rest != "" {
+		d.Fatalf("invalid signature %q", sig)
+	}
+
+	dr := decoder{bigEndian: gi.BigEndian}
+	start := d.Pos() / 8
+	end := start + d.BitsLeft()/8
+
+	if len(gi.Names) > 0 && t.kind == '(' {
+		// decode top level tuple as a struct using names
+		dr.decodeTupleMembers(d, t, start, end, gi.Names, 0)
+	} else {
+		dr.decodeValue(d, "value", t, start, end, 0)
+	}
+	d.SeekAbs(end * 8)
+
+	return nil
+}
@@ -22,6 +22,7 @@ func init() {
 		Name:        format.GZIP,
 		Description: "gzip compression",
 		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte{0x1f, 0x8b}}},
 		DecodeFn:    gzDecode,
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.PROBE}, Group: &probeFormat},
@@ -115,7 +116,7 @@ func gzDecode(d *decode.D, in interface{}) interface{} {
 			d.FieldRawLen("compressed", readCompressedSize)
 			crc32W := crc32.NewIEEE()
 			d.MustCopy(crc32W, uncompressedBB.Clone())
-			d.FieldU32("crc32", d.ValidateUBytes(crc32W.Sum(nil)), scalar.Hex)
+			d.FieldChecksumU("crc32", 32, "crc32", uint64(crc32W.Sum32()), scalar.Hex)
 			d.FieldU32("isize")
 		}
 	}
@@ -0,0 +1,191 @@
+package http2
+
+// https://datatracker.ietf.org/doc/html/rfc7541
+
+import (
+	"strings"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+const hpackDefaultMaxSize = 4096
+
+// entry size is name and value length plus 32 bytes overhead
+const hpackEntryOverhead = 32
+
+var (
+	hpackIndexedNames           = scalar.UToSymStr{0b1: "indexed"}
+	hpackIncrementalNames       = scalar.UToSymStr{0b01: "literal_incremental_indexing"}
+	hpackSizeUpdateNames        = scalar.UToSymStr{0b001: "dynamic_table_size_update"}
+	hpackWithoutIndexingNames   = scalar.UToSymStr{0b0000: "literal_without_indexing"}
+	hpackNeverIndexedNames      = scalar.UToSymStr{0b0001: "literal_never_indexed"}
+	hpackHuffmanSymbolByLenCode = func() map[[2]uint32]int {
+		m := map[[2]uint32]int{}
+		for sym, c := range hpackHuffmanCodes {
+			m[[2]uint32{uint32(c.bits), c.code}] = sym
+		}
+		return m
+	}()
+)
+
+const hpackHuffmanEOS = 256
+
+// decoding state for one direction of a connection
+type hpackDecoder struct {
+	// newest entry first
+	dynamicTable []hpackHeaderField
+	size         int
+	maxSize      int
+}
+
+func newHPACKDecoder() *hpackDecoder {
+	return &hpackDecoder{maxSize: hpackDefaultMaxSize}
+}
+
+func (hd *hpackDecoder) evict() {
+	for hd.size > hd.maxSize && len(hd.dynamicTable) > 0 {
+		last := hd.dynamicTable[len(hd.dynamicTable)-1]
+		hd.size -= len(last.name) + len(last.value) + hpackEntryOverhead
+		hd.dynamicTable = hd.dynamicTable[:len(hd.dynamicTable)-1]
+	}
+}
+
+func (hd *hpackDecoder) add(f hpackHeaderField) {
+	hd.dynamicTable = append([]hpackHeaderField{f}, hd.dynamicTable...)
+	hd.size += len(f.name) + len(f.value) + hpackEntryOverhead
+	hd.evict()
+}
+
+// static table is index 1-61 followed by dynamic table, ok is false if index is
+// unknown, ex: capture started mid connection
+func (hd *hpackDecoder) lookup(index uint64) (hpackHeaderField, bool) {
+	if index == 0 {
+		return hpackHeaderField{}, false
+	}
+	if index < uint64(len(hpackStaticTable)) {
+		return hpackStaticTable[index], true
+	}
+	index -= uint64(len(hpackStaticTable))
+	if index < uint64(len(hd.dynamicTable)) {
+		return hd.dynamicTable[index], true
+	}
+	return hpackHeaderField{}, false
+}
+
+// integer with prefixBits prefix and continuation bytes
+func hpackInt(prefixBits int) func(d *decode.D) uint64 {
+	return func(d *decode.D) uint64 {
+		max := uint64(1)<<prefixBits - 1
+		v := d.U(prefixBits)
+		if v < max {
+			return v
+		}
+		for shift := 0; ; shift += 7 {
+			if shift > 56 {
+				d.Fatalf("integer overflow")
+			}
+			b := d.U8()
+			v += (b & 0x7f) << shift
+			if b&0x80 == 0 {
+				break
+			}
+		}
+		return v
+	}
+}
+
+func hpackHuffmanDecode(d *decode.D, b []byte) string {
+	var sb strings.Builder
+	var code uint32
+	var bits uint32
+	for _, c := range b {
+		for i := 7; i >= 0; i-- {
+			code = code<<1 | uint32(c>>i&1)
+			bits++
+			sym, ok := hpackHuffmanSymbolByLenCode[[2]uint32{bits, code}]
+			if !ok {
+				if bits > 30 {
+					d.Fatalf("invalid huffman code")
+				}
+				continue
+			}
+			if sym == hpackHuffmanEOS {
+				d.Fatalf("huffman EOS in string")
+			}
+			sb.WriteByte(byte(sym))
+			code, bits = 0, 0
+		}
+	}
+	// padding is most significant bits of EOS, all ones
+	if bits > 7 || code != 1<<bits-1 {
+		d.Fatalf("invalid huffman padding")
+	}
+	return sb.String()
+}
+
+func fieldHPACKString(d *decode.D, name string) string {
+	huffman := d.FieldBool(name + "_huffman")
+	length := d.FieldUFn(name+"_length", hpackInt(7))
+	if length > uint64(d.BitsLeft()/8) {
+		d.Fatalf("string length %d larger than input", length)
+	}
+	if huffman {
+		return d.FieldStrFn(name, func(d *decode.D) string {
+			return hpackHuffmanDecode(d, d.BytesLen(int(length)))
+		})
+	}
+	return d.FieldUTF8(name, int(length))
+}
+
+func (hd *hpackDecoder) decodeField(d *decode.D) {
+	b := d.PeekBits(8)
+	switch {
+	case b&0x80 != 0:
+		d.FieldU1("representation", hpackIndexedNames)
+		index := d.FieldUFn("index", hpackInt(7))
+		if f, ok := hd.lookup(index); ok {
+			d.FieldValueStr("name", f.name)
+			d.FieldValueStr("value", f.value)
+		}
+		return
+	case b&0xe0 == 0x20:
+		d.FieldU3("representation", hpackSizeUpdateNames)
+		hd.maxSize = int(d.FieldUFn("max_size", hpackInt(5)))
+		hd.evict()
+		return
+	}
+
+	incremental := false
+	prefixBits := 4
+	switch {
+	case b&0xc0 == 0x40:
+		d.FieldU2("representation", hpackIncrementalNames)
+		incremental = true
+		prefixBits = 6
+	case b&0xf0 == 0x10:
+		d.FieldU4("representation", hpackNeverIndexedNames)
+	default:
+		d.FieldU4("representation", hpackWithoutIndexingNames)
+	}
+
+	var f hpackHeaderField
+	nameIndex := d.FieldUFn("name_index", hpackInt(prefixBits))
+	if nameIndex == 0 {
+		f.name = fieldHPACKString(d, "name")
+	} else {
+		if nf, ok := hd.lookup(nameIndex); ok {
+			f.name = nf.name
+			d.FieldValueStr("name", f.name)
+		}
+	}
+	f.value = fieldHPACKString(d, "value")
+
+	if incremental {
+		hd.add(f)
+	}
+}
+
+func (hd *hpackDecoder) decodeHeaderBlock(d *decode.D) {
+	d.FieldStructArrayLoop("fields", "field", d.NotEnd, hd.decodeField)
+}
@@ -0,0 +1,241 @@
+package http2
+
+// https://datatracker.ietf.org/doc/html/rfc7540
+// https://www.iana.org/assignments/http2-parameters/http2-parameters.xhtml
+
+// TODO: h2c upgrade from HTTP/1.1
+
+import (
+	"fmt"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.HTTP2,
+		Description: "HTTP/2 frames",
+		Groups:      []string{format.TCP_STREAM},
+		DecodeFn:    http2Decode,
+	})
+}
+
+const clientPreface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+const frameHeaderLength = 9
+
+const (
+	frameTypeData         = 0x0
+	frameTypeHeaders      = 0x1
+	frameTypePriority     = 0x2
+	frameTypeRSTStream    = 0x3
+	frameTypeSettings     = 0x4
+	frameTypePushPromise  = 0x5
+	frameTypePing         = 0x6
+	frameTypeGoAway       = 0x7
+	frameTypeWindowUpdate = 0x8
+	frameTypeContinuation = 0x9
+)
+
+var frameTypeNames = scalar.UToSymStr{
+	frameTypeData:         "data",
+	frameTypeHeaders:      "headers",
+	frameTypePriority:     "priority",
+	frameTypeRSTStream:    "rst_stream",
+	frameTypeSettings:     "settings",
+	frameTypePushPromise:  "push_promise",
+	frameTypePing:         "ping",
+	frameTypeGoAway:       "goaway",
+	frameTypeWindowUpdate: "window_update",
+	frameTypeContinuation: "continuation",
+	0xa:                   "altsvc",
+	0xc:                   "origin",
+}
+
+const (
+	flagEndHeaders = 0x04
+	flagPadded     = 0x08
+	flagPriority   = 0x20
+)
+
+// flag names for each bit, most significant first
+var frameFlagNames = map[uint64][8]string{
+	frameTypeData:         {4: "padded", 7: "end_stream"},
+	frameTypeHeaders:      {2: "priority", 4: "padded", 5: "end_headers", 7: "end_stream"},
+	frameTypeSettings:     {7: "ack"},
+	frameTypePushPromise:  {4: "padded", 5: "end_headers"},
+	frameTypePing:         {7: "ack"},
+	frameTypeContinuation: {5: "end_headers"},
+}
+
+var settingsNames = scalar.UToSymStr{
+	0x1: "header_table_size",
+	0x2: "enable_push",
+	0x3: "max_concurrent_streams",
+	0x4: "initial_window_size",
+	0x5: "max_frame_size",
+	0x6: "max_header_list_size",
+	0x8: "enable_connect_protocol", // RFC 8441
+	0x9: "no_rfc7540_priorities",   // RFC 9218
+}
+
+var errorCodeNames = scalar.UToSymStr{
+	0x0: "no_error",
+	0x1: "protocol_error",
+	0x2: "internal_error",
+	0x3: "flow_control_error",
+	0x4: "settings_timeout",
+	0x5: "stream_closed",
+	0x6: "frame_size_error",
+	0x7: "refused_stream",
+	0x8: "cancel",
+	0x9: "compression_error",
+	0xa: "connect_error",
+	0xb: "enhance_your_calm",
+	0xc: "inadequate_security",
+	0xd: "http_1_1_required",
+}
+
+type http2Decoder struct {
+	hpack *hpackDecoder
+	// header block fragments waiting for a frame with end_headers
+	headerBlock []byte
+}
+
+func (hd *http2Decoder) fieldHeaderBlockFragment(d *decode.D, nBytes int64, endHeaders bool) {
+	if endHeaders && len(hd.headerBlock) == 0 {
+		d.FieldStruct("header_block", func(d *decode.D) {
+			d.LenFn(nBytes*8, hd.hpack.decodeHeaderBlock)
+		})
+		return
+	}
+
+	hd.headerBlock = append(hd.headerBlock, d.PeekBytes(int(nBytes))...)
+	d.FieldRawLen("header_block_fragment", nBytes*8)
+	if endHeaders {
+		bb := bitio.NewBufferFromBytes(hd.headerBlock, -1)
+		d.FieldStructRootBitBufFn("reassembled_header_block", bb, hd.hpack.decodeHeaderBlock)
+		hd.headerBlock = nil
+	}
+}
+
+func fieldPriority(d *decode.D) {
+	d.FieldBool("exclusive")
+	d.FieldU31("stream_dependency")
+	d.FieldU8("weight")
+}
+
+// padded frames have pad length first and padding last
+func fieldPadded(d *decode.D, padded bool, fn func(d *decode.D, nBytes int64)) {
+	padLength := uint64(0)
+	if padded {
+		padLength = d.FieldU8("pad_length")
+	}
+	fn(d, d.BitsLeft()/8-int64(padLength))
+	if padLength > 0 {
+		d.FieldRawLen("padding", int64(padLength)*8)
+	}
+}
+
+func (hd *http2Decoder) decodeFrame(d *decode.D) {
+	length := d.FieldU24("length")
+	typ := d.FieldU8("type", frameTypeNames)
+	flags := d.PeekBits(8)
+	d.FieldStruct("flags", func(d *decode.D) {
+		names := frameFlagNames[typ]
+		for i := 0; i < 8; {
+			if names[i] != "" {
+				d.FieldBool(names[i])
+				i++
+				continue
+			}
+			n := 1
+			for i+n < 8 && names[i+n] == "" {
+				n++
+			}
+			d.FieldU(fmt.Sprintf("unused%d", i), n)
+			i += n
+		}
+	})
+	d.FieldU1("reserved")
+	d.FieldU31("stream_id")
+
+	padded := flags&flagPadded != 0
+	endHeaders := flags&flagEndHeaders != 0
+
+	d.LenFn(int64(length)*8, func(d *decode.D) {
+		switch typ {
+		case frameTypeData:
+			fieldPadded(d, padded, func(d *decode.D, nBytes int64) {
+				d.FieldRawLen("data", nBytes*8)
+			})
+		case frameTypeHeaders:
+			fieldPadded(d, padded, func(d *decode.D, nBytes int64) {
+				if flags&flagPriority != 0 {
+					fieldPriority(d)
+					nBytes -= 5
+				}
+				hd.fieldHeaderBlockFragment(d, nBytes, endHeaders)
+			})
+		case frameTypePriority:
+			fieldPriority(d)
+		case frameTypeRSTStream:
+			d.FieldU32("error_code", errorCodeNames)
+		case frameTypeSettings:
+			d.FieldStructArrayLoop("settings", "setting", d.NotEnd, func(d *decode.D) {
+				d.FieldU16("identifier", settingsNames)
+				d.FieldU32("value")
+			})
+		case frameTypePushPromise:
+			fieldPadded(d, padded, func(d *decode.D, nBytes int64) {
+				d.FieldU1("reserved1")
+				d.FieldU31("promised_stream_id")
+				hd.fieldHeaderBlockFragment(d, nBytes-4, endHeaders)
+			})
+		case frameTypePing:
+			d.FieldRawLen("opaque_data", 8*8)
+		case frameTypeGoAway:
+			d.FieldU1("reserved1")
+			d.FieldU31("last_stream_id")
+			d.FieldU32("error_code", errorCodeNames)
+			if d.NotEnd() {
+				d.FieldUTF8("additional_debug_data", int(d.BitsLeft()/8))
+			}
+		case frameTypeWindowUpdate:
+			d.FieldU1("reserved1")
+			d.FieldU31("window_size_increment")
+		case frameTypeContinuation:
+			hd.fieldHeaderBlockFragment(d, d.BitsLeft()/8, endHeaders)
+		default:
+			d.FieldRawLen("payload", d.BitsLeft())
+		}
+	})
+}
+
+func http2Decode(d *decode.D, in interface{}) interface{} {
+	// client sends preface and server starts with a settings frame
+	hasPreface := d.BitsLeft() >= int64(len(clientPreface))*8 &&
+		string(d.PeekBytes(len(clientPreface))) == clientPreface
+	if hasPreface {
+		d.FieldUTF8("preface", len(clientPreface))
+	} else {
+		if d.BitsLeft() < frameHeaderLength*8 {
+			d.Fatalf("too short")
+		}
+		header := d.PeekBytes(frameHeaderLength)
+		length := int(header[0])<<16 | int(header[1])<<8 | int(header[2])
+		streamID := int(header[5]&0x7f)<<24 | int(header[6])<<16 | int(header[7])<<8 | int(header[8])
+		if header[3] != frameTypeSettings || length%6 != 0 || streamID != 0 {
+			d.Fatalf("no preface or settings frame")
+		}
+	}
+
+	hd := &http2Decoder{hpack: newHPACKDecoder()}
+	d.FieldStructArrayLoop("frames", "frame", d.NotEnd, hd.decodeFrame)
+
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/wader/fq/format/registry"
 	"github.com/wader/fq/internal/num"
 	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
 )
 
 func init() {
@@ -18,21 +19,127 @@ func init() {
 	})
 }
 
+// s15Fixed16Number
+func fieldS15Fixed16(d *decode.D, name string) float64 {
+	return d.FieldFFn(name, func(d *decode.D) float64 { return float64(d.S32()) / 65536 })
+}
+
+func fieldXYZNumber(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		fieldS15Fixed16(d, "X")
+		fieldS15Fixed16(d, "Y")
+		fieldS15Fixed16(d, "Z")
+	})
+}
+
 func xyzType(_ int64, d *decode.D) {
-	d.FieldFP32("X")
-	d.FieldFP32("Y")
-	d.FieldFP32("Z")
+	// usually one XYZ number but can be an array
+	if d.BitsLeft() == 12*8 {
+		fieldS15Fixed16(d, "X")
+		fieldS15Fixed16(d, "Y")
+		fieldS15Fixed16(d, "Z")
+		return
+	}
+	d.FieldArray("values", func(d *decode.D) {
+		for d.BitsLeft() >= 12*8 {
+			fieldXYZNumber(d, "value")
+		}
+	})
 }
 
 func textType(_ int64, d *decode.D) {
 	d.FieldUTF8NullFixedLen("text", int(d.BitsLeft()/8))
 }
 
+func curvType(_ int64, d *decode.D) {
+	count := d.FieldU32("count")
+	switch count {
+	case 0:
+		// identity response
+	case 1:
+		d.FieldFP16("gamma")
+	default:
+		d.FieldArray("values", func(d *decode.D) {
+			for i := uint64(0); i < count; i++ {
+				d.FieldU16("value")
+			}
+		})
+	}
+}
+
+var paraFunctionTypeParameters = map[uint64][]string{
+	0: {"g"},
+	1: {"g", "a", "b"},
+	2: {"g", "a", "b", "c"},
+	3: {"g", "a", "b", "c", "d"},
+	4: {"g", "a", "b", "c", "d", "e", "f"},
+}
+
+var paraFunctionTypeNames = scalar.UToScalar{
+	0: {Description: "Y = X^g"},
+	1: {Description: "Y = (aX+b)^g if X >= -b/a, 0 otherwise"},
+	2: {Description: "Y = (aX+b)^g+c if X >= -b/a, c otherwise"},
+	3: {Description: "Y = (aX+b)^g if X >= d, cX otherwise"},
+	4: {Description: "Y = (aX+b)^g+e if X >= d, cX+f otherwise"},
+}
+
 func paraType(_ int64, d *decode.D) {
-	d.FieldU32("reserved0")
-	d.FieldU16("function_type")
+	functionType := d.FieldU16("function_type", paraFunctionTypeNames)
 	d.FieldU16("reserved1")
-	d.FieldRawLen("parameters", d.BitsLeft())
+	parameters, ok := paraFunctionTypeParameters[functionType]
+	if !ok {
+		d.FieldRawLen("parameters", d.BitsLeft())
+		return
+	}
+	d.FieldStruct("parameters", func(d *decode.D) {
+		for _, p := range parameters {
+			fieldS15Fixed16(d, p)
+		}
+	})
+}
+
+func sf32Type(_ int64, d *decode.D) {
+	d.FieldArray("values", func(d *decode.D) {
+		for d.BitsLeft() >= 32 {
+			fieldS15Fixed16(d, "value")
+		}
+	})
+}
+
+func sigType(_ int64, d *decode.D) {
+	d.FieldUTF8NullFixedLen("value", 4)
+}
+
+var measurementObserverNames = scalar.UToSymStr{
+	0: "unknown",
+	1: "cie_1931",
+	2: "cie_1964",
+}
+
+var measurementGeometryNames = scalar.UToSymStr{
+	0: "unknown",
+	1: "0_45_or_45_0",
+	2: "0_d_or_d_0",
+}
+
+var measurementIlluminantNames = scalar.UToSymStr{
+	0: "unknown",
+	1: "d50",
+	2: "d65",
+	3: "d93",
+	4: "f2",
+	5: "d55",
+	6: "a",
+	7: "equi_power",
+	8: "f8",
+}
+
+func measType(_ int64, d *decode.D) {
+	d.FieldU32("observer", measurementObserverNames)
+	fieldXYZNumber(d, "backing")
+	d.FieldU32("geometry", measurementGeometryNames)
+	d.FieldFP32("flare")
+	d.FieldU32("illuminant", measurementIlluminantNames)
 }
 
 func descType(_ int64, d *decode.D) {
@@ -62,7 +169,7 @@ func multiLocalizedUnicodeType(tagStart int64, d *decode.D) {
 			})
 			recordPadding := int64(recordSize) - 2 - 2 - 4 - 4
 			if recordPadding > 0 {
-				d.FieldRawLen("padding", recordPadding)
+				d.FieldRawLen("padding", recordPadding*8)
 			}
 		}
 	})
@@ -71,11 +178,76 @@ func multiLocalizedUnicodeType(tagStart int64, d *decode.D) {
 var typeToDecode = map[string]func(tagStart int64, d *decode.D){
 	"XYZ ": xyzType,
 	"text": textType,
+	"curv": curvType,
 	"para": paraType,
+	"sf32": sf32Type,
+	"sig ": sigType,
+	"meas": measType,
 	"desc": descType,
 	"mluc": multiLocalizedUnicodeType,
 }
 
+var deviceClassNames = scalar.StrToScalar{
+	"scnr": {Description: "Input device"},
+	"mntr": {Description: "Display device"},
+	"prtr": {Description: "Output device"},
+	"link": {Description: "Device link"},
+	"spac": {Description: "Color space conversion"},
+	"abst": {Description: "Abstract"},
+	"nmcl": {Description: "Named color"},
+}
+
+var primaryPlatformNames = scalar.StrToScalar{
+	"APPL": {Description: "Apple Computer, Inc."},
+	"MSFT": {Description: "Microsoft Corporation"},
+	"SGI ": {Description: "Silicon Graphics, Inc."},
+	"SUNW": {Description: "Sun Microsystems, Inc."},
+	"TGNT": {Description: "Taligent, Inc."},
+}
+
+var renderingIntentNames = scalar.UToSymStr{
+	0: "perceptual",
+	1: "media_relative_colorimetric",
+	2: "saturation",
+	3: "icc_absolute_colorimetric",
+}
+
+var tagSignatureNames = scalar.StrToScalar{
+	"A2B0": {Description: "AToB0"},
+	"A2B1": {Description: "AToB1"},
+	"A2B2": {Description: "AToB2"},
+	"B2A0": {Description: "BToA0"},
+	"B2A1": {Description: "BToA1"},
+	"B2A2": {Description: "BToA2"},
+	"bXYZ": {Description: "Blue matrix column"},
+	"bTRC": {Description: "Blue tone reproduction curve"},
+	"bkpt": {Description: "Media black point"},
+	"calt": {Description: "Calibration date time"},
+	"chad": {Description: "Chromatic adaptation"},
+	"chrm": {Description: "Chromaticity"},
+	"cprt": {Description: "Copyright"},
+	"desc": {Description: "Profile description"},
+	"dmdd": {Description: "Device model description"},
+	"dmnd": {Description: "Device manufacturer description"},
+	"gXYZ": {Description: "Green matrix column"},
+	"gTRC": {Description: "Green tone reproduction curve"},
+	"gamt": {Description: "Gamut"},
+	"kTRC": {Description: "Gray tone reproduction curve"},
+	"lumi": {Description: "Luminance"},
+	"meas": {Description: "Measurement"},
+	"ncl2": {Description: "Named color 2"},
+	"pre0": {Description: "Preview 0"},
+	"pre1": {Description: "Preview 1"},
+	"pre2": {Description: "Preview 2"},
+	"rXYZ": {Description: "Red matrix column"},
+	"rTRC": {Description: "Red tone reproduction curve"},
+	"targ": {Description: "Characterization target"},
+	"tech": {Description: "Technology"},
+	"view": {Description: "Viewing conditions"},
+	"vued": {Description: "Viewing conditions description"},
+	"wtpt": {Description: "Media white point"},
+}
+
 func decodeBCDU8(d *decode.D) uint64 {
 	n := d.U8()
 	return (n>>4)*10 + n&0xf
@@ -111,10 +283,11 @@ func iccProfileDecode(d *decode.D, in interface{}) interface{} {
 		d.FieldStruct("header", func(d *decode.D) {
 			d.FieldU32("size")
 			d.FieldUTF8NullFixedLen("cmm_type_signature", 4)
-			d.FieldUFn("version_major", decodeBCDU8)
-			d.FieldUFn("version_minor", decodeBCDU8)
+			d.FieldU8("version_major")
+			d.FieldU4("version_minor")
+			d.FieldU4("version_bug_fix")
 			d.FieldU16("version_reserved")
-			d.FieldUTF8NullFixedLen("device_class_signature", 4)
+			d.FieldUTF8NullFixedLen("device_class_signature", 4, deviceClassNames)
 			d.FieldUTF8NullFixedLen("color_space", 4)
 			d.FieldUTF8NullFixedLen("connection_space", 4)
 			d.FieldStruct("timestamp", func(d *decode.D) {
@@ -126,16 +299,28 @@ func iccProfileDecode(d *decode.D, in interface{}) interface{} {
 				d.FieldU16("seconds")
 
 			})
-			d.FieldUTF8NullFixedLen("file_signature", 4)
-			d.FieldUTF8NullFixedLen("primary_platform", 4)
-			d.FieldU32("flags")
+			d.FieldUTF8NullFixedLen("file_signature", 4, d.AssertStr("acsp"))
+			d.FieldUTF8NullFixedLen("primary_platform", 4, primaryPlatformNames)
+			d.FieldStruct("flags", func(d *decode.D) {
+				d.FieldU16("vendor")
+				d.FieldU14("reserved")
+				d.FieldBool("not_independent")
+				d.FieldBool("embedded")
+			})
 			d.FieldUTF8NullFixedLen("device_manufacturer", 4)
 			d.FieldUTF8NullFixedLen("device_model", 4)
-			d.FieldUTF8NullFixedLen("device_attribute", 8)
-			d.FieldUTF8NullFixedLen("render_intent", 4)
-			d.FieldUTF8NullFixedLen("xyz_illuminant", 12)
+			d.FieldStruct("device_attributes", func(d *decode.D) {
+				d.FieldU32("vendor")
+				d.FieldU28("reserved")
+				d.FieldBool("black_and_white")
+				d.FieldBool("negative")
+				d.FieldBool("matte")
+				d.FieldBool("transparency")
+			})
+			d.FieldU32("rendering_intent", renderingIntentNames)
+			fieldXYZNumber(d, "illuminant")
 			d.FieldUTF8NullFixedLen("profile_creator_signature", 4)
-			d.FieldUTF8NullFixedLen("profile_id", 16)
+			d.FieldRawLen("profile_id", 16*8)
 			d.FieldRawLen("reserved", 28*8, d.BitBufIsZero())
 		})
 
@@ -144,7 +329,7 @@ func iccProfileDecode(d *decode.D, in interface{}) interface{} {
 			d.FieldArray("table", func(d *decode.D) {
 				for i := uint64(0); i < tagCount; i++ {
 					d.FieldStruct("element", func(d *decode.D) {
-						d.FieldUTF8NullFixedLen("signature", 4)
+						d.FieldUTF8NullFixedLen("signature", 4, tagSignatureNames)
 						offset := d.FieldU32("offset")
 						size := d.FieldU32("size")
 
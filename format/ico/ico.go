@@ -0,0 +1,100 @@
+package ico
+
+// https://docs.microsoft.com/en-us/previous-versions/ms997538(v=msdn.10)
+// https://en.wikipedia.org/wiki/ICO_(file_format)
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var imageFormat decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.ICO,
+		Description: "Windows icon and cursor",
+		Groups:      []string{format.PROBE, format.IMAGE},
+		Magic: []decode.Magic{
+			// reserved zero and type 1 or 2, little endian
+			{Bytes: []byte{0x00, 0x00, 0x00, 0x00}, Mask: []byte{0xff, 0xff, 0xfc, 0xff}},
+		},
+		DecodeFn: icoDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.PNG, format.BMP}, Group: &imageFormat},
+		},
+	})
+}
+
+const (
+	typeIcon   = 1
+	typeCursor = 2
+)
+
+var typeNames = scalar.UToSymStr{
+	typeIcon:   "icon",
+	typeCursor: "cursor",
+}
+
+const headerLen = 6
+const entryLen = 16
+
+// 0 means 256 pixels
+var sizeMap = scalar.UToScalar{0: {Description: "256"}}
+
+func icoDecode(d *decode.D, in interface{}) interface{} {
+	d.Endian = decode.LittleEndian
+
+	d.FieldU16("reserved", d.AssertU(0))
+	typ := d.FieldU16("type", typeNames, d.AssertU(typeIcon, typeCursor))
+	count := d.FieldU16("count")
+	if count == 0 {
+		d.Fatalf("no images")
+	}
+
+	type entry struct {
+		offset int64
+		size   int64
+	}
+	var entries []entry
+
+	fileLen := d.Len()
+	d.FieldArray("entries", func(d *decode.D) {
+		for i := uint64(0); i < count; i++ {
+			d.FieldStruct("entry", func(d *decode.D) {
+				d.FieldU8("width", sizeMap)
+				d.FieldU8("height", sizeMap)
+				d.FieldU8("color_count")
+				d.FieldU8("reserved")
+				if typ == typeCursor {
+					d.FieldU16("hotspot_x")
+					d.FieldU16("hotspot_y")
+				} else {
+					d.FieldU16("planes")
+					d.FieldU16("bit_count")
+				}
+				size := int64(d.FieldU32("size"))
+				offset := int64(d.FieldU32("offset"))
+				if offset < headerLen+int64(count)*entryLen || (offset+size)*8 > fileLen {
+					d.Fatalf("image outside file")
+				}
+				entries = append(entries, entry{offset: offset, size: size})
+			})
+		}
+	})
+
+	d.FieldArray("images", func(d *decode.D) {
+		for _, e := range entries {
+			dv, _, _ := d.TryFieldFormatRange("image", e.offset*8, e.size*8, imageFormat, format.BMPIn{Icon: true})
+			if dv == nil {
+				d.RangeFn(e.offset*8, e.size*8, func(d *decode.D) {
+					d.FieldRawLen("image", d.BitsLeft())
+				})
+			}
+		}
+	})
+
+	return nil
+}
@@ -7,8 +7,6 @@ import (
 	"github.com/wader/fq/pkg/scalar"
 )
 
-// TODO: comment 28 long, zero byte, track number
-
 func init() {
 	registry.MustRegister(decode.Format{
 		Name:        format.ID3V1,
@@ -22,13 +20,21 @@ func id3v1Decode(d *decode.D, in interface{}) interface{} {
 	d.AssertAtLeastBitsLeft(128 * 8)
 	d.FieldUTF8("magic", 3, d.AssertStr("TAG"))
 	if d.PeekBits(8) == uint64('+') {
-		d.Errorf("looks like id3v11")
+		d.Errorf("looks like enhanced tag")
 	}
 	d.FieldUTF8NullFixedLen("song_name", 30)
 	d.FieldUTF8NullFixedLen("artist", 30)
 	d.FieldUTF8NullFixedLen("album_name", 30)
 	d.FieldUTF8NullFixedLen("year", 4)
-	d.FieldUTF8NullFixedLen("comment", 30)
+	// ID3v1.1 uses the last two comment bytes for a zero byte and a track number
+	commentEnd := d.PeekBytes(30)[28:]
+	if commentEnd[0] == 0 && commentEnd[1] != 0 {
+		d.FieldUTF8NullFixedLen("comment", 28)
+		d.FieldU8("zero", d.AssertU(0))
+		d.FieldU8("track")
+	} else {
+		d.FieldUTF8NullFixedLen("comment", 30)
+	}
 	// from https://en.wikipedia.org/wiki/List_of_ID3v1_Genres
 	d.FieldU8("genre", scalar.UToSymStr{
 		0:   "Blues",
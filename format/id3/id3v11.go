@@ -1,5 +1,8 @@
 package id3
 
+// Enhanced TAG, placed directly before a ID3v1 tag
+// https://en.wikipedia.org/wiki/ID3#Enhanced_tag
+
 import (
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/registry"
@@ -10,17 +13,19 @@ import (
 func init() {
 	registry.MustRegister(decode.Format{
 		Name:        format.ID3V11,
-		Description: "ID3v1.1 metadata",
+		Description: "ID3v1 Enhanced TAG metadata",
 		DecodeFn:    id3v11Decode,
 	})
 }
 
+const enhancedTagLen = 227
+
 func id3v11Decode(d *decode.D, in interface{}) interface{} {
-	d.AssertAtLeastBitsLeft(128 * 8)
+	d.AssertAtLeastBitsLeft(enhancedTagLen * 8)
 	d.FieldUTF8("magic", 4, d.AssertStr("TAG+"))
-	d.FieldUTF8("title", 60)
-	d.FieldUTF8("artist", 60)
-	d.FieldUTF8("album", 60)
+	d.FieldUTF8NullFixedLen("title", 60)
+	d.FieldUTF8NullFixedLen("artist", 60)
+	d.FieldUTF8NullFixedLen("album", 60)
 	d.FieldU8("speed", scalar.UToSymStr{
 		0: "unset",
 		1: "slow",
@@ -28,9 +33,10 @@ func id3v11Decode(d *decode.D, in interface{}) interface{} {
 		3: "fast",
 		4: "hardcore",
 	})
-	d.FieldUTF8("genre", 30)
-	d.FieldUTF8("start", 6)
-	d.FieldUTF8("stop", 6)
+	d.FieldUTF8NullFixedLen("genre", 30)
+	// mmm:ss
+	d.FieldUTF8NullFixedLen("start", 6)
+	d.FieldUTF8NullFixedLen("stop", 6)
 
 	return nil
 }
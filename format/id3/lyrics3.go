@@ -0,0 +1,83 @@
+package id3
+
+// Lyrics3 v1 and v2, placed directly before a ID3v1 tag
+// https://id3.org/Lyrics3
+// https://id3.org/Lyrics3v2
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.LYRICS3,
+		Description: "Lyrics3 v1/v2 tag",
+		DecodeFn:    lyrics3Decode,
+	})
+}
+
+const (
+	lyrics3BeginMagic = "LYRICSBEGIN"
+	lyrics3V1EndMagic = "LYRICSEND"
+	lyrics3V2EndMagic = "LYRICS200"
+	// v2 tag ends with 6 digit size and end magic
+	lyrics3V2TrailerLen = 6 + 9
+)
+
+var lyrics3FieldNames = scalar.StrToScalar{
+	"IND": {Description: "Indications"},
+	"LYR": {Description: "Lyrics"},
+	"INF": {Description: "Additional information"},
+	"AUT": {Description: "Lyrics author"},
+	"EAL": {Description: "Extended album name"},
+	"EAR": {Description: "Extended artist name"},
+	"ETT": {Description: "Extended track title"},
+	"IMG": {Description: "Links to image files"},
+}
+
+var mapDecStrToSymU = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	n, err := strconv.ParseUint(s.ActualStr(), 10, 64)
+	if err != nil {
+		return s, err
+	}
+	s.Sym = n
+	return s, nil
+})
+
+func lyrics3Decode(d *decode.D, in interface{}) interface{} {
+	d.AssertAtLeastBitsLeft(int64(len(lyrics3BeginMagic)+len(lyrics3V1EndMagic)) * 8)
+	d.FieldUTF8("magic", len(lyrics3BeginMagic), d.AssertStr(lyrics3BeginMagic))
+
+	endMagic := string(d.BytesRange(d.Len()-int64(len(lyrics3V1EndMagic))*8, len(lyrics3V1EndMagic)))
+	switch endMagic {
+	case lyrics3V1EndMagic:
+		d.FieldUTF8("lyrics", int(d.BitsLeft()/8)-len(lyrics3V1EndMagic))
+	case lyrics3V2EndMagic:
+		tagStart := d.Pos() - int64(len(lyrics3BeginMagic))*8
+		d.FieldArray("fields", func(d *decode.D) {
+			for d.BitsLeft() > lyrics3V2TrailerLen*8 {
+				d.FieldStruct("field", func(d *decode.D) {
+					d.FieldUTF8("id", 3, lyrics3FieldNames)
+					size := d.FieldUTF8("size", 5, mapDecStrToSymU)
+					n, err := strconv.ParseUint(size, 10, 64)
+					if err != nil {
+						d.Fatalf("invalid field size %q", size)
+					}
+					d.FieldUTF8("value", int(n))
+				})
+			}
+		})
+		d.FieldUTF8("size", 6, mapDecStrToSymU, d.ValidateStr(fmt.Sprintf("%06d", (d.Pos()-tagStart)/8)))
+	default:
+		d.Fatalf("unknown end magic %q", endMagic)
+	}
+	d.FieldUTF8("end_magic", len(endMagic))
+
+	return nil
+}
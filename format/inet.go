@@ -4,6 +4,7 @@ import "github.com/wader/fq/pkg/scalar"
 
 // from https://www.tcpdump.org/linktypes.html
 // TODO cleanup
+//
 //nolint:revive
 const (
 	LinkTypeNULL                       = 0
@@ -345,6 +346,7 @@ const (
 	IPv4ProtocolIGMP = 2
 	IPv4ProtocolTCP  = 6
 	IPv4ProtocolUDP  = 17
+	IPv4ProtocolESP  = 50
 )
 
 var IPv4ProtocolMap = scalar.UToScalar{
@@ -397,7 +399,7 @@ var IPv4ProtocolMap = scalar.UToScalar{
 	47:               {Sym: "gre", Description: "Generic Routing Encapsulation"},
 	48:               {Sym: "dsr", Description: "Dynamic Source Routing Protocol"},
 	49:               {Sym: "bna", Description: "BNA"},
-	50:               {Sym: "esp", Description: "encapsulating security payload"},
+	IPv4ProtocolESP:  {Sym: "esp", Description: "encapsulating security payload"},
 	51:               {Sym: "ah", Description: "authentication header"},
 	52:               {Sym: "i-nlsp", Description: "Integrated Net Layer Security TUBA"},
 	53:               {Sym: "swipe", Description: "IP with Encryption"},
@@ -491,8 +493,15 @@ var IPv4ProtocolMap = scalar.UToScalar{
 // current truncated to < 1024
 
 const (
-	UDPPortDomain = 53
-	UDPPortMDNS   = 5353
+	UDPPortDomain    = 53
+	UDPPortHTTPS     = 443
+	UDPPortIKE       = 500
+	UDPPortOpenVPN   = 1194
+	UDPPortSTUN      = 3478
+	UDPPortIKENATT   = 4500
+	UDPPortMDNS      = 5353
+	UDPPortMemcached = 11211
+	UDPPortWireGuard = 51820
 )
 
 var UDPPortMap = scalar.UToScalar{
@@ -893,7 +902,7 @@ var UDPPortMap = scalar.UToScalar{
 	497:           {Sym: "dantz", Description: "dantz"},
 	498:           {Sym: "siam", Description: "siam"},
 	499:           {Sym: "iso-ill", Description: "ISO ILL Protocol"},
-	500:           {Sym: "isakmp", Description: "isakmp"},
+	UDPPortIKE:    {Sym: "isakmp", Description: "isakmp"},
 	501:           {Sym: "stmf", Description: "STMF"},
 	502:           {Sym: "asa-appl-proto", Description: "asa-appl-proto"},
 	503:           {Sym: "intrinsa", Description: "Intrinsa"},
@@ -1175,11 +1184,18 @@ var UDPPortMap = scalar.UToScalar{
 	1000:          {Sym: "cadlock2"},
 	1010:          {Sym: "surf", Description: "surf"},
 
-	UDPPortMDNS: {Sym: "mdns", Description: "Multicast DNS"},
+	UDPPortOpenVPN:   {Sym: "openvpn", Description: "OpenVPN"},
+	UDPPortSTUN:      {Sym: "stun", Description: "Session Traversal Utilities for NAT"},
+	UDPPortIKENATT:   {Sym: "ipsec-nat-t", Description: "IPsec NAT-Traversal"},
+	UDPPortMDNS:      {Sym: "mdns", Description: "Multicast DNS"},
+	UDPPortMemcached: {Sym: "memcache", Description: "Memory cache service"},
+	UDPPortWireGuard: {Sym: "wireguard", Description: "WireGuard"},
 }
 
 const (
-	TCPPortDomain = 53
+	TCPPortDomain    = 53
+	TCPPortOpenVPN   = 1194
+	TCPPortMemcached = 11211
 )
 
 var TCPPortMap = scalar.UToScalar{
@@ -1862,4 +1878,7 @@ var TCPPortMap = scalar.UToScalar{
 	999:           {Sym: "garcon"},
 	1000:          {Sym: "cadlock2"},
 	1010:          {Sym: "surf", Description: "surf"},
+
+	TCPPortOpenVPN:   {Sym: "openvpn", Description: "OpenVPN"},
+	TCPPortMemcached: {Sym: "memcache", Description: "Memory cache service"},
 }
@@ -18,6 +18,7 @@ func init() {
 	registry.MustRegister(decode.Format{
 		Name:        format.ETHER8023_FRAME,
 		Description: "Ethernet 802.3 frame",
+		Groups:      []string{format.LINK_FRAME},
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.IPV4_PACKET}, Group: &ether8023FrameIPv4Format},
 		},
@@ -38,6 +39,12 @@ var mapUToEtherSym = scalar.Fn(func(s scalar.S) (scalar.S, error) {
 })
 
 func decodeEthernet(d *decode.D, in interface{}) interface{} {
+	if lfi, ok := in.(format.LinkFrameIn); ok {
+		if lfi.Type != format.LinkTypeETHERNET {
+			d.Fatalf("wrong link type %d", lfi.Type)
+		}
+	}
+
 	d.FieldU("destination", 48, mapUToEtherSym, scalar.Hex)
 	d.FieldU("source", 48, mapUToEtherSym, scalar.Hex)
 	etherType := d.FieldU16("ether_type", format.EtherTypeMap, scalar.Hex)
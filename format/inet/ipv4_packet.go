@@ -14,15 +14,18 @@ import (
 var udpPacketFormat decode.Group
 var tcpPacketFormat decode.Group
 var icmpFormat decode.Group
+var espFormat decode.Group
 
 func init() {
 	registry.MustRegister(decode.Format{
 		Name:        format.IPV4_PACKET,
 		Description: "Internet protocol v4 packet",
+		Groups:      []string{format.LINK_FRAME},
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.UDP_DATAGRAM}, Group: &udpPacketFormat},
 			{Names: []string{format.TCP_SEGMENT}, Group: &tcpPacketFormat},
 			{Names: []string{format.ICMP}, Group: &icmpFormat},
+			{Names: []string{format.ESP}, Group: &espFormat},
 		},
 		DecodeFn: decodeIPv4,
 	})
@@ -48,6 +51,7 @@ var ipv4ProtocolFormat = map[uint64]*decode.Group{
 	format.IPv4ProtocolUDP:  &udpPacketFormat,
 	format.IPv4ProtocolTCP:  &tcpPacketFormat,
 	format.IPv4ProtocolICMP: &icmpFormat,
+	format.IPv4ProtocolESP:  &espFormat,
 }
 
 var mapUToIPv4Sym = scalar.Fn(func(s scalar.S) (scalar.S, error) {
@@ -58,6 +62,13 @@ var mapUToIPv4Sym = scalar.Fn(func(s scalar.S) (scalar.S, error) {
 })
 
 func decodeIPv4(d *decode.D, in interface{}) interface{} {
+	if lfi, ok := in.(format.LinkFrameIn); ok {
+		// raw link type can also be IPv6
+		if (lfi.Type != format.LinkTypeRAW && lfi.Type != format.LinkTypeIPV4) || d.PeekBits(4) != 4 {
+			d.Fatalf("wrong link type %d", lfi.Type)
+		}
+	}
+
 	d.FieldU4("version")
 	ihl := d.FieldU4("ihl")
 	d.FieldU6("dscp")
@@ -100,7 +111,7 @@ func decodeIPv4(d *decode.D, in interface{}) interface{} {
 	ipv4Checksum := &checksum.IPv4{}
 	d.MustCopy(ipv4Checksum, d.BitBufRange(0, checksumStart))
 	d.MustCopy(ipv4Checksum, d.BitBufRange(checksumEnd, headerEnd-checksumEnd))
-	_ = d.FieldMustGet("header_checksum").TryScalarFn(d.ValidateUBytes(ipv4Checksum.Sum(nil)), scalar.Hex)
+	d.ValueChecksumU(d.FieldMustGet("header_checksum"), "ipv4", ipv4Checksum.Sum64())
 
 	dataLen := int64(totalLength-(ihl*4)) * 8
 	g, ok := ipv4ProtocolFormat[protocol]
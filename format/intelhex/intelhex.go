@@ -0,0 +1,189 @@
+package intelhex
+
+// https://en.wikipedia.org/wiki/Intel_HEX
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strconv"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var probeFormat decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.INTEL_HEX,
+		Description: "Intel HEX",
+		DecodeFn:    intelHexDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.PROBE}, Group: &probeFormat},
+		},
+	})
+}
+
+const (
+	recordTypeData                   = 0x00
+	recordTypeEndOfFile              = 0x01
+	recordTypeExtendedSegmentAddress = 0x02
+	recordTypeStartSegmentAddress    = 0x03
+	recordTypeExtendedLinearAddress  = 0x04
+	recordTypeStartLinearAddress     = 0x05
+)
+
+var recordTypeNames = scalar.UToSymStr{
+	recordTypeData:                   "data",
+	recordTypeEndOfFile:              "end_of_file",
+	recordTypeExtendedSegmentAddress: "extended_segment_address",
+	recordTypeStartSegmentAddress:    "start_segment_address",
+	recordTypeExtendedLinearAddress:  "extended_linear_address",
+	recordTypeStartLinearAddress:     "start_linear_address",
+}
+
+// gaps between data records are filled with this, erased flash
+const fillByte = 0xff
+
+// don't flatten to a binary larger than this, ex sparse address space
+const maxBinaryBytes = 64 * 1024 * 1024
+
+// hex encoded number of nBytes bytes, two characters per byte
+func fieldHexU(d *decode.D, name string, nBytes int, sms ...scalar.Mapper) uint64 {
+	return d.FieldUFn(name, func(d *decode.D) uint64 {
+		s := d.UTF8(nBytes * 2)
+		n, err := strconv.ParseUint(s, 16, 64)
+		if err != nil {
+			d.Fatalf("%s: invalid hex %q", name, s)
+		}
+		return n
+	}, sms...)
+}
+
+type chunk struct {
+	address uint64
+	data    []byte
+}
+
+func intelHexDecode(d *decode.D, in interface{}) interface{} {
+	var chunks []chunk
+	var baseAddress uint64
+	seenEOF := false
+
+	d.FieldArray("records", func(d *decode.D) {
+		for !seenEOF && !d.End() {
+			if c := d.PeekBytes(1)[0]; c != ':' {
+				d.Fatalf("expected record start code %q found %q", ':', c)
+			}
+
+			d.FieldStruct("record", func(d *decode.D) {
+				d.FieldUTF8("start_code", 1)
+				byteCount := fieldHexU(d, "byte_count", 1)
+				address := fieldHexU(d, "address", 2, scalar.Hex)
+				recordType := fieldHexU(d, "record_type", 1, recordTypeNames)
+
+				dataText := string(d.PeekBytes(int(byteCount) * 2))
+				data, err := hex.DecodeString(dataText)
+				if err != nil {
+					d.Fatalf("invalid data hex %q", dataText)
+				}
+
+				switch recordType {
+				case recordTypeData:
+					d.FieldUTF8("data", int(byteCount)*2)
+					absAddress := baseAddress + address
+					d.FieldValueU("absolute_address", absAddress, scalar.Hex)
+					chunks = append(chunks, chunk{address: absAddress, data: data})
+				case recordTypeEndOfFile:
+					seenEOF = true
+				case recordTypeExtendedSegmentAddress:
+					if byteCount != 2 {
+						d.Fatalf("expected 2 bytes of data found %d", byteCount)
+					}
+					segment := fieldHexU(d, "segment", 2, scalar.Hex)
+					baseAddress = segment * 16
+					d.FieldValueU("base_address", baseAddress, scalar.Hex)
+				case recordTypeStartSegmentAddress:
+					if byteCount != 4 {
+						d.Fatalf("expected 4 bytes of data found %d", byteCount)
+					}
+					fieldHexU(d, "cs", 2, scalar.Hex)
+					fieldHexU(d, "ip", 2, scalar.Hex)
+				case recordTypeExtendedLinearAddress:
+					if byteCount != 2 {
+						d.Fatalf("expected 2 bytes of data found %d", byteCount)
+					}
+					upper := fieldHexU(d, "upper_address", 2, scalar.Hex)
+					baseAddress = upper << 16
+					d.FieldValueU("base_address", baseAddress, scalar.Hex)
+				case recordTypeStartLinearAddress:
+					if byteCount != 4 {
+						d.Fatalf("expected 4 bytes of data found %d", byteCount)
+					}
+					fieldHexU(d, "eip", 4, scalar.Hex)
+				default:
+					d.FieldUTF8("data", int(byteCount)*2)
+				}
+
+				// sum of all bytes including checksum is zero
+				sum := byte(byteCount) + byte(address>>8) + byte(address) + byte(recordType)
+				for _, b := range data {
+					sum += b
+				}
+				fieldHexU(d, "checksum", 1, scalar.Hex)
+				d.ValueChecksumU(d.FieldMustGet("checksum"), "sum8", uint64(-sum))
+
+				// line ending and empty lines
+				n := 0
+				for int64(n) < d.BitsLeft()/8 {
+					if c := d.PeekBytes(n + 1)[n]; c != '\r' && c != '\n' {
+						break
+					}
+					n++
+				}
+				if n > 0 {
+					d.FieldUTF8("newline", n)
+				}
+			})
+		}
+	})
+
+	if !seenEOF {
+		d.Fatalf("no end of file record found")
+	}
+
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	minAddress := chunks[0].address
+	maxAddress := chunks[0].address
+	for _, c := range chunks {
+		if c.address < minAddress {
+			minAddress = c.address
+		}
+		if end := c.address + uint64(len(c.data)); end > maxAddress {
+			maxAddress = end
+		}
+	}
+	if maxAddress-minAddress > maxBinaryBytes {
+		d.Errorf("binary too large %d bytes", maxAddress-minAddress)
+		return nil
+	}
+
+	b := bytes.Repeat([]byte{fillByte}, int(maxAddress-minAddress))
+	for _, c := range chunks {
+		copy(b[c.address-minAddress:], c.data)
+	}
+
+	d.FieldValueU("binary_address", minAddress, scalar.Hex)
+	bb := bitio.NewBufferFromBytes(b, -1)
+	if dv, _, _ := d.TryFieldFormatBitBuf("binary", bb, probeFormat, nil); dv == nil {
+		d.FieldRootBitBuf("binary", bb)
+	}
+
+	return nil
+}
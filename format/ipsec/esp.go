@@ -0,0 +1,42 @@
+package ipsec
+
+// https://datatracker.ietf.org/doc/html/rfc4303
+// https://datatracker.ietf.org/doc/html/rfc3948 UDP encapsulation
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.ESP,
+		Description: "IPsec Encapsulating Security Payload",
+		Groups:      []string{format.UDP_PAYLOAD},
+		DecodeFn:    espDecode,
+	})
+}
+
+func espDecode(d *decode.D, in interface{}) interface{} {
+	if udi, ok := in.(format.UDPDatagramIn); ok {
+		if udi.DestinationPort != format.UDPPortIKENATT && udi.SourcePort != format.UDPPortIKENATT {
+			d.Fatalf("wrong port")
+		}
+		// single 0xff byte is a NAT-keepalive and zero SPI is the non-ESP marker used by IKE
+		if d.BitsLeft() == 8 {
+			d.FieldU8("nat_keepalive", d.AssertU(0xff))
+			return nil
+		}
+	}
+
+	// SPI 0 is reserved and 1-255 reserved for future use
+	d.FieldU32("spi", d.AssertURange(256, 0xffff_ffff), scalar.Hex)
+	d.FieldU32("sequence_number")
+	// payload, padding, pad length, next header and ICV are all encrypted or
+	// have unknown length without the security association
+	d.FieldRawLen("encrypted_data", d.BitsLeft())
+
+	return nil
+}
@@ -0,0 +1,498 @@
+package ipsec
+
+// https://datatracker.ietf.org/doc/html/rfc7296
+// https://www.iana.org/assignments/ikev2-parameters/ikev2-parameters.xhtml
+
+// TODO: IKEv1 payloads, now only generic payload header
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.IKEV2,
+		Description: "Internet Key Exchange version 2",
+		Groups:      []string{format.UDP_PAYLOAD},
+		DecodeFn:    ikev2Decode,
+	})
+}
+
+const (
+	payloadNone = 0
+	payloadSA   = 33
+	payloadKE   = 34
+	payloadIDi  = 35
+	payloadIDr  = 36
+	payloadCERT = 37
+	payloadCREQ = 38
+	payloadAUTH = 39
+	payloadNonc = 40
+	payloadN    = 41
+	payloadD    = 42
+	payloadV    = 43
+	payloadTSi  = 44
+	payloadTSr  = 45
+	payloadSK   = 46
+	payloadCP   = 47
+	payloadEAP  = 48
+	payloadSKF  = 53
+)
+
+var payloadNames = scalar.UToScalar{
+	payloadNone: {Sym: "none", Description: "No Next Payload"},
+	payloadSA:   {Sym: "sa", Description: "Security Association"},
+	payloadKE:   {Sym: "ke", Description: "Key Exchange"},
+	payloadIDi:  {Sym: "idi", Description: "Identification - Initiator"},
+	payloadIDr:  {Sym: "idr", Description: "Identification - Responder"},
+	payloadCERT: {Sym: "cert", Description: "Certificate"},
+	payloadCREQ: {Sym: "certreq", Description: "Certificate Request"},
+	payloadAUTH: {Sym: "auth", Description: "Authentication"},
+	payloadNonc: {Sym: "nonce", Description: "Nonce"},
+	payloadN:    {Sym: "notify", Description: "Notify"},
+	payloadD:    {Sym: "delete", Description: "Delete"},
+	payloadV:    {Sym: "vendor_id", Description: "Vendor ID"},
+	payloadTSi:  {Sym: "tsi", Description: "Traffic Selector - Initiator"},
+	payloadTSr:  {Sym: "tsr", Description: "Traffic Selector - Responder"},
+	payloadSK:   {Sym: "sk", Description: "Encrypted and Authenticated"},
+	payloadCP:   {Sym: "cp", Description: "Configuration"},
+	payloadEAP:  {Sym: "eap", Description: "Extensible Authentication"},
+	payloadSKF:  {Sym: "skf", Description: "Encrypted and Authenticated Fragment"},
+}
+
+var exchangeTypeNames = scalar.UToSymStr{
+	34: "IKE_SA_INIT",
+	35: "IKE_AUTH",
+	36: "CREATE_CHILD_SA",
+	37: "INFORMATIONAL",
+	38: "IKE_SESSION_RESUME",
+	43: "IKE_INTERMEDIATE",
+	44: "IKE_FOLLOWUP_KE",
+}
+
+const (
+	protocolIKE = 1
+	protocolAH  = 2
+	protocolESP = 3
+)
+
+var protocolIDNames = scalar.UToSymStr{
+	protocolIKE: "IKE",
+	protocolAH:  "AH",
+	protocolESP: "ESP",
+}
+
+const (
+	transformENCR  = 1
+	transformPRF   = 2
+	transformINTEG = 3
+	transformDH    = 4
+	transformESN   = 5
+)
+
+var transformTypeNames = scalar.UToScalar{
+	transformENCR:  {Sym: "encr", Description: "Encryption Algorithm"},
+	transformPRF:   {Sym: "prf", Description: "Pseudorandom Function"},
+	transformINTEG: {Sym: "integ", Description: "Integrity Algorithm"},
+	transformDH:    {Sym: "dh", Description: "Diffie-Hellman Group"},
+	transformESN:   {Sym: "esn", Description: "Extended Sequence Numbers"},
+}
+
+var transformIDNames = map[uint64]scalar.UToSymStr{
+	transformENCR: {
+		1:  "DES_IV64",
+		2:  "DES",
+		3:  "3DES",
+		4:  "RC5",
+		5:  "IDEA",
+		6:  "CAST",
+		7:  "BLOWFISH",
+		8:  "3IDEA",
+		9:  "DES_IV32",
+		11: "NULL",
+		12: "AES_CBC",
+		13: "AES_CTR",
+		14: "AES_CCM_8",
+		15: "AES_CCM_12",
+		16: "AES_CCM_16",
+		18: "AES_GCM_8",
+		19: "AES_GCM_12",
+		20: "AES_GCM_16",
+		21: "NULL_AUTH_AES_GMAC",
+		23: "CAMELLIA_CBC",
+		24: "CAMELLIA_CTR",
+		25: "CAMELLIA_CCM_8",
+		26: "CAMELLIA_CCM_12",
+		27: "CAMELLIA_CCM_16",
+		28: "CHACHA20_POLY1305",
+	},
+	transformPRF: {
+		1: "HMAC_MD5",
+		2: "HMAC_SHA1",
+		3: "HMAC_TIGER",
+		4: "AES128_XCBC",
+		5: "HMAC_SHA2_256",
+		6: "HMAC_SHA2_384",
+		7: "HMAC_SHA2_512",
+		8: "AES128_CMAC",
+	},
+	transformINTEG: {
+		0:  "NONE",
+		1:  "HMAC_MD5_96",
+		2:  "HMAC_SHA1_96",
+		3:  "DES_MAC",
+		4:  "KPDK_MD5",
+		5:  "AES_XCBC_96",
+		6:  "HMAC_MD5_128",
+		7:  "HMAC_SHA1_160",
+		8:  "AES_CMAC_96",
+		9:  "AES_128_GMAC",
+		10: "AES_192_GMAC",
+		11: "AES_256_GMAC",
+		12: "HMAC_SHA2_256_128",
+		13: "HMAC_SHA2_384_192",
+		14: "HMAC_SHA2_512_256",
+	},
+	transformDH: dhGroupNames,
+	transformESN: {
+		0: "NO_ESN",
+		1: "ESN",
+	},
+}
+
+var dhGroupNames = scalar.UToSymStr{
+	0:  "NONE",
+	1:  "MODP_768",
+	2:  "MODP_1024",
+	5:  "MODP_1536",
+	14: "MODP_2048",
+	15: "MODP_3072",
+	16: "MODP_4096",
+	17: "MODP_6144",
+	18: "MODP_8192",
+	19: "ECP_256",
+	20: "ECP_384",
+	21: "ECP_521",
+	22: "MODP_1024_160",
+	23: "MODP_2048_224",
+	24: "MODP_2048_256",
+	25: "ECP_192",
+	26: "ECP_224",
+	27: "BRAINPOOLP224R1",
+	28: "BRAINPOOLP256R1",
+	29: "BRAINPOOLP384R1",
+	30: "BRAINPOOLP512R1",
+	31: "CURVE25519",
+	32: "CURVE448",
+}
+
+var transformAttributeTypeNames = scalar.UToSymStr{
+	14: "key_length",
+}
+
+var idTypeNames = scalar.UToSymStr{
+	1:  "ID_IPV4_ADDR",
+	2:  "ID_FQDN",
+	3:  "ID_RFC822_ADDR",
+	5:  "ID_IPV6_ADDR",
+	9:  "ID_DER_ASN1_DN",
+	10: "ID_DER_ASN1_GN",
+	11: "ID_KEY_ID",
+	12: "ID_FC_NAME",
+	13: "ID_NULL",
+}
+
+var authMethodNames = scalar.UToSymStr{
+	1:  "RSA_DIGITAL_SIGNATURE",
+	2:  "SHARED_KEY_MESSAGE_INTEGRITY_CODE",
+	3:  "DSS_DIGITAL_SIGNATURE",
+	9:  "ECDSA_SHA256_P256",
+	10: "ECDSA_SHA384_P384",
+	11: "ECDSA_SHA512_P521",
+	12: "GENERIC_SECURE_PASSWORD",
+	13: "NULL_AUTHENTICATION",
+	14: "DIGITAL_SIGNATURE",
+}
+
+var certEncodingNames = scalar.UToSymStr{
+	1:  "PKCS7_WRAPPED_X509",
+	2:  "PGP",
+	3:  "DNS_SIGNED_KEY",
+	4:  "X509_SIGNATURE",
+	6:  "KERBEROS_TOKEN",
+	7:  "CRL",
+	8:  "ARL",
+	9:  "SPKI",
+	10: "X509_ATTRIBUTE",
+	11: "RAW_RSA_KEY",
+	12: "HASH_AND_URL_X509_CERT",
+	13: "HASH_AND_URL_X509_BUNDLE",
+	14: "OCSP_CONTENT",
+	15: "RAW_PUBLIC_KEY",
+}
+
+var notifyTypeNames = scalar.UToSymStr{
+	1:     "UNSUPPORTED_CRITICAL_PAYLOAD",
+	4:     "INVALID_IKE_SPI",
+	5:     "INVALID_MAJOR_VERSION",
+	7:     "INVALID_SYNTAX",
+	9:     "INVALID_MESSAGE_ID",
+	11:    "INVALID_SPI",
+	14:    "NO_PROPOSAL_CHOSEN",
+	17:    "INVALID_KE_PAYLOAD",
+	24:    "AUTHENTICATION_FAILED",
+	34:    "SINGLE_PAIR_REQUIRED",
+	35:    "NO_ADDITIONAL_SAS",
+	36:    "INTERNAL_ADDRESS_FAILURE",
+	37:    "FAILED_CP_REQUIRED",
+	38:    "TS_UNACCEPTABLE",
+	39:    "INVALID_SELECTORS",
+	43:    "TEMPORARY_FAILURE",
+	44:    "CHILD_SA_NOT_FOUND",
+	16384: "INITIAL_CONTACT",
+	16385: "SET_WINDOW_SIZE",
+	16386: "ADDITIONAL_TS_POSSIBLE",
+	16387: "IPCOMP_SUPPORTED",
+	16388: "NAT_DETECTION_SOURCE_IP",
+	16389: "NAT_DETECTION_DESTINATION_IP",
+	16390: "COOKIE",
+	16391: "USE_TRANSPORT_MODE",
+	16392: "HTTP_CERT_LOOKUP_SUPPORTED",
+	16393: "REKEY_SA",
+	16394: "ESP_TFC_PADDING_NOT_SUPPORTED",
+	16395: "NON_FIRST_FRAGMENTS_ALSO",
+	16396: "MOBIKE_SUPPORTED",
+	16404: "MULTIPLE_AUTH_SUPPORTED",
+	16405: "ANOTHER_AUTH_FOLLOWS",
+	16406: "REDIRECT_SUPPORTED",
+	16407: "REDIRECT",
+	16408: "REDIRECTED_FROM",
+	16417: "EAP_ONLY_AUTHENTICATION",
+	16418: "CHILDLESS_IKEV2_SUPPORTED",
+	16430: "IKEV2_FRAGMENTATION_SUPPORTED",
+	16431: "SIGNATURE_HASH_ALGORITHMS",
+	16441: "INTERMEDIATE_EXCHANGE_SUPPORTED",
+}
+
+var tsTypeNames = scalar.UToSymStr{
+	7: "TS_IPV4_ADDR_RANGE",
+	8: "TS_IPV6_ADDR_RANGE",
+}
+
+var cfgTypeNames = scalar.UToSymStr{
+	1: "CFG_REQUEST",
+	2: "CFG_REPLY",
+	3: "CFG_SET",
+	4: "CFG_ACK",
+}
+
+var mapUToIPv4Sym = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(s.ActualU()))
+	s.Sym = net.IP(b[:]).String()
+	return s, nil
+})
+
+func decodeTransform(d *decode.D) {
+	d.FieldU8("last_substruc", scalar.UToSymStr{0: "last", 3: "more"})
+	d.FieldU8("reserved")
+	length := d.FieldU16("transform_length")
+	d.LenFn((int64(length)-4)*8, func(d *decode.D) {
+		transformType := d.FieldU8("transform_type", transformTypeNames)
+		d.FieldU8("reserved1")
+		d.FieldU16("transform_id", transformIDNames[transformType])
+		d.FieldStructArrayLoop("attributes", "attribute", d.NotEnd, func(d *decode.D) {
+			tv := d.FieldBool("format")
+			d.FieldU15("type", transformAttributeTypeNames)
+			if tv {
+				d.FieldU16("value")
+			} else {
+				l := d.FieldU16("length")
+				d.FieldRawLen("value", int64(l)*8)
+			}
+		})
+	})
+}
+
+func decodeProposal(d *decode.D) {
+	d.FieldU8("last_substruc", scalar.UToSymStr{0: "last", 2: "more"})
+	d.FieldU8("reserved")
+	length := d.FieldU16("proposal_length")
+	d.LenFn((int64(length)-4)*8, func(d *decode.D) {
+		d.FieldU8("proposal_num")
+		d.FieldU8("protocol_id", protocolIDNames)
+		spiSize := d.FieldU8("spi_size")
+		numTransforms := d.FieldU8("num_transforms")
+		if spiSize > 0 {
+			d.FieldRawLen("spi", int64(spiSize)*8)
+		}
+		d.FieldArray("transforms", func(d *decode.D) {
+			for i := uint64(0); i < numTransforms; i++ {
+				d.FieldStruct("transform", decodeTransform)
+			}
+		})
+	})
+}
+
+func decodeTrafficSelector(d *decode.D) {
+	tsType := d.FieldU8("ts_type", tsTypeNames)
+	d.FieldU8("ip_protocol_id", format.IPv4ProtocolMap)
+	length := d.FieldU16("selector_length")
+	d.LenFn((int64(length)-4)*8, func(d *decode.D) {
+		d.FieldU16("start_port")
+		d.FieldU16("end_port")
+		switch tsType {
+		case 7:
+			d.FieldU32("starting_address", mapUToIPv4Sym)
+			d.FieldU32("ending_address", mapUToIPv4Sym)
+		default:
+			d.FieldRawLen("starting_address", d.BitsLeft()/2)
+			d.FieldRawLen("ending_address", d.BitsLeft())
+		}
+	})
+}
+
+func decodePayloadBody(d *decode.D, payloadType uint64) {
+	switch payloadType {
+	case payloadSA:
+		d.FieldStructArrayLoop("proposals", "proposal", d.NotEnd, decodeProposal)
+	case payloadKE:
+		d.FieldU16("dh_group", dhGroupNames)
+		d.FieldU16("reserved1")
+		d.FieldRawLen("key_exchange_data", d.BitsLeft())
+	case payloadIDi, payloadIDr:
+		d.FieldU8("id_type", idTypeNames)
+		d.FieldU24("reserved1")
+		d.FieldRawLen("identification_data", d.BitsLeft())
+	case payloadCERT, payloadCREQ:
+		d.FieldU8("cert_encoding", certEncodingNames)
+		d.FieldRawLen("data", d.BitsLeft())
+	case payloadAUTH:
+		d.FieldU8("auth_method", authMethodNames)
+		d.FieldU24("reserved1")
+		d.FieldRawLen("authentication_data", d.BitsLeft())
+	case payloadNonc:
+		d.FieldRawLen("nonce_data", d.BitsLeft())
+	case payloadN:
+		d.FieldU8("protocol_id", protocolIDNames)
+		spiSize := d.FieldU8("spi_size")
+		d.FieldU16("notify_message_type", notifyTypeNames)
+		if spiSize > 0 {
+			d.FieldRawLen("spi", int64(spiSize)*8)
+		}
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("notification_data", d.BitsLeft())
+		}
+	case payloadD:
+		d.FieldU8("protocol_id", protocolIDNames)
+		spiSize := d.FieldU8("spi_size")
+		numSPIs := d.FieldU16("num_spis")
+		d.FieldArray("spis", func(d *decode.D) {
+			for i := uint64(0); i < numSPIs; i++ {
+				d.FieldRawLen("spi", int64(spiSize)*8)
+			}
+		})
+	case payloadV:
+		d.FieldRawLen("vendor_id", d.BitsLeft())
+	case payloadTSi, payloadTSr:
+		numTS := d.FieldU8("num_ts")
+		d.FieldU24("reserved1")
+		d.FieldArray("traffic_selectors", func(d *decode.D) {
+			for i := uint64(0); i < numTS; i++ {
+				d.FieldStruct("traffic_selector", decodeTrafficSelector)
+			}
+		})
+	case payloadCP:
+		d.FieldU8("cfg_type", cfgTypeNames)
+		d.FieldU24("reserved1")
+		d.FieldStructArrayLoop("attributes", "attribute", d.NotEnd, func(d *decode.D) {
+			d.FieldU1("reserved")
+			d.FieldU15("type")
+			l := d.FieldU16("length")
+			d.FieldRawLen("value", int64(l)*8)
+		})
+	case payloadSKF:
+		d.FieldU16("fragment_number")
+		d.FieldU16("total_fragments")
+		d.FieldRawLen("encrypted_data", d.BitsLeft())
+	case payloadSK:
+		// IV, padding and ICV lengths depend on negotiated algorithms
+		d.FieldRawLen("encrypted_data", d.BitsLeft())
+	default:
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+}
+
+func decodePayloads(d *decode.D, nextPayload uint64) {
+	d.FieldArray("payloads", func(d *decode.D) {
+		for nextPayload != payloadNone && d.NotEnd() {
+			payloadType := nextPayload
+			d.FieldStruct("payload", func(d *decode.D) {
+				d.FieldValueU("type", payloadType, payloadNames)
+				nextPayload = d.FieldU8("next_payload", payloadNames)
+				d.FieldBool("critical")
+				d.FieldU7("reserved")
+				length := d.FieldU16("payload_length")
+				if length < 4 {
+					d.Fatalf("payload length %d < 4", length)
+				}
+				d.LenFn((int64(length)-4)*8, func(d *decode.D) {
+					decodePayloadBody(d, payloadType)
+				})
+				// encrypted payload is always last, next payload is for first inner payload
+				if payloadType == payloadSK || payloadType == payloadSKF {
+					nextPayload = payloadNone
+				}
+			})
+		}
+	})
+}
+
+func ikev2Decode(d *decode.D, in interface{}) interface{} {
+	if udi, ok := in.(format.UDPDatagramIn); ok {
+		switch {
+		case udi.DestinationPort == format.UDPPortIKE || udi.SourcePort == format.UDPPortIKE:
+		case udi.DestinationPort == format.UDPPortIKENATT || udi.SourcePort == format.UDPPortIKENATT:
+			// non-ESP marker to tell IKE from ESP when using UDP encapsulation
+			d.FieldU32("non_esp_marker", d.AssertU(0))
+		default:
+			d.Fatalf("wrong port")
+		}
+	}
+
+	var nextPayload uint64
+	var length uint64
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldU64("initiator_spi", scalar.Hex)
+		d.FieldU64("responder_spi", scalar.Hex)
+		nextPayload = d.FieldU8("next_payload", payloadNames)
+		d.FieldU4("major_version", d.AssertU(2))
+		d.FieldU4("minor_version")
+		d.FieldU8("exchange_type", exchangeTypeNames)
+		d.FieldStruct("flags", func(d *decode.D) {
+			d.FieldU2("unused0")
+			d.FieldBool("response")
+			d.FieldBool("version")
+			d.FieldBool("initiator")
+			d.FieldU3("unused1")
+		})
+		d.FieldU32("message_id")
+		length = d.FieldU32("length")
+	})
+
+	const headerLen = 28
+	if length < headerLen {
+		d.Fatalf("length %d < %d", length, headerLen)
+	}
+	d.LenFn((int64(length)-headerLen)*8, func(d *decode.D) {
+		decodePayloads(d, nextPayload)
+	})
+
+	return nil
+}
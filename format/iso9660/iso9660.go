@@ -0,0 +1,341 @@
+package iso9660
+
+// https://www.ecma-international.org/publications-and-standards/standards/ecma-119/
+// https://wiki.osdev.org/ISO_9660
+
+// TODO: Joliet and Rock Ridge names
+// TODO: multi-extent files
+// TODO: path tables
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/ranges"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:          format.ISO9660,
+		Description:   "ISO 9660 file system",
+		Groups:        []string{format.PROBE},
+		Magic:         []decode.Magic{{Offset: systemAreaLen + 1, Bytes: []byte("CD001")}},
+		DecodeFn:      iso9660Decode,
+		EmbeddedFiles: iso9660EmbeddedFiles,
+	})
+}
+
+const (
+	sectorLen = 2048
+	// 16 sectors reserved for system use, ex boot code
+	systemAreaLen = 16 * sectorLen
+	// directories can't be nested deeper than this, protects against loops
+	maxDirDepth = 256
+)
+
+const (
+	volumeDescriptorBootRecord    = 0
+	volumeDescriptorPrimary       = 1
+	volumeDescriptorSupplementary = 2
+	volumeDescriptorPartition     = 3
+	volumeDescriptorTerminator    = 255
+)
+
+var volumeDescriptorTypeNames = scalar.UToSymStr{
+	volumeDescriptorBootRecord:    "boot_record",
+	volumeDescriptorPrimary:       "primary",
+	volumeDescriptorSupplementary: "supplementary",
+	volumeDescriptorPartition:     "partition",
+	volumeDescriptorTerminator:    "terminator",
+}
+
+var identifierMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	switch s.ActualStr() {
+	case "\x00":
+		s.Description = "current directory"
+	case "\x01":
+		s.Description = "parent directory"
+	}
+	return s, nil
+})
+
+var mapTrimSpace = scalar.Trim(" ")
+
+// fileName returns name without version and trailing dot, "A.TXT;1" -> "A.TXT"
+func fileName(identifier string) string {
+	if i := strings.LastIndexByte(identifier, ';'); i != -1 {
+		identifier = identifier[:i]
+	}
+	return strings.TrimSuffix(identifier, ".")
+}
+
+// both-byte order values are stored little endian followed by big endian
+func fieldBothU16(d *decode.D, name string) uint64 {
+	v := d.FieldU16LE(name)
+	d.FieldU16BE(name+"_be", d.ValidateU(v))
+	return v
+}
+
+func fieldBothU32(d *decode.D, name string) uint64 {
+	v := d.FieldU32LE(name)
+	d.FieldU32BE(name+"_be", d.ValidateU(v))
+	return v
+}
+
+// dec-datetime, digits and offset from GMT in 15 minute intervals
+func fieldDecDateTime(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		d.FieldUTF8("year", 4)
+		d.FieldUTF8("month", 2)
+		d.FieldUTF8("day", 2)
+		d.FieldUTF8("hour", 2)
+		d.FieldUTF8("minute", 2)
+		d.FieldUTF8("second", 2)
+		d.FieldUTF8("hundredths", 2)
+		d.FieldS8("gmt_offset")
+	})
+}
+
+func fieldRecordingDateTime(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		d.FieldU8("year", scalar.Fn(func(s scalar.S) (scalar.S, error) {
+			if v, ok := s.Actual.(uint64); ok {
+				s.Description = fmt.Sprintf("%d", 1900+v)
+			}
+			return s, nil
+		}))
+		d.FieldU8("month")
+		d.FieldU8("day")
+		d.FieldU8("hour")
+		d.FieldU8("minute")
+		d.FieldU8("second")
+		d.FieldS8("gmt_offset")
+	})
+}
+
+type directoryRecord struct {
+	extent      uint64
+	dataLength  uint64
+	isDirectory bool
+	identifier  string
+}
+
+func decodeDirectoryRecord(d *decode.D) directoryRecord {
+	var r directoryRecord
+	length := d.FieldU8("length")
+	if length < 34 {
+		d.Fatalf("invalid directory record length %d", length)
+	}
+	d.LenFn(int64(length-1)*8, func(d *decode.D) {
+		d.FieldU8("extended_attribute_record_length")
+		r.extent = fieldBothU32(d, "extent_location")
+		r.dataLength = fieldBothU32(d, "data_length")
+		fieldRecordingDateTime(d, "recording_date_time")
+		d.FieldStruct("file_flags", func(d *decode.D) {
+			d.FieldBool("multi_extent")
+			d.FieldU2("reserved")
+			d.FieldBool("protection")
+			d.FieldBool("record")
+			d.FieldBool("associated_file")
+			r.isDirectory = d.FieldBool("directory")
+			d.FieldBool("hidden")
+		})
+		d.FieldU8("file_unit_size")
+		d.FieldU8("interleave_gap_size")
+		fieldBothU16(d, "volume_sequence_number")
+		identifierLen := d.FieldU8("file_identifier_length")
+		r.identifier = d.FieldUTF8("file_identifier", int(identifierLen), identifierMap)
+		// identifier is padded to even length
+		if identifierLen%2 == 0 {
+			d.FieldRawLen("padding", 8, d.BitBufIsZero())
+		}
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("system_use", d.BitsLeft())
+		}
+	})
+	return r
+}
+
+type volume struct {
+	blockLen int64
+	root     directoryRecord
+	found    bool
+}
+
+func decodeVolumeDescriptor(d *decode.D, vol *volume) uint64 {
+	typ := d.FieldU8("type", volumeDescriptorTypeNames)
+	d.FieldUTF8("identifier", 5, d.AssertStr("CD001"))
+	d.FieldU8("version")
+
+	switch typ {
+	case volumeDescriptorBootRecord:
+		d.FieldUTF8NullFixedLen("boot_system_identifier", 32)
+		d.FieldUTF8NullFixedLen("boot_identifier", 32)
+		d.FieldRawLen("boot_system_use", d.BitsLeft())
+	case volumeDescriptorPrimary, volumeDescriptorSupplementary:
+		// supplementary has volume flags and escape sequences in unused fields
+		d.FieldU8("volume_flags")
+		d.FieldUTF8("system_identifier", 32, mapTrimSpace)
+		d.FieldUTF8("volume_identifier", 32, mapTrimSpace)
+		d.FieldRawLen("unused0", 8*8, d.BitBufIsZero())
+		fieldBothU32(d, "volume_space_size")
+		d.FieldRawLen("escape_sequences", 32*8)
+		fieldBothU16(d, "volume_set_size")
+		fieldBothU16(d, "volume_sequence_number")
+		blockLen := fieldBothU16(d, "logical_block_size")
+		fieldBothU32(d, "path_table_size")
+		d.FieldU32LE("type_l_path_table_location")
+		d.FieldU32LE("optional_type_l_path_table_location")
+		d.FieldU32BE("type_m_path_table_location")
+		d.FieldU32BE("optional_type_m_path_table_location")
+		var root directoryRecord
+		d.FieldStruct("root_directory_record", func(d *decode.D) { root = decodeDirectoryRecord(d) })
+		d.FieldUTF8("volume_set_identifier", 128, mapTrimSpace)
+		d.FieldUTF8("publisher_identifier", 128, mapTrimSpace)
+		d.FieldUTF8("data_preparer_identifier", 128, mapTrimSpace)
+		d.FieldUTF8("application_identifier", 128, mapTrimSpace)
+		d.FieldUTF8("copyright_file_identifier", 37, mapTrimSpace)
+		d.FieldUTF8("abstract_file_identifier", 37, mapTrimSpace)
+		d.FieldUTF8("bibliographic_file_identifier", 37, mapTrimSpace)
+		fieldDecDateTime(d, "creation_date_time")
+		fieldDecDateTime(d, "modification_date_time")
+		fieldDecDateTime(d, "expiration_date_time")
+		fieldDecDateTime(d, "effective_date_time")
+		d.FieldU8("file_structure_version")
+		d.FieldU8("unused1")
+		d.FieldRawLen("application_use", 512*8)
+		d.FieldRawLen("reserved", d.BitsLeft())
+
+		if typ == volumeDescriptorPrimary && !vol.found {
+			if blockLen == 0 || blockLen > sectorLen {
+				d.Fatalf("invalid logical block size %d", blockLen)
+			}
+			vol.blockLen = int64(blockLen)
+			vol.root = root
+			vol.found = true
+		}
+	default:
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+
+	return typ
+}
+
+func iso9660Decode(d *decode.D, in interface{}) interface{} {
+	d.FieldRawLen("system_area", systemAreaLen*8)
+
+	var vol volume
+	terminated := false
+	d.FieldStructArrayLoop("volume_descriptors", "volume_descriptor", func() bool { return !terminated && d.BitsLeft() >= sectorLen*8 }, func(d *decode.D) {
+		d.LenFn(sectorLen*8, func(d *decode.D) {
+			terminated = decodeVolumeDescriptor(d, &vol) == volumeDescriptorTerminator
+		})
+	})
+	if !vol.found {
+		d.Fatalf("no primary volume descriptor")
+	}
+
+	// walk directories breadth first from the root directory record in the
+	// primary volume descriptor
+	type dir struct {
+		path   string
+		record directoryRecord
+		depth  int
+	}
+	queue := []dir{{path: "", record: vol.root}}
+	seen := map[uint64]bool{}
+	d.FieldArray("directories", func(d *decode.D) {
+		for len(queue) > 0 {
+			dr := queue[0]
+			queue = queue[1:]
+			if seen[dr.record.extent] {
+				continue
+			}
+			seen[dr.record.extent] = true
+			if dr.depth > maxDirDepth {
+				d.Fatalf("%s: directories nested too deep", dr.path)
+			}
+
+			start := int64(dr.record.extent) * vol.blockLen * 8
+			length := int64(dr.record.dataLength) * 8
+			if start+length > d.Len() {
+				d.Fatalf("%s: invalid directory extent", dr.path)
+			}
+			d.SeekAbs(start)
+			d.FieldStruct("directory", func(d *decode.D) {
+				d.FieldValueStr("path", "/"+dr.path)
+				d.FieldArray("records", func(d *decode.D) {
+					end := start + length
+					for d.Pos() < end {
+						// records don't cross sectors, rest of sector is zero padding
+						if d.PeekBits(8) == 0 {
+							next := (d.Pos()/(sectorLen*8) + 1) * sectorLen * 8
+							if next > end {
+								next = end
+							}
+							d.SeekAbs(next)
+							continue
+						}
+						var r directoryRecord
+						d.FieldStruct("record", func(d *decode.D) { r = decodeDirectoryRecord(d) })
+						if r.identifier == "\x00" || r.identifier == "\x01" || !r.isDirectory {
+							continue
+						}
+						queue = append(queue, dir{
+							path:   dr.path + fileName(r.identifier) + "/",
+							record: r,
+							depth:  dr.depth + 1,
+						})
+					}
+				})
+			})
+		}
+	})
+
+	return nil
+}
+
+// files and directories in directory order
+func iso9660EmbeddedFiles(v *decode.Value) ([]decode.EmbeddedFile, error) {
+	var blockLen int64
+	for _, vd := range v.Child("volume_descriptors").Children() {
+		if typ, _ := vd.Child("type").Scalar().Actual.(uint64); typ == volumeDescriptorPrimary {
+			n, _ := vd.Child("logical_block_size").Scalar().Actual.(uint64)
+			blockLen = int64(n)
+			break
+		}
+	}
+	if blockLen == 0 {
+		return nil, fmt.Errorf("no primary volume descriptor")
+	}
+
+	var efs []decode.EmbeddedFile
+	for _, dv := range v.Child("directories").Children() {
+		path, _ := dv.Child("path").Scalar().Actual.(string)
+		path = strings.TrimPrefix(path, "/")
+		for _, rv := range dv.Child("records").Children() {
+			identifier, _ := rv.Child("file_identifier").Scalar().Actual.(string)
+			if identifier == "\x00" || identifier == "\x01" {
+				continue
+			}
+			name := path + fileName(identifier)
+			if isDir, _ := rv.Child("file_flags").Child("directory").Scalar().Actual.(bool); isDir {
+				efs = append(efs, decode.EmbeddedFile{Name: name + "/", Dir: true})
+				continue
+			}
+			extent, _ := rv.Child("extent_location").Scalar().Actual.(uint64)
+			length, _ := rv.Child("data_length").Scalar().Actual.(uint64)
+			r := ranges.Range{Start: int64(extent) * blockLen * 8, Len: int64(length) * 8}
+			if r.Stop() > v.RootBitBuf.Len() {
+				return nil, fmt.Errorf("%s: invalid extent", name)
+			}
+			efs = append(efs, decode.EmbeddedFile{Name: name, Range: r, Size: int64(length)})
+		}
+	}
+
+	return efs, nil
+}
@@ -22,6 +22,7 @@ func init() {
 		Name:        format.JPEG,
 		Description: "Joint Photographic Experts Group file",
 		Groups:      []string{format.PROBE, format.IMAGE},
+		Magic:       []decode.Magic{{Bytes: []byte{0xff, 0xd8}}},
 		DecodeFn:    jpegDecode,
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.EXIF}, Group: &exifFormat},
@@ -0,0 +1,668 @@
+package lnk
+
+// https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-shllink/16cb4ca1-9339-4d0c-a68d-bf1d6cc0f943
+// https://github.com/libyal/liblnk/blob/main/documentation/Windows%20Shortcut%20File%20(LNK)%20format.asciidoc
+// https://github.com/libyal/libfwsi/blob/main/documentation/Windows%20Shell%20Item%20format.asciidoc
+
+// TODO: property store and vista id list shell item property values
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.LNK,
+		Description: "Windows shortcut",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: headerMagic}},
+		DecodeFn:    lnkDecode,
+	})
+}
+
+const headerSize = 0x4c
+
+// header size followed by shell link CLSID 00021401-0000-0000-c000-000000000046
+var headerMagic = []byte{
+	0x4c, 0x00, 0x00, 0x00,
+	0x01, 0x14, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0xc0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46,
+}
+
+var knownGUIDNames = map[string]string{
+	"00021401-0000-0000-c000-000000000046": "Shell link",
+	"20d04fe0-3aea-1069-a2d8-08002b30309d": "My Computer",
+	"450d8fba-ad25-11d0-98a8-0800361b1103": "My Documents",
+	"208d2c60-3aea-1069-a2d7-08002b30309d": "My Network Places",
+	"f02c1a0d-be21-4350-88b0-7367fc96ef3c": "Network",
+	"645ff040-5081-101b-9f08-00aa002f954e": "Recycle Bin",
+	"21ec2020-3aea-1069-a2dd-08002b30309d": "Control Panel",
+	"59031a47-3f72-44a7-89c5-5595fe6b30ee": "Users Files",
+	"b4bfcc3a-db2c-424c-b029-7fe99a87c641": "Desktop",
+	"fdd39ad0-238f-46af-adb4-6c85480369c7": "Documents",
+	"374de290-123f-4565-9164-39c4925e467b": "Downloads",
+	"1ac14e77-02e7-4e5d-b744-2eb1ae5198b7": "System",
+	"905e63b6-c1bf-494e-b29c-65b732d3d21a": "Program Files",
+	"f38bf404-1d43-42f2-9305-67de0b28fc23": "Windows",
+}
+
+var showCommandNames = scalar.UToSymStr{
+	1: "normal",
+	3: "maximized",
+	7: "min_no_active",
+}
+
+var driveTypeNames = scalar.UToSymStr{
+	0: "unknown",
+	1: "no_root_dir",
+	2: "removable",
+	3: "fixed",
+	4: "remote",
+	5: "cdrom",
+	6: "ramdisk",
+}
+
+var networkProviderTypeNames = scalar.UToSymStr{
+	0x00020000: "lanman",
+	0x001a0000: "avid",
+	0x001b0000: "docuspace",
+	0x001c0000: "mangosoft",
+	0x001d0000: "sernet",
+	0x001e0000: "riverfront1",
+	0x001f0000: "riverfront2",
+	0x00200000: "decorb",
+	0x00210000: "protstor",
+	0x00220000: "fj_redir",
+	0x00230000: "distinct",
+	0x00240000: "twins",
+	0x00250000: "rdr2sample",
+	0x00260000: "csc",
+	0x00270000: "3in1",
+	0x00290000: "extendnet",
+	0x002a0000: "stac",
+	0x002b0000: "foxbat",
+	0x002c0000: "yahoo",
+	0x002d0000: "exifs",
+	0x002e0000: "dav",
+	0x002f0000: "knoware",
+	0x00300000: "object_dire",
+	0x00310000: "masfax",
+	0x00320000: "hob_nfs",
+	0x00330000: "shiva",
+	0x00340000: "ibmal",
+	0x00350000: "lock",
+	0x00360000: "termsrv",
+	0x00370000: "srt",
+	0x00380000: "quincy",
+	0x00390000: "openafs",
+	0x003a0000: "avid1",
+	0x003b0000: "dfs",
+	0x003c0000: "kwnp",
+	0x003d0000: "zenworks",
+	0x003e0000: "driveonweb",
+	0x003f0000: "vmware",
+	0x00400000: "rsfx",
+	0x00410000: "mfiles",
+	0x00420000: "ms_nfs",
+	0x00430000: "google",
+}
+
+const (
+	extraDataEnvironment     = 0xa0000001
+	extraDataConsole         = 0xa0000002
+	extraDataTracker         = 0xa0000003
+	extraDataConsoleFE       = 0xa0000004
+	extraDataSpecialFolder   = 0xa0000005
+	extraDataDarwin          = 0xa0000006
+	extraDataIconEnvironment = 0xa0000007
+	extraDataShim            = 0xa0000008
+	extraDataPropertyStore   = 0xa0000009
+	extraDataKnownFolder     = 0xa000000b
+	extraDataVistaIDList     = 0xa000000c
+)
+
+// block size less than 4 is the terminal block
+const (
+	extraDataMinBlockSize = 4
+	extraDataHeaderSize   = 8
+)
+
+var extraDataSignatureNames = scalar.UToSymStr{
+	extraDataEnvironment:     "environment",
+	extraDataConsole:         "console",
+	extraDataTracker:         "tracker",
+	extraDataConsoleFE:       "console_fe",
+	extraDataSpecialFolder:   "special_folder",
+	extraDataDarwin:          "darwin",
+	extraDataIconEnvironment: "icon_environment",
+	extraDataShim:            "shim",
+	extraDataPropertyStore:   "property_store",
+	extraDataKnownFolder:     "known_folder",
+	extraDataVistaIDList:     "vista_id_list",
+}
+
+const (
+	classTypeRootFolder = 0x10
+	classTypeVolume     = 0x20
+	classTypeFileEntry  = 0x30
+)
+
+// shell item class type is upper bits, lower nibble are type specific flags
+var classTypeNames = map[uint64]string{
+	classTypeRootFolder: "root_folder",
+	classTypeVolume:     "volume",
+	classTypeFileEntry:  "file_entry",
+	0x40:                "network_location",
+	0x50:                "compressed_folder",
+	0x60:                "uri",
+	0x70:                "control_panel",
+}
+
+var classTypeMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	uv, ok := s.Actual.(uint64)
+	if !ok {
+		return s, nil
+	}
+	if n, ok := classTypeNames[uv&0x70]; ok {
+		s.Sym = n
+	}
+	return s, nil
+})
+
+var sortIndexNames = scalar.UToSymStr{
+	0x00: "internet_explorer",
+	0x42: "libraries",
+	0x44: "users",
+	0x48: "my_documents",
+	0x50: "my_computer",
+	0x58: "network",
+	0x60: "recycle_bin",
+	0x68: "internet_explorer",
+	0x80: "my_games",
+}
+
+// virtual key code
+var hotKeyMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	uv, ok := s.Actual.(uint64)
+	if !ok {
+		return s, nil
+	}
+	switch {
+	case uv >= '0' && uv <= '9', uv >= 'A' && uv <= 'Z':
+		s.Sym = string(rune(uv))
+	case uv >= 0x70 && uv <= 0x87:
+		s.Sym = fmt.Sprintf("f%d", uv-0x70+1)
+	case uv == 0x90:
+		s.Sym = "num_lock"
+	case uv == 0x91:
+		s.Sym = "scroll_lock"
+	}
+	return s, nil
+})
+
+// FILETIME is 100ns intervals since 1601-01-01 00:00:00 UTC
+const fileTimeUnixDelta = 11644473600
+
+var fileTimeMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	uv, ok := s.Actual.(uint64)
+	if !ok || uv == 0 {
+		return s, nil
+	}
+	s.Description = time.Unix(int64(uv/10_000_000)-fileTimeUnixDelta, int64(uv%10_000_000)*100).UTC().Format(time.RFC3339Nano)
+	return s, nil
+})
+
+// FAT date is year since 1980 (7 bits), month (4 bits) and day (5 bits)
+var fatDateMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	uv, ok := s.Actual.(uint64)
+	if !ok || uv == 0 {
+		return s, nil
+	}
+	s.Description = fmt.Sprintf("%04d-%02d-%02d", 1980+uv>>9, (uv>>5)&0xf, uv&0x1f)
+	return s, nil
+})
+
+// FAT time is hours (5 bits), minutes (6 bits) and seconds/2 (5 bits)
+var fatTimeMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	uv, ok := s.Actual.(uint64)
+	if !ok {
+		return s, nil
+	}
+	s.Description = fmt.Sprintf("%02d:%02d:%02d", uv>>11, (uv>>5)&0x3f, (uv&0x1f)*2)
+	return s, nil
+})
+
+// GUID with first three groups in little endian
+func fieldGUID(d *decode.D, name string) {
+	b := d.PeekBytes(16)
+	guid := fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(b[0:4]),
+		binary.LittleEndian.Uint16(b[4:6]),
+		binary.LittleEndian.Uint16(b[6:8]),
+		b[8:10],
+		b[10:16],
+	)
+	d.FieldRawLen(name, 16*8, scalar.Sym(guid), scalar.Description(knownGUIDNames[guid]))
+}
+
+func fieldUTF16LENull(d *decode.D, name string) string {
+	b := d.PeekBytes(int(d.BitsLeft() / 8))
+	for i := 0; i+1 < len(b); i += 2 {
+		if b[i] == 0 && b[i+1] == 0 {
+			return d.FieldUTF16LE(name, i+2, scalar.Trim("\x00"))
+		}
+	}
+	d.Fatalf("%s: null terminator not found", name)
+	return ""
+}
+
+func fieldFileAttributes(d *decode.D) {
+	d.FieldStruct("file_attributes", func(d *decode.D) {
+		// TODO: 32LE, should have some kind of native endian flag reader helper?
+		d.FieldBool("normal")
+		d.FieldBool("reserved2")
+		d.FieldBool("archive")
+		d.FieldBool("directory")
+		d.FieldBool("reserved1")
+		d.FieldBool("system")
+		d.FieldBool("hidden")
+		d.FieldBool("readonly")
+
+		d.FieldBool("unused0")
+		d.FieldBool("encrypted")
+		d.FieldBool("not_content_indexed")
+		d.FieldBool("offline")
+		d.FieldBool("compressed")
+		d.FieldBool("reparse_point")
+		d.FieldBool("sparse_file")
+		d.FieldBool("temporary")
+
+		d.FieldU16("unused1")
+	})
+}
+
+type linkFlags struct {
+	hasLinkTargetIDList bool
+	hasLinkInfo         bool
+	hasName             bool
+	hasRelativePath     bool
+	hasWorkingDir       bool
+	hasArguments        bool
+	hasIconLocation     bool
+	isUnicode           bool
+}
+
+func decodeHeader(d *decode.D) linkFlags {
+	var f linkFlags
+
+	d.FieldU32("header_size", d.AssertU(headerSize))
+	fieldGUID(d, "link_clsid")
+	d.FieldStruct("link_flags", func(d *decode.D) {
+		// TODO: 32LE, should have some kind of native endian flag reader helper?
+		f.isUnicode = d.FieldBool("is_unicode")
+		f.hasIconLocation = d.FieldBool("has_icon_location")
+		f.hasArguments = d.FieldBool("has_arguments")
+		f.hasWorkingDir = d.FieldBool("has_working_dir")
+		f.hasRelativePath = d.FieldBool("has_relative_path")
+		f.hasName = d.FieldBool("has_name")
+		f.hasLinkInfo = d.FieldBool("has_link_info")
+		f.hasLinkTargetIDList = d.FieldBool("has_link_target_id_list")
+
+		d.FieldBool("no_pidl_alias")
+		d.FieldBool("has_exp_icon")
+		d.FieldBool("run_as_user")
+		d.FieldBool("has_darwin_id")
+		d.FieldBool("unused1")
+		d.FieldBool("run_in_separate_process")
+		d.FieldBool("has_exp_string")
+		d.FieldBool("force_no_link_info")
+
+		d.FieldBool("allow_link_to_link")
+		d.FieldBool("disable_known_folder_alias")
+		d.FieldBool("disable_known_folder_tracking")
+		d.FieldBool("disable_link_path_tracking")
+		d.FieldBool("enable_target_metadata")
+		d.FieldBool("force_no_link_track")
+		d.FieldBool("run_with_shim_layer")
+		d.FieldBool("unused2")
+
+		d.FieldU5("unused3")
+		d.FieldBool("keep_local_id_list_for_unc_target")
+		d.FieldBool("prefer_environment_path")
+		d.FieldBool("unalias_on_save")
+	})
+	fieldFileAttributes(d)
+	d.FieldU64("creation_time", fileTimeMap)
+	d.FieldU64("access_time", fileTimeMap)
+	d.FieldU64("write_time", fileTimeMap)
+	d.FieldU32("file_size")
+	d.FieldS32("icon_index")
+	d.FieldU32("show_command", showCommandNames)
+	d.FieldStruct("hot_key", func(d *decode.D) {
+		d.FieldU8("key", hotKeyMap, scalar.Hex)
+		d.FieldStruct("modifiers", func(d *decode.D) {
+			d.FieldU5("unused")
+			d.FieldBool("alt")
+			d.FieldBool("control")
+			d.FieldBool("shift")
+		})
+	})
+	d.FieldU16("reserved1")
+	d.FieldU32("reserved2")
+	d.FieldU32("reserved3")
+
+	return f
+}
+
+func decodeExtensionBlocks(d *decode.D) {
+	d.FieldArray("extension_blocks", func(d *decode.D) {
+		for d.BitsLeft() >= 8*8 {
+			size := int64(binary.LittleEndian.Uint16(d.PeekBytes(2)))
+			if size < 8 || size*8 > d.BitsLeft() {
+				break
+			}
+			d.FieldStruct("extension_block", func(d *decode.D) {
+				d.FieldU16("size")
+				d.FieldU16("version")
+				d.FieldU32("signature", scalar.Hex)
+				d.FieldRawLen("data", (size-8)*8)
+			})
+		}
+	})
+}
+
+func decodeShellItem(d *decode.D, itemStart int64) {
+	classType := d.FieldU8("class_type", classTypeMap, scalar.Hex)
+	switch {
+	case classType == 0x1f:
+		d.FieldU8("sort_index", sortIndexNames, scalar.Hex)
+		fieldGUID(d, "shell_folder_id")
+	case classType&0x70 == classTypeVolume && classType&0x01 != 0:
+		d.FieldUTF8Null("name")
+	case classType&0x70 == classTypeFileEntry:
+		d.FieldU8("unknown0")
+		d.FieldU32("file_size")
+		d.FieldU16("last_modification_date", fatDateMap)
+		d.FieldU16("last_modification_time", fatTimeMap)
+		d.FieldU16("file_attributes", scalar.Hex)
+		// bit 2 set means unicode primary name
+		if classType&0x04 != 0 {
+			fieldUTF16LENull(d, "primary_name")
+		} else {
+			d.FieldUTF8Null("primary_name")
+		}
+		if (d.Pos()-itemStart)%16 != 0 {
+			d.FieldU8("padding")
+		}
+		decodeExtensionBlocks(d)
+	}
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+}
+
+func decodeIDListItems(d *decode.D) {
+	d.FieldArray("items", func(d *decode.D) {
+		for d.BitsLeft() >= 16 {
+			size := int64(binary.LittleEndian.Uint16(d.PeekBytes(2)))
+			if size == 0 {
+				break
+			}
+			if size < 3 {
+				d.Fatalf("invalid item size %d", size)
+			}
+			d.FieldStruct("item", func(d *decode.D) {
+				itemStart := d.Pos()
+				d.FieldU16("size")
+				d.LenFn((size-2)*8, func(d *decode.D) { decodeShellItem(d, itemStart) })
+			})
+		}
+	})
+	d.FieldU16("terminal_id", d.AssertU(0))
+}
+
+func decodeVolumeID(d *decode.D) {
+	start := d.Pos()
+	size := d.FieldU32("volume_id_size")
+	d.LenFn(int64(size-4)*8, func(d *decode.D) {
+		d.FieldU32("drive_type", driveTypeNames)
+		d.FieldU32("drive_serial_number", scalar.Hex)
+		labelOffset := d.FieldU32("volume_label_offset")
+		// offset 0x14 means label is only stored as unicode
+		if labelOffset == 0x14 {
+			labelOffset = d.FieldU32("volume_label_offset_unicode")
+			d.SeekAbs(start + int64(labelOffset)*8)
+			fieldUTF16LENull(d, "volume_label_unicode")
+		} else {
+			d.SeekAbs(start + int64(labelOffset)*8)
+			d.FieldUTF8Null("volume_label")
+		}
+	})
+}
+
+func decodeCommonNetworkRelativeLink(d *decode.D) {
+	start := d.Pos()
+	size := d.FieldU32("common_network_relative_link_size")
+	d.LenFn(int64(size-4)*8, func(d *decode.D) {
+		var validDevice bool
+		d.FieldStruct("common_network_relative_link_flags", func(d *decode.D) {
+			// TODO: 32LE, should have some kind of native endian flag reader helper?
+			d.FieldU6("unused0")
+			d.FieldBool("valid_net_type")
+			validDevice = d.FieldBool("valid_device")
+			d.FieldU24("unused1")
+		})
+		netNameOffset := d.FieldU32("net_name_offset")
+		deviceNameOffset := d.FieldU32("device_name_offset")
+		d.FieldU32("network_provider_type", networkProviderTypeNames, scalar.Hex)
+		var netNameOffsetUnicode, deviceNameOffsetUnicode uint64
+		if netNameOffset > 0x14 {
+			netNameOffsetUnicode = d.FieldU32("net_name_offset_unicode")
+			deviceNameOffsetUnicode = d.FieldU32("device_name_offset_unicode")
+		}
+
+		d.SeekAbs(start + int64(netNameOffset)*8)
+		d.FieldUTF8Null("net_name")
+		if validDevice {
+			d.SeekAbs(start + int64(deviceNameOffset)*8)
+			d.FieldUTF8Null("device_name")
+		}
+		if netNameOffsetUnicode != 0 {
+			d.SeekAbs(start + int64(netNameOffsetUnicode)*8)
+			fieldUTF16LENull(d, "net_name_unicode")
+		}
+		if validDevice && deviceNameOffsetUnicode != 0 {
+			d.SeekAbs(start + int64(deviceNameOffsetUnicode)*8)
+			fieldUTF16LENull(d, "device_name_unicode")
+		}
+	})
+}
+
+func decodeLinkInfo(d *decode.D) {
+	start := d.Pos()
+	size := d.FieldU32("link_info_size")
+	if size < 0x1c {
+		d.Fatalf("invalid link info size %d", size)
+	}
+	d.LenFn(int64(size-4)*8, func(d *decode.D) {
+		headerSize := d.FieldU32("link_info_header_size")
+		var hasVolumeID, hasNetworkLink bool
+		d.FieldStruct("link_info_flags", func(d *decode.D) {
+			// TODO: 32LE, should have some kind of native endian flag reader helper?
+			d.FieldU6("unused0")
+			hasNetworkLink = d.FieldBool("common_network_relative_link_and_path_suffix")
+			hasVolumeID = d.FieldBool("volume_id_and_local_base_path")
+			d.FieldU24("unused1")
+		})
+		volumeIDOffset := d.FieldU32("volume_id_offset")
+		localBasePathOffset := d.FieldU32("local_base_path_offset")
+		networkLinkOffset := d.FieldU32("common_network_relative_link_offset")
+		commonPathSuffixOffset := d.FieldU32("common_path_suffix_offset")
+		var localBasePathOffsetUnicode, commonPathSuffixOffsetUnicode uint64
+		if headerSize >= 0x24 {
+			localBasePathOffsetUnicode = d.FieldU32("local_base_path_offset_unicode")
+			commonPathSuffixOffsetUnicode = d.FieldU32("common_path_suffix_offset_unicode")
+		}
+
+		if hasVolumeID {
+			d.SeekAbs(start + int64(volumeIDOffset)*8)
+			d.FieldStruct("volume_id", decodeVolumeID)
+			d.SeekAbs(start + int64(localBasePathOffset)*8)
+			d.FieldUTF8Null("local_base_path")
+		}
+		if hasNetworkLink {
+			d.SeekAbs(start + int64(networkLinkOffset)*8)
+			d.FieldStruct("common_network_relative_link", decodeCommonNetworkRelativeLink)
+		}
+		d.SeekAbs(start + int64(commonPathSuffixOffset)*8)
+		d.FieldUTF8Null("common_path_suffix")
+		if hasVolumeID && localBasePathOffsetUnicode != 0 {
+			d.SeekAbs(start + int64(localBasePathOffsetUnicode)*8)
+			fieldUTF16LENull(d, "local_base_path_unicode")
+		}
+		if commonPathSuffixOffsetUnicode != 0 {
+			d.SeekAbs(start + int64(commonPathSuffixOffsetUnicode)*8)
+			fieldUTF16LENull(d, "common_path_suffix_unicode")
+		}
+	})
+}
+
+// count of characters followed by string without null terminator
+func fieldStringData(d *decode.D, name string, isUnicode bool) {
+	count := int(d.FieldU16(name + "_length"))
+	if isUnicode {
+		d.FieldUTF16LE(name, count*2)
+	} else {
+		d.FieldUTF8(name, count)
+	}
+}
+
+func fieldAnsiUnicode(d *decode.D, name string) {
+	d.FieldUTF8NullFixedLen(name+"_ansi", 260)
+	d.FieldUTF16LE(name+"_unicode", 520, scalar.Trim("\x00"))
+}
+
+func decodeExtraDataBlock(d *decode.D, signature uint64) {
+	switch signature {
+	case extraDataEnvironment,
+		extraDataIconEnvironment:
+		fieldAnsiUnicode(d, "target")
+	case extraDataDarwin:
+		fieldAnsiUnicode(d, "darwin_data")
+	case extraDataConsole:
+		d.FieldU16("fill_attributes", scalar.Hex)
+		d.FieldU16("popup_fill_attributes", scalar.Hex)
+		d.FieldS16("screen_buffer_size_x")
+		d.FieldS16("screen_buffer_size_y")
+		d.FieldS16("window_size_x")
+		d.FieldS16("window_size_y")
+		d.FieldS16("window_origin_x")
+		d.FieldS16("window_origin_y")
+		d.FieldU32("unused1")
+		d.FieldU32("unused2")
+		d.FieldU32("font_size")
+		d.FieldU32("font_family", scalar.Hex)
+		d.FieldU32("font_weight")
+		d.FieldUTF16LE("face_name", 64, scalar.Trim("\x00"))
+		d.FieldU32("cursor_size")
+		d.FieldU32("full_screen")
+		d.FieldU32("quick_edit")
+		d.FieldU32("insert_mode")
+		d.FieldU32("auto_position")
+		d.FieldU32("history_buffer_size")
+		d.FieldU32("number_of_history_buffers")
+		d.FieldU32("history_no_dup")
+		d.FieldArray("color_table", func(d *decode.D) {
+			for i := 0; i < 16; i++ {
+				d.FieldU32("color", scalar.Hex)
+			}
+		})
+	case extraDataTracker:
+		d.FieldU32("length")
+		d.FieldU32("version")
+		d.FieldUTF8NullFixedLen("machine_id", 16)
+		fieldGUID(d, "droid_volume_id")
+		fieldGUID(d, "droid_file_id")
+		fieldGUID(d, "droid_birth_volume_id")
+		fieldGUID(d, "droid_birth_file_id")
+	case extraDataConsoleFE:
+		d.FieldU32("code_page")
+	case extraDataSpecialFolder:
+		d.FieldU32("special_folder_id")
+		d.FieldU32("offset")
+	case extraDataKnownFolder:
+		fieldGUID(d, "known_folder_id")
+		d.FieldU32("offset")
+	case extraDataShim:
+		d.FieldUTF16LE("layer_name", int(d.BitsLeft()/8), scalar.Trim("\x00"))
+	case extraDataVistaIDList:
+		decodeIDListItems(d)
+	}
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+}
+
+func lnkDecode(d *decode.D, in interface{}) interface{} {
+	d.Endian = decode.LittleEndian
+
+	var f linkFlags
+	d.FieldStruct("header", func(d *decode.D) { f = decodeHeader(d) })
+
+	if f.hasLinkTargetIDList {
+		d.FieldStruct("link_target_id_list", func(d *decode.D) {
+			size := d.FieldU16("id_list_size")
+			d.LenFn(int64(size)*8, decodeIDListItems)
+		})
+	}
+	if f.hasLinkInfo {
+		d.FieldStruct("link_info", decodeLinkInfo)
+	}
+	if f.hasName || f.hasRelativePath || f.hasWorkingDir || f.hasArguments || f.hasIconLocation {
+		d.FieldStruct("string_data", func(d *decode.D) {
+			for _, s := range []struct {
+				present bool
+				name    string
+			}{
+				{f.hasName, "name"},
+				{f.hasRelativePath, "relative_path"},
+				{f.hasWorkingDir, "working_dir"},
+				{f.hasArguments, "arguments"},
+				{f.hasIconLocation, "icon_location"},
+			} {
+				if s.present {
+					fieldStringData(d, s.name, f.isUnicode)
+				}
+			}
+		})
+	}
+	if d.BitsLeft() > 0 {
+		d.FieldArray("extra_data", func(d *decode.D) {
+			for d.BitsLeft() >= 32 {
+				size := int64(binary.LittleEndian.Uint32(d.PeekBytes(4)))
+				if size < extraDataMinBlockSize {
+					break
+				}
+				if size < extraDataHeaderSize {
+					d.Fatalf("invalid extra data block size %d", size)
+				}
+				d.FieldStruct("block", func(d *decode.D) {
+					d.FieldU32("block_size")
+					signature := d.FieldU32("signature", extraDataSignatureNames, scalar.Hex)
+					d.LenFn((size-extraDataHeaderSize)*8, func(d *decode.D) {
+						decodeExtraDataBlock(d, signature)
+					})
+				})
+			}
+		})
+		d.FieldU32("terminal_block", d.AssertURange(0, extraDataMinBlockSize-1))
+	}
+
+	return nil
+}
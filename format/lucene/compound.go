@@ -0,0 +1,20 @@
+package lucene
+
+// https://github.com/apache/lucene/blob/main/lucene/core/src/java/org/apache/lucene/codecs/lucene90/Lucene90CompoundFormat.java
+
+import (
+	"github.com/wader/fq/pkg/decode"
+)
+
+func decodeCompoundEntries(d *decode.D) {
+	count := fieldVint(d, "count")
+	d.FieldArray("entries", func(d *decode.D) {
+		for i := uint64(0); i < count; i++ {
+			d.FieldStruct("entry", func(d *decode.D) {
+				fieldString(d, "id")
+				d.FieldS64("offset")
+				d.FieldS64("length")
+			})
+		}
+	})
+}
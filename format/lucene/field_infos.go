@@ -0,0 +1,89 @@
+package lucene
+
+// https://github.com/apache/lucene/blob/main/lucene/core/src/java/org/apache/lucene/codecs/lucene94/Lucene94FieldInfosFormat.java
+// https://github.com/apache/lucene/blob/branch_8x/lucene/core/src/java/org/apache/lucene/codecs/lucene60/Lucene60FieldInfosFormat.java
+
+import (
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var indexOptionsNames = scalar.UToSymStr{
+	0: "none",
+	1: "docs",
+	2: "docs_and_freqs",
+	3: "docs_and_freqs_and_positions",
+	4: "docs_and_freqs_and_positions_and_offsets",
+}
+
+var docValuesTypeNames = scalar.UToSymStr{
+	0: "none",
+	1: "numeric",
+	2: "binary",
+	3: "sorted",
+	4: "sorted_set",
+	5: "sorted_numeric",
+}
+
+var docValuesSkipIndexTypeNames = scalar.UToSymStr{
+	0: "none",
+	1: "range",
+}
+
+var vectorEncodingNames = scalar.UToSymStr{
+	0: "byte",
+	1: "float32",
+}
+
+var vectorSimilarityNames = scalar.UToSymStr{
+	0: "euclidean",
+	1: "dot_product",
+	2: "cosine",
+	3: "maximum_inner_product",
+}
+
+var docValuesGenMap = scalar.SToScalar{-1: {Description: "no updates"}}
+
+// Lucene94FieldInfos version that added doc values skip index
+const fieldInfos94FormatDocValueSkipper = 2
+
+func decodeFieldInfos(d *decode.D, h codecHeader) {
+	size := fieldVint(d, "size")
+	d.FieldArray("fields", func(d *decode.D) {
+		for i := uint64(0); i < size; i++ {
+			d.FieldStruct("field", func(d *decode.D) {
+				fieldString(d, "name")
+				fieldVint(d, "number")
+				d.FieldStruct("bits", func(d *decode.D) {
+					d.FieldU3("unused")
+					d.FieldBool("parent_field")
+					d.FieldBool("soft_deletes_field")
+					d.FieldBool("store_payloads")
+					d.FieldBool("omit_norms")
+					d.FieldBool("store_term_vector")
+				})
+				d.FieldU8("index_options", indexOptionsNames)
+				d.FieldU8("doc_values_type", docValuesTypeNames)
+				if h.codec == "Lucene94FieldInfos" && h.version >= fieldInfos94FormatDocValueSkipper {
+					d.FieldU8("doc_values_skip_index_type", docValuesSkipIndexTypeNames)
+				}
+				d.FieldS64("doc_values_gen", docValuesGenMap)
+				fieldMapOfStrings(d, "attributes")
+				pointDimensionCount := fieldVint(d, "point_dimension_count")
+				if pointDimensionCount != 0 {
+					fieldVint(d, "point_index_dimension_count")
+					fieldVint(d, "point_num_bytes")
+				}
+				switch h.codec {
+				case "Lucene90FieldInfos":
+					fieldVint(d, "vector_dimension")
+					d.FieldU8("vector_similarity")
+				case "Lucene94FieldInfos":
+					fieldVint(d, "vector_dimension")
+					d.FieldU8("vector_encoding", vectorEncodingNames)
+					d.FieldU8("vector_similarity", vectorSimilarityNames)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,157 @@
+package lucene
+
+// https://github.com/apache/lucene/blob/main/lucene/core/src/java/org/apache/lucene/codecs/CodecUtil.java
+// https://github.com/apache/lucene/blob/main/lucene/core/src/java/org/apache/lucene/store/DataOutput.java
+
+// TODO: segments_N commit files
+// TODO: split compound data using entries
+
+import (
+	"hash/crc32"
+	"strconv"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.LUCENE,
+		Description: "Lucene index file (5.0 and later)",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte{0x3f, 0xd7, 0x6c, 0x17}}},
+		DecodeFn:    luceneDecode,
+	})
+}
+
+const (
+	codecMagic  = 0x3fd76c17
+	footerMagic = ^uint64(codecMagic) & 0xffff_ffff
+	footerLen   = 16
+	objectIDLen = 16
+)
+
+// variable length integer, 7 bits per byte least significant group first
+func vint(d *decode.D) uint64 {
+	var v uint64
+	for shift := 0; ; shift += 7 {
+		if shift > 63 {
+			d.Fatalf("vint too long")
+		}
+		b := d.U8()
+		v |= (b & 0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	return v
+}
+
+func fieldVint(d *decode.D, name string, sms ...scalar.Mapper) uint64 {
+	return d.FieldUFn(name, vint, sms...)
+}
+
+// UTF-8 string with vint length prefix
+func str(d *decode.D) string {
+	return d.UTF8(int(vint(d)))
+}
+
+func fieldString(d *decode.D, name string) string {
+	return d.FieldStrFn(name, str)
+}
+
+func fieldMapOfStrings(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		count := fieldVint(d, "count")
+		d.FieldArray("entries", func(d *decode.D) {
+			for i := uint64(0); i < count; i++ {
+				d.FieldStruct("entry", func(d *decode.D) {
+					fieldString(d, "key")
+					fieldString(d, "value")
+				})
+			}
+		})
+	})
+}
+
+func fieldSetOfStrings(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		count := fieldVint(d, "count")
+		d.FieldArray("values", func(d *decode.D) {
+			for i := uint64(0); i < count; i++ {
+				fieldString(d, "value")
+			}
+		})
+	})
+}
+
+// Lucene 9.0 and later writes little endian except for header and footer
+func codecEndian(codec string) decode.Endian {
+	s := strings.TrimPrefix(codec, "Lucene")
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	if v, err := strconv.Atoi(s[:n]); err == nil && v >= 90 {
+		return decode.LittleEndian
+	}
+	return decode.BigEndian
+}
+
+type codecHeader struct {
+	codec   string
+	version uint64
+}
+
+func decodeIndexHeader(d *decode.D) codecHeader {
+	var h codecHeader
+	d.FieldU32("magic", d.AssertU(codecMagic), scalar.Hex)
+	h.codec = fieldString(d, "codec")
+	h.version = d.FieldU32("version")
+	d.FieldRawLen("object_id", objectIDLen*8, scalar.RawHex)
+	suffixLen := d.FieldU8("suffix_length")
+	d.FieldUTF8("suffix", int(suffixLen))
+	return h
+}
+
+func luceneDecode(d *decode.D, in interface{}) interface{} {
+	var h codecHeader
+	d.FieldStruct("header", func(d *decode.D) { h = decodeIndexHeader(d) })
+
+	bodyLen := d.Len() - footerLen*8 - d.Pos()
+	if bodyLen < 0 {
+		d.Fatalf("file too short for footer")
+	}
+
+	d.FieldStruct("body", func(d *decode.D) {
+		d.LenFn(bodyLen, func(d *decode.D) {
+			d.Endian = codecEndian(h.codec)
+			switch h.codec {
+			case "Lucene70SegmentInfo", "Lucene86SegmentInfo", "Lucene90SegmentInfo":
+				decodeSegmentInfo(d)
+			case "Lucene60FieldInfos", "Lucene90FieldInfos", "Lucene94FieldInfos":
+				decodeFieldInfos(d, h)
+			case "Lucene50CompoundEntries", "Lucene90CompoundEntries":
+				decodeCompoundEntries(d)
+			default:
+				// Lucene50CompoundData, Lucene90CompoundData etc
+				d.FieldRawLen("data", d.BitsLeft())
+			}
+			if d.NotEnd() {
+				d.FieldRawLen("unknown", d.BitsLeft())
+			}
+		})
+	})
+
+	checksumEnd := d.Len() - 64
+	d.FieldStruct("footer", func(d *decode.D) {
+		d.FieldU32("magic", d.AssertU(footerMagic), scalar.Hex)
+		d.FieldU32("algorithm_id", scalar.UToSymStr{0: "crc32"})
+		d.FieldChecksumU("checksum", 64, "crc32", uint64(crc32.ChecksumIEEE(d.BytesRange(0, int(checksumEnd/8)))), scalar.Hex)
+	})
+
+	return nil
+}
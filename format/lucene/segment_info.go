@@ -0,0 +1,37 @@
+package lucene
+
+// https://github.com/apache/lucene/blob/main/lucene/core/src/java/org/apache/lucene/codecs/lucene90/Lucene90SegmentInfoFormat.java
+
+import (
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var isCompoundFileMap = scalar.SToScalar{
+	1:  {Sym: true},
+	-1: {Sym: false},
+}
+
+func decodeVersion(d *decode.D) {
+	d.FieldS32("major")
+	d.FieldS32("minor")
+	d.FieldS32("bugfix")
+}
+
+func decodeSegmentInfo(d *decode.D) {
+	d.FieldStruct("version", decodeVersion)
+	hasMinVersion := d.FieldU8("has_min_version", scalar.UToSymStr{0: "no", 1: "yes"})
+	if hasMinVersion == 1 {
+		d.FieldStruct("min_version", decodeVersion)
+	}
+	d.FieldS32("doc_count")
+	d.FieldS8("is_compound_file", isCompoundFileMap)
+	fieldMapOfStrings(d, "diagnostics")
+	fieldSetOfStrings(d, "files")
+	fieldMapOfStrings(d, "attributes")
+	numSortFields := fieldVint(d, "num_sort_fields")
+	if numSortFields > 0 {
+		// provider specific serialization
+		d.FieldRawLen("sort_fields", d.BitsLeft())
+	}
+}
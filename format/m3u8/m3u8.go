@@ -0,0 +1,388 @@
+package m3u8
+
+// https://datatracker.ietf.org/doc/html/rfc8216
+// https://datatracker.ietf.org/doc/html/draft-pantos-hls-rfc8216bis
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/internal/lineparse"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.M3U8,
+		Description: "HTTP Live Streaming playlist",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte(headerTag)}},
+		DecodeFn:    m3u8Decode,
+	})
+}
+
+const headerTag = "#EXTM3U"
+
+const (
+	tagKindNone = iota
+	tagKindInteger
+	tagKindString
+	tagKindExtinf
+	tagKindByterange
+	tagKindAttributes
+)
+
+type tagInfo struct {
+	kind        int
+	playlist    bool // applies to playlist and not to next URI
+	description string
+}
+
+var tagInfos = map[string]tagInfo{
+	// basic tags
+	"EXT-X-VERSION": {kind: tagKindInteger, playlist: true, description: "Compatibility version"},
+	// media segment tags
+	"EXTINF":                  {kind: tagKindExtinf, description: "Segment duration and title"},
+	"EXT-X-BYTERANGE":         {kind: tagKindByterange, description: "Segment is a sub-range of the URI"},
+	"EXT-X-DISCONTINUITY":     {kind: tagKindNone, description: "Discontinuity between segments"},
+	"EXT-X-KEY":               {kind: tagKindAttributes, description: "Segment encryption"},
+	"EXT-X-MAP":               {kind: tagKindAttributes, description: "Media initialization section"},
+	"EXT-X-PROGRAM-DATE-TIME": {kind: tagKindString, description: "Absolute date and time of first sample"},
+	"EXT-X-DATERANGE":         {kind: tagKindAttributes, description: "Date range with attributes"},
+	"EXT-X-GAP":               {kind: tagKindNone, description: "Segment is missing"},
+	"EXT-X-BITRATE":           {kind: tagKindInteger, description: "Approximate segment bitrate in kbps"},
+	"EXT-X-PART":              {kind: tagKindAttributes, description: "Partial segment"},
+	// media playlist tags
+	"EXT-X-TARGETDURATION":         {kind: tagKindInteger, playlist: true, description: "Maximum segment duration"},
+	"EXT-X-MEDIA-SEQUENCE":         {kind: tagKindInteger, playlist: true, description: "Media sequence number of first segment"},
+	"EXT-X-DISCONTINUITY-SEQUENCE": {kind: tagKindInteger, playlist: true, description: "Discontinuity sequence number of first segment"},
+	"EXT-X-ENDLIST":                {kind: tagKindNone, playlist: true, description: "No more segments will be added"},
+	"EXT-X-PLAYLIST-TYPE":          {kind: tagKindString, playlist: true, description: "Mutability of playlist"},
+	"EXT-X-I-FRAMES-ONLY":          {kind: tagKindNone, playlist: true, description: "Segments are single I-frames"},
+	"EXT-X-PART-INF":               {kind: tagKindAttributes, playlist: true, description: "Partial segment information"},
+	"EXT-X-SERVER-CONTROL":         {kind: tagKindAttributes, playlist: true, description: "Server delivery directives support"},
+	"EXT-X-SKIP":                   {kind: tagKindAttributes, playlist: true, description: "Skipped segments in playlist delta update"},
+	"EXT-X-PRELOAD-HINT":           {kind: tagKindAttributes, playlist: true, description: "Resource needed to play playlist"},
+	"EXT-X-RENDITION-REPORT":       {kind: tagKindAttributes, playlist: true, description: "Information about associated rendition"},
+	"EXT-X-ALLOW-CACHE":            {kind: tagKindString, playlist: true, description: "Allow caching (removed in version 7)"},
+	// multivariant playlist tags
+	"EXT-X-MEDIA":              {kind: tagKindAttributes, playlist: true, description: "Alternative rendition"},
+	"EXT-X-STREAM-INF":         {kind: tagKindAttributes, description: "Variant stream"},
+	"EXT-X-I-FRAME-STREAM-INF": {kind: tagKindAttributes, playlist: true, description: "I-frame only variant stream"},
+	"EXT-X-SESSION-DATA":       {kind: tagKindAttributes, playlist: true, description: "Session data"},
+	"EXT-X-SESSION-KEY":        {kind: tagKindAttributes, playlist: true, description: "Session encryption key"},
+	"EXT-X-CONTENT-STEERING":   {kind: tagKindAttributes, playlist: true, description: "Content steering server"},
+	// media or multivariant playlist tags
+	"EXT-X-INDEPENDENT-SEGMENTS": {kind: tagKindNone, playlist: true, description: "Segments can be decoded independently"},
+	"EXT-X-START":                {kind: tagKindAttributes, playlist: true, description: "Preferred start point"},
+	"EXT-X-DEFINE":               {kind: tagKindAttributes, playlist: true, description: "Variable definition"},
+}
+
+var tagNameMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	if name, ok := s.Actual.(string); ok {
+		if ti, ok := tagInfos[name]; ok {
+			s.Description = ti.description
+		}
+	}
+	return s, nil
+})
+
+type line struct {
+	start int // byte offset in input
+	end   int // including newline
+	text  string
+}
+
+// name of tag and byte offset of value, -1 if none
+func (l line) tag() (string, int) {
+	s := l.text[1:]
+	if i := strings.IndexByte(s, ':'); i != -1 {
+		return s[0:i], l.start + 1 + i + 1
+	}
+	return s, -1
+}
+
+type entry struct {
+	tags []line
+	uri  line
+}
+
+func fieldSpanU(d *decode.D, start int, end int, name string, value string) {
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		d.Fatalf("%s: invalid integer %q", name, value)
+	}
+	lineparse.FieldU(d, start, end, name, n)
+}
+
+func fieldSpanF(d *decode.D, start int, end int, name string, value string) {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		d.Fatalf("%s: invalid float %q", name, value)
+	}
+	lineparse.FieldF(d, start, end, name, n)
+}
+
+// <n>[@<o>] where value starts at valueStart
+func fieldByterange(d *decode.D, start int, valueStart int, end int, value string) {
+	length, offset, hasOffset := cut(value, '@')
+	if !hasOffset {
+		fieldSpanU(d, start, end, "length", length)
+		return
+	}
+	offsetStart := valueStart + len(length) + 1
+	fieldSpanU(d, start, offsetStart, "length", length)
+	fieldSpanU(d, offsetStart, end, "offset", offset)
+}
+
+func cut(s string, sep byte) (string, string, bool) {
+	if i := strings.IndexByte(s, sep); i != -1 {
+		return s[0:i], s[i+1:], true
+	}
+	return s, "", false
+}
+
+func isDecimalInteger(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+type attribute struct {
+	start      int // byte offset of name
+	valueStart int // byte offset of value, after quote if quoted
+	end        int // including separating comma
+	name       string
+	value      string
+	quoted     bool
+}
+
+func parseAttributes(b []byte, start int, end int) ([]attribute, bool) {
+	var attrs []attribute
+	i := start
+	for i < end {
+		a := attribute{start: i}
+		eq := bytes.IndexByte(b[i:end], '=')
+		if eq == -1 {
+			return nil, false
+		}
+		a.name = string(b[i : i+eq])
+		i += eq + 1
+		if i < end && b[i] == '"' {
+			q := bytes.IndexByte(b[i+1:end], '"')
+			if q == -1 {
+				return nil, false
+			}
+			a.quoted = true
+			a.valueStart = i + 1
+			a.value = string(b[i+1 : i+1+q])
+			i += 1 + q + 1
+		} else {
+			a.valueStart = i
+			c := bytes.IndexByte(b[i:end], ',')
+			if c == -1 {
+				c = end - i
+			}
+			a.value = string(b[i : i+c])
+			i += c
+		}
+		if i < end {
+			if b[i] != ',' {
+				return nil, false
+			}
+			i++
+		}
+		a.end = i
+		attrs = append(attrs, a)
+	}
+	return attrs, true
+}
+
+func attributeFieldName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "-", "_"))
+}
+
+func fieldAttributes(d *decode.D, b []byte, l line, valueStart int) {
+	valueEnd := l.start + len(l.text)
+	attrs, ok := parseAttributes(b, valueStart, valueEnd)
+	if !ok {
+		d.Fatalf("invalid attribute list %q", b[valueStart:valueEnd])
+	}
+	d.FieldStruct("attributes", func(d *decode.D) {
+		seen := map[string]bool{}
+		for i, a := range attrs {
+			name := attributeFieldName(a.name)
+			if seen[name] {
+				d.Fatalf("duplicate attribute %q", a.name)
+			}
+			seen[name] = true
+			end := a.end
+			if i == len(attrs)-1 {
+				end = l.end
+			}
+
+			switch {
+			case a.name == "BYTERANGE" && a.quoted:
+				d.FieldStruct(name, func(d *decode.D) {
+					fieldByterange(d, a.start, a.valueStart, end, a.value)
+				})
+			case a.name == "RESOLUTION" && !a.quoted && strings.Contains(a.value, "x"):
+				width, height, _ := cut(a.value, 'x')
+				heightStart := a.valueStart + len(width) + 1
+				d.FieldStruct(name, func(d *decode.D) {
+					fieldSpanU(d, a.start, heightStart, "width", width)
+					fieldSpanU(d, heightStart, end, "height", height)
+				})
+			case a.quoted:
+				lineparse.FieldStr(d, a.start, end, name, a.value)
+			case isDecimalInteger(a.value):
+				fieldSpanU(d, a.start, end, name, a.value)
+			default:
+				if _, err := strconv.ParseFloat(a.value, 64); err == nil && !strings.HasPrefix(a.value, "0x") {
+					fieldSpanF(d, a.start, end, name, a.value)
+				} else {
+					// enumerated string or hexadecimal sequence
+					lineparse.FieldStr(d, a.start, end, name, a.value)
+				}
+			}
+		}
+	})
+}
+
+func fieldTag(d *decode.D, b []byte, l line) {
+	name, valueStart := l.tag()
+	d.FieldStruct("tag", func(d *decode.D) {
+		if valueStart == -1 {
+			lineparse.FieldStr(d, l.start, l.end, "name", name, tagNameMap)
+			return
+		}
+		lineparse.FieldStr(d, l.start, valueStart, "name", name, tagNameMap)
+		value := l.text[valueStart-l.start:]
+
+		switch tagInfos[name].kind {
+		case tagKindInteger:
+			fieldSpanU(d, valueStart, l.end, "value", value)
+		case tagKindExtinf:
+			// #EXTINF:<duration>,[<title>]
+			duration, title, hasTitle := cut(value, ',')
+			if !hasTitle || title == "" {
+				fieldSpanF(d, valueStart, l.end, "duration", duration)
+				return
+			}
+			fieldSpanF(d, valueStart, valueStart+len(duration)+1, "duration", duration)
+			lineparse.FieldStr(d, valueStart+len(duration)+1, l.end, "title", title)
+		case tagKindByterange:
+			fieldByterange(d, valueStart, valueStart, l.end, value)
+		case tagKindAttributes:
+			fieldAttributes(d, b, l, valueStart)
+		default:
+			lineparse.FieldStr(d, valueStart, l.end, "value", value)
+		}
+	})
+}
+
+func fieldTags(d *decode.D, b []byte, tags []line) {
+	d.FieldArray("tags", func(d *decode.D) {
+		for _, l := range tags {
+			fieldTag(d, b, l)
+		}
+	})
+}
+
+func fieldEntries(d *decode.D, b []byte, name string, elmName string, entries []entry) {
+	d.FieldArray(name, func(d *decode.D) {
+		for _, e := range entries {
+			d.FieldStruct(elmName, func(d *decode.D) {
+				fieldTags(d, b, e.tags)
+				lineparse.FieldStr(d, e.uri.start, e.uri.end, "uri", e.uri.text)
+			})
+		}
+	})
+}
+
+func m3u8Decode(d *decode.D, in interface{}) interface{} {
+	b := d.BytesLen(int(d.Len() / 8))
+	d.SeekAbs(0)
+
+	var lines []line
+	for pos := 0; pos < len(b); {
+		end := len(b)
+		if i := bytes.IndexByte(b[pos:], '\n'); i != -1 {
+			end = pos + i + 1
+		}
+		text := strings.TrimRight(string(b[pos:end]), "\r\n")
+		lines = append(lines, line{start: pos, end: end, text: text})
+		pos = end
+	}
+	if len(lines) == 0 || lines[0].text != headerTag {
+		d.Fatalf("no %s header", headerTag)
+	}
+
+	var playlistTags []line
+	var pendingTags []line
+	var comments []line
+	var segments []entry
+	var variantStreams []entry
+
+	for _, l := range lines[1:] {
+		switch {
+		case strings.TrimSpace(l.text) == "":
+			// empty line
+		case strings.HasPrefix(l.text, "#EXT"):
+			name, _ := l.tag()
+			if tagInfos[name].playlist {
+				playlistTags = append(playlistTags, l)
+			} else {
+				pendingTags = append(pendingTags, l)
+			}
+		case strings.HasPrefix(l.text, "#"):
+			comments = append(comments, l)
+		default:
+			e := entry{tags: pendingTags, uri: l}
+			pendingTags = nil
+			isVariantStream := false
+			for _, t := range e.tags {
+				if name, _ := t.tag(); name == "EXT-X-STREAM-INF" {
+					isVariantStream = true
+				}
+			}
+			if isVariantStream {
+				variantStreams = append(variantStreams, e)
+			} else {
+				segments = append(segments, e)
+			}
+		}
+	}
+	// tags after last URI, ex partial segments of next segment, applies to playlist
+	playlistTags = append(playlistTags, pendingTags...)
+	sort.Slice(playlistTags, func(i, j int) bool { return playlistTags[i].start < playlistTags[j].start })
+
+	lineparse.FieldStr(d, lines[0].start, lines[0].end, "header", lines[0].text)
+	if len(comments) > 0 {
+		d.FieldArray("comments", func(d *decode.D) {
+			for _, l := range comments {
+				lineparse.FieldStr(d, l.start, l.end, "comment", l.text[1:])
+			}
+		})
+	}
+	fieldTags(d, b, playlistTags)
+	if len(variantStreams) > 0 {
+		fieldEntries(d, b, "variant_streams", "variant_stream", variantStreams)
+	}
+	if len(segments) > 0 || len(variantStreams) == 0 {
+		fieldEntries(d, b, "segments", "segment", segments)
+	}
+
+	return nil
+}
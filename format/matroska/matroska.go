@@ -16,6 +16,7 @@ package matroska
 import (
 	"embed"
 	"fmt"
+	"time"
 
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/matroska/ebml"
@@ -30,6 +31,7 @@ import (
 var matroskaFS embed.FS
 
 var aacFrameFormat decode.Group
+var ac3Format decode.Group
 var av1CCRFormat decode.Group
 var av1FrameFormat decode.Group
 var flacFrameFormat decode.Group
@@ -56,9 +58,11 @@ func init() {
 		Name:        format.MATROSKA,
 		Description: "Matroska file",
 		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte{0x1a, 0x45, 0xdf, 0xa3}}},
 		DecodeFn:    matroskaDecode,
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.AAC_FRAME}, Group: &aacFrameFormat},
+			{Names: []string{format.AC3}, Group: &ac3Format},
 			{Names: []string{format.AV1_CCR}, Group: &av1CCRFormat},
 			{Names: []string{format.AV1_FRAME}, Group: &av1FrameFormat},
 			{Names: []string{format.AVC_AU}, Group: &mpegAVCAUFormat},
@@ -87,6 +91,8 @@ func init() {
 		"A_FLAC":           &flacFrameFormat,
 		"A_AAC":            &aacFrameFormat,
 		"A_OPUS":           &opusPacketFrameFormat,
+		"A_AC3":            &ac3Format,
+		"A_EAC3":           &ac3Format,
 		"V_VP8":            &vp8FrameFormat,
 		"V_VP9":            &vp9FrameFormat,
 		"V_AV1":            &av1FrameFormat,
@@ -138,11 +144,42 @@ type block struct {
 }
 
 type decodeContext struct {
-	currentTrack *track
-	tracks       []*track
-	blocks       []block
+	currentTrack   *track
+	tracks         []*track
+	blocks         []block
+	timestampScale uint64
 }
 
+// default TimestampScale, 1ms
+const defaultTimestampScale = 1_000_000
+
+// Date is nanoseconds since 2001-01-01T00:00:00 UTC
+var dateEpochDate = time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+var dateMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	s.Sym = dateEpochDate.Add(time.Duration(s.ActualS())).Format(time.RFC3339Nano)
+	return s, nil
+})
+
+// duration in ticks of scale nanoseconds
+func durationMap(scale uint64) scalar.Mapper {
+	return scalar.Fn(func(s scalar.S) (scalar.S, error) {
+		s.Description = time.Duration(s.ActualU() * scale).String()
+		return s, nil
+	})
+}
+
+// SeekID is the raw element ID of a top level element
+var seekIDMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	n := s.ActualU()
+	if a, ok := ebml_matroska.Segment[n]; ok {
+		s.Sym = a.Name
+	} else if a, ok := ebml.Global[n]; ok {
+		s.Sym = a.Name
+	}
+	return s, nil
+})
+
 func decodeMaster(d *decode.D, bitsLimit int64, tag ebml.Tag, dc *decodeContext) {
 	tagEndBit := d.Pos() + bitsLimit
 
@@ -201,9 +238,21 @@ func decodeMaster(d *decode.D, bitsLimit int64, tag ebml.Tag, dc *decodeContext)
 				case ebml.Integer:
 					d.FieldS("value", int(tagSize)*8, optionalMap(a.IntegerEnums))
 				case ebml.Uinteger:
-					v := d.FieldU("value", int(tagSize)*8, optionalMap(a.UintegerEnums))
-					if dc.currentTrack != nil && tagID == ebml_matroska.TrackNumberID {
+					var sm scalar.Mapper
+					switch tagID {
+					case ebml_matroska.CueTimeID,
+						ebml_matroska.CueDurationID:
+						sm = durationMap(dc.timestampScale)
+					case ebml_matroska.ChapterTimeStartID,
+						ebml_matroska.ChapterTimeEndID:
+						sm = durationMap(1)
+					}
+					v := d.FieldU("value", int(tagSize)*8, optionalMap(a.UintegerEnums), optionalMap(sm))
+					switch {
+					case dc.currentTrack != nil && tagID == ebml_matroska.TrackNumberID:
 						dc.currentTrack.number = int(v)
+					case tagID == ebml_matroska.TimestampScaleID:
+						dc.timestampScale = v
 					}
 				case ebml.Float:
 					d.FieldF("value", int(tagSize)*8)
@@ -215,28 +264,14 @@ func decodeMaster(d *decode.D, bitsLimit int64, tag ebml.Tag, dc *decodeContext)
 				case ebml.UTF8:
 					d.FieldUTF8NullFixedLen("value", int(tagSize))
 				case ebml.Date:
-					// TODO:
-					/*
-						proc type_date {size label _extra} {
-						    set s [clock scan {2001-01-01 00:00:00}]
-						    set frac 0
-						    switch $size {
-						        0 {}
-						        8 {
-						            set nano [int64]
-						            set s [clock add $s [expr $nano/1000000000] seconds]
-						            set frac [expr ($nano%1000000000)/1000000000.0]
-						        }
-						        default {
-						            bytes $size $label
-						            return
-						        }
-						    }
-
-						    entry $label "[clock format $s] ${frac}s" $size [expr [pos]-$size]
-						}
-					*/
-					d.FieldRawLen("value", int64(tagSize)*8)
+					switch tagSize {
+					case 0:
+						d.FieldValueS("value", 0, dateMap)
+					case 8:
+						d.FieldS64("value", dateMap)
+					default:
+						d.FieldRawLen("value", int64(tagSize)*8)
+					}
 				case ebml.Binary:
 					switch tagID {
 					case ebml_matroska.SimpleBlockID:
@@ -261,6 +296,12 @@ func decodeMaster(d *decode.D, bitsLimit int64, tag ebml.Tag, dc *decodeContext)
 						d.SeekRel(int64(tagSize) * 8)
 					case ebml_matroska.FileDataID:
 						d.FieldFormatLen("value", int64(tagSize)*8, imageFormat, nil)
+					case ebml_matroska.SeekIDID:
+						if tagSize > 0 && tagSize <= 4 {
+							d.FieldU("value", int(tagSize)*8, seekIDMap, scalar.Hex)
+						} else {
+							d.FieldRawLen("value", int64(tagSize)*8)
+						}
 					default:
 						d.FieldRawLen("value", int64(tagSize)*8)
 						// if tagID == CRC {
@@ -291,7 +332,7 @@ func matroskaDecode(d *decode.D, in interface{}) interface{} {
 	if d.PeekBits(32) != ebmlHeaderID {
 		d.Errorf("no EBML header found")
 	}
-	dc := &decodeContext{tracks: []*track{}}
+	dc := &decodeContext{tracks: []*track{}, timestampScale: defaultTimestampScale}
 	decodeMaster(d, d.BitsLeft(), ebml_matroska.Root, dc)
 
 	trackNumberToTrack := map[int]*track{}
@@ -369,7 +410,12 @@ func matroskaDecode(d *decode.D, in interface{}) interface{} {
 			}
 			t.formatInArg = format.HevcIn{LengthSize: hevcDcrOut.LengthSize} //nolint:gosimple
 		case "V_AV1":
-			t.parentD.FieldFormatRange("value", t.codecPrivatePos, t.codecPrivateTagSize, av1CCRFormat, nil)
+			dv, v := t.parentD.FieldFormatRange("value", t.codecPrivatePos, t.codecPrivateTagSize, av1CCRFormat, nil)
+			av1CCROut, ok := v.(format.AV1CCROut)
+			if dv != nil && !ok {
+				panic(fmt.Sprintf("expected AV1CCROut got %#+v", v))
+			}
+			t.formatInArg = format.AV1FrameIn{SequenceHeader: av1CCROut.SequenceHeader} //nolint:gosimple
 		case "V_VP9":
 			t.parentD.FieldFormatRange("value", t.codecPrivatePos, t.codecPrivateTagSize, vp9CFMFormat, nil)
 		default:
@@ -404,7 +450,11 @@ func matroskaDecode(d *decode.D, in interface{}) interface{} {
 			// TODO: fixed/unknown?
 			if t, ok := trackNumberToTrack[int(trackNumber)]; ok {
 				if f, ok := codecToFormat[t.codec]; ok {
-					d.FieldFormat("packet", *f, t.formatInArg)
+					_, v := d.FieldFormat("packet", *f, t.formatInArg)
+					// reference frame sizes are needed to decode following frames
+					if vo, ok := v.(format.VP9FrameOut); ok {
+						t.formatInArg = format.VP9FrameIn{RefFrameWidth: vo.RefFrameWidth, RefFrameHeight: vo.RefFrameHeight}
+					}
 				}
 			}
 
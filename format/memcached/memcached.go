@@ -0,0 +1,250 @@
+package memcached
+
+// https://github.com/memcached/memcached/wiki/BinaryProtocolRevamped
+// https://github.com/couchbase/kv_engine/blob/master/docs/BinaryProtocol.md flexible framing
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.MEMCACHED,
+		Description: "Memcached binary protocol packets",
+		Groups: []string{
+			format.TCP_STREAM,
+			format.UDP_PAYLOAD,
+		},
+		DecodeFn: memcachedDecode,
+	})
+}
+
+const (
+	magicAltRequest  = 0x08
+	magicAltResponse = 0x18
+	magicRequest     = 0x80
+	magicResponse    = 0x81
+)
+
+var magicNames = scalar.UToSymStr{
+	magicAltRequest:  "alt_request",
+	magicAltResponse: "alt_response",
+	magicRequest:     "request",
+	magicResponse:    "response",
+}
+
+const (
+	opGet           = 0x00
+	opSet           = 0x01
+	opAdd           = 0x02
+	opReplace       = 0x03
+	opDelete        = 0x04
+	opIncrement     = 0x05
+	opDecrement     = 0x06
+	opQuit          = 0x07
+	opFlush         = 0x08
+	opGetQ          = 0x09
+	opNoOp          = 0x0a
+	opVersion       = 0x0b
+	opGetK          = 0x0c
+	opGetKQ         = 0x0d
+	opAppend        = 0x0e
+	opPrepend       = 0x0f
+	opStat          = 0x10
+	opSetQ          = 0x11
+	opAddQ          = 0x12
+	opReplaceQ      = 0x13
+	opDeleteQ       = 0x14
+	opIncrementQ    = 0x15
+	opDecrementQ    = 0x16
+	opQuitQ         = 0x17
+	opFlushQ        = 0x18
+	opAppendQ       = 0x19
+	opPrependQ      = 0x1a
+	opVerbosity     = 0x1b
+	opTouch         = 0x1c
+	opGAT           = 0x1d
+	opGATQ          = 0x1e
+	opSASLListMechs = 0x20
+	opSASLAuth      = 0x21
+	opSASLStep      = 0x22
+	opGATK          = 0x23
+	opGATKQ         = 0x24
+)
+
+var opcodeNames = scalar.UToSymStr{
+	opGet:           "get",
+	opSet:           "set",
+	opAdd:           "add",
+	opReplace:       "replace",
+	opDelete:        "delete",
+	opIncrement:     "increment",
+	opDecrement:     "decrement",
+	opQuit:          "quit",
+	opFlush:         "flush",
+	opGetQ:          "getq",
+	opNoOp:          "noop",
+	opVersion:       "version",
+	opGetK:          "getk",
+	opGetKQ:         "getkq",
+	opAppend:        "append",
+	opPrepend:       "prepend",
+	opStat:          "stat",
+	opSetQ:          "setq",
+	opAddQ:          "addq",
+	opReplaceQ:      "replaceq",
+	opDeleteQ:       "deleteq",
+	opIncrementQ:    "incrementq",
+	opDecrementQ:    "decrementq",
+	opQuitQ:         "quitq",
+	opFlushQ:        "flushq",
+	opAppendQ:       "appendq",
+	opPrependQ:      "prependq",
+	opVerbosity:     "verbosity",
+	opTouch:         "touch",
+	opGAT:           "gat",
+	opGATQ:          "gatq",
+	opSASLListMechs: "sasl_list_mechs",
+	opSASLAuth:      "sasl_auth",
+	opSASLStep:      "sasl_step",
+	opGATK:          "gatk",
+	opGATKQ:         "gatkq",
+}
+
+var statusNames = scalar.UToSymStr{
+	0x0000: "no_error",
+	0x0001: "key_not_found",
+	0x0002: "key_exists",
+	0x0003: "value_too_large",
+	0x0004: "invalid_arguments",
+	0x0005: "item_not_stored",
+	0x0006: "incr_decr_on_non_numeric_value",
+	0x0007: "vbucket_belongs_to_another_server",
+	0x0008: "authentication_error",
+	0x0009: "authentication_continue",
+	0x0081: "unknown_command",
+	0x0082: "out_of_memory",
+	0x0083: "not_supported",
+	0x0084: "internal_error",
+	0x0085: "busy",
+	0x0086: "temporary_failure",
+}
+
+var dataTypeNames = scalar.UToSymStr{
+	0x00: "raw",
+}
+
+var expirationMap = scalar.UToScalar{0: {Description: "never"}}
+
+func decodeExtras(d *decode.D, isRequest bool, opcode uint64) {
+	if !isRequest {
+		switch opcode {
+		case opGet, opGetQ, opGetK, opGetKQ, opGAT, opGATQ, opGATK, opGATKQ:
+			d.FieldU32("flags", scalar.Hex)
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+		return
+	}
+
+	switch opcode {
+	case opSet, opAdd, opReplace, opSetQ, opAddQ, opReplaceQ:
+		d.FieldU32("flags", scalar.Hex)
+		d.FieldU32("expiration", expirationMap)
+	case opIncrement, opDecrement, opIncrementQ, opDecrementQ:
+		d.FieldU64("amount")
+		d.FieldU64("initial_value")
+		d.FieldU32("expiration", expirationMap)
+	case opFlush, opFlushQ, opTouch, opGAT, opGATQ, opGATK, opGATKQ:
+		d.FieldU32("expiration", expirationMap)
+	case opVerbosity:
+		d.FieldU32("verbosity")
+	default:
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+}
+
+func decodePacket(d *decode.D) {
+	var isRequest bool
+	var opcode uint64
+	var framingExtrasLen uint64
+	var keyLen uint64
+	var extrasLen uint64
+	var bodyLen uint64
+
+	d.FieldStruct("header", func(d *decode.D) {
+		magic := d.FieldU8("magic", magicNames, scalar.Hex)
+		isRequest = magic == magicRequest || magic == magicAltRequest
+		opcode = d.FieldU8("opcode", opcodeNames, scalar.Hex)
+		if magic == magicAltRequest || magic == magicAltResponse {
+			framingExtrasLen = d.FieldU8("framing_extras_length")
+			keyLen = d.FieldU8("key_length")
+		} else {
+			keyLen = d.FieldU16("key_length")
+		}
+		extrasLen = d.FieldU8("extras_length")
+		d.FieldU8("data_type", dataTypeNames)
+		if isRequest {
+			d.FieldU16("vbucket_id")
+		} else {
+			d.FieldU16("status", statusNames)
+		}
+		bodyLen = d.FieldU32("total_body_length")
+		d.FieldU32("opaque", scalar.Hex)
+		d.FieldU64("cas")
+	})
+
+	if framingExtrasLen+extrasLen+keyLen > bodyLen {
+		d.Fatalf("framing extras, extras and key length larger than body")
+	}
+
+	if framingExtrasLen > 0 {
+		d.FieldRawLen("framing_extras", int64(framingExtrasLen)*8)
+	}
+	if extrasLen > 0 {
+		d.FieldStruct("extras", func(d *decode.D) {
+			d.LenFn(int64(extrasLen)*8, func(d *decode.D) {
+				decodeExtras(d, isRequest, opcode)
+			})
+		})
+	}
+	if keyLen > 0 {
+		d.FieldUTF8("key", int(keyLen))
+	}
+	valueLen := bodyLen - framingExtrasLen - extrasLen - keyLen
+	if valueLen > 0 {
+		d.FieldRawLen("value", int64(valueLen)*8)
+	}
+}
+
+func memcachedDecode(d *decode.D, in interface{}) interface{} {
+	if tsi, ok := in.(format.TCPStreamIn); ok {
+		if tsi.DestinationPort != format.TCPPortMemcached && tsi.SourcePort != format.TCPPortMemcached {
+			d.Fatalf("wrong port")
+		}
+	}
+	if udi, ok := in.(format.UDPDatagramIn); ok {
+		if udi.DestinationPort != format.UDPPortMemcached && udi.SourcePort != format.UDPPortMemcached {
+			d.Fatalf("wrong port")
+		}
+		d.FieldStruct("frame_header", func(d *decode.D) {
+			d.FieldU16("request_id")
+			d.FieldU16("sequence_number")
+			d.FieldU16("datagram_count")
+			d.FieldU16("reserved")
+		})
+	}
+
+	switch d.PeekBits(8) {
+	case magicRequest, magicResponse, magicAltRequest, magicAltResponse:
+	default:
+		d.Fatalf("not a binary protocol packet")
+	}
+
+	d.FieldStructArrayLoop("packets", "packet", d.NotEnd, decodePacket)
+
+	return nil
+}
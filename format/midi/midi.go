@@ -0,0 +1,371 @@
+package midi
+
+// https://www.midi.org/specifications/file-format-specifications/standard-midi-files
+// http://www.music.mcgill.ca/~ich/classes/mumt306/StandardMIDIfileformat.html
+// https://www.midi.org/specifications-old/item/table-3-control-change-messages-data-bytes-2
+
+import (
+	"fmt"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.MIDI,
+		Description: "Standard MIDI file",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte("MThd")}},
+		DecodeFn:    midiDecode,
+	})
+}
+
+var fileFormatNames = scalar.UToSymStr{
+	0: "single_track",
+	1: "multi_track",
+	2: "multi_song",
+}
+
+const (
+	statusNoteOff         = 0x8
+	statusNoteOn          = 0x9
+	statusPolyAftertouch  = 0xa
+	statusControlChange   = 0xb
+	statusProgramChange   = 0xc
+	statusChannelPressure = 0xd
+	statusPitchBend       = 0xe
+)
+
+var channelMessageNames = scalar.UToSymStr{
+	statusNoteOff:         "note_off",
+	statusNoteOn:          "note_on",
+	statusPolyAftertouch:  "polyphonic_aftertouch",
+	statusControlChange:   "control_change",
+	statusProgramChange:   "program_change",
+	statusChannelPressure: "channel_pressure",
+	statusPitchBend:       "pitch_bend",
+}
+
+const (
+	statusSysEx       = 0xf0
+	statusSysExEscape = 0xf7
+	statusMeta        = 0xff
+)
+
+var statusNames = scalar.UToSymStr{
+	statusSysEx:       "sysex",
+	statusSysExEscape: "sysex_escape",
+	statusMeta:        "meta",
+}
+
+const (
+	metaSequenceNumber    = 0x00
+	metaText              = 0x01
+	metaCopyright         = 0x02
+	metaTrackName         = 0x03
+	metaInstrumentName    = 0x04
+	metaLyric             = 0x05
+	metaMarker            = 0x06
+	metaCuePoint          = 0x07
+	metaProgramName       = 0x08
+	metaDeviceName        = 0x09
+	metaChannelPrefix     = 0x20
+	metaPort              = 0x21
+	metaEndOfTrack        = 0x2f
+	metaTempo             = 0x51
+	metaSMPTEOffset       = 0x54
+	metaTimeSignature     = 0x58
+	metaKeySignature      = 0x59
+	metaSequencerSpecific = 0x7f
+)
+
+var metaTypeNames = scalar.UToSymStr{
+	metaSequenceNumber:    "sequence_number",
+	metaText:              "text",
+	metaCopyright:         "copyright",
+	metaTrackName:         "track_name",
+	metaInstrumentName:    "instrument_name",
+	metaLyric:             "lyric",
+	metaMarker:            "marker",
+	metaCuePoint:          "cue_point",
+	metaProgramName:       "program_name",
+	metaDeviceName:        "device_name",
+	metaChannelPrefix:     "channel_prefix",
+	metaPort:              "port",
+	metaEndOfTrack:        "end_of_track",
+	metaTempo:             "tempo",
+	metaSMPTEOffset:       "smpte_offset",
+	metaTimeSignature:     "time_signature",
+	metaKeySignature:      "key_signature",
+	metaSequencerSpecific: "sequencer_specific",
+}
+
+var controllerNames = scalar.UToSymStr{
+	0:   "bank_select_msb",
+	1:   "modulation_wheel_msb",
+	2:   "breath_controller_msb",
+	4:   "foot_controller_msb",
+	5:   "portamento_time_msb",
+	6:   "data_entry_msb",
+	7:   "channel_volume_msb",
+	8:   "balance_msb",
+	10:  "pan_msb",
+	11:  "expression_controller_msb",
+	12:  "effect_control_1_msb",
+	13:  "effect_control_2_msb",
+	16:  "general_purpose_controller_1_msb",
+	17:  "general_purpose_controller_2_msb",
+	18:  "general_purpose_controller_3_msb",
+	19:  "general_purpose_controller_4_msb",
+	32:  "bank_select_lsb",
+	33:  "modulation_wheel_lsb",
+	34:  "breath_controller_lsb",
+	36:  "foot_controller_lsb",
+	37:  "portamento_time_lsb",
+	38:  "data_entry_lsb",
+	39:  "channel_volume_lsb",
+	40:  "balance_lsb",
+	42:  "pan_lsb",
+	43:  "expression_controller_lsb",
+	44:  "effect_control_1_lsb",
+	45:  "effect_control_2_lsb",
+	48:  "general_purpose_controller_1_lsb",
+	49:  "general_purpose_controller_2_lsb",
+	50:  "general_purpose_controller_3_lsb",
+	51:  "general_purpose_controller_4_lsb",
+	64:  "sustain_pedal",
+	65:  "portamento",
+	66:  "sostenuto",
+	67:  "soft_pedal",
+	68:  "legato_footswitch",
+	69:  "hold_2",
+	70:  "sound_variation",
+	71:  "timbre_harmonic_intensity",
+	72:  "release_time",
+	73:  "attack_time",
+	74:  "brightness",
+	75:  "sound_controller_6",
+	76:  "sound_controller_7",
+	77:  "sound_controller_8",
+	78:  "sound_controller_9",
+	79:  "sound_controller_10",
+	80:  "general_purpose_controller_5",
+	81:  "general_purpose_controller_6",
+	82:  "general_purpose_controller_7",
+	83:  "general_purpose_controller_8",
+	84:  "portamento_control",
+	88:  "high_resolution_velocity_prefix",
+	91:  "effects_1_depth",
+	92:  "effects_2_depth",
+	93:  "effects_3_depth",
+	94:  "effects_4_depth",
+	95:  "effects_5_depth",
+	96:  "data_increment",
+	97:  "data_decrement",
+	98:  "nrpn_lsb",
+	99:  "nrpn_msb",
+	100: "rpn_lsb",
+	101: "rpn_msb",
+	120: "all_sound_off",
+	121: "reset_all_controllers",
+	122: "local_control",
+	123: "all_notes_off",
+	124: "omni_mode_off",
+	125: "omni_mode_on",
+	126: "mono_mode_on",
+	127: "poly_mode_on",
+}
+
+var noteNames = [12]string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
+// note 60 is middle C (C4)
+var noteMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	u, ok := s.Actual.(uint64)
+	if !ok {
+		return s, nil
+	}
+	s.Sym = fmt.Sprintf("%s%d", noteNames[u%12], int(u/12)-1)
+	return s, nil
+})
+
+var keyModeNames = scalar.UToSymStr{
+	0: "major",
+	1: "minor",
+}
+
+var smpteFrameRateNames = scalar.UToSymStr{
+	0: "24",
+	1: "25",
+	2: "29.97",
+	3: "30",
+}
+
+// variable length quantity, 7 bits per byte most significant group first
+func vlq(d *decode.D) uint64 {
+	var v uint64
+	for i := 0; ; i++ {
+		if i == 4 {
+			d.Fatalf("variable length quantity too long")
+		}
+		b := d.U8()
+		v = v<<7 | b&0x7f
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	return v
+}
+
+func fieldVLQ(d *decode.D, name string, sms ...scalar.Mapper) uint64 {
+	return d.FieldUFn(name, vlq, sms...)
+}
+
+func decodeMetaEvent(d *decode.D) {
+	typ := d.FieldU8("meta_type", metaTypeNames)
+	length := fieldVLQ(d, "length")
+	d.LenFn(int64(length)*8, func(d *decode.D) {
+		switch typ {
+		case metaSequenceNumber:
+			if d.BitsLeft() == 16 {
+				d.FieldU16("sequence_number")
+			}
+		case metaText, metaCopyright, metaTrackName, metaInstrumentName, metaLyric,
+			metaMarker, metaCuePoint, metaProgramName, metaDeviceName:
+			d.FieldUTF8("text", int(length))
+		case metaChannelPrefix:
+			d.FieldU8("channel")
+		case metaPort:
+			d.FieldU8("port")
+		case metaEndOfTrack:
+		case metaTempo:
+			d.FieldU24("microseconds_per_quarter_note")
+		case metaSMPTEOffset:
+			d.FieldU1("unused")
+			d.FieldU2("frame_rate", smpteFrameRateNames)
+			d.FieldU5("hours")
+			d.FieldU8("minutes")
+			d.FieldU8("seconds")
+			d.FieldU8("frames")
+			d.FieldU8("fractional_frames")
+		case metaTimeSignature:
+			d.FieldU8("numerator")
+			d.FieldU8("denominator", scalar.Fn(func(s scalar.S) (scalar.S, error) {
+				s.Sym = uint64(1) << s.ActualU()
+				return s, nil
+			}))
+			d.FieldU8("clocks_per_click")
+			d.FieldU8("thirty_seconds_per_quarter_note")
+		case metaKeySignature:
+			d.FieldS8("sharps_flats")
+			d.FieldU8("mode", keyModeNames)
+		}
+		if d.NotEnd() {
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+}
+
+func decodeChannelMessage(d *decode.D, typ uint64) {
+	switch typ {
+	case statusNoteOff, statusNoteOn:
+		d.FieldU8("note", noteMap)
+		d.FieldU8("velocity")
+	case statusPolyAftertouch:
+		d.FieldU8("note", noteMap)
+		d.FieldU8("pressure")
+	case statusControlChange:
+		d.FieldU8("controller", controllerNames)
+		d.FieldU8("value")
+	case statusProgramChange:
+		d.FieldU8("program")
+	case statusChannelPressure:
+		d.FieldU8("pressure")
+	case statusPitchBend:
+		// 14 bit value, least significant 7 bits first, 0x2000 is center
+		d.FieldSFn("value", func(d *decode.D) int64 {
+			lsb := d.U8()
+			msb := d.U8()
+			return int64(msb<<7|lsb) - 0x2000
+		})
+	}
+}
+
+func decodeTrack(d *decode.D) {
+	var runningStatus uint64
+
+	d.FieldStructArrayLoop("events", "event", d.NotEnd, func(d *decode.D) {
+		fieldVLQ(d, "delta_time")
+
+		status := d.PeekBits(8)
+		switch {
+		case status == statusMeta:
+			d.FieldU8("status", statusNames)
+			runningStatus = 0
+			decodeMetaEvent(d)
+		case status == statusSysEx || status == statusSysExEscape:
+			d.FieldU8("status", statusNames)
+			runningStatus = 0
+			length := fieldVLQ(d, "length")
+			d.FieldRawLen("data", int64(length)*8)
+		case status >= 0x80:
+			runningStatus = status
+			typ := d.FieldU4("type", channelMessageNames)
+			d.FieldU4("channel")
+			decodeChannelMessage(d, typ)
+		default:
+			if runningStatus == 0 {
+				d.Fatalf("data byte without running status")
+			}
+			// running status, reuse status of previous channel message
+			typ := runningStatus >> 4
+			d.FieldValueU("type", typ, channelMessageNames)
+			d.FieldValueU("channel", runningStatus&0xf)
+			decodeChannelMessage(d, typ)
+		}
+	})
+}
+
+func decodeChunk(d *decode.D, expectedID string) {
+	var sms []scalar.Mapper
+	if expectedID != "" {
+		sms = append(sms, d.AssertStr(expectedID))
+	}
+	id := d.FieldUTF8("id", 4, sms...)
+	length := d.FieldU32("length")
+	d.LenFn(int64(length)*8, func(d *decode.D) {
+		switch id {
+		case "MThd":
+			d.FieldU16("format", fileFormatNames)
+			d.FieldU16("tracks")
+			smpte := d.FieldBool("smpte")
+			if smpte {
+				d.FieldS7("frames_per_second", scalar.SToScalar{
+					-24: {Sym: 24},
+					-25: {Sym: 25},
+					-29: {Sym: 29.97},
+					-30: {Sym: 30},
+				})
+				d.FieldU8("ticks_per_frame")
+			} else {
+				d.FieldU15("ticks_per_quarter_note")
+			}
+			if d.NotEnd() {
+				d.FieldRawLen("unknown", d.BitsLeft())
+			}
+		case "MTrk":
+			decodeTrack(d)
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+}
+
+func midiDecode(d *decode.D, in interface{}) interface{} {
+	d.FieldStruct("header", func(d *decode.D) { decodeChunk(d, "MThd") })
+	d.FieldStructArrayLoop("chunks", "chunk", d.NotEnd, func(d *decode.D) { decodeChunk(d, "") })
+
+	return nil
+}
@@ -0,0 +1,395 @@
+package minidump
+
+// https://docs.microsoft.com/en-us/windows/win32/api/minidumpapiset/
+// https://github.com/libyal/libmdmp/blob/main/documentation/Minidump%20(MDMP)%20format.asciidoc
+
+// TODO: exception, handle data, unloaded module and memory info streams
+// TODO: thread context per processor architecture
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.MINIDUMP,
+		Description: "Windows minidump",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte("MDMP\x93\xa7")}},
+		DecodeFn:    minidumpDecode,
+	})
+}
+
+const (
+	headerSignature = "MDMP"
+	headerVersion   = 0xa793
+)
+
+const (
+	streamTypeThreadList   = 3
+	streamTypeModuleList   = 4
+	streamTypeMemoryList   = 5
+	streamTypeSystemInfo   = 7
+	streamTypeMemory64List = 9
+	streamTypeCommentA     = 10
+	streamTypeCommentW     = 11
+)
+
+var streamTypeNames = scalar.UToSymStr{
+	0:                      "unused",
+	1:                      "reserved0",
+	2:                      "reserved1",
+	streamTypeThreadList:   "thread_list",
+	streamTypeModuleList:   "module_list",
+	streamTypeMemoryList:   "memory_list",
+	6:                      "exception",
+	streamTypeSystemInfo:   "system_info",
+	8:                      "thread_ex_list",
+	streamTypeMemory64List: "memory64_list",
+	streamTypeCommentA:     "comment_a",
+	streamTypeCommentW:     "comment_w",
+	12:                     "handle_data",
+	13:                     "function_table",
+	14:                     "unloaded_module_list",
+	15:                     "misc_info",
+	16:                     "memory_info_list",
+	17:                     "thread_info_list",
+	18:                     "handle_operation_list",
+	19:                     "token",
+	20:                     "javascript_data",
+	21:                     "system_memory_info",
+	22:                     "process_vm_counters",
+	23:                     "ipt_trace",
+	24:                     "thread_names",
+	0xffff:                 "last_reserved",
+}
+
+const processorArchitectureIntel = 0
+
+var processorArchitectureNames = scalar.UToSymStr{
+	processorArchitectureIntel: "intel",
+	1:                          "mips",
+	2:                          "alpha",
+	3:                          "ppc",
+	4:                          "shx",
+	5:                          "arm",
+	6:                          "ia64",
+	7:                          "alpha64",
+	8:                          "msil",
+	9:                          "amd64",
+	10:                         "ia32_on_win64",
+	12:                         "arm64",
+	0xffff:                     "unknown",
+}
+
+var productTypeNames = scalar.UToSymStr{
+	1: "workstation",
+	2: "domain_controller",
+	3: "server",
+}
+
+var platformIDNames = scalar.UToSymStr{
+	0: "win32s",
+	1: "win32_windows",
+	2: "win32_nt",
+}
+
+var unixTimeMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	uv, ok := s.Actual.(uint64)
+	if !ok || uv == 0 {
+		return s, nil
+	}
+	s.Description = time.Unix(int64(uv), 0).UTC().Format(time.RFC3339)
+	return s, nil
+})
+
+// GUID with first three groups in little endian
+func fieldGUID(d *decode.D, name string) {
+	b := d.PeekBytes(16)
+	d.FieldRawLen(name, 16*8, scalar.Sym(fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(b[0:4]),
+		binary.LittleEndian.Uint16(b[4:6]),
+		binary.LittleEndian.Uint16(b[6:8]),
+		b[8:10],
+		b[10:16],
+	)))
+}
+
+// rva is relative to start of file, data referenced is decoded into the
+// struct with the rva. Data outside of file, ex in truncated dumps, is skipped
+func rvaFn(d *decode.D, rva uint64, size uint64, fn func(d *decode.D)) {
+	if rva == 0 || (rva+size)*8 > uint64(d.Len()) {
+		return
+	}
+	pos := d.Pos()
+	d.SeekAbs(int64(rva) * 8)
+	fn(d)
+	d.SeekAbs(pos)
+}
+
+// MINIDUMP_STRING, length in bytes excluding null terminator
+func fieldString(d *decode.D, name string, rva uint64) {
+	rvaFn(d, rva, 4, func(d *decode.D) {
+		d.FieldStruct(name, func(d *decode.D) {
+			length := d.FieldU32("length")
+			if (d.Pos()/8)+int64(length) > d.Len()/8 {
+				d.Fatalf("%s: length %d outside file", name, length)
+			}
+			d.FieldUTF16LE("value", int(length))
+		})
+	})
+}
+
+// MINIDUMP_LOCATION_DESCRIPTOR
+func fieldLocation(d *decode.D, name string, fn func(d *decode.D, size uint64)) {
+	d.FieldStruct(name, func(d *decode.D) {
+		size := d.FieldU32("data_size")
+		rva := d.FieldU32("rva")
+		rvaFn(d, rva, size, func(d *decode.D) { fn(d, size) })
+	})
+}
+
+func fieldRawData(d *decode.D, size uint64) {
+	d.FieldRawLen("data", int64(size)*8)
+}
+
+// MINIDUMP_MEMORY_DESCRIPTOR
+func decodeMemoryDescriptor(d *decode.D) {
+	d.FieldU64("start_of_memory_range", scalar.Hex)
+	size := d.FieldU32("data_size")
+	rva := d.FieldU32("rva")
+	rvaFn(d, rva, size, func(d *decode.D) { fieldRawData(d, size) })
+}
+
+func decodeThreadList(d *decode.D, size uint64) {
+	const threadSize = 48
+	n := d.FieldU32("number_of_threads")
+	if 4+n*threadSize > size {
+		d.Fatalf("%d threads does not fit in stream size %d", n, size)
+	}
+	d.FieldArray("threads", func(d *decode.D) {
+		for i := uint64(0); i < n; i++ {
+			d.FieldStruct("thread", func(d *decode.D) {
+				d.FieldU32("thread_id")
+				d.FieldU32("suspend_count")
+				d.FieldU32("priority_class", scalar.Hex)
+				d.FieldU32("priority")
+				d.FieldU64("teb", scalar.Hex)
+				d.FieldStruct("stack", decodeMemoryDescriptor)
+				fieldLocation(d, "thread_context", func(d *decode.D, size uint64) { fieldRawData(d, size) })
+			})
+		}
+	})
+}
+
+// CodeView record, PDB 7.0 "RSDS" is the only one used by modern toolchains
+func decodeCVRecord(d *decode.D, size uint64) {
+	if size < 24 || string(d.PeekBytes(4)) != "RSDS" {
+		fieldRawData(d, size)
+		return
+	}
+	d.FieldUTF8("signature", 4)
+	fieldGUID(d, "guid")
+	d.FieldU32("age")
+	d.FieldUTF8NullFixedLen("pdb_file_name", int(size-24))
+}
+
+func decodeModuleList(d *decode.D, size uint64) {
+	const moduleSize = 108
+	n := d.FieldU32("number_of_modules")
+	if 4+n*moduleSize > size {
+		d.Fatalf("%d modules does not fit in stream size %d", n, size)
+	}
+	d.FieldArray("modules", func(d *decode.D) {
+		for i := uint64(0); i < n; i++ {
+			d.FieldStruct("module", func(d *decode.D) {
+				d.FieldU64("base_of_image", scalar.Hex)
+				d.FieldU32("size_of_image")
+				d.FieldU32("checksum", scalar.Hex)
+				d.FieldU32("time_date_stamp", unixTimeMap)
+				nameRVA := d.FieldU32("module_name_rva")
+				fieldString(d, "module_name", nameRVA)
+				// VS_FIXEDFILEINFO
+				d.FieldStruct("version_info", func(d *decode.D) {
+					d.FieldU32("signature", scalar.Hex)
+					d.FieldU32("struct_version", scalar.Hex)
+					d.FieldU32("file_version_ms", scalar.Hex)
+					d.FieldU32("file_version_ls", scalar.Hex)
+					d.FieldU32("product_version_ms", scalar.Hex)
+					d.FieldU32("product_version_ls", scalar.Hex)
+					d.FieldU32("file_flags_mask", scalar.Hex)
+					d.FieldU32("file_flags", scalar.Hex)
+					d.FieldU32("file_os", scalar.Hex)
+					d.FieldU32("file_type")
+					d.FieldU32("file_subtype")
+					d.FieldU32("file_date_ms")
+					d.FieldU32("file_date_ls")
+				})
+				fieldLocation(d, "cv_record", decodeCVRecord)
+				fieldLocation(d, "misc_record", func(d *decode.D, size uint64) { fieldRawData(d, size) })
+				d.FieldU64("reserved0")
+				d.FieldU64("reserved1")
+			})
+		}
+	})
+}
+
+func decodeMemoryList(d *decode.D, size uint64) {
+	const descriptorSize = 16
+	n := d.FieldU32("number_of_memory_ranges")
+	if 4+n*descriptorSize > size {
+		d.Fatalf("%d memory ranges does not fit in stream size %d", n, size)
+	}
+	d.FieldArray("memory_ranges", func(d *decode.D) {
+		for i := uint64(0); i < n; i++ {
+			d.FieldStruct("memory_range", decodeMemoryDescriptor)
+		}
+	})
+}
+
+// memory of all ranges is stored consecutively starting at base_rva
+func decodeMemory64List(d *decode.D, size uint64) {
+	const descriptorSize = 16
+	n := d.FieldU64("number_of_memory_ranges")
+	rva := d.FieldU64("base_rva")
+	if 16+n*descriptorSize > size {
+		d.Fatalf("%d memory ranges does not fit in stream size %d", n, size)
+	}
+	d.FieldArray("memory_ranges", func(d *decode.D) {
+		for i := uint64(0); i < n; i++ {
+			d.FieldStruct("memory_range", func(d *decode.D) {
+				d.FieldU64("start_of_memory_range", scalar.Hex)
+				size := d.FieldU64("data_size")
+				rvaFn(d, rva, size, func(d *decode.D) { fieldRawData(d, size) })
+				rva += size
+			})
+		}
+	})
+}
+
+func decodeSystemInfo(d *decode.D, size uint64) {
+	const systemInfoSize = 56
+	if size < systemInfoSize {
+		d.Fatalf("stream size %d too small for system info", size)
+	}
+	arch := d.FieldU16("processor_architecture", processorArchitectureNames)
+	d.FieldU16("processor_level")
+	d.FieldU16("processor_revision", scalar.Hex)
+	d.FieldU8("number_of_processors")
+	d.FieldU8("product_type", productTypeNames)
+	d.FieldU32("major_version")
+	d.FieldU32("minor_version")
+	d.FieldU32("build_number")
+	d.FieldU32("platform_id", platformIDNames)
+	csdVersionRVA := d.FieldU32("csd_version_rva")
+	fieldString(d, "csd_version", csdVersionRVA)
+	d.FieldU16("suite_mask", scalar.Hex)
+	d.FieldU16("reserved2")
+	d.FieldStruct("cpu", func(d *decode.D) {
+		if arch == processorArchitectureIntel {
+			d.FieldUTF8("vendor_id", 12)
+			d.FieldU32("version_information", scalar.Hex)
+			d.FieldU32("feature_information", scalar.Hex)
+			d.FieldU32("amd_extended_cpu_features", scalar.Hex)
+		} else {
+			d.FieldArray("processor_features", func(d *decode.D) {
+				d.FieldU64("processor_feature", scalar.Hex)
+				d.FieldU64("processor_feature", scalar.Hex)
+			})
+			d.FieldRawLen("unused", 8*8)
+		}
+	})
+}
+
+func minidumpDecode(d *decode.D, in interface{}) interface{} {
+	d.Endian = decode.LittleEndian
+
+	var numberOfStreams uint64
+	var streamDirectoryRVA uint64
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldUTF8("signature", 4, d.AssertStr(headerSignature))
+		d.FieldU16("version", d.AssertU(headerVersion), scalar.Hex)
+		d.FieldU16("implementation_version", scalar.Hex)
+		numberOfStreams = d.FieldU32("number_of_streams")
+		streamDirectoryRVA = d.FieldU32("stream_directory_rva")
+		d.FieldU32("checksum", scalar.Hex)
+		d.FieldU32("time_date_stamp", unixTimeMap)
+		d.FieldStruct("flags", func(d *decode.D) {
+			// TODO: 64LE, should have some kind of native endian flag reader helper?
+			d.FieldBool("filter_module_paths")
+			d.FieldBool("with_indirectly_referenced_memory")
+			d.FieldBool("with_unloaded_modules")
+			d.FieldBool("scan_memory")
+			d.FieldBool("filter_memory")
+			d.FieldBool("with_handle_data")
+			d.FieldBool("with_full_memory")
+			d.FieldBool("with_data_segs")
+
+			d.FieldBool("with_full_auxiliary_state")
+			d.FieldBool("without_auxiliary_state")
+			d.FieldBool("with_code_segs")
+			d.FieldBool("with_thread_info")
+			d.FieldBool("with_full_memory_info")
+			d.FieldBool("without_optional_data")
+			d.FieldBool("with_private_read_write_memory")
+			d.FieldBool("with_process_thread_data")
+
+			d.FieldBool("scan_inaccessible_partial_pages")
+			d.FieldBool("with_ipt_trace")
+			d.FieldBool("with_avx_xstate_context")
+			d.FieldBool("filter_triage")
+			d.FieldBool("with_module_headers")
+			d.FieldBool("with_token_information")
+			d.FieldBool("ignore_inaccessible_memory")
+			d.FieldBool("with_private_write_copy_memory")
+
+			d.FieldU7("unused0")
+			d.FieldBool("filter_write_combined_memory")
+			d.FieldU32("unused1")
+		})
+	})
+
+	const directorySize = 12
+	if (streamDirectoryRVA+numberOfStreams*directorySize)*8 > uint64(d.Len()) {
+		d.Fatalf("stream directory outside file")
+	}
+	d.SeekAbs(int64(streamDirectoryRVA) * 8)
+	d.FieldArray("streams", func(d *decode.D) {
+		for i := uint64(0); i < numberOfStreams; i++ {
+			d.FieldStruct("stream", func(d *decode.D) {
+				typ := d.FieldU32("stream_type", streamTypeNames)
+				size := d.FieldU32("data_size")
+				rva := d.FieldU32("rva")
+				rvaFn(d, rva, size, func(d *decode.D) {
+					switch typ {
+					case streamTypeThreadList:
+						decodeThreadList(d, size)
+					case streamTypeModuleList:
+						decodeModuleList(d, size)
+					case streamTypeMemoryList:
+						decodeMemoryList(d, size)
+					case streamTypeSystemInfo:
+						decodeSystemInfo(d, size)
+					case streamTypeMemory64List:
+						decodeMemory64List(d, size)
+					case streamTypeCommentA:
+						d.FieldUTF8NullFixedLen("comment", int(size))
+					case streamTypeCommentW:
+						d.FieldUTF16LE("comment", int(size))
+					default:
+						fieldRawData(d, size)
+					}
+				})
+			})
+		}
+	})
+
+	return nil
+}
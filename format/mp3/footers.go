@@ -0,0 +1,87 @@
+package mp3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/ranges"
+)
+
+const (
+	id3v1Len               = 128
+	enhancedTagLen         = 227
+	apeHeaderFooterLen     = 32
+	apeFlagsContainsHeader = 1 << 31
+	lyrics3V1MaxLen        = 5100
+	lyrics3V2TrailerLen    = 6 + 9
+)
+
+var (
+	id3v1Magic       = []byte("TAG")
+	enhancedTagMagic = []byte("TAG+")
+	apeMagic         = []byte("APETAGEX")
+	lyrics3Begin     = []byte("LYRICSBEGIN")
+	lyrics3V1End     = []byte("LYRICSEND")
+	lyrics3V2End     = []byte("LYRICS200")
+)
+
+// findFooters finds trailing tags by walking backwards from the end as some
+// of them can only be found by their footer. Usual order is APEv2, Lyrics3,
+// Enhanced TAG and last ID3v1 but any order and repeats are handled.
+// Returns bit ranges in file order.
+func findFooters(d *decode.D, firstBit int64) []ranges.Range {
+	start := firstBit / 8
+	end := d.Len() / 8
+	var rs []ranges.Range
+
+	peek := func(pos int64, n int64) []byte {
+		if pos < start || pos+n > end {
+			return nil
+		}
+		return d.BytesRange(pos*8, int(n))
+	}
+	hasMagic := func(pos int64, magic []byte) bool {
+		return bytes.Equal(peek(pos, int64(len(magic))), magic)
+	}
+
+	for {
+		pos := int64(-1)
+		switch {
+		case hasMagic(end-id3v1Len, id3v1Magic):
+			pos = end - id3v1Len
+		case hasMagic(end-enhancedTagLen, enhancedTagMagic):
+			pos = end - enhancedTagLen
+		case hasMagic(end-int64(len(lyrics3V2End)), lyrics3V2End):
+			n, err := strconv.ParseInt(string(peek(end-lyrics3V2TrailerLen, 6)), 10, 64)
+			if err == nil && hasMagic(end-lyrics3V2TrailerLen-n, lyrics3Begin) {
+				pos = end - lyrics3V2TrailerLen - n
+			}
+		case hasMagic(end-int64(len(lyrics3V1End)), lyrics3V1End):
+			searchStart := end - int64(len(lyrics3V1End)) - lyrics3V1MaxLen - int64(len(lyrics3Begin))
+			if searchStart < start {
+				searchStart = start
+			}
+			if i := bytes.LastIndex(peek(searchStart, end-searchStart), lyrics3Begin); i != -1 {
+				pos = searchStart + int64(i)
+			}
+		case hasMagic(end-apeHeaderFooterLen, apeMagic):
+			fb := peek(end-apeHeaderFooterLen, apeHeaderFooterLen)
+			// tag size includes footer but not header
+			pos = end - int64(binary.LittleEndian.Uint32(fb[12:]))
+			if binary.LittleEndian.Uint32(fb[20:])&apeFlagsContainsHeader != 0 {
+				pos -= apeHeaderFooterLen
+				if !hasMagic(pos, apeMagic) {
+					pos = -1
+				}
+			}
+		}
+		if pos < start || pos >= end {
+			return rs
+		}
+
+		rs = append([]ranges.Range{{Start: pos * 8, Len: (end - pos) * 8}}, rs...)
+		end = pos
+	}
+}
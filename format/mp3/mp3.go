@@ -32,6 +32,7 @@ func init() {
 					format.ID3V1,
 					format.ID3V11,
 					format.APEV2,
+					format.LYRICS3,
 				},
 				Group: &footerFormat,
 			},
@@ -61,57 +62,73 @@ func mp3Decode(d *decode.D, in interface{}) interface{} {
 		}
 	})
 
+	footers := findFooters(d, d.Pos())
+	framesEnd := d.Len()
+	if len(footers) > 0 {
+		framesEnd = footers[0].Start
+	}
+
 	lastValidEnd := int64(0)
 	validFrames := 0
 	decodeFailures := 0
-	d.FieldArray("frames", func(d *decode.D) {
-		for d.NotEnd() {
-			syncLen, _, err := d.TryPeekFind(16, 8, maxSyncSeek, func(v uint64) bool {
-				return (v&0b1111_1111_1110_0000 == 0b1111_1111_1110_0000 && // sync header
-					v&0b0000_0000_0001_1000 != 0b0000_0000_0000_1000 && // not reserved mpeg version
-					v&0b0000_0000_0000_0110 == 0b0000_0000_0000_0010) // layer 3
-			})
-			if err != nil || syncLen < 0 {
-				break
-			}
-			if syncLen > 0 {
-				d.SeekRel(syncLen)
-			}
-
-			dv, v, _ := d.TryFieldFormat("frame", mp3Frame, nil)
-			if dv == nil {
-				decodeFailures++
-				d.SeekRel(8)
-				continue
-			}
-			mfo, ok := v.(format.MP3FrameOut)
-			if !ok {
-				panic(fmt.Sprintf("expected MP3FrameOut got %#+v", v))
-			}
-			uniqueHeaderConfigs[headerConfig{
-				MPEGVersion:      mfo.MPEGVersion,
-				ProtectionAbsent: mfo.ProtectionAbsent,
-				SampleRate:       mfo.SampleRate,
-				ChannelsIndex:    mfo.ChannelsIndex,
-				ChannelModeIndex: mfo.ChannelModeIndex,
-			}] = struct{}{}
-
-			lastValidEnd = d.Pos()
-			validFrames++
-
-			if len(uniqueHeaderConfigs) >= maxUniqueHeaderConfigs {
-				d.Errorf("too many unique header configurations")
+	d.LenFn(framesEnd-d.Pos(), func(d *decode.D) {
+		d.FieldArray("frames", func(d *decode.D) {
+			for d.NotEnd() {
+				syncLen, _, err := d.TryPeekFind(16, 8, maxSyncSeek, func(v uint64) bool {
+					return (v&0b1111_1111_1110_0000 == 0b1111_1111_1110_0000 && // sync header
+						v&0b0000_0000_0001_1000 != 0b0000_0000_0000_1000 && // not reserved mpeg version
+						v&0b0000_0000_0000_0110 == 0b0000_0000_0000_0010) // layer 3
+				})
+				if err != nil || syncLen < 0 {
+					break
+				}
+				if syncLen > 0 {
+					d.SeekRel(syncLen)
+				}
+
+				dv, v, _ := d.TryFieldFormat("frame", mp3Frame, nil)
+				if dv == nil {
+					decodeFailures++
+					d.SeekRel(8)
+					continue
+				}
+				mfo, ok := v.(format.MP3FrameOut)
+				if !ok {
+					panic(fmt.Sprintf("expected MP3FrameOut got %#+v", v))
+				}
+				uniqueHeaderConfigs[headerConfig{
+					MPEGVersion:      mfo.MPEGVersion,
+					ProtectionAbsent: mfo.ProtectionAbsent,
+					SampleRate:       mfo.SampleRate,
+					ChannelsIndex:    mfo.ChannelsIndex,
+					ChannelModeIndex: mfo.ChannelModeIndex,
+				}] = struct{}{}
+
+				lastValidEnd = d.Pos()
+				validFrames++
+
+				if len(uniqueHeaderConfigs) >= maxUniqueHeaderConfigs {
+					d.Errorf("too many unique header configurations")
+				}
 			}
-		}
+		})
 	})
 
+	d.SeekAbs(lastValidEnd)
+
 	if validFrames == 0 || (validFrames < 2 && decodeFailures > 0) {
 		d.Errorf("no frames found")
 	}
 
-	d.SeekAbs(lastValidEnd)
-
 	d.FieldArray("footers", func(d *decode.D) {
+		if len(footers) > 0 {
+			for _, r := range footers {
+				_, _, _ = d.TryFieldFormatRange("footer", r.Start, r.Len, footerFormat, nil)
+			}
+			return
+		}
+
+		// no tags found at end, try directly after last valid frame
 		for d.NotEnd() {
 			if dv, _, _ := d.TryFieldFormat("footer", footerFormat, nil); dv == nil {
 				return
@@ -0,0 +1,46 @@
+package mp3
+
+// https://www.codeproject.com/Articles/8295/MPEG-Audio-Frame-Header
+// http://gabriel.mp3-tech.org/vbrheadersdk.zip
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.VBRI,
+		Description: "Fraunhofer encoder VBRI header",
+		DecodeFn:    vbriDecode,
+	})
+}
+
+func vbriDecode(d *decode.D, in interface{}) interface{} {
+	d.FieldUTF8("header", 4, d.AssertStr("VBRI"))
+	d.FieldU16("version")
+	d.FieldU16("delay")
+	d.FieldU16("quality")
+	d.FieldU32("bytes")
+	d.FieldU32("frames")
+	tocEntries := d.FieldU16("toc_entries")
+	tocScale := d.FieldU16("toc_scale")
+	tocEntryBytes := d.FieldU16("toc_entry_size")
+	d.FieldU16("toc_frames_per_entry")
+	if tocEntryBytes < 1 || tocEntryBytes > 4 {
+		d.Fatalf("invalid toc entry size %d", tocEntryBytes)
+	}
+	d.FieldArray("toc", func(d *decode.D) {
+		for i := uint64(0); i < tocEntries; i++ {
+			d.FieldU("entry", int(tocEntryBytes)*8, scalar.Fn(func(s scalar.S) (scalar.S, error) {
+				// number of bytes for entry
+				s.Sym = s.ActualU() * tocScale
+				return s, nil
+			}))
+		}
+	})
+
+	return nil
+}
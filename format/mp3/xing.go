@@ -1,11 +1,15 @@
 package mp3
 
 // https://www.codeproject.com/Articles/8295/MPEG-Audio-Frame-Header
+// http://gabriel.mp3-tech.org/mp3infotag.html
 
 import (
+	"bytes"
+
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/registry"
 	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
 )
 
 func init() {
@@ -16,13 +20,158 @@ func init() {
 	})
 }
 
+const lameTagBytes = 36
+
+// encoder string prefixes for encoders known to write a LAME tag
+var lameEncoderPrefixes = [][]byte{
+	[]byte("LAME"),
+	[]byte("L3.99"),
+	[]byte("Lavc"),
+	[]byte("Lavf"),
+}
+
+var vbrMethodNames = scalar.UToSymStr{
+	0:  "unknown",
+	1:  "cbr",
+	2:  "abr",
+	3:  "vbr_method1",
+	4:  "vbr_method2",
+	5:  "vbr_method3",
+	6:  "vbr_method4",
+	8:  "cbr_2_pass",
+	9:  "abr_2_pass",
+	15: "reserved",
+}
+
+var replayGainNames = scalar.UToSymStr{
+	0: "not_set",
+	1: "radio",
+	2: "audiophile",
+}
+
+var replayGainOriginatorNames = scalar.UToSymStr{
+	0: "not_set",
+	1: "artist",
+	2: "user",
+	3: "model",
+	4: "rms_average",
+}
+
+var sourceFrequencyNames = scalar.UToScalar{
+	0: {Sym: "32000_or_lower"},
+	1: {Sym: "44100"},
+	2: {Sym: "48000"},
+	3: {Sym: "higher_than_48000"},
+}
+
+var stereoModeNames = scalar.UToSymStr{
+	0: "mono",
+	1: "stereo",
+	2: "dual",
+	3: "joint",
+	4: "force",
+	5: "auto",
+	6: "intensity",
+	7: "undefined",
+}
+
+var surroundInfoNames = scalar.UToSymStr{
+	0: "none",
+	1: "dpl",
+	2: "dpl2",
+	3: "ambisonic",
+}
+
+var presetNames = scalar.UToSymStr{
+	0:    "unknown",
+	410:  "v9",
+	420:  "v8",
+	430:  "v7",
+	440:  "v6",
+	450:  "v5",
+	460:  "v4",
+	470:  "v3",
+	480:  "v2",
+	490:  "v1",
+	500:  "v0",
+	1000: "r3mix",
+	1001: "standard",
+	1002: "extreme",
+	1003: "insane",
+	1004: "standard_fast",
+	1005: "extreme_fast",
+	1006: "medium",
+	1007: "medium_fast",
+}
+
+func hasLameTag(d *decode.D) bool {
+	if d.BitsLeft() < lameTagBytes*8 {
+		return false
+	}
+	encoder := d.PeekBytes(9)
+	for _, p := range lameEncoderPrefixes {
+		if bytes.HasPrefix(encoder, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldReplayGain(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		d.FieldU3("name", replayGainNames)
+		d.FieldU3("originator", replayGainOriginatorNames)
+		negative := d.FieldBool("sign")
+		adjustment := d.FieldU9("adjustment")
+		gain := float64(adjustment) / 10
+		if negative {
+			gain = -gain
+		}
+		d.FieldValueFloat("gain_db", gain)
+	})
+}
+
+func lameTagDecode(d *decode.D) {
+	d.FieldUTF8NullFixedLen("encoder", 9)
+	d.FieldU4("tag_revision")
+	d.FieldU4("vbr_method", vbrMethodNames)
+	lowpassFilter := d.FieldU8("lowpass_filter")
+	d.FieldValueU("lowpass_filter_hz", lowpassFilter*100)
+	// 9.23 fixed point, 1.0 is max amplitude
+	d.FieldFFn("replay_gain_peak", func(d *decode.D) float64 { return float64(d.U32()) / (1 << 23) })
+	fieldReplayGain(d, "radio_replay_gain")
+	fieldReplayGain(d, "audiophile_replay_gain")
+	d.FieldStruct("lame_flags", func(d *decode.D) {
+		d.FieldBool("nogap_previous")
+		d.FieldBool("nogap_next")
+		d.FieldBool("nssafejoint")
+		d.FieldBool("nspsytune")
+	})
+	d.FieldU4("lame_ath_type")
+	// abr target bitrate or minimal bitrate for vbr, 255 means 255 or higher
+	d.FieldU8("abr_vbr")
+	d.FieldU12("encoder_delay")
+	d.FieldU12("encoder_padding")
+	d.FieldStruct("misc", func(d *decode.D) {
+		d.FieldU2("source_frequency", sourceFrequencyNames)
+		d.FieldBool("unwise_settings")
+		d.FieldU3("stereo_mode", stereoModeNames)
+		d.FieldU2("noise_shaping")
+	})
+	mp3Gain := d.FieldS8("mp3_gain")
+	// steps of 1.5 dB
+	d.FieldValueFloat("mp3_gain_db", float64(mp3Gain)*1.5)
+	d.FieldU2("unused")
+	d.FieldU3("surround_info", surroundInfoNames)
+	d.FieldU11("preset", presetNames)
+	d.FieldU32("length")
+	d.FieldU16("music_crc", scalar.Hex)
+	d.FieldU16("tag_crc", scalar.Hex)
+}
+
 func xingDecode(d *decode.D, in interface{}) interface{} {
-	// TODO: info has lame extension?
-	hasLameExtension := false
 	switch d.FieldUTF8("header", 4) {
-	case "Xing":
-	case "Info":
-		hasLameExtension = true
+	case "Xing", "Info":
 	default:
 		d.Errorf("no xing header found")
 	}
@@ -56,27 +205,8 @@ func xingDecode(d *decode.D, in interface{}) interface{} {
 		d.FieldU32BE("quality")
 	}
 
-	if hasLameExtension {
-		d.FieldStruct("lame_extension", func(d *decode.D) {
-			d.FieldUTF8("encoder", 9)
-			d.FieldU4("tag_revision")
-			d.FieldU4("vbr_method")
-			d.FieldU8("lowpass_filter") // TODO: /100
-			d.FieldU32("replay_gain_peak")
-			d.FieldU16("radio_replay_gain")
-			d.FieldU16("audiophile_replay_gain")
-			d.FieldU4("lame_flags")
-			d.FieldU4("lame_ath_type")
-			d.FieldU8("abr_vbr")          // TODO:
-			d.FieldU12("encoder_delay")   // TODO:
-			d.FieldU12("encoder_padding") // TODO:
-			d.FieldU8("misc")             // TODO:
-			d.FieldU8("mp3_gain")         // TODO:
-			d.FieldU16("preset")          // TODO:
-			d.FieldU32("length")
-			d.FieldU16("music_crc") // TODO:
-			d.FieldU16("tag_crc")   // TODO:
-		})
+	if hasLameTag(d) {
+		d.FieldStruct("lame_extension", lameTagDecode)
 	}
 
 	return nil
@@ -29,6 +29,33 @@ var boxSizeNames = scalar.UToScalar{
 	boxSizeUse64bitSize: scalar.S{Description: "Use 64 bit size"},
 }
 
+var constructionMethodNames = scalar.UToSymStr{
+	0: "file",
+	1: "idat",
+	2: "item",
+}
+
+var itemTypeNames = scalar.StrToScalar{
+	"av01": {Description: "AV1 image"},
+	"avc1": {Description: "AVC image"},
+	"hvc1": {Description: "HEVC image"},
+	"jpeg": {Description: "JPEG image"},
+	"grid": {Description: "Image grid"},
+	"iden": {Description: "Identity transformation"},
+	"iovl": {Description: "Image overlay"},
+	"Exif": {Description: "Exif metadata"},
+	"mime": {Description: "MIME typed data"},
+	"uri ": {Description: "URI typed data"},
+}
+
+var itemReferenceTypeNames = scalar.StrToScalar{
+	"auxl": {Description: "Auxiliary image"},
+	"base": {Description: "Pre-derived image base"},
+	"cdsc": {Description: "Content describes"},
+	"dimg": {Description: "Derived image"},
+	"thmb": {Description: "Thumbnail"},
+}
+
 var mediaTimeNames = scalar.SToScalar{
 	-1: {Description: "empty"},
 }
@@ -141,6 +168,9 @@ func decodeBox(ctx *decodeContext, d *decode.D) {
 	// 	dataSize = uint64(d.BitsLeft() / 8)
 	// }
 
+	// path matching uses the type as in the file, same as mp4_path
+	pathMatcher, onPath := ctx.pathMatcher.Match(typ)
+
 	// TODO: not sure about this
 	switch {
 	case typ == "�too":
@@ -155,10 +185,13 @@ func decodeBox(ctx *decodeContext, d *decode.D) {
 
 	ctx.path = append(ctx.path, typ)
 
-	if decodeFn, ok := boxDecoders[typ]; ok {
+	if decodeFn, ok := boxDecoders[typ]; ok && onPath {
+		parentPathMatcher := ctx.pathMatcher
+		ctx.pathMatcher = pathMatcher
 		d.LenFn(int64(dataSize*8), func(d *decode.D) {
 			decodeFn(ctx, d)
 		})
+		ctx.pathMatcher = parentPathMatcher
 	} else {
 		d.FieldRawLen("data", int64(dataSize*8))
 	}
@@ -345,8 +378,37 @@ func init() {
 						d.FieldRawLen("reserved", 6*8)
 						d.FieldU16("data_reference_index")
 
-						switch subType {
-						case "soun", "vide":
+						switch {
+						case dataFormat == "tx3g":
+							// TextSampleEntry
+							d.FieldStruct("display_flags", func(d *decode.D) {
+								d.FieldBool("all_samples_forced")
+								d.FieldBool("some_samples_forced")
+								d.FieldU11("unused0")
+								d.FieldBool("fill_text_region")
+								d.FieldBool("vertical_text")
+								d.FieldU5("unused1")
+								d.FieldBool("continuous_karaoke")
+								d.FieldU2("unused2")
+								d.FieldU2("scroll_direction", tx3gScrollDirectionNames)
+								d.FieldBool("scroll_out")
+								d.FieldBool("scroll_in")
+								d.FieldU5("unused3")
+							})
+							d.FieldS8("horizontal_justification", tx3gJustificationNames)
+							d.FieldS8("vertical_justification", tx3gJustificationNames)
+							decodeTx3gRGBA(d, "background_color")
+							decodeTx3gBoxRecord(d, "default_text_box")
+							decodeTx3gStyleRecord(d, "default_style")
+							if d.BitsLeft() > 0 {
+								decodeBoxes(ctx, d)
+							}
+						case dataFormat == "wvtt":
+							// PlainTextSampleEntry
+							if d.BitsLeft() > 0 {
+								decodeBoxes(ctx, d)
+							}
+						case subType == "soun", subType == "vide":
 
 							version := d.FieldU16("version")
 							d.FieldU16("revision_level")
@@ -441,7 +503,10 @@ func init() {
 			if dv != nil && !ok {
 				panic(fmt.Sprintf("expected AvcDcrOut got %#+v", v))
 			}
-			if ctx.currentTrack != nil {
+			switch {
+			case ctx.currentItemProperty != nil:
+				ctx.currentItemProperty.formatInArg = format.AvcIn{LengthSize: avcDcrOut.LengthSize} //nolint:gosimple
+			case ctx.currentTrack != nil:
 				ctx.currentTrack.formatInArg = format.AvcIn{LengthSize: avcDcrOut.LengthSize} //nolint:gosimple
 			}
 		},
@@ -451,7 +516,10 @@ func init() {
 			if dv != nil && !ok {
 				panic(fmt.Sprintf("expected HevcDcrOut got %#+v", v))
 			}
-			if ctx.currentTrack != nil {
+			switch {
+			case ctx.currentItemProperty != nil:
+				ctx.currentItemProperty.formatInArg = format.HevcIn{LengthSize: hevcDcrOut.LengthSize} //nolint:gosimple
+			case ctx.currentTrack != nil:
 				ctx.currentTrack.formatInArg = format.HevcIn{LengthSize: hevcDcrOut.LengthSize} //nolint:gosimple
 			}
 		},
@@ -472,8 +540,18 @@ func init() {
 		"dOps": func(_ *decodeContext, d *decode.D) {
 			d.FieldFormat("descriptor", opusPacketFrameFormat, nil)
 		},
-		"av1C": func(_ *decodeContext, d *decode.D) {
-			d.FieldFormat("descriptor", av1CCRFormat, nil)
+		"av1C": func(ctx *decodeContext, d *decode.D) {
+			dv, v := d.FieldFormat("descriptor", av1CCRFormat, nil)
+			av1CCROut, ok := v.(format.AV1CCROut)
+			if dv != nil && !ok {
+				panic(fmt.Sprintf("expected AV1CCROut got %#+v", v))
+			}
+			switch {
+			case ctx.currentItemProperty != nil:
+				ctx.currentItemProperty.formatInArg = format.AV1FrameIn{SequenceHeader: av1CCROut.SequenceHeader} //nolint:gosimple
+			case ctx.currentTrack != nil:
+				ctx.currentTrack.formatInArg = format.AV1FrameIn{SequenceHeader: av1CCROut.SequenceHeader} //nolint:gosimple
+			}
 		},
 		"vpcC": func(_ *decodeContext, d *decode.D) {
 			d.FieldU8("version")
@@ -850,9 +928,8 @@ func init() {
 			d.FieldU24("flags")
 			d.FieldU32("mfra_size")
 		},
-		// TODO: item location
-		// HEIC image
-		"iloc": func(_ *decodeContext, d *decode.D) {
+		// HEIF item boxes, ISO/IEC 23008-12
+		"iloc": func(ctx *decodeContext, d *decode.D) {
 			version := d.FieldU8("version")
 			d.FieldU24("flags")
 
@@ -875,28 +952,34 @@ func init() {
 			d.FieldArray("items", func(d *decode.D) {
 				for i := uint64(0); i < itemCount; i++ {
 					d.FieldStruct("item", func(d *decode.D) {
+						var id uint64
 						switch version {
 						case 0, 1:
-							d.FieldU16("id")
+							id = d.FieldU16("id")
 						case 2:
-							d.FieldU32("id")
+							id = d.FieldU32("id")
 						}
+						it := ctx.item(uint32(id))
 						switch version {
 						case 1, 2:
 							d.FieldU12("reserved")
-							d.FieldU4("construction_method")
+							it.constructionMethod = d.FieldU4("construction_method", constructionMethodNames)
 						}
 						d.FieldU16("data_reference_index")
-						d.FieldU("base_offset", int(baseOffsetSize)*8)
+						baseOffset := d.FieldU("base_offset", int(baseOffsetSize)*8)
 						extentCount := d.FieldU16("extent_count")
 						d.FieldArray("extends", func(d *decode.D) {
 							for i := uint64(0); i < extentCount; i++ {
 								d.FieldStruct("extent", func(d *decode.D) {
 									if (version == 1 || version == 2) && indexSize > 0 {
-										d.FieldU("index", int(offsetSize)*8)
+										d.FieldU("index", int(indexSize)*8)
 									}
-									d.FieldU("offset", int(offsetSize)*8)
-									d.FieldU("length", int(lengthSize)*8)
+									offset := d.FieldU("offset", int(offsetSize)*8)
+									length := d.FieldU("length", int(lengthSize)*8)
+									it.extents = append(it.extents, itemExtent{
+										offset: int64(baseOffset + offset),
+										length: int64(length),
+									})
 								})
 							}
 						})
@@ -904,28 +987,186 @@ func init() {
 				}
 			})
 		},
-		"infe": func(_ *decodeContext, d *decode.D) {
-			d.FieldU8("version")
+		"infe": func(ctx *decodeContext, d *decode.D) {
+			version := d.FieldU8("version")
 			d.FieldU24("flags")
-			d.FieldU16("id")
-			d.FieldU16("protection_index")
-			d.FieldUTF8Null("item_name")
-			// TODO: really optional? seems so
-			if d.NotEnd() {
-				d.FieldUTF8Null("content_type")
-			}
-			if d.NotEnd() {
-				d.FieldUTF8Null("content_encoding")
+			switch version {
+			case 0, 1:
+				d.FieldU16("id")
+				d.FieldU16("protection_index")
+				d.FieldUTF8Null("item_name")
+				// TODO: really optional? seems so
+				if d.NotEnd() {
+					d.FieldUTF8Null("content_type")
+				}
+				if d.NotEnd() {
+					d.FieldUTF8Null("content_encoding")
+				}
+				if version == 1 && d.NotEnd() {
+					d.FieldUTF8("extension_type", 4)
+					d.FieldRawLen("extension", d.BitsLeft())
+				}
+			default:
+				var id uint64
+				if version == 2 {
+					id = d.FieldU16("id")
+				} else {
+					id = d.FieldU32("id")
+				}
+				d.FieldU16("protection_index")
+				typ := d.FieldUTF8("item_type", 4, itemTypeNames)
+				name := d.FieldUTF8Null("item_name")
+				it := ctx.item(uint32(id))
+				it.typ = typ
+				it.name = name
+				switch typ {
+				case "mime":
+					it.contentType = d.FieldUTF8Null("content_type")
+					if d.NotEnd() {
+						d.FieldUTF8Null("content_encoding")
+					}
+				case "uri ":
+					d.FieldUTF8Null("item_uri_type")
+				}
 			}
 		},
 		"iinf": func(ctx *decodeContext, d *decode.D) {
-			d.FieldU8("version")
+			version := d.FieldU8("version")
 			d.FieldU24("flags")
-			_ = d.FieldU16("entry_count")
+			if version == 0 {
+				d.FieldU16("entry_count")
+			} else {
+				d.FieldU32("entry_count")
+			}
 			decodeBoxes(ctx, d)
 		},
+		"pitm": func(ctx *decodeContext, d *decode.D) {
+			version := d.FieldU8("version")
+			d.FieldU24("flags")
+			if version == 0 {
+				d.FieldU16("item_id")
+			} else {
+				d.FieldU32("item_id")
+			}
+		},
+		"iref": func(_ *decodeContext, d *decode.D) {
+			version := d.FieldU8("version")
+			d.FieldU24("flags")
+			// SingleItemTypeReferenceBox, box type is the reference type
+			d.FieldStructArrayLoop("references", "reference", func() bool { return d.BitsLeft() >= 8*8 }, func(d *decode.D) {
+				size := d.FieldU32("size")
+				d.FieldUTF8("type", 4, itemReferenceTypeNames)
+				d.LenFn(int64(size-8)*8, func(d *decode.D) {
+					idSize := 16
+					if version != 0 {
+						idSize = 32
+					}
+					d.FieldU("from_item_id", idSize)
+					count := d.FieldU16("reference_count")
+					d.FieldArray("to_item_ids", func(d *decode.D) {
+						for i := uint64(0); i < count; i++ {
+							d.FieldU("to_item_id", idSize)
+						}
+					})
+				})
+			})
+		},
+		"idat": func(ctx *decodeContext, d *decode.D) {
+			ctx.idatOffset = d.Pos()
+			d.FieldRawLen("data", d.BitsLeft())
+		},
 		"iprp": decodeBoxes,
-		"ipco": decodeBoxes,
+		"ipco": func(ctx *decodeContext, d *decode.D) {
+			// property index is 1-based position in container
+			d.FieldStructArrayLoop("boxes", "box", func() bool { return d.BitsLeft() >= 8*8 }, func(d *decode.D) {
+				ctx.currentItemProperty = &itemProperty{}
+				decodeBox(ctx, d)
+				ctx.itemProperties = append(ctx.itemProperties, ctx.currentItemProperty)
+				ctx.currentItemProperty = nil
+			})
+		},
+		"ipma": func(ctx *decodeContext, d *decode.D) {
+			version := d.FieldU8("version")
+			flags := d.FieldU24("flags")
+			entryCount := d.FieldU32("entry_count")
+			d.FieldArray("entries", func(d *decode.D) {
+				for i := uint64(0); i < entryCount; i++ {
+					d.FieldStruct("entry", func(d *decode.D) {
+						var id uint64
+						if version < 1 {
+							id = d.FieldU16("item_id")
+						} else {
+							id = d.FieldU32("item_id")
+						}
+						it := ctx.item(uint32(id))
+						associationCount := d.FieldU8("association_count")
+						d.FieldArray("associations", func(d *decode.D) {
+							for j := uint64(0); j < associationCount; j++ {
+								d.FieldStruct("association", func(d *decode.D) {
+									d.FieldBool("essential")
+									var index uint64
+									if flags&1 != 0 {
+										index = d.FieldU15("property_index")
+									} else {
+										index = d.FieldU7("property_index")
+									}
+									it.propertyIndexes = append(it.propertyIndexes, int(index))
+								})
+							}
+						})
+					})
+				}
+			})
+		},
+		"ispe": func(_ *decodeContext, d *decode.D) {
+			d.FieldU8("version")
+			d.FieldU24("flags")
+			d.FieldU32("image_width")
+			d.FieldU32("image_height")
+		},
+		"pixi": func(_ *decodeContext, d *decode.D) {
+			d.FieldU8("version")
+			d.FieldU24("flags")
+			numChannels := d.FieldU8("num_channels")
+			d.FieldArray("channels", func(d *decode.D) {
+				for i := uint64(0); i < numChannels; i++ {
+					d.FieldU8("bits_per_channel")
+				}
+			})
+		},
+		"irot": func(_ *decodeContext, d *decode.D) {
+			d.FieldU6("reserved")
+			d.FieldUFn("angle", func(d *decode.D) uint64 { return d.U2() * 90 })
+		},
+		"imir": func(_ *decodeContext, d *decode.D) {
+			d.FieldU7("reserved")
+			d.FieldU1("axis", scalar.UToSymStr{0: "vertical", 1: "horizontal"})
+		},
+		"auxC": func(_ *decodeContext, d *decode.D) {
+			d.FieldU8("version")
+			d.FieldU24("flags")
+			d.FieldUTF8Null("aux_type")
+			if d.NotEnd() {
+				d.FieldRawLen("aux_subtype", d.BitsLeft())
+			}
+		},
+		"colr": func(_ *decodeContext, d *decode.D) {
+			colourType := d.FieldUTF8("colour_type", 4)
+			switch colourType {
+			case "nclx", "nclc":
+				d.FieldU16("colour_primaries")
+				d.FieldU16("transfer_characteristics")
+				d.FieldU16("matrix_coefficients")
+				if colourType == "nclx" {
+					d.FieldBool("full_range_flag")
+					d.FieldU7("reserved")
+				}
+			case "rICC", "prof":
+				d.FieldFormatLen("icc_profile", d.BitsLeft(), iccProfileFormat, nil)
+			default:
+				d.FieldRawLen("data", d.BitsLeft())
+			}
+		},
 		"ID32": func(_ *decodeContext, d *decode.D) {
 			d.FieldU8("version")
 			d.FieldU24("flags")
@@ -1012,6 +1253,23 @@ func init() {
 			}
 		},
 		"schi": decodeBoxes,
+		"ftab": func(_ *decodeContext, d *decode.D) {
+			entryCount := d.FieldU16("entry_count")
+			d.FieldArray("entries", func(d *decode.D) {
+				for i := uint64(0); i < entryCount; i++ {
+					d.FieldStruct("entry", func(d *decode.D) {
+						d.FieldU16("font_id")
+						d.FieldUTF8ShortString("font_name")
+					})
+				}
+			})
+		},
+		"vttC": func(_ *decodeContext, d *decode.D) {
+			d.FieldUTF8("config", int(d.BitsLeft()/8))
+		},
+		"vlab": func(_ *decodeContext, d *decode.D) {
+			d.FieldUTF8("source_label", int(d.BitsLeft()/8))
+		},
 		"btrt": func(_ *decodeContext, d *decode.D) {
 			d.FieldU32("decoding_buffer_size")
 			d.FieldU32("max_bitrate")
@@ -1147,27 +1405,44 @@ func init() {
 			}
 		},
 		"covr": decodeBoxes,
-		"dec3": func(_ *decodeContext, d *decode.D) {
-			d.FieldU13("data_rate")
-			d.FieldU3("num_ind_sub")
+		"dac3": func(_ *decodeContext, d *decode.D) {
 			d.FieldU2("fscod")
 			d.FieldU5("bsid")
-			d.FieldU5("bsmod")
+			d.FieldU3("bsmod")
 			d.FieldU3("acmod")
 			d.FieldU1("lfeon")
-			d.FieldU3("reserved0")
-			numDepSub := d.FieldU4("num_dep_sub")
-			if numDepSub > 0 {
-				d.FieldU9("chan_loc")
-			} else {
-				d.FieldU1("reserved1")
-			}
+			d.FieldU5("bit_rate_code")
+			d.FieldU5("reserved")
+		},
+		"dec3": func(_ *decodeContext, d *decode.D) {
+			d.FieldU13("data_rate")
+			numIndSub := d.FieldU3("num_ind_sub", scalar.UAdd(1))
+			d.FieldArray("independent_substreams", func(d *decode.D) {
+				for i := uint64(0); i < numIndSub; i++ {
+					d.FieldStruct("independent_substream", func(d *decode.D) {
+						d.FieldU2("fscod")
+						d.FieldU5("bsid")
+						d.FieldU1("reserved0")
+						d.FieldU1("asvc")
+						d.FieldU3("bsmod")
+						d.FieldU3("acmod")
+						d.FieldU1("lfeon")
+						d.FieldU3("reserved1")
+						numDepSub := d.FieldU4("num_dep_sub")
+						if numDepSub > 0 {
+							d.FieldU9("chan_loc")
+						} else {
+							d.FieldU1("reserved2")
+						}
+					})
+				}
+			})
 
 			if d.BitsLeft() >= 16 {
-				d.FieldU7("reserved2")
-				ec3JocFlag := d.FieldBool("ec3_job_flag")
+				d.FieldU7("reserved")
+				ec3JocFlag := d.FieldBool("flag_ec3_extension_type_a")
 				if ec3JocFlag {
-					d.FieldU1("ec3_job_complexity")
+					d.FieldU8("complexity_index_type_a")
 				}
 			}
 		},
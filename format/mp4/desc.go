@@ -11,6 +11,8 @@ var boxDescriptions = scalar.StrToScalar{
 	"angl": {Description: "Name of the camera angle through which the clip was shot"},
 	"assp": {Description: "Alternative startup sequence properties"},
 	"auth": {Description: "Author of the media"},
+	"auxC": {Description: "Auxiliary type property"},
+	"av1C": {Description: "AV1 codec configuration"},
 	"avcn": {Description: "AVC NAL Unit Storage Box"},
 	"bidx": {Description: "Box Index"},
 	"bloc": {Description: "Base location and purchase location for license acquisition"},
@@ -40,6 +42,7 @@ var boxDescriptions = scalar.StrToScalar{
 	"ctab": {Description: "Track color-table"},
 	"ctts": {Description: "Composition time to sample"},
 	"cvru": {Description: "OMA DRM Cover URI"},
+	"dac3": {Description: "AC-3 (Dolby Digital) stream descriptor"},
 	"dac4": {Description: "Dolby AC-4 stream descriptor"},
 	"date": {Description: "Date and time, formatted according to ISO 8601, when the content was created. For clips captured by recording devices, this is typically the date and time when the clip’s recording started"},
 	"dcfD": {Description: "Marlin DCF Duration, user-data atom type"},
@@ -69,6 +72,7 @@ var boxDescriptions = scalar.StrToScalar{
 	"free": {Description: "Free space"},
 	"frma": {Description: "Original format box"},
 	"frpa": {Description: "Front Part"},
+	"ftab": {Description: "Font table"},
 	"ftyp": {Description: "File type and compatibility"},
 	"gitn": {Description: "Group ID to name"},
 	"gnre": {Description: "Media genre"},
@@ -79,6 +83,7 @@ var boxDescriptions = scalar.StrToScalar{
 	"hmhd": {Description: "Hint media header, overall information (hint track only)"},
 	"hnti": {Description: "Hint information"},
 	"hpix": {Description: "Hipix Rich Picture (user-data or meta-data)"},
+	"hvcC": {Description: "HEVC decoder configuration"},
 	"icnu": {Description: "OMA DRM Icon URI"},
 	"ID32": {Description: "ID3 version 2 container"},
 	"idat": {Description: "Item data"},
@@ -88,6 +93,7 @@ var boxDescriptions = scalar.StrToScalar{
 	"imap": {Description: "Track input map definition"},
 	"imda": {Description: "Identified media data"},
 	"imif": {Description: "IPMP Information box"},
+	"imir": {Description: "Image mirroring"},
 	"infe": {Description: "Item information entry"},
 	"infu": {Description: "OMA DRM Info URL"},
 	"iods": {Description: "Object Descriptor container box"},
@@ -98,6 +104,8 @@ var boxDescriptions = scalar.StrToScalar{
 	"ipro": {Description: "Item protection"},
 	"iprp": {Description: "Item Properties Box"},
 	"iref": {Description: "Item reference"},
+	"irot": {Description: "Image rotation"},
+	"ispe": {Description: "Image spatial extents"},
 	"j2kH": {Description: "JPEG 2000 header item property"},
 	"jP  ": {Description: "JPEG 2000 Signature"},
 	"jp2c": {Description: "JPEG 2000 contiguous codestream"},
@@ -160,6 +168,7 @@ var boxDescriptions = scalar.StrToScalar{
 	"pfhd": {Description: "Partial File Header"},
 	"pfil": {Description: "Partial File"},
 	"pitm": {Description: "Primary item reference"},
+	"pixi": {Description: "Pixel information"},
 	"ploc": {Description: "Partial Segment Location"},
 	"pnot": {Description: "Preview container"},
 	"prft": {Description: "Producer reference time"},
@@ -250,7 +259,9 @@ var boxDescriptions = scalar.StrToScalar{
 	"urat": {Description: "User 'star' rating of the media"},
 	"url ": {Description: "A URL"},
 	"uuid": {Description: "User-extension box"},
+	"vlab": {Description: "WebVTT source label"},
 	"vmhd": {Description: "Video media header, overall information (video track only)"},
+	"vttC": {Description: "WebVTT configuration"},
 	"vwdi": {Description: "Multiview Scene Information"},
 	"wide": {Description: "Expansion space reservation"},
 	"xml ": {Description: "XML container"},
@@ -6,6 +6,8 @@ package mp4
 // Quicktime file format https://developer.apple.com/standards/qtff-2001.pdf
 // FLAC in ISOBMFF https://github.com/xiph/flac/blob/master/doc/isoflac.txt
 // vp9 in ISOBMFF https://www.webmproject.org/vp9/mp4/
+// HEIF ISO/IEC 23008-12
+// AVIF https://aomediacodec.github.io/av1-avif/
 // https://developer.apple.com/library/archive/documentation/QuickTime/QTFF/Metadata/Metadata.html#//apple_ref/doc/uid/TP40000939-CH1-SW43
 
 // TODO: validate structure better? trak/stco etc
@@ -17,6 +19,7 @@ package mp4
 
 import (
 	"embed"
+	"fmt"
 	"sort"
 
 	"github.com/wader/fq/format"
@@ -28,10 +31,14 @@ import (
 var mp4FS embed.FS
 
 var aacFrameFormat decode.Group
+var ac3Format decode.Group
+var ac3FrameFormat decode.Group
 var av1CCRFormat decode.Group
 var av1FrameFormat decode.Group
 var flacFrameFormat decode.Group
 var flacMetadatablocksFormat decode.Group
+var exifFormat decode.Group
+var iccProfileFormat decode.Group
 var id3v2Format decode.Group
 var imageFormat decode.Group
 var jpegFormat decode.Group
@@ -45,9 +52,11 @@ var mpegPESPacketSampleFormat decode.Group
 var opusPacketFrameFormat decode.Group
 var protoBufWidevineFormat decode.Group
 var psshPlayreadyFormat decode.Group
+var tx3gSampleFormat decode.Group
 var vorbisPacketFormat decode.Group
 var vp9FrameFormat decode.Group
 var vpxCCRFormat decode.Group
+var wvttSampleFormat decode.Group
 
 func init() {
 	registry.MustRegister(decode.Format{
@@ -57,13 +66,18 @@ func init() {
 			format.PROBE,
 			format.IMAGE, // avif
 		},
-		DecodeFn: mp4Decode,
+		DecodeFn:     mp4Decode,
+		SupportsPath: true,
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.AAC_FRAME}, Group: &aacFrameFormat},
+			{Names: []string{format.AC3}, Group: &ac3Format},
+			{Names: []string{format.AC3_FRAME}, Group: &ac3FrameFormat},
 			{Names: []string{format.AV1_CCR}, Group: &av1CCRFormat},
 			{Names: []string{format.AV1_FRAME}, Group: &av1FrameFormat},
 			{Names: []string{format.FLAC_FRAME}, Group: &flacFrameFormat},
 			{Names: []string{format.FLAC_METADATABLOCKS}, Group: &flacMetadatablocksFormat},
+			{Names: []string{format.EXIF}, Group: &exifFormat},
+			{Names: []string{format.ICC_PROFILE}, Group: &iccProfileFormat},
 			{Names: []string{format.ID3V2}, Group: &id3v2Format},
 			{Names: []string{format.IMAGE}, Group: &imageFormat},
 			{Names: []string{format.JPEG}, Group: &jpegFormat},
@@ -77,14 +91,31 @@ func init() {
 			{Names: []string{format.OPUS_PACKET}, Group: &opusPacketFrameFormat},
 			{Names: []string{format.PROTOBUF_WIDEVINE}, Group: &protoBufWidevineFormat},
 			{Names: []string{format.PSSH_PLAYREADY}, Group: &psshPlayreadyFormat},
+			{Names: []string{format.TX3G_SAMPLE}, Group: &tx3gSampleFormat},
 			{Names: []string{format.VORBIS_PACKET}, Group: &vorbisPacketFormat},
 			{Names: []string{format.VP9_FRAME}, Group: &vp9FrameFormat},
 			{Names: []string{format.VPX_CCR}, Group: &vpxCCRFormat},
+			{Names: []string{format.WVTT_SAMPLE}, Group: &wvttSampleFormat},
 		},
-		Files: mp4FS,
+		Files:         mp4FS,
+		EmbeddedFiles: mp4EmbeddedFiles,
 	})
 }
 
+// samples of each track as track<n>/sample<n>
+func mp4EmbeddedFiles(v *decode.Value) ([]decode.EmbeddedFile, error) {
+	var efs []decode.EmbeddedFile
+	for ti, t := range v.Child("tracks").Children() {
+		for si, s := range t.Child("samples").Children() {
+			efs = append(efs, decode.EmbeddedFile{
+				Name:  fmt.Sprintf("track%d/sample%d", ti, si),
+				Range: s.Range,
+			})
+		}
+	}
+	return efs, nil
+}
+
 type stsc struct {
 	firstChunk      uint32
 	samplesPerChunk uint32
@@ -117,11 +148,149 @@ type track struct {
 	currentMoof *moof
 }
 
+type itemExtent struct {
+	offset int64
+	length int64
+}
+
+type item struct {
+	id                 uint32
+	typ                string
+	name               string
+	contentType        string
+	constructionMethod uint64
+	extents            []itemExtent
+	propertyIndexes    []int // 1-based index into ipco boxes
+}
+
+type itemProperty struct {
+	formatInArg interface{}
+}
+
 type decodeContext struct {
-	path              []string
-	tracks            map[uint32]*track
-	currentTrack      *track
-	currentMoofOffset int64
+	path                []string
+	tracks              map[uint32]*track
+	currentTrack        *track
+	currentMoofOffset   int64
+	items               map[uint32]*item
+	itemProperties      []*itemProperty
+	currentItemProperty *itemProperty
+	idatOffset          int64
+	// nil if not doing targeted decode
+	pathMatcher *decode.PathMatcher
+}
+
+func (ctx *decodeContext) item(id uint32) *item {
+	it, ok := ctx.items[id]
+	if !ok {
+		it = &item{id: id}
+		ctx.items[id] = it
+	}
+	return it
+}
+
+// format argument from first associated property that has one, ex hvcC length size
+func (ctx *decodeContext) itemFormatInArg(it *item) interface{} {
+	for _, i := range it.propertyIndexes {
+		if i < 1 || i > len(ctx.itemProperties) {
+			continue
+		}
+		if p := ctx.itemProperties[i-1]; p.formatInArg != nil {
+			return p.formatInArg
+		}
+	}
+	return nil
+}
+
+const (
+	constructionMethodFile = 0
+	constructionMethodIdat = 1
+)
+
+func decodeItemData(ctx *decodeContext, d *decode.D, it *item, name string, firstBit int64, nBits int64) {
+	inArg := ctx.itemFormatInArg(it)
+	d.RangeFn(firstBit, nBits, func(d *decode.D) {
+		switch it.typ {
+		case "av01":
+			d.FieldFormatLen(name, nBits, av1FrameFormat, inArg)
+		case "hvc1":
+			d.FieldFormatLen(name, nBits, mpegHEVCSampleFormat, inArg)
+		case "avc1":
+			d.FieldFormatLen(name, nBits, mpegAVCAUFormat, inArg)
+		case "jpeg":
+			d.FieldFormatLen(name, nBits, jpegFormat, nil)
+		case "Exif":
+			d.FieldStruct(name, func(d *decode.D) {
+				tiffHeaderOffset := d.FieldU32("exif_tiff_header_offset")
+				d.FieldRawLen("prefix", int64(tiffHeaderOffset)*8)
+				d.FieldFormatLen("exif", d.BitsLeft(), exifFormat, nil)
+			})
+		case "grid":
+			d.FieldStruct(name, func(d *decode.D) {
+				d.FieldU8("version")
+				flags := d.FieldU8("flags")
+				d.FieldUFn("rows", func(d *decode.D) uint64 { return d.U8() + 1 })
+				d.FieldUFn("columns", func(d *decode.D) uint64 { return d.U8() + 1 })
+				fieldSize := 16
+				if flags&1 != 0 {
+					fieldSize = 32
+				}
+				d.FieldU("output_width", fieldSize)
+				d.FieldU("output_height", fieldSize)
+			})
+		case "mime":
+			d.FieldUTF8(name, int(nBits/8))
+		default:
+			d.FieldRawLen(name, nBits)
+		}
+	})
+}
+
+func decodeItems(ctx *decodeContext, d *decode.D) {
+	var sortedItems []*item
+	for _, it := range ctx.items {
+		sortedItems = append(sortedItems, it)
+	}
+	sort.Slice(sortedItems, func(i, j int) bool { return sortedItems[i].id < sortedItems[j].id })
+
+	d.FieldArray("items", func(d *decode.D) {
+		for _, it := range sortedItems {
+			d.FieldStruct("item", func(d *decode.D) {
+				d.FieldValueU("id", uint64(it.id))
+				d.FieldValueStr("type", it.typ, itemTypeNames)
+				if it.name != "" {
+					d.FieldValueStr("name", it.name)
+				}
+				if it.contentType != "" {
+					d.FieldValueStr("content_type", it.contentType)
+				}
+
+				var baseOffset int64
+				switch it.constructionMethod {
+				case constructionMethodFile:
+				case constructionMethodIdat:
+					baseOffset = ctx.idatOffset / 8
+				default:
+					// TODO: item construction method
+					return
+				}
+
+				// data split into multiple extents can only be decoded as raw
+				if len(it.extents) == 1 {
+					e := it.extents[0]
+					decodeItemData(ctx, d, it, "data", (baseOffset+e.offset)*8, e.length*8)
+				} else {
+					d.FieldArray("extents", func(d *decode.D) {
+						for _, e := range it.extents {
+							d.RangeFn((baseOffset+e.offset)*8, e.length*8, func(d *decode.D) {
+								d.FieldRawLen("extent", e.length*8)
+							})
+						}
+					})
+				}
+			})
+		}
+	})
 }
 
 func isParent(ctx *decodeContext, typ string) bool {
@@ -130,7 +299,9 @@ func isParent(ctx *decodeContext, typ string) bool {
 
 func mp4Decode(d *decode.D, in interface{}) interface{} {
 	ctx := &decodeContext{
-		tracks: map[uint32]*track{},
+		tracks:      map[uint32]*track{},
+		items:       map[uint32]*item{},
+		pathMatcher: d.PathMatcher(),
 	}
 
 	// TODO: nicer, validate functions without field?
@@ -150,6 +321,11 @@ func mp4Decode(d *decode.D, in interface{}) interface{} {
 
 	decodeBoxes(ctx, d)
 
+	// targeted decode has skipped boxes needed for tracks and items
+	if ctx.pathMatcher != nil {
+		return nil
+	}
+
 	// keep track order stable
 	var sortedTracks []*track
 	for _, t := range ctx.tracks {
@@ -166,6 +342,11 @@ func mp4Decode(d *decode.D, in interface{}) interface{} {
 						d.FieldFormatLen(name, nBits, flacFrameFormat, inArg)
 					case dataFormat == "Opus":
 						d.FieldFormatLen(name, nBits, opusPacketFrameFormat, inArg)
+					case dataFormat == "ac-3":
+						d.FieldFormatLen(name, nBits, ac3FrameFormat, inArg)
+					case dataFormat == "ec-3":
+						// sample can have dependent substreams in separate syncframes
+						d.FieldFormatLen(name, nBits, ac3Format, inArg)
 					case dataFormat == "vp09":
 						d.FieldFormatLen(name, nBits, vp9FrameFormat, inArg)
 					case dataFormat == "avc1":
@@ -187,6 +368,10 @@ func mp4Decode(d *decode.D, in interface{}) interface{} {
 						d.FieldFormatLen(name, nBits, jpegFormat, inArg)
 					case dataFormat == "jpeg":
 						d.FieldFormatLen(name, nBits, jpegFormat, inArg)
+					case dataFormat == "tx3g":
+						d.FieldFormatLen(name, nBits, tx3gSampleFormat, inArg)
+					case dataFormat == "wvtt":
+						d.FieldFormatLen(name, nBits, wvttSampleFormat, inArg)
 					default:
 						d.FieldRawLen(name, d.BitsLeft())
 					}
@@ -276,6 +461,9 @@ func mp4Decode(d *decode.D, in interface{}) interface{} {
 		}
 	})
 
-	return nil
+	if len(ctx.items) > 0 {
+		decodeItems(ctx, d)
+	}
 
+	return nil
 }
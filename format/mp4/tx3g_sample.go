@@ -0,0 +1,137 @@
+package mp4
+
+// 3GPP TS 26.245 Timed text format
+// https://www.3gpp.org/ftp/Specs/archive/26_series/26.245/
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.TX3G_SAMPLE,
+		Description: "3GPP timed text sample",
+		DecodeFn:    tx3gSampleDecode,
+	})
+}
+
+var tx3gBoxDescriptions = scalar.StrToScalar{
+	"styl": {Description: "Text style"},
+	"hlit": {Description: "Highlight"},
+	"hclr": {Description: "Highlight color"},
+	"krok": {Description: "Karaoke"},
+	"dlay": {Description: "Scroll delay"},
+	"href": {Description: "Hyperlink"},
+	"tbox": {Description: "Text box"},
+	"blnk": {Description: "Blink"},
+	"twrp": {Description: "Text wrap"},
+}
+
+var tx3gJustificationNames = scalar.SToSymStr{
+	0:  "left_top",
+	1:  "center",
+	-1: "right_bottom",
+}
+
+var tx3gScrollDirectionNames = scalar.UToSymStr{
+	0: "up",
+	1: "down",
+	2: "left",
+	3: "right",
+}
+
+func decodeTx3gRGBA(d *decode.D, name string) {
+	d.FieldU32(name, scalar.Hex)
+}
+
+func decodeTx3gBoxRecord(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		d.FieldS16("top")
+		d.FieldS16("left")
+		d.FieldS16("bottom")
+		d.FieldS16("right")
+	})
+}
+
+func decodeTx3gStyleRecord(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		d.FieldU16("start_char")
+		d.FieldU16("end_char")
+		d.FieldU16("font_id")
+		d.FieldStruct("face_style_flags", func(d *decode.D) {
+			d.FieldU5("unused")
+			d.FieldBool("underline")
+			d.FieldBool("italic")
+			d.FieldBool("bold")
+		})
+		d.FieldU8("font_size")
+		decodeTx3gRGBA(d, "text_color")
+	})
+}
+
+func decodeTx3gBox(d *decode.D) {
+	size := d.FieldU32("size")
+	typ := d.FieldUTF8("type", 4, tx3gBoxDescriptions)
+	if size < 8 {
+		d.Fatalf("invalid box size %d", size)
+	}
+	d.LenFn(int64(size-8)*8, func(d *decode.D) {
+		switch typ {
+		case "styl":
+			entryCount := d.FieldU16("entry_count")
+			d.FieldArray("entries", func(d *decode.D) {
+				for i := uint64(0); i < entryCount; i++ {
+					decodeTx3gStyleRecord(d, "entry")
+				}
+			})
+		case "hlit", "blnk":
+			d.FieldU16("start_char_offset")
+			d.FieldU16("end_char_offset")
+		case "hclr":
+			decodeTx3gRGBA(d, "highlight_color")
+		case "krok":
+			d.FieldU32("highlight_start_time")
+			entryCount := d.FieldU16("entry_count")
+			d.FieldArray("entries", func(d *decode.D) {
+				for i := uint64(0); i < entryCount; i++ {
+					d.FieldStruct("entry", func(d *decode.D) {
+						d.FieldU32("highlight_end_time")
+						d.FieldU16("start_char_offset")
+						d.FieldU16("end_char_offset")
+					})
+				}
+			})
+		case "dlay":
+			d.FieldU32("scroll_delay")
+		case "href":
+			d.FieldU16("start_char_offset")
+			d.FieldU16("end_char_offset")
+			d.FieldUTF8ShortString("url")
+			d.FieldUTF8ShortString("alt_string")
+		case "tbox":
+			decodeTx3gBoxRecord(d, "text_box")
+		case "twrp":
+			d.FieldU8("wrap_flag", scalar.UToSymStr{0: "no_wrap", 1: "automatic"})
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+}
+
+func tx3gSampleDecode(d *decode.D, in interface{}) interface{} {
+	textLength := d.FieldU16("text_length")
+	// UTF-16 if starts with a byte order mark
+	if textLength >= 2 && d.PeekBits(16) == 0xfeff {
+		d.FieldUTF16("text", int(textLength))
+	} else {
+		d.FieldUTF8("text", int(textLength))
+	}
+	if d.BitsLeft() > 0 {
+		d.FieldStructArrayLoop("boxes", "box", func() bool { return d.BitsLeft() >= 8*8 }, decodeTx3gBox)
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package mp4
+
+// ISO/IEC 14496-30 WebVTT in ISO base media file format
+// https://www.w3.org/TR/webvtt1/
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.WVTT_SAMPLE,
+		Description: "WebVTT sample in ISO base media file",
+		DecodeFn:    wvttSampleDecode,
+	})
+}
+
+var wvttBoxDescriptions = scalar.StrToScalar{
+	"vttc": {Description: "Cue"},
+	"vtte": {Description: "Empty cue"},
+	"vtta": {Description: "Additional text"},
+	"iden": {Description: "Cue identifier"},
+	"sttg": {Description: "Cue settings"},
+	"payl": {Description: "Cue payload"},
+	"ctim": {Description: "Cue current time"},
+}
+
+func decodeWvttBoxes(d *decode.D) {
+	d.FieldStructArrayLoop("boxes", "box", func() bool { return d.BitsLeft() >= 8*8 }, decodeWvttBox)
+}
+
+func decodeWvttBox(d *decode.D) {
+	size := d.FieldU32("size")
+	typ := d.FieldUTF8("type", 4, wvttBoxDescriptions)
+	if size < 8 {
+		d.Fatalf("invalid box size %d", size)
+	}
+	d.LenFn(int64(size-8)*8, func(d *decode.D) {
+		switch typ {
+		case "vttc":
+			decodeWvttBoxes(d)
+		case "vtte":
+			// no data
+		case "iden", "sttg", "payl", "ctim", "vtta":
+			d.FieldUTF8("value", int(d.BitsLeft()/8))
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+}
+
+func wvttSampleDecode(d *decode.D, in interface{}) interface{} {
+	decodeWvttBoxes(d)
+
+	return nil
+}
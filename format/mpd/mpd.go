@@ -0,0 +1,646 @@
+package mpd
+
+// https://standards.iso.org/ittf/PubliclyAvailableStandards/MPEG-DASH_schema_files/DASH-MPD.xsd
+// ISO/IEC 23009-1 MPEG-DASH
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/internal/lineparse"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+// TODO: SegmentList, SegmentBase index ranges, xlink
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.MPD,
+		Description: "MPEG-DASH Media Presentation Description",
+		ProbeOrder:  90, // before json, no magic
+		Groups:      []string{format.PROBE},
+		DecodeFn:    decodeMPD,
+	})
+}
+
+// max number of segments to resolve per representation
+const maxSegments = 100_000
+
+// number of bytes to look for root element in when probing
+const probeLen = 1024
+
+// elements that can only occur once in its parent, others are arrays
+var singleElements = map[string]bool{
+	"SegmentTemplate":     true,
+	"SegmentBase":         true,
+	"SegmentList":         true,
+	"SegmentTimeline":     true,
+	"Initialization":      true,
+	"RepresentationIndex": true,
+	"Title":               true,
+	"Source":              true,
+	"Copyright":           true,
+}
+
+// attributes that look like numbers but should be kept as strings
+var stringAttributes = map[string]bool{
+	"id":         true,
+	"value":      true,
+	"lang":       true,
+	"codecs":     true,
+	"frameRate":  true,
+	"sar":        true,
+	"par":        true,
+	"indexRange": true,
+	"mediaRange": true,
+	"range":      true,
+}
+
+type span struct {
+	start int // byte offset in input
+	end   int
+}
+
+// leaf is an attribute, text or text only element value. Ranges of leafs are
+// extended backwards to cover markup and whitespace before them
+type leaf struct {
+	span
+	name   string
+	value  string
+	isText bool
+}
+
+type element struct {
+	name     string
+	span     span
+	attrs    map[string]string
+	leafs    []*leaf // attributes in order
+	children []*element
+	text     *leaf // text only element or text content
+}
+
+func (e *element) child(name string) *element {
+	for _, c := range e.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (e *element) childTexts(name string) []string {
+	var ss []string
+	for _, c := range e.children {
+		if c.name == name && c.text != nil {
+			ss = append(ss, c.text.value)
+		}
+	}
+	return ss
+}
+
+func isSpace(c byte) bool { return c == ' ' || c == '\t' || c == '\r' || c == '\n' }
+
+// attribute name spans in start tag, names are raw including namespace prefix
+func scanAttributes(b []byte, start int, end int) []*leaf {
+	var ls []*leaf
+	i := start + 1
+	for i < end && !isSpace(b[i]) && b[i] != '/' && b[i] != '>' {
+		i++
+	}
+	for {
+		for i < end && isSpace(b[i]) {
+			i++
+		}
+		if i >= end || b[i] == '/' || b[i] == '>' {
+			return ls
+		}
+		l := &leaf{span: span{start: i}}
+		for i < end && !isSpace(b[i]) && b[i] != '=' {
+			i++
+		}
+		l.name = string(b[l.start:i])
+		for i < end && b[i] != '"' && b[i] != '\'' {
+			i++
+		}
+		if i >= end {
+			return ls
+		}
+		q := b[i]
+		i++
+		for i < end && b[i] != q {
+			i++
+		}
+		i++
+		l.end = i
+		ls = append(ls, l)
+	}
+}
+
+func isNamespaceAttr(name string) bool {
+	return name == "xmlns" || strings.HasPrefix(name, "xmlns:")
+}
+
+type parser struct {
+	b     []byte
+	xd    *xml.Decoder
+	leafs []*leaf // in document order
+}
+
+func (p *parser) token() (xml.Token, span, error) {
+	start := int(p.xd.InputOffset())
+	t, err := p.xd.Token()
+	return t, span{start: start, end: int(p.xd.InputOffset())}, err
+}
+
+func (p *parser) element(se xml.StartElement, s span) (*element, error) {
+	e := &element{name: se.Name.Local, span: s, attrs: map[string]string{}}
+	als := scanAttributes(p.b, s.start, s.end)
+	if len(als) != len(se.Attr) {
+		return nil, fmt.Errorf("%s: failed to find attributes", e.name)
+	}
+	for i, l := range als {
+		if isNamespaceAttr(l.name) {
+			continue
+		}
+		if _, ok := e.attrs[l.name]; ok {
+			return nil, fmt.Errorf("%s: duplicate attribute %s", e.name, l.name)
+		}
+		l.value = se.Attr[i].Value
+		e.attrs[l.name] = l.value
+		e.leafs = append(e.leafs, l)
+		p.leafs = append(p.leafs, l)
+	}
+
+	var text strings.Builder
+	textSpan := span{start: -1}
+	for {
+		t, ts, err := p.token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			c, err := p.element(t, ts)
+			if err != nil {
+				return nil, err
+			}
+			e.children = append(e.children, c)
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) == 0 {
+				continue
+			}
+			text.Write(t)
+			if textSpan.start == -1 {
+				textSpan.start = ts.start
+			}
+			textSpan.end = ts.end
+		case xml.EndElement:
+			e.span.end = ts.end
+			if textSpan.start == -1 {
+				return e, nil
+			}
+			l := &leaf{name: "text", span: textSpan, value: strings.TrimSpace(text.String()), isText: true}
+			if len(e.leafs) == 0 && len(e.children) == 0 {
+				l.name = e.name
+				l.span = e.span
+			}
+			e.text = l
+			p.leafs = append(p.leafs, l)
+			return e, nil
+		}
+	}
+}
+
+// xs:duration PnYnMnDTnHnMnS in seconds, years and months are approximated
+var durationRe = regexp.MustCompile(`^(-)?P(?:(\d+(?:\.\d+)?)Y)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+func parseDuration(s string) (float64, bool) {
+	sm := durationRe.FindStringSubmatch(s)
+	if sm == nil || s == "P" || strings.HasSuffix(s, "T") {
+		return 0, false
+	}
+	units := []float64{365 * 86400, 30 * 86400, 86400, 3600, 60, 1}
+	var seconds float64
+	for i, u := range units {
+		if sm[2+i] == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(sm[2+i], 64)
+		if err != nil {
+			return 0, false
+		}
+		seconds += f * u
+	}
+	if sm[1] == "-" {
+		seconds = -seconds
+	}
+	return seconds, true
+}
+
+func fieldLeaf(d *decode.D, l *leaf) {
+	lineparse.FieldSpan(d, l.start, l.end, func(d *decode.D) {
+		s := l.value
+		readFn := func(d *decode.D) { d.SeekRel(d.BitsLeft()) }
+		if l.isText || stringAttributes[l.name] {
+			d.FieldStrFn(l.name, func(d *decode.D) string { readFn(d); return s })
+			return
+		}
+		if s == "true" || s == "false" {
+			d.FieldBoolFn(l.name, func(d *decode.D) bool { readFn(d); return s == "true" })
+			return
+		}
+		if v, ok := parseDuration(s); ok {
+			d.FieldFFn(l.name, func(d *decode.D) float64 { readFn(d); return v }, scalar.Description(s))
+			return
+		}
+		if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+			d.FieldUFn(l.name, func(d *decode.D) uint64 { readFn(d); return n })
+			return
+		}
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			d.FieldSFn(l.name, func(d *decode.D) int64 { readFn(d); return n })
+			return
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+			d.FieldFFn(l.name, func(d *decode.D) float64 { readFn(d); return f })
+			return
+		}
+		d.FieldStrFn(l.name, func(d *decode.D) string { readFn(d); return s })
+	})
+}
+
+// $<Identifier>[%0<width>d]$
+var templateRe = regexp.MustCompile(`\$(RepresentationID|Number|Bandwidth|Time|SubNumber)?(%0\d+d)?\$`)
+
+func resolveTemplate(template string, vars map[string]interface{}) string {
+	return templateRe.ReplaceAllStringFunc(template, func(s string) string {
+		sm := templateRe.FindStringSubmatch(s)
+		if sm[1] == "" {
+			return "$"
+		}
+		v, ok := vars[sm[1]]
+		if !ok {
+			return s
+		}
+		if sm[2] != "" {
+			return fmt.Sprintf(sm[2], v)
+		}
+		return fmt.Sprint(v)
+	})
+}
+
+func resolveURL(base string, ref string) string {
+	if base == "" {
+		return ref
+	}
+	bu, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	ru, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return bu.ResolveReference(ru).String()
+}
+
+// base URL resolved from parent base URLs, first BaseURL is used
+func baseURL(parent string, e *element) string {
+	if bs := e.childTexts("BaseURL"); len(bs) > 0 {
+		return resolveURL(parent, bs[0])
+	}
+	return parent
+}
+
+// segment template with attributes inherited from upper levels
+type segmentTemplate struct {
+	attrs    map[string]string
+	timeline *element
+}
+
+func (st segmentTemplate) merge(e *element) segmentTemplate {
+	t := e.child("SegmentTemplate")
+	if t == nil {
+		return st
+	}
+	m := segmentTemplate{attrs: map[string]string{}, timeline: st.timeline}
+	for k, v := range st.attrs {
+		m.attrs[k] = v
+	}
+	for k, v := range t.attrs {
+		m.attrs[k] = v
+	}
+	if tl := t.child("SegmentTimeline"); tl != nil {
+		m.timeline = tl
+	}
+	return m
+}
+
+func (st segmentTemplate) uint(name string, def uint64) uint64 {
+	if s, ok := st.attrs[name]; ok {
+		if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+type segment struct {
+	number   uint64
+	time     uint64
+	duration uint64
+}
+
+// periodDuration is in seconds, negative if unknown
+func (st segmentTemplate) segments(periodDuration float64) []segment {
+	timescale := st.uint("timescale", 1)
+	if timescale == 0 {
+		timescale = 1
+	}
+	startNumber := st.uint("startNumber", 1)
+	pto := st.uint("presentationTimeOffset", 0)
+
+	var ss []segment
+	if st.timeline != nil {
+		end := uint64(math.MaxUint64)
+		if periodDuration >= 0 {
+			end = pto + uint64(periodDuration*float64(timescale))
+		}
+		var t uint64
+		number := startNumber
+		var sElms []*element
+		for _, c := range st.timeline.children {
+			if c.name == "S" {
+				sElms = append(sElms, c)
+			}
+		}
+		for i, s := range sElms {
+			st := segmentTemplate{attrs: s.attrs}
+			if _, ok := s.attrs["t"]; ok {
+				t = st.uint("t", 0)
+			}
+			d := st.uint("d", 0)
+			if d == 0 {
+				continue
+			}
+			r := int64(0)
+			if rs, ok := s.attrs["r"]; ok {
+				if n, err := strconv.ParseInt(rs, 10, 64); err == nil {
+					r = n
+				}
+			}
+			if r < 0 {
+				// repeat until next S@t or end of period
+				repeatEnd := end
+				if i+1 < len(sElms) {
+					if _, ok := sElms[i+1].attrs["t"]; ok {
+						repeatEnd = segmentTemplate{attrs: sElms[i+1].attrs}.uint("t", 0)
+					}
+				}
+				if repeatEnd == math.MaxUint64 {
+					r = 0
+				} else if repeatEnd > t {
+					r = int64((repeatEnd-t+d-1)/d) - 1
+				}
+			}
+			for j := int64(0); j <= r && len(ss) < maxSegments; j++ {
+				ss = append(ss, segment{number: number, time: t, duration: d})
+				number++
+				t += d
+			}
+		}
+		return ss
+	}
+
+	d := st.uint("duration", 0)
+	if d == 0 || periodDuration < 0 {
+		return nil
+	}
+	count := uint64(math.Ceil(periodDuration * float64(timescale) / float64(d)))
+	for i := uint64(0); i < count && len(ss) < maxSegments; i++ {
+		ss = append(ss, segment{number: startNumber + i, time: pto + i*d, duration: d})
+	}
+	return ss
+}
+
+// resolved segment information for a representation
+type representation struct {
+	initializationURL string
+	hasSegments       bool
+	periodStart       float64
+	timescale         uint64
+	pto               uint64
+	baseURL           string
+	media             string
+	vars              map[string]interface{}
+	segments          []segment
+}
+
+func resolveRepresentations(root *element) map[*element]*representation {
+	reps := map[*element]*representation{}
+
+	mpdDuration := -1.0
+	if s, ok := root.attrs["mediaPresentationDuration"]; ok {
+		if v, ok := parseDuration(s); ok {
+			mpdDuration = v
+		}
+	}
+	mpdBaseURL := baseURL("", root)
+
+	var periods []*element
+	for _, c := range root.children {
+		if c.name == "Period" {
+			periods = append(periods, c)
+		}
+	}
+
+	var periodStart float64
+	for pi, p := range periods {
+		if s, ok := p.attrs["start"]; ok {
+			if v, ok := parseDuration(s); ok {
+				periodStart = v
+			}
+		}
+		periodDuration := -1.0
+		if s, ok := p.attrs["duration"]; ok {
+			if v, ok := parseDuration(s); ok {
+				periodDuration = v
+			}
+		} else if pi+1 < len(periods) {
+			if s, ok := periods[pi+1].attrs["start"]; ok {
+				if v, ok := parseDuration(s); ok {
+					periodDuration = v - periodStart
+				}
+			}
+		} else if mpdDuration >= 0 {
+			periodDuration = mpdDuration - periodStart
+		}
+
+		periodBaseURL := baseURL(mpdBaseURL, p)
+		periodST := segmentTemplate{}.merge(p)
+		for _, as := range p.children {
+			if as.name != "AdaptationSet" {
+				continue
+			}
+			asBaseURL := baseURL(periodBaseURL, as)
+			asST := periodST.merge(as)
+			for _, rep := range as.children {
+				if rep.name != "Representation" {
+					continue
+				}
+				repST := asST.merge(rep)
+				if repST.attrs == nil {
+					continue
+				}
+
+				r := &representation{
+					periodStart: periodStart,
+					timescale:   repST.uint("timescale", 1),
+					pto:         repST.uint("presentationTimeOffset", 0),
+					baseURL:     baseURL(asBaseURL, rep),
+					vars:        map[string]interface{}{"RepresentationID": rep.attrs["id"]},
+				}
+				if r.timescale == 0 {
+					r.timescale = 1
+				}
+				if bw, err := strconv.ParseUint(rep.attrs["bandwidth"], 10, 64); err == nil {
+					r.vars["Bandwidth"] = bw
+				}
+				if init, ok := repST.attrs["initialization"]; ok {
+					r.initializationURL = resolveURL(r.baseURL, resolveTemplate(init, r.vars))
+				}
+				if r.media, r.hasSegments = repST.attrs["media"]; r.hasSegments {
+					r.segments = repST.segments(periodDuration)
+				}
+				reps[rep] = r
+			}
+		}
+
+		if periodDuration >= 0 {
+			periodStart += periodDuration
+		}
+	}
+
+	return reps
+}
+
+func fieldRepresentation(d *decode.D, r *representation) {
+	if r.initializationURL != "" {
+		d.FieldValueStr("initialization_url", r.initializationURL)
+	}
+	if !r.hasSegments {
+		return
+	}
+	d.FieldArray("segments", func(d *decode.D) {
+		for _, s := range r.segments {
+			d.FieldStruct("segment", func(d *decode.D) {
+				r.vars["Number"] = s.number
+				r.vars["Time"] = s.time
+				d.FieldValueU("number", s.number)
+				d.FieldValueU("time", s.time)
+				d.FieldValueU("duration", s.duration)
+				d.FieldValueFloat("start_seconds", r.periodStart+(float64(s.time)-float64(r.pto))/float64(r.timescale))
+				d.FieldValueFloat("duration_seconds", float64(s.duration)/float64(r.timescale))
+				d.FieldValueStr("url", resolveURL(r.baseURL, resolveTemplate(r.media, r.vars)))
+			})
+		}
+	})
+}
+
+func fieldChild(d *decode.D, e *element, reps map[*element]*representation) {
+	if e.text != nil && len(e.leafs) == 0 && len(e.children) == 0 {
+		fieldLeaf(d, e.text)
+		return
+	}
+	d.FieldStruct(e.name, func(d *decode.D) { fieldElement(d, e, reps) })
+}
+
+func fieldElement(d *decode.D, e *element, reps map[*element]*representation) {
+	for _, l := range e.leafs {
+		fieldLeaf(d, l)
+	}
+	if e.text != nil && (len(e.leafs) > 0 || len(e.children) > 0) {
+		fieldLeaf(d, e.text)
+	}
+
+	var names []string
+	byName := map[string][]*element{}
+	for _, c := range e.children {
+		if _, ok := byName[c.name]; !ok {
+			names = append(names, c.name)
+		}
+		byName[c.name] = append(byName[c.name], c)
+	}
+	for _, name := range names {
+		cs := byName[name]
+		if singleElements[name] && len(cs) == 1 {
+			fieldChild(d, cs[0], reps)
+			continue
+		}
+		d.FieldArray(name, func(d *decode.D) {
+			for _, c := range cs {
+				fieldChild(d, c, reps)
+			}
+		})
+	}
+
+	if r, ok := reps[e]; ok {
+		fieldRepresentation(d, r)
+	}
+}
+
+func decodeMPD(d *decode.D, in interface{}) interface{} {
+	peekLen := d.Len() / 8
+	if peekLen > probeLen {
+		peekLen = probeLen
+	}
+	if !bytes.Contains(d.PeekBytes(int(peekLen)), []byte("<MPD")) {
+		d.Fatalf("no MPD element found")
+	}
+
+	b := d.BytesLen(int(d.Len() / 8))
+	d.SeekAbs(0)
+
+	p := &parser{b: b, xd: xml.NewDecoder(bytes.NewReader(b))}
+	var root *element
+	for root == nil {
+		t, ts, err := p.token()
+		if err == io.EOF {
+			d.Fatalf("no root element")
+		} else if err != nil {
+			d.Fatalf(err.Error())
+		}
+		if se, ok := t.(xml.StartElement); ok {
+			if se.Name.Local != "MPD" {
+				d.Fatalf("root element is not MPD")
+			}
+			if root, err = p.element(se, ts); err != nil {
+				d.Fatalf(err.Error())
+			}
+		}
+	}
+
+	// make leafs cover everything before them, last leaf covers the rest
+	prevEnd := 0
+	for _, l := range p.leafs {
+		l.start = prevEnd
+		prevEnd = l.end
+	}
+	if len(p.leafs) > 0 {
+		p.leafs[len(p.leafs)-1].end = len(b)
+	}
+
+	fieldElement(d, root, resolveRepresentations(root))
+
+	return nil
+}
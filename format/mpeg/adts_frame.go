@@ -7,6 +7,7 @@ package mpeg
 import (
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/checksum"
 	"github.com/wader/fq/pkg/decode"
 	"github.com/wader/fq/pkg/scalar"
 )
@@ -64,6 +65,11 @@ func adtsFrameDecoder(d *decode.D, in interface{}) interface{} {
 	// O	11	Buffer fullness
 	// P	2	Number of AAC frames (RDBs) in ADTS frame minus 1, for maximum compatibility always use 1 AAC frame per ADTS frame
 	// Q	16	CRC if protection absent is 0
+	//
+	// If protection is present and more than one raw data block there are
+	// block positions before the header CRC and each block is followed by a CRC.
+	// Header CRC then only covers the header. Other CRCs cover the header and/or
+	// first bits of each syntax element of raw data blocks so are not verified.
 
 	d.FieldU12("syncword", d.AssertU(0b1111_1111_1111), scalar.Bin)
 	d.FieldU1("mpeg_version", scalar.UToSymStr{0: "MPEG-4", 1: "MPEG2- AAC"})
@@ -79,25 +85,57 @@ func adtsFrameDecoder(d *decode.D, in interface{}) interface{} {
 	d.FieldU1("copyrighted")
 	d.FieldU1("copyright")
 	frameLength := d.FieldU13("frame_length")
-	dataLength := int64(frameLength - 7)
-	if !protectionAbsent {
-		// TODO: multuple RDBs CRCs
-		dataLength -= 2
-	}
-
 	d.FieldU11("buffer_fullness")
 	numberOfRDBs := d.FieldU2("number_of_rdbs", scalar.UAdd(1))
+
+	headerLength := int64(7)
+	var rdbPositions []int64
 	if !protectionAbsent {
-		d.FieldU16("crc")
+		if numberOfRDBs > 1 {
+			// byte offsets from start of first raw data block
+			rdbPositions = append(rdbPositions, 0)
+			d.FieldArray("raw_data_block_positions", func(d *decode.D) {
+				for i := uint64(1); i < numberOfRDBs; i++ {
+					rdbPositions = append(rdbPositions, int64(d.FieldU16("raw_data_block_position")))
+				}
+			})
+			headerLength += int64(numberOfRDBs-1) * 2
+		}
+		if numberOfRDBs > 1 {
+			crcHash := &checksum.CRC{Bits: 16, Current: 0xffff, Table: checksum.ANSI16Table}
+			d.MustCopy(crcHash, d.BitBufRange(0, headerLength*8))
+			d.FieldChecksumU("crc", 16, "crc16", crcHash.Sum64(), scalar.Hex)
+		} else {
+			d.FieldU16("crc", scalar.Hex)
+		}
+		headerLength += 2
 	}
 
+	dataLength := int64(frameLength) - headerLength
 	if dataLength < 0 {
 		d.Fatalf("dataLength < 0")
 	}
 
+	aacFrameIn := format.AACFrameIn{ObjectType: int(objectType)}
 	d.FieldArray("raw_data_blocks", func(d *decode.D) {
-		for i := uint64(0); i < numberOfRDBs; i++ {
-			d.FieldFormatLen("raw_data_block", dataLength*8, aacFrameFormat, format.AACFrameIn{ObjectType: int(objectType)})
+		switch {
+		case rdbPositions != nil:
+			// each raw data block is followed by a crc
+			for i, pos := range rdbPositions {
+				end := dataLength
+				if i+1 < len(rdbPositions) {
+					end = rdbPositions[i+1]
+				}
+				rdbLength := end - pos - 2
+				if rdbLength < 0 {
+					d.Fatalf("invalid raw data block position")
+				}
+				d.FieldFormatLen("raw_data_block", rdbLength*8, aacFrameFormat, aacFrameIn)
+				d.FieldU16("crc", scalar.Hex)
+			}
+		default:
+			// TODO: length of each block is not known without protection so decode as one
+			d.FieldFormatLen("raw_data_block", dataLength*8, aacFrameFormat, aacFrameIn)
 		}
 	})
 
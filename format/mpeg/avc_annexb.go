@@ -1,11 +1,16 @@
 package mpeg
 
 import (
+	"embed"
+
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/registry"
 	"github.com/wader/fq/pkg/decode"
 )
 
+//go:embed avc_annexb.jq
+var avcAnnexBFS embed.FS
+
 var annexBAVCNALUFormat decode.Group
 
 func init() {
@@ -13,10 +18,11 @@ func init() {
 		Name:        format.AVC_ANNEXB,
 		Description: "H.264/AVC Annex B",
 		DecodeFn: func(d *decode.D, in interface{}) interface{} {
-			return annexBDecode(d, in, annexBAVCNALUFormat)
+			return annexBDecode(d, in, annexBAVCNALUFormat, nil)
 		},
 		RootArray: true,
 		RootName:  "stream",
+		Files:     avcAnnexBFS,
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.AVC_NALU}, Group: &annexBAVCNALUFormat},
 		},
@@ -1,11 +1,16 @@
 package mpeg
 
 import (
+	"embed"
+
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/registry"
 	"github.com/wader/fq/pkg/decode"
 )
 
+//go:embed hevc_annexb.jq
+var hevcAnnexBFS embed.FS
+
 var annexBHEVCNALUFormat decode.Group
 
 func init() {
@@ -13,10 +18,11 @@ func init() {
 		Name:        format.HEVC_ANNEXB,
 		Description: "H.265/HEVC Annex B",
 		DecodeFn: func(d *decode.D, in interface{}) interface{} {
-			return annexBDecode(d, in, annexBHEVCNALUFormat)
+			return annexBDecode(d, in, annexBHEVCNALUFormat, format.HevcNALUIn{NumExtraSliceHeaderBits: map[uint64]uint64{}})
 		},
 		RootArray: true,
 		RootName:  "stream",
+		Files:     hevcAnnexBFS,
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.HEVC_NALU}, Group: &annexBHEVCNALUFormat},
 		},
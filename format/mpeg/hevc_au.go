@@ -27,10 +27,11 @@ func hevcAUDecode(d *decode.D, in interface{}) interface{} {
 		d.Errorf("hevcIn required")
 	}
 
+	naluIn := format.HevcNALUIn{NumExtraSliceHeaderBits: map[uint64]uint64{}}
 	for d.NotEnd() {
 		d.FieldStruct("nalu", func(d *decode.D) {
 			l := d.FieldU("length", int(hevcIn.LengthSize)*8)
-			d.FieldFormatLen("nalu", int64(l)*8, hevcAUNALFormat, nil)
+			d.FieldFormatLen("nalu", int64(l)*8, hevcAUNALFormat, naluIn)
 		})
 	}
 
@@ -24,16 +24,16 @@ func hevcDcrDecode(d *decode.D, in interface{}) interface{} {
 	d.FieldU8("configuration_version")
 	d.FieldU2("general_profile_space")
 	d.FieldU1("general_tier_flag")
-	d.FieldU5("general_profile_idc")
-	d.FieldU32("general_profile_compatibility_flags")
-	d.FieldU48("general_constraint_indicator_flags")
-	d.FieldU8("general_level_idc")
+	d.FieldU5("general_profile_idc", hevcProfileNames)
+	d.FieldU32("general_profile_compatibility_flags", scalar.Bin)
+	d.FieldU48("general_constraint_indicator_flags", scalar.Bin)
+	d.FieldU8("general_level_idc", hevcLevelMap)
 	d.FieldU4("reserved0")
 	d.FieldU12("min_spatial_segmentation_idc")
 	d.FieldU6("reserved1")
 	d.FieldU2("parallelism_type")
 	d.FieldU6("reserved2")
-	d.FieldU2("chroma_format_idc")
+	d.FieldU2("chroma_format_idc", hevcChromaFormatNames)
 	d.FieldU5("reserved3")
 	d.FieldU3("bit_depth_luma", scalar.UAdd(8))
 	d.FieldU5("reserved4")
@@ -1,21 +1,46 @@
 package mpeg
 
 import (
+	"fmt"
+
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/registry"
 	"github.com/wader/fq/pkg/decode"
 	"github.com/wader/fq/pkg/scalar"
 )
 
+var hevcVPSFormat decode.Group
+var hevcSPSFormat decode.Group
+var hevcPPSFormat decode.Group
+
 func init() {
 	registry.MustRegister(decode.Format{
-		Name:         format.HEVC_NALU,
-		Description:  "H.265/HEVC Network Access Layer Unit",
-		DecodeFn:     hevcNALUDecode,
-		Dependencies: []decode.Dependency{},
+		Name:        format.HEVC_NALU,
+		Description: "H.265/HEVC Network Access Layer Unit",
+		DecodeFn:    hevcNALUDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.HEVC_VPS}, Group: &hevcVPSFormat},
+			{Names: []string{format.HEVC_SPS}, Group: &hevcSPSFormat},
+			{Names: []string{format.HEVC_PPS}, Group: &hevcPPSFormat},
+		},
 	})
 }
 
+const (
+	hevcNALBLAWLP    = 16
+	hevcNALRsvIRAP23 = 23
+	hevcNALRsvVCL31  = 31
+	hevcNALVPS       = 32
+	hevcNALSPS       = 33
+	hevcNALPPS       = 34
+)
+
+var hevcSliceTypeNames = scalar.UToSymStr{
+	0: "B",
+	1: "P",
+	2: "I",
+}
+
 var hevcNALNames = scalar.UToSymStr{
 	0:  "TRAIL_N",
 	1:  "TRAIL_R",
@@ -68,15 +93,48 @@ var hevcNALNames = scalar.UToSymStr{
 }
 
 func hevcNALUDecode(d *decode.D, in interface{}) interface{} {
+	// optional, without it slice_type is not decoded
+	naluIn, _ := in.(format.HevcNALUIn)
+
 	d.FieldBool("forbidden_zero_bit")
 	nalType := d.FieldU6("nal_unit_type", hevcNALNames)
 	d.FieldU6("nuh_layer_id")
 	d.FieldU3("nuh_temporal_id_plus1")
 	unescapedBb := d.MustNewBitBufFromReader(decode.NALUnescapeReader{Reader: d.BitBufRange(d.Pos(), d.BitsLeft())})
 
-	_ = unescapedBb
-	_ = nalType
-
+	switch {
+	case nalType <= hevcNALRsvVCL31:
+		d.FieldStruct("slice_segment_header", func(d *decode.D) {
+			firstSliceSegmentInPicFlag := d.FieldBool("first_slice_segment_in_pic_flag")
+			if nalType >= hevcNALBLAWLP && nalType <= hevcNALRsvIRAP23 {
+				d.FieldBool("no_output_of_prior_pics_flag")
+			}
+			ppsID := d.FieldUFn("slice_pic_parameter_set_id", uEV)
+			// TODO: dependent_slice_segment_flag and slice_segment_address depends on PPS and SPS
+			numExtraSliceHeaderBits, ok := naluIn.NumExtraSliceHeaderBits[ppsID]
+			if !firstSliceSegmentInPicFlag || !ok {
+				return
+			}
+			if numExtraSliceHeaderBits > 0 {
+				d.FieldU("slice_reserved_flags", int(numExtraSliceHeaderBits))
+			}
+			d.FieldUFn("slice_type", uEV, hevcSliceTypeNames)
+			// TODO: rest depends on PPS and SPS
+		})
+	case nalType == hevcNALVPS:
+		d.FieldFormatBitBuf("vps", unescapedBb, hevcVPSFormat, nil)
+	case nalType == hevcNALSPS:
+		d.FieldFormatBitBuf("sps", unescapedBb, hevcSPSFormat, nil)
+	case nalType == hevcNALPPS:
+		_, v := d.FieldFormatBitBuf("pps", unescapedBb, hevcPPSFormat, nil)
+		ppsOut, ok := v.(format.HevcPPSOut)
+		if !ok {
+			panic(fmt.Sprintf("expected HevcPPSOut got %#+v", v))
+		}
+		if naluIn.NumExtraSliceHeaderBits != nil {
+			naluIn.NumExtraSliceHeaderBits[ppsOut.PicParameterSetID] = ppsOut.NumExtraSliceHeaderBits
+		}
+	}
 	d.FieldRawLen("data", d.BitsLeft())
 
 	return nil
@@ -0,0 +1,494 @@
+package mpeg
+
+// ITU-T H.265 7.3.2.2 Sequence parameter set RBSP syntax
+
+import (
+	"fmt"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.HEVC_SPS,
+		Description: "H.265/HEVC Sequence Parameter Set",
+		DecodeFn:    hevcSPSDecode,
+	})
+}
+
+var hevcProfileNames = scalar.UToSymStr{
+	1:  "main",
+	2:  "main_10",
+	3:  "main_still_picture",
+	4:  "format_range_extensions",
+	5:  "high_throughput",
+	6:  "multiview_main",
+	7:  "scalable_main",
+	8:  "3d_main",
+	9:  "screen_extended",
+	10: "scalable_format_range_extensions",
+	11: "high_throughput_screen_extended",
+}
+
+// level_idc is 30 times level number, ex 93 is 3.1
+var hevcLevelMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	u, ok := s.Actual.(uint64)
+	if !ok || u == 0 {
+		return s, nil
+	}
+	if u%30 == 0 {
+		s.Sym = fmt.Sprintf("%d", u/30)
+	} else {
+		s.Sym = fmt.Sprintf("%d.%d", u/30, (u%30)/3)
+	}
+	return s, nil
+})
+
+var hevcChromaFormatNames = scalar.UToSymStr{
+	0: "monochrome",
+	1: "4:2:0",
+	2: "4:2:2",
+	3: "4:4:4",
+}
+
+func hevcProfile(d *decode.D, prefix string) {
+	d.FieldU2(prefix + "profile_space")
+	d.FieldBool(prefix + "tier_flag")
+	d.FieldU5(prefix+"profile_idc", hevcProfileNames)
+	d.FieldU32(prefix+"profile_compatibility_flags", scalar.Bin)
+	d.FieldBool(prefix + "progressive_source_flag")
+	d.FieldBool(prefix + "interlaced_source_flag")
+	d.FieldBool(prefix + "non_packed_constraint_flag")
+	d.FieldBool(prefix + "frame_only_constraint_flag")
+	d.FieldU43(prefix+"constraint_flags", scalar.Bin)
+	d.FieldBool(prefix + "inbld_flag")
+}
+
+// 7.3.3 Profile, tier and level syntax
+func hevcProfileTierLevel(d *decode.D, profilePresentFlag bool, maxNumSubLayersMinus1 uint64) {
+	if profilePresentFlag {
+		hevcProfile(d, "general_")
+	}
+	d.FieldU8("general_level_idc", hevcLevelMap)
+	if maxNumSubLayersMinus1 == 0 {
+		return
+	}
+
+	subLayerProfilePresent := make([]bool, maxNumSubLayersMinus1)
+	subLayerLevelPresent := make([]bool, maxNumSubLayersMinus1)
+	d.FieldArray("sub_layer_flags", func(d *decode.D) {
+		for i := uint64(0); i < maxNumSubLayersMinus1; i++ {
+			d.FieldStruct("sub_layer_flag", func(d *decode.D) {
+				subLayerProfilePresent[i] = d.FieldBool("sub_layer_profile_present_flag")
+				subLayerLevelPresent[i] = d.FieldBool("sub_layer_level_present_flag")
+			})
+		}
+	})
+	for i := maxNumSubLayersMinus1; i < 8; i++ {
+		d.FieldU2("reserved_zero_2bits")
+	}
+	d.FieldArray("sub_layers", func(d *decode.D) {
+		for i := uint64(0); i < maxNumSubLayersMinus1; i++ {
+			d.FieldStruct("sub_layer", func(d *decode.D) {
+				if subLayerProfilePresent[i] {
+					hevcProfile(d, "sub_layer_")
+				}
+				if subLayerLevelPresent[i] {
+					d.FieldU8("sub_layer_level_idc", hevcLevelMap)
+				}
+			})
+		}
+	})
+}
+
+// E.2.3 Sub-layer HRD parameters syntax
+func hevcSubLayerHrdParameters(d *decode.D, cpbCnt uint64, subPicHrdParamsPresentFlag bool) {
+	for i := uint64(0); i < cpbCnt; i++ {
+		d.FieldStruct("cpb", func(d *decode.D) {
+			d.FieldUFn("bit_rate_value", uEV, scalar.UAdd(1))
+			d.FieldUFn("cpb_size_value", uEV, scalar.UAdd(1))
+			if subPicHrdParamsPresentFlag {
+				d.FieldUFn("cpb_size_du_value", uEV, scalar.UAdd(1))
+				d.FieldUFn("bit_rate_du_value", uEV, scalar.UAdd(1))
+			}
+			d.FieldBool("cbr_flag")
+		})
+	}
+}
+
+// E.2.2 HRD parameters syntax
+func hevcHrdParameters(d *decode.D, commonInfPresentFlag bool, maxNumSubLayersMinus1 uint64) {
+	nalHrdParametersPresentFlag := false
+	vclHrdParametersPresentFlag := false
+	subPicHrdParamsPresentFlag := false
+	if commonInfPresentFlag {
+		nalHrdParametersPresentFlag = d.FieldBool("nal_hrd_parameters_present_flag")
+		vclHrdParametersPresentFlag = d.FieldBool("vcl_hrd_parameters_present_flag")
+		if nalHrdParametersPresentFlag || vclHrdParametersPresentFlag {
+			subPicHrdParamsPresentFlag = d.FieldBool("sub_pic_hrd_params_present_flag")
+			if subPicHrdParamsPresentFlag {
+				d.FieldU8("tick_divisor", scalar.UAdd(2))
+				d.FieldU5("du_cpb_removal_delay_increment_length", scalar.UAdd(1))
+				d.FieldBool("sub_pic_cpb_params_in_pic_timing_sei_flag")
+				d.FieldU5("dpb_output_delay_du_length", scalar.UAdd(1))
+			}
+			d.FieldU4("bit_rate_scale")
+			d.FieldU4("cpb_size_scale")
+			if subPicHrdParamsPresentFlag {
+				d.FieldU4("cpb_size_du_scale")
+			}
+			d.FieldU5("initial_cpb_removal_delay_length", scalar.UAdd(1))
+			d.FieldU5("au_cpb_removal_delay_length", scalar.UAdd(1))
+			d.FieldU5("dpb_output_delay_length", scalar.UAdd(1))
+		}
+	}
+	d.FieldArray("sub_layers", func(d *decode.D) {
+		for i := uint64(0); i <= maxNumSubLayersMinus1; i++ {
+			d.FieldStruct("sub_layer", func(d *decode.D) {
+				fixedPicRateWithinCvsFlag := true
+				if !d.FieldBool("fixed_pic_rate_general_flag") {
+					fixedPicRateWithinCvsFlag = d.FieldBool("fixed_pic_rate_within_cvs_flag")
+				}
+				lowDelayHrdFlag := false
+				if fixedPicRateWithinCvsFlag {
+					d.FieldUFn("elemental_duration_in_tc", uEV, scalar.UAdd(1))
+				} else {
+					lowDelayHrdFlag = d.FieldBool("low_delay_hrd_flag")
+				}
+				cpbCnt := uint64(1)
+				if !lowDelayHrdFlag {
+					cpbCnt = d.FieldUFn("cpb_cnt", uEV, scalar.UAdd(1))
+				}
+				if nalHrdParametersPresentFlag {
+					d.FieldArray("nal_hrd_parameters", func(d *decode.D) {
+						hevcSubLayerHrdParameters(d, cpbCnt, subPicHrdParamsPresentFlag)
+					})
+				}
+				if vclHrdParametersPresentFlag {
+					d.FieldArray("vcl_hrd_parameters", func(d *decode.D) {
+						hevcSubLayerHrdParameters(d, cpbCnt, subPicHrdParamsPresentFlag)
+					})
+				}
+			})
+		}
+	})
+}
+
+// 7.3.4 Scaling list data syntax
+func hevcScalingListData(d *decode.D) {
+	d.FieldArray("scaling_lists", func(d *decode.D) {
+		for sizeID := 0; sizeID < 4; sizeID++ {
+			matrixIDStep := 1
+			if sizeID == 3 {
+				matrixIDStep = 3
+			}
+			for matrixID := 0; matrixID < 6; matrixID += matrixIDStep {
+				d.FieldStruct("scaling_list", func(d *decode.D) {
+					d.FieldValueU("size_id", uint64(sizeID))
+					d.FieldValueU("matrix_id", uint64(matrixID))
+					if !d.FieldBool("scaling_list_pred_mode_flag") {
+						d.FieldUFn("scaling_list_pred_matrix_id_delta", uEV)
+						return
+					}
+					coefNum := 1 << (4 + (sizeID << 1))
+					if coefNum > 64 {
+						coefNum = 64
+					}
+					if sizeID > 1 {
+						d.FieldSFn("scaling_list_dc_coef", sEV, scalar.SAdd(8))
+					}
+					d.FieldArray("scaling_list_delta_coefs", func(d *decode.D) {
+						for i := 0; i < coefNum; i++ {
+							d.FieldSFn("scaling_list_delta_coef", sEV)
+						}
+					})
+				})
+			}
+		}
+	})
+}
+
+// short term reference picture set delta POCs, used to parse following sets
+type hevcStRefPicSet struct {
+	deltaPocS0      []int64
+	deltaPocS1      []int64
+	usedByCurrPicS0 []bool
+	usedByCurrPicS1 []bool
+}
+
+func (s hevcStRefPicSet) numDeltaPocs() int { return len(s.deltaPocS0) + len(s.deltaPocS1) }
+
+// 7.3.7 Short-term reference picture set syntax and 7.4.8 semantics
+func hevcStRefPicSetDecode(d *decode.D, stRpsIdx int, sets []hevcStRefPicSet) hevcStRefPicSet {
+	var s hevcStRefPicSet
+
+	interRefPicSetPredictionFlag := false
+	if stRpsIdx != 0 {
+		interRefPicSetPredictionFlag = d.FieldBool("inter_ref_pic_set_prediction_flag")
+	}
+	if interRefPicSetPredictionFlag {
+		// delta_idx_minus1 is only present in slice headers
+		ref := sets[stRpsIdx-1]
+		deltaRpsSign := d.FieldU1("delta_rps_sign")
+		absDeltaRps := int64(d.FieldUFn("abs_delta_rps", uEV, scalar.UAdd(1)))
+		deltaRps := (1 - 2*int64(deltaRpsSign)) * absDeltaRps
+
+		n := ref.numDeltaPocs()
+		usedByCurrPicFlag := make([]bool, n+1)
+		useDeltaFlag := make([]bool, n+1)
+		d.FieldArray("ref_pics", func(d *decode.D) {
+			for j := 0; j <= n; j++ {
+				d.FieldStruct("ref_pic", func(d *decode.D) {
+					usedByCurrPicFlag[j] = d.FieldBool("used_by_curr_pic_flag")
+					useDeltaFlag[j] = true
+					if !usedByCurrPicFlag[j] {
+						useDeltaFlag[j] = d.FieldBool("use_delta_flag")
+					}
+				})
+			}
+		})
+
+		numNegative := len(ref.deltaPocS0)
+		for j := len(ref.deltaPocS1) - 1; j >= 0; j-- {
+			dPoc := ref.deltaPocS1[j] + deltaRps
+			if dPoc < 0 && useDeltaFlag[numNegative+j] {
+				s.deltaPocS0 = append(s.deltaPocS0, dPoc)
+				s.usedByCurrPicS0 = append(s.usedByCurrPicS0, usedByCurrPicFlag[numNegative+j])
+			}
+		}
+		if deltaRps < 0 && useDeltaFlag[n] {
+			s.deltaPocS0 = append(s.deltaPocS0, deltaRps)
+			s.usedByCurrPicS0 = append(s.usedByCurrPicS0, usedByCurrPicFlag[n])
+		}
+		for j := 0; j < numNegative; j++ {
+			dPoc := ref.deltaPocS0[j] + deltaRps
+			if dPoc < 0 && useDeltaFlag[j] {
+				s.deltaPocS0 = append(s.deltaPocS0, dPoc)
+				s.usedByCurrPicS0 = append(s.usedByCurrPicS0, usedByCurrPicFlag[j])
+			}
+		}
+
+		for j := numNegative - 1; j >= 0; j-- {
+			dPoc := ref.deltaPocS0[j] + deltaRps
+			if dPoc > 0 && useDeltaFlag[j] {
+				s.deltaPocS1 = append(s.deltaPocS1, dPoc)
+				s.usedByCurrPicS1 = append(s.usedByCurrPicS1, usedByCurrPicFlag[j])
+			}
+		}
+		if deltaRps > 0 && useDeltaFlag[n] {
+			s.deltaPocS1 = append(s.deltaPocS1, deltaRps)
+			s.usedByCurrPicS1 = append(s.usedByCurrPicS1, usedByCurrPicFlag[n])
+		}
+		for j := 0; j < len(ref.deltaPocS1); j++ {
+			dPoc := ref.deltaPocS1[j] + deltaRps
+			if dPoc > 0 && useDeltaFlag[numNegative+j] {
+				s.deltaPocS1 = append(s.deltaPocS1, dPoc)
+				s.usedByCurrPicS1 = append(s.usedByCurrPicS1, usedByCurrPicFlag[numNegative+j])
+			}
+		}
+
+		return s
+	}
+
+	numNegativePics := d.FieldUFn("num_negative_pics", uEV)
+	numPositivePics := d.FieldUFn("num_positive_pics", uEV)
+	var poc int64
+	d.FieldArray("negative_pics", func(d *decode.D) {
+		for i := uint64(0); i < numNegativePics; i++ {
+			d.FieldStruct("negative_pic", func(d *decode.D) {
+				poc -= int64(d.FieldUFn("delta_poc_s0", uEV, scalar.UAdd(1)))
+				s.deltaPocS0 = append(s.deltaPocS0, poc)
+				s.usedByCurrPicS0 = append(s.usedByCurrPicS0, d.FieldBool("used_by_curr_pic_s0_flag"))
+			})
+		}
+	})
+	poc = 0
+	d.FieldArray("positive_pics", func(d *decode.D) {
+		for i := uint64(0); i < numPositivePics; i++ {
+			d.FieldStruct("positive_pic", func(d *decode.D) {
+				poc += int64(d.FieldUFn("delta_poc_s1", uEV, scalar.UAdd(1)))
+				s.deltaPocS1 = append(s.deltaPocS1, poc)
+				s.usedByCurrPicS1 = append(s.usedByCurrPicS1, d.FieldBool("used_by_curr_pic_s1_flag"))
+			})
+		}
+	})
+
+	return s
+}
+
+// E.2.1 VUI parameters syntax
+func hevcVuiParameters(d *decode.D, spsMaxSubLayersMinus1 uint64) {
+	aspectRatioInfoPresentFlag := d.FieldBool("aspect_ratio_info_present_flag")
+	if aspectRatioInfoPresentFlag {
+		aspectRatioIdc := d.FieldU8("aspect_ratio_idc", avcAspectRatioIdcMap)
+		const extendedSAR = 255
+		if aspectRatioIdc == extendedSAR {
+			d.FieldU16("sar_width")
+			d.FieldU16("sar_height")
+		}
+	}
+	overscanInfoPresentFlag := d.FieldBool("overscan_info_present_flag")
+	if overscanInfoPresentFlag {
+		d.FieldBool("overscan_appropriate_flag")
+	}
+	videoSignalTypePresentFlag := d.FieldBool("video_signal_type_present_flag")
+	if videoSignalTypePresentFlag {
+		d.FieldU3("video_format", avcVideoFormatMap)
+		d.FieldBool("video_full_range_flag")
+		colourDescriptionPresentFlag := d.FieldBool("colour_description_present_flag")
+		if colourDescriptionPresentFlag {
+			d.FieldU8("colour_primaries", format.ISO_23091_2_ColourPrimariesMap)
+			d.FieldU8("transfer_characteristics", format.ISO_23091_2_TransferCharacteristicMap)
+			d.FieldU8("matrix_coefficients", format.ISO_23091_2_MatrixCoefficients)
+		}
+	}
+	chromaLocInfoPresentFlag := d.FieldBool("chroma_loc_info_present_flag")
+	if chromaLocInfoPresentFlag {
+		d.FieldUFn("chroma_sample_loc_type_top_field", uEV)
+		d.FieldUFn("chroma_sample_loc_type_bottom_field", uEV)
+	}
+	d.FieldBool("neutral_chroma_indication_flag")
+	d.FieldBool("field_seq_flag")
+	d.FieldBool("frame_field_info_present_flag")
+	defaultDisplayWindowFlag := d.FieldBool("default_display_window_flag")
+	if defaultDisplayWindowFlag {
+		d.FieldUFn("def_disp_win_left_offset", uEV)
+		d.FieldUFn("def_disp_win_right_offset", uEV)
+		d.FieldUFn("def_disp_win_top_offset", uEV)
+		d.FieldUFn("def_disp_win_bottom_offset", uEV)
+	}
+	vuiTimingInfoPresentFlag := d.FieldBool("vui_timing_info_present_flag")
+	if vuiTimingInfoPresentFlag {
+		d.FieldU32("vui_num_units_in_tick")
+		d.FieldU32("vui_time_scale")
+		vuiPocProportionalToTimingFlag := d.FieldBool("vui_poc_proportional_to_timing_flag")
+		if vuiPocProportionalToTimingFlag {
+			d.FieldUFn("vui_num_ticks_poc_diff_one", uEV, scalar.UAdd(1))
+		}
+		vuiHrdParametersPresentFlag := d.FieldBool("vui_hrd_parameters_present_flag")
+		if vuiHrdParametersPresentFlag {
+			d.FieldStruct("hrd_parameters", func(d *decode.D) {
+				hevcHrdParameters(d, true, spsMaxSubLayersMinus1)
+			})
+		}
+	}
+	bitstreamRestrictionFlag := d.FieldBool("bitstream_restriction_flag")
+	if bitstreamRestrictionFlag {
+		d.FieldBool("tiles_fixed_structure_flag")
+		d.FieldBool("motion_vectors_over_pic_boundaries_flag")
+		d.FieldBool("restricted_ref_pic_lists_flag")
+		d.FieldUFn("min_spatial_segmentation_idc", uEV)
+		d.FieldUFn("max_bytes_per_pic_denom", uEV)
+		d.FieldUFn("max_bits_per_min_cu_denom", uEV)
+		d.FieldUFn("log2_max_mv_length_horizontal", uEV)
+		d.FieldUFn("log2_max_mv_length_vertical", uEV)
+	}
+}
+
+func hevcSPSDecode(d *decode.D, in interface{}) interface{} {
+	d.FieldU4("sps_video_parameter_set_id")
+	spsMaxSubLayersMinus1 := d.FieldU3("sps_max_sub_layers", scalar.UAdd(1)) - 1
+	d.FieldBool("sps_temporal_id_nesting_flag")
+	d.FieldStruct("profile_tier_level", func(d *decode.D) {
+		hevcProfileTierLevel(d, true, spsMaxSubLayersMinus1)
+	})
+	d.FieldUFn("sps_seq_parameter_set_id", uEV)
+	chromaFormatIdc := d.FieldUFn("chroma_format_idc", uEV, hevcChromaFormatNames)
+	if chromaFormatIdc == 3 {
+		d.FieldBool("separate_colour_plane_flag")
+	}
+	d.FieldUFn("pic_width_in_luma_samples", uEV)
+	d.FieldUFn("pic_height_in_luma_samples", uEV)
+	conformanceWindowFlag := d.FieldBool("conformance_window_flag")
+	if conformanceWindowFlag {
+		d.FieldUFn("conf_win_left_offset", uEV)
+		d.FieldUFn("conf_win_right_offset", uEV)
+		d.FieldUFn("conf_win_top_offset", uEV)
+		d.FieldUFn("conf_win_bottom_offset", uEV)
+	}
+	d.FieldUFn("bit_depth_luma", uEV, scalar.UAdd(8))
+	d.FieldUFn("bit_depth_chroma", uEV, scalar.UAdd(8))
+	log2MaxPicOrderCntLsb := d.FieldUFn("log2_max_pic_order_cnt_lsb", uEV, scalar.UAdd(4))
+	spsSubLayerOrderingInfoPresentFlag := d.FieldBool("sps_sub_layer_ordering_info_present_flag")
+	d.FieldArray("sub_layer_ordering_infos", func(d *decode.D) {
+		i := spsMaxSubLayersMinus1
+		if spsSubLayerOrderingInfoPresentFlag {
+			i = 0
+		}
+		for ; i <= spsMaxSubLayersMinus1; i++ {
+			d.FieldStruct("sub_layer_ordering_info", func(d *decode.D) {
+				d.FieldUFn("sps_max_dec_pic_buffering", uEV, scalar.UAdd(1))
+				d.FieldUFn("sps_max_num_reorder_pics", uEV)
+				d.FieldUFn("sps_max_latency_increase_plus1", uEV)
+			})
+		}
+	})
+	d.FieldUFn("log2_min_luma_coding_block_size", uEV, scalar.UAdd(3))
+	d.FieldUFn("log2_diff_max_min_luma_coding_block_size", uEV)
+	d.FieldUFn("log2_min_luma_transform_block_size", uEV, scalar.UAdd(2))
+	d.FieldUFn("log2_diff_max_min_luma_transform_block_size", uEV)
+	d.FieldUFn("max_transform_hierarchy_depth_inter", uEV)
+	d.FieldUFn("max_transform_hierarchy_depth_intra", uEV)
+	scalingListEnabledFlag := d.FieldBool("scaling_list_enabled_flag")
+	if scalingListEnabledFlag {
+		spsScalingListDataPresentFlag := d.FieldBool("sps_scaling_list_data_present_flag")
+		if spsScalingListDataPresentFlag {
+			d.FieldStruct("scaling_list_data", hevcScalingListData)
+		}
+	}
+	d.FieldBool("amp_enabled_flag")
+	d.FieldBool("sample_adaptive_offset_enabled_flag")
+	pcmEnabledFlag := d.FieldBool("pcm_enabled_flag")
+	if pcmEnabledFlag {
+		d.FieldU4("pcm_sample_bit_depth_luma", scalar.UAdd(1))
+		d.FieldU4("pcm_sample_bit_depth_chroma", scalar.UAdd(1))
+		d.FieldUFn("log2_min_pcm_luma_coding_block_size", uEV, scalar.UAdd(3))
+		d.FieldUFn("log2_diff_max_min_pcm_luma_coding_block_size", uEV)
+		d.FieldBool("pcm_loop_filter_disabled_flag")
+	}
+	numShortTermRefPicSets := d.FieldUFn("num_short_term_ref_pic_sets", uEV)
+	d.FieldArray("st_ref_pic_sets", func(d *decode.D) {
+		var sets []hevcStRefPicSet
+		for i := 0; i < int(numShortTermRefPicSets); i++ {
+			d.FieldStruct("st_ref_pic_set", func(d *decode.D) {
+				sets = append(sets, hevcStRefPicSetDecode(d, i, sets))
+			})
+		}
+	})
+	longTermRefPicsPresentFlag := d.FieldBool("long_term_ref_pics_present_flag")
+	if longTermRefPicsPresentFlag {
+		numLongTermRefPicsSps := d.FieldUFn("num_long_term_ref_pics_sps", uEV)
+		d.FieldArray("long_term_ref_pics", func(d *decode.D) {
+			for i := uint64(0); i < numLongTermRefPicsSps; i++ {
+				d.FieldStruct("long_term_ref_pic", func(d *decode.D) {
+					d.FieldU("lt_ref_pic_poc_lsb_sps", int(log2MaxPicOrderCntLsb))
+					d.FieldBool("used_by_curr_pic_lt_sps_flag")
+				})
+			}
+		})
+	}
+	d.FieldBool("sps_temporal_mvp_enabled_flag")
+	d.FieldBool("strong_intra_smoothing_enabled_flag")
+	vuiParametersPresentFlag := d.FieldBool("vui_parameters_present_flag")
+	if vuiParametersPresentFlag {
+		d.FieldStruct("vui_parameters", func(d *decode.D) {
+			hevcVuiParameters(d, spsMaxSubLayersMinus1)
+		})
+	}
+	spsExtensionPresentFlag := d.FieldBool("sps_extension_present_flag")
+	if spsExtensionPresentFlag {
+		d.FieldBool("sps_range_extension_flag")
+		d.FieldBool("sps_multilayer_extension_flag")
+		d.FieldBool("sps_3d_extension_flag")
+		d.FieldBool("sps_scc_extension_flag")
+		d.FieldU4("sps_extension_4bits")
+	}
+
+	// TODO: extensions
+	d.FieldRawLen("rbsp_trailing_bits", d.BitsLeft())
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package mpeg
+
+// ITU-T H.265 7.3.2.1 Video parameter set RBSP syntax
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.HEVC_VPS,
+		Description: "H.265/HEVC Video Parameter Set",
+		DecodeFn:    hevcVPSDecode,
+	})
+}
+
+func hevcVPSDecode(d *decode.D, in interface{}) interface{} {
+	d.FieldU4("vps_video_parameter_set_id")
+	d.FieldBool("vps_base_layer_internal_flag")
+	d.FieldBool("vps_base_layer_available_flag")
+	d.FieldU6("vps_max_layers", scalar.UAdd(1))
+	vpsMaxSubLayersMinus1 := d.FieldU3("vps_max_sub_layers", scalar.UAdd(1)) - 1
+	d.FieldBool("vps_temporal_id_nesting_flag")
+	d.FieldU16("vps_reserved_0xffff_16bits", scalar.Hex)
+	d.FieldStruct("profile_tier_level", func(d *decode.D) {
+		hevcProfileTierLevel(d, true, vpsMaxSubLayersMinus1)
+	})
+	vpsSubLayerOrderingInfoPresentFlag := d.FieldBool("vps_sub_layer_ordering_info_present_flag")
+	d.FieldArray("sub_layer_ordering_infos", func(d *decode.D) {
+		i := vpsMaxSubLayersMinus1
+		if vpsSubLayerOrderingInfoPresentFlag {
+			i = 0
+		}
+		for ; i <= vpsMaxSubLayersMinus1; i++ {
+			d.FieldStruct("sub_layer_ordering_info", func(d *decode.D) {
+				d.FieldUFn("vps_max_dec_pic_buffering", uEV, scalar.UAdd(1))
+				d.FieldUFn("vps_max_num_reorder_pics", uEV)
+				d.FieldUFn("vps_max_latency_increase_plus1", uEV)
+			})
+		}
+	})
+	vpsMaxLayerID := d.FieldU6("vps_max_layer_id")
+	vpsNumLayerSets := d.FieldUFn("vps_num_layer_sets", uEV, scalar.UAdd(1))
+	d.FieldArray("layer_sets", func(d *decode.D) {
+		for i := uint64(1); i < vpsNumLayerSets; i++ {
+			d.FieldStruct("layer_set", func(d *decode.D) {
+				d.FieldArray("layer_id_included_flags", func(d *decode.D) {
+					for j := uint64(0); j <= vpsMaxLayerID; j++ {
+						d.FieldBool("layer_id_included_flag")
+					}
+				})
+			})
+		}
+	})
+	vpsTimingInfoPresentFlag := d.FieldBool("vps_timing_info_present_flag")
+	if vpsTimingInfoPresentFlag {
+		d.FieldU32("vps_num_units_in_tick")
+		d.FieldU32("vps_time_scale")
+		vpsPocProportionalToTimingFlag := d.FieldBool("vps_poc_proportional_to_timing_flag")
+		if vpsPocProportionalToTimingFlag {
+			d.FieldUFn("vps_num_ticks_poc_diff_one", uEV, scalar.UAdd(1))
+		}
+		vpsNumHrdParameters := d.FieldUFn("vps_num_hrd_parameters", uEV)
+		d.FieldArray("hrd_parameters", func(d *decode.D) {
+			for i := uint64(0); i < vpsNumHrdParameters; i++ {
+				d.FieldStruct("hrd_parameters", func(d *decode.D) {
+					d.FieldUFn("hrd_layer_set_idx", uEV)
+					cprmsPresentFlag := true
+					if i > 0 {
+						cprmsPresentFlag = d.FieldBool("cprms_present_flag")
+					}
+					hevcHrdParameters(d, cprmsPresentFlag, vpsMaxSubLayersMinus1)
+				})
+			}
+		})
+	}
+	d.FieldBool("vps_extension_flag")
+
+	// TODO: extensions
+	d.FieldRawLen("rbsp_trailing_bits", d.BitsLeft())
+
+	return nil
+}
@@ -1,12 +1,35 @@
 package mpeg
 
+// ISO/IEC 13818-1 Transport Stream
+// https://en.wikipedia.org/wiki/MPEG_transport_stream
+// https://en.wikipedia.org/wiki/Program-specific_information
+// https://en.wikipedia.org/wiki/Packetized_elementary_stream
+
+// TODO: m2ts with 4 byte timecode prefix
+// TODO: SDT/NIT/EIT and other DVB tables
+// TODO: sections with section_syntax_indicator but no crc
+
 import (
+	"embed"
+
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/checksum"
 	"github.com/wader/fq/pkg/decode"
 	"github.com/wader/fq/pkg/scalar"
 )
 
+//go:embed mpeg_ts.jq
+var mpegTSFS embed.FS
+
+var tsPacketFormat decode.Group
+var tsADTSFormat decode.Group
+var tsAVCAnnexBFormat decode.Group
+var tsHEVCAnnexBFormat decode.Group
+var tsMP3Format decode.Group
+var tsAC3Format decode.Group
+
 func init() {
 	registry.MustRegister(decode.Format{
 		Name:        format.MPEG_TS,
@@ -14,20 +37,611 @@ func init() {
 		Description: "MPEG Transport Stream",
 		Groups:      []string{format.PROBE},
 		DecodeFn:    tsDecode,
+		Files:       mpegTSFS,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.MPEG_TS_PACKET}, Group: &tsPacketFormat},
+			{Names: []string{format.ADTS}, Group: &tsADTSFormat},
+			{Names: []string{format.AVC_ANNEXB}, Group: &tsAVCAnnexBFormat},
+			{Names: []string{format.HEVC_ANNEXB}, Group: &tsHEVCAnnexBFormat},
+			{Names: []string{format.MP3}, Group: &tsMP3Format},
+			{Names: []string{format.AC3}, Group: &tsAC3Format},
+		},
 	})
 }
 
-// TODO: ts_packet
+const (
+	tsTableIDPAT = 0x00
+	tsTableIDPMT = 0x02
+)
+
+var tsTableIDNames = scalar.URangeToScalar{
+	{0x00, 0x00}: {Sym: "pat", Description: "Program association section"},
+	{0x01, 0x01}: {Sym: "cat", Description: "Conditional access section"},
+	{0x02, 0x02}: {Sym: "pmt", Description: "Program map section"},
+	{0x03, 0x03}: {Sym: "tsdt", Description: "Transport stream description section"},
+	{0x04, 0x3f}: {Sym: "reserved"},
+	{0x40, 0x40}: {Sym: "nit_actual", Description: "Network information section actual network"},
+	{0x41, 0x41}: {Sym: "nit_other", Description: "Network information section other network"},
+	{0x42, 0x42}: {Sym: "sdt_actual", Description: "Service description section actual transport stream"},
+	{0x46, 0x46}: {Sym: "sdt_other", Description: "Service description section other transport stream"},
+	{0x4e, 0x6f}: {Sym: "eit", Description: "Event information section"},
+	{0x70, 0x70}: {Sym: "tdt", Description: "Time date section"},
+	{0x73, 0x73}: {Sym: "tot", Description: "Time offset section"},
+	{0xff, 0xff}: {Sym: "forbidden"},
+}
+
+const (
+	tsStreamTypeMPEG1Audio = 0x03
+	tsStreamTypeMPEG2Audio = 0x04
+	tsStreamTypePrivatePES = 0x06
+	tsStreamTypeADTS       = 0x0f
+	tsStreamTypeAVC        = 0x1b
+	tsStreamTypeHEVC       = 0x24
+	tsStreamTypeAC3        = 0x81
+	tsStreamTypeEAC3       = 0x87
+)
+
+var tsStreamTypeNames = scalar.UToScalar{
+	0x01:                   {Sym: "mpeg1_video", Description: "ISO/IEC 11172-2 Video"},
+	0x02:                   {Sym: "mpeg2_video", Description: "ISO/IEC 13818-2 Video"},
+	tsStreamTypeMPEG1Audio: {Sym: "mpeg1_audio", Description: "ISO/IEC 11172-3 Audio"},
+	tsStreamTypeMPEG2Audio: {Sym: "mpeg2_audio", Description: "ISO/IEC 13818-3 Audio"},
+	0x05:                   {Sym: "private_sections", Description: "ISO/IEC 13818-1 private sections"},
+	tsStreamTypePrivatePES: {Sym: "private_pes", Description: "ISO/IEC 13818-1 PES packets containing private data"},
+	0x0b:                   {Sym: "dsmcc_sections", Description: "ISO/IEC 13818-6 type B"},
+	tsStreamTypeADTS:       {Sym: "adts", Description: "ISO/IEC 13818-7 Audio with ADTS transport syntax"},
+	0x10:                   {Sym: "mpeg4_visual", Description: "ISO/IEC 14496-2 Visual"},
+	0x11:                   {Sym: "latm", Description: "ISO/IEC 14496-3 Audio with LATM transport syntax"},
+	0x15:                   {Sym: "metadata", Description: "Metadata carried in PES packets"},
+	tsStreamTypeAVC:        {Sym: "avc", Description: "ITU-T Rec. H.264 | ISO/IEC 14496-10 Video"},
+	tsStreamTypeHEVC:       {Sym: "hevc", Description: "ITU-T Rec. H.265 | ISO/IEC 23008-2 Video"},
+	tsStreamTypeAC3:        {Sym: "ac3", Description: "ATSC A/52 AC-3 Audio"},
+	0x86:                   {Sym: "scte35", Description: "SCTE-35 splice information"},
+	tsStreamTypeEAC3:       {Sym: "eac3", Description: "ATSC A/52 E-AC-3 Audio"},
+}
+
+const (
+	tsDescriptorRegistration = 0x05
+	tsDescriptorISO639       = 0x0a
+	tsDescriptorAC3          = 0x6a
+	tsDescriptorEAC3         = 0x7a
+)
+
+var tsDescriptorTagNames = scalar.UToSymStr{
+	0x02:                     "video_stream",
+	0x03:                     "audio_stream",
+	0x04:                     "hierarchy",
+	tsDescriptorRegistration: "registration",
+	0x06:                     "data_stream_alignment",
+	0x07:                     "target_background_grid",
+	0x08:                     "video_window",
+	0x09:                     "ca",
+	tsDescriptorISO639:       "iso_639_language",
+	0x0b:                     "system_clock",
+	0x0c:                     "multiplex_buffer_utilization",
+	0x0d:                     "copyright",
+	0x0e:                     "maximum_bitrate",
+	0x0f:                     "private_data_indicator",
+	0x10:                     "smoothing_buffer",
+	0x11:                     "std",
+	0x12:                     "ibp",
+	0x1c:                     "mpeg4_audio",
+	0x26:                     "metadata",
+	0x28:                     "avc_video",
+	0x2a:                     "avc_timing_and_hrd",
+	0x2b:                     "mpeg2_aac_audio",
+	0x38:                     "hevc_video",
+	0x48:                     "service",
+	0x52:                     "stream_identifier",
+	0x56:                     "teletext",
+	0x59:                     "subtitling",
+	tsDescriptorAC3:          "ac3",
+	tsDescriptorEAC3:         "enhanced_ac3",
+	0x7c:                     "aac",
+}
+
+var tsAudioTypeNames = scalar.UToSymStr{
+	0x00: "undefined",
+	0x01: "clean_effects",
+	0x02: "hearing_impaired",
+	0x03: "visual_impaired_commentary",
+}
+
+type tsStreamKind int
+
+const (
+	tsStreamPSI tsStreamKind = iota
+	tsStreamPES
+)
+
+type tsStream struct {
+	kind              tsStreamKind
+	streamType        int
+	codec             *decode.Group
+	d                 *decode.D
+	buf               []byte
+	started           bool
+	continuityCounter int
+	// discontinuity_indicator seen for current PES packet
+	discontinuity bool
+}
+
+type tsDecoder struct {
+	streamsD *decode.D
+	streams  map[int]*tsStream
+	// streams in order of first seen packet
+	order []*tsStream
+}
+
+func tsStreamCodec(streamType int, descriptors []tsDescriptor) *decode.Group {
+	switch streamType {
+	case tsStreamTypeMPEG1Audio, tsStreamTypeMPEG2Audio:
+		return &tsMP3Format
+	case tsStreamTypeADTS:
+		return &tsADTSFormat
+	case tsStreamTypeAVC:
+		return &tsAVCAnnexBFormat
+	case tsStreamTypeHEVC:
+		return &tsHEVCAnnexBFormat
+	case tsStreamTypeAC3, tsStreamTypeEAC3:
+		return &tsAC3Format
+	case tsStreamTypePrivatePES:
+		for _, desc := range descriptors {
+			switch {
+			case desc.tag == tsDescriptorAC3,
+				desc.tag == tsDescriptorEAC3,
+				desc.tag == tsDescriptorRegistration && (desc.formatIdentifier == "AC-3" || desc.formatIdentifier == "EAC3"):
+				return &tsAC3Format
+			}
+		}
+	}
+	return nil
+}
+
+type tsDescriptor struct {
+	tag              uint64
+	formatIdentifier string
+}
+
+func tsDecodeDescriptors(d *decode.D) []tsDescriptor {
+	var descs []tsDescriptor
+	for d.NotEnd() {
+		d.FieldStruct("descriptor", func(d *decode.D) {
+			var desc tsDescriptor
+			desc.tag = d.FieldU8("tag", tsDescriptorTagNames, scalar.Hex)
+			length := d.FieldU8("length")
+			d.LenFn(int64(length)*8, func(d *decode.D) {
+				switch desc.tag {
+				case tsDescriptorRegistration:
+					desc.formatIdentifier = d.FieldUTF8("format_identifier", 4)
+					if d.NotEnd() {
+						d.FieldRawLen("additional_identification_info", d.BitsLeft())
+					}
+				case tsDescriptorISO639:
+					d.FieldArray("languages", func(d *decode.D) {
+						for d.NotEnd() {
+							d.FieldStruct("language", func(d *decode.D) {
+								d.FieldUTF8("code", 3)
+								d.FieldU8("audio_type", tsAudioTypeNames)
+							})
+						}
+					})
+				default:
+					d.FieldRawLen("data", d.BitsLeft())
+				}
+			})
+			descs = append(descs, desc)
+		})
+	}
+	return descs
+}
+
+func (tsd *tsDecoder) addStream(pid int, s *tsStream) {
+	if _, ok := tsd.streams[pid]; ok {
+		return
+	}
+	s.continuityCounter = -1
+	tsd.streams[pid] = s
+}
+
+func (tsd *tsDecoder) decodePAT(d *decode.D) {
+	d.FieldArray("programs", func(d *decode.D) {
+		for d.NotEnd() {
+			d.FieldStruct("program", func(d *decode.D) {
+				programNumber := d.FieldU16("program_number")
+				d.FieldU3("reserved")
+				if programNumber == 0 {
+					d.FieldU13("network_pid", scalar.Hex)
+					return
+				}
+				pid := d.FieldU13("program_map_pid", scalar.Hex)
+				tsd.addStream(int(pid), &tsStream{kind: tsStreamPSI})
+			})
+		}
+	})
+}
+
+func (tsd *tsDecoder) decodePMT(d *decode.D) {
+	d.FieldU3("reserved2")
+	d.FieldU13("pcr_pid", scalar.Hex)
+	d.FieldU4("reserved3")
+	programInfoLength := d.FieldU12("program_info_length")
+	d.FieldArray("descriptors", func(d *decode.D) {
+		d.LenFn(int64(programInfoLength)*8, func(d *decode.D) { tsDecodeDescriptors(d) })
+	})
+	d.FieldArray("streams", func(d *decode.D) {
+		for d.NotEnd() {
+			d.FieldStruct("stream", func(d *decode.D) {
+				streamType := d.FieldU8("stream_type", tsStreamTypeNames, scalar.Hex)
+				d.FieldU3("reserved0")
+				pid := d.FieldU13("elementary_pid", scalar.Hex)
+				d.FieldU4("reserved1")
+				esInfoLength := d.FieldU12("es_info_length")
+				var descs []tsDescriptor
+				d.FieldArray("descriptors", func(d *decode.D) {
+					d.LenFn(int64(esInfoLength)*8, func(d *decode.D) { descs = tsDecodeDescriptors(d) })
+				})
+				tsd.addStream(int(pid), &tsStream{
+					kind:       tsStreamPES,
+					streamType: int(streamType),
+					codec:      tsStreamCodec(int(streamType), descs),
+				})
+			})
+		}
+	})
+}
+
+func (tsd *tsDecoder) decodeSection(d *decode.D) {
+	tableID := d.FieldU8("table_id", tsTableIDNames, scalar.Hex)
+	sectionSyntaxIndicator := d.FieldBool("section_syntax_indicator")
+	d.FieldBool("private_indicator")
+	d.FieldU2("reserved0")
+	sectionLength := d.FieldU12("section_length")
+
+	if !sectionSyntaxIndicator {
+		d.FieldRawLen("data", int64(sectionLength)*8)
+		return
+	}
+	if sectionLength < 9 {
+		d.Fatalf("section_length %d too small", sectionLength)
+	}
+
+	switch tableID {
+	case tsTableIDPAT:
+		d.FieldU16("transport_stream_id")
+	case tsTableIDPMT:
+		d.FieldU16("program_number")
+	default:
+		d.FieldU16("table_id_extension")
+	}
+	d.FieldU2("reserved1")
+	d.FieldU5("version_number")
+	d.FieldBool("current_next_indicator")
+	d.FieldU8("section_number")
+	d.FieldU8("last_section_number")
+
+	d.LenFn(int64(sectionLength-9)*8, func(d *decode.D) {
+		switch tableID {
+		case tsTableIDPAT:
+			tsd.decodePAT(d)
+		case tsTableIDPMT:
+			tsd.decodePMT(d)
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+
+	crcEnd := d.Pos()
+	sectionCRC := &checksum.CRC{Bits: 32, Current: 0xffff_ffff, Table: checksum.Poly04c11db7Table}
+	d.MustCopy(sectionCRC, d.BitBufRange(0, crcEnd))
+	d.FieldChecksumU("crc", 32, "crc32", sectionCRC.Sum64(), scalar.Hex)
+}
+
+// decode complete sections in buffer, rest is kept until more data arrives
+func (tsd *tsDecoder) flushSections(s *tsStream) {
+	for len(s.buf) >= 3 {
+		if s.buf[0] == 0xff {
+			// stuffing until next payload unit start
+			s.buf = nil
+			s.started = false
+			return
+		}
+		sectionLength := int(s.buf[1]&0x0f)<<8 | int(s.buf[2])
+		if len(s.buf) < 3+sectionLength {
+			return
+		}
+		bb := bitio.NewBufferFromBytes(s.buf[0:3+sectionLength], -1)
+		s.d.FieldStructRootBitBufFn("section", bb, tsd.decodeSection)
+		s.buf = s.buf[3+sectionLength:]
+	}
+}
+
+// pes_packet_length zero means unbounded, only allowed for video
+func tsPESPacketDone(b []byte) bool {
+	if len(b) < 6 {
+		return false
+	}
+	packetLength := int(b[4])<<8 | int(b[5])
+	return packetLength != 0 && len(b) >= 6+packetLength
+}
+
+func (tsd *tsDecoder) flushPES(s *tsStream) {
+	if len(s.buf) == 0 {
+		return
+	}
+	bb := bitio.NewBufferFromBytes(s.buf, -1)
+	discontinuity := s.discontinuity
+	s.d.FieldStructRootBitBufFn("packet", bb, func(d *decode.D) {
+		pesDecodeTSPacket(d, s.codec)
+		// timestamps are allowed to jump
+		if discontinuity {
+			d.FieldValueBool("discontinuity", true)
+		}
+	})
+	s.buf = nil
+	s.started = false
+	s.discontinuity = false
+}
+
+func (tsd *tsDecoder) packet(p tsPacket) {
+	s, ok := tsd.streams[p.pid]
+	if !ok || !p.hasPayload {
+		return
+	}
+
+	if s.d == nil {
+		tsd.streamsD.FieldStruct("stream", func(d *decode.D) {
+			d.FieldValueU("pid", uint64(p.pid), tsPIDNames, scalar.Hex)
+			switch s.kind {
+			case tsStreamPSI:
+				s.d = d.FieldArrayValue("sections")
+			case tsStreamPES:
+				d.FieldValueU("stream_type", uint64(s.streamType), tsStreamTypeNames, scalar.Hex)
+				s.d = d.FieldArrayValue("packets")
+			}
+		})
+		tsd.order = append(tsd.order, s)
+	}
+
+	// missing packets, drop partial unit
+	if s.continuityCounter != -1 && !p.discontinuity && (s.continuityCounter+1)&0xf != p.continuityCounter {
+		s.buf = nil
+		s.started = false
+	}
+	s.continuityCounter = p.continuityCounter
+
+	if p.scrambled {
+		s.buf = nil
+		s.started = false
+		return
+	}
+
+	switch s.kind {
+	case tsStreamPSI:
+		payload := p.payload
+		if p.payloadUnitStart {
+			if len(payload) == 0 {
+				return
+			}
+			pointerField := int(payload[0])
+			payload = payload[1:]
+			if pointerField > len(payload) {
+				s.buf = nil
+				s.started = false
+				return
+			}
+			if s.started {
+				s.buf = append(s.buf, payload[0:pointerField]...)
+				tsd.flushSections(s)
+			}
+			s.buf = append([]byte{}, payload[pointerField:]...)
+			s.started = true
+		} else if s.started {
+			s.buf = append(s.buf, payload...)
+		}
+		tsd.flushSections(s)
+	case tsStreamPES:
+		if p.payloadUnitStart {
+			tsd.flushPES(s)
+			s.started = true
+		}
+		if p.discontinuity {
+			s.discontinuity = true
+		}
+		if !s.started {
+			return
+		}
+		s.buf = append(s.buf, p.payload...)
+		if tsPESPacketDone(s.buf) {
+			tsd.flushPES(s)
+		}
+	}
+}
 
 func tsDecode(d *decode.D, in interface{}) interface{} {
-	d.FieldU8("sync", d.AssertU(0x47), scalar.Hex)
-	d.FieldBool("transport_error_indicator")
-	d.FieldBool("payload_unit_start")
-	d.FieldBool("transport_priority")
-	d.FieldU13("pid")
-	d.FieldU2("transport_scrambling_control")
-	d.FieldU2("adaptation_field_control")
-	d.FieldU4("continuity_counter")
+	// require sync byte for second packet if there is one
+	if d.BitsLeft() >= (tsPacketLength+1)*8 && d.PeekBytes(tsPacketLength + 1)[tsPacketLength] != tsSyncByte {
+		d.Fatalf("no sync byte for second packet")
+	}
+
+	tsd := &tsDecoder{
+		streamsD: d.FieldArrayValue("streams"),
+		streams: map[int]*tsStream{
+			tsPIDPAT: {kind: tsStreamPSI, continuityCounter: -1},
+		},
+	}
+
+	validPackets := 0
+	d.FieldArray("packets", func(d *decode.D) {
+		for d.NotEnd() {
+			_, v, err := d.TryFieldFormat("packet", tsPacketFormat, nil)
+			if err != nil {
+				break
+			}
+			p, ok := v.(tsPacket)
+			if !ok {
+				panic("packet decode is not a tsPacket")
+			}
+			if p.pid != tsPIDNull {
+				tsd.packet(p)
+			}
+			validPackets++
+		}
+	})
+
+	if validPackets == 0 {
+		d.Fatalf("no packets found")
+	}
+
+	// unbounded or truncated PES packets
+	for _, s := range tsd.order {
+		if s.kind == tsStreamPES && s.started {
+			tsd.flushPES(s)
+		}
+	}
+
+	if d.NotEnd() {
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
 
 	return nil
 }
+
+// 33 bit timestamp in 90kHz split by marker bits
+func decodeTimestamp33(d *decode.D) uint64 {
+	ts0 := d.U3()
+	d.U1()
+	ts1 := d.U15()
+	d.U1()
+	ts2 := d.U15()
+	d.U1()
+	return ts0<<30 | ts1<<15 | ts2
+}
+
+// timestamp with 4 bit prefix, 0010 for pts only otherwise 0011 and 0001
+func pesDecodeTimestamp(d *decode.D) uint64 {
+	d.U4()
+	return decodeTimestamp33(d)
+}
+
+const (
+	pesStreamIDProgramStreamMap = 0xbc
+	pesStreamIDPadding          = 0xbe
+	pesStreamIDPrivateStream2   = 0xbf
+	pesStreamIDECM              = 0xf0
+	pesStreamIDEMM              = 0xf1
+	pesStreamIDDSMCC            = 0xf2
+	pesStreamIDH2221TypeE       = 0xf8
+	pesStreamIDDirectory        = 0xff
+)
+
+var pesPTSDTSFlagsNames = scalar.UToSymStr{
+	0b00: "none",
+	0b01: "forbidden",
+	0b10: "pts",
+	0b11: "pts_dts",
+}
+
+func pesHasOptionalHeader(streamID uint64) bool {
+	switch streamID {
+	case pesStreamIDProgramStreamMap,
+		pesStreamIDPadding,
+		pesStreamIDPrivateStream2,
+		pesStreamIDECM,
+		pesStreamIDEMM,
+		pesStreamIDDSMCC,
+		pesStreamIDH2221TypeE,
+		pesStreamIDDirectory:
+		return false
+	default:
+		return true
+	}
+}
+
+// PES packet reassembled from transport stream packets, payload is decoded
+// with codec if known
+func pesDecodeTSPacket(d *decode.D, codec *decode.Group) {
+	d.FieldU24("prefix", d.AssertU(0b0000_0000_0000_0000_0000_0001), scalar.Bin)
+	streamID := d.FieldU8("stream_id", startAndStreamNames, scalar.Hex)
+	packetLength := d.FieldU16("packet_length")
+	packetEnd := d.Len()
+	if packetLength != 0 && 48+int64(packetLength)*8 < packetEnd {
+		packetEnd = 48 + int64(packetLength)*8
+	}
+
+	if pesHasOptionalHeader(streamID) {
+		d.FieldStruct("header", func(d *decode.D) {
+			d.FieldU2("marker", d.AssertU(0b10))
+			d.FieldU2("scrambling_control", tsScramblingControlNames)
+			d.FieldBool("priority")
+			d.FieldBool("data_alignment_indicator")
+			d.FieldBool("copyright")
+			d.FieldBool("original")
+			ptsDTSFlags := d.FieldU2("pts_dts_flags", pesPTSDTSFlagsNames)
+			escrFlag := d.FieldBool("escr_flag")
+			esRateFlag := d.FieldBool("es_rate_flag")
+			dsmTrickModeFlag := d.FieldBool("dsm_trick_mode_flag")
+			additionalCopyInfoFlag := d.FieldBool("additional_copy_info_flag")
+			crcFlag := d.FieldBool("crc_flag")
+			extensionFlag := d.FieldBool("extension_flag")
+			headerDataLength := d.FieldU8("header_data_length")
+			d.LenFn(int64(headerDataLength)*8, func(d *decode.D) {
+				if ptsDTSFlags&0b10 != 0 {
+					d.FieldUFn("pts", pesDecodeTimestamp)
+				}
+				if ptsDTSFlags == 0b11 {
+					d.FieldUFn("dts", pesDecodeTimestamp)
+				}
+				if escrFlag {
+					d.FieldStruct("escr", func(d *decode.D) {
+						d.FieldU2("reserved")
+						base0 := d.FieldU3("base0")
+						d.FieldU1("marker0")
+						base1 := d.FieldU15("base1")
+						d.FieldU1("marker1")
+						base2 := d.FieldU15("base2")
+						d.FieldU1("marker2")
+						ext := d.FieldU9("extension")
+						d.FieldU1("marker3")
+						d.FieldValueU("value", (base0<<30|base1<<15|base2)*300+ext, scalar.Description("27MHz"))
+					})
+				}
+				if esRateFlag {
+					d.FieldU1("es_rate_marker0")
+					d.FieldU22("es_rate")
+					d.FieldU1("es_rate_marker1")
+				}
+				if dsmTrickModeFlag {
+					d.FieldU8("dsm_trick_mode")
+				}
+				if additionalCopyInfoFlag {
+					d.FieldU1("additional_copy_info_marker")
+					d.FieldU7("additional_copy_info")
+				}
+				if crcFlag {
+					d.FieldU16("previous_packet_crc", scalar.Hex)
+				}
+				if extensionFlag {
+					// TODO: pes extension fields
+					d.FieldRawLen("extension", d.BitsLeft())
+				}
+				if d.NotEnd() {
+					d.FieldRawLen("stuffing", d.BitsLeft())
+				}
+			})
+		})
+	}
+
+	dataLen := packetEnd - d.Pos()
+	if dataLen < 0 {
+		d.Fatalf("header longer than packet")
+	}
+	if codec == nil || dataLen == 0 {
+		d.FieldRawLen("data", dataLen)
+	} else if dv, _, _ := d.TryFieldFormatLen("data", dataLen, *codec, nil); dv == nil {
+		d.FieldRawLen("data", dataLen)
+	}
+	if d.NotEnd() {
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+}
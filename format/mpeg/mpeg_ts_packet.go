@@ -0,0 +1,177 @@
+package mpeg
+
+// ISO/IEC 13818-1 2.4.3.2 Transport Stream packet layer
+// https://en.wikipedia.org/wiki/MPEG_transport_stream
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.MPEG_TS_PACKET,
+		Description: "MPEG Transport Stream packet",
+		DecodeFn:    tsPacketDecode,
+	})
+}
+
+const (
+	tsPacketLength = 188
+	tsSyncByte     = 0x47
+)
+
+const (
+	tsPIDPAT  = 0x0000
+	tsPIDNull = 0x1fff
+)
+
+var tsPIDNames = scalar.URangeToScalar{
+	{0x0000, 0x0000}: {Sym: "pat"},
+	{0x0001, 0x0001}: {Sym: "cat"},
+	{0x0002, 0x0002}: {Sym: "tsdt"},
+	{0x0003, 0x0003}: {Sym: "ipmp"},
+	{0x0004, 0x000f}: {Sym: "reserved"},
+	{0x0010, 0x0010}: {Sym: "nit"},
+	{0x0011, 0x0011}: {Sym: "sdt"},
+	{0x0012, 0x0012}: {Sym: "eit"},
+	{0x0014, 0x0014}: {Sym: "tdt"},
+	{0x1fff, 0x1fff}: {Sym: "null"},
+}
+
+var tsScramblingControlNames = scalar.UToSymStr{
+	0b00: "not_scrambled",
+	0b01: "reserved",
+	0b10: "even_key",
+	0b11: "odd_key",
+}
+
+const (
+	tsAdaptationFieldPayload = 0b01
+	tsAdaptationFieldOnly    = 0b10
+)
+
+var tsAdaptationFieldControlNames = scalar.UToSymStr{
+	0b00: "reserved",
+	0b01: "payload_only",
+	0b10: "adaptation_field_only",
+	0b11: "adaptation_field_and_payload",
+}
+
+type tsPacket struct {
+	pid               int
+	payloadUnitStart  bool
+	continuityCounter int
+	discontinuity     bool
+	hasPayload        bool
+	scrambled         bool
+	payload           []byte
+}
+
+// program clock reference, 33 bit base in 90kHz and 9 bit extension in 27MHz
+func tsDecodePCR(d *decode.D) {
+	base := d.FieldU33("base")
+	d.FieldU6("reserved")
+	ext := d.FieldU9("extension")
+	d.FieldValueU("value", base*300+ext, scalar.Description("27MHz"))
+}
+
+func tsDecodeAdaptationField(d *decode.D) bool {
+	var discontinuity bool
+	length := d.FieldU8("length")
+	if length == 0 {
+		return false
+	}
+
+	d.LenFn(int64(length)*8, func(d *decode.D) {
+		discontinuity = d.FieldBool("discontinuity_indicator")
+		d.FieldBool("random_access_indicator")
+		d.FieldBool("elementary_stream_priority_indicator")
+		pcrFlag := d.FieldBool("pcr_flag")
+		opcrFlag := d.FieldBool("opcr_flag")
+		splicingPointFlag := d.FieldBool("splicing_point_flag")
+		transportPrivateDataFlag := d.FieldBool("transport_private_data_flag")
+		extensionFlag := d.FieldBool("adaptation_field_extension_flag")
+		if pcrFlag {
+			d.FieldStruct("pcr", tsDecodePCR)
+		}
+		if opcrFlag {
+			d.FieldStruct("opcr", tsDecodePCR)
+		}
+		if splicingPointFlag {
+			d.FieldS8("splice_countdown")
+		}
+		if transportPrivateDataFlag {
+			privateDataLength := d.FieldU8("transport_private_data_length")
+			d.FieldRawLen("transport_private_data", int64(privateDataLength)*8)
+		}
+		if extensionFlag {
+			d.FieldStruct("extension", func(d *decode.D) {
+				extensionLength := d.FieldU8("length")
+				d.LenFn(int64(extensionLength)*8, func(d *decode.D) {
+					ltwFlag := d.FieldBool("ltw_flag")
+					piecewiseRateFlag := d.FieldBool("piecewise_rate_flag")
+					seamlessSpliceFlag := d.FieldBool("seamless_splice_flag")
+					d.FieldU5("reserved")
+					if ltwFlag {
+						d.FieldBool("ltw_valid_flag")
+						d.FieldU15("ltw_offset")
+					}
+					if piecewiseRateFlag {
+						d.FieldU2("reserved0")
+						d.FieldU22("piecewise_rate")
+					}
+					if seamlessSpliceFlag {
+						d.FieldU4("splice_type")
+						d.FieldUFn("dts_next_au", decodeTimestamp33)
+					}
+					if d.NotEnd() {
+						d.FieldRawLen("reserved1", d.BitsLeft())
+					}
+				})
+			})
+		}
+		if d.NotEnd() {
+			d.FieldRawLen("stuffing", d.BitsLeft())
+		}
+	})
+
+	return discontinuity
+}
+
+func tsPacketDecode(d *decode.D, in interface{}) interface{} {
+	var p tsPacket
+
+	d.LenFn(tsPacketLength*8, func(d *decode.D) {
+		d.FieldU8("sync", d.AssertU(tsSyncByte), scalar.Hex)
+		d.FieldBool("transport_error_indicator")
+		p.payloadUnitStart = d.FieldBool("payload_unit_start")
+		d.FieldBool("transport_priority")
+		p.pid = int(d.FieldU13("pid", tsPIDNames, scalar.Hex))
+		p.scrambled = d.FieldU2("transport_scrambling_control", tsScramblingControlNames) != 0
+		adaptationFieldControl := d.FieldU2("adaptation_field_control", tsAdaptationFieldControlNames)
+		p.continuityCounter = int(d.FieldU4("continuity_counter"))
+
+		if adaptationFieldControl&tsAdaptationFieldOnly != 0 {
+			d.FieldStruct("adaptation_field", func(d *decode.D) {
+				p.discontinuity = tsDecodeAdaptationField(d)
+			})
+		}
+		if adaptationFieldControl&tsAdaptationFieldPayload != 0 {
+			p.hasPayload = true
+			if d.NotEnd() {
+				bs, err := d.FieldRawLen("payload", d.BitsLeft()).Bytes()
+				if err != nil {
+					d.IOPanic(err, "payload")
+				}
+				p.payload = bs
+			}
+		} else if d.NotEnd() {
+			d.FieldRawLen("stuffing", d.BitsLeft())
+		}
+	})
+
+	return p
+}
@@ -0,0 +1,219 @@
+package nes
+
+// https://www.nesdev.org/wiki/INES
+// https://www.nesdev.org/wiki/NES_2.0
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.NES,
+		Description: "iNES/NES 2.0 ROM image",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte(headerMagic)}},
+		DecodeFn:    nesDecode,
+	})
+}
+
+const headerMagic = "NES\x1a"
+
+const (
+	trainerBytes = 512
+	prgBankBytes = 16 * 1024
+	chrBankBytes = 8 * 1024
+)
+
+const (
+	consoleTypeNES          = 0
+	consoleTypeVsSystem     = 1
+	consoleTypePlayChoice10 = 2
+	consoleTypeExtended     = 3
+)
+
+var consoleTypeNames = scalar.UToSymStr{
+	consoleTypeNES:          "nes",
+	consoleTypeVsSystem:     "vs_system",
+	consoleTypePlayChoice10: "playchoice_10",
+	consoleTypeExtended:     "extended",
+}
+
+var mirroringNames = scalar.UToSymStr{
+	0: "horizontal",
+	1: "vertical",
+}
+
+var timingNames = scalar.UToSymStr{
+	0: "ntsc",
+	1: "pal",
+	2: "multiple_region",
+	3: "dendy",
+}
+
+var tvSystemNames = scalar.UToSymStr{
+	0: "ntsc",
+	1: "pal",
+}
+
+var extendedConsoleTypeNames = scalar.UToSymStr{
+	0x0: "nes",
+	0x1: "vs_system",
+	0x2: "playchoice_10",
+	0x3: "famiclone_decimal_mode",
+	0x4: "nes_epsm",
+	0x5: "vt01",
+	0x6: "vt02",
+	0x7: "vt03",
+	0x8: "vt09",
+	0x9: "vt32",
+	0xa: "vt369",
+	0xb: "umc_um6578",
+	0xc: "famicom_network_system",
+}
+
+var vsPPUTypeNames = scalar.UToSymStr{
+	0x0: "rp2c03b",
+	0x1: "rp2c03g",
+	0x2: "rp2c04_0001",
+	0x3: "rp2c04_0002",
+	0x4: "rp2c04_0003",
+	0x5: "rp2c04_0004",
+	0x6: "rc2c03b",
+	0x7: "rc2c03c",
+	0x8: "rc2c05_01",
+	0x9: "rc2c05_02",
+	0xa: "rc2c05_03",
+	0xb: "rc2c05_04",
+	0xc: "rc2c05_05",
+}
+
+var vsHardwareTypeNames = scalar.UToSymStr{
+	0x0: "unisystem",
+	0x1: "unisystem_rbi_baseball",
+	0x2: "unisystem_tko_boxing",
+	0x3: "unisystem_super_xevious",
+	0x4: "unisystem_vs_ice_climber_japan",
+	0x5: "dual_system",
+	0x6: "dual_system_raid_on_bungeling_bay",
+}
+
+// rom size from lsb byte and msb nibble, msb 0xf means lsb is in exponent-multiplier notation
+func nes2ROMSize(lsb uint64, msb uint64, unitBytes uint64) uint64 {
+	if msb == 0xf {
+		exponent := lsb >> 2
+		multiplier := lsb&0b11*2 + 1
+		return (1 << exponent) * multiplier
+	}
+	return (msb<<8 | lsb) * unitBytes
+}
+
+// ram size from shift count, zero means no ram
+func nes2RAMSize(shift uint64) uint64 {
+	if shift == 0 {
+		return 0
+	}
+	return 64 << shift
+}
+
+func fieldBanks(d *decode.D, name string, size uint64, bankBytes uint64) {
+	d.FieldArray(name, func(d *decode.D) {
+		for size > 0 {
+			n := bankBytes
+			if size < n {
+				n = size
+			}
+			d.FieldRawLen("bank", int64(n)*8)
+			size -= n
+		}
+	})
+}
+
+func nesDecode(d *decode.D, in interface{}) interface{} {
+	var prgROMSize uint64
+	var chrROMSize uint64
+	var hasTrainer bool
+	var consoleType uint64
+
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldUTF8("magic", 4, d.AssertStr(headerMagic))
+		prgROMSizeLSB := d.FieldU8("prg_rom_size_lsb")
+		chrROMSizeLSB := d.FieldU8("chr_rom_size_lsb")
+		mapperLow := d.FieldU4("mapper_low")
+		d.FieldBool("four_screen")
+		hasTrainer = d.FieldBool("trainer")
+		d.FieldBool("battery")
+		d.FieldU1("mirroring", mirroringNames)
+		mapperMiddle := d.FieldU4("mapper_middle")
+		nes2 := d.FieldU2("nes2_identifier", scalar.UToSymStr{2: "nes2"}) == 2
+		consoleType = d.FieldU2("console_type", consoleTypeNames)
+
+		mapper := mapperMiddle<<4 | mapperLow
+		if nes2 {
+			d.FieldU4("submapper")
+			mapperHigh := d.FieldU4("mapper_high")
+			chrROMSizeMSB := d.FieldU4("chr_rom_size_msb")
+			prgROMSizeMSB := d.FieldU4("prg_rom_size_msb")
+			prgNVRAMShift := d.FieldU4("prg_nvram_shift")
+			prgRAMShift := d.FieldU4("prg_ram_shift")
+			chrNVRAMShift := d.FieldU4("chr_nvram_shift")
+			chrRAMShift := d.FieldU4("chr_ram_shift")
+			d.FieldU6("unused0")
+			d.FieldU2("timing", timingNames)
+			switch consoleType {
+			case consoleTypeVsSystem:
+				d.FieldU4("vs_hardware_type", vsHardwareTypeNames)
+				d.FieldU4("vs_ppu_type", vsPPUTypeNames)
+			case consoleTypeExtended:
+				d.FieldU4("unused1")
+				d.FieldU4("extended_console_type", extendedConsoleTypeNames)
+			default:
+				d.FieldU8("unused1")
+			}
+			d.FieldU6("unused2")
+			d.FieldU2("misc_roms")
+			d.FieldU2("unused3")
+			d.FieldU6("default_expansion_device")
+
+			mapper |= mapperHigh << 8
+			prgROMSize = nes2ROMSize(prgROMSizeLSB, prgROMSizeMSB, prgBankBytes)
+			chrROMSize = nes2ROMSize(chrROMSizeLSB, chrROMSizeMSB, chrBankBytes)
+			d.FieldValueU("mapper", mapper)
+			d.FieldValueU("prg_rom_size", prgROMSize)
+			d.FieldValueU("chr_rom_size", chrROMSize)
+			d.FieldValueU("prg_ram_size", nes2RAMSize(prgRAMShift))
+			d.FieldValueU("prg_nvram_size", nes2RAMSize(prgNVRAMShift))
+			d.FieldValueU("chr_ram_size", nes2RAMSize(chrRAMShift))
+			d.FieldValueU("chr_nvram_size", nes2RAMSize(chrNVRAMShift))
+		} else {
+			// in 8KB units, zero means 8KB for compatibility
+			d.FieldU8("prg_ram_size")
+			d.FieldU7("unused0")
+			d.FieldU1("tv_system", tvSystemNames)
+			// unofficial and rarely used
+			d.FieldU8("flags10")
+			d.FieldRawLen("padding", 5*8)
+
+			prgROMSize = prgROMSizeLSB * prgBankBytes
+			chrROMSize = chrROMSizeLSB * chrBankBytes
+			d.FieldValueU("mapper", mapper)
+			d.FieldValueU("prg_rom_size", prgROMSize)
+			d.FieldValueU("chr_rom_size", chrROMSize)
+		}
+	})
+
+	if hasTrainer {
+		d.FieldRawLen("trainer", trainerBytes*8)
+	}
+	fieldBanks(d, "prg_rom", prgROMSize, prgBankBytes)
+	fieldBanks(d, "chr_rom", chrROMSize, chrBankBytes)
+	if d.BitsLeft() > 0 {
+		// playchoice 10 INST-ROM and PROM or other misc roms
+		d.FieldRawLen("misc_rom", d.BitsLeft())
+	}
+
+	return nil
+}
@@ -51,7 +51,7 @@ const (
 
 type stream struct {
 	sequenceNo     uint32
-	packetBuf      []byte
+	packetBufs     []bitio.BitReadAtSeeker
 	packetD        *decode.D
 	codec          streamCodec
 	flacStreamInfo format.FlacStreamInfo
@@ -102,10 +102,18 @@ func decodeOgg(d *decode.D, in interface{}) interface{} {
 			// 	// log.Println("page gap")
 			// }
 
-			for _, bs := range oggPageOut.Segments {
-				s.packetBuf = append(s.packetBuf, bs...)
-				if len(bs) < 255 {
-					bb := bitio.NewBufferFromBytes(s.packetBuf, -1)
+			for _, sbb := range oggPageOut.Segments {
+				s.packetBufs = append(s.packetBufs, sbb)
+				if sbb.Len() < 255*8 {
+					// packet is reassembled from segments, possibly spanning pages
+					mbr, err := bitio.NewMultiBitReader(s.packetBufs)
+					if err != nil {
+						d.IOPanic(err, "NewMultiBitReader")
+					}
+					bb, err := bitio.NewBufferFromBitReadSeeker(mbr)
+					if err != nil {
+						d.IOPanic(err, "NewBufferFromBitReadSeeker")
+					}
 
 					if s.codec == codecUnknown {
 						if b, err := bb.PeekBytes(len(vorbisIdentification)); err == nil && bytes.Equal(b, vorbisIdentification) {
@@ -161,7 +169,7 @@ func decodeOgg(d *decode.D, in interface{}) interface{} {
 						s.packetD.FieldRootBitBuf("packet", bb)
 					}
 
-					s.packetBuf = nil
+					s.packetBufs = nil
 				}
 			}
 
@@ -43,11 +43,7 @@ func pageDecode(d *decode.D, in interface{}) interface{} {
 	})
 	d.FieldArray("segments", func(d *decode.D) {
 		for _, ss := range segmentTable {
-			bs, err := d.FieldRawLen("segment", int64(ss)*8).Bytes()
-			if err != nil {
-				d.IOPanic(err, "d.BitBufRange segment")
-			}
-			p.Segments = append(p.Segments, bs)
+			p.Segments = append(p.Segments, d.FieldRawLen("segment", int64(ss)*8))
 		}
 	})
 	endPos := d.Pos()
@@ -57,7 +53,7 @@ func pageDecode(d *decode.D, in interface{}) interface{} {
 	d.MustCopy(pageCRC, d.BitBufRange(startPos, pageChecksumValue.Range.Start-startPos))                      // header before checksum
 	d.MustCopy(pageCRC, bytes.NewReader([]byte{0, 0, 0, 0}))                                                  // zero checksum bits
 	d.MustCopy(pageCRC, d.BitBufRange(pageChecksumValue.Range.Stop(), endPos-pageChecksumValue.Range.Stop())) // rest of page
-	_ = pageChecksumValue.TryScalarFn(d.ValidateUBytes(pageCRC.Sum(nil)))
+	d.ValueChecksumU(pageChecksumValue, "crc32", pageCRC.Sum64())
 
 	return p
 }
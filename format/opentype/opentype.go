@@ -0,0 +1,243 @@
+package opentype
+
+// https://docs.microsoft.com/en-us/typography/opentype/spec/otff
+// https://developer.apple.com/fonts/TrueType-Reference-Manual/
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.OPENTYPE,
+		Description: "OpenType/TrueType font",
+		Groups:      []string{format.PROBE},
+		Magic: []decode.Magic{
+			{Bytes: []byte{0x00, 0x01, 0x00, 0x00}},
+			{Bytes: []byte("OTTO")},
+			{Bytes: []byte("true")},
+		},
+		DecodeFn: opentypeDecode,
+	})
+}
+
+const (
+	sfntVersionTrueType = 0x00010000
+	sfntVersionCFF      = 0x4f54544f // "OTTO"
+	sfntVersionApple    = 0x74727565 // "true"
+)
+
+var sfntVersionNames = scalar.UToSymStr{
+	sfntVersionTrueType: "truetype",
+	sfntVersionCFF:      "cff",
+	sfntVersionApple:    "truetype_apple",
+}
+
+const (
+	tableRecordLen = 16
+	headerLen      = 12
+)
+
+var tagNames = scalar.StrToScalar{
+	"BASE": {Description: "Baseline data"},
+	"CBDT": {Description: "Color bitmap data"},
+	"CBLC": {Description: "Color bitmap location data"},
+	"CFF ": {Description: "Compact font format"},
+	"CFF2": {Description: "Compact font format 2"},
+	"COLR": {Description: "Color table"},
+	"CPAL": {Description: "Color palette table"},
+	"DSIG": {Description: "Digital signature"},
+	"EBDT": {Description: "Embedded bitmap data"},
+	"EBLC": {Description: "Embedded bitmap location data"},
+	"GDEF": {Description: "Glyph definition data"},
+	"GPOS": {Description: "Glyph positioning data"},
+	"GSUB": {Description: "Glyph substitution data"},
+	"HVAR": {Description: "Horizontal metrics variations"},
+	"JSTF": {Description: "Justification data"},
+	"LTSH": {Description: "Linear threshold data"},
+	"MATH": {Description: "Math layout data"},
+	"MVAR": {Description: "Metrics variations"},
+	"OS/2": {Description: "OS/2 and Windows specific metrics"},
+	"STAT": {Description: "Style attributes"},
+	"SVG ": {Description: "SVG glyph descriptions"},
+	"VDMX": {Description: "Vertical device metrics"},
+	"avar": {Description: "Axis variations"},
+	"cmap": {Description: "Character to glyph index mapping"},
+	"cvt ": {Description: "Control value table"},
+	"fpgm": {Description: "Font program"},
+	"fvar": {Description: "Font variations"},
+	"gasp": {Description: "Grid-fitting/scan-conversion"},
+	"glyf": {Description: "Glyph data"},
+	"gvar": {Description: "Glyph variations"},
+	"hdmx": {Description: "Horizontal device metrics"},
+	"head": {Description: "Font header"},
+	"hhea": {Description: "Horizontal header"},
+	"hmtx": {Description: "Horizontal metrics"},
+	"kern": {Description: "Kerning"},
+	"loca": {Description: "Index to location"},
+	"maxp": {Description: "Maximum profile"},
+	"meta": {Description: "Metadata"},
+	"name": {Description: "Naming table"},
+	"post": {Description: "PostScript information"},
+	"prep": {Description: "Control value program"},
+	"sbix": {Description: "Standard bitmap graphics"},
+	"vhea": {Description: "Vertical metrics header"},
+	"vmtx": {Description: "Vertical metrics"},
+}
+
+type tableRecord struct {
+	tag    string
+	offset int64
+	length int64
+}
+
+// font has values from other tables needed to decode some tables
+type font struct {
+	tables map[string]tableRecord
+	// from head
+	indexToLocFormat int64
+	// from maxp
+	numGlyphs int64
+	// from hhea
+	numberOfHMetrics int64
+	// glyph byte offsets into glyf from loca, numGlyphs+1 entries
+	glyphOffsets []int64
+}
+
+// peekTableU16 reads an u16 at byte offset into table if it exists
+func (f *font) peekTableU16(d *decode.D, tag string, offset int64) (uint64, bool) {
+	t, ok := f.tables[tag]
+	if !ok || offset+2 > t.length {
+		return 0, false
+	}
+	return uint64(binary.BigEndian.Uint16(d.BytesRange((t.offset+offset)*8, 2))), true
+}
+
+// scan reads values used by other tables before decoding as table order is by tag
+func (f *font) scan(d *decode.D) {
+	if v, ok := f.peekTableU16(d, "head", 50); ok {
+		f.indexToLocFormat = int64(int16(v))
+	}
+	if v, ok := f.peekTableU16(d, "maxp", 4); ok {
+		f.numGlyphs = int64(v)
+	}
+	if v, ok := f.peekTableU16(d, "hhea", 34); ok {
+		f.numberOfHMetrics = int64(v)
+	}
+
+	loca, ok := f.tables["loca"]
+	if !ok {
+		return
+	}
+	entryLen := int64(2)
+	if f.indexToLocFormat == indexToLocFormatLong {
+		entryLen = 4
+	}
+	n := f.numGlyphs + 1
+	if n*entryLen > loca.length {
+		return
+	}
+	b := d.BytesRange(loca.offset*8, int(n*entryLen))
+	for i := int64(0); i < n; i++ {
+		if entryLen == 2 {
+			// short offsets are stored divided by 2
+			f.glyphOffsets = append(f.glyphOffsets, int64(binary.BigEndian.Uint16(b[i*2:]))*2)
+		} else {
+			f.glyphOffsets = append(f.glyphOffsets, int64(binary.BigEndian.Uint32(b[i*4:])))
+		}
+	}
+}
+
+var tableDecoders = map[string]func(d *decode.D, f *font, t tableRecord){
+	"OS/2": decodeOS2,
+	"cmap": decodeCmap,
+	"glyf": decodeGlyf,
+	"head": decodeHead,
+	"hhea": decodeHhea,
+	"hmtx": decodeHmtx,
+	"loca": decodeLoca,
+	"maxp": decodeMaxp,
+	"name": decodeName,
+	"post": decodePost,
+}
+
+func opentypeDecode(d *decode.D, in interface{}) interface{} {
+	d.FieldU32("sfnt_version", sfntVersionNames, scalar.Hex)
+	numTables := d.FieldU16("num_tables")
+	if numTables == 0 {
+		d.Fatalf("no tables")
+	}
+	d.FieldU16("search_range")
+	d.FieldU16("entry_selector")
+	d.FieldU16("range_shift")
+
+	f := &font{tables: map[string]tableRecord{}}
+	var records []tableRecord
+	b := d.BytesRange(headerLen*8, int(numTables)*tableRecordLen)
+	for i := 0; i < int(numTables); i++ {
+		rb := b[i*tableRecordLen:]
+		t := tableRecord{
+			tag:    string(rb[0:4]),
+			offset: int64(binary.BigEndian.Uint32(rb[8:])),
+			length: int64(binary.BigEndian.Uint32(rb[12:])),
+		}
+		if (t.offset+t.length)*8 > d.Len() {
+			d.Fatalf("table %q outside file", t.tag)
+		}
+		f.tables[t.tag] = t
+		records = append(records, t)
+	}
+	if _, ok := f.tables["head"]; !ok {
+		d.Fatalf("no head table")
+	}
+	f.scan(d)
+
+	d.FieldArray("table_records", func(d *decode.D) {
+		for range records {
+			d.FieldStruct("table_record", func(d *decode.D) {
+				d.FieldUTF8("tag", 4, tagNames)
+				d.FieldU32("checksum", scalar.Hex)
+				d.FieldU32("offset")
+				d.FieldU32("length")
+			})
+		}
+	})
+
+	// tables in file order
+	sort.SliceStable(records, func(i, j int) bool { return records[i].offset < records[j].offset })
+	d.FieldArray("tables", func(d *decode.D) {
+		for _, t := range records {
+			d.FieldStruct("table", func(d *decode.D) {
+				d.SeekAbs(t.offset * 8)
+				d.FieldValueStr("tag", t.tag, tagNames)
+				d.RangeFn(t.offset*8, t.length*8, func(d *decode.D) {
+					if fn, ok := tableDecoders[t.tag]; ok {
+						fn(d, f, t)
+					} else {
+						d.FieldRawLen("data", d.BitsLeft())
+					}
+				})
+
+				// tables are 4 byte aligned, padding is not included in length
+				paddingStart := t.offset + t.length
+				paddingBytes := (4 - paddingStart%4) % 4
+				if paddingStart+paddingBytes > d.Len()/8 {
+					paddingBytes = d.Len()/8 - paddingStart
+				}
+				if paddingBytes > 0 {
+					d.RangeFn(paddingStart*8, paddingBytes*8, func(d *decode.D) {
+						d.FieldRawLen("padding", d.BitsLeft())
+					})
+				}
+			})
+		}
+	})
+
+	return nil
+}
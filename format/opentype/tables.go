@@ -0,0 +1,577 @@
+package opentype
+
+import (
+	"time"
+	"unicode/utf8"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+// 16.16 signed fixed point
+var fixedMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	s.Sym = float64(s.ActualS()) / 0x10000
+	return s, nil
+})
+
+// LONGDATETIME seconds since 1904-01-01 UTC
+var longDateTimeEpochDate = time.Date(1904, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+var longDateTimeMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	s.Description = longDateTimeEpochDate.Add(time.Second * time.Duration(s.ActualS())).Format(time.RFC3339)
+	return s, nil
+})
+
+const headMagicNumber = 0x5f0f3cf5
+
+const (
+	indexToLocFormatShort = 0
+	indexToLocFormatLong  = 1
+)
+
+var indexToLocFormatNames = scalar.SToSymStr{
+	indexToLocFormatShort: "short",
+	indexToLocFormatLong:  "long",
+}
+
+func decodeHead(d *decode.D, f *font, t tableRecord) {
+	d.FieldU16("major_version")
+	d.FieldU16("minor_version")
+	d.FieldS32("font_revision", fixedMap)
+	d.FieldU32("checksum_adjustment", scalar.Hex)
+	d.FieldU32("magic_number", d.AssertU(headMagicNumber), scalar.Hex)
+	d.FieldStruct("flags", func(d *decode.D) {
+		d.FieldU1("unused")
+		d.FieldBool("last_resort_font")
+		d.FieldBool("cleartype_optimized")
+		d.FieldBool("converted")
+		d.FieldBool("lossless")
+		d.FieldU6("reserved")
+		d.FieldBool("instructions_alter_advance_width")
+		d.FieldBool("instructions_depend_on_point_size")
+		d.FieldBool("integer_ppem")
+		d.FieldBool("left_sidebearing_at_x0")
+		d.FieldBool("baseline_at_y0")
+	})
+	d.FieldU16("units_per_em")
+	d.FieldS64("created", longDateTimeMap)
+	d.FieldS64("modified", longDateTimeMap)
+	d.FieldS16("x_min")
+	d.FieldS16("y_min")
+	d.FieldS16("x_max")
+	d.FieldS16("y_max")
+	d.FieldStruct("mac_style", func(d *decode.D) {
+		d.FieldU9("reserved")
+		d.FieldBool("extended")
+		d.FieldBool("condensed")
+		d.FieldBool("shadow")
+		d.FieldBool("outline")
+		d.FieldBool("underline")
+		d.FieldBool("italic")
+		d.FieldBool("bold")
+	})
+	d.FieldU16("lowest_rec_ppem")
+	d.FieldS16("font_direction_hint")
+	d.FieldS16("index_to_loc_format", indexToLocFormatNames)
+	d.FieldS16("glyph_data_format")
+}
+
+func decodeMaxp(d *decode.D, f *font, t tableRecord) {
+	version := d.FieldU32("version", scalar.Hex)
+	d.FieldU16("num_glyphs")
+	// version 0.5 is used by CFF fonts and only has number of glyphs
+	if version < 0x00010000 {
+		return
+	}
+	d.FieldU16("max_points")
+	d.FieldU16("max_contours")
+	d.FieldU16("max_composite_points")
+	d.FieldU16("max_composite_contours")
+	d.FieldU16("max_zones")
+	d.FieldU16("max_twilight_points")
+	d.FieldU16("max_storage")
+	d.FieldU16("max_function_defs")
+	d.FieldU16("max_instruction_defs")
+	d.FieldU16("max_stack_elements")
+	d.FieldU16("max_size_of_instructions")
+	d.FieldU16("max_component_elements")
+	d.FieldU16("max_component_depth")
+}
+
+func decodeHhea(d *decode.D, f *font, t tableRecord) {
+	d.FieldU16("major_version")
+	d.FieldU16("minor_version")
+	d.FieldS16("ascender")
+	d.FieldS16("descender")
+	d.FieldS16("line_gap")
+	d.FieldU16("advance_width_max")
+	d.FieldS16("min_left_side_bearing")
+	d.FieldS16("min_right_side_bearing")
+	d.FieldS16("x_max_extent")
+	d.FieldS16("caret_slope_rise")
+	d.FieldS16("caret_slope_run")
+	d.FieldS16("caret_offset")
+	d.FieldRawLen("reserved", 4*16)
+	d.FieldS16("metric_data_format")
+	d.FieldU16("number_of_hmetrics")
+}
+
+func decodeHmtx(d *decode.D, f *font, t tableRecord) {
+	d.FieldArray("h_metrics", func(d *decode.D) {
+		for i := int64(0); i < f.numberOfHMetrics && d.NotEnd(); i++ {
+			d.FieldStruct("h_metric", func(d *decode.D) {
+				d.FieldU16("advance_width")
+				d.FieldS16("lsb")
+			})
+		}
+	})
+	// rest of glyphs use last advance width
+	d.FieldArray("left_side_bearings", func(d *decode.D) {
+		for i := f.numberOfHMetrics; i < f.numGlyphs && d.NotEnd(); i++ {
+			d.FieldS16("left_side_bearing")
+		}
+	})
+}
+
+func decodeLoca(d *decode.D, f *font, t tableRecord) {
+	d.FieldArray("offsets", func(d *decode.D) {
+		for i := int64(0); i < f.numGlyphs+1 && d.NotEnd(); i++ {
+			if f.indexToLocFormat == indexToLocFormatLong {
+				d.FieldU32("offset")
+			} else {
+				d.FieldU16("offset", scalar.Fn(func(s scalar.S) (scalar.S, error) {
+					s.Sym = s.ActualU() * 2
+					return s, nil
+				}))
+			}
+		}
+	})
+}
+
+var glyphFlagNames = []string{
+	"overlap_simple",
+	"y_is_same_or_positive",
+	"x_is_same_or_positive",
+	"repeat",
+	"y_short_vector",
+	"x_short_vector",
+	"on_curve_point",
+}
+
+const (
+	componentArgsAreWords       = 0x0001
+	componentWeHaveAScale       = 0x0008
+	componentMoreComponents     = 0x0020
+	componentWeHaveAnXAndYScale = 0x0040
+	componentWeHaveATwoByTwo    = 0x0080
+	componentWeHaveInstructions = 0x0100
+)
+
+func decodeSimpleGlyph(d *decode.D, numberOfContours int64) {
+	var numPoints uint64
+	d.FieldArray("end_pts_of_contours", func(d *decode.D) {
+		for i := int64(0); i < numberOfContours; i++ {
+			numPoints = d.FieldU16("end_pt") + 1
+		}
+	})
+	instructionLength := d.FieldU16("instruction_length")
+	d.FieldRawLen("instructions", int64(instructionLength)*8)
+
+	// flags are run length encoded and decides size of coordinates
+	var xLen, yLen int64
+	d.FieldArray("flags", func(d *decode.D) {
+		for n := uint64(0); n < numPoints; {
+			var flags uint64
+			d.FieldStruct("flag", func(d *decode.D) {
+				flags = d.PeekBits(8)
+				d.FieldU1("reserved")
+				for _, name := range glyphFlagNames {
+					d.FieldBool(name)
+				}
+			})
+			repeat := uint64(1)
+			if flags&0x08 != 0 {
+				repeat += d.FieldU8("repeat_count")
+			}
+			for i := uint64(0); i < repeat; i++ {
+				switch {
+				case flags&0x02 != 0:
+					xLen++
+				case flags&0x10 == 0:
+					xLen += 2
+				}
+				switch {
+				case flags&0x04 != 0:
+					yLen++
+				case flags&0x20 == 0:
+					yLen += 2
+				}
+			}
+			n += repeat
+		}
+	})
+	d.FieldRawLen("x_coordinates", xLen*8)
+	d.FieldRawLen("y_coordinates", yLen*8)
+}
+
+func decodeCompositeGlyph(d *decode.D) {
+	var flags uint64
+	d.FieldArray("components", func(d *decode.D) {
+		for more := true; more; more = flags&componentMoreComponents != 0 {
+			d.FieldStruct("component", func(d *decode.D) {
+				flags = d.FieldU16("flags", scalar.Hex)
+				d.FieldU16("glyph_index")
+				if flags&componentArgsAreWords != 0 {
+					d.FieldS16("argument1")
+					d.FieldS16("argument2")
+				} else {
+					d.FieldS8("argument1")
+					d.FieldS8("argument2")
+				}
+				// F2DOT14 values
+				switch {
+				case flags&componentWeHaveAScale != 0:
+					d.FieldS16("scale")
+				case flags&componentWeHaveAnXAndYScale != 0:
+					d.FieldS16("x_scale")
+					d.FieldS16("y_scale")
+				case flags&componentWeHaveATwoByTwo != 0:
+					d.FieldS16("x_scale")
+					d.FieldS16("scale01")
+					d.FieldS16("scale10")
+					d.FieldS16("y_scale")
+				}
+			})
+		}
+	})
+	if flags&componentWeHaveInstructions != 0 {
+		instructionLength := d.FieldU16("instruction_length")
+		d.FieldRawLen("instructions", int64(instructionLength)*8)
+	}
+}
+
+func decodeGlyf(d *decode.D, f *font, t tableRecord) {
+	if len(f.glyphOffsets) == 0 {
+		d.FieldRawLen("data", d.BitsLeft())
+		return
+	}
+
+	d.FieldArray("glyphs", func(d *decode.D) {
+		for i := 0; i < len(f.glyphOffsets)-1; i++ {
+			start, end := f.glyphOffsets[i], f.glyphOffsets[i+1]
+			if end < start || end > t.length {
+				d.Fatalf("glyph %d outside glyf table", i)
+			}
+			d.FieldStruct("glyph", func(d *decode.D) {
+				d.FieldValueU("glyph_id", uint64(i))
+				// empty glyph, ex space
+				if start == end {
+					return
+				}
+				d.RangeFn((t.offset+start)*8, (end-start)*8, func(d *decode.D) {
+					numberOfContours := d.FieldS16("number_of_contours")
+					d.FieldS16("x_min")
+					d.FieldS16("y_min")
+					d.FieldS16("x_max")
+					d.FieldS16("y_max")
+					if numberOfContours >= 0 {
+						decodeSimpleGlyph(d, numberOfContours)
+					} else {
+						decodeCompositeGlyph(d)
+					}
+					// glyphs are usually padded to 2 or 4 bytes
+					if d.NotEnd() {
+						d.FieldRawLen("padding", d.BitsLeft())
+					}
+				})
+			})
+		}
+	})
+}
+
+const (
+	platformUnicode   = 0
+	platformMacintosh = 1
+	platformISO       = 2
+	platformWindows   = 3
+	platformCustom    = 4
+)
+
+var platformNames = scalar.UToSymStr{
+	platformUnicode:   "unicode",
+	platformMacintosh: "macintosh",
+	platformISO:       "iso",
+	platformWindows:   "windows",
+	platformCustom:    "custom",
+}
+
+var nameIDNames = scalar.UToSymStr{
+	0:  "copyright",
+	1:  "font_family",
+	2:  "font_subfamily",
+	3:  "unique_id",
+	4:  "full_name",
+	5:  "version",
+	6:  "postscript_name",
+	7:  "trademark",
+	8:  "manufacturer",
+	9:  "designer",
+	10: "description",
+	11: "vendor_url",
+	12: "designer_url",
+	13: "license",
+	14: "license_url",
+	16: "typographic_family",
+	17: "typographic_subfamily",
+	18: "compatible_full",
+	19: "sample_text",
+	20: "postscript_cid_findfont_name",
+	21: "wws_family",
+	22: "wws_subfamily",
+	23: "light_background_palette",
+	24: "dark_background_palette",
+	25: "variations_postscript_name_prefix",
+}
+
+func decodeName(d *decode.D, f *font, t tableRecord) {
+	tableStart := d.Pos()
+	version := d.FieldU16("version")
+	count := d.FieldU16("count")
+	storageOffset := d.FieldU16("storage_offset")
+	storageStart := tableStart + int64(storageOffset)*8
+
+	fieldString := func(d *decode.D, platformID uint64, length uint64, offset uint64) {
+		d.RangeFn(storageStart+int64(offset)*8, int64(length)*8, func(d *decode.D) {
+			switch {
+			case platformID == platformUnicode || platformID == platformWindows:
+				d.FieldUTF16BE("value", int(length))
+			case utf8.Valid(d.PeekBytes(int(length))):
+				d.FieldUTF8("value", int(length))
+			default:
+				d.FieldRawLen("value", int64(length)*8)
+			}
+		})
+	}
+
+	d.FieldArray("name_records", func(d *decode.D) {
+		for i := uint64(0); i < count; i++ {
+			d.FieldStruct("name_record", func(d *decode.D) {
+				platformID := d.FieldU16("platform_id", platformNames)
+				d.FieldU16("encoding_id")
+				d.FieldU16("language_id", scalar.Hex)
+				d.FieldU16("name_id", nameIDNames)
+				length := d.FieldU16("length")
+				offset := d.FieldU16("offset")
+				fieldString(d, platformID, length, offset)
+			})
+		}
+	})
+	if version >= 1 {
+		langTagCount := d.FieldU16("lang_tag_count")
+		d.FieldArray("lang_tag_records", func(d *decode.D) {
+			for i := uint64(0); i < langTagCount; i++ {
+				d.FieldStruct("lang_tag_record", func(d *decode.D) {
+					length := d.FieldU16("length")
+					offset := d.FieldU16("offset")
+					// language tags are always UTF-16BE
+					fieldString(d, platformUnicode, length, offset)
+				})
+			}
+		})
+	}
+}
+
+func decodeCmapSubtable(d *decode.D) {
+	format := d.FieldU16("format")
+	switch format {
+	case 0:
+		d.FieldU16("length")
+		d.FieldU16("language")
+		d.FieldArray("glyph_ids", func(d *decode.D) {
+			for i := 0; i < 256; i++ {
+				d.FieldU8("glyph_id")
+			}
+		})
+	case 4:
+		length := d.FieldU16("length")
+		d.FieldU16("language")
+		segCountX2 := d.FieldU16("seg_count_x2")
+		d.FieldU16("search_range")
+		d.FieldU16("entry_selector")
+		d.FieldU16("range_shift")
+		segCount := segCountX2 / 2
+		fieldU16s := func(name string, elemName string) {
+			d.FieldArray(name, func(d *decode.D) {
+				for i := uint64(0); i < segCount; i++ {
+					d.FieldU16(elemName)
+				}
+			})
+		}
+		fieldU16s("end_codes", "end_code")
+		d.FieldU16("reserved_pad")
+		fieldU16s("start_codes", "start_code")
+		d.FieldArray("id_deltas", func(d *decode.D) {
+			for i := uint64(0); i < segCount; i++ {
+				d.FieldS16("id_delta")
+			}
+		})
+		fieldU16s("id_range_offsets", "id_range_offset")
+		// 8 fixed u16 fields and 4 arrays of segCount u16 and reserved_pad
+		glyphIDsLen := int64(length) - 16 - 8*int64(segCount)
+		if glyphIDsLen > 0 {
+			d.FieldArray("glyph_ids", func(d *decode.D) {
+				for i := int64(0); i < glyphIDsLen/2; i++ {
+					d.FieldU16("glyph_id")
+				}
+			})
+		}
+	case 6:
+		d.FieldU16("length")
+		d.FieldU16("language")
+		d.FieldU16("first_code")
+		entryCount := d.FieldU16("entry_count")
+		d.FieldArray("glyph_ids", func(d *decode.D) {
+			for i := uint64(0); i < entryCount; i++ {
+				d.FieldU16("glyph_id")
+			}
+		})
+	case 12, 13:
+		d.FieldU16("reserved")
+		d.FieldU32("length")
+		d.FieldU32("language")
+		numGroups := d.FieldU32("num_groups")
+		d.FieldArray("groups", func(d *decode.D) {
+			for i := uint64(0); i < numGroups; i++ {
+				d.FieldStruct("group", func(d *decode.D) {
+					d.FieldU32("start_char_code")
+					d.FieldU32("end_char_code")
+					if format == 12 {
+						d.FieldU32("start_glyph_id")
+					} else {
+						d.FieldU32("glyph_id")
+					}
+				})
+			}
+		})
+	case 8, 10:
+		d.FieldU16("reserved")
+		length := d.FieldU32("length")
+		d.FieldRawLen("data", (int64(length)-8)*8)
+	case 14:
+		length := d.FieldU32("length")
+		d.FieldRawLen("data", (int64(length)-6)*8)
+	default:
+		length := d.FieldU16("length")
+		d.FieldRawLen("data", (int64(length)-4)*8)
+	}
+}
+
+func decodeCmap(d *decode.D, f *font, t tableRecord) {
+	tableStart := d.Pos()
+	d.FieldU16("version")
+	numTables := d.FieldU16("num_tables")
+	d.FieldArray("encoding_records", func(d *decode.D) {
+		for i := uint64(0); i < numTables; i++ {
+			d.FieldStruct("encoding_record", func(d *decode.D) {
+				d.FieldU16("platform_id", platformNames)
+				d.FieldU16("encoding_id")
+				offset := d.FieldU32("offset")
+				d.FieldStruct("subtable", func(d *decode.D) {
+					// subtable length is only known after reading format
+					d.RangeFn(tableStart+int64(offset)*8, t.length*8-int64(offset)*8, decodeCmapSubtable)
+				})
+			})
+		}
+	})
+}
+
+var weightClassNames = scalar.UToSymStr{
+	100: "thin",
+	200: "extra_light",
+	300: "light",
+	400: "normal",
+	500: "medium",
+	600: "semi_bold",
+	700: "bold",
+	800: "extra_bold",
+	900: "black",
+}
+
+var widthClassNames = scalar.UToSymStr{
+	1: "ultra_condensed",
+	2: "extra_condensed",
+	3: "condensed",
+	4: "semi_condensed",
+	5: "medium",
+	6: "semi_expanded",
+	7: "expanded",
+	8: "extra_expanded",
+	9: "ultra_expanded",
+}
+
+func decodeOS2(d *decode.D, f *font, t tableRecord) {
+	version := d.FieldU16("version")
+	d.FieldS16("x_avg_char_width")
+	d.FieldU16("us_weight_class", weightClassNames)
+	d.FieldU16("us_width_class", widthClassNames)
+	d.FieldU16("fs_type", scalar.Hex)
+	d.FieldS16("y_subscript_x_size")
+	d.FieldS16("y_subscript_y_size")
+	d.FieldS16("y_subscript_x_offset")
+	d.FieldS16("y_subscript_y_offset")
+	d.FieldS16("y_superscript_x_size")
+	d.FieldS16("y_superscript_y_size")
+	d.FieldS16("y_superscript_x_offset")
+	d.FieldS16("y_superscript_y_offset")
+	d.FieldS16("y_strikeout_size")
+	d.FieldS16("y_strikeout_position")
+	d.FieldS16("s_family_class")
+	d.FieldRawLen("panose", 10*8)
+	d.FieldU32("ul_unicode_range1", scalar.Hex)
+	d.FieldU32("ul_unicode_range2", scalar.Hex)
+	d.FieldU32("ul_unicode_range3", scalar.Hex)
+	d.FieldU32("ul_unicode_range4", scalar.Hex)
+	d.FieldUTF8("ach_vend_id", 4)
+	d.FieldU16("fs_selection", scalar.Hex)
+	d.FieldU16("us_first_char_index")
+	d.FieldU16("us_last_char_index")
+	d.FieldS16("s_typo_ascender")
+	d.FieldS16("s_typo_descender")
+	d.FieldS16("s_typo_line_gap")
+	d.FieldU16("us_win_ascent")
+	d.FieldU16("us_win_descent")
+	if version < 1 || !d.NotEnd() {
+		return
+	}
+	d.FieldU32("ul_code_page_range1", scalar.Hex)
+	d.FieldU32("ul_code_page_range2", scalar.Hex)
+	if version < 2 {
+		return
+	}
+	d.FieldS16("sx_height")
+	d.FieldS16("s_cap_height")
+	d.FieldU16("us_default_char")
+	d.FieldU16("us_break_char")
+	d.FieldU16("us_max_context")
+	if version < 5 {
+		return
+	}
+	d.FieldU16("us_lower_optical_point_size")
+	d.FieldU16("us_upper_optical_point_size")
+}
+
+func decodePost(d *decode.D, f *font, t tableRecord) {
+	d.FieldU32("version", scalar.Hex)
+	d.FieldS32("italic_angle", fixedMap)
+	d.FieldS16("underline_position")
+	d.FieldS16("underline_thickness")
+	d.FieldU32("is_fixed_pitch")
+	d.FieldU32("min_mem_type42")
+	d.FieldU32("max_mem_type42")
+	d.FieldU32("min_mem_type1")
+	d.FieldU32("max_mem_type1")
+	// version 2 glyph names etc
+	if d.NotEnd() {
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+}
@@ -0,0 +1,196 @@
+package openvpn
+
+// https://openvpn.net/community-resources/openvpn-protocol/
+// https://github.com/OpenVPN/openvpn/blob/master/doc/doxygen/doc_protocol_overview.h
+// https://github.com/wireshark/wireshark/blob/master/epan/dissectors/packet-openvpn.c
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.OPENVPN,
+		Description: "OpenVPN packet",
+		Groups: []string{
+			format.TCP_STREAM,
+			format.UDP_PAYLOAD,
+		},
+		DecodeFn: openvpnDecode,
+	})
+	registry.MustRegister(decode.Format{
+		Name:        format.OPENVPN_TCP,
+		Description: "OpenVPN packets (TCP)",
+		DecodeFn:    openvpnTCPDecode,
+	})
+}
+
+const (
+	opControlHardResetClientV1 = 1
+	opControlHardResetServerV1 = 2
+	opControlSoftResetV1       = 3
+	opControlV1                = 4
+	opAckV1                    = 5
+	opDataV1                   = 6
+	opControlHardResetClientV2 = 7
+	opControlHardResetServerV2 = 8
+	opDataV2                   = 9
+	opControlHardResetClientV3 = 10
+	opControlWKCV1             = 11
+)
+
+var opcodeNames = scalar.UToSymStr{
+	opControlHardResetClientV1: "P_CONTROL_HARD_RESET_CLIENT_V1",
+	opControlHardResetServerV1: "P_CONTROL_HARD_RESET_SERVER_V1",
+	opControlSoftResetV1:       "P_CONTROL_SOFT_RESET_V1",
+	opControlV1:                "P_CONTROL_V1",
+	opAckV1:                    "P_ACK_V1",
+	opDataV1:                   "P_DATA_V1",
+	opControlHardResetClientV2: "P_CONTROL_HARD_RESET_CLIENT_V2",
+	opControlHardResetServerV2: "P_CONTROL_HARD_RESET_SERVER_V2",
+	opDataV2:                   "P_DATA_V2",
+	opControlHardResetClientV3: "P_CONTROL_HARD_RESET_CLIENT_V3",
+	opControlWKCV1:             "P_CONTROL_WKC_V1",
+}
+
+// max number of acks in one packet, RELIABLE_ACK_SIZE
+const maxAcks = 8
+
+// tls-auth HMAC size depends on --auth digest which is not known, try
+// common sizes, sha1 (default), sha256, sha512, md5 and no tls-auth
+var tlsAuthHMACLens = []int64{20, 32, 64, 16, 0}
+
+// tls-auth packet id/net time pair size
+const tlsAuthReplayLen = 8
+
+// minimum net_time (2000-01-01) to treat tls-auth replay fields as plausible
+const minNetTime = 946684800
+
+// guess tls-auth HMAC length by checking if the ack array fits in the
+// packet and that net_time looks like a unix time
+func guessHMACLen(d *decode.D, opcode uint64) int64 {
+	start := d.Pos()
+	packetBytes := d.BitsLeft() / 8
+
+	for _, hmacLen := range tlsAuthHMACLens {
+		// session_id
+		n := int64(8)
+		if hmacLen > 0 {
+			n += hmacLen + tlsAuthReplayLen
+		}
+		if packetBytes < n+1 {
+			continue
+		}
+		if hmacLen > 0 {
+			netTime := d.BytesRange(start+(n-4)*8, 4)
+			t := uint64(netTime[0])<<24 | uint64(netTime[1])<<16 | uint64(netTime[2])<<8 | uint64(netTime[3])
+			if t < minNetTime {
+				continue
+			}
+		}
+		ackLen := int64(d.BytesRange(start+n*8, 1)[0])
+		if ackLen > maxAcks {
+			continue
+		}
+		need := n + 1 + ackLen*4
+		if ackLen > 0 {
+			need += 8
+		}
+		if opcode != opAckV1 {
+			need += 4
+		}
+		if need > packetBytes {
+			continue
+		}
+		return hmacLen
+	}
+
+	return 0
+}
+
+func decodePacket(d *decode.D) {
+	var opcode uint64
+	d.FieldStruct("opcode", func(d *decode.D) {
+		opcode = d.FieldU5("opcode", opcodeNames)
+		d.FieldU3("key_id")
+	})
+
+	switch opcode {
+	case opDataV1:
+		d.FieldRawLen("data", d.BitsLeft())
+	case opDataV2:
+		d.FieldU24("peer_id")
+		d.FieldRawLen("data", d.BitsLeft())
+	case opControlHardResetClientV1,
+		opControlHardResetServerV1,
+		opControlSoftResetV1,
+		opControlV1,
+		opAckV1,
+		opControlHardResetClientV2,
+		opControlHardResetServerV2,
+		opControlHardResetClientV3,
+		opControlWKCV1:
+
+		hmacLen := guessHMACLen(d, opcode)
+		d.FieldU64("session_id", scalar.Hex)
+		if hmacLen > 0 {
+			d.FieldStruct("tls_auth", func(d *decode.D) {
+				d.FieldRawLen("hmac", hmacLen*8)
+				d.FieldU32("packet_id")
+				d.FieldU32("net_time")
+			})
+		}
+		ackLen := d.FieldU8("message_packet_id_array_length")
+		d.FieldArray("message_packet_id_array", func(d *decode.D) {
+			for i := uint64(0); i < ackLen; i++ {
+				d.FieldU32("message_packet_id")
+			}
+		})
+		if ackLen > 0 {
+			d.FieldU64("remote_session_id", scalar.Hex)
+		}
+		if opcode != opAckV1 {
+			d.FieldU32("message_packet_id")
+		}
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("tls_payload", d.BitsLeft())
+		}
+	default:
+		d.Fatalf("unknown opcode %d", opcode)
+	}
+}
+
+// tcp stream packets are prefixed with a 16 bit length
+func decodeTCPPackets(d *decode.D) {
+	d.FieldStructArrayLoop("packets", "packet", d.NotEnd, func(d *decode.D) {
+		length := d.FieldU16("packet_length")
+		d.LenFn(int64(length)*8, decodePacket)
+	})
+}
+
+func openvpnTCPDecode(d *decode.D, in interface{}) interface{} {
+	decodeTCPPackets(d)
+	return nil
+}
+
+func openvpnDecode(d *decode.D, in interface{}) interface{} {
+	if tsi, ok := in.(format.TCPStreamIn); ok {
+		if tsi.DestinationPort == format.TCPPortOpenVPN || tsi.SourcePort == format.TCPPortOpenVPN {
+			decodeTCPPackets(d)
+			return nil
+		}
+		d.Fatalf("wrong port")
+	}
+	if udi, ok := in.(format.UDPDatagramIn); ok {
+		if udi.DestinationPort != format.UDPPortOpenVPN && udi.SourcePort != format.UDPPortOpenVPN {
+			d.Fatalf("wrong port")
+		}
+	}
+
+	decodePacket(d)
+
+	return nil
+}
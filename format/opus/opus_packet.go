@@ -1,13 +1,17 @@
 package opus
 
 // https://tools.ietf.org/html/rfc7845
+// https://tools.ietf.org/html/rfc6716#section-3
+// https://tools.ietf.org/html/rfc8486
 
 import (
 	"bytes"
+	"fmt"
 
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/registry"
 	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
 )
 
 var vorbisComment decode.Group
@@ -23,6 +27,133 @@ func init() {
 	})
 }
 
+const (
+	mapFamilyRTP                  = 0
+	mapFamilyVorbis               = 1
+	mapFamilyAmbisonics           = 2
+	mapFamilyAmbisonicsProjection = 3
+	mapFamilyUndefined            = 255
+)
+
+var mapFamilyNames = scalar.UToSymStr{
+	mapFamilyRTP:                  "rtp",
+	mapFamilyVorbis:               "vorbis",
+	mapFamilyAmbisonics:           "ambisonics",
+	mapFamilyAmbisonicsProjection: "ambisonics_projection",
+	mapFamilyUndefined:            "undefined",
+}
+
+var channelMappingNames = scalar.UToSymStr{
+	255: "silence",
+}
+
+// Q7.8 fixed point gain in dB
+var outputGainMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	v, ok := s.Actual.(int64)
+	if !ok {
+		return s, nil
+	}
+	s.Description = fmt.Sprintf("%g dB", float64(v)/256)
+	return s, nil
+})
+
+const (
+	framesCodeOne           = 0
+	framesCodeTwoEqual      = 1
+	framesCodeTwoDifferent  = 2
+	framesCodeArbitrary     = 3
+	maxFrameLength          = 1275
+	frameLengthTwoByteStart = 252
+)
+
+// 0 is no frame (DTX), 1-251 length, 252-255 first byte of two byte length
+func frameLength(d *decode.D) uint64 {
+	b0 := d.U8()
+	if b0 < frameLengthTwoByteStart {
+		return b0
+	}
+	return d.U8()*4 + b0
+}
+
+func fieldFrameLength(d *decode.D, name string) int64 {
+	return int64(d.FieldUFn(name, frameLength))
+}
+
+func fieldFrames(d *decode.D, lengths []int64) {
+	d.FieldArray("frames", func(d *decode.D) {
+		for _, l := range lengths {
+			if l > maxFrameLength {
+				d.Fatalf("frame length %d larger than %d", l, maxFrameLength)
+			}
+			d.FieldRawLen("frame", l*8)
+		}
+	})
+}
+
+// frame packing, see rfc6716 section 3.2
+func decodeFrames(d *decode.D, code uint64) {
+	switch code {
+	case framesCodeOne:
+		fieldFrames(d, []int64{d.BitsLeft() / 8})
+	case framesCodeTwoEqual:
+		n := d.BitsLeft() / 8
+		if n%2 != 0 {
+			d.Fatalf("odd length %d for two equal size frames", n)
+		}
+		fieldFrames(d, []int64{n / 2, n / 2})
+	case framesCodeTwoDifferent:
+		l := fieldFrameLength(d, "frame_length")
+		fieldFrames(d, []int64{l, d.BitsLeft()/8 - l})
+	case framesCodeArbitrary:
+		vbr := d.FieldBool("vbr")
+		padding := d.FieldBool("has_padding")
+		count := int64(d.FieldU6("frame_count"))
+		if count == 0 {
+			d.Fatalf("zero frame count")
+		}
+		var paddingLength int64
+		if padding {
+			// 255 means 254 bytes of padding and one more length byte
+			d.FieldArray("padding_lengths", func(d *decode.D) {
+				for {
+					b := int64(d.FieldU8("padding_length"))
+					if b != 255 {
+						paddingLength += b
+						break
+					}
+					paddingLength += 254
+				}
+			})
+			d.FieldValueU("padding_length", uint64(paddingLength))
+		}
+		var lengths []int64
+		if vbr {
+			d.FieldArray("frame_lengths", func(d *decode.D) {
+				for i := int64(0); i < count-1; i++ {
+					lengths = append(lengths, fieldFrameLength(d, "frame_length"))
+				}
+			})
+			sum := int64(0)
+			for _, l := range lengths {
+				sum += l
+			}
+			lengths = append(lengths, d.BitsLeft()/8-paddingLength-sum)
+		} else {
+			n := d.BitsLeft()/8 - paddingLength
+			if n%count != 0 {
+				d.Fatalf("length %d not multiple of frame count %d", n, count)
+			}
+			for i := int64(0); i < count; i++ {
+				lengths = append(lengths, n/count)
+			}
+		}
+		fieldFrames(d, lengths)
+		if paddingLength > 0 {
+			d.FieldRawLen("padding", paddingLength*8)
+		}
+	}
+}
+
 func opusDecode(d *decode.D, in interface{}) interface{} {
 	d.Endian = decode.LittleEndian
 
@@ -38,15 +169,21 @@ func opusDecode(d *decode.D, in interface{}) interface{} {
 		channelCount := d.FieldU8("channel_count")
 		d.FieldU16("pre_skip")
 		d.FieldU32("sample_rate")
-		d.FieldU16("output_gain")
-		mapFamily := d.FieldU8("map_family")
-		if mapFamily != 0 {
-			d.FieldU8("stream_count")
-			d.FieldU8("coupled_count")
-			i := uint64(0)
-			d.FieldArrayLoop("channel_mappings", func() bool { return i < channelCount }, func(d *decode.D) {
-				d.FieldU8("channel_mapping")
-			})
+		d.FieldS16("output_gain", outputGainMap)
+		mapFamily := d.FieldU8("map_family", mapFamilyNames)
+		if mapFamily != mapFamilyRTP {
+			streamCount := d.FieldU8("stream_count")
+			coupledCount := d.FieldU8("coupled_count")
+			if mapFamily == mapFamilyAmbisonicsProjection {
+				// S16 matrix with a row per output channel and a column per decoded channel
+				d.FieldRawLen("demixing_matrix", int64(channelCount*(streamCount+coupledCount)*2*8))
+			} else {
+				d.FieldArray("channel_mappings", func(d *decode.D) {
+					for i := uint64(0); i < channelCount; i++ {
+						d.FieldU8("channel_mapping", channelMappingNames)
+					}
+				})
+			}
 		}
 	case bytes.Equal(prefix, []byte("OpusTags")):
 		d.FieldValueStr("type", "tags")
@@ -54,6 +191,7 @@ func opusDecode(d *decode.D, in interface{}) interface{} {
 		d.FieldFormat("comment", vorbisComment, nil)
 	default:
 		d.FieldValueStr("type", "audio")
+		var framesCode uint64
 		d.FieldStruct("toc", func(d *decode.D) {
 			d.FieldStruct("config", func(d *decode.D) {
 				configurations := map[uint64]struct {
@@ -111,13 +249,13 @@ func opusDecode(d *decode.D, in interface{}) interface{} {
 					2: {2, "2 frames, different size"},
 					3: {0, "arbitrary number of frames"},
 				}
-				n := d.FieldU2("config")
-				config := framesPerPacketConfigs[n]
+				framesCode = d.FieldU2("config")
+				config := framesPerPacketConfigs[framesCode]
 				d.FieldValueU("frames", config.frames)
 				d.FieldValueStr("mode", config.mode)
 			})
-			d.FieldRawLen("data", d.BitsLeft())
 		})
+		decodeFrames(d, framesCode)
 	}
 
 	return nil
@@ -0,0 +1,80 @@
+package ostree
+
+// https://ostreedev.github.io/ostree/repo/
+// https://github.com/ostreedev/ostree/blob/main/src/libostree/ostree-core.h
+
+// TODO: file and filez objects
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+)
+
+var gvariantFormat decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.OSTREE_COMMIT,
+		Description: "OSTree commit object",
+		DecodeFn:    commitDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.GVARIANT}, Group: &gvariantFormat},
+		},
+	})
+	registry.MustRegister(decode.Format{
+		Name:        format.OSTREE_DIRTREE,
+		Description: "OSTree dirtree object",
+		DecodeFn:    dirTreeDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.GVARIANT}, Group: &gvariantFormat},
+		},
+	})
+	registry.MustRegister(decode.Format{
+		Name:        format.OSTREE_DIRMETA,
+		Description: "OSTree dirmeta object",
+		DecodeFn:    dirMetaDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.GVARIANT}, Group: &gvariantFormat},
+		},
+	})
+}
+
+// objects are GVariant with integers in big endian
+
+func commitDecode(d *decode.D, in interface{}) interface{} {
+	d.Format(gvariantFormat, format.GVariantIn{
+		Signature: "(a{sv}aya(say)sstayay)",
+		Names: []string{
+			"metadata",
+			"parent",
+			"related",
+			"subject",
+			"body",
+			"timestamp",
+			"root_tree",
+			"root_meta",
+		},
+		BigEndian: true,
+	})
+	return nil
+}
+
+func dirTreeDecode(d *decode.D, in interface{}) interface{} {
+	// files are name and file checksum, dirs are name, dirtree and dirmeta checksum
+	d.Format(gvariantFormat, format.GVariantIn{
+		Signature: "(a(say)a(sayay))",
+		Names:     []string{"files", "dirs"},
+		BigEndian: true,
+	})
+	return nil
+}
+
+func dirMetaDecode(d *decode.D, in interface{}) interface{} {
+	d.Format(gvariantFormat, format.GVariantIn{
+		Signature: "(uuua(ayay))",
+		Names:     []string{"uid", "gid", "mode", "xattrs"},
+		BigEndian: true,
+	})
+	return nil
+}
@@ -0,0 +1,117 @@
+package otpauth
+
+// https://github.com/google/google-authenticator/wiki/Key-Uri-Format
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.OTPAUTH,
+		Description: "One-time password key URI",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    otpauthDecode,
+	})
+}
+
+var typeNames = scalar.StrToScalar{
+	"hotp": {Description: "HMAC-based one-time password"},
+	"totp": {Description: "Time-based one-time password"},
+}
+
+// decodeURI reads the whole input as one URI with expected scheme
+func decodeURI(d *decode.D, scheme string) *url.URL {
+	prefix := scheme + "://"
+	if !d.TryHasBytes([]byte(prefix)) {
+		d.Fatalf("no %s found", prefix)
+	}
+
+	var u *url.URL
+	d.FieldStrFn("uri", func(d *decode.D) string {
+		s := strings.TrimRight(d.UTF8(int(d.BitsLeft()/8)), "\r\n")
+		var err error
+		u, err = url.Parse(s)
+		if err != nil {
+			d.Fatalf("failed to parse uri: %s", err)
+		}
+		return s
+	})
+
+	return u
+}
+
+// base32 secrets are often written lowercase and without padding
+func decodeSecret(s string) ([]byte, error) {
+	s = strings.ToUpper(strings.TrimRight(s, "="))
+	return base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(s)
+}
+
+func otpauthDecode(d *decode.D, in interface{}) interface{} {
+	u := decodeURI(d, "otpauth")
+
+	d.FieldValueStr("type", u.Host, typeNames)
+
+	label := strings.TrimPrefix(u.Path, "/")
+	d.FieldValueStr("label", label)
+	labelIssuer := ""
+	account := label
+	if i := strings.Index(label, ":"); i != -1 {
+		labelIssuer = label[0:i]
+		account = strings.TrimLeft(label[i+1:], " ")
+	}
+	d.FieldValueStr("account", account)
+
+	q := u.Query()
+	issuer := q.Get("issuer")
+	if issuer == "" {
+		issuer = labelIssuer
+	}
+	if issuer != "" {
+		d.FieldValueStr("issuer", issuer)
+	}
+
+	secret := q.Get("secret")
+	d.FieldValueStr("secret", secret)
+	if b, err := decodeSecret(secret); err == nil {
+		d.FieldRootBitBuf("secret_bytes", bitio.NewBufferFromBytes(b, -1))
+	}
+
+	// default values from key uri format spec
+	algorithm := "SHA1"
+	if s := q.Get("algorithm"); s != "" {
+		algorithm = strings.ToUpper(s)
+	}
+	d.FieldValueStr("algorithm", algorithm)
+	digits := uint64(6)
+	if n, err := strconv.ParseUint(q.Get("digits"), 10, 64); err == nil {
+		digits = n
+	}
+	d.FieldValueU("digits", digits)
+
+	switch u.Host {
+	case "totp":
+		period := uint64(30)
+		if n, err := strconv.ParseUint(q.Get("period"), 10, 64); err == nil {
+			period = n
+		}
+		d.FieldValueU("period", period)
+	case "hotp":
+		if n, err := strconv.ParseUint(q.Get("counter"), 10, 64); err == nil {
+			d.FieldValueU("counter", n)
+		}
+	default:
+		d.Errorf("unknown otp type %q", u.Host)
+	}
+
+	return nil
+}
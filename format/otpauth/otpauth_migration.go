@@ -0,0 +1,105 @@
+package otpauth
+
+// Google Authenticator export, protobuf message base64 encoded in a URI
+// https://github.com/dim13/otpauth/blob/master/migration/migration.proto
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var otpauthMigrationProtoBufFormat decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.OTPAUTH_MIGRATION,
+		Description: "Google Authenticator export URI",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    otpauthMigrationDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.PROTOBUF}, Group: &otpauthMigrationProtoBufFormat},
+		},
+	})
+}
+
+// int32/int64 fields are decoded as unsigned as they are never negative
+var migrationPayloadPb = format.ProtoBufMessage{
+	1: {Type: format.ProtoBufTypeMessage, Name: "otp_parameters", Message: format.ProtoBufMessage{
+		1: {Type: format.ProtoBufTypeBytes, Name: "secret"},
+		2: {Type: format.ProtoBufTypeString, Name: "name"},
+		3: {Type: format.ProtoBufTypeString, Name: "issuer"},
+		4: {Type: format.ProtoBufTypeEnum, Name: "algorithm", Enums: scalar.UToSymStr{
+			0: "ALGORITHM_UNSPECIFIED",
+			1: "SHA1",
+			2: "SHA256",
+			3: "SHA512",
+			4: "MD5",
+		}},
+		5: {Type: format.ProtoBufTypeEnum, Name: "digits", Enums: scalar.UToSymStr{
+			0: "DIGIT_COUNT_UNSPECIFIED",
+			1: "SIX",
+			2: "EIGHT",
+		}},
+		6: {Type: format.ProtoBufTypeEnum, Name: "type", Enums: scalar.UToSymStr{
+			0: "OTP_TYPE_UNSPECIFIED",
+			1: "HOTP",
+			2: "TOTP",
+		}},
+		7: {Type: format.ProtoBufTypeUInt64, Name: "counter"},
+	}},
+	2: {Type: format.ProtoBufTypeUInt32, Name: "version"},
+	3: {Type: format.ProtoBufTypeUInt32, Name: "batch_size"},
+	4: {Type: format.ProtoBufTypeUInt32, Name: "batch_index"},
+	5: {Type: format.ProtoBufTypeUInt32, Name: "batch_id"},
+}
+
+func otpauthMigrationDecode(d *decode.D, in interface{}) interface{} {
+	u := decodeURI(d, "otpauth-migration")
+
+	d.FieldValueStr("type", u.Host)
+
+	// don't use u.Query() as it unescapes "+" in unescaped base64 to space
+	var data string
+	for _, kv := range strings.Split(u.RawQuery, "&") {
+		if v := strings.TrimPrefix(kv, "data="); v != kv {
+			var err error
+			if data, err = url.PathUnescape(v); err != nil {
+				d.Fatalf("failed to unescape data: %s", err)
+			}
+			break
+		}
+	}
+	d.FieldValueStr("data", data)
+	// some exporters use url safe alphabet and/or skip padding
+	var b []byte
+	var err error
+	for _, e := range []*base64.Encoding{
+		base64.StdEncoding,
+		base64.URLEncoding,
+		base64.RawStdEncoding,
+		base64.RawURLEncoding,
+	} {
+		if b, err = e.DecodeString(data); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		d.Fatalf("failed to decode data: %s", err)
+	}
+
+	d.FieldFormatBitBuf(
+		"payload",
+		bitio.NewBufferFromBytes(b, -1),
+		otpauthMigrationProtoBufFormat,
+		format.ProtoBufIn{Message: migrationPayloadPb},
+	)
+
+	return nil
+}
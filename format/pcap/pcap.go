@@ -11,20 +11,22 @@ import (
 	"github.com/wader/fq/pkg/scalar"
 )
 
-var pcapEther8023Format decode.Group
-var pcapSLLPacket decode.Group
-var pcapSLL2Packet decode.Group
+var pcapLinkFrameFormat decode.Group
 var pcapTCPStreamFormat decode.Group
 var pcapIPv4PacketFormat decode.Group
 
 const (
-	bigEndian    = 0xa1b2c3d4
-	littleEndian = 0xd4c3b2a1
+	bigEndian      = 0xa1b2c3d4
+	littleEndian   = 0xd4c3b2a1
+	bigEndianNs    = 0xa1b23c4d
+	littleEndianNs = 0x4d3cb2a1
 )
 
 var endianMap = scalar.UToSymStr{
-	bigEndian:    "big_endian",
-	littleEndian: "little_endian",
+	bigEndian:      "big_endian",
+	littleEndian:   "little_endian",
+	bigEndianNs:    "big_endian_ns",
+	littleEndianNs: "little_endian_ns",
 }
 
 func init() {
@@ -32,10 +34,14 @@ func init() {
 		Name:        format.PCAP,
 		Description: "PCAP packet capture",
 		Groups:      []string{format.PROBE},
+		Magic: []decode.Magic{
+			{Bytes: []byte{0xa1, 0xb2, 0xc3, 0xd4}},
+			{Bytes: []byte{0xd4, 0xc3, 0xb2, 0xa1}},
+			{Bytes: []byte{0xa1, 0xb2, 0x3c, 0x4d}},
+			{Bytes: []byte{0x4d, 0x3c, 0xb2, 0xa1}},
+		},
 		Dependencies: []decode.Dependency{
-			{Names: []string{format.ETHER8023_FRAME}, Group: &pcapEther8023Format},
-			{Names: []string{format.SLL_PACKET}, Group: &pcapSLLPacket},
-			{Names: []string{format.SLL2_PACKET}, Group: &pcapSLL2Packet},
+			{Names: []string{format.LINK_FRAME}, Group: &pcapLinkFrameFormat},
 			{Names: []string{format.TCP_STREAM}, Group: &pcapTCPStreamFormat},
 			{Names: []string{format.IPV4_PACKET}, Group: &pcapIPv4PacketFormat},
 		},
@@ -44,12 +50,20 @@ func init() {
 }
 
 func decodePcap(d *decode.D, in interface{}) interface{} {
-	endian := d.FieldU32("magic", d.AssertU(bigEndian, littleEndian), endianMap, scalar.Hex)
+	endian := d.FieldU32("magic", d.AssertU(bigEndian, littleEndian, bigEndianNs, littleEndianNs), endianMap, scalar.Hex)
+	// nanosecond resolution timestamps
+	nsTimestamps := false
 	switch endian {
 	case bigEndian:
 		d.Endian = decode.BigEndian
 	case littleEndian:
 		d.Endian = decode.LittleEndian
+	case bigEndianNs:
+		d.Endian = decode.BigEndian
+		nsTimestamps = true
+	case littleEndianNs:
+		d.Endian = decode.LittleEndian
+		nsTimestamps = true
 	default:
 		d.Fatalf("unknown endian %d", endian)
 	}
@@ -66,7 +80,11 @@ func decodePcap(d *decode.D, in interface{}) interface{} {
 		for !d.End() {
 			d.FieldStruct("packet", func(d *decode.D) {
 				d.FieldU32("ts_sec")
-				d.FieldU32("ts_usec")
+				if nsTimestamps {
+					d.FieldU32("ts_nsec")
+				} else {
+					d.FieldU32("ts_usec")
+				}
 				inclLen := d.FieldU32("incl_len")
 				origLen := d.FieldU32("orig_len")
 
@@ -89,11 +107,7 @@ func decodePcap(d *decode.D, in interface{}) interface{} {
 					_ = fn(fd, bs)
 				}
 
-				if g, ok := linkToFormat[linkType]; ok {
-					d.FieldFormatLen("packet", int64(inclLen)*8, *g, nil)
-				} else {
-					d.FieldRawLen("packet", int64(inclLen)*8)
-				}
+				fieldLinkFrame(d, int64(inclLen)*8, linkType, pcapLinkFrameFormat)
 			})
 		}
 	})
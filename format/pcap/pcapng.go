@@ -13,9 +13,7 @@ import (
 	"github.com/wader/fq/pkg/scalar"
 )
 
-var pcapngEther8023Format decode.Group
-var pcapngSLLPacketFormat decode.Group
-var pcapngSLL2PacketFormat decode.Group
+var pcapngLinkFrameFormat decode.Group
 var pcapngTCPStreamFormat decode.Group
 var pcapngIPvPacket4Format decode.Group
 
@@ -25,10 +23,9 @@ func init() {
 		Description: "PCAPNG packet capture",
 		RootArray:   true,
 		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte{0x0a, 0x0d, 0x0d, 0x0a}}},
 		Dependencies: []decode.Dependency{
-			{Names: []string{format.ETHER8023_FRAME}, Group: &pcapngEther8023Format},
-			{Names: []string{format.SLL_PACKET}, Group: &pcapngSLLPacketFormat},
-			{Names: []string{format.SLL2_PACKET}, Group: &pcapngSLL2PacketFormat},
+			{Names: []string{format.LINK_FRAME}, Group: &pcapngLinkFrameFormat},
 			{Names: []string{format.TCP_STREAM}, Group: &pcapngTCPStreamFormat},
 			{Names: []string{format.IPV4_PACKET}, Group: &pcapngIPvPacket4Format},
 		},
@@ -247,11 +244,7 @@ var blockFns = map[uint64]func(d *decode.D, dc *decodeContext){
 			_ = fn(dc.flowDecoder, bs)
 		}
 
-		if g, ok := linkToFormat[linkType]; ok {
-			d.FieldFormatLen("packet", int64(capturedLength)*8, *g, nil)
-		} else {
-			d.FieldRawLen("packet", int64(capturedLength)*8)
-		}
+		fieldLinkFrame(d, int64(capturedLength)*8, linkType, pcapngLinkFrameFormat)
 
 		d.FieldRawLen("padding", int64(d.AlignBits(32)))
 		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, enhancedPacketOptionsMap) })
@@ -9,16 +9,11 @@ import (
 	"github.com/wader/fq/pkg/decode"
 )
 
-// TODO: is shared between pcap and pcapng
-var linkToFormat = map[int]*decode.Group{
-	format.LinkTypeETHERNET:   &pcapngEther8023Format,
-	format.LinkTypeLINUX_SLL:  &pcapngSLLPacketFormat,
-	format.LinkTypeLINUX_SLL2: &pcapngSLL2PacketFormat,
-}
-
 var linkToDecodeFn = map[int]func(fd *flowsdecoder.Decoder, bs []byte) error{
 	format.LinkTypeETHERNET:  (*flowsdecoder.Decoder).EthernetFrame,
 	format.LinkTypeLINUX_SLL: (*flowsdecoder.Decoder).SLLPacket,
+	format.LinkTypeRAW:       (*flowsdecoder.Decoder).IPv4Packet,
+	format.LinkTypeIPV4:      (*flowsdecoder.Decoder).IPv4Packet,
 	format.LinkTypeLINUX_SLL2: func(fd *flowsdecoder.Decoder, bs []byte) error {
 		if len(bs) < 20 {
 			// TODO: too short sll packet, error somehow?
@@ -39,6 +34,18 @@ var linkToDecodeFn = map[int]func(fd *flowsdecoder.Decoder, bs []byte) error{
 	},
 }
 
+// decode packet using link_frame decoders, raw bits if there is none for the link type
+func fieldLinkFrame(d *decode.D, nBits int64, linkType int, linkFrameFormat decode.Group) {
+	if dv, _, _ := d.TryFieldFormatLen(
+		"packet",
+		nBits,
+		linkFrameFormat,
+		format.LinkFrameIn{Type: linkType},
+	); dv == nil {
+		d.FieldRawLen("packet", nBits)
+	}
+}
+
 func fieldFlows(d *decode.D, fd *flowsdecoder.Decoder, tcpStreamFormat decode.Group, ipv4PacketFormat decode.Group) {
 	d.FieldArray("ipv4_reassembled", func(d *decode.D) {
 		for _, p := range fd.IPV4Reassembled {
@@ -0,0 +1,276 @@
+package pgs
+
+// https://blog.thescorpius.com/index.php/2017/07/15/presentation-graphic-stream-sup-files-bluray-subtitle-format/
+// https://github.com/FFmpeg/FFmpeg/blob/master/libavcodec/pgssubdec.c
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.PGS,
+		Description: "Presentation Graphic Stream (Blu-ray subtitle)",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte("PG")}},
+		DecodeFn:    pgsDecode,
+		RootArray:   true,
+		RootName:    "segments",
+	})
+}
+
+// presentation and decode timestamps are in 90kHz units
+const timestampHz = 90000
+
+const (
+	segmentTypePDS = 0x14
+	segmentTypeODS = 0x15
+	segmentTypePCS = 0x16
+	segmentTypeWDS = 0x17
+	segmentTypeEND = 0x80
+)
+
+var segmentTypeNames = scalar.UToScalar{
+	segmentTypePDS: {Sym: "pds", Description: "Palette definition segment"},
+	segmentTypeODS: {Sym: "ods", Description: "Object definition segment"},
+	segmentTypePCS: {Sym: "pcs", Description: "Presentation composition segment"},
+	segmentTypeWDS: {Sym: "wds", Description: "Window definition segment"},
+	segmentTypeEND: {Sym: "end", Description: "End of display set segment"},
+}
+
+var compositionStateNames = scalar.UToSymStr{
+	0x00: "normal",
+	0x40: "acquisition_point",
+	0x80: "epoch_start",
+}
+
+var frameRateNames = scalar.UToSymStr{
+	0x10: "23.976",
+	0x20: "24",
+	0x30: "25",
+	0x40: "29.97",
+	0x50: "30",
+	0x60: "50",
+	0x70: "59.94",
+}
+
+type object struct {
+	width  uint64
+	height uint64
+	data   []byte
+}
+
+type rleInfo struct {
+	lines        uint64
+	pixels       uint64
+	longestLine  uint64
+	colorsUsed   uint64
+	transparents uint64
+}
+
+// decodes run-length encoded bitmap, each line ends with a 0x00 0x00 code
+func decodeRLE(b []byte) rleInfo {
+	var ri rleInfo
+	var colors [256]bool
+	var linePixels uint64
+
+	endLine := func() {
+		ri.lines++
+		if linePixels > ri.longestLine {
+			ri.longestLine = linePixels
+		}
+		linePixels = 0
+	}
+	add := func(n uint64, color byte) {
+		ri.pixels += n
+		linePixels += n
+		if color == 0 {
+			ri.transparents += n
+		}
+		if !colors[color] {
+			colors[color] = true
+			ri.colorsUsed++
+		}
+	}
+
+	for i := 0; i < len(b); {
+		c := b[i]
+		i++
+		if c != 0 {
+			add(1, c)
+			continue
+		}
+		if i >= len(b) {
+			break
+		}
+		f := b[i]
+		i++
+		if f == 0 {
+			endLine()
+			continue
+		}
+		n := uint64(f & 0x3f)
+		if f&0x40 != 0 {
+			if i >= len(b) {
+				break
+			}
+			n = n<<8 | uint64(b[i])
+			i++
+		}
+		color := byte(0)
+		if f&0x80 != 0 {
+			if i >= len(b) {
+				break
+			}
+			color = b[i]
+			i++
+		}
+		add(n, color)
+	}
+
+	return ri
+}
+
+func decodePCS(d *decode.D) {
+	d.FieldU16("width")
+	d.FieldU16("height")
+	d.FieldU8("frame_rate", frameRateNames)
+	d.FieldU16("composition_number")
+	d.FieldU8("composition_state", compositionStateNames)
+	d.FieldU8("palette_update_flag", scalar.UToSymStr{0x00: "false", 0x80: "true"})
+	d.FieldU8("palette_id")
+	numObjects := d.FieldU8("number_of_composition_objects")
+	d.FieldArray("composition_objects", func(d *decode.D) {
+		for i := uint64(0); i < numObjects; i++ {
+			d.FieldStruct("composition_object", func(d *decode.D) {
+				d.FieldU16("object_id")
+				d.FieldU8("window_id")
+				cropped := d.FieldU8("object_cropped_flag", scalar.UToSymStr{0x00: "off", 0x40: "force"})
+				d.FieldU16("x")
+				d.FieldU16("y")
+				if cropped == 0x40 {
+					d.FieldU16("crop_x")
+					d.FieldU16("crop_y")
+					d.FieldU16("crop_width")
+					d.FieldU16("crop_height")
+				}
+			})
+		}
+	})
+}
+
+func decodeWDS(d *decode.D) {
+	numWindows := d.FieldU8("number_of_windows")
+	d.FieldArray("windows", func(d *decode.D) {
+		for i := uint64(0); i < numWindows; i++ {
+			d.FieldStruct("window", func(d *decode.D) {
+				d.FieldU8("window_id")
+				d.FieldU16("x")
+				d.FieldU16("y")
+				d.FieldU16("width")
+				d.FieldU16("height")
+			})
+		}
+	})
+}
+
+func decodePDS(d *decode.D) {
+	d.FieldU8("palette_id")
+	d.FieldU8("palette_version")
+	d.FieldArray("entries", func(d *decode.D) {
+		for !d.End() {
+			d.FieldStruct("entry", func(d *decode.D) {
+				d.FieldU8("id")
+				d.FieldU8("y")
+				d.FieldU8("cr")
+				d.FieldU8("cb")
+				d.FieldU8("alpha")
+			})
+		}
+	})
+}
+
+func decodeODS(d *decode.D, objects map[uint64]*object) {
+	objectID := d.FieldU16("object_id")
+	d.FieldU8("object_version")
+	var first, last bool
+	d.FieldStruct("sequence_flag", func(d *decode.D) {
+		first = d.FieldBool("first_in_sequence")
+		last = d.FieldBool("last_in_sequence")
+		d.FieldU6("unused")
+	})
+
+	o := objects[objectID]
+	if first {
+		// length includes width and height
+		d.FieldU24("object_data_length")
+		o = &object{}
+		o.width = d.FieldU16("width")
+		o.height = d.FieldU16("height")
+		objects[objectID] = o
+	}
+	dataLen := d.BitsLeft()
+	if o != nil {
+		o.data = append(o.data, d.BytesRange(d.Pos(), int(dataLen/8))...)
+	}
+	d.FieldRawLen("data", dataLen)
+
+	if !last || o == nil {
+		return
+	}
+	delete(objects, objectID)
+	ri := decodeRLE(o.data)
+	d.FieldStruct("bitmap", func(d *decode.D) {
+		d.FieldValueU("lines", ri.lines, d.ValidateU(o.height))
+		d.FieldValueU("pixels", ri.pixels, d.ValidateU(o.width*o.height))
+		d.FieldValueU("longest_line", ri.longestLine)
+		d.FieldValueU("colors_used", ri.colorsUsed)
+		d.FieldValueU("transparent_pixels", ri.transparents)
+	})
+}
+
+func pgsDecode(d *decode.D, in interface{}) interface{} {
+	objects := map[uint64]*object{}
+
+	if d.End() {
+		d.Fatalf("no segments")
+	}
+
+	for i := 0; !d.End(); i++ {
+		d.FieldStruct("segment", func(d *decode.D) {
+			d.FieldUTF8("magic", 2, d.AssertStr("PG"))
+			pts := d.FieldU32("pts")
+			d.FieldValueFloat("pts_time", float64(pts)/timestampHz)
+			dts := d.FieldU32("dts")
+			d.FieldValueFloat("dts_time", float64(dts)/timestampHz)
+			typ := d.FieldU8("type", segmentTypeNames)
+			// display set starts with a presentation composition segment
+			if i == 0 && typ != segmentTypePCS {
+				d.Fatalf("first segment is not a presentation composition segment")
+			}
+			size := d.FieldU16("size")
+
+			d.LenFn(int64(size)*8, func(d *decode.D) {
+				switch typ {
+				case segmentTypePCS:
+					decodePCS(d)
+				case segmentTypeWDS:
+					decodeWDS(d)
+				case segmentTypePDS:
+					decodePDS(d)
+				case segmentTypeODS:
+					decodeODS(d, objects)
+				case segmentTypeEND:
+					// no data
+				default:
+					d.FieldRawLen("data", d.BitsLeft())
+				}
+			})
+		})
+	}
+
+	return nil
+}
@@ -5,11 +5,15 @@ package png
 // https://wiki.mozilla.org/APNG_Specification
 
 import (
+	"bytes"
 	"compress/zlib"
 	"hash/crc32"
+	"io"
+	"math"
 
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/bitio"
 	"github.com/wader/fq/pkg/decode"
 	"github.com/wader/fq/pkg/scalar"
 )
@@ -22,6 +26,7 @@ func init() {
 		Name:        format.PNG,
 		Description: "Portable Network Graphics file",
 		Groups:      []string{format.PROBE, format.IMAGE},
+		Magic:       []decode.Magic{{Bytes: []byte("\x89PNG\r\n\x1a\n")}},
 		DecodeFn:    pngDecode,
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.ICC_PROFILE}, Group: &iccProfileFormat},
@@ -76,13 +81,167 @@ var colorTypeMap = scalar.UToScalar{
 	colorTypeRGBA:               {Sym: "rgba", Description: "RGBA"},
 }
 
+var colorTypeChannels = map[uint64]uint64{
+	colorTypeGrayscale:          1,
+	colorTypeRGB:                3,
+	colorTypePalette:            1,
+	colorTypeGrayscaleWithAlpha: 2,
+	colorTypeRGBA:               4,
+}
+
+// x, y start and step for each Adam7 pass
+var adam7Passes = [][4]uint64{
+	{0, 0, 8, 8},
+	{4, 0, 8, 8},
+	{0, 4, 4, 8},
+	{2, 0, 4, 4},
+	{0, 2, 2, 4},
+	{1, 0, 2, 2},
+	{0, 1, 1, 2},
+}
+
+const filterTypeMax = 4
+
+type header struct {
+	width           uint64
+	height          uint64
+	bitDepth        uint64
+	colorType       uint64
+	interlaceMethod uint64
+}
+
+type salvagePass struct {
+	pass    int
+	height  uint64
+	rowSize uint64
+}
+
+// salvagePasses returns height and size of a scanline including filter type byte
+// for each non-empty pass
+func salvagePasses(h *header) []salvagePass {
+	passes := [][4]uint64{{0, 0, 1, 1}}
+	if h.interlaceMethod == 1 {
+		passes = adam7Passes
+	}
+	bitsPerPixel := colorTypeChannels[h.colorType] * h.bitDepth
+	var sps []salvagePass
+	for i, p := range passes {
+		if h.width <= p[0] || h.height <= p[1] {
+			continue
+		}
+		passWidth := (h.width - p[0] + p[2] - 1) / p[2]
+		passHeight := (h.height - p[1] + p[3] - 1) / p[3]
+		sps = append(sps, salvagePass{
+			pass:    i + 1,
+			height:  passHeight,
+			rowSize: 1 + (passWidth*bitsPerPixel+7)/8,
+		})
+	}
+	return sps
+}
+
+// decodeSalvage inflates as much as possible of the concatenated IDAT data and adds
+// ranges of scanlines that are complete and start with a valid filter type.
+// Inflated size is limited to what IHDR describes.
+func decodeSalvage(d *decode.D, h *header, idat []byte) {
+	d.FieldValueU("idat_size", uint64(len(idat)))
+
+	if h == nil {
+		d.Warnf(decode.WarningTruncated, "no IHDR chunk, not inflating")
+		return
+	}
+	passes := salvagePasses(h)
+	expectedSize := uint64(0)
+	for _, p := range passes {
+		if p.height > (math.MaxUint64-expectedSize)/p.rowSize {
+			expectedSize = math.MaxUint64
+			break
+		}
+		expectedSize += p.height * p.rowSize
+	}
+	d.FieldValueU("expected_size", expectedSize)
+
+	var inflated []byte
+	zr, err := zlib.NewReader(bytes.NewReader(idat))
+	if err == nil {
+		// partial output is returned on error, ex unexpected EOF for truncated data
+		// read one extra byte to know if there is more than expected
+		limit := int64(math.MaxInt64)
+		if expectedSize < math.MaxInt64 {
+			limit = int64(expectedSize) + 1
+		}
+		inflated, err = io.ReadAll(io.LimitReader(zr, limit))
+	}
+	if err != nil {
+		d.FieldValueStr("inflate_error", err.Error())
+	}
+	if uint64(len(inflated)) > expectedSize {
+		inflated = inflated[0:expectedSize]
+		d.Warnf(decode.WarningTrailingData, "inflated data larger than %d bytes described by IHDR", expectedSize)
+	}
+	d.FieldRootBitBuf("inflated", bitio.NewBufferFromBytes(inflated, -1))
+
+	offset := uint64(0)
+	d.FieldArray("scanline_ranges", func(d *decode.D) {
+		for _, p := range passes {
+			rangeStart := -1
+			addRange := func(end int) {
+				if rangeStart == -1 {
+					return
+				}
+				d.FieldStruct("range", func(d *decode.D) {
+					if h.interlaceMethod == 1 {
+						d.FieldValueU("pass", uint64(p.pass))
+					}
+					d.FieldValueU("start", uint64(rangeStart))
+					d.FieldValueU("end", uint64(end))
+					d.FieldValueU("offset", offset-uint64(end-rangeStart)*p.rowSize)
+					d.FieldValueU("size", uint64(end-rangeStart)*p.rowSize)
+				})
+				rangeStart = -1
+			}
+			row := uint64(0)
+			for ; row < p.height && offset+p.rowSize <= uint64(len(inflated)); row++ {
+				if inflated[offset] > filterTypeMax {
+					addRange(int(row))
+				} else if rangeStart == -1 {
+					rangeStart = int(row)
+				}
+				offset += p.rowSize
+			}
+			addRange(int(row))
+			if row < p.height {
+				break
+			}
+		}
+	})
+}
+
 func pngDecode(d *decode.D, in interface{}) interface{} {
 	iEndFound := false
 	var colorType uint64
+	var h *header
+	var idat []byte
+
+	// continue past crc mismatches and truncated chunks, IDAT data is inflated until error
+	salvage, _ := d.Options.FormatOptions["salvage"].(bool)
+	notEnd := func() bool {
+		if salvage {
+			// length and type
+			return d.BitsLeft() >= 8*8
+		}
+		return d.NotEnd()
+	}
 
 	d.FieldRawLen("signature", 8*8, d.AssertBitBuf([]byte("\x89PNG\r\n\x1a\n")))
-	d.FieldStructArrayLoop("chunks", "chunk", func() bool { return d.NotEnd() && !iEndFound }, func(d *decode.D) {
+	d.FieldStructArrayLoop("chunks", "chunk", func() bool { return notEnd() && !iEndFound }, func(d *decode.D) {
 		chunkLength := d.FieldU32("length")
+		truncated := false
+		if salvage && int64(chunkLength)*8 > d.BitsLeft()-4*8 {
+			chunkLength = uint64(d.BitsLeft()/8 - 4)
+			truncated = true
+			d.FieldWarnf("length", decode.WarningTruncated, "chunk truncated to %d bytes", chunkLength)
+		}
 		crcStartPos := d.Pos()
 		// TODO: this is a bit weird, use struct?
 		chunkType := d.FieldStrFn("type", func(d *decode.D) string {
@@ -104,15 +263,17 @@ func pngDecode(d *decode.D, in interface{}) interface{} {
 		d.LenFn(int64(chunkLength)*8, func(d *decode.D) {
 			switch chunkType {
 			case "IHDR":
-				d.FieldU32("width")
-				d.FieldU32("height")
-				d.FieldU8("bit_depth")
+				h = &header{}
+				h.width = d.FieldU32("width")
+				h.height = d.FieldU32("height")
+				h.bitDepth = d.FieldU8("bit_depth")
 				colorType = d.FieldU8("color_type", colorTypeMap)
+				h.colorType = colorType
 				d.FieldU8("compression_method", compressionNames)
 				d.FieldU8("filter_method", scalar.UToSymStr{
 					0: "Adaptive filtering",
 				})
-				d.FieldU8("interlace_method", scalar.UToSymStr{
+				h.interlaceMethod = d.FieldU8("interlace_method", scalar.UToSymStr{
 					0: "No interlace",
 					1: "Adam7 interlace",
 				})
@@ -193,6 +354,11 @@ func pngDecode(d *decode.D, in interface{}) interface{} {
 				d.FieldU16("delay_sep")
 				d.FieldU8("dispose_op", disposeOpNames)
 				d.FieldU8("blend_op", blendOpNames)
+			case "IDAT":
+				if salvage {
+					idat = append(idat, d.PeekBytes(int(d.BitsLeft()/8))...)
+				}
+				d.FieldRawLen("data", d.BitsLeft())
 			case "fdAT":
 				d.FieldU32("sequence_number")
 				d.FieldRawLen("data", d.BitsLeft()-32)
@@ -205,10 +371,26 @@ func pngDecode(d *decode.D, in interface{}) interface{} {
 			}
 		})
 
+		if salvage && d.BitsLeft() < 32 {
+			if !truncated {
+				d.Warnf(decode.WarningTruncated, "crc missing")
+			}
+			return
+		}
 		chunkCRC := crc32.NewIEEE()
 		d.MustCopy(chunkCRC, d.BitBufRange(crcStartPos, d.Pos()-crcStartPos))
-		d.FieldU32("crc", d.ValidateUBytes(chunkCRC.Sum(nil)), scalar.Hex)
+		crc := d.FieldChecksumU("crc", 32, "crc32", uint64(chunkCRC.Sum32()), scalar.Hex)
+		if salvage && crc != uint64(chunkCRC.Sum32()) {
+			d.FieldWarnf("crc", decode.WarningChecksumMismatch, "%s crc 0x%08x, computed 0x%08x", chunkType, crc, chunkCRC.Sum32())
+		}
 	})
 
+	if salvage {
+		if !iEndFound {
+			d.Warnf(decode.WarningTruncated, "no IEND chunk")
+		}
+		d.FieldStruct("salvage", func(d *decode.D) { decodeSalvage(d, h, idat) })
+	}
+
 	return nil
 }
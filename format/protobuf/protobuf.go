@@ -106,8 +106,7 @@ func protobufDecodeField(d *decode.D, pbm *format.ProtoBufMessage) {
 				case format.ProtoBufTypeBytes:
 					d.FieldValueRaw("value", d.BytesRange(valueStart, int(length)))
 				case format.ProtoBufTypeMessage:
-					// TODO: test
-					d.LenFn(int64(length)*8, func(d *decode.D) {
+					d.RangeFn(valueStart, int64(length)*8, func(d *decode.D) {
 						protobufDecodeFields(d, &pbf.Message)
 					})
 				case format.ProtoBufTypePackedRepeated:
@@ -0,0 +1,492 @@
+package psd
+
+// https://www.adobe.com/devnet-apps/photoshop/fileformatashtml/
+
+// TODO: decode RLE and zip compressed channel data
+// TODO: more image resource and additional layer info blocks
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var jpegFormat decode.Group
+var iccProfileFormat decode.Group
+var exifFormat decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.PSD,
+		Description: "Adobe Photoshop document",
+		Groups:      []string{format.PROBE, format.IMAGE},
+		Magic:       []decode.Magic{{Bytes: []byte("8BPS")}},
+		DecodeFn:    psdDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.JPEG}, Group: &jpegFormat},
+			{Names: []string{format.ICC_PROFILE}, Group: &iccProfileFormat},
+			{Names: []string{format.EXIF}, Group: &exifFormat},
+		},
+	})
+}
+
+const (
+	versionPSD = 1
+	versionPSB = 2
+)
+
+var versionNames = scalar.UToSymStr{
+	versionPSD: "psd",
+	versionPSB: "psb",
+}
+
+var colorModeNames = scalar.UToSymStr{
+	0: "bitmap",
+	1: "grayscale",
+	2: "indexed",
+	3: "rgb",
+	4: "cmyk",
+	7: "multichannel",
+	8: "duotone",
+	9: "lab",
+}
+
+const (
+	compressionRaw           = 0
+	compressionRLE           = 1
+	compressionZip           = 2
+	compressionZipPrediction = 3
+)
+
+var compressionNames = scalar.UToSymStr{
+	compressionRaw:           "raw",
+	compressionRLE:           "rle",
+	compressionZip:           "zip",
+	compressionZipPrediction: "zip_prediction",
+}
+
+const (
+	resourceResolutionInfo = 1005
+	resourceThumbnailOld   = 1033
+	resourceThumbnail      = 1036
+	resourceICCProfile     = 1039
+	resourceEXIFData1      = 1058
+	resourceXMPMetadata    = 1060
+)
+
+var resourceIDNames = scalar.UToSymStr{
+	1000:                   "channels_rows_columns_depth_mode",
+	1001:                   "macintosh_print_manager_info",
+	1002:                   "macintosh_page_format_info",
+	1003:                   "indexed_color_table",
+	resourceResolutionInfo: "resolution_info",
+	1006:                   "alpha_channel_names",
+	1007:                   "display_info_obsolete",
+	1008:                   "caption",
+	1009:                   "border_info",
+	1010:                   "background_color",
+	1011:                   "print_flags",
+	1012:                   "grayscale_halftoning_info",
+	1013:                   "color_halftoning_info",
+	1014:                   "duotone_halftoning_info",
+	1015:                   "grayscale_transfer_function",
+	1016:                   "color_transfer_functions",
+	1017:                   "duotone_transfer_functions",
+	1018:                   "duotone_image_info",
+	1019:                   "effective_black_white_dot_range",
+	1021:                   "eps_options",
+	1022:                   "quick_mask_info",
+	1024:                   "layer_state_info",
+	1025:                   "working_path",
+	1026:                   "layers_group_info",
+	1028:                   "iptc_naa_record",
+	1029:                   "image_mode_raw",
+	1030:                   "jpeg_quality",
+	1032:                   "grid_and_guides_info",
+	resourceThumbnailOld:   "thumbnail_resource_old",
+	1034:                   "copyright_flag",
+	1035:                   "url",
+	resourceThumbnail:      "thumbnail_resource",
+	1037:                   "global_angle",
+	1038:                   "color_samplers_resource_obsolete",
+	resourceICCProfile:     "icc_profile",
+	1040:                   "watermark",
+	1041:                   "icc_untagged_profile",
+	1042:                   "effects_visible",
+	1043:                   "spot_halftone",
+	1044:                   "document_specific_ids_seed",
+	1045:                   "unicode_alpha_names",
+	1046:                   "indexed_color_table_count",
+	1047:                   "transparency_index",
+	1049:                   "global_altitude",
+	1050:                   "slices",
+	1051:                   "workflow_url",
+	1052:                   "jump_to_xpep",
+	1053:                   "alpha_identifiers",
+	1054:                   "url_list",
+	1057:                   "version_info",
+	resourceEXIFData1:      "exif_data_1",
+	1059:                   "exif_data_3",
+	resourceXMPMetadata:    "xmp_metadata",
+	1061:                   "caption_digest",
+	1062:                   "print_scale",
+	1064:                   "pixel_aspect_ratio",
+	1065:                   "layer_comps",
+	1066:                   "alternate_duotone_colors",
+	1067:                   "alternate_spot_colors",
+	1069:                   "layer_selection_ids",
+	1070:                   "hdr_toning_info",
+	1071:                   "print_info",
+	1072:                   "layer_groups_enabled_id",
+	1073:                   "color_samplers_resource",
+	1074:                   "measurement_scale",
+	1075:                   "timeline_information",
+	1076:                   "sheet_disclosure",
+	1077:                   "display_info",
+	1078:                   "onion_skins",
+	1080:                   "count_information",
+	1082:                   "print_information",
+	1083:                   "print_style",
+	1084:                   "macintosh_nsprintinfo",
+	1085:                   "windows_devmode",
+	1086:                   "auto_save_file_path",
+	1087:                   "auto_save_format",
+	1088:                   "path_selection_state",
+	2999:                   "clipping_path_name",
+	3000:                   "origin_path_info",
+	7000:                   "image_ready_variables",
+	7001:                   "image_ready_data_sets",
+	7002:                   "image_ready_default_selected_state",
+	7003:                   "image_ready_7_rollover_expanded_state",
+	7004:                   "image_ready_rollover_expanded_state",
+	7005:                   "image_ready_save_layer_settings",
+	7006:                   "image_ready_version",
+	8000:                   "lightroom_workflow",
+	10000:                  "print_flags_info",
+}
+
+// 2000-2997 are saved paths
+var resourceIDMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	u, ok := s.Actual.(uint64)
+	if !ok {
+		return s, nil
+	}
+	if u >= 2000 && u <= 2997 {
+		s.Sym = "path_information"
+		return s, nil
+	}
+	return resourceIDNames.MapScalar(s)
+})
+
+var resolutionUnitNames = scalar.UToSymStr{
+	1: "pixels_per_inch",
+	2: "pixels_per_cm",
+}
+
+var sizeUnitNames = scalar.UToSymStr{
+	1: "inches",
+	2: "cm",
+	3: "points",
+	4: "picas",
+	5: "columns",
+}
+
+var thumbnailFormatNames = scalar.UToSymStr{
+	0: "raw_rgb",
+	1: "jpeg_rgb",
+}
+
+var clippingNames = scalar.UToSymStr{
+	0: "base",
+	1: "non_base",
+}
+
+var channelIDMap = scalar.SToScalar{
+	-1: {Sym: "transparency_mask"},
+	-2: {Sym: "user_supplied_layer_mask"},
+	-3: {Sym: "real_user_supplied_layer_mask"},
+}
+
+// pascal string, length byte included in padding
+func fieldPascalString(d *decode.D, name string, align int64) {
+	d.FieldStruct(name, func(d *decode.D) {
+		length := d.FieldU8("length")
+		d.FieldUTF8("value", int(length))
+		padLen := (align - (1+int64(length))%align) % align
+		if padLen > 0 {
+			d.FieldRawLen("padding", padLen*8, d.BitBufIsZero())
+		}
+	})
+}
+
+// PSB uses 64 bit lengths for some sections
+func fieldLength(d *decode.D, name string, version uint64) int64 {
+	if version == versionPSB {
+		return int64(d.FieldU64(name))
+	}
+	return int64(d.FieldU32(name))
+}
+
+func decodeThumbnail(d *decode.D, id uint64) {
+	d.FieldU32("format", thumbnailFormatNames)
+	d.FieldU32("width")
+	d.FieldU32("height")
+	d.FieldU32("width_bytes")
+	d.FieldU32("total_size")
+	compressedSize := d.FieldU32("compressed_size")
+	d.FieldU16("bits_per_pixel")
+	d.FieldU16("planes")
+	// old thumbnail resource has BGR instead of RGB order
+	if id == resourceThumbnail && int64(compressedSize)*8 <= d.BitsLeft() {
+		d.FieldFormatLen("data", int64(compressedSize)*8, jpegFormat, nil)
+	}
+	if d.NotEnd() {
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+}
+
+func decodeImageResource(d *decode.D) {
+	d.FieldUTF8("signature", 4, d.AssertStr("8BIM", "MeSa", "AgHg", "PHUT", "DCSR"))
+	id := d.FieldU16("id", resourceIDMap)
+	fieldPascalString(d, "name", 2)
+	size := d.FieldU32("size")
+	d.LenFn(int64(size)*8, func(d *decode.D) {
+		switch id {
+		case resourceResolutionInfo:
+			d.FieldFP32("horizontal_resolution")
+			d.FieldU16("horizontal_resolution_unit", resolutionUnitNames)
+			d.FieldU16("width_unit", sizeUnitNames)
+			d.FieldFP32("vertical_resolution")
+			d.FieldU16("vertical_resolution_unit", resolutionUnitNames)
+			d.FieldU16("height_unit", sizeUnitNames)
+		case resourceThumbnailOld, resourceThumbnail:
+			d.FieldStruct("thumbnail", func(d *decode.D) {
+				decodeThumbnail(d, id)
+			})
+		case resourceICCProfile:
+			d.FieldFormatLen("data", d.BitsLeft(), iccProfileFormat, nil)
+		case resourceEXIFData1:
+			d.FieldFormatLen("data", d.BitsLeft(), exifFormat, nil)
+		case resourceXMPMetadata:
+			d.FieldUTF8("data", int(d.BitsLeft()/8))
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+	// data is padded to even size
+	if size%2 != 0 {
+		d.FieldRawLen("padding", 8, d.BitBufIsZero())
+	}
+}
+
+// keys that has 64 bit length in PSB
+var psbLongLengthKeys = map[string]bool{
+	"LMsk": true, "Lr16": true, "Lr32": true, "Layr": true, "Mt16": true, "Mt32": true,
+	"Mtrn": true, "Alph": true, "FMsk": true, "lnk2": true, "FEid": true, "FXid": true,
+	"PxSD": true,
+}
+
+func decodeAdditionalLayerInfo(d *decode.D, version uint64) {
+	d.FieldUTF8("signature", 4, d.AssertStr("8BIM", "8B64"))
+	key := d.FieldUTF8("key", 4)
+	var length int64
+	if version == versionPSB && psbLongLengthKeys[key] {
+		length = int64(d.FieldU64("length"))
+	} else {
+		length = int64(d.FieldU32("length"))
+	}
+	d.LenFn(length*8, func(d *decode.D) {
+		switch key {
+		case "luni":
+			d.FieldStruct("unicode_name", func(d *decode.D) {
+				length := d.FieldU32("length")
+				d.FieldUTF16BE("value", int(length)*2)
+			})
+			if d.NotEnd() {
+				d.FieldRawLen("padding", d.BitsLeft(), d.BitBufIsZero())
+			}
+		case "lyid":
+			d.FieldU32("layer_id")
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+}
+
+type layerChannel struct {
+	id     int64
+	length int64
+}
+
+type layerRecord struct {
+	channels []layerChannel
+}
+
+func decodeLayerRecord(d *decode.D, version uint64) layerRecord {
+	var lr layerRecord
+
+	d.FieldS32("top")
+	d.FieldS32("left")
+	d.FieldS32("bottom")
+	d.FieldS32("right")
+	channelCount := d.FieldU16("channel_count")
+	d.FieldArray("channels", func(d *decode.D) {
+		for i := uint64(0); i < channelCount; i++ {
+			d.FieldStruct("channel", func(d *decode.D) {
+				id := d.FieldS16("id", channelIDMap)
+				length := fieldLength(d, "length", version)
+				lr.channels = append(lr.channels, layerChannel{id: id, length: length})
+			})
+		}
+	})
+	d.FieldUTF8("blend_mode_signature", 4, d.AssertStr("8BIM"))
+	d.FieldUTF8("blend_mode_key", 4)
+	d.FieldU8("opacity")
+	d.FieldU8("clipping", clippingNames)
+	d.FieldStruct("flags", func(d *decode.D) {
+		d.FieldU3("unused")
+		d.FieldBool("pixel_data_irrelevant")
+		d.FieldBool("pixel_data_irrelevant_valid")
+		d.FieldBool("obsolete")
+		d.FieldBool("hidden")
+		d.FieldBool("transparency_protected")
+	})
+	d.FieldU8("filler")
+	extraLen := d.FieldU32("extra_data_length")
+	d.LenFn(int64(extraLen)*8, func(d *decode.D) {
+		d.FieldStruct("mask_data", func(d *decode.D) {
+			length := d.FieldU32("length")
+			if length > 0 {
+				d.FieldRawLen("data", int64(length)*8)
+			}
+		})
+		d.FieldStruct("blending_ranges", func(d *decode.D) {
+			length := d.FieldU32("length")
+			if length > 0 {
+				d.FieldRawLen("data", int64(length)*8)
+			}
+		})
+		fieldPascalString(d, "name", 4)
+		d.FieldStructArrayLoop("additional_layer_info", "block", d.NotEnd, func(d *decode.D) {
+			decodeAdditionalLayerInfo(d, version)
+		})
+	})
+
+	return lr
+}
+
+func decodeLayerInfo(d *decode.D, version uint64) {
+	var records []layerRecord
+
+	// negative count means first alpha channel contains the transparency data
+	layerCount := d.FieldS16("layer_count")
+	if layerCount < 0 {
+		layerCount = -layerCount
+	}
+	d.FieldArray("layer_records", func(d *decode.D) {
+		for i := int64(0); i < layerCount; i++ {
+			d.FieldStruct("layer_record", func(d *decode.D) {
+				records = append(records, decodeLayerRecord(d, version))
+			})
+		}
+	})
+	d.FieldArray("channel_image_data", func(d *decode.D) {
+		for _, r := range records {
+			d.FieldArray("layer", func(d *decode.D) {
+				for _, c := range r.channels {
+					d.FieldStruct("channel", func(d *decode.D) {
+						d.FieldValueS("id", c.id, channelIDMap)
+						d.LenFn(c.length*8, func(d *decode.D) {
+							d.FieldU16("compression", compressionNames)
+							if d.NotEnd() {
+								d.FieldRawLen("data", d.BitsLeft())
+							}
+						})
+					})
+				}
+			})
+		}
+	})
+	if d.NotEnd() {
+		d.FieldRawLen("padding", d.BitsLeft(), d.BitBufIsZero())
+	}
+}
+
+func decodeLayerAndMaskInfo(d *decode.D, version uint64) {
+	d.FieldStruct("layer_info", func(d *decode.D) {
+		length := fieldLength(d, "length", version)
+		if length > 0 {
+			d.LenFn(length*8, func(d *decode.D) {
+				decodeLayerInfo(d, version)
+			})
+		}
+	})
+	if !d.NotEnd() {
+		return
+	}
+	d.FieldStruct("global_layer_mask_info", func(d *decode.D) {
+		length := d.FieldU32("length")
+		if length == 0 {
+			return
+		}
+		d.LenFn(int64(length)*8, func(d *decode.D) {
+			d.FieldU16("overlay_color_space")
+			d.FieldRawLen("color_components", 8*8)
+			d.FieldU16("opacity")
+			d.FieldU8("kind")
+			if d.NotEnd() {
+				d.FieldRawLen("filler", d.BitsLeft())
+			}
+		})
+	})
+	d.FieldStructArrayLoop("additional_layer_info", "block", func() bool { return d.BitsLeft() >= 12*8 }, func(d *decode.D) {
+		decodeAdditionalLayerInfo(d, version)
+	})
+	if d.NotEnd() {
+		d.FieldRawLen("padding", d.BitsLeft(), d.BitBufIsZero())
+	}
+}
+
+func psdDecode(d *decode.D, in interface{}) interface{} {
+	var version uint64
+
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldUTF8("signature", 4, d.AssertStr("8BPS"))
+		version = d.FieldU16("version", versionNames, d.AssertU(versionPSD, versionPSB))
+		d.FieldRawLen("reserved", 6*8, d.BitBufIsZero())
+		d.FieldU16("channels")
+		d.FieldU32("height")
+		d.FieldU32("width")
+		d.FieldU16("depth")
+		d.FieldU16("color_mode", colorModeNames)
+	})
+	d.FieldStruct("color_mode_data", func(d *decode.D) {
+		length := d.FieldU32("length")
+		if length > 0 {
+			d.FieldRawLen("data", int64(length)*8)
+		}
+	})
+	d.FieldStruct("image_resources", func(d *decode.D) {
+		length := d.FieldU32("length")
+		d.LenFn(int64(length)*8, func(d *decode.D) {
+			d.FieldStructArrayLoop("blocks", "block", d.NotEnd, decodeImageResource)
+		})
+	})
+	d.FieldStruct("layer_and_mask_info", func(d *decode.D) {
+		length := fieldLength(d, "length", version)
+		if length > 0 {
+			d.LenFn(length*8, func(d *decode.D) {
+				decodeLayerAndMaskInfo(d, version)
+			})
+		}
+	})
+	d.FieldStruct("image_data", func(d *decode.D) {
+		d.FieldU16("compression", compressionNames)
+		if d.NotEnd() {
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,216 @@
+package quic
+
+// https://datatracker.ietf.org/doc/html/rfc9000#section-19
+// https://datatracker.ietf.org/doc/html/rfc9221 unreliable datagram extension
+
+import (
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+const (
+	frameTypePadding                    = 0x00
+	frameTypePing                       = 0x01
+	frameTypeACK                        = 0x02
+	frameTypeACKECN                     = 0x03
+	frameTypeResetStream                = 0x04
+	frameTypeStopSending                = 0x05
+	frameTypeCrypto                     = 0x06
+	frameTypeNewToken                   = 0x07
+	frameTypeStream                     = 0x08
+	frameTypeStreamLast                 = 0x0f
+	frameTypeMaxData                    = 0x10
+	frameTypeMaxStreamData              = 0x11
+	frameTypeMaxStreamsBidi             = 0x12
+	frameTypeMaxStreamsUni              = 0x13
+	frameTypeDataBlocked                = 0x14
+	frameTypeStreamDataBlocked          = 0x15
+	frameTypeStreamsBlockedBidi         = 0x16
+	frameTypeStreamsBlockedUni          = 0x17
+	frameTypeNewConnectionID            = 0x18
+	frameTypeRetireConnectionID         = 0x19
+	frameTypePathChallenge              = 0x1a
+	frameTypePathResponse               = 0x1b
+	frameTypeConnectionClose            = 0x1c
+	frameTypeConnectionCloseApplication = 0x1d
+	frameTypeHandshakeDone              = 0x1e
+	frameTypeDatagram                   = 0x30
+	frameTypeDatagramWithLength         = 0x31
+	streamFlagOffset                    = 0x04
+	streamFlagLength                    = 0x02
+	statelessResetTokenLen              = 16
+	pathChallengeDataLen                = 8
+	transportErrorCryptoErrorFirst      = 0x0100
+	transportErrorCryptoErrorLast       = 0x01ff
+)
+
+var frameTypeNames = scalar.UToSymStr{
+	frameTypePadding:                    "padding",
+	frameTypePing:                       "ping",
+	frameTypeACK:                        "ack",
+	frameTypeACKECN:                     "ack_ecn",
+	frameTypeResetStream:                "reset_stream",
+	frameTypeStopSending:                "stop_sending",
+	frameTypeCrypto:                     "crypto",
+	frameTypeNewToken:                   "new_token",
+	0x08:                                "stream",
+	0x09:                                "stream_fin",
+	0x0a:                                "stream_len",
+	0x0b:                                "stream_len_fin",
+	0x0c:                                "stream_off",
+	0x0d:                                "stream_off_fin",
+	0x0e:                                "stream_off_len",
+	0x0f:                                "stream_off_len_fin",
+	frameTypeMaxData:                    "max_data",
+	frameTypeMaxStreamData:              "max_stream_data",
+	frameTypeMaxStreamsBidi:             "max_streams_bidi",
+	frameTypeMaxStreamsUni:              "max_streams_uni",
+	frameTypeDataBlocked:                "data_blocked",
+	frameTypeStreamDataBlocked:          "stream_data_blocked",
+	frameTypeStreamsBlockedBidi:         "streams_blocked_bidi",
+	frameTypeStreamsBlockedUni:          "streams_blocked_uni",
+	frameTypeNewConnectionID:            "new_connection_id",
+	frameTypeRetireConnectionID:         "retire_connection_id",
+	frameTypePathChallenge:              "path_challenge",
+	frameTypePathResponse:               "path_response",
+	frameTypeConnectionClose:            "connection_close",
+	frameTypeConnectionCloseApplication: "connection_close_application",
+	frameTypeHandshakeDone:              "handshake_done",
+	frameTypeDatagram:                   "datagram",
+	frameTypeDatagramWithLength:         "datagram_len",
+}
+
+var transportErrorNames = scalar.UToSymStr{
+	0x00: "no_error",
+	0x01: "internal_error",
+	0x02: "connection_refused",
+	0x03: "flow_control_error",
+	0x04: "stream_limit_error",
+	0x05: "stream_state_error",
+	0x06: "final_size_error",
+	0x07: "frame_encoding_error",
+	0x08: "transport_parameter_error",
+	0x09: "connection_id_limit_error",
+	0x0a: "protocol_violation",
+	0x0b: "invalid_token",
+	0x0c: "application_error",
+	0x0d: "crypto_buffer_exceeded",
+	0x0e: "key_update_error",
+	0x0f: "aead_limit_reached",
+	0x10: "no_viable_path",
+}
+
+// crypto_error is 0x100 plus TLS alert
+var transportCryptoErrorNames = scalar.URangeToScalar{
+	{transportErrorCryptoErrorFirst, transportErrorCryptoErrorLast}: {Sym: "crypto_error"},
+}
+
+func decodeFrame(d *decode.D) {
+	typ := d.FieldUFn("type", varint, frameTypeNames, scalar.Hex)
+
+	switch {
+	case typ == frameTypePadding:
+		// consecutive padding frames are one zero byte each, decode as one run
+		n := 0
+		for _, b := range d.PeekBytes(int(d.BitsLeft() / 8)) {
+			if b != frameTypePadding {
+				break
+			}
+			n++
+		}
+		if n > 0 {
+			d.FieldRawLen("padding", int64(n)*8)
+		}
+	case typ == frameTypePing,
+		typ == frameTypeHandshakeDone:
+		// no fields
+	case typ == frameTypeACK,
+		typ == frameTypeACKECN:
+		d.FieldUFn("largest_acknowledged", varint)
+		d.FieldUFn("ack_delay", varint)
+		ackRangeCount := d.FieldUFn("ack_range_count", varint)
+		d.FieldUFn("first_ack_range", varint)
+		d.FieldArray("ack_ranges", func(d *decode.D) {
+			for i := uint64(0); i < ackRangeCount; i++ {
+				d.FieldStruct("ack_range", func(d *decode.D) {
+					d.FieldUFn("gap", varint)
+					d.FieldUFn("ack_range_length", varint)
+				})
+			}
+		})
+		if typ == frameTypeACKECN {
+			d.FieldStruct("ecn_counts", func(d *decode.D) {
+				d.FieldUFn("ect0_count", varint)
+				d.FieldUFn("ect1_count", varint)
+				d.FieldUFn("ecn_ce_count", varint)
+			})
+		}
+	case typ == frameTypeResetStream:
+		d.FieldUFn("stream_id", varint)
+		d.FieldUFn("application_protocol_error_code", varint)
+		d.FieldUFn("final_size", varint)
+	case typ == frameTypeStopSending:
+		d.FieldUFn("stream_id", varint)
+		d.FieldUFn("application_protocol_error_code", varint)
+	case typ == frameTypeCrypto:
+		d.FieldUFn("offset", varint)
+		length := d.FieldUFn("length", varint)
+		d.FieldRawLen("crypto_data", int64(length)*8)
+	case typ == frameTypeNewToken:
+		length := d.FieldUFn("token_length", varint)
+		d.FieldRawLen("token", int64(length)*8)
+	case typ >= frameTypeStream && typ <= frameTypeStreamLast:
+		d.FieldUFn("stream_id", varint)
+		if typ&streamFlagOffset != 0 {
+			d.FieldUFn("offset", varint)
+		}
+		// without length stream data extends to end of packet
+		length := uint64(d.BitsLeft() / 8)
+		if typ&streamFlagLength != 0 {
+			length = d.FieldUFn("length", varint)
+		}
+		d.FieldRawLen("stream_data", int64(length)*8)
+	case typ == frameTypeMaxData,
+		typ == frameTypeDataBlocked:
+		d.FieldUFn("maximum_data", varint)
+	case typ == frameTypeMaxStreamData,
+		typ == frameTypeStreamDataBlocked:
+		d.FieldUFn("stream_id", varint)
+		d.FieldUFn("maximum_stream_data", varint)
+	case typ == frameTypeMaxStreamsBidi,
+		typ == frameTypeMaxStreamsUni,
+		typ == frameTypeStreamsBlockedBidi,
+		typ == frameTypeStreamsBlockedUni:
+		d.FieldUFn("maximum_streams", varint)
+	case typ == frameTypeNewConnectionID:
+		d.FieldUFn("sequence_number", varint)
+		d.FieldUFn("retire_prior_to", varint)
+		length := d.FieldU8("length")
+		d.FieldRawLen("connection_id", int64(length)*8)
+		d.FieldRawLen("stateless_reset_token", statelessResetTokenLen*8)
+	case typ == frameTypeRetireConnectionID:
+		d.FieldUFn("sequence_number", varint)
+	case typ == frameTypePathChallenge,
+		typ == frameTypePathResponse:
+		d.FieldRawLen("data", pathChallengeDataLen*8)
+	case typ == frameTypeConnectionClose:
+		d.FieldUFn("error_code", varint, transportErrorNames, transportCryptoErrorNames)
+		d.FieldUFn("frame_type", varint, frameTypeNames, scalar.Hex)
+		length := d.FieldUFn("reason_phrase_length", varint)
+		d.FieldUTF8("reason_phrase", int(length))
+	case typ == frameTypeConnectionCloseApplication:
+		d.FieldUFn("error_code", varint)
+		length := d.FieldUFn("reason_phrase_length", varint)
+		d.FieldUTF8("reason_phrase", int(length))
+	case typ == frameTypeDatagram,
+		typ == frameTypeDatagramWithLength:
+		length := uint64(d.BitsLeft() / 8)
+		if typ == frameTypeDatagramWithLength {
+			length = d.FieldUFn("length", varint)
+		}
+		d.FieldRawLen("data", int64(length)*8)
+	default:
+		// unknown frame type, length is not known so rest of packet
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+}
@@ -0,0 +1,129 @@
+package quic
+
+// https://datatracker.ietf.org/doc/html/rfc9001#section-5
+// https://datatracker.ietf.org/doc/html/rfc9369#section-3.3
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+)
+
+var (
+	initialSaltV1 = []byte{
+		0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17,
+		0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a,
+	}
+	initialSaltV2 = []byte{
+		0x0d, 0xed, 0xe3, 0xde, 0xf7, 0x00, 0xa6, 0xdb, 0x81, 0x93,
+		0x81, 0xbe, 0x6e, 0x26, 0x9d, 0xcb, 0xf9, 0xbd, 0x2e, 0xd9,
+	}
+)
+
+const (
+	hpSampleLen    = 16
+	maxPacketNrLen = 4
+)
+
+func hkdfExtract(salt []byte, secret []byte) []byte {
+	h := hmac.New(sha256.New, salt)
+	h.Write(secret)
+	return h.Sum(nil)
+}
+
+// TLS 1.3 HKDF-Expand-Label with empty context, length is at most one hash
+func hkdfExpandLabel(secret []byte, label string, length int) []byte {
+	label = "tls13 " + label
+	info := make([]byte, 0, 2+1+len(label)+1+1)
+	info = append(info, byte(length>>8), byte(length))
+	info = append(info, byte(len(label)))
+	info = append(info, label...)
+	info = append(info, 0)
+	info = append(info, 1)
+	h := hmac.New(sha256.New, secret)
+	h.Write(info)
+	return h.Sum(nil)[:length]
+}
+
+type initialKeys struct {
+	aead cipher.AEAD
+	iv   []byte
+	hp   cipher.Block
+}
+
+// keys protecting client initial packets, derived from the destination
+// connection id the client choose for its first initial packet
+func newClientInitialKeys(version uint64, dcid []byte) (initialKeys, bool) {
+	salt := initialSaltV1
+	labelPrefix := "quic"
+	switch version {
+	case versionV1:
+	case versionV2:
+		salt = initialSaltV2
+		labelPrefix = "quicv2"
+	default:
+		return initialKeys{}, false
+	}
+
+	initialSecret := hkdfExtract(salt, dcid)
+	clientSecret := hkdfExpandLabel(initialSecret, "client in", 32)
+	key := hkdfExpandLabel(clientSecret, labelPrefix+" key", 16)
+	iv := hkdfExpandLabel(clientSecret, labelPrefix+" iv", 12)
+	hpKey := hkdfExpandLabel(clientSecret, labelPrefix+" hp", 16)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return initialKeys{}, false
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return initialKeys{}, false
+	}
+	hp, err := aes.NewCipher(hpKey)
+	if err != nil {
+		return initialKeys{}, false
+	}
+
+	return initialKeys{aead: aead, iv: iv, hp: hp}, true
+}
+
+// unprotect long header packet, header is everything up to packet number and
+// protected is packet number and payload. Returns unprotected first byte,
+// packet number bytes and plaintext payload.
+func (k initialKeys) unprotect(header []byte, protected []byte) (byte, []byte, []byte, bool) {
+	if len(header) == 0 || len(protected) < maxPacketNrLen+hpSampleLen {
+		return 0, nil, nil, false
+	}
+
+	mask := make([]byte, aes.BlockSize)
+	k.hp.Encrypt(mask, protected[maxPacketNrLen:maxPacketNrLen+hpSampleLen])
+
+	firstByte := header[0] ^ mask[0]&0x0f
+	pnLen := int(firstByte&0x3) + 1
+	pnBytes := make([]byte, pnLen)
+	var pn uint64
+	for i := range pnBytes {
+		pnBytes[i] = protected[i] ^ mask[1+i]
+		pn = pn<<8 | uint64(pnBytes[i])
+	}
+
+	aad := make([]byte, 0, len(header)+pnLen)
+	aad = append(aad, firstByte)
+	aad = append(aad, header[1:]...)
+	aad = append(aad, pnBytes...)
+
+	// truncated packet number is used as is, initial packet numbers are small
+	nonce := make([]byte, len(k.iv))
+	copy(nonce, k.iv)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(pn >> (8 * i))
+	}
+
+	plaintext, err := k.aead.Open(nil, nonce, protected[pnLen:], aad)
+	if err != nil {
+		return 0, nil, nil, false
+	}
+
+	return firstByte, pnBytes, plaintext, true
+}
@@ -0,0 +1,238 @@
+package quic
+
+// https://datatracker.ietf.org/doc/html/rfc9000
+// https://datatracker.ietf.org/doc/html/rfc9001
+// https://datatracker.ietf.org/doc/html/rfc9369 QUIC version 2
+
+// TODO: server initial packets use keys from the client's original destination
+// connection id, needs state across datagrams
+// TODO: decode crypto frame data as TLS handshake messages
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.QUIC,
+		Description: "QUIC packets",
+		Groups:      []string{format.UDP_PAYLOAD},
+		DecodeFn:    quicDecode,
+	})
+}
+
+const (
+	versionNegotiation = 0x00000000
+	versionV1          = 0x00000001
+	versionV2          = 0x6b3343cf
+)
+
+var versionNames = scalar.UToSymStr{
+	versionNegotiation: "version_negotiation",
+	versionV1:          "v1",
+	versionV2:          "v2",
+	0xff00001d:         "draft_29",
+}
+
+const (
+	packetTypeInitial = iota
+	packetType0RTT
+	packetTypeHandshake
+	packetTypeRetry
+)
+
+// long packet type bits differ between versions
+var (
+	packetTypesV1 = map[uint64]int{
+		0b00: packetTypeInitial,
+		0b01: packetType0RTT,
+		0b10: packetTypeHandshake,
+		0b11: packetTypeRetry,
+	}
+	packetTypesV2 = map[uint64]int{
+		0b01: packetTypeInitial,
+		0b10: packetType0RTT,
+		0b11: packetTypeHandshake,
+		0b00: packetTypeRetry,
+	}
+	packetTypeNamesV1 = scalar.UToSymStr{
+		0b00: "initial",
+		0b01: "0rtt",
+		0b10: "handshake",
+		0b11: "retry",
+	}
+	packetTypeNamesV2 = scalar.UToSymStr{
+		0b01: "initial",
+		0b10: "0rtt",
+		0b11: "handshake",
+		0b00: "retry",
+	}
+)
+
+var headerFormNames = scalar.UToSymStr{
+	0: "short",
+	1: "long",
+}
+
+const retryIntegrityTagLen = 16
+
+// variable-length integer, two most significant bits is length as 1, 2, 4 or 8 bytes
+func varint(d *decode.D) uint64 {
+	n := 1 << d.U2()
+	return d.U(n*8 - 2)
+}
+
+// version is known if it could be a long header packet
+func knownVersion(v uint64) bool {
+	_, ok := versionNames[v]
+	return ok || v&0xffffff00 == 0xff000000
+}
+
+func decodeLongHeaderPacket(d *decode.D) {
+	start := d.Pos()
+	version := d.PeekBits(5*8) & 0xffffffff
+
+	d.FieldU1("header_form", headerFormNames)
+	if version == versionNegotiation {
+		d.FieldU7("unused")
+		d.FieldU32("version", versionNames, scalar.Hex)
+		dcidLength := d.FieldU8("destination_connection_id_length")
+		d.FieldRawLen("destination_connection_id", int64(dcidLength)*8)
+		scidLength := d.FieldU8("source_connection_id_length")
+		d.FieldRawLen("source_connection_id", int64(scidLength)*8)
+		d.FieldArray("supported_versions", func(d *decode.D) {
+			for d.NotEnd() {
+				d.FieldU32("version", versionNames, scalar.Hex)
+			}
+		})
+		return
+	}
+
+	packetTypes := packetTypesV1
+	packetTypeNames := packetTypeNamesV1
+	if version == versionV2 {
+		packetTypes = packetTypesV2
+		packetTypeNames = packetTypeNamesV2
+	}
+
+	d.FieldBool("fixed_bit")
+	packetType := packetTypes[d.FieldU2("long_packet_type", packetTypeNames)]
+	// reserved bits and packet number length, protected except for retry
+	d.FieldU4("type_specific_bits")
+	d.FieldU32("version", versionNames, scalar.Hex)
+	dcidLength := d.FieldU8("destination_connection_id_length")
+	dcid := d.FieldRawLen("destination_connection_id", int64(dcidLength)*8)
+	scidLength := d.FieldU8("source_connection_id_length")
+	d.FieldRawLen("source_connection_id", int64(scidLength)*8)
+
+	switch packetType {
+	case packetTypeRetry:
+		d.FieldRawLen("retry_token", d.BitsLeft()-retryIntegrityTagLen*8)
+		d.FieldRawLen("retry_integrity_tag", retryIntegrityTagLen*8)
+		return
+	case packetTypeInitial:
+		tokenLength := d.FieldUFn("token_length", varint)
+		d.FieldRawLen("token", int64(tokenLength)*8)
+	}
+
+	length := d.FieldUFn("length", varint)
+	headerLen := int((d.Pos() - start) / 8)
+	header := d.BytesRange(start, headerLen)
+	protected := d.PeekBytes(int(length))
+	d.FieldRawLen("protected_payload", int64(length)*8)
+
+	if packetType != packetTypeInitial {
+		return
+	}
+	dcidBytes, err := dcid.Bytes()
+	if err != nil {
+		return
+	}
+	keys, ok := newClientInitialKeys(version, dcidBytes)
+	if !ok {
+		return
+	}
+	firstByte, pnBytes, plaintext, ok := keys.unprotect(header, protected)
+	if !ok {
+		return
+	}
+
+	b := append([]byte{firstByte}, pnBytes...)
+	b = append(b, plaintext...)
+	d.FieldStructRootBitBufFn("decrypted", bitio.NewBufferFromBytes(b, -1), func(d *decode.D) {
+		d.FieldU1("header_form", headerFormNames)
+		d.FieldBool("fixed_bit")
+		d.FieldU2("long_packet_type", packetTypeNames)
+		d.FieldU2("reserved_bits")
+		d.FieldU2("packet_number_length", scalar.UAdd(1))
+		d.FieldU("packet_number", len(pnBytes)*8)
+		d.FieldStructArrayLoop("frames", "frame", d.NotEnd, decodeFrame)
+	})
+}
+
+// destination connection id length is only known by the endpoints so rest of
+// the packet is protected payload
+func decodeShortHeaderPacket(d *decode.D) {
+	d.FieldU1("header_form", headerFormNames)
+	d.FieldBool("fixed_bit")
+	d.FieldBool("spin_bit")
+	// reserved bits, key phase and packet number length
+	d.FieldU5("protected_bits")
+	d.FieldRawLen("destination_connection_id_and_protected_payload", d.BitsLeft())
+}
+
+func quicDecode(d *decode.D, in interface{}) interface{} {
+	if d.BitsLeft() < 8 {
+		d.Fatalf("too short")
+	}
+	first := d.PeekBits(8)
+	isLong := first&0x80 != 0
+	if isLong {
+		if d.BitsLeft() < 5*8 {
+			d.Fatalf("too short")
+		}
+		version := d.PeekBits(5*8) & 0xffffffff
+		if !knownVersion(version) {
+			d.Fatalf("unknown version %x", version)
+		}
+		if version != versionNegotiation && first&0x40 == 0 {
+			d.Fatalf("fixed bit not set")
+		}
+	} else {
+		if first&0x40 == 0 {
+			d.Fatalf("fixed bit not set")
+		}
+		// short header packets has no version, only guess based on port
+		if udi, ok := in.(format.UDPDatagramIn); ok {
+			if udi.DestinationPort != format.UDPPortHTTPS && udi.SourcePort != format.UDPPortHTTPS {
+				d.Fatalf("short header packet on wrong port")
+			}
+		}
+	}
+
+	// a datagram can have coalesced long header packets and a last short header packet
+	d.FieldArray("packets", func(d *decode.D) {
+		for i := 0; d.NotEnd(); i++ {
+			// zero bytes or garbage after coalesced packets has no fixed bit
+			if i > 0 && d.PeekBits(8)&0x40 == 0 {
+				break
+			}
+			d.FieldStruct("packet", func(d *decode.D) {
+				if d.PeekBits(1) == 1 {
+					decodeLongHeaderPacket(d)
+				} else {
+					decodeShortHeaderPacket(d)
+				}
+			})
+		}
+	})
+	if d.NotEnd() {
+		d.FieldRawLen("padding", d.BitsLeft())
+	}
+
+	return nil
+}
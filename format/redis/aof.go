@@ -0,0 +1,87 @@
+package redis
+
+// https://redis.io/docs/manual/persistence/
+// https://redis.io/docs/reference/protocol-spec/
+
+// TODO: multi part AOF manifest
+
+import (
+	"strconv"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+)
+
+var rdbFormat decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.AOF,
+		Description: "Redis append only file",
+		DecodeFn:    aofDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.RDB}, Group: &rdbFormat},
+		},
+	})
+}
+
+// max length of a RESP line excluding bulk string data
+const maxLineLen = 64
+
+// reads a line terminated by CRLF and returns it without terminator
+func respLine(d *decode.D) string {
+	n := d.PeekFindByte('\n', maxLineLen)
+	if n < 1 || d.PeekBytes(int(n))[n-1] != '\r' {
+		d.Fatalf("line not terminated by CRLF")
+	}
+	s := d.UTF8(int(n) + 1)
+	return s[:len(s)-2]
+}
+
+// reads a RESP line like "*3" or "$5" with a prefix and decimal integer
+func respPrefixedU(prefix byte) func(d *decode.D) uint64 {
+	return func(d *decode.D) uint64 {
+		l := respLine(d)
+		if len(l) < 2 || l[0] != prefix {
+			d.Fatalf("expected %q line", prefix)
+		}
+		n, err := strconv.ParseUint(l[1:], 10, 64)
+		if err != nil {
+			d.Fatalf("invalid integer %q", l[1:])
+		}
+		return n
+	}
+}
+
+func decodeCommand(d *decode.D) {
+	// redis 7 timestamp annotations, "#TS:1628217470\r\n"
+	if d.PeekBits(8) == '#' {
+		d.FieldStrFn("annotation", respLine)
+		return
+	}
+
+	argc := d.FieldUFn("argument_count", respPrefixedU('*'))
+	d.FieldArray("arguments", func(d *decode.D) {
+		for i := uint64(0); i < argc; i++ {
+			d.FieldStruct("argument", func(d *decode.D) {
+				length := d.FieldUFn("length", respPrefixedU('$'))
+				fieldUTF8Length(d, "value", length)
+				d.FieldUTF8("terminator", 2, d.AssertStr("\r\n"))
+			})
+		}
+	})
+}
+
+func aofDecode(d *decode.D, in interface{}) interface{} {
+	// rewritten AOF files can start with an RDB snapshot
+	if d.TryHasBytes([]byte("REDIS")) {
+		d.FieldFormat("rdb_preamble", rdbFormat, nil)
+	} else if d.PeekBits(8) != '*' && d.PeekBits(8) != '#' {
+		d.Fatalf("not a RESP array or annotation")
+	}
+
+	d.FieldStructArrayLoop("commands", "command", d.NotEnd, decodeCommand)
+
+	return nil
+}
@@ -0,0 +1,562 @@
+package redis
+
+// https://github.com/redis/redis/blob/unstable/src/rdb.h
+// https://github.com/redis/redis/blob/unstable/src/rdb.c
+// https://github.com/sripathikrishnan/redis-rdb-tools/wiki/Redis-RDB-Dump-File-Format
+
+// TODO: module values (type 6 and 7 without module2 opcodes)
+// TODO: function pre GA format
+
+import (
+	"hash/crc64"
+	"strconv"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.RDB,
+		Description: "Redis database dump",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte("REDIS")}},
+		DecodeFn:    rdbDecode,
+	})
+}
+
+// latest known rdb version, redis 7.2
+const latestVersion = 11
+
+const (
+	typeString           = 0
+	typeList             = 1
+	typeSet              = 2
+	typeZSet             = 3
+	typeHash             = 4
+	typeZSet2            = 5
+	typeModule2          = 7
+	typeHashZipmap       = 9
+	typeListZiplist      = 10
+	typeSetIntset        = 11
+	typeZSetZiplist      = 12
+	typeHashZiplist      = 13
+	typeListQuicklist    = 14
+	typeStreamListpacks  = 15
+	typeHashListpack     = 16
+	typeZSetListpack     = 17
+	typeListQuicklist2   = 18
+	typeStreamListpacks2 = 19
+	typeSetListpack      = 20
+	typeStreamListpacks3 = 21
+
+	opcodeFunction2    = 0xf5
+	opcodeFunction     = 0xf6
+	opcodeModuleAux    = 0xf7
+	opcodeIdle         = 0xf8
+	opcodeFreq         = 0xf9
+	opcodeAux          = 0xfa
+	opcodeResizeDB     = 0xfb
+	opcodeExpireTimeMS = 0xfc
+	opcodeExpireTime   = 0xfd
+	opcodeSelectDB     = 0xfe
+	opcodeEOF          = 0xff
+)
+
+var typeNames = scalar.UToSymStr{
+	typeString:           "string",
+	typeList:             "list",
+	typeSet:              "set",
+	typeZSet:             "zset",
+	typeHash:             "hash",
+	typeZSet2:            "zset_2",
+	6:                    "module",
+	typeModule2:          "module_2",
+	typeHashZipmap:       "hash_zipmap",
+	typeListZiplist:      "list_ziplist",
+	typeSetIntset:        "set_intset",
+	typeZSetZiplist:      "zset_ziplist",
+	typeHashZiplist:      "hash_ziplist",
+	typeListQuicklist:    "list_quicklist",
+	typeStreamListpacks:  "stream_listpacks",
+	typeHashListpack:     "hash_listpack",
+	typeZSetListpack:     "zset_listpack",
+	typeListQuicklist2:   "list_quicklist_2",
+	typeStreamListpacks2: "stream_listpacks_2",
+	typeSetListpack:      "set_listpack",
+	typeStreamListpacks3: "stream_listpacks_3",
+	opcodeFunction2:      "function2",
+	opcodeFunction:       "function",
+	opcodeModuleAux:      "module_aux",
+	opcodeIdle:           "idle",
+	opcodeFreq:           "freq",
+	opcodeAux:            "aux",
+	opcodeResizeDB:       "resizedb",
+	opcodeExpireTimeMS:   "expiretime_ms",
+	opcodeExpireTime:     "expiretime",
+	opcodeSelectDB:       "selectdb",
+	opcodeEOF:            "eof",
+}
+
+const (
+	lengthEnc6Bit    = 0
+	lengthEnc14Bit   = 1
+	lengthEncLarge   = 2
+	lengthEncSpecial = 3
+
+	lengthLarge32Bit = 0x00
+	lengthLarge64Bit = 0x01
+)
+
+var lengthEncodingNames = scalar.UToSymStr{
+	lengthEnc6Bit:    "6bit",
+	lengthEnc14Bit:   "14bit",
+	lengthEncLarge:   "large",
+	lengthEncSpecial: "special",
+}
+
+const (
+	stringEncInt8  = 0
+	stringEncInt16 = 1
+	stringEncInt32 = 2
+	stringEncLZF   = 3
+)
+
+var stringEncodingNames = scalar.UToSymStr{
+	stringEncInt8:  "int8",
+	stringEncInt16: "int16",
+	stringEncInt32: "int32",
+	stringEncLZF:   "lzf",
+}
+
+const (
+	quicklistContainerPlain  = 1
+	quicklistContainerPacked = 2
+)
+
+var quicklistContainerNames = scalar.UToSymStr{
+	quicklistContainerPlain:  "plain",
+	quicklistContainerPacked: "packed",
+}
+
+const (
+	moduleOpcodeEOF    = 0
+	moduleOpcodeSInt   = 1
+	moduleOpcodeUInt   = 2
+	moduleOpcodeFloat  = 3
+	moduleOpcodeDouble = 4
+	moduleOpcodeString = 5
+)
+
+var moduleOpcodeNames = scalar.UToSymStr{
+	moduleOpcodeEOF:    "eof",
+	moduleOpcodeSInt:   "sint",
+	moduleOpcodeUInt:   "uint",
+	moduleOpcodeFloat:  "float",
+	moduleOpcodeDouble: "double",
+	moduleOpcodeString: "string",
+}
+
+// CRC-64/Jones as used by redis, reflected polynomial with zero init and xorout
+var crc64JonesTable = crc64.MakeTable(0x95ac9329ac4bc9b5)
+
+func unixTime(unit time.Duration) scalar.Mapper {
+	return scalar.Fn(func(s scalar.S) (scalar.S, error) {
+		uv, ok := s.Actual.(uint64)
+		if !ok {
+			return s, nil
+		}
+		s.Description = time.Unix(0, 0).Add(unit * time.Duration(uv)).UTC().Format(time.RFC3339)
+		return s, nil
+	})
+}
+
+func crc64Jones(b []byte) uint64 {
+	return ^crc64.Update(^uint64(0), crc64JonesTable, b)
+}
+
+// decodes length encoded integer, special encodings are not allowed
+func lengthU(d *decode.D) uint64 {
+	switch d.U2() {
+	case lengthEnc6Bit:
+		return d.U6()
+	case lengthEnc14Bit:
+		return d.U14()
+	case lengthEncLarge:
+		switch d.U6() {
+		case lengthLarge32Bit:
+			return d.U32()
+		case lengthLarge64Bit:
+			return d.U64()
+		default:
+			d.Fatalf("unknown large length encoding")
+		}
+	default:
+		d.Fatalf("unexpected special length encoding")
+	}
+	panic("unreachable")
+}
+
+func fieldLength(d *decode.D, name string, sms ...scalar.Mapper) uint64 {
+	return d.FieldUFn(name, lengthU, sms...)
+}
+
+// length is from input so check it fits before reading
+func fieldUTF8Length(d *decode.D, name string, length uint64) string {
+	if length > uint64(d.BitsLeft()/8) {
+		d.Fatalf("%s length %d larger than input", name, length)
+	}
+	return d.FieldUTF8(name, int(length))
+}
+
+// https://github.com/ning/compress/wiki/LZFFormat
+func lzfDecompress(d *decode.D, in []byte, uncompressedLen int) []byte {
+	// uncompressed length is from input so don't trust it for preallocation,
+	// a back reference can at most expand 3 bytes into 264
+	outCap := uncompressedLen
+	if maxLen := len(in) * 88; outCap < 0 || outCap > maxLen {
+		outCap = maxLen
+	}
+	out := make([]byte, 0, outCap)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 1<<5 {
+			// literal run
+			n := ctrl + 1
+			if i+n > len(in) {
+				d.Fatalf("lzf: literal run outside input")
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+		// back reference
+		n := ctrl >> 5
+		if n == 7 {
+			if i >= len(in) {
+				d.Fatalf("lzf: truncated back reference")
+			}
+			n += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			d.Fatalf("lzf: truncated back reference")
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		if ref < 0 {
+			d.Fatalf("lzf: back reference before start")
+		}
+		for j := 0; j < n+2; j++ {
+			out = append(out, out[ref+j])
+		}
+		if len(out) > uncompressedLen {
+			d.Fatalf("lzf: uncompressed length larger than expected %d", uncompressedLen)
+		}
+	}
+	if len(out) != uncompressedLen {
+		d.Fatalf("lzf: uncompressed length %d, expected %d", len(out), uncompressedLen)
+	}
+	return out
+}
+
+// decodes a string, fn is used to decode the string content if not nil
+func decodeString(d *decode.D, fn func(d *decode.D)) {
+	if d.PeekBits(2) != lengthEncSpecial {
+		length := fieldLength(d, "length")
+		if fn != nil {
+			d.FieldStruct("value", func(d *decode.D) {
+				d.LenFn(int64(length)*8, fn)
+			})
+			return
+		}
+		fieldUTF8Length(d, "value", length)
+		return
+	}
+
+	d.FieldU2("length_encoding", lengthEncodingNames)
+	switch d.FieldU6("encoding", stringEncodingNames) {
+	case stringEncInt8:
+		d.FieldS8("value")
+	case stringEncInt16:
+		d.FieldS16LE("value")
+	case stringEncInt32:
+		d.FieldS32LE("value")
+	case stringEncLZF:
+		compressedLen := fieldLength(d, "compressed_length")
+		uncompressedLen := fieldLength(d, "uncompressed_length")
+		if compressedLen > uint64(d.BitsLeft()/8) {
+			d.Fatalf("compressed length %d larger than input", compressedLen)
+		}
+		compressed := d.BytesRange(d.Pos(), int(compressedLen))
+		d.FieldRawLen("compressed", int64(compressedLen)*8)
+		uncompressed := lzfDecompress(d, compressed, int(uncompressedLen))
+		bb := bitio.NewBufferFromBytes(uncompressed, -1)
+		if fn != nil {
+			d.FieldStructRootBitBufFn("value", bb, fn)
+		} else {
+			d.FieldRootBitBuf("value", bb)
+		}
+	default:
+		d.Fatalf("unknown string encoding")
+	}
+}
+
+func fieldString(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) { decodeString(d, nil) })
+}
+
+func fieldStringFn(d *decode.D, name string, fn func(d *decode.D)) {
+	d.FieldStruct(name, func(d *decode.D) { decodeString(d, fn) })
+}
+
+func fieldStrings(d *decode.D, name string, elementName string, n uint64) {
+	d.FieldArray(name, func(d *decode.D) {
+		for i := uint64(0); i < n; i++ {
+			fieldString(d, elementName)
+		}
+	})
+}
+
+// double as length prefixed string, 253-255 are nan, +inf and -inf
+func decodeStringDouble(d *decode.D) {
+	d.FieldStruct("score", func(d *decode.D) {
+		length := d.FieldU8("length", scalar.UToScalar{
+			253: {Sym: "nan"},
+			254: {Sym: "+inf"},
+			255: {Sym: "-inf"},
+		})
+		if length < 253 {
+			d.FieldStrFn("value", func(d *decode.D) string { return d.UTF8(int(length)) })
+		}
+	})
+}
+
+func decodeStream(d *decode.D, typ uint64) {
+	n := fieldLength(d, "listpacks_count")
+	d.FieldArray("listpacks", func(d *decode.D) {
+		for i := uint64(0); i < n; i++ {
+			d.FieldStruct("listpack", func(d *decode.D) {
+				// master entry id, 64 bit milliseconds and sequence number big endian
+				fieldStringFn(d, "master_id", func(d *decode.D) {
+					d.FieldU64BE("ms")
+					d.FieldU64BE("seq")
+				})
+				fieldStringFn(d, "entries", decodeListpack)
+			})
+		}
+	})
+	fieldLength(d, "length")
+	fieldLength(d, "last_id_ms")
+	fieldLength(d, "last_id_seq")
+	if typ >= typeStreamListpacks2 {
+		fieldLength(d, "first_id_ms")
+		fieldLength(d, "first_id_seq")
+		fieldLength(d, "max_deleted_id_ms")
+		fieldLength(d, "max_deleted_id_seq")
+		fieldLength(d, "entries_added")
+	}
+
+	cgroupsCount := fieldLength(d, "consumer_groups_count")
+	d.FieldArray("consumer_groups", func(d *decode.D) {
+		for i := uint64(0); i < cgroupsCount; i++ {
+			d.FieldStruct("consumer_group", func(d *decode.D) {
+				fieldString(d, "name")
+				fieldLength(d, "last_id_ms")
+				fieldLength(d, "last_id_seq")
+				if typ >= typeStreamListpacks2 {
+					fieldLength(d, "entries_read")
+				}
+
+				pelCount := fieldLength(d, "pel_count")
+				d.FieldArray("pel", func(d *decode.D) {
+					for i := uint64(0); i < pelCount; i++ {
+						d.FieldStruct("entry", func(d *decode.D) {
+							d.FieldU64BE("id_ms")
+							d.FieldU64BE("id_seq")
+							d.FieldU64LE("delivery_time", unixTime(time.Millisecond))
+							fieldLength(d, "delivery_count")
+						})
+					}
+				})
+
+				consumersCount := fieldLength(d, "consumers_count")
+				d.FieldArray("consumers", func(d *decode.D) {
+					for i := uint64(0); i < consumersCount; i++ {
+						d.FieldStruct("consumer", func(d *decode.D) {
+							fieldString(d, "name")
+							d.FieldU64LE("seen_time", unixTime(time.Millisecond))
+							if typ >= typeStreamListpacks3 {
+								d.FieldU64LE("active_time", unixTime(time.Millisecond))
+							}
+							pelCount := fieldLength(d, "pel_count")
+							d.FieldArray("pel", func(d *decode.D) {
+								for i := uint64(0); i < pelCount; i++ {
+									d.FieldStruct("entry", func(d *decode.D) {
+										d.FieldU64BE("id_ms")
+										d.FieldU64BE("id_seq")
+									})
+								}
+							})
+						})
+					}
+				})
+			})
+		}
+	})
+}
+
+func decodeModule2(d *decode.D) {
+	fieldLength(d, "module_id", scalar.Hex)
+	d.FieldStructArrayLoop("values", "value", func() bool { return d.PeekBits(8) != moduleOpcodeEOF }, func(d *decode.D) {
+		switch fieldLength(d, "opcode", moduleOpcodeNames) {
+		case moduleOpcodeSInt, moduleOpcodeUInt:
+			fieldLength(d, "value")
+		case moduleOpcodeFloat:
+			d.FieldF32LE("value")
+		case moduleOpcodeDouble:
+			d.FieldF64LE("value")
+		case moduleOpcodeString:
+			fieldString(d, "value")
+		default:
+			d.Fatalf("unknown module opcode")
+		}
+	})
+	fieldLength(d, "eof", moduleOpcodeNames, d.AssertU(moduleOpcodeEOF))
+}
+
+func decodeValue(d *decode.D, typ uint64) {
+	switch typ {
+	case typeString:
+		fieldString(d, "value")
+	case typeList, typeSet:
+		n := fieldLength(d, "length")
+		fieldStrings(d, "elements", "element", n)
+	case typeZSet, typeZSet2:
+		n := fieldLength(d, "length")
+		d.FieldArray("elements", func(d *decode.D) {
+			for i := uint64(0); i < n; i++ {
+				d.FieldStruct("element", func(d *decode.D) {
+					fieldString(d, "member")
+					if typ == typeZSet {
+						decodeStringDouble(d)
+					} else {
+						d.FieldF64LE("score")
+					}
+				})
+			}
+		})
+	case typeHash:
+		n := fieldLength(d, "length")
+		d.FieldArray("fields", func(d *decode.D) {
+			for i := uint64(0); i < n; i++ {
+				d.FieldStruct("field", func(d *decode.D) {
+					fieldString(d, "field")
+					fieldString(d, "value")
+				})
+			}
+		})
+	case typeModule2:
+		decodeModule2(d)
+	case typeHashZipmap:
+		fieldString(d, "zipmap")
+		d.FieldWarnf("zipmap", decode.WarningDeprecated, "zipmap encoding is deprecated since redis 2.6")
+	case typeListZiplist, typeZSetZiplist, typeHashZiplist:
+		fieldStringFn(d, "ziplist", decodeZiplist)
+	case typeSetIntset:
+		fieldStringFn(d, "intset", decodeIntset)
+	case typeListQuicklist:
+		n := fieldLength(d, "length")
+		d.FieldArray("ziplists", func(d *decode.D) {
+			for i := uint64(0); i < n; i++ {
+				fieldStringFn(d, "ziplist", decodeZiplist)
+			}
+		})
+	case typeListQuicklist2:
+		n := fieldLength(d, "length")
+		d.FieldArray("nodes", func(d *decode.D) {
+			for i := uint64(0); i < n; i++ {
+				d.FieldStruct("node", func(d *decode.D) {
+					container := fieldLength(d, "container", quicklistContainerNames)
+					if container == quicklistContainerPacked {
+						fieldStringFn(d, "listpack", decodeListpack)
+					} else {
+						fieldString(d, "value")
+					}
+				})
+			}
+		})
+	case typeHashListpack, typeZSetListpack, typeSetListpack:
+		fieldStringFn(d, "listpack", decodeListpack)
+	case typeStreamListpacks, typeStreamListpacks2, typeStreamListpacks3:
+		decodeStream(d, typ)
+	default:
+		d.Fatalf("unknown value type %d", typ)
+	}
+}
+
+func rdbDecode(d *decode.D, in interface{}) interface{} {
+	d.FieldUTF8("magic", 5, d.AssertStr("REDIS"))
+	versionStr := d.FieldUTF8("version", 4)
+	version, err := strconv.Atoi(versionStr)
+	if err != nil {
+		d.Fatalf("invalid version %q", versionStr)
+	}
+	if version > latestVersion {
+		d.FieldWarnf("version", decode.WarningUnknownVersion, "version %d newer than latest known %d", version, latestVersion)
+	}
+
+	start := d.Pos()
+	seenEOF := false
+	d.FieldStructArrayLoop("records", "record", func() bool { return !seenEOF }, func(d *decode.D) {
+		typ := d.FieldU8("type", typeNames)
+		switch typ {
+		case opcodeEOF:
+			seenEOF = true
+		case opcodeSelectDB:
+			fieldLength(d, "db_number")
+		case opcodeResizeDB:
+			fieldLength(d, "db_size")
+			fieldLength(d, "expires_size")
+		case opcodeExpireTime:
+			d.FieldU32LE("expire_time", unixTime(time.Second))
+		case opcodeExpireTimeMS:
+			d.FieldU64LE("expire_time", unixTime(time.Millisecond))
+		case opcodeAux:
+			fieldString(d, "key")
+			fieldString(d, "value")
+		case opcodeFreq:
+			d.FieldU8("lfu_freq")
+		case opcodeIdle:
+			fieldLength(d, "lru_idle")
+		case opcodeModuleAux:
+			decodeModule2(d)
+		case opcodeFunction2:
+			fieldString(d, "code")
+		default:
+			if _, ok := typeNames[typ]; !ok || typ >= opcodeFunction || typ == 6 {
+				d.Fatalf("unsupported type %d", typ)
+			}
+			fieldString(d, "key")
+			decodeValue(d, typ)
+		}
+	})
+
+	if version >= 5 && d.BitsLeft() >= 64 {
+		crc := crc64Jones(d.BytesRange(start-9*8, int((d.Pos()-start)/8)+9))
+		// zero checksum means checksumming was disabled when saving
+		if d.PeekBits(64) == 0 {
+			d.FieldU64LE("checksum", scalar.Description("disabled"), scalar.Hex)
+		} else {
+			d.FieldU64LE("checksum", scalar.Hex)
+			d.ValueChecksumU(d.FieldMustGet("checksum"), "crc64", crc)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package redis
+
+// https://github.com/redis/redis/blob/unstable/src/ziplist.c
+// https://github.com/redis/redis/blob/unstable/src/listpack.c
+// https://github.com/redis/redis/blob/unstable/src/intset.c
+
+import (
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+const listEnd = 0xff
+
+const ziplistPrevLenBig = 0xfe
+
+var intsetEncodingNames = scalar.UToSymStr{
+	2: "int16",
+	4: "int32",
+	8: "int64",
+}
+
+func decodeIntset(d *decode.D) {
+	d.Endian = decode.LittleEndian
+
+	encoding := d.FieldU32("encoding", intsetEncodingNames)
+	switch encoding {
+	case 2, 4, 8:
+	default:
+		d.Fatalf("unknown intset encoding %d", encoding)
+	}
+	length := d.FieldU32("length")
+	d.FieldArray("contents", func(d *decode.D) {
+		for i := uint64(0); i < length; i++ {
+			d.FieldS("element", int(encoding)*8)
+		}
+	})
+}
+
+// ziplist entry encodings that use the whole first byte
+var ziplistEncodingNames = scalar.URangeToScalar{
+	{0x80, 0x80}: {Sym: "str_32bit"},
+	{0xc0, 0xc0}: {Sym: "int16"},
+	{0xd0, 0xd0}: {Sym: "int32"},
+	{0xe0, 0xe0}: {Sym: "int64"},
+	{0xf0, 0xf0}: {Sym: "int24"},
+	{0xfe, 0xfe}: {Sym: "int8"},
+	{0xf1, 0xfd}: {Sym: "int4"},
+}
+
+func decodeZiplistEntry(d *decode.D) {
+	d.FieldUFn("prevlen", func(d *decode.D) uint64 {
+		if d.PeekBits(8) == ziplistPrevLenBig {
+			d.U8()
+			return d.U32()
+		}
+		return d.U8()
+	})
+
+	encoding := d.PeekBits(8)
+	switch {
+	case encoding>>6 == 0:
+		d.FieldU2("encoding", scalar.Sym("str_6bit"))
+		length := d.FieldU6("length")
+		fieldUTF8Length(d, "value", length)
+	case encoding>>6 == 1:
+		d.FieldU2("encoding", scalar.Sym("str_14bit"))
+		length := d.FieldU14BE("length")
+		fieldUTF8Length(d, "value", length)
+	case encoding>>6 == 2:
+		d.FieldU8("encoding", ziplistEncodingNames, scalar.Hex)
+		length := d.FieldU32BE("length")
+		fieldUTF8Length(d, "value", length)
+	default:
+		d.FieldU8("encoding", ziplistEncodingNames, scalar.Hex)
+		switch {
+		case encoding == 0xc0:
+			d.FieldS16("value")
+		case encoding == 0xd0:
+			d.FieldS32("value")
+		case encoding == 0xe0:
+			d.FieldS64("value")
+		case encoding == 0xf0:
+			d.FieldS24("value")
+		case encoding == 0xfe:
+			d.FieldS8("value")
+		case encoding >= 0xf1 && encoding <= 0xfd:
+			// immediate 4 bit integer 0-12 stored as 1-13
+			d.FieldValueS("value", int64(encoding&0x0f)-1)
+		default:
+			d.Fatalf("unknown ziplist encoding %x", encoding)
+		}
+	}
+}
+
+func decodeZiplist(d *decode.D) {
+	d.Endian = decode.LittleEndian
+
+	d.FieldU32("zlbytes")
+	d.FieldU32("zltail")
+	d.FieldU16("zllen", scalar.UToScalar{0xffff: {Description: "count entries"}})
+	d.FieldStructArrayLoop("entries", "entry", func() bool { return d.PeekBits(8) != listEnd }, decodeZiplistEntry)
+	d.FieldU8("zlend", d.AssertU(listEnd), scalar.Hex)
+}
+
+// listpack entry encodings that use the whole first byte
+var listpackEncodingNames = scalar.UToSymStr{
+	0xf0: "str_32bit",
+	0xf1: "int16",
+	0xf2: "int24",
+	0xf3: "int32",
+	0xf4: "int64",
+}
+
+func decodeListpackEntry(d *decode.D) {
+	start := d.Pos()
+	encoding := d.PeekBits(8)
+	switch {
+	case encoding>>7 == 0:
+		d.FieldU1("encoding", scalar.Sym("uint_7bit"))
+		d.FieldU7("value")
+	case encoding>>6 == 0b10:
+		d.FieldU2("encoding", scalar.Sym("str_6bit"))
+		length := d.FieldU6("length")
+		fieldUTF8Length(d, "value", length)
+	case encoding>>5 == 0b110:
+		d.FieldU3("encoding", scalar.Sym("int_13bit"))
+		d.FieldS13BE("value")
+	case encoding>>4 == 0b1110:
+		d.FieldU4("encoding", scalar.Sym("str_12bit"))
+		length := d.FieldU12BE("length")
+		fieldUTF8Length(d, "value", length)
+	default:
+		d.FieldU8("encoding", listpackEncodingNames, scalar.Hex)
+		switch encoding {
+		case 0xf0:
+			length := d.FieldU32("length")
+			fieldUTF8Length(d, "value", length)
+		case 0xf1:
+			d.FieldS16("value")
+		case 0xf2:
+			d.FieldS24("value")
+		case 0xf3:
+			d.FieldS32("value")
+		case 0xf4:
+			d.FieldS64("value")
+		default:
+			d.Fatalf("unknown listpack encoding %x", encoding)
+		}
+	}
+
+	// backlen is encoded length of entry in 7 bit groups, most significant first
+	entryLen := (d.Pos() - start) / 8
+	backlenLen := 1
+	for n := entryLen; n > 127; n >>= 7 {
+		backlenLen++
+	}
+	d.FieldUFn("backlen", func(d *decode.D) uint64 {
+		var v uint64
+		for i := 0; i < backlenLen; i++ {
+			v = v<<7 | d.U8()&0x7f
+		}
+		return v
+	}, d.ValidateU(uint64(entryLen)))
+}
+
+func decodeListpack(d *decode.D) {
+	d.Endian = decode.LittleEndian
+
+	d.FieldU32("total_bytes")
+	d.FieldU16("num_elements", scalar.UToScalar{0xffff: {Description: "count entries"}})
+	d.FieldStructArrayLoop("entries", "entry", func() bool { return d.PeekBits(8) != listEnd }, decodeListpackEntry)
+	d.FieldU8("end", d.AssertU(listEnd), scalar.Hex)
+}
@@ -0,0 +1,625 @@
+package regf
+
+// https://github.com/msuhanov/regf/blob/master/Windows%20registry%20file%20format%20specification.md
+// https://github.com/libyal/libregf/blob/main/documentation/Windows%20NT%20Registry%20File%20(REGF)%20format.asciidoc
+
+// TODO: transaction log files
+
+import (
+	"embed"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed *.jq
+var regfFS embed.FS
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.REGF,
+		Description: "Windows registry hive",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte(baseBlockMagic)}},
+		DecodeFn:    regfDecode,
+		Files:       regfFS,
+	})
+}
+
+const (
+	baseBlockMagic = "regf"
+	hiveBinMagic   = "hbin"
+)
+
+const (
+	hiveBinHeaderSize = 32
+	// checksum covers base block up to checksum field
+	checksumCoverSize = 508
+	// max size of data stored directly in a value data cell, larger uses big data record
+	bigDataSegmentSize = 16344
+)
+
+// cell offsets are relative to start of first hive bin, 0xffffffff means no cell
+const noCell = 0xffffffff
+
+var cellOffsetMap = scalar.UToSymStr{
+	noCell: "none",
+}
+
+var fileTypeNames = scalar.UToSymStr{
+	0: "primary",
+	1: "transaction_log",
+	2: "transaction_log_v2",
+	6: "transaction_log_new",
+}
+
+const (
+	regNone                     = 0
+	regSZ                       = 1
+	regExpandSZ                 = 2
+	regBinary                   = 3
+	regDWORD                    = 4
+	regDWORDBigEndian           = 5
+	regLink                     = 6
+	regMultiSZ                  = 7
+	regResourceList             = 8
+	regFullResourceDescriptor   = 9
+	regResourceRequirementsList = 10
+	regQWORD                    = 11
+)
+
+var valueTypeNames = scalar.UToSymStr{
+	regNone:                     "none",
+	regSZ:                       "sz",
+	regExpandSZ:                 "expand_sz",
+	regBinary:                   "binary",
+	regDWORD:                    "dword",
+	regDWORDBigEndian:           "dword_big_endian",
+	regLink:                     "link",
+	regMultiSZ:                  "multi_sz",
+	regResourceList:             "resource_list",
+	regFullResourceDescriptor:   "full_resource_descriptor",
+	regResourceRequirementsList: "resource_requirements_list",
+	regQWORD:                    "qword",
+}
+
+// seconds between FILETIME epoch 1601-01-01 and unix epoch
+const fileTimeUnixDelta = 11644473600
+
+// windows FILETIME, 100ns intervals since 1601-01-01
+var fileTimeMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	uv, ok := s.Actual.(uint64)
+	if !ok || uv == 0 {
+		return s, nil
+	}
+	s.Description = time.Unix(int64(uv/10_000_000)-fileTimeUnixDelta, int64(uv%10_000_000)*100).UTC().Format(time.RFC3339Nano)
+	return s, nil
+})
+
+var dataSizeMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	uv, ok := s.Actual.(uint64)
+	if !ok {
+		return s, nil
+	}
+	if uv&0x8000_0000 != 0 {
+		s.Description = fmt.Sprintf("inline %d", uv&0x7fff_ffff)
+	}
+	return s, nil
+})
+
+var cellSizeMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	sv, ok := s.Actual.(int64)
+	if !ok {
+		return s, nil
+	}
+	if sv < 0 {
+		s.Description = "allocated"
+	} else {
+		s.Description = "free"
+	}
+	return s, nil
+})
+
+// kind of cells that can't be identified by a signature, found by following
+// offsets from records that reference them
+const (
+	refValueList = iota + 1
+	refClassName
+	refValueData
+	refSegmentList
+	refSegment
+)
+
+type cellRef struct {
+	kind      int
+	n         uint64 // number of entries or bytes
+	valueType uint64
+}
+
+// scanCellRefs looks at allocated records and returns cells they reference by offset
+func scanCellRefs(b []byte) map[uint64]cellRef {
+	refs := map[uint64]cellRef{}
+	le32 := binary.LittleEndian.Uint32
+	le16 := binary.LittleEndian.Uint16
+
+	// returns content of allocated cell at offset
+	cellData := func(off uint64) []byte {
+		if off+4 > uint64(len(b)) {
+			return nil
+		}
+		size := int32(le32(b[off:]))
+		if size >= 0 {
+			return nil
+		}
+		end := off + uint64(-int64(size))
+		if end > uint64(len(b)) || end < off+4 {
+			return nil
+		}
+		return b[off+4 : end]
+	}
+
+	for binOff := uint64(0); binOff+hiveBinHeaderSize <= uint64(len(b)); {
+		if string(b[binOff:binOff+4]) != hiveBinMagic {
+			break
+		}
+		binSize := uint64(le32(b[binOff+8:]))
+		if binSize < hiveBinHeaderSize {
+			break
+		}
+		binEnd := binOff + binSize
+		for off := binOff + hiveBinHeaderSize; off+4 <= binEnd && off+4 <= uint64(len(b)); {
+			size := int32(le32(b[off:]))
+			absSize := uint64(size)
+			if size < 0 {
+				absSize = uint64(-int64(size))
+			}
+			if absSize < 4 {
+				break
+			}
+			if c := cellData(off); len(c) >= 2 {
+				switch string(c[0:2]) {
+				case "nk":
+					if len(c) < 76 {
+						break
+					}
+					if n := le32(c[36:]); n > 0 {
+						refs[uint64(le32(c[40:]))] = cellRef{kind: refValueList, n: uint64(n)}
+					}
+					if n := le16(c[74:]); n > 0 {
+						refs[uint64(le32(c[48:]))] = cellRef{kind: refClassName, n: uint64(n)}
+					}
+				case "vk":
+					if len(c) < 20 {
+						break
+					}
+					size := le32(c[4:])
+					dataOff := uint64(le32(c[8:]))
+					if size&0x8000_0000 != 0 || size == 0 {
+						break
+					}
+					if dc := cellData(dataOff); size > bigDataSegmentSize && len(dc) >= 8 && string(dc[0:2]) == "db" {
+						numSegments := uint64(le16(dc[2:]))
+						segListOff := uint64(le32(dc[4:]))
+						refs[segListOff] = cellRef{kind: refSegmentList, n: numSegments}
+						segList := cellData(segListOff)
+						left := uint64(size)
+						for i := uint64(0); i < numSegments && (i+1)*4 <= uint64(len(segList)) && left > 0; i++ {
+							n := left
+							if n > bigDataSegmentSize {
+								n = bigDataSegmentSize
+							}
+							refs[uint64(le32(segList[i*4:]))] = cellRef{kind: refSegment, n: n}
+							left -= n
+						}
+						break
+					}
+					refs[dataOff] = cellRef{kind: refValueData, n: uint64(size), valueType: uint64(le32(c[12:]))}
+				}
+			}
+			off += absSize
+		}
+		binOff = binEnd
+	}
+
+	return refs
+}
+
+func decodeBaseBlock(d *decode.D) {
+	d.FieldUTF8("signature", 4, d.AssertStr(baseBlockMagic))
+	primarySeq := d.FieldU32("primary_sequence_number")
+	d.FieldU32("secondary_sequence_number", scalar.Fn(func(s scalar.S) (scalar.S, error) {
+		// differ if hive was not written completely, transaction log needs to be applied
+		if s.ActualU() != primarySeq {
+			s.Description = "dirty"
+		}
+		return s, nil
+	}))
+	d.FieldU64("last_written_timestamp", fileTimeMap)
+	d.FieldU32("major_version", d.AssertU(1))
+	minorVersion := d.FieldU32("minor_version")
+	d.FieldU32("file_type", fileTypeNames)
+	d.FieldU32("file_format", scalar.UToSymStr{1: "direct_memory_load"})
+	d.FieldU32("root_cell_offset", scalar.Hex)
+	d.FieldU32("hive_bins_data_size")
+	d.FieldU32("clustering_factor")
+	d.FieldUTF16LE("file_name", 64, scalar.Trim("\x00"))
+	if minorVersion >= 5 {
+		d.FieldRawLen("rm_id", 16*8, scalar.RawUUID)
+		d.FieldRawLen("log_id", 16*8, scalar.RawUUID)
+		d.FieldU32("flags")
+		d.FieldRawLen("tm_id", 16*8, scalar.RawUUID)
+		d.FieldUTF8("guid_signature", 4)
+		d.FieldU64("last_reorganized_timestamp", fileTimeMap)
+		d.FieldRawLen("reserved0", 332*8)
+	} else {
+		d.FieldRawLen("reserved0", 396*8)
+	}
+
+	var xor uint32
+	b := d.BytesRange(0, checksumCoverSize)
+	for i := 0; i < checksumCoverSize; i += 4 {
+		xor ^= binary.LittleEndian.Uint32(b[i:])
+	}
+	switch xor {
+	case 0xffff_ffff:
+		xor = 0xffff_fffe
+	case 0:
+		xor = 1
+	}
+	d.FieldChecksumU("checksum", 32, "xor32", uint64(xor), scalar.Hex)
+
+	d.FieldRawLen("reserved1", 3576*8)
+	d.FieldU32("boot_type")
+	d.FieldU32("boot_recover")
+}
+
+// name is ASCII (extended, latin1) if compressed otherwise UTF-16LE
+func fieldName(d *decode.D, name string, nBytes int, compressed bool) {
+	if compressed {
+		d.FieldStrFn(name, func(d *decode.D) string {
+			var sb strings.Builder
+			for _, b := range d.BytesLen(nBytes) {
+				sb.WriteRune(rune(b))
+			}
+			return sb.String()
+		})
+	} else {
+		d.FieldUTF16LE(name, nBytes)
+	}
+}
+
+func decodeKeyNode(d *decode.D) {
+	var compressed bool
+	d.FieldStruct("flags", func(d *decode.D) {
+		// TODO: 16LE, should have some kind of native endian flag reader helper?
+		d.FieldBool("virtual_source")
+		d.FieldBool("predefined_handle")
+		compressed = d.FieldBool("comp_name")
+		d.FieldBool("sym_link")
+		d.FieldBool("no_delete")
+		d.FieldBool("hive_entry")
+		d.FieldBool("hive_exit")
+		d.FieldBool("volatile")
+
+		d.FieldU6("unused0")
+		d.FieldBool("virtual_store")
+		d.FieldBool("virtual_target")
+	})
+	d.FieldU64("last_written_timestamp", fileTimeMap)
+	d.FieldU32("access_bits")
+	d.FieldU32("parent", cellOffsetMap, scalar.Hex)
+	d.FieldU32("num_subkeys")
+	d.FieldU32("num_volatile_subkeys")
+	d.FieldU32("subkeys_list_offset", cellOffsetMap, scalar.Hex)
+	d.FieldU32("volatile_subkeys_list_offset", cellOffsetMap, scalar.Hex)
+	d.FieldU32("num_values")
+	d.FieldU32("values_list_offset", cellOffsetMap, scalar.Hex)
+	d.FieldU32("security_key_offset", cellOffsetMap, scalar.Hex)
+	d.FieldU32("class_name_offset", cellOffsetMap, scalar.Hex)
+	d.FieldU32("largest_subkey_name_length")
+	d.FieldU32("largest_subkey_class_name_length")
+	d.FieldU32("largest_value_name_length")
+	d.FieldU32("largest_value_data_size")
+	d.FieldU32("workvar")
+	nameLength := d.FieldU16("name_length")
+	d.FieldU16("class_name_length")
+	fieldName(d, "name", int(nameLength), compressed)
+}
+
+// utf-16 strings are usually but not always null terminated
+func fieldUTF16String(d *decode.D, name string, nBytes int64) {
+	d.FieldUTF16LE(name, int(nBytes), scalar.Trim("\x00"))
+}
+
+func decodeValueData(d *decode.D, valueType uint64, size int64) {
+	switch {
+	case (valueType == regSZ || valueType == regExpandSZ || valueType == regLink) && size%2 == 0:
+		fieldUTF16String(d, "data", size)
+	case valueType == regDWORD && size == 4:
+		d.FieldU32LE("data")
+	case valueType == regDWORDBigEndian && size == 4:
+		d.FieldU32BE("data")
+	case valueType == regQWORD && size == 8:
+		d.FieldU64LE("data")
+	case valueType == regMultiSZ && size%2 == 0:
+		d.FieldArray("data", func(d *decode.D) {
+			d.LenFn(size*8, func(d *decode.D) {
+				for !d.End() {
+					b := d.PeekBytes(int(d.BitsLeft() / 8))
+					n := len(b)
+					for i := 0; i+1 < len(b); i += 2 {
+						if b[i] == 0 && b[i+1] == 0 {
+							n = i + 2
+							break
+						}
+					}
+					// empty string terminates list
+					if n == 2 {
+						d.FieldRawLen("terminator", d.BitsLeft())
+						break
+					}
+					fieldUTF16String(d, "string", int64(n))
+				}
+			})
+		})
+	default:
+		d.FieldRawLen("data", size*8)
+	}
+}
+
+func decodeValueKey(d *decode.D) {
+	nameLength := d.FieldU16("name_length")
+	dataSize := d.FieldU32("data_size", dataSizeMap)
+	inline := dataSize&0x8000_0000 != 0
+	var dataType uint64
+	if inline {
+		// data stored in offset field, read type first
+		dataType = uint64(binary.LittleEndian.Uint32(d.PeekBytes(8)[4:8]))
+		n := int64(dataSize & 0x7fff_ffff)
+		if n > 4 {
+			d.Fatalf("inline data size %d larger than 4", n)
+		}
+		d.FieldStruct("inline_data", func(d *decode.D) {
+			decodeValueData(d, dataType, n)
+			if n < 4 {
+				d.FieldRawLen("padding", (4-n)*8)
+			}
+		})
+	} else {
+		d.FieldU32("data_offset", cellOffsetMap, scalar.Hex)
+	}
+	d.FieldU32("data_type", valueTypeNames)
+	var compressed bool
+	d.FieldStruct("flags", func(d *decode.D) {
+		// TODO: 16LE, should have some kind of native endian flag reader helper?
+		d.FieldU6("unused0")
+		d.FieldBool("tombstone")
+		compressed = d.FieldBool("comp_name")
+		d.FieldU8("unused1")
+	})
+	d.FieldU16("spare")
+	fieldName(d, "name", int(nameLength), compressed)
+}
+
+func decodeSID(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		d.FieldU8("revision")
+		n := d.FieldU8("num_sub_authorities")
+		authority := d.FieldU48BE("identifier_authority")
+		subAuthorities := []string{}
+		d.FieldArray("sub_authorities", func(d *decode.D) {
+			for i := uint64(0); i < n; i++ {
+				subAuthorities = append(subAuthorities, fmt.Sprint(d.FieldU32("sub_authority")))
+			}
+		})
+		d.FieldValueStr("string", fmt.Sprintf("S-1-%d-%s", authority, strings.Join(subAuthorities, "-")))
+	})
+}
+
+// self-relative security descriptor, offsets are relative to descriptor start
+func decodeSecurityDescriptor(d *decode.D, size int64) {
+	start := d.Pos()
+	d.FieldStruct("security_descriptor", func(d *decode.D) {
+		d.FieldU8("revision")
+		d.FieldU8("sbz1")
+		d.FieldU16("control", scalar.Hex)
+		ownerOff := d.FieldU32("owner_offset")
+		groupOff := d.FieldU32("group_offset")
+		saclOff := d.FieldU32("sacl_offset")
+		daclOff := d.FieldU32("dacl_offset")
+
+		for _, s := range []struct {
+			name string
+			off  uint64
+			fn   func(d *decode.D, name string)
+		}{
+			{"owner", ownerOff, decodeSID},
+			{"group", groupOff, decodeSID},
+			{"sacl", saclOff, decodeACL},
+			{"dacl", daclOff, decodeACL},
+		} {
+			if s.off == 0 {
+				continue
+			}
+			if int64(s.off) >= size {
+				d.Fatalf("%s offset %d outside descriptor", s.name, s.off)
+			}
+			d.SeekAbs(start + int64(s.off)*8)
+			s.fn(d, s.name)
+		}
+	})
+	d.SeekAbs(start + size*8)
+}
+
+func decodeACL(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		d.FieldU8("revision")
+		d.FieldU8("sbz1")
+		size := d.FieldU16("size")
+		d.FieldU16("num_aces")
+		d.FieldU16("sbz2")
+		if size < 8 {
+			d.Fatalf("acl size %d too small", size)
+		}
+		d.FieldRawLen("aces", int64(size-8)*8)
+	})
+}
+
+func decodeSecurityKey(d *decode.D) {
+	d.FieldU16("reserved")
+	d.FieldU32("flink", scalar.Hex)
+	d.FieldU32("blink", scalar.Hex)
+	d.FieldU32("reference_count")
+	size := d.FieldU32("security_descriptor_size")
+	d.LenFn(int64(size)*8, func(d *decode.D) { decodeSecurityDescriptor(d, int64(size)) })
+}
+
+func decodeSubkeysList(d *decode.D, signature string) {
+	n := d.FieldU16("num_elements")
+	d.FieldArray("elements", func(d *decode.D) {
+		for i := uint64(0); i < n; i++ {
+			switch signature {
+			case "lf":
+				d.FieldStruct("element", func(d *decode.D) {
+					d.FieldU32("key_node_offset", scalar.Hex)
+					d.FieldUTF8NullFixedLen("name_hint", 4)
+				})
+			case "lh":
+				d.FieldStruct("element", func(d *decode.D) {
+					d.FieldU32("key_node_offset", scalar.Hex)
+					d.FieldU32("name_hash", scalar.Hex)
+				})
+			case "li":
+				d.FieldU32("key_node_offset", scalar.Hex)
+			case "ri":
+				d.FieldU32("subkeys_list_offset", scalar.Hex)
+			}
+		}
+	})
+}
+
+func decodeBigData(d *decode.D) {
+	d.FieldU16("num_segments")
+	d.FieldU32("segments_list_offset", scalar.Hex)
+}
+
+var signatureNames = scalar.StrToSymStr{
+	"nk": "key_node",
+	"vk": "value_key",
+	"sk": "security_key",
+	"lf": "fast_leaf",
+	"lh": "hash_leaf",
+	"li": "index_leaf",
+	"ri": "index_root",
+	"db": "big_data",
+}
+
+func decodeCellData(d *decode.D, ref cellRef, hasRef bool) {
+	switch {
+	case hasRef && ref.kind == refValueList:
+		d.FieldArray("values", func(d *decode.D) {
+			for i := uint64(0); i < ref.n && d.BitsLeft() >= 32; i++ {
+				d.FieldU32("value_key_offset", scalar.Hex)
+			}
+		})
+	case hasRef && ref.kind == refClassName && int64(ref.n)*8 <= d.BitsLeft():
+		fieldUTF16String(d, "class_name", int64(ref.n))
+	case hasRef && ref.kind == refValueData && int64(ref.n)*8 <= d.BitsLeft():
+		decodeValueData(d, ref.valueType, int64(ref.n))
+	case hasRef && ref.kind == refSegmentList:
+		d.FieldArray("segments", func(d *decode.D) {
+			for i := uint64(0); i < ref.n && d.BitsLeft() >= 32; i++ {
+				d.FieldU32("segment_offset", scalar.Hex)
+			}
+		})
+	case hasRef && ref.kind == refSegment && int64(ref.n)*8 <= d.BitsLeft():
+		d.FieldRawLen("data", int64(ref.n)*8)
+	default:
+		if d.BitsLeft() < 16 {
+			break
+		}
+		signature := d.PeekBytes(2)
+		if _, ok := signatureNames[string(signature)]; !ok {
+			d.FieldRawLen("data", d.BitsLeft())
+			break
+		}
+		sig := d.FieldUTF8("signature", 2, signatureNames)
+		switch sig {
+		case "nk":
+			decodeKeyNode(d)
+		case "vk":
+			decodeValueKey(d)
+		case "sk":
+			decodeSecurityKey(d)
+		case "lf", "lh", "li", "ri":
+			decodeSubkeysList(d, sig)
+		case "db":
+			decodeBigData(d)
+		}
+	}
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("padding", d.BitsLeft())
+	}
+}
+
+func decodeHiveBin(d *decode.D, hiveBinsStart int64, refs map[uint64]cellRef) {
+	binStart := d.Pos()
+	d.FieldUTF8("signature", 4, d.AssertStr(hiveBinMagic))
+	d.FieldU32("offset", scalar.Hex)
+	size := d.FieldU32("size")
+	if size < hiveBinHeaderSize || binStart+int64(size)*8 > d.Len() {
+		d.Fatalf("invalid hive bin size %d", size)
+	}
+	d.FieldRawLen("reserved", 8*8)
+	d.FieldU64("timestamp", fileTimeMap)
+	d.FieldU32("spare")
+
+	binEnd := binStart + int64(size)*8
+	d.FieldArray("cells", func(d *decode.D) {
+		for d.Pos() < binEnd {
+			d.FieldStruct("cell", func(d *decode.D) {
+				offset := uint64(d.Pos()-hiveBinsStart) / 8
+				cellSize := d.FieldS32("size", cellSizeMap)
+				allocated := cellSize < 0
+				if allocated {
+					cellSize = -cellSize
+				}
+				if cellSize < 4 || d.Pos()-32+cellSize*8 > binEnd {
+					d.Fatalf("invalid cell size %d", cellSize)
+				}
+				d.LenFn((cellSize-4)*8, func(d *decode.D) {
+					if !allocated {
+						d.FieldRawLen("unused", d.BitsLeft())
+						return
+					}
+					ref, ok := refs[offset]
+					decodeCellData(d, ref, ok)
+				})
+			})
+		}
+	})
+}
+
+func regfDecode(d *decode.D, in interface{}) interface{} {
+	d.Endian = decode.LittleEndian
+
+	d.FieldStruct("base_block", decodeBaseBlock)
+
+	hiveBinsStart := d.Pos()
+	hiveBinsSize := d.BitsLeft() / 8
+	refs := scanCellRefs(d.BytesRange(hiveBinsStart, int(hiveBinsSize)))
+
+	d.FieldArray("hive_bins", func(d *decode.D) {
+		for d.BitsLeft() >= hiveBinHeaderSize*8 && string(d.PeekBytes(4)) == hiveBinMagic {
+			d.FieldStruct("hive_bin", func(d *decode.D) { decodeHiveBin(d, hiveBinsStart, refs) })
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,274 @@
+package rtp
+
+// https://datatracker.ietf.org/doc/html/rfc3550#section-6 RTCP
+// https://datatracker.ietf.org/doc/html/rfc4585 RTCP feedback
+// https://datatracker.ietf.org/doc/html/rfc3611 RTCP extended reports
+// https://datatracker.ietf.org/doc/html/rfc5506 Reduced-size RTCP
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.RTCP,
+		ProbeOrder:  10, // no magic, after other udp payload formats
+		Description: "RTP Control Protocol packets",
+		Groups:      []string{format.UDP_PAYLOAD},
+		DecodeFn:    rtcpDecode,
+	})
+}
+
+const (
+	rtcpTypeSR    = 200
+	rtcpTypeRR    = 201
+	rtcpTypeSDES  = 202
+	rtcpTypeBYE   = 203
+	rtcpTypeAPP   = 204
+	rtcpTypeRTPFB = 205
+	rtcpTypePSFB  = 206
+	rtcpTypeXR    = 207
+)
+
+var rtcpTypeNames = scalar.UToScalar{
+	rtcpTypeSR:    {Sym: "sr", Description: "Sender report"},
+	rtcpTypeRR:    {Sym: "rr", Description: "Receiver report"},
+	rtcpTypeSDES:  {Sym: "sdes", Description: "Source description"},
+	rtcpTypeBYE:   {Sym: "bye", Description: "Goodbye"},
+	rtcpTypeAPP:   {Sym: "app", Description: "Application-defined"},
+	rtcpTypeRTPFB: {Sym: "rtpfb", Description: "Transport layer feedback"},
+	rtcpTypePSFB:  {Sym: "psfb", Description: "Payload-specific feedback"},
+	rtcpTypeXR:    {Sym: "xr", Description: "Extended report"},
+}
+
+const (
+	rtpfbNACK = 1
+)
+
+var rtpfbFormatNames = scalar.UToSymStr{
+	rtpfbNACK: "nack",
+	3:         "tmmbr",
+	4:         "tmmbn",
+	15:        "transport_cc",
+}
+
+var psfbFormatNames = scalar.UToSymStr{
+	1:  "pli",
+	2:  "sli",
+	3:  "rpsi",
+	4:  "fir",
+	5:  "tstr",
+	6:  "tstn",
+	7:  "vbcm",
+	15: "afb",
+}
+
+const sdesEnd = 0
+
+var sdesItemTypeNames = scalar.UToSymStr{
+	sdesEnd: "end",
+	1:       "cname",
+	2:       "name",
+	3:       "email",
+	4:       "phone",
+	5:       "loc",
+	6:       "tool",
+	7:       "note",
+	8:       "priv",
+}
+
+var xrBlockTypeNames = scalar.UToSymStr{
+	1: "loss_rle",
+	2: "duplicate_rle",
+	3: "packet_receipt_times",
+	4: "receiver_reference_time",
+	5: "dlrr",
+	6: "statistics_summary",
+	7: "voip_metrics",
+}
+
+func decodeReportBlocks(d *decode.D, count uint64) {
+	d.FieldArray("report_blocks", func(d *decode.D) {
+		for i := uint64(0); i < count; i++ {
+			d.FieldStruct("report_block", func(d *decode.D) {
+				d.FieldU32("ssrc", scalar.Hex)
+				d.FieldU8("fraction_lost")
+				d.FieldS24("cumulative_lost")
+				d.FieldU32("extended_highest_sequence_number")
+				d.FieldU32("interarrival_jitter")
+				d.FieldU32("last_sr", scalar.Hex)
+				d.FieldU32("delay_since_last_sr")
+			})
+		}
+	})
+}
+
+func decodeSDES(d *decode.D, count uint64) {
+	d.FieldArray("chunks", func(d *decode.D) {
+		for i := uint64(0); i < count; i++ {
+			d.FieldStruct("chunk", func(d *decode.D) {
+				start := d.Pos()
+				d.FieldU32("ssrc", scalar.Hex)
+				d.FieldArray("items", func(d *decode.D) {
+					for {
+						end := false
+						d.FieldStruct("item", func(d *decode.D) {
+							typ := d.FieldU8("type", sdesItemTypeNames)
+							if typ == sdesEnd {
+								end = true
+								return
+							}
+							length := d.FieldU8("length")
+							if typ == 8 {
+								prefixLength := d.FieldU8("prefix_length")
+								d.FieldUTF8("prefix", int(prefixLength))
+								d.FieldUTF8("value", int(length-1-prefixLength))
+								return
+							}
+							d.FieldUTF8("text", int(length))
+						})
+						if end {
+							break
+						}
+					}
+				})
+				// chunks end on 32 bit boundary
+				if rem := ((d.Pos() - start) / 8) % 4; rem != 0 {
+					d.FieldRawLen("padding", (4-rem)*8, d.BitBufIsZero())
+				}
+			})
+		}
+	})
+}
+
+func decodeRTCPPacket(d *decode.D) {
+	// count field is feedback message type for feedback packets
+	var count uint64
+	peekPacketType := d.PeekBytes(2)[1]
+	d.FieldU2("version", d.AssertU(rtpVersion))
+	padding := d.FieldBool("padding")
+	switch peekPacketType {
+	case rtcpTypeRTPFB:
+		count = d.FieldU5("format", rtpfbFormatNames)
+	case rtcpTypePSFB:
+		count = d.FieldU5("format", psfbFormatNames)
+	default:
+		count = d.FieldU5("count")
+	}
+	packetType := d.FieldU8("packet_type", rtcpTypeNames)
+	length := d.FieldU16("length", scalar.Description("32 bit words minus one"))
+
+	d.LenFn(int64(length)*32, func(d *decode.D) {
+		paddingLen := int64(0)
+		if padding && d.Len() >= 8 {
+			paddingLen = int64(d.BytesRange(d.Len()-8, 1)[0])
+			if paddingLen*8 > d.BitsLeft() {
+				d.Fatalf("invalid padding length %d", paddingLen)
+			}
+		}
+
+		d.LenFn(d.BitsLeft()-paddingLen*8, func(d *decode.D) {
+			switch packetType {
+			case rtcpTypeSR:
+				d.FieldU32("ssrc", scalar.Hex)
+				d.FieldStruct("sender_info", func(d *decode.D) {
+					d.FieldU32("ntp_timestamp_msw")
+					d.FieldU32("ntp_timestamp_lsw")
+					d.FieldU32("rtp_timestamp")
+					d.FieldU32("packet_count")
+					d.FieldU32("octet_count")
+				})
+				decodeReportBlocks(d, count)
+			case rtcpTypeRR:
+				d.FieldU32("ssrc", scalar.Hex)
+				decodeReportBlocks(d, count)
+			case rtcpTypeSDES:
+				decodeSDES(d, count)
+			case rtcpTypeBYE:
+				d.FieldArray("ssrcs", func(d *decode.D) {
+					for i := uint64(0); i < count; i++ {
+						d.FieldU32("ssrc", scalar.Hex)
+					}
+				})
+				if d.NotEnd() {
+					reasonLength := d.FieldU8("reason_length")
+					d.FieldUTF8("reason", int(reasonLength))
+				}
+			case rtcpTypeAPP:
+				d.FieldU32("ssrc", scalar.Hex)
+				d.FieldUTF8("name", 4)
+				d.FieldRawLen("data", d.BitsLeft())
+			case rtcpTypeRTPFB, rtcpTypePSFB:
+				d.FieldU32("sender_ssrc", scalar.Hex)
+				d.FieldU32("media_ssrc", scalar.Hex)
+				switch {
+				case packetType == rtcpTypeRTPFB && count == rtpfbNACK:
+					d.FieldArray("nacks", func(d *decode.D) {
+						for d.NotEnd() {
+							d.FieldStruct("nack", func(d *decode.D) {
+								d.FieldU16("packet_id")
+								d.FieldU16("lost_packets_bitmask", scalar.Bin)
+							})
+						}
+					})
+				default:
+					d.FieldRawLen("feedback_control_information", d.BitsLeft())
+				}
+			case rtcpTypeXR:
+				d.FieldU32("ssrc", scalar.Hex)
+				d.FieldArray("report_blocks", func(d *decode.D) {
+					for d.NotEnd() {
+						d.FieldStruct("report_block", func(d *decode.D) {
+							d.FieldU8("block_type", xrBlockTypeNames)
+							d.FieldU8("type_specific")
+							blockLength := d.FieldU16("block_length")
+							d.FieldRawLen("data", int64(blockLength)*32)
+						})
+					}
+				})
+			default:
+				d.FieldRawLen("data", d.BitsLeft())
+			}
+			if d.NotEnd() {
+				d.FieldRawLen("unknown", d.BitsLeft())
+			}
+		})
+
+		if padding {
+			d.FieldRawLen("padding_bytes", (paddingLen-1)*8)
+			d.FieldU8("padding_length")
+		}
+	})
+}
+
+// heuristics used when tried as udp payload, lengths of compound packets
+// should add up exactly
+func isRTCP(d *decode.D) bool {
+	b := d.PeekBytes(int(d.BitsLeft() / 8))
+	for len(b) > 0 {
+		if len(b) < 4 || b[0]>>6 != rtpVersion || b[1] < rtcpTypeSR || b[1] > rtcpTypeXR {
+			return false
+		}
+		n := (int(b[2])<<8 | int(b[3]) + 1) * 4
+		if n > len(b) {
+			return false
+		}
+		b = b[n:]
+	}
+	return true
+}
+
+func rtcpDecode(d *decode.D, in interface{}) interface{} {
+	if udi, ok := in.(format.UDPDatagramIn); ok {
+		if udi.SourcePort < 1024 || udi.DestinationPort < 1024 || !isRTCP(d) {
+			d.Fatalf("not RTCP")
+		}
+	}
+
+	d.FieldStructArrayLoop("packets", "packet", d.NotEnd, decodeRTCPPacket)
+
+	return nil
+}
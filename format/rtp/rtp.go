@@ -0,0 +1,210 @@
+package rtp
+
+// https://datatracker.ietf.org/doc/html/rfc3550 RTP
+// https://datatracker.ietf.org/doc/html/rfc3551 RTP profile for audio and video
+// https://datatracker.ietf.org/doc/html/rfc8285 RTP header extensions
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.RTP,
+		ProbeOrder:  10, // no magic, after other udp payload formats
+		Description: "Real-time Transport Protocol packet",
+		Groups:      []string{format.UDP_PAYLOAD},
+		DecodeFn:    rtpDecode,
+	})
+}
+
+const rtpVersion = 2
+
+// RTCP packet types 192-223 collide with RTP payload types 64-95 with marker bit set
+const (
+	rtcpMuxFirst = 192
+	rtcpMuxLast  = 223
+)
+
+var payloadTypeNames = scalar.UToScalar{
+	0:  {Sym: "pcmu", Description: "PCMU audio 8000Hz"},
+	3:  {Sym: "gsm", Description: "GSM audio 8000Hz"},
+	4:  {Sym: "g723", Description: "G723 audio 8000Hz"},
+	5:  {Sym: "dvi4_8000", Description: "DVI4 audio 8000Hz"},
+	6:  {Sym: "dvi4_16000", Description: "DVI4 audio 16000Hz"},
+	7:  {Sym: "lpc", Description: "LPC audio 8000Hz"},
+	8:  {Sym: "pcma", Description: "PCMA audio 8000Hz"},
+	9:  {Sym: "g722", Description: "G722 audio 8000Hz"},
+	10: {Sym: "l16_stereo", Description: "L16 audio 44100Hz 2 channels"},
+	11: {Sym: "l16_mono", Description: "L16 audio 44100Hz 1 channel"},
+	12: {Sym: "qcelp", Description: "QCELP audio 8000Hz"},
+	13: {Sym: "cn", Description: "Comfort noise 8000Hz"},
+	14: {Sym: "mpa", Description: "MPEG audio 90000Hz"},
+	15: {Sym: "g728", Description: "G728 audio 8000Hz"},
+	16: {Sym: "dvi4_11025", Description: "DVI4 audio 11025Hz"},
+	17: {Sym: "dvi4_22050", Description: "DVI4 audio 22050Hz"},
+	18: {Sym: "g729", Description: "G729 audio 8000Hz"},
+	25: {Sym: "celb", Description: "CelB video 90000Hz"},
+	26: {Sym: "jpeg", Description: "JPEG video 90000Hz"},
+	28: {Sym: "nv", Description: "nv video 90000Hz"},
+	31: {Sym: "h261", Description: "H261 video 90000Hz"},
+	32: {Sym: "mpv", Description: "MPEG video 90000Hz"},
+	33: {Sym: "mp2t", Description: "MPEG transport stream 90000Hz"},
+	34: {Sym: "h263", Description: "H263 video 90000Hz"},
+}
+
+func payloadTypeMapper() scalar.Mapper {
+	return scalar.Fn(func(s scalar.S) (scalar.S, error) {
+		if s, err := payloadTypeNames.MapScalar(s); err != nil || s.Sym != nil {
+			return s, err
+		}
+		if pt, ok := s.Actual.(uint64); ok && pt >= 96 && pt <= 127 {
+			s.Sym = "dynamic"
+		}
+		return s, nil
+	})
+}
+
+const (
+	extensionProfileOneByte    = 0xbede
+	extensionProfileTwoByte    = 0x1000
+	extensionProfileTwoByteMax = 0x100f
+)
+
+var extensionProfileNames = scalar.UToSymStr{
+	extensionProfileOneByte: "one_byte",
+}
+
+func decodeHeaderExtension(d *decode.D) {
+	profile := d.FieldU16("profile", extensionProfileNames, scalar.Hex)
+	length := d.FieldU16("length")
+	d.LenFn(int64(length)*32, func(d *decode.D) {
+		switch {
+		case profile == extensionProfileOneByte:
+			d.FieldArray("elements", func(d *decode.D) {
+				for d.BitsLeft() >= 8 {
+					// zero bytes are padding, id 15 stops parsing
+					if d.PeekBits(8) == 0 {
+						d.FieldU8("padding")
+						continue
+					}
+					stop := false
+					d.FieldStruct("element", func(d *decode.D) {
+						id := d.FieldU4("id")
+						length := d.FieldU4("length", scalar.UAdd(1))
+						if id == 15 {
+							stop = true
+							return
+						}
+						d.FieldRawLen("data", int64(length)*8)
+					})
+					if stop {
+						break
+					}
+				}
+			})
+		case profile >= extensionProfileTwoByte && profile <= extensionProfileTwoByteMax:
+			d.FieldArray("elements", func(d *decode.D) {
+				for d.BitsLeft() >= 8 {
+					if d.PeekBits(8) == 0 {
+						d.FieldU8("padding")
+						continue
+					}
+					d.FieldStruct("element", func(d *decode.D) {
+						d.FieldU8("id")
+						length := d.FieldU8("length")
+						d.FieldRawLen("data", int64(length)*8)
+					})
+				}
+			})
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+		if d.NotEnd() {
+			d.FieldRawLen("padding", d.BitsLeft())
+		}
+	})
+}
+
+// returns header values and padding flag as padding length is last byte of packet
+func decodeRTPHeader(d *decode.D) (format.RTPOut, bool) {
+	var out format.RTPOut
+	d.FieldU2("version", d.AssertU(rtpVersion))
+	padding := d.FieldBool("padding")
+	extension := d.FieldBool("extension")
+	csrcCount := d.FieldU4("csrc_count")
+	out.Marker = d.FieldBool("marker")
+	out.PayloadType = int(d.FieldU7("payload_type", payloadTypeMapper()))
+	out.SequenceNumber = uint16(d.FieldU16("sequence_number"))
+	out.Timestamp = uint32(d.FieldU32("timestamp"))
+	out.SSRC = uint32(d.FieldU32("ssrc", scalar.Hex))
+	d.FieldArray("csrcs", func(d *decode.D) {
+		for i := uint64(0); i < csrcCount; i++ {
+			d.FieldU32("csrc", scalar.Hex)
+		}
+	})
+	if extension {
+		d.FieldStruct("header_extension", decodeHeaderExtension)
+	}
+	return out, padding
+}
+
+// heuristics used when tried as udp payload as there is no magic or port
+func isRTP(d *decode.D) bool {
+	if d.BitsLeft() < 12*8 {
+		return false
+	}
+	b := d.PeekBytes(2)
+	if b[0]>>6 != rtpVersion {
+		return false
+	}
+	if b[1] >= rtcpMuxFirst && b[1] <= rtcpMuxLast {
+		return false
+	}
+	pt := uint64(b[1] & 0x7f)
+	_, known := payloadTypeNames[pt]
+	if !known && (pt < 96 || pt > 127) {
+		return false
+	}
+	csrcCount := int64(b[0] & 0xf)
+	return d.BitsLeft() >= (12+csrcCount*4)*8
+}
+
+func rtpDecode(d *decode.D, in interface{}) interface{} {
+	if udi, ok := in.(format.UDPDatagramIn); ok {
+		// dynamic ports are used, skip well known ones
+		if udi.SourcePort < 1024 || udi.DestinationPort < 1024 || !isRTP(d) {
+			d.Fatalf("not RTP")
+		}
+	}
+
+	var out format.RTPOut
+	var padding bool
+	d.FieldStruct("header", func(d *decode.D) {
+		out, padding = decodeRTPHeader(d)
+	})
+
+	paddingLen := int64(0)
+	if padding {
+		if d.BitsLeft() < 8 {
+			d.Fatalf("too short for padding length")
+		}
+		paddingLen = int64(d.BytesRange(d.Len()-8, 1)[0])
+		if paddingLen == 0 || paddingLen*8 > d.BitsLeft() {
+			d.Fatalf("invalid padding length %d", paddingLen)
+		}
+	}
+
+	payloadLen := d.BitsLeft() - paddingLen*8
+	out.Payload = d.BytesRange(d.Pos(), int(payloadLen/8))
+	d.FieldRawLen("payload", payloadLen)
+	if padding {
+		d.FieldRawLen("padding_bytes", (paddingLen-1)*8)
+		d.FieldU8("padding_length")
+	}
+
+	return out
+}
@@ -0,0 +1,55 @@
+package rtp
+
+// https://datatracker.ietf.org/doc/html/rfc3711 SRTP
+// https://datatracker.ietf.org/doc/html/rfc5761 RTP and RTCP multiplexing
+
+// TODO: authentication tag length is assumed to be 80 bits (AES_CM_128_HMAC_SHA1_80)
+// TODO: MKI
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.SRTP,
+		Description: "Secure Real-time Transport Protocol packet",
+		DecodeFn:    srtpDecode,
+	})
+}
+
+const authTagLen = 10
+
+func srtpDecode(d *decode.D, in interface{}) interface{} {
+	if pt := d.PeekBytes(2)[1]; pt >= rtcpMuxFirst && pt <= rtcpMuxLast {
+		d.FieldStruct("srtcp_header", func(d *decode.D) {
+			d.FieldU2("version", d.AssertU(rtpVersion))
+			d.FieldBool("padding")
+			d.FieldU5("count")
+			d.FieldU8("packet_type", rtcpTypeNames)
+			d.FieldU16("length")
+			d.FieldU32("ssrc", scalar.Hex)
+		})
+		// E flag, SRTCP index and tag are in trailer
+		encryptedLen := d.BitsLeft() - (4+authTagLen)*8
+		if encryptedLen < 0 {
+			d.Fatalf("too short for SRTCP trailer")
+		}
+		d.FieldRawLen("encrypted_portion", encryptedLen)
+		d.FieldBool("encrypted")
+		d.FieldU31("srtcp_index")
+	} else {
+		d.FieldStruct("header", func(d *decode.D) { decodeRTPHeader(d) })
+		encryptedLen := d.BitsLeft() - authTagLen*8
+		if encryptedLen < 0 {
+			d.Fatalf("too short for authentication tag")
+		}
+		d.FieldRawLen("encrypted_payload", encryptedLen)
+	}
+	d.FieldRawLen("authentication_tag", d.BitsLeft())
+
+	return nil
+}
@@ -0,0 +1,245 @@
+package rtsp
+
+// https://datatracker.ietf.org/doc/html/rfc6184 RTP Payload Format for H.264 Video
+// https://datatracker.ietf.org/doc/html/rfc7798 RTP Payload Format for HEVC
+// https://datatracker.ietf.org/doc/html/rfc3640 RTP Payload Format for Transport of MPEG-4 Elementary Streams
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+)
+
+// TODO: H.264 STAP-B, MTAP and FU-B (interleaved mode)
+// TODO: HEVC DONL (sprop-max-don-diff > 0) and PACI
+// TODO: AAC fragmented access units and MP4A-LATM
+
+const (
+	h264NALTypeSTAPA = 24
+	h264NALTypeFUA   = 28
+
+	hevcNALTypeAP = 48
+	hevcNALTypeFU = 49
+
+	fuStartBit = 0x80
+	fuEndBit   = 0x40
+
+	// samples per AAC frame
+	aacFrameSamples = 1024
+)
+
+type accessUnit struct {
+	timestamp uint32
+	data      []byte
+}
+
+type depacketizer interface {
+	push(p format.RTPOut)
+	flush()
+	units() []accessUnit
+}
+
+// collects NAL units into access units with 4 byte big endian length prefix,
+// access units ends at marker bit or when timestamp changes
+type naluDepacketizer struct {
+	splitFn     func(nd *naluDepacketizer, p []byte)
+	accessUnits []accessUnit
+	timestamp   uint32
+	nalus       [][]byte
+	fu          []byte // fragmentation unit being reassembled
+}
+
+func (nd *naluDepacketizer) push(p format.RTPOut) {
+	if len(nd.nalus) > 0 && p.Timestamp != nd.timestamp {
+		nd.flush()
+	}
+	nd.timestamp = p.Timestamp
+	nd.splitFn(nd, p.Payload)
+	if p.Marker {
+		nd.flush()
+	}
+}
+
+func (nd *naluDepacketizer) flush() {
+	if len(nd.nalus) == 0 {
+		return
+	}
+	var data []byte
+	for _, n := range nd.nalus {
+		var l [4]byte
+		binary.BigEndian.PutUint32(l[:], uint32(len(n)))
+		data = append(append(data, l[:]...), n...)
+	}
+	nd.accessUnits = append(nd.accessUnits, accessUnit{timestamp: nd.timestamp, data: data})
+	nd.nalus = nil
+}
+
+func (nd *naluDepacketizer) units() []accessUnit { return nd.accessUnits }
+
+// aggregation packet with 16 bit big endian sizes
+func (nd *naluDepacketizer) aggregated(p []byte) {
+	for len(p) >= 2 {
+		size := int(binary.BigEndian.Uint16(p))
+		p = p[2:]
+		if size > len(p) {
+			return
+		}
+		nd.nalus = append(nd.nalus, p[0:size])
+		p = p[size:]
+	}
+}
+
+func (nd *naluDepacketizer) fragment(header []byte, fuHeader byte, p []byte) {
+	if fuHeader&fuStartBit != 0 {
+		nd.fu = append(append([]byte{}, header...), p...)
+	} else if nd.fu != nil {
+		nd.fu = append(nd.fu, p...)
+	}
+	if fuHeader&fuEndBit != 0 && nd.fu != nil {
+		nd.nalus = append(nd.nalus, nd.fu)
+		nd.fu = nil
+	}
+}
+
+func h264Split(nd *naluDepacketizer, p []byte) {
+	if len(p) < 1 {
+		return
+	}
+	switch t := p[0] & 0x1f; {
+	case t >= 1 && t <= 23:
+		nd.nalus = append(nd.nalus, p)
+	case t == h264NALTypeSTAPA:
+		nd.aggregated(p[1:])
+	case t == h264NALTypeFUA:
+		if len(p) < 2 {
+			return
+		}
+		// reconstructed NAL header has forbidden and nri bits from FU indicator
+		nd.fragment([]byte{p[0]&0xe0 | p[1]&0x1f}, p[1], p[2:])
+	}
+}
+
+func hevcSplit(nd *naluDepacketizer, p []byte) {
+	if len(p) < 2 {
+		return
+	}
+	switch t := p[0] >> 1 & 0x3f; {
+	case t < hevcNALTypeAP:
+		nd.nalus = append(nd.nalus, p)
+	case t == hevcNALTypeAP:
+		nd.aggregated(p[2:])
+	case t == hevcNALTypeFU:
+		if len(p) < 3 {
+			return
+		}
+		// reconstructed NAL header has type from FU header
+		nd.fragment([]byte{p[0]&0x81 | (p[2]&0x3f)<<1, p[1]}, p[2], p[3:])
+	}
+}
+
+// mpeg4-generic AAC access units, each wrapped in an ADTS header
+type aacDepacketizer struct {
+	sizeLength       int
+	indexLength      int
+	indexDeltaLength int
+	objectType       int
+	frequencyIndex   int
+	channelConfig    int
+	accessUnits      []accessUnit
+}
+
+func newAACDepacketizer(fmtp map[string]string) *aacDepacketizer {
+	atoi := func(s string) int { n, _ := strconv.Atoi(s); return n }
+	ad := &aacDepacketizer{
+		sizeLength:       atoi(fmtp["sizelength"]),
+		indexLength:      atoi(fmtp["indexlength"]),
+		indexDeltaLength: atoi(fmtp["indexdeltalength"]),
+	}
+	// audio specific config, 5 bit object type, 4 bit frequency index, 4 bit channel configuration
+	if asc, err := hex.DecodeString(fmtp["config"]); err == nil && len(asc) >= 2 {
+		ad.objectType = int(asc[0] >> 3)
+		ad.frequencyIndex = int(asc[0]&0x7)<<1 | int(asc[1]>>7)
+		ad.channelConfig = int(asc[1] >> 3 & 0xf)
+	}
+	return ad
+}
+
+// ADTS can only signal object type 1-4 and no explicit frequency
+func (ad *aacDepacketizer) valid() bool {
+	return ad.sizeLength > 0 && ad.sizeLength <= 32 &&
+		ad.indexLength <= 32 && ad.indexDeltaLength <= 32 &&
+		ad.objectType >= 1 && ad.objectType <= 4 &&
+		ad.frequencyIndex < 13
+}
+
+func (ad *aacDepacketizer) adtsHeader(frameLen int) []byte {
+	return []byte{
+		0xff,
+		0xf1, // sync, mpeg-4, layer 0, protection absent
+		byte((ad.objectType-1)<<6 | ad.frequencyIndex<<2 | ad.channelConfig>>2),
+		byte((ad.channelConfig&3)<<6 | frameLen>>11&3),
+		byte(frameLen >> 3),
+		byte(frameLen&7<<5 | 0x1f), // buffer fullness 0x7ff
+		0xfc,
+	}
+}
+
+func (ad *aacDepacketizer) push(p format.RTPOut) {
+	if !ad.valid() || len(p.Payload) < 2 {
+		return
+	}
+	headersBits := int(binary.BigEndian.Uint16(p.Payload))
+	headersEnd := 2 + (headersBits+7)/8
+	if headersEnd > len(p.Payload) {
+		return
+	}
+	headers := p.Payload[2:headersEnd]
+	var sizes []int
+	for pos := 0; ; {
+		indexLength := ad.indexDeltaLength
+		if pos == 0 {
+			indexLength = ad.indexLength
+		}
+		if pos+ad.sizeLength+indexLength > headersBits {
+			break
+		}
+		sizes = append(sizes, int(bitio.Read64(headers, pos, ad.sizeLength)))
+		pos += ad.sizeLength + indexLength
+	}
+
+	data := p.Payload[headersEnd:]
+	for i, size := range sizes {
+		if size > len(data) {
+			return
+		}
+		frame := append(ad.adtsHeader(7+size), data[0:size]...)
+		ad.accessUnits = append(ad.accessUnits, accessUnit{
+			timestamp: p.Timestamp + uint32(i*aacFrameSamples),
+			data:      frame,
+		})
+		data = data[size:]
+	}
+}
+
+func (ad *aacDepacketizer) flush() {}
+
+func (ad *aacDepacketizer) units() []accessUnit { return ad.accessUnits }
+
+// returns nil if encoding is not supported
+func newDepacketizer(m format.SDPRTPMap, fmtp map[string]string) depacketizer {
+	switch strings.ToUpper(m.EncodingName) {
+	case "H264":
+		return &naluDepacketizer{splitFn: h264Split}
+	case "H265":
+		return &naluDepacketizer{splitFn: hevcSplit}
+	case "MPEG4-GENERIC":
+		if strings.EqualFold(fmtp["mode"], "AAC-hbr") || strings.EqualFold(fmtp["mode"], "AAC-lbr") {
+			return newAACDepacketizer(fmtp)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,438 @@
+package rtsp
+
+// https://datatracker.ietf.org/doc/html/rfc2326 Real Time Streaming Protocol (RTSP)
+// https://datatracker.ietf.org/doc/html/rfc7826 RTSP 2.0
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/internal/lineparse"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var rtpFormat decode.Group
+var rtcpFormat decode.Group
+var sdpFormat decode.Group
+var avcAUFormat decode.Group
+var avcNALUFormat decode.Group
+var hevcAUFormat decode.Group
+var hevcNALUFormat decode.Group
+var adtsFrameFormat decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.RTSP,
+		Description: "Real Time Streaming Protocol",
+		Groups:      []string{format.TCP_STREAM},
+		DecodeFn:    rtspDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.RTP}, Group: &rtpFormat},
+			{Names: []string{format.RTCP}, Group: &rtcpFormat},
+			{Names: []string{format.SDP}, Group: &sdpFormat},
+			{Names: []string{format.AVC_AU}, Group: &avcAUFormat},
+			{Names: []string{format.AVC_NALU}, Group: &avcNALUFormat},
+			{Names: []string{format.HEVC_AU}, Group: &hevcAUFormat},
+			{Names: []string{format.HEVC_NALU}, Group: &hevcNALUFormat},
+			{Names: []string{format.ADTS_FRAME}, Group: &adtsFrameFormat},
+		},
+	})
+}
+
+const (
+	rtspVersionPrefix = "RTSP/"
+	interleavedMagic  = '$'
+	// RTCP packet types sender report to application defined
+	rtcpTypeFirst = 200
+	rtcpTypeLast  = 204
+)
+
+// length of access unit length prefix added by depacketizer
+const naluLengthSize = 4
+
+// max length of start line without CRLF
+const maxStartLineLen = 4096
+
+var statusCodeNames = scalar.UToSymStr{
+	100: "continue",
+	200: "ok",
+	201: "created",
+	250: "low_on_storage_space",
+	300: "multiple_choices",
+	301: "moved_permanently",
+	302: "moved_temporarily",
+	303: "see_other",
+	304: "not_modified",
+	305: "use_proxy",
+	400: "bad_request",
+	401: "unauthorized",
+	402: "payment_required",
+	403: "forbidden",
+	404: "not_found",
+	405: "method_not_allowed",
+	406: "not_acceptable",
+	407: "proxy_authentication_required",
+	408: "request_timeout",
+	410: "gone",
+	411: "length_required",
+	412: "precondition_failed",
+	413: "request_entity_too_large",
+	414: "request_uri_too_large",
+	415: "unsupported_media_type",
+	451: "parameter_not_understood",
+	452: "conference_not_found",
+	453: "not_enough_bandwidth",
+	454: "session_not_found",
+	455: "method_not_valid_in_this_state",
+	456: "header_field_not_valid_for_resource",
+	457: "invalid_range",
+	458: "parameter_is_read_only",
+	459: "aggregate_operation_not_allowed",
+	460: "only_aggregate_operation_allowed",
+	461: "unsupported_transport",
+	462: "destination_unreachable",
+	500: "internal_server_error",
+	501: "not_implemented",
+	502: "bad_gateway",
+	503: "service_unavailable",
+	504: "gateway_timeout",
+	505: "rtsp_version_not_supported",
+	551: "option_not_supported",
+}
+
+// start line is "<method> <uri> RTSP/x.y" or "RTSP/x.y <status code> <reason>"
+func isStartLine(s string) bool {
+	if strings.HasPrefix(s, rtspVersionPrefix) {
+		return true
+	}
+	parts := strings.Split(s, " ")
+	return len(parts) == 3 && strings.HasPrefix(parts[2], rtspVersionPrefix)
+}
+
+type streamKey struct {
+	channel     int
+	payloadType int
+}
+
+type stream struct {
+	streamKey
+	rtpMap       format.SDPRTPMap
+	fmtp         map[string]string
+	depacketizer depacketizer
+}
+
+type rtspDecoder struct {
+	// from session descriptions, keyed by payload type
+	rtpMaps map[int]format.SDPRTPMap
+	fmtps   map[int]map[string]string
+	streams map[streamKey]*stream
+	order   []*stream
+}
+
+func (rd *rtspDecoder) addSDP(out format.SDPOut) {
+	for _, m := range out.Media {
+		for pt, rm := range m.RTPMaps {
+			rd.rtpMaps[pt] = rm
+		}
+		for pt, fmtp := range m.FMTPs {
+			rd.fmtps[pt] = fmtp
+		}
+	}
+}
+
+func (rd *rtspDecoder) addRTP(channel int, p format.RTPOut) {
+	k := streamKey{channel: channel, payloadType: p.PayloadType}
+	s, ok := rd.streams[k]
+	if !ok {
+		rm, ok := rd.rtpMaps[p.PayloadType]
+		if !ok {
+			return
+		}
+		fmtp := rd.fmtps[p.PayloadType]
+		s = &stream{
+			streamKey:    k,
+			rtpMap:       rm,
+			fmtp:         fmtp,
+			depacketizer: newDepacketizer(rm, fmtp),
+		}
+		rd.streams[k] = s
+		rd.order = append(rd.order, s)
+	}
+	if s.depacketizer != nil {
+		s.depacketizer.push(p)
+	}
+}
+
+// returns false if message is incomplete
+func (rd *rtspDecoder) decodeMessage(d *decode.D, b []byte, pos int) (int, bool) {
+	headerEnd := bytes.Index(b[pos:], []byte("\r\n\r\n"))
+	if headerEnd == -1 {
+		return pos, false
+	}
+	headerEnd += pos + 4
+
+	var lines []lineparse.Line
+	for p := pos; p < headerEnd-2; {
+		end := p + bytes.Index(b[p:], []byte("\r\n")) + 2
+		lines = append(lines, lineparse.Line{Start: p, End: end})
+		p = end
+	}
+	// empty line ends the headers, make it part of last line
+	lines[len(lines)-1].End = headerEnd
+
+	startLine := lineparse.Split(b, lines[0].Start, lines[0].End, 3)
+	isResponse := strings.HasPrefix(startLine.Value, rtspVersionPrefix)
+	name := "request"
+	if isResponse {
+		name = "response"
+	}
+
+	var contentLength int
+	var contentType string
+	end := headerEnd
+	complete := true
+	d.FieldStruct(name, func(d *decode.D) {
+		if isResponse {
+			lineparse.FieldToken(d, startLine, 0, "version")
+			lineparse.FieldTokenU(d, startLine, 1, "status_code", statusCodeNames)
+			if len(startLine.Tokens) > 2 {
+				lineparse.FieldToken(d, startLine, 2, "reason")
+			}
+		} else {
+			lineparse.FieldToken(d, startLine, 0, "method")
+			lineparse.FieldToken(d, startLine, 1, "uri")
+			lineparse.FieldToken(d, startLine, 2, "version")
+		}
+
+		d.FieldArray("headers", func(d *decode.D) {
+			for _, l := range lines[1:] {
+				l = lineparse.Split(b, l.Start, l.End, 1)
+				i := strings.IndexByte(l.Value, ':')
+				if i == -1 {
+					d.Fatalf("invalid header %q", l.Value)
+				}
+				headerName := l.Value[0:i]
+				value := strings.TrimSpace(l.Value[i+1:])
+				d.FieldStruct("header", func(d *decode.D) {
+					lineparse.FieldStr(d, l.Start, l.Start+i+1, "name", headerName)
+					lineparse.FieldStr(d, l.Start+i+1, l.End, "value", value)
+				})
+				switch strings.ToLower(headerName) {
+				case "content-length":
+					n, err := strconv.Atoi(value)
+					if err != nil || n < 0 {
+						d.Fatalf("invalid content length %q", value)
+					}
+					contentLength = n
+				case "content-type":
+					contentType = strings.ToLower(strings.TrimSpace(strings.Split(value, ";")[0]))
+				}
+			}
+		})
+
+		if contentLength == 0 {
+			return
+		}
+		d.SeekAbs(int64(headerEnd) * 8)
+		if headerEnd+contentLength > len(b) {
+			complete = false
+			return
+		}
+		end = headerEnd + contentLength
+		if contentType == "application/sdp" {
+			dv, v, _ := d.TryFieldFormatLen("body", int64(contentLength)*8, sdpFormat, nil)
+			if dv != nil {
+				sdpOut, ok := v.(format.SDPOut)
+				if !ok {
+					panic(fmt.Sprintf("expected SDPOut got %#+v", v))
+				}
+				rd.addSDP(sdpOut)
+				return
+			}
+		}
+		d.FieldRawLen("body", int64(contentLength)*8)
+	})
+
+	return end, complete
+}
+
+// returns false if frame is incomplete
+func (rd *rtspDecoder) decodeInterleavedFrame(d *decode.D, b []byte, pos int) (int, bool) {
+	if pos+4 > len(b) {
+		return pos, false
+	}
+	length := int(b[pos+2])<<8 | int(b[pos+3])
+	end := pos + 4 + length
+	if end > len(b) {
+		return pos, false
+	}
+
+	d.SeekAbs(int64(pos) * 8)
+	d.FieldStruct("interleaved_frame", func(d *decode.D) {
+		d.FieldU8("magic", d.AssertU(interleavedMagic), scalar.Hex)
+		channel := d.FieldU8("channel")
+		d.FieldU16("length")
+		if length >= 2 && b[pos+5] >= rtcpTypeFirst && b[pos+5] <= rtcpTypeLast {
+			if dv, _, _ := d.TryFieldFormatLen("packet", int64(length)*8, rtcpFormat, nil); dv != nil {
+				return
+			}
+		} else {
+			dv, v, _ := d.TryFieldFormatLen("packet", int64(length)*8, rtpFormat, nil)
+			if dv != nil {
+				rtpOut, ok := v.(format.RTPOut)
+				if !ok {
+					panic(fmt.Sprintf("expected RTPOut got %#+v", v))
+				}
+				rd.addRTP(int(channel), rtpOut)
+				return
+			}
+		}
+		d.FieldRawLen("packet", int64(length)*8)
+	})
+
+	return end, true
+}
+
+func fieldParameterSets(d *decode.D, s *stream) {
+	var group decode.Group
+	var sets []string
+	switch strings.ToUpper(s.rtpMap.EncodingName) {
+	case "H264":
+		group = avcNALUFormat
+		if v := s.fmtp["sprop-parameter-sets"]; v != "" {
+			sets = strings.Split(v, ",")
+		}
+	case "H265":
+		group = hevcNALUFormat
+		for _, k := range []string{"sprop-vps", "sprop-sps", "sprop-pps"} {
+			if v := s.fmtp[k]; v != "" {
+				sets = append(sets, strings.Split(v, ",")...)
+			}
+		}
+	}
+	if len(sets) == 0 {
+		return
+	}
+	d.FieldArray("parameter_sets", func(d *decode.D) {
+		for _, set := range sets {
+			nalu, err := base64.StdEncoding.DecodeString(set)
+			if err != nil {
+				continue
+			}
+			bb := bitio.NewBufferFromBytes(nalu, -1)
+			if dv, _, _ := d.TryFieldFormatBitBuf("nalu", bb, group, nil); dv == nil {
+				d.FieldRootBitBuf("nalu", bb)
+			}
+		}
+	})
+}
+
+func fieldAccessUnits(d *decode.D, s *stream) {
+	var group decode.Group
+	var inArg interface{}
+	switch strings.ToUpper(s.rtpMap.EncodingName) {
+	case "H264":
+		group = avcAUFormat
+		inArg = format.AvcIn{LengthSize: naluLengthSize}
+	case "H265":
+		group = hevcAUFormat
+		inArg = format.HevcIn{LengthSize: naluLengthSize}
+	default:
+		group = adtsFrameFormat
+	}
+
+	aus := s.depacketizer.units()
+	d.FieldArray("access_units", func(d *decode.D) {
+		for _, au := range aus {
+			d.FieldStruct("access_unit", func(d *decode.D) {
+				d.FieldValueU("timestamp", uint64(au.timestamp))
+				if s.rtpMap.ClockRate > 0 {
+					// relative to first access unit, wraps at 32 bit
+					d.FieldValueFloat("time", float64(au.timestamp-aus[0].timestamp)/float64(s.rtpMap.ClockRate))
+				}
+				bb := bitio.NewBufferFromBytes(au.data, -1)
+				if dv, _, _ := d.TryFieldFormatBitBuf("data", bb, group, inArg); dv == nil {
+					d.FieldRootBitBuf("data", bb)
+				}
+			})
+		}
+	})
+}
+
+func rtspDecode(d *decode.D, in interface{}) interface{} {
+	// check start line before reading whole input as probe tries all files
+	peekLen := d.Len() / 8
+	if peekLen > maxStartLineLen+2 {
+		peekLen = maxStartLineLen + 2
+	}
+	prefix := d.PeekBytes(int(peekLen))
+	firstLine := prefix
+	if i := bytes.Index(prefix, []byte("\r\n")); i != -1 {
+		firstLine = prefix[0:i]
+	} else if peekLen < d.Len()/8 {
+		d.Fatalf("no RTSP start line")
+	}
+	if !isStartLine(string(firstLine)) {
+		d.Fatalf("no RTSP start line")
+	}
+
+	b := d.BytesLen(int(d.Len() / 8))
+	d.SeekAbs(0)
+
+	rd := &rtspDecoder{
+		rtpMaps: map[int]format.SDPRTPMap{},
+		fmtps:   map[int]map[string]string{},
+		streams: map[streamKey]*stream{},
+	}
+
+	d.FieldArray("messages", func(d *decode.D) {
+		for pos := 0; pos < len(b); {
+			var complete bool
+			if b[pos] == interleavedMagic {
+				pos, complete = rd.decodeInterleavedFrame(d, b, pos)
+			} else {
+				pos, complete = rd.decodeMessage(d, b, pos)
+			}
+			if !complete {
+				// truncated, rest ends up as unknown
+				d.SeekAbs(int64(pos) * 8)
+				break
+			}
+			d.SeekAbs(int64(pos) * 8)
+		}
+	})
+
+	for _, s := range rd.order {
+		if s.depacketizer != nil {
+			s.depacketizer.flush()
+		}
+	}
+	sort.SliceStable(rd.order, func(i, j int) bool { return rd.order[i].channel < rd.order[j].channel })
+
+	if len(rd.order) > 0 {
+		d.FieldArray("streams", func(d *decode.D) {
+			for _, s := range rd.order {
+				d.FieldStruct("stream", func(d *decode.D) {
+					d.FieldValueU("channel", uint64(s.channel))
+					d.FieldValueU("payload_type", uint64(s.payloadType))
+					d.FieldValueStr("encoding_name", s.rtpMap.EncodingName)
+					d.FieldValueU("clock_rate", uint64(s.rtpMap.ClockRate))
+					fieldParameterSets(d, s)
+					if s.depacketizer != nil {
+						fieldAccessUnits(d, s)
+					}
+				})
+			}
+		})
+	}
+
+	return nil
+}
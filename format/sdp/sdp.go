@@ -0,0 +1,334 @@
+package sdp
+
+// https://datatracker.ietf.org/doc/html/rfc8866 SDP: Session Description Protocol
+// https://datatracker.ietf.org/doc/html/rfc4566
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/internal/lineparse"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.SDP,
+		Description: "Session Description Protocol",
+		Groups:      []string{format.PROBE},
+		Magic: []decode.Magic{
+			{Bytes: []byte("v=0\r\n")},
+			{Bytes: []byte("v=0\n")},
+		},
+		DecodeFn: sdpDecode,
+	})
+}
+
+var mediaNames = scalar.StrToScalar{
+	"audio":       {Description: "Audio"},
+	"video":       {Description: "Video"},
+	"text":        {Description: "Text"},
+	"application": {Description: "Application"},
+	"message":     {Description: "Message"},
+}
+
+type line struct {
+	lineparse.Line // value and tokens are after "<type>="
+	typ            byte
+}
+
+func parseLine(b []byte, start int, end int) line {
+	s := bytes.TrimRight(b[start:end], "\r\n")
+	if len(s) < 2 || s[1] != '=' {
+		return line{Line: lineparse.Line{Start: start, End: end}}
+	}
+	l := line{Line: lineparse.Split(b, start+2, end, 0), typ: s[0]}
+	l.Start = start
+	return l
+}
+
+func fieldLine(d *decode.D, l line, name string) string {
+	return lineparse.FieldStr(d, l.Start, l.End, name, l.Value)
+}
+
+func fieldConnection(d *decode.D, l line) {
+	d.FieldStruct("connection", func(d *decode.D) {
+		lineparse.FieldToken(d, l.Line, 0, "network_type")
+		lineparse.FieldToken(d, l.Line, 1, "address_type")
+		lineparse.FieldToken(d, l.Line, 2, "address")
+	})
+}
+
+func fieldTiming(d *decode.D, l line) {
+	d.FieldStruct("timing", func(d *decode.D) {
+		lineparse.FieldTokenU(d, l.Line, 0, "start_time")
+		lineparse.FieldTokenU(d, l.Line, 1, "stop_time")
+	})
+}
+
+// a=<name>[:<value>]
+func fieldAttribute(d *decode.D, l line, out *format.SDPMedia) {
+	d.FieldStruct("attribute", func(d *decode.D) {
+		name, value := l.Value, ""
+		valueStart := l.End
+		if i := strings.IndexByte(l.Value, ':'); i != -1 {
+			name, value = l.Value[0:i], l.Value[i+1:]
+			valueStart = l.Start + 2 + i + 1
+		}
+		lineparse.FieldStr(d, l.Start, valueStart, "name", name)
+		if valueStart == l.End {
+			return
+		}
+		lineparse.FieldStr(d, valueStart, l.End, "value", value)
+
+		if out == nil {
+			return
+		}
+		switch name {
+		case "control":
+			out.Control = value
+		case "rtpmap":
+			// <payload type> <encoding name>/<clock rate>[/<encoding parameters>]
+			pt, rest := cut(value, ' ')
+			ptN, err := strconv.Atoi(pt)
+			if err != nil {
+				return
+			}
+			parts := strings.Split(strings.TrimSpace(rest), "/")
+			m := format.SDPRTPMap{EncodingName: parts[0]}
+			d.FieldValueU("payload_type", uint64(ptN))
+			d.FieldValueStr("encoding_name", m.EncodingName)
+			if len(parts) > 1 {
+				if n, err := strconv.Atoi(parts[1]); err == nil {
+					m.ClockRate = n
+					d.FieldValueU("clock_rate", uint64(n))
+				}
+			}
+			if len(parts) > 2 {
+				m.EncodingParameters = parts[2]
+				d.FieldValueStr("encoding_parameters", m.EncodingParameters)
+			}
+			out.RTPMaps[ptN] = m
+		case "fmtp":
+			// <payload type> <parameter>=<value>;...
+			pt, rest := cut(value, ' ')
+			ptN, err := strconv.Atoi(pt)
+			if err != nil {
+				return
+			}
+			d.FieldValueU("payload_type", uint64(ptN))
+			params := map[string]string{}
+			d.FieldStruct("parameters", func(d *decode.D) {
+				for _, p := range strings.Split(rest, ";") {
+					k, v := cut(strings.TrimSpace(p), '=')
+					if k == "" {
+						continue
+					}
+					k = strings.ToLower(k)
+					if _, ok := params[k]; ok {
+						continue
+					}
+					params[k] = v
+					d.FieldValueStr(strings.ReplaceAll(k, "-", "_"), v)
+				}
+			})
+			out.FMTPs[ptN] = params
+		}
+	})
+}
+
+func cut(s string, sep byte) (string, string) {
+	if i := strings.IndexByte(s, sep); i != -1 {
+		return s[0:i], s[i+1:]
+	}
+	return s, ""
+}
+
+// description section, session or media
+type section struct {
+	line        line // m= line for media
+	information *line
+	uri         *line
+	keys        []line
+	emails      []line
+	phones      []line
+	connections []line
+	bandwidths  []line
+	timings     []line
+	repeats     []line
+	timeZones   []line
+	attributes  []line
+}
+
+func (s *section) fields(d *decode.D, out *format.SDPMedia) {
+	if s.information != nil {
+		fieldLine(d, *s.information, "information")
+	}
+	if s.uri != nil {
+		fieldLine(d, *s.uri, "uri")
+	}
+	fieldLines := func(name string, ls []line, fn func(d *decode.D, l line)) {
+		if len(ls) == 0 {
+			return
+		}
+		d.FieldArray(name, func(d *decode.D) {
+			for _, l := range ls {
+				fn(d, l)
+			}
+		})
+	}
+	lineFn := func(name string) func(d *decode.D, l line) {
+		return func(d *decode.D, l line) { fieldLine(d, l, name) }
+	}
+	fieldLines("emails", s.emails, lineFn("email"))
+	fieldLines("phones", s.phones, lineFn("phone"))
+	fieldLines("connections", s.connections, fieldConnection)
+	fieldLines("bandwidths", s.bandwidths, func(d *decode.D, l line) {
+		d.FieldStruct("bandwidth", func(d *decode.D) {
+			i := strings.IndexByte(l.Value, ':')
+			if i == -1 {
+				d.Fatalf("b=: missing bandwidth type")
+			}
+			bwType, bw := l.Value[0:i], l.Value[i+1:]
+			n, err := strconv.ParseUint(bw, 10, 64)
+			if err != nil {
+				d.Fatalf("b=: invalid bandwidth %q", bw)
+			}
+			valueStart := l.Start + 2 + i + 1
+			lineparse.FieldStr(d, l.Start, valueStart, "type", bwType)
+			lineparse.FieldU(d, valueStart, l.End, "bandwidth", n)
+		})
+	})
+	fieldLines("timings", s.timings, fieldTiming)
+	fieldLines("repeat_times", s.repeats, lineFn("repeat_time"))
+	fieldLines("time_zones", s.timeZones, lineFn("time_zone"))
+	fieldLines("keys", s.keys, lineFn("key"))
+	fieldLines("attributes", s.attributes, func(d *decode.D, l line) { fieldAttribute(d, l, out) })
+}
+
+func sdpDecode(d *decode.D, in interface{}) interface{} {
+	b := d.BytesLen(int(d.Len() / 8))
+	d.SeekAbs(0)
+
+	var lines []line
+	for pos := 0; pos < len(b); {
+		end := len(b)
+		if i := bytes.IndexByte(b[pos:], '\n'); i != -1 {
+			end = pos + i + 1
+		}
+		l := parseLine(b, pos, end)
+		pos = end
+		if l.typ == 0 {
+			if len(bytes.TrimSpace(b[l.Start:l.End])) == 0 {
+				// empty line, usually trailing
+				continue
+			}
+			d.Fatalf("invalid line %q", bytes.TrimRight(b[l.Start:l.End], "\r\n"))
+		}
+		lines = append(lines, l)
+	}
+
+	if len(lines) == 0 || lines[0].typ != 'v' {
+		d.Fatalf("no v= line")
+	}
+
+	var version, origin, sessionName *line
+	var session section
+	var media []*section
+	current := &session
+	for i := range lines {
+		l := lines[i]
+		switch l.typ {
+		case 'v':
+			if version != nil {
+				d.Fatalf("multiple v= lines")
+			}
+			version = &l
+		case 'o':
+			origin = &l
+		case 's':
+			sessionName = &l
+		case 'i':
+			current.information = &l
+		case 'u':
+			current.uri = &l
+		case 'e':
+			current.emails = append(current.emails, l)
+		case 'p':
+			current.phones = append(current.phones, l)
+		case 'c':
+			current.connections = append(current.connections, l)
+		case 'b':
+			current.bandwidths = append(current.bandwidths, l)
+		case 't':
+			current.timings = append(current.timings, l)
+		case 'r':
+			current.repeats = append(current.repeats, l)
+		case 'z':
+			current.timeZones = append(current.timeZones, l)
+		case 'k':
+			current.keys = append(current.keys, l)
+		case 'a':
+			current.attributes = append(current.attributes, l)
+		case 'm':
+			current = &section{line: l}
+			media = append(media, current)
+		default:
+			d.Fatalf("unknown line type %c=", l.typ)
+		}
+	}
+
+	var out format.SDPOut
+
+	lineparse.FieldTokenU(d, version.Line, 0, "version")
+	if origin != nil {
+		d.FieldStruct("origin", func(d *decode.D) {
+			l := *origin
+			lineparse.FieldToken(d, l.Line, 0, "username")
+			lineparse.FieldToken(d, l.Line, 1, "session_id")
+			lineparse.FieldToken(d, l.Line, 2, "session_version")
+			lineparse.FieldToken(d, l.Line, 3, "network_type")
+			lineparse.FieldToken(d, l.Line, 4, "address_type")
+			lineparse.FieldToken(d, l.Line, 5, "unicast_address")
+		})
+	}
+	if sessionName != nil {
+		fieldLine(d, *sessionName, "session_name")
+	}
+	session.fields(d, nil)
+	d.FieldArray("media", func(d *decode.D) {
+		for _, s := range media {
+			m := format.SDPMedia{
+				RTPMaps: map[int]format.SDPRTPMap{},
+				FMTPs:   map[int]map[string]string{},
+			}
+			d.FieldStruct("media", func(d *decode.D) {
+				l := s.line
+				m.Media = lineparse.FieldToken(d, l.Line, 0, "media", mediaNames)
+				// <port>[/<number of ports>]
+				port, _ := cut(l.Tokens[0].Value, '/')
+				if len(l.Tokens) > 1 {
+					port, _ = cut(l.Tokens[1].Value, '/')
+				}
+				if n, err := strconv.Atoi(port); err == nil {
+					m.Port = n
+				}
+				lineparse.FieldToken(d, l.Line, 1, "port")
+				m.Proto = lineparse.FieldToken(d, l.Line, 2, "proto")
+				d.FieldArray("formats", func(d *decode.D) {
+					for i := 3; i < len(l.Tokens); i++ {
+						m.Formats = append(m.Formats, lineparse.FieldToken(d, l.Line, i, "format"))
+					}
+				})
+				s.fields(d, &m)
+			})
+			out.Media = append(out.Media, m)
+		}
+	})
+
+	return out
+}
@@ -0,0 +1,720 @@
+package squashfs
+
+// https://dr-emann.github.io/squashfs/
+// https://github.com/plougher/squashfs-tools/blob/master/squashfs-tools/squashfs_fs.h
+// https://snapcraft.io/docs/the-snap-format
+
+// TODO: decode inodes and directories as fields, embedded files reads them separately
+// TODO: other compressors than gzip
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/ranges"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:          format.SQUASHFS,
+		Description:   "SquashFS filesystem (snap package)",
+		Groups:        []string{format.PROBE},
+		Magic:         []decode.Magic{{Bytes: []byte("hsqs")}},
+		DecodeFn:      squashfsDecode,
+		EmbeddedFiles: squashfsEmbeddedFiles,
+	})
+}
+
+const (
+	// metadata blocks has at most 8KiB of uncompressed data
+	metadataBlockLen = 8192
+	tableNotPresent  = 0xffff_ffff_ffff_ffff
+
+	fragmentEntryLen = 16
+	exportEntryLen   = 8
+	idEntryLen       = 4
+	xattrIDEntryLen  = 16
+)
+
+const (
+	compressionGzip = 1
+	compressionLZMA = 2
+	compressionLZO  = 3
+	compressionXZ   = 4
+	compressionLZ4  = 5
+	compressionZstd = 6
+)
+
+var compressionNames = scalar.UToSymStr{
+	compressionGzip: "gzip",
+	compressionLZMA: "lzma",
+	compressionLZO:  "lzo",
+	compressionXZ:   "xz",
+	compressionLZ4:  "lz4",
+	compressionZstd: "zstd",
+}
+
+var flagNames = []struct {
+	bit  uint64
+	name string
+}{
+	{0x0001, "uncompressed_inodes"},
+	{0x0002, "uncompressed_data"},
+	{0x0004, "check"},
+	{0x0008, "uncompressed_fragments"},
+	{0x0010, "no_fragments"},
+	{0x0020, "always_fragments"},
+	{0x0040, "duplicates"},
+	{0x0080, "exportable"},
+	{0x0100, "uncompressed_xattrs"},
+	{0x0200, "no_xattrs"},
+	{0x0400, "compressor_options"},
+	{0x0800, "uncompressed_ids"},
+}
+
+const flagCompressorOptions = 0x0400
+
+var tablePosMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	if v, ok := s.Actual.(uint64); ok && v == tableNotPresent {
+		s.Description = "not present"
+	}
+	return s, nil
+})
+
+type superblock struct {
+	compression       uint64
+	inodeCount        uint64
+	fragmentCount     uint64
+	idCount           uint64
+	flags             uint64
+	bytesUsed         int64
+	idTableStart      uint64
+	xattrIDTableStart uint64
+	inodeTableStart   uint64
+	dirTableStart     uint64
+	fragmentStart     uint64
+	exportTableStart  uint64
+}
+
+func decodeMetadataBlock(d *decode.D, compression uint64) {
+	// stored length with highest bit set if uncompressed
+	header := d.FieldU16("header", scalar.Hex)
+	compressed := header&0x8000 == 0
+	size := int64(header & 0x7fff)
+	d.FieldValueBool("compressed", compressed)
+	d.FieldValueU("size", uint64(size))
+	if compressed && compression == compressionGzip {
+		b := d.BytesRange(d.Pos(), int(size))
+		if zr, err := zlib.NewReader(bytes.NewReader(b)); err == nil {
+			if ub, err := ioutil.ReadAll(zr); err == nil {
+				d.FieldRootBitBuf("uncompressed", bitio.NewBufferFromBytes(ub, -1))
+			}
+		}
+	}
+	d.FieldRawLen("data", size*8)
+}
+
+func decodeMetadataBlocks(d *decode.D, name string, end int64, compression uint64) {
+	d.FieldStructArrayLoop(name, "block", func() bool { return d.Pos() < end*8 }, func(d *decode.D) {
+		decodeMetadataBlock(d, compression)
+	})
+}
+
+// lookup table with positions of the metadata blocks that stores the entries
+func decodeLookupTable(d *decode.D, entries uint64, entryLen uint64) {
+	n := (entries*entryLen + metadataBlockLen - 1) / metadataBlockLen
+	d.FieldArray("lookup_table", func(d *decode.D) {
+		for i := uint64(0); i < n; i++ {
+			d.FieldU64("position", scalar.Hex)
+		}
+	})
+}
+
+func firstLookupPos(d *decode.D, tableStart uint64) int64 {
+	return int64(binary.LittleEndian.Uint64(d.BytesRange(int64(tableStart)*8, 8)))
+}
+
+func squashfsDecode(d *decode.D, in interface{}) interface{} {
+	d.Endian = decode.LittleEndian
+
+	var sb superblock
+	d.FieldStruct("superblock", func(d *decode.D) {
+		d.FieldUTF8("magic", 4, d.AssertStr("hsqs"))
+		sb.inodeCount = d.FieldU32("inode_count")
+		d.FieldU32("modification_time")
+		d.FieldU32("block_size")
+		sb.fragmentCount = d.FieldU32("fragment_entry_count")
+		sb.compression = d.FieldU16("compression_id", compressionNames)
+		d.FieldU16("block_log")
+		d.FieldStruct("flags", func(d *decode.D) {
+			sb.flags = d.FieldU16("value", scalar.Hex)
+			for _, f := range flagNames {
+				d.FieldValueBool(f.name, sb.flags&f.bit != 0)
+			}
+		})
+		sb.idCount = d.FieldU16("id_count")
+		d.FieldU16("version_major", d.AssertU(4))
+		d.FieldU16("version_minor")
+		d.FieldU64("root_inode_ref", scalar.Hex)
+		sb.bytesUsed = int64(d.FieldU64("bytes_used"))
+		sb.idTableStart = d.FieldU64("id_table_start", scalar.Hex)
+		sb.xattrIDTableStart = d.FieldU64("xattr_id_table_start", tablePosMap, scalar.Hex)
+		sb.inodeTableStart = d.FieldU64("inode_table_start", scalar.Hex)
+		sb.dirTableStart = d.FieldU64("directory_table_start", scalar.Hex)
+		sb.fragmentStart = d.FieldU64("fragment_table_start", tablePosMap, scalar.Hex)
+		sb.exportTableStart = d.FieldU64("export_table_start", tablePosMap, scalar.Hex)
+	})
+	if sb.bytesUsed*8 > d.Len() || int64(sb.inodeTableStart) > sb.bytesUsed {
+		d.Fatalf("invalid bytes used or table start")
+	}
+
+	if sb.flags&flagCompressorOptions != 0 {
+		d.FieldStruct("compressor_options", func(d *decode.D) { decodeMetadataBlock(d, sb.compression) })
+	}
+
+	// data and fragment blocks, followed by the metadata tables. Lookup tables
+	// points to metadata blocks stored before the table itself.
+	d.FieldRawLen("data", int64(sb.inodeTableStart)*8-d.Pos())
+
+	type region struct {
+		start int64
+		fn    func(d *decode.D, end int64)
+	}
+	regions := []region{
+		{int64(sb.inodeTableStart), func(d *decode.D, end int64) {
+			decodeMetadataBlocks(d, "inode_table", end, sb.compression)
+		}},
+		{int64(sb.dirTableStart), func(d *decode.D, end int64) {
+			decodeMetadataBlocks(d, "directory_table", end, sb.compression)
+		}},
+	}
+	lookupTable := func(name string, tableStart uint64, entries uint64, entryLen uint64) {
+		if tableStart == tableNotPresent || entries == 0 {
+			return
+		}
+		regions = append(regions, region{firstLookupPos(d, tableStart), func(d *decode.D, end int64) {
+			d.FieldStruct(name, func(d *decode.D) {
+				decodeMetadataBlocks(d, "blocks", int64(tableStart), sb.compression)
+				decodeLookupTable(d, entries, entryLen)
+			})
+		}})
+	}
+	lookupTable("fragment_table", sb.fragmentStart, sb.fragmentCount, fragmentEntryLen)
+	lookupTable("export_table", sb.exportTableStart, sb.inodeCount, exportEntryLen)
+	lookupTable("id_table", sb.idTableStart, sb.idCount, idEntryLen)
+	if sb.xattrIDTableStart != tableNotPresent {
+		// key value metadata blocks, id metadata blocks and then table header
+		kvStart := firstLookupPos(d, sb.xattrIDTableStart)
+		regions = append(regions, region{kvStart, func(d *decode.D, end int64) {
+			d.FieldStruct("xattr_table", func(d *decode.D) {
+				decodeMetadataBlocks(d, "blocks", int64(sb.xattrIDTableStart), sb.compression)
+				d.FieldU64("kv_start", scalar.Hex)
+				count := d.FieldU32("count")
+				d.FieldU32("unused")
+				decodeLookupTable(d, count, xattrIDEntryLen)
+			})
+		}})
+	}
+
+	sort.Slice(regions, func(i, j int) bool { return regions[i].start < regions[j].start })
+	for i, r := range regions {
+		end := sb.bytesUsed
+		if i+1 < len(regions) {
+			end = regions[i+1].start
+		}
+		if r.start < d.Pos()/8 || end > sb.bytesUsed || r.start > end {
+			d.Fatalf("invalid table position %d", r.start)
+		}
+		d.SeekAbs(r.start * 8)
+		r.fn(d, end)
+	}
+	d.SeekAbs(sb.bytesUsed * 8)
+
+	// images are usually padded to 4KiB
+	if d.NotEnd() {
+		d.FieldRawLen("padding", d.BitsLeft())
+	}
+
+	return nil
+}
+
+const (
+	inodeBasicDir     = 1
+	inodeBasicFile    = 2
+	inodeExtendedDir  = 8
+	inodeExtendedFile = 9
+
+	fragmentNone = 0xffff_ffff
+	// data and fragment block sizes has this bit set if stored uncompressed
+	blockUncompressed = 1 << 24
+	// directories can't be nested deeper than this, protects against loops
+	maxDirDepth = 256
+)
+
+var errTruncatedMetadata = errors.New("truncated metadata")
+
+// squashfsReader reads inodes, directories and file data from an image
+type squashfsReader struct {
+	bb                  *bitio.Buffer
+	compression         uint64
+	blockSize           uint64
+	inodeTableStart     uint64
+	dirTableStart       uint64
+	fragmentTableStart  uint64
+	fragmentEntryCount  uint64
+	metadataBlocksCache map[int64]metadataBlock
+}
+
+type metadataBlock struct {
+	data []byte
+	next int64
+}
+
+func (r *squashfsReader) bytes(pos int64, n int64) ([]byte, error) {
+	if pos < 0 || n < 0 || (pos+n)*8 > r.bb.Len() {
+		return nil, fmt.Errorf("invalid range %d-%d", pos, pos+n)
+	}
+	return r.bb.BytesRange(pos*8, int(n))
+}
+
+func (r *squashfsReader) decompress(b []byte, maxLen int64) ([]byte, error) {
+	if r.compression != compressionGzip {
+		return nil, fmt.Errorf("unsupported compression %s", compressionNames[r.compression])
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	ub, err := ioutil.ReadAll(io.LimitReader(zr, maxLen+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(ub)) > maxLen {
+		return nil, fmt.Errorf("decompressed block larger than %d bytes", maxLen)
+	}
+	return ub, nil
+}
+
+func (r *squashfsReader) metadataBlock(pos int64) (metadataBlock, error) {
+	if mb, ok := r.metadataBlocksCache[pos]; ok {
+		return mb, nil
+	}
+	hb, err := r.bytes(pos, 2)
+	if err != nil {
+		return metadataBlock{}, err
+	}
+	header := binary.LittleEndian.Uint16(hb)
+	size := int64(header & 0x7fff)
+	b, err := r.bytes(pos+2, size)
+	if err != nil {
+		return metadataBlock{}, err
+	}
+	if header&0x8000 == 0 {
+		if b, err = r.decompress(b, metadataBlockLen); err != nil {
+			return metadataBlock{}, err
+		}
+	}
+	mb := metadataBlock{data: b, next: pos + 2 + size}
+	r.metadataBlocksCache[pos] = mb
+	return mb, nil
+}
+
+// metadataCursor reads metadata that can continue into following blocks
+type metadataCursor struct {
+	r    *squashfsReader
+	buf  []byte
+	next int64
+}
+
+// cursor at ref, block position relative to tableStart in upper bits and offset
+// in uncompressed block in lower 16 bits
+func (r *squashfsReader) cursor(tableStart uint64, blockPos uint64, offset uint64) (*metadataCursor, error) {
+	mb, err := r.metadataBlock(int64(tableStart + blockPos))
+	if err != nil {
+		return nil, err
+	}
+	if offset > uint64(len(mb.data)) {
+		return nil, errTruncatedMetadata
+	}
+	return &metadataCursor{r: r, buf: mb.data[offset:], next: mb.next}, nil
+}
+
+func (c *metadataCursor) read(n int) ([]byte, error) {
+	var b []byte
+	for len(b) < n {
+		if len(c.buf) == 0 {
+			mb, err := c.r.metadataBlock(c.next)
+			if err != nil {
+				return nil, err
+			}
+			if len(mb.data) == 0 {
+				return nil, errTruncatedMetadata
+			}
+			c.buf = mb.data
+			c.next = mb.next
+		}
+		l := n - len(b)
+		if l > len(c.buf) {
+			l = len(c.buf)
+		}
+		b = append(b, c.buf[:l]...)
+		c.buf = c.buf[l:]
+	}
+	return b, nil
+}
+
+func (c *metadataCursor) u16() (uint64, error) {
+	b, err := c.read(2)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(binary.LittleEndian.Uint16(b)), nil
+}
+
+func (c *metadataCursor) u32() (uint64, error) {
+	b, err := c.read(4)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(binary.LittleEndian.Uint32(b)), nil
+}
+
+func (c *metadataCursor) u64() (uint64, error) {
+	b, err := c.read(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b), nil
+}
+
+type inode struct {
+	typ uint64
+	// directory
+	dirBlock  uint64
+	dirOffset uint64
+	dirSize   uint64
+	// file
+	blocksStart    uint64
+	fileSize       uint64
+	fragmentIndex  uint64
+	fragmentOffset uint64
+	blockSizes     []uint64
+}
+
+func (r *squashfsReader) inode(ref uint64) (inode, error) {
+	c, err := r.cursor(r.inodeTableStart, ref>>16, ref&0xffff)
+	if err != nil {
+		return inode{}, err
+	}
+	// type, permissions, uid, gid, modification time and inode number
+	h, err := c.read(16)
+	if err != nil {
+		return inode{}, err
+	}
+	in := inode{typ: uint64(binary.LittleEndian.Uint16(h))}
+
+	// fields are read in order, error is checked once at the end
+	var fieldErr error
+	u16 := func() uint64 { v, err := c.u16(); fieldErr = firstErr(fieldErr, err); return v }
+	u32 := func() uint64 { v, err := c.u32(); fieldErr = firstErr(fieldErr, err); return v }
+	u64 := func() uint64 { v, err := c.u64(); fieldErr = firstErr(fieldErr, err); return v }
+
+	switch in.typ {
+	case inodeBasicDir:
+		in.dirBlock = u32()
+		u32() // link count
+		in.dirSize = u16()
+		in.dirOffset = u16()
+	case inodeExtendedDir:
+		u32() // link count
+		in.dirSize = u32()
+		in.dirBlock = u32()
+		u32() // parent inode
+		u16() // index count
+		in.dirOffset = u16()
+	case inodeBasicFile:
+		in.blocksStart = u32()
+		in.fragmentIndex = u32()
+		in.fragmentOffset = u32()
+		in.fileSize = u32()
+	case inodeExtendedFile:
+		in.blocksStart = u64()
+		in.fileSize = u64()
+		u64() // sparse
+		u32() // link count
+		in.fragmentIndex = u32()
+		in.fragmentOffset = u32()
+		u32() // xattr index
+	default:
+		return in, nil
+	}
+	if fieldErr != nil {
+		return inode{}, fieldErr
+	}
+
+	if in.typ == inodeBasicFile || in.typ == inodeExtendedFile {
+		n := in.fileSize / r.blockSize
+		if in.fragmentIndex == fragmentNone && in.fileSize%r.blockSize != 0 {
+			n++
+		}
+		// each block size is 4 bytes of metadata, sanity check against image size
+		if n*4 > uint64(r.bb.Len()/8) {
+			return inode{}, fmt.Errorf("invalid file size %d", in.fileSize)
+		}
+		in.blockSizes = make([]uint64, n)
+		for i := range in.blockSizes {
+			in.blockSizes[i] = u32()
+		}
+		if fieldErr != nil {
+			return inode{}, fieldErr
+		}
+	}
+
+	return in, nil
+}
+
+func firstErr(a, b error) error {
+	if a != nil {
+		return a
+	}
+	return b
+}
+
+type dirEntry struct {
+	name     string
+	typ      uint64
+	inodeRef uint64
+}
+
+func (r *squashfsReader) dirEntries(in inode) ([]dirEntry, error) {
+	// size includes 3 bytes for implicit . and .. entries
+	if in.dirSize <= 3 {
+		return nil, nil
+	}
+	c, err := r.cursor(r.dirTableStart, in.dirBlock, in.dirOffset)
+	if err != nil {
+		return nil, err
+	}
+	b, err := c.read(int(in.dirSize - 3))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []dirEntry
+	for len(b) > 0 {
+		// header with count-1, inode metadata block position and base inode number
+		if len(b) < 12 {
+			return nil, errTruncatedMetadata
+		}
+		count := uint64(binary.LittleEndian.Uint32(b[0:])) + 1
+		start := uint64(binary.LittleEndian.Uint32(b[4:]))
+		b = b[12:]
+		for i := uint64(0); i < count; i++ {
+			// offset, inode number offset, type and name size-1
+			if len(b) < 8 {
+				return nil, errTruncatedMetadata
+			}
+			offset := uint64(binary.LittleEndian.Uint16(b[0:]))
+			typ := uint64(binary.LittleEndian.Uint16(b[4:]))
+			nameLen := int(binary.LittleEndian.Uint16(b[6:])) + 1
+			b = b[8:]
+			if len(b) < nameLen {
+				return nil, errTruncatedMetadata
+			}
+			entries = append(entries, dirEntry{
+				name:     string(b[:nameLen]),
+				typ:      typ,
+				inodeRef: start<<16 | offset,
+			})
+			b = b[nameLen:]
+		}
+	}
+
+	return entries, nil
+}
+
+// fragment block position and on disk size for fragment index
+func (r *squashfsReader) fragment(index uint64) (uint64, uint64, error) {
+	if r.fragmentTableStart == tableNotPresent || index >= r.fragmentEntryCount {
+		return 0, 0, fmt.Errorf("invalid fragment index %d", index)
+	}
+	entriesPerBlock := uint64(metadataBlockLen / fragmentEntryLen)
+	lb, err := r.bytes(int64(r.fragmentTableStart+index/entriesPerBlock*8), 8)
+	if err != nil {
+		return 0, 0, err
+	}
+	c, err := r.cursor(0, binary.LittleEndian.Uint64(lb), index%entriesPerBlock*fragmentEntryLen)
+	if err != nil {
+		return 0, 0, err
+	}
+	start, err := c.u64()
+	if err != nil {
+		return 0, 0, err
+	}
+	size, err := c.u32()
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, size, nil
+}
+
+// block on disk size and data, sparse blocks has size zero
+func (r *squashfsReader) dataBlock(b []byte, size uint64, maxLen int64) ([]byte, error) {
+	switch {
+	case size == 0:
+		return make([]byte, maxLen), nil
+	case size&blockUncompressed != 0:
+		return b, nil
+	default:
+		return r.decompress(b, maxLen)
+	}
+}
+
+func (r *squashfsReader) file(name string, in inode) (decode.EmbeddedFile, error) {
+	var storedLen uint64
+	for _, s := range in.blockSizes {
+		storedLen += s &^ blockUncompressed
+	}
+	ef := decode.EmbeddedFile{
+		Name:  name,
+		Range: ranges.Range{Start: int64(in.blocksStart) * 8, Len: int64(storedLen) * 8},
+		Size:  int64(in.fileSize),
+	}
+	if in.blocksStart+storedLen > uint64(r.bb.Len()/8) {
+		return ef, fmt.Errorf("%s: invalid data blocks position", name)
+	}
+
+	ef.Decompress = func(rd io.Reader) (io.Reader, error) {
+		var out []byte
+		left := in.fileSize
+		for _, s := range in.blockSizes {
+			b := make([]byte, s&^blockUncompressed)
+			if _, err := io.ReadFull(rd, b); err != nil {
+				return nil, err
+			}
+			blockLen := r.blockSize
+			if left < blockLen {
+				blockLen = left
+			}
+			ub, err := r.dataBlock(b, s, int64(blockLen))
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, ub...)
+			left -= uint64(len(ub))
+		}
+		// file ends with a fragment, a block with tails of multiple files
+		if in.fragmentIndex != fragmentNone && left > 0 {
+			start, size, err := r.fragment(in.fragmentIndex)
+			if err != nil {
+				return nil, err
+			}
+			b, err := r.bytes(int64(start), int64(size&^blockUncompressed))
+			if err != nil {
+				return nil, err
+			}
+			fb, err := r.dataBlock(b, size|boolToBlockUncompressed(size == 0), int64(r.blockSize))
+			if err != nil {
+				return nil, err
+			}
+			if in.fragmentOffset+left > uint64(len(fb)) {
+				return nil, fmt.Errorf("invalid fragment offset %d", in.fragmentOffset)
+			}
+			out = append(out, fb[in.fragmentOffset:in.fragmentOffset+left]...)
+		}
+		return bytes.NewReader(out), nil
+	}
+
+	return ef, nil
+}
+
+func boolToBlockUncompressed(b bool) uint64 {
+	if b {
+		return blockUncompressed
+	}
+	return 0
+}
+
+func (r *squashfsReader) walk(prefix string, in inode, depth int, efs *[]decode.EmbeddedFile) error {
+	if depth > maxDirDepth {
+		return fmt.Errorf("%s: directories nested too deep", prefix)
+	}
+	entries, err := r.dirEntries(in)
+	if err != nil {
+		return fmt.Errorf("%s: %w", prefix, err)
+	}
+	for _, e := range entries {
+		if e.name == "" || e.name == "." || e.name == ".." || strings.Contains(e.name, "/") {
+			return fmt.Errorf("%s: invalid name %q", prefix, e.name)
+		}
+		name := prefix + e.name
+		ein, err := r.inode(e.inodeRef)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		switch ein.typ {
+		case inodeBasicDir, inodeExtendedDir:
+			*efs = append(*efs, decode.EmbeddedFile{Name: name + "/", Dir: true})
+			if err := r.walk(name+"/", ein, depth+1, efs); err != nil {
+				return err
+			}
+		case inodeBasicFile, inodeExtendedFile:
+			ef, err := r.file(name, ein)
+			if err != nil {
+				return err
+			}
+			*efs = append(*efs, ef)
+		}
+		// symlinks, devices, fifos and sockets are skipped
+	}
+	return nil
+}
+
+// regular files and directories by walking directory tables from root inode
+func squashfsEmbeddedFiles(v *decode.Value) ([]decode.EmbeddedFile, error) {
+	sbV := v.Child("superblock")
+	u := func(name string) uint64 {
+		n, _ := sbV.Child(name).Scalar().Actual.(uint64)
+		return n
+	}
+	r := &squashfsReader{
+		bb:                  v.RootBitBuf,
+		compression:         u("compression_id"),
+		blockSize:           u("block_size"),
+		inodeTableStart:     u("inode_table_start"),
+		dirTableStart:       u("directory_table_start"),
+		fragmentTableStart:  u("fragment_table_start"),
+		fragmentEntryCount:  u("fragment_entry_count"),
+		metadataBlocksCache: map[int64]metadataBlock{},
+	}
+	if r.blockSize == 0 {
+		return nil, fmt.Errorf("invalid block size")
+	}
+
+	rootRef := u("root_inode_ref")
+	root, err := r.inode(rootRef)
+	if err != nil {
+		return nil, fmt.Errorf("root inode: %w", err)
+	}
+	if root.typ != inodeBasicDir && root.typ != inodeExtendedDir {
+		return nil, fmt.Errorf("root inode is not a directory")
+	}
+	var efs []decode.EmbeddedFile
+	if err := r.walk("", root, 0, &efs); err != nil {
+		return nil, err
+	}
+
+	return efs, nil
+}
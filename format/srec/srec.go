@@ -0,0 +1,217 @@
+package srec
+
+// https://en.wikipedia.org/wiki/SREC_(file_format)
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strconv"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var probeFormat decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.SREC,
+		Description: "Motorola S-record",
+		DecodeFn:    srecDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.PROBE}, Group: &probeFormat},
+		},
+	})
+}
+
+const (
+	recordTypeHeader   = 0
+	recordTypeData16   = 1
+	recordTypeData24   = 2
+	recordTypeData32   = 3
+	recordTypeReserved = 4
+	recordTypeCount16  = 5
+	recordTypeCount24  = 6
+	recordTypeStart32  = 7
+	recordTypeStart24  = 8
+	recordTypeStart16  = 9
+)
+
+var recordTypeNames = scalar.UToSymStr{
+	recordTypeHeader:   "header",
+	recordTypeData16:   "data_16",
+	recordTypeData24:   "data_24",
+	recordTypeData32:   "data_32",
+	recordTypeReserved: "reserved",
+	recordTypeCount16:  "count_16",
+	recordTypeCount24:  "count_24",
+	recordTypeStart32:  "start_address_32",
+	recordTypeStart24:  "start_address_24",
+	recordTypeStart16:  "start_address_16",
+}
+
+// number of address bytes for record type
+var recordTypeAddressBytes = map[uint64]int{
+	recordTypeHeader:  2,
+	recordTypeData16:  2,
+	recordTypeData24:  3,
+	recordTypeData32:  4,
+	recordTypeCount16: 2,
+	recordTypeCount24: 3,
+	recordTypeStart32: 4,
+	recordTypeStart24: 3,
+	recordTypeStart16: 2,
+}
+
+// gaps between data records are filled with this, erased flash
+const fillByte = 0xff
+
+// don't flatten to a binary larger than this, ex sparse address space
+const maxBinaryBytes = 64 * 1024 * 1024
+
+// hex encoded number of nBytes bytes, two characters per byte
+func fieldHexU(d *decode.D, name string, nBytes int, sms ...scalar.Mapper) uint64 {
+	return d.FieldUFn(name, func(d *decode.D) uint64 {
+		s := d.UTF8(nBytes * 2)
+		n, err := strconv.ParseUint(s, 16, 64)
+		if err != nil {
+			d.Fatalf("%s: invalid hex %q", name, s)
+		}
+		return n
+	}, sms...)
+}
+
+type chunk struct {
+	address uint64
+	data    []byte
+}
+
+func srecDecode(d *decode.D, in interface{}) interface{} {
+	var chunks []chunk
+	dataRecords := uint64(0)
+	seenTermination := false
+
+	if d.End() {
+		d.Fatalf("no records found")
+	}
+
+	d.FieldArray("records", func(d *decode.D) {
+		for !seenTermination && !d.End() {
+			if c := d.PeekBytes(1)[0]; c != 'S' {
+				d.Fatalf("expected record start code %q found %q", 'S', c)
+			}
+
+			d.FieldStruct("record", func(d *decode.D) {
+				d.FieldUTF8("start_code", 1)
+				recordType := d.FieldUFn("record_type", func(d *decode.D) uint64 {
+					c := d.U8()
+					if c < '0' || c > '9' {
+						d.Fatalf("invalid record type %q", c)
+					}
+					return c - '0'
+				}, recordTypeNames)
+				addressBytes, ok := recordTypeAddressBytes[recordType]
+				if !ok {
+					d.Fatalf("unsupported record type %d", recordType)
+				}
+				// count of address, data and checksum bytes
+				byteCount := fieldHexU(d, "byte_count", 1)
+				if byteCount < uint64(addressBytes)+1 {
+					d.Fatalf("byte count %d too small for %d address bytes", byteCount, addressBytes)
+				}
+				dataBytes := int(byteCount) - addressBytes - 1
+
+				addressText := string(d.PeekBytes(addressBytes * 2))
+				dataText := string(d.PeekBytes(addressBytes*2 + dataBytes*2))[addressBytes*2:]
+				addressData, err := hex.DecodeString(addressText)
+				if err != nil {
+					d.Fatalf("invalid address hex %q", addressText)
+				}
+				data, err := hex.DecodeString(dataText)
+				if err != nil {
+					d.Fatalf("invalid data hex %q", dataText)
+				}
+
+				switch recordType {
+				case recordTypeHeader:
+					fieldHexU(d, "address", addressBytes, scalar.Hex)
+					d.FieldUTF8("data", dataBytes*2)
+					d.FieldValueStr("text", string(bytes.TrimRight(data, "\x00")))
+				case recordTypeData16, recordTypeData24, recordTypeData32:
+					address := fieldHexU(d, "address", addressBytes, scalar.Hex)
+					d.FieldUTF8("data", dataBytes*2)
+					chunks = append(chunks, chunk{address: address, data: data})
+					dataRecords++
+				case recordTypeCount16, recordTypeCount24:
+					fieldHexU(d, "record_count", addressBytes, d.ValidateU(dataRecords))
+				case recordTypeStart32, recordTypeStart24, recordTypeStart16:
+					fieldHexU(d, "start_address", addressBytes, scalar.Hex)
+					seenTermination = true
+				}
+				// count and termination records should have no data
+				if dataBytes > 0 && recordType >= recordTypeCount16 {
+					d.FieldUTF8("data", dataBytes*2)
+				}
+
+				// ones' complement of the least significant byte of the sum of
+				// byte count, address and data bytes
+				sum := byte(byteCount)
+				for _, b := range addressData {
+					sum += b
+				}
+				for _, b := range data {
+					sum += b
+				}
+				fieldHexU(d, "checksum", 1, scalar.Hex)
+				d.ValueChecksumU(d.FieldMustGet("checksum"), "sum8", uint64(^sum))
+
+				// line ending and empty lines
+				n := 0
+				for int64(n) < d.BitsLeft()/8 {
+					if c := d.PeekBytes(n + 1)[n]; c != '\r' && c != '\n' {
+						break
+					}
+					n++
+				}
+				if n > 0 {
+					d.FieldUTF8("newline", n)
+				}
+			})
+		}
+	})
+
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	minAddress := chunks[0].address
+	maxAddress := chunks[0].address
+	for _, c := range chunks {
+		if c.address < minAddress {
+			minAddress = c.address
+		}
+		if end := c.address + uint64(len(c.data)); end > maxAddress {
+			maxAddress = end
+		}
+	}
+	if maxAddress-minAddress > maxBinaryBytes {
+		d.Errorf("binary too large %d bytes", maxAddress-minAddress)
+		return nil
+	}
+
+	b := bytes.Repeat([]byte{fillByte}, int(maxAddress-minAddress))
+	for _, c := range chunks {
+		copy(b[c.address-minAddress:], c.data)
+	}
+
+	d.FieldValueU("binary_address", minAddress, scalar.Hex)
+	bb := bitio.NewBufferFromBytes(b, -1)
+	if dv, _, _ := d.TryFieldFormatBitBuf("binary", bb, probeFormat, nil); dv == nil {
+		d.FieldRootBitBuf("binary", bb)
+	}
+
+	return nil
+}
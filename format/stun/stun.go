@@ -0,0 +1,319 @@
+package stun
+
+// https://datatracker.ietf.org/doc/html/rfc8489 STUN
+// https://datatracker.ietf.org/doc/html/rfc8656 TURN
+// https://datatracker.ietf.org/doc/html/rfc8445 ICE
+// https://www.iana.org/assignments/stun-parameters/stun-parameters.xhtml
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"net"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.STUN,
+		Description: "Session Traversal Utilities for NAT message",
+		Groups:      []string{format.UDP_PAYLOAD},
+		DecodeFn:    stunDecode,
+	})
+	registry.MustRegister(decode.Format{
+		Name:        format.TURN_CHANNEL_DATA,
+		Description: "TURN ChannelData message",
+		Groups:      []string{format.UDP_PAYLOAD},
+		DecodeFn:    turnChannelDataDecode,
+	})
+}
+
+const magicCookie = 0x2112a442
+
+// xored with CRC-32 of message for FINGERPRINT attribute
+const fingerprintXOR = 0x5354554e
+
+const headerLen = 20
+
+var methodNames = scalar.UToSymStr{
+	0x001: "binding",
+	0x003: "allocate",
+	0x004: "refresh",
+	0x006: "send",
+	0x007: "data",
+	0x008: "create_permission",
+	0x009: "channel_bind",
+	0x00a: "connect",
+	0x00b: "connection_bind",
+	0x00c: "connection_attempt",
+	0x080: "goog_ping",
+}
+
+var classNames = scalar.UToSymStr{
+	0: "request",
+	1: "indication",
+	2: "success_response",
+	3: "error_response",
+}
+
+const (
+	attrMappedAddress          = 0x0001
+	attrUsername               = 0x0006
+	attrMessageIntegrity       = 0x0008
+	attrErrorCode              = 0x0009
+	attrUnknownAttributes      = 0x000a
+	attrChannelNumber          = 0x000c
+	attrLifetime               = 0x000d
+	attrXORPeerAddress         = 0x0012
+	attrData                   = 0x0013
+	attrRealm                  = 0x0014
+	attrNonce                  = 0x0015
+	attrXORRelayedAddress      = 0x0016
+	attrRequestedAddressFamily = 0x0017
+	attrEvenPort               = 0x0018
+	attrRequestedTransport     = 0x0019
+	attrDontFragment           = 0x001a
+	attrMessageIntegritySHA256 = 0x001c
+	attrPasswordAlgorithm      = 0x001d
+	attrUserhash               = 0x001e
+	attrXORMappedAddress       = 0x0020
+	attrReservationToken       = 0x0022
+	attrPriority               = 0x0024
+	attrUseCandidate           = 0x0025
+	attrPasswordAlgorithms     = 0x8002
+	attrAlternateDomain        = 0x8003
+	attrSoftware               = 0x8022
+	attrAlternateServer        = 0x8023
+	attrFingerprint            = 0x8028
+	attrICEControlled          = 0x8029
+	attrICEControlling         = 0x802a
+)
+
+var attributeTypeNames = scalar.UToSymStr{
+	attrMappedAddress:          "mapped_address",
+	attrUsername:               "username",
+	attrMessageIntegrity:       "message_integrity",
+	attrErrorCode:              "error_code",
+	attrUnknownAttributes:      "unknown_attributes",
+	attrChannelNumber:          "channel_number",
+	attrLifetime:               "lifetime",
+	attrXORPeerAddress:         "xor_peer_address",
+	attrData:                   "data",
+	attrRealm:                  "realm",
+	attrNonce:                  "nonce",
+	attrXORRelayedAddress:      "xor_relayed_address",
+	attrRequestedAddressFamily: "requested_address_family",
+	attrEvenPort:               "even_port",
+	attrRequestedTransport:     "requested_transport",
+	attrDontFragment:           "dont_fragment",
+	attrMessageIntegritySHA256: "message_integrity_sha256",
+	attrPasswordAlgorithm:      "password_algorithm",
+	attrUserhash:               "userhash",
+	attrXORMappedAddress:       "xor_mapped_address",
+	attrReservationToken:       "reservation_token",
+	attrPriority:               "priority",
+	attrUseCandidate:           "use_candidate",
+	attrPasswordAlgorithms:     "password_algorithms",
+	attrAlternateDomain:        "alternate_domain",
+	attrSoftware:               "software",
+	attrAlternateServer:        "alternate_server",
+	attrFingerprint:            "fingerprint",
+	attrICEControlled:          "ice_controlled",
+	attrICEControlling:         "ice_controlling",
+}
+
+const (
+	familyIPv4 = 1
+	familyIPv6 = 2
+)
+
+var familyNames = scalar.UToSymStr{
+	familyIPv4: "ipv4",
+	familyIPv6: "ipv6",
+}
+
+var passwordAlgorithmNames = scalar.UToSymStr{
+	1: "md5",
+	2: "sha256",
+}
+
+var mapUToIPv4Sym = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(s.ActualU()))
+	s.Sym = net.IP(b[:]).String()
+	return s, nil
+})
+
+func decodeAddress(d *decode.D) {
+	d.FieldU8("reserved")
+	family := d.FieldU8("family", familyNames)
+	d.FieldU16("port")
+	switch family {
+	case familyIPv4:
+		d.FieldU32("address", mapUToIPv4Sym, scalar.Hex)
+	case familyIPv6:
+		d.FieldRawLen("address", 128)
+	default:
+		d.FieldRawLen("address", d.BitsLeft())
+	}
+}
+
+// port is xored with most significant 16 bits of magic cookie, IPv4 address with
+// magic cookie and IPv6 address with magic cookie and transaction id
+func decodeXORAddress(d *decode.D, transactionID []byte) {
+	d.FieldU8("reserved")
+	family := d.FieldU8("family", familyNames)
+	xPort := d.FieldU16("x_port")
+	d.FieldValueU("port", xPort^(magicCookie>>16))
+
+	var key [16]byte
+	binary.BigEndian.PutUint32(key[0:4], magicCookie)
+	copy(key[4:], transactionID)
+
+	switch family {
+	case familyIPv4:
+		xAddress := d.FieldU32("x_address", scalar.Hex)
+		d.FieldValueU("address", xAddress^magicCookie, mapUToIPv4Sym, scalar.Hex)
+	case familyIPv6:
+		xAddress := d.BytesRange(d.Pos(), 16)
+		d.FieldRawLen("x_address", 128)
+		address := make(net.IP, 16)
+		for i := range address {
+			address[i] = xAddress[i] ^ key[i]
+		}
+		d.FieldValueStr("address", address.String())
+	default:
+		d.FieldRawLen("x_address", d.BitsLeft())
+	}
+}
+
+func decodeAttribute(d *decode.D, msgStart int64, transactionID []byte) {
+	attrStart := d.Pos()
+	typ := d.FieldU16("type", attributeTypeNames, scalar.Hex)
+	length := d.FieldU16("length")
+
+	d.LenFn(int64(length)*8, func(d *decode.D) {
+		switch typ {
+		case attrMappedAddress, attrAlternateServer:
+			decodeAddress(d)
+		case attrXORMappedAddress, attrXORPeerAddress, attrXORRelayedAddress:
+			decodeXORAddress(d, transactionID)
+		case attrUsername, attrRealm, attrNonce, attrSoftware, attrAlternateDomain:
+			d.FieldUTF8("value", int(length))
+		case attrErrorCode:
+			d.FieldU21("reserved")
+			class := d.FieldU3("class")
+			number := d.FieldU8("number")
+			d.FieldValueU("code", class*100+number)
+			d.FieldUTF8("reason", int(d.BitsLeft()/8))
+		case attrUnknownAttributes:
+			d.FieldArray("attributes", func(d *decode.D) {
+				for d.NotEnd() {
+					d.FieldU16("type", attributeTypeNames, scalar.Hex)
+				}
+			})
+		case attrChannelNumber:
+			d.FieldU16("channel_number", scalar.Hex)
+			d.FieldU16("rffu")
+		case attrLifetime:
+			d.FieldU32("lifetime")
+		case attrRequestedAddressFamily:
+			d.FieldU8("family", familyNames)
+			d.FieldU24("reserved")
+		case attrEvenPort:
+			d.FieldBool("reserve_next_port")
+			d.FieldU7("reserved")
+		case attrRequestedTransport:
+			d.FieldU8("protocol", format.IPv4ProtocolMap)
+			d.FieldU24("rffu")
+		case attrMessageIntegrity, attrMessageIntegritySHA256:
+			d.FieldRawLen("hmac", d.BitsLeft())
+		case attrPasswordAlgorithm:
+			d.FieldU16("algorithm", passwordAlgorithmNames)
+			paramsLen := d.FieldU16("parameters_length")
+			d.FieldRawLen("parameters", int64(paramsLen)*8)
+		case attrPasswordAlgorithms:
+			d.FieldStructArrayLoop("algorithms", "algorithm", d.NotEnd, func(d *decode.D) {
+				d.FieldU16("algorithm", passwordAlgorithmNames)
+				paramsLen := d.FieldU16("parameters_length")
+				d.FieldRawLen("parameters", int64(paramsLen)*8)
+				if paramsLen%4 != 0 {
+					d.FieldRawLen("padding", int64(4-paramsLen%4)*8)
+				}
+			})
+		case attrPriority:
+			d.FieldU32("priority")
+		case attrICEControlled, attrICEControlling:
+			d.FieldU64("tie_breaker", scalar.Hex)
+		case attrFingerprint:
+			crc := crc32.ChecksumIEEE(d.BytesRange(msgStart, int((attrStart-msgStart)/8)))
+			d.FieldChecksumU("crc", 32, "crc32", uint64(crc^fingerprintXOR), scalar.Hex)
+		case attrDontFragment, attrUseCandidate:
+		default:
+			d.FieldRawLen("value", d.BitsLeft())
+		}
+	})
+
+	if length%4 != 0 {
+		d.FieldRawLen("padding", int64(4-length%4)*8)
+	}
+}
+
+func stunDecode(d *decode.D, in interface{}) interface{} {
+	// STUN can be multiplexed with other protocols on any port so rely on
+	// the magic cookie instead of port
+	if d.BitsLeft() < headerLen*8 ||
+		d.PeekBits(2) != 0 ||
+		binary.BigEndian.Uint32(d.BytesRange(d.Pos()+32, 4)) != magicCookie {
+		d.Fatalf("no magic cookie found")
+	}
+
+	msgStart := d.Pos()
+	var length uint64
+	var transactionID []byte
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldU2("zero")
+		// method and class bits are interleaved: M11-M7 C1 M6-M4 C0 M3-M0
+		typ := d.FieldU14("message_type", scalar.Hex)
+		d.FieldValueU("method", (typ&0xf)|(typ>>1)&0x70|(typ>>2)&0xf80, methodNames)
+		d.FieldValueU("class", (typ>>4)&1|(typ>>7)&2, classNames)
+		length = d.FieldU16("length")
+		d.FieldU32("magic_cookie", d.AssertU(magicCookie), scalar.Hex)
+		transactionID = d.BytesRange(d.Pos(), 12)
+		d.FieldRawLen("transaction_id", 96)
+	})
+
+	if length%4 != 0 {
+		d.Fatalf("length %d not multiple of 4", length)
+	}
+
+	d.LenFn(int64(length)*8, func(d *decode.D) {
+		d.FieldStructArrayLoop("attributes", "attribute", d.NotEnd, func(d *decode.D) {
+			decodeAttribute(d, msgStart, transactionID)
+		})
+	})
+
+	return nil
+}
+
+func turnChannelDataDecode(d *decode.D, in interface{}) interface{} {
+	if udi, ok := in.(format.UDPDatagramIn); ok {
+		if udi.DestinationPort != format.UDPPortSTUN && udi.SourcePort != format.UDPPortSTUN {
+			d.Fatalf("wrong port")
+		}
+	}
+
+	// 0x4000-0x4fff are channel numbers, 0x5000-0x7fff reserved
+	d.FieldU16("channel_number", d.AssertURange(0x4000, 0x7fff), scalar.Hex)
+	length := d.FieldU16("length")
+	d.FieldRawLen("application_data", int64(length)*8)
+	// padding to 4 bytes is required over TCP and optional over UDP
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("padding", d.BitsLeft())
+	}
+
+	return nil
+}
@@ -18,10 +18,11 @@ var probeFormat decode.Group
 
 func init() {
 	registry.MustRegister(decode.Format{
-		Name:        format.TAR,
-		Description: "Tar archive",
-		Groups:      []string{format.PROBE},
-		DecodeFn:    tarDecode,
+		Name:          format.TAR,
+		Description:   "Tar archive",
+		Groups:        []string{format.PROBE},
+		DecodeFn:      tarDecode,
+		EmbeddedFiles: tarEmbeddedFiles,
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.PROBE}, Group: &probeFormat},
 		},
@@ -103,3 +104,26 @@ func tarDecode(d *decode.D, in interface{}) interface{} {
 
 	return nil
 }
+
+func tarEmbeddedFiles(v *decode.Value) ([]decode.EmbeddedFile, error) {
+	var efs []decode.EmbeddedFile
+	for _, f := range v.Child("files").Children() {
+		name, _ := f.Child("name").Scalar().Value().(string)
+		if prefix, _ := f.Child("prefix").Scalar().Value().(string); prefix != "" {
+			name = prefix + "/" + name
+		}
+		switch typeFlag, _ := f.Child("typeflag").Scalar().Value().(string); typeFlag {
+		case "0", "":
+			ef := decode.EmbeddedFile{Name: name}
+			if dv := f.Child("data"); dv != nil {
+				ef.Range = dv.Range
+			}
+			efs = append(efs, ef)
+		case "5":
+			efs = append(efs, decode.EmbeddedFile{Name: name, Dir: true})
+		default:
+			// links, devices etc are skipped
+		}
+	}
+	return efs, nil
+}
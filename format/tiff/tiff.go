@@ -16,7 +16,11 @@ func init() {
 		Name:        format.TIFF,
 		Description: "Tag Image File Format",
 		Groups:      []string{format.PROBE, format.IMAGE},
-		DecodeFn:    tiffDecode,
+		Magic: []decode.Magic{
+			{Bytes: []byte("II*\x00")},
+			{Bytes: []byte("MM\x00*")},
+		},
+		DecodeFn: tiffDecode,
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.ICC_PROFILE}, Group: &tiffIccProfile},
 		},
@@ -0,0 +1,129 @@
+package tls
+
+// https://datatracker.ietf.org/doc/html/rfc6347 DTLS 1.2
+// https://datatracker.ietf.org/doc/html/rfc9147 DTLS 1.3
+// https://datatracker.ietf.org/doc/html/rfc9146 connection id
+// https://datatracker.ietf.org/doc/html/rfc5764 DTLS-SRTP
+
+// TODO: DTLS 1.3 unified header with connection id, length of id is not known
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.DTLS,
+		Description: "Datagram Transport Layer Security records",
+		Groups:      []string{format.UDP_PAYLOAD},
+		DecodeFn:    dtlsDecode,
+	})
+}
+
+// DTLS versions are one's complement of TLS versions
+const dtlsVersionMajor = 0xfe
+
+func decodeDTLSHandshake(d *decode.D) {
+	msgType := d.FieldU8("msg_type", handshakeTypeNames)
+	length := d.FieldU24("length")
+	d.FieldU16("message_seq")
+	fragmentOffset := d.FieldU24("fragment_offset")
+	fragmentLength := d.FieldU24("fragment_length")
+	d.LenFn(int64(fragmentLength)*8, func(d *decode.D) {
+		if fragmentOffset != 0 || fragmentLength != length {
+			d.FieldRawLen("fragment", d.BitsLeft())
+			return
+		}
+		decodeHandshakeBody(d, msgType, true)
+	})
+}
+
+func decodeDTLSPlaintext(d *decode.D) {
+	contentType := d.FieldU8("content_type", contentTypeNames)
+	d.FieldU16("version", versionNames, scalar.Hex)
+	epoch := d.FieldU16("epoch")
+	d.FieldU48("sequence_number")
+	length := d.FieldU16("length")
+
+	d.LenFn(int64(length)*8, func(d *decode.D) {
+		// non-zero epoch means fragment is protected by negotiated keys
+		if epoch != 0 {
+			d.FieldRawLen("encrypted_fragment", d.BitsLeft())
+			return
+		}
+
+		switch contentType {
+		case contentTypeHandshake:
+			d.FieldStructArrayLoop("messages", "message", d.NotEnd, decodeDTLSHandshake)
+		case contentTypeAlert:
+			d.FieldStruct("alert", decodeAlert)
+		case contentTypeChangeCipherSpec:
+			d.FieldU8("type", d.AssertU(1))
+		default:
+			d.FieldRawLen("fragment", d.BitsLeft())
+		}
+	})
+}
+
+// DTLS 1.3 unified header, 0b001CSLEE
+func decodeDTLSCiphertext(d *decode.D) {
+	var hasCID bool
+	var seqIs16Bit bool
+	var hasLength bool
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldU3("fixed_bits", d.AssertU(0b001))
+		hasCID = d.FieldBool("connection_id")
+		seqIs16Bit = d.FieldBool("sequence_number_16_bit")
+		hasLength = d.FieldBool("length_present")
+		d.FieldU2("epoch_low_bits")
+	})
+	if hasCID {
+		d.FieldRawLen("unknown_cid_and_record", d.BitsLeft())
+		return
+	}
+	if seqIs16Bit {
+		d.FieldU16("encrypted_sequence_number")
+	} else {
+		d.FieldU8("encrypted_sequence_number")
+	}
+	length := d.BitsLeft() / 8
+	if hasLength {
+		length = int64(d.FieldU16("length"))
+	}
+	d.FieldRawLen("encrypted_record", length*8)
+}
+
+func dtlsDecode(d *decode.D, in interface{}) interface{} {
+	// DTLS is usually multiplexed on a dynamic port with STUN and SRTP so
+	// look at the first record instead of ports, RFC 7983
+	if d.BitsLeft() < 13*8 {
+		d.Fatalf("too short")
+	}
+	firstByte := d.PeekBits(8)
+	switch {
+	case firstByte >= contentTypeChangeCipherSpec && firstByte <= contentTypeTLS12CID:
+		if d.PeekBytes(2)[1] != dtlsVersionMajor {
+			d.Fatalf("not a DTLS version")
+		}
+	case firstByte&0xe0 == 0x20:
+		// unified header has too few fixed bits to be used to probe
+		if _, ok := in.(format.UDPDatagramIn); ok {
+			d.Fatalf("unified header not allowed as first record")
+		}
+	default:
+		d.Fatalf("unknown content type")
+	}
+
+	d.FieldStructArrayLoop("records", "record", d.NotEnd, func(d *decode.D) {
+		if d.PeekBits(8)&0xe0 == 0x20 {
+			decodeDTLSCiphertext(d)
+			return
+		}
+		decodeDTLSPlaintext(d)
+	})
+
+	return nil
+}
@@ -0,0 +1,464 @@
+package tls
+
+// https://datatracker.ietf.org/doc/html/rfc5246
+// https://datatracker.ietf.org/doc/html/rfc8446
+// https://www.iana.org/assignments/tls-parameters/tls-parameters.xhtml
+// https://www.iana.org/assignments/tls-extensiontype-values/tls-extensiontype-values.xhtml
+
+import (
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+const (
+	contentTypeChangeCipherSpec = 20
+	contentTypeAlert            = 21
+	contentTypeHandshake        = 22
+	contentTypeApplicationData  = 23
+	contentTypeHeartbeat        = 24
+	contentTypeTLS12CID         = 25
+)
+
+var contentTypeNames = scalar.UToSymStr{
+	contentTypeChangeCipherSpec: "change_cipher_spec",
+	contentTypeAlert:            "alert",
+	contentTypeHandshake:        "handshake",
+	contentTypeApplicationData:  "application_data",
+	contentTypeHeartbeat:        "heartbeat",
+	contentTypeTLS12CID:         "tls12_cid",
+}
+
+var versionNames = scalar.UToSymStr{
+	0x0300: "ssl3.0",
+	0x0301: "tls1.0",
+	0x0302: "tls1.1",
+	0x0303: "tls1.2",
+	0x0304: "tls1.3",
+	0xfeff: "dtls1.0",
+	0xfefd: "dtls1.2",
+	0xfefc: "dtls1.3",
+}
+
+const (
+	handshakeHelloRequest       = 0
+	handshakeClientHello        = 1
+	handshakeServerHello        = 2
+	handshakeHelloVerifyRequest = 3
+	handshakeNewSessionTicket   = 4
+	handshakeEndOfEarlyData     = 5
+	handshakeEncryptedExtension = 8
+	handshakeCertificate        = 11
+	handshakeServerKeyExchange  = 12
+	handshakeCertificateRequest = 13
+	handshakeServerHelloDone    = 14
+	handshakeCertificateVerify  = 15
+	handshakeClientKeyExchange  = 16
+	handshakeFinished           = 20
+	handshakeKeyUpdate          = 24
+	handshakeMessageHash        = 254
+)
+
+var handshakeTypeNames = scalar.UToSymStr{
+	handshakeHelloRequest:       "hello_request",
+	handshakeClientHello:        "client_hello",
+	handshakeServerHello:        "server_hello",
+	handshakeHelloVerifyRequest: "hello_verify_request",
+	handshakeNewSessionTicket:   "new_session_ticket",
+	handshakeEndOfEarlyData:     "end_of_early_data",
+	handshakeEncryptedExtension: "encrypted_extensions",
+	handshakeCertificate:        "certificate",
+	handshakeServerKeyExchange:  "server_key_exchange",
+	handshakeCertificateRequest: "certificate_request",
+	handshakeServerHelloDone:    "server_hello_done",
+	handshakeCertificateVerify:  "certificate_verify",
+	handshakeClientKeyExchange:  "client_key_exchange",
+	handshakeFinished:           "finished",
+	handshakeKeyUpdate:          "key_update",
+	handshakeMessageHash:        "message_hash",
+}
+
+var alertLevelNames = scalar.UToSymStr{
+	1: "warning",
+	2: "fatal",
+}
+
+var alertDescriptionNames = scalar.UToSymStr{
+	0:   "close_notify",
+	10:  "unexpected_message",
+	20:  "bad_record_mac",
+	21:  "decryption_failed",
+	22:  "record_overflow",
+	30:  "decompression_failure",
+	40:  "handshake_failure",
+	41:  "no_certificate",
+	42:  "bad_certificate",
+	43:  "unsupported_certificate",
+	44:  "certificate_revoked",
+	45:  "certificate_expired",
+	46:  "certificate_unknown",
+	47:  "illegal_parameter",
+	48:  "unknown_ca",
+	49:  "access_denied",
+	50:  "decode_error",
+	51:  "decrypt_error",
+	60:  "export_restriction",
+	70:  "protocol_version",
+	71:  "insufficient_security",
+	80:  "internal_error",
+	86:  "inappropriate_fallback",
+	90:  "user_canceled",
+	100: "no_renegotiation",
+	109: "missing_extension",
+	110: "unsupported_extension",
+	111: "certificate_unobtainable",
+	112: "unrecognized_name",
+	113: "bad_certificate_status_response",
+	114: "bad_certificate_hash_value",
+	115: "unknown_psk_identity",
+	116: "certificate_required",
+	120: "no_application_protocol",
+}
+
+var cipherSuiteNames = scalar.UToSymStr{
+	0x0000: "TLS_NULL_WITH_NULL_NULL",
+	0x0004: "TLS_RSA_WITH_RC4_128_MD5",
+	0x0005: "TLS_RSA_WITH_RC4_128_SHA",
+	0x000a: "TLS_RSA_WITH_3DES_EDE_CBC_SHA",
+	0x002f: "TLS_RSA_WITH_AES_128_CBC_SHA",
+	0x0033: "TLS_DHE_RSA_WITH_AES_128_CBC_SHA",
+	0x0035: "TLS_RSA_WITH_AES_256_CBC_SHA",
+	0x0039: "TLS_DHE_RSA_WITH_AES_256_CBC_SHA",
+	0x003c: "TLS_RSA_WITH_AES_128_CBC_SHA256",
+	0x003d: "TLS_RSA_WITH_AES_256_CBC_SHA256",
+	0x0067: "TLS_DHE_RSA_WITH_AES_128_CBC_SHA256",
+	0x006b: "TLS_DHE_RSA_WITH_AES_256_CBC_SHA256",
+	0x008c: "TLS_PSK_WITH_AES_128_CBC_SHA",
+	0x008d: "TLS_PSK_WITH_AES_256_CBC_SHA",
+	0x009c: "TLS_RSA_WITH_AES_128_GCM_SHA256",
+	0x009d: "TLS_RSA_WITH_AES_256_GCM_SHA384",
+	0x009e: "TLS_DHE_RSA_WITH_AES_128_GCM_SHA256",
+	0x009f: "TLS_DHE_RSA_WITH_AES_256_GCM_SHA384",
+	0x00a8: "TLS_PSK_WITH_AES_128_GCM_SHA256",
+	0x00a9: "TLS_PSK_WITH_AES_256_GCM_SHA384",
+	0x00ff: "TLS_EMPTY_RENEGOTIATION_INFO_SCSV",
+	0x1301: "TLS_AES_128_GCM_SHA256",
+	0x1302: "TLS_AES_256_GCM_SHA384",
+	0x1303: "TLS_CHACHA20_POLY1305_SHA256",
+	0x1304: "TLS_AES_128_CCM_SHA256",
+	0x1305: "TLS_AES_128_CCM_8_SHA256",
+	0x5600: "TLS_FALLBACK_SCSV",
+	0xc009: "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA",
+	0xc00a: "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA",
+	0xc012: "TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA",
+	0xc013: "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA",
+	0xc014: "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA",
+	0xc023: "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256",
+	0xc024: "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA384",
+	0xc027: "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256",
+	0xc028: "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA384",
+	0xc02b: "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	0xc02c: "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	0xc02f: "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	0xc030: "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+	0xc0a4: "TLS_PSK_WITH_AES_128_CCM",
+	0xc0a5: "TLS_PSK_WITH_AES_256_CCM",
+	0xc0a8: "TLS_PSK_WITH_AES_128_CCM_8",
+	0xc0a9: "TLS_PSK_WITH_AES_256_CCM_8",
+	0xc0ac: "TLS_ECDHE_ECDSA_WITH_AES_128_CCM",
+	0xc0ad: "TLS_ECDHE_ECDSA_WITH_AES_256_CCM",
+	0xc0ae: "TLS_ECDHE_ECDSA_WITH_AES_128_CCM_8",
+	0xc0af: "TLS_ECDHE_ECDSA_WITH_AES_256_CCM_8",
+	0xcca8: "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+	0xcca9: "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256",
+	0xccaa: "TLS_DHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+	0xccab: "TLS_PSK_WITH_CHACHA20_POLY1305_SHA256",
+	0xccac: "TLS_ECDHE_PSK_WITH_CHACHA20_POLY1305_SHA256",
+}
+
+var compressionMethodNames = scalar.UToSymStr{
+	0: "null",
+	1: "deflate",
+}
+
+const (
+	extServerName             = 0
+	extMaxFragmentLength      = 1
+	extStatusRequest          = 5
+	extSupportedGroups        = 10
+	extECPointFormats         = 11
+	extSignatureAlgorithms    = 13
+	extUseSRTP                = 14
+	extHeartbeat              = 15
+	extALPN                   = 16
+	extSCT                    = 18
+	extPadding                = 21
+	extEncryptThenMAC         = 22
+	extExtendedMasterSecret   = 23
+	extCompressCertificate    = 27
+	extRecordSizeLimit        = 28
+	extSessionTicket          = 35
+	extPreSharedKey           = 41
+	extEarlyData              = 42
+	extSupportedVersions      = 43
+	extCookie                 = 44
+	extPSKKeyExchangeModes    = 45
+	extCertificateAuthorities = 47
+	extPostHandshakeAuth      = 49
+	extSignatureAlgorithmCert = 50
+	extKeyShare               = 51
+	extConnectionID           = 54
+	extRenegotiationInfo      = 0xff01
+)
+
+var extensionNames = scalar.UToSymStr{
+	extServerName:             "server_name",
+	extMaxFragmentLength:      "max_fragment_length",
+	extStatusRequest:          "status_request",
+	extSupportedGroups:        "supported_groups",
+	extECPointFormats:         "ec_point_formats",
+	extSignatureAlgorithms:    "signature_algorithms",
+	extUseSRTP:                "use_srtp",
+	extHeartbeat:              "heartbeat",
+	extALPN:                   "application_layer_protocol_negotiation",
+	extSCT:                    "signed_certificate_timestamp",
+	extPadding:                "padding",
+	extEncryptThenMAC:         "encrypt_then_mac",
+	extExtendedMasterSecret:   "extended_master_secret",
+	extCompressCertificate:    "compress_certificate",
+	extRecordSizeLimit:        "record_size_limit",
+	extSessionTicket:          "session_ticket",
+	extPreSharedKey:           "pre_shared_key",
+	extEarlyData:              "early_data",
+	extSupportedVersions:      "supported_versions",
+	extCookie:                 "cookie",
+	extPSKKeyExchangeModes:    "psk_key_exchange_modes",
+	extCertificateAuthorities: "certificate_authorities",
+	extPostHandshakeAuth:      "post_handshake_auth",
+	extSignatureAlgorithmCert: "signature_algorithms_cert",
+	extKeyShare:               "key_share",
+	extConnectionID:           "connection_id",
+	extRenegotiationInfo:      "renegotiation_info",
+}
+
+var namedGroupNames = scalar.UToSymStr{
+	0x0017: "secp256r1",
+	0x0018: "secp384r1",
+	0x0019: "secp521r1",
+	0x001d: "x25519",
+	0x001e: "x448",
+	0x0100: "ffdhe2048",
+	0x0101: "ffdhe3072",
+	0x0102: "ffdhe4096",
+	0x0103: "ffdhe6144",
+	0x0104: "ffdhe8192",
+}
+
+var ecPointFormatNames = scalar.UToSymStr{
+	0: "uncompressed",
+	1: "ansiX962_compressed_prime",
+	2: "ansiX962_compressed_char2",
+}
+
+var signatureSchemeNames = scalar.UToSymStr{
+	0x0201: "rsa_pkcs1_sha1",
+	0x0203: "ecdsa_sha1",
+	0x0401: "rsa_pkcs1_sha256",
+	0x0403: "ecdsa_secp256r1_sha256",
+	0x0501: "rsa_pkcs1_sha384",
+	0x0503: "ecdsa_secp384r1_sha384",
+	0x0601: "rsa_pkcs1_sha512",
+	0x0603: "ecdsa_secp521r1_sha512",
+	0x0804: "rsa_pss_rsae_sha256",
+	0x0805: "rsa_pss_rsae_sha384",
+	0x0806: "rsa_pss_rsae_sha512",
+	0x0807: "ed25519",
+	0x0808: "ed448",
+	0x0809: "rsa_pss_pss_sha256",
+	0x080a: "rsa_pss_pss_sha384",
+	0x080b: "rsa_pss_pss_sha512",
+}
+
+var srtpProtectionProfileNames = scalar.UToSymStr{
+	0x0001: "SRTP_AES128_CM_HMAC_SHA1_80",
+	0x0002: "SRTP_AES128_CM_HMAC_SHA1_32",
+	0x0005: "SRTP_NULL_HMAC_SHA1_80",
+	0x0006: "SRTP_NULL_HMAC_SHA1_32",
+	0x0007: "SRTP_AEAD_AES_128_GCM",
+	0x0008: "SRTP_AEAD_AES_256_GCM",
+}
+
+var serverNameTypeNames = scalar.UToSymStr{
+	0: "host_name",
+}
+
+// decode a length prefixed vector, fn is called with a decoder limited to the vector content
+func fieldVector(d *decode.D, lengthName string, lengthBits int, fn func(d *decode.D)) {
+	length := d.FieldU(lengthName, lengthBits)
+	d.LenFn(int64(length)*8, fn)
+}
+
+func fieldU16Array(d *decode.D, name string, elementName string, lengthBits int, sms ...scalar.Mapper) {
+	fieldVector(d, name+"_length", lengthBits, func(d *decode.D) {
+		d.FieldArray(name, func(d *decode.D) {
+			for d.NotEnd() {
+				d.FieldU16(elementName, sms...)
+			}
+		})
+	})
+}
+
+func fieldOpaque(d *decode.D, name string, lengthBits int) {
+	length := d.FieldU(name+"_length", lengthBits)
+	d.FieldRawLen(name, int64(length)*8)
+}
+
+func decodeExtension(d *decode.D, handshakeType uint64) {
+	typ := d.FieldU16("type", extensionNames)
+	length := d.FieldU16("length")
+	d.LenFn(int64(length)*8, func(d *decode.D) {
+		switch {
+		case typ == extServerName && length > 0:
+			fieldVector(d, "server_name_list_length", 16, func(d *decode.D) {
+				d.FieldStructArrayLoop("server_names", "server_name", d.NotEnd, func(d *decode.D) {
+					d.FieldU8("name_type", serverNameTypeNames)
+					nameLen := d.FieldU16("length")
+					d.FieldUTF8("host_name", int(nameLen))
+				})
+			})
+		case typ == extSupportedGroups:
+			fieldU16Array(d, "named_groups", "named_group", 16, namedGroupNames, scalar.Hex)
+		case typ == extECPointFormats:
+			fieldVector(d, "ec_point_formats_length", 8, func(d *decode.D) {
+				d.FieldArray("ec_point_formats", func(d *decode.D) {
+					for d.NotEnd() {
+						d.FieldU8("ec_point_format", ecPointFormatNames)
+					}
+				})
+			})
+		case typ == extSignatureAlgorithms, typ == extSignatureAlgorithmCert:
+			fieldU16Array(d, "signature_algorithms", "signature_algorithm", 16, signatureSchemeNames, scalar.Hex)
+		case typ == extUseSRTP:
+			fieldU16Array(d, "protection_profiles", "protection_profile", 16, srtpProtectionProfileNames, scalar.Hex)
+			fieldOpaque(d, "mki", 8)
+		case typ == extALPN:
+			fieldVector(d, "protocol_name_list_length", 16, func(d *decode.D) {
+				d.FieldArray("protocol_names", func(d *decode.D) {
+					for d.NotEnd() {
+						d.FieldUTF8ShortString("protocol_name")
+					}
+				})
+			})
+		case typ == extSupportedVersions && handshakeType == handshakeClientHello:
+			fieldVector(d, "versions_length", 8, func(d *decode.D) {
+				d.FieldArray("versions", func(d *decode.D) {
+					for d.NotEnd() {
+						d.FieldU16("version", versionNames, scalar.Hex)
+					}
+				})
+			})
+		case typ == extSupportedVersions:
+			d.FieldU16("selected_version", versionNames, scalar.Hex)
+		case typ == extRenegotiationInfo:
+			fieldOpaque(d, "renegotiated_connection", 8)
+		case typ == extRecordSizeLimit:
+			d.FieldU16("record_size_limit")
+		case typ == extConnectionID:
+			fieldOpaque(d, "cid", 8)
+		case typ == extKeyShare && handshakeType == handshakeClientHello:
+			fieldVector(d, "client_shares_length", 16, func(d *decode.D) {
+				d.FieldStructArrayLoop("client_shares", "key_share_entry", d.NotEnd, func(d *decode.D) {
+					d.FieldU16("group", namedGroupNames, scalar.Hex)
+					fieldOpaque(d, "key_exchange", 16)
+				})
+			})
+		case typ == extKeyShare && handshakeType == handshakeServerHello && length == 2:
+			// hello retry request only has selected group
+			d.FieldU16("selected_group", namedGroupNames, scalar.Hex)
+		case typ == extKeyShare && handshakeType == handshakeServerHello:
+			d.FieldStruct("server_share", func(d *decode.D) {
+				d.FieldU16("group", namedGroupNames, scalar.Hex)
+				fieldOpaque(d, "key_exchange", 16)
+			})
+		default:
+			if length > 0 {
+				d.FieldRawLen("data", d.BitsLeft())
+			}
+		}
+	})
+}
+
+func decodeExtensions(d *decode.D, handshakeType uint64) {
+	if d.BitsLeft() == 0 {
+		// extensions are optional
+		return
+	}
+	fieldVector(d, "extensions_length", 16, func(d *decode.D) {
+		d.FieldStructArrayLoop("extensions", "extension", d.NotEnd, func(d *decode.D) {
+			decodeExtension(d, handshakeType)
+		})
+	})
+}
+
+func decodeClientHello(d *decode.D, isDTLS bool) {
+	d.FieldU16("client_version", versionNames, scalar.Hex)
+	d.FieldRawLen("random", 32*8)
+	fieldOpaque(d, "session_id", 8)
+	if isDTLS {
+		fieldOpaque(d, "cookie", 8)
+	}
+	fieldU16Array(d, "cipher_suites", "cipher_suite", 16, cipherSuiteNames, scalar.Hex)
+	fieldVector(d, "compression_methods_length", 8, func(d *decode.D) {
+		d.FieldArray("compression_methods", func(d *decode.D) {
+			for d.NotEnd() {
+				d.FieldU8("compression_method", compressionMethodNames)
+			}
+		})
+	})
+	decodeExtensions(d, handshakeClientHello)
+}
+
+func decodeServerHello(d *decode.D) {
+	d.FieldU16("server_version", versionNames, scalar.Hex)
+	d.FieldRawLen("random", 32*8)
+	fieldOpaque(d, "session_id", 8)
+	d.FieldU16("cipher_suite", cipherSuiteNames, scalar.Hex)
+	d.FieldU8("compression_method", compressionMethodNames)
+	decodeExtensions(d, handshakeServerHello)
+}
+
+func decodeCertificate(d *decode.D) {
+	fieldVector(d, "certificate_list_length", 24, func(d *decode.D) {
+		d.FieldArray("certificate_list", func(d *decode.D) {
+			for d.NotEnd() {
+				fieldOpaque(d, "certificate", 24)
+			}
+		})
+	})
+}
+
+// decode handshake message body, msgType is handshake type
+func decodeHandshakeBody(d *decode.D, msgType uint64, isDTLS bool) {
+	switch msgType {
+	case handshakeClientHello:
+		decodeClientHello(d, isDTLS)
+	case handshakeServerHello:
+		decodeServerHello(d)
+	case handshakeHelloVerifyRequest:
+		d.FieldU16("server_version", versionNames, scalar.Hex)
+		fieldOpaque(d, "cookie", 8)
+	case handshakeCertificate:
+		decodeCertificate(d)
+	case handshakeNewSessionTicket:
+		// RFC 5077, TLS 1.3 tickets are always encrypted
+		d.FieldU32("ticket_lifetime_hint")
+		fieldOpaque(d, "ticket", 16)
+	case handshakeHelloRequest, handshakeServerHelloDone:
+	default:
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+}
+
+func decodeAlert(d *decode.D) {
+	d.FieldU8("level", alertLevelNames)
+	d.FieldU8("description", alertDescriptionNames)
+}
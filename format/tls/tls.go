@@ -0,0 +1,131 @@
+package tls
+
+// https://datatracker.ietf.org/doc/html/rfc2246 TLS 1.0
+// https://datatracker.ietf.org/doc/html/rfc4346 TLS 1.1
+// https://datatracker.ietf.org/doc/html/rfc5246 TLS 1.2
+// https://datatracker.ietf.org/doc/html/rfc8446 TLS 1.3
+
+// TODO: SSLv2 compatible client hello
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.TLS,
+		Description: "Transport Layer Security records",
+		Groups:      []string{format.TCP_STREAM},
+		DecodeFn:    tlsDecode,
+	})
+}
+
+const tlsVersionMajor = 0x03
+
+const handshakeHeaderLength = 4
+
+type tlsDecoder struct {
+	// set after change_cipher_spec, rest of stream is protected by negotiated keys
+	encrypted bool
+	// incomplete handshake message waiting for more records
+	handshakeBuf []byte
+}
+
+// length of complete handshake message at start of b or -1 if incomplete
+func handshakeMessageLength(b []byte) int {
+	if len(b) < handshakeHeaderLength {
+		return -1
+	}
+	l := handshakeHeaderLength + (int(b[1])<<16 | int(b[2])<<8 | int(b[3]))
+	if len(b) < l {
+		return -1
+	}
+	return l
+}
+
+func decodeTLSHandshake(d *decode.D) {
+	msgType := d.FieldU8("msg_type", handshakeTypeNames)
+	length := d.FieldU24("length")
+	d.LenFn(int64(length)*8, func(d *decode.D) {
+		decodeHandshakeBody(d, msgType, false)
+	})
+}
+
+// handshake messages can be split over and share records, complete messages are
+// decoded in place and split messages are decoded when reassembled
+func (td *tlsDecoder) decodeHandshakeFragment(d *decode.D) {
+	d.FieldArray("messages", func(d *decode.D) {
+		for len(td.handshakeBuf) == 0 && d.NotEnd() {
+			if handshakeMessageLength(d.PeekBytes(int(d.BitsLeft()/8))) == -1 {
+				break
+			}
+			d.FieldStruct("message", decodeTLSHandshake)
+		}
+	})
+	if d.BitsLeft() == 0 {
+		return
+	}
+
+	td.handshakeBuf = append(td.handshakeBuf, d.PeekBytes(int(d.BitsLeft()/8))...)
+	d.FieldRawLen("fragment", d.BitsLeft())
+
+	if handshakeMessageLength(td.handshakeBuf) == -1 {
+		return
+	}
+	d.FieldArray("reassembled_messages", func(d *decode.D) {
+		for {
+			l := handshakeMessageLength(td.handshakeBuf)
+			if l == -1 {
+				break
+			}
+			bb := bitio.NewBufferFromBytes(td.handshakeBuf[0:l], -1)
+			d.FieldStructRootBitBufFn("message", bb, decodeTLSHandshake)
+			td.handshakeBuf = td.handshakeBuf[l:]
+		}
+	})
+}
+
+func (td *tlsDecoder) decodeRecord(d *decode.D) {
+	contentType := d.FieldU8("content_type", contentTypeNames)
+	d.FieldU16("version", versionNames, scalar.Hex)
+	length := d.FieldU16("length")
+
+	d.LenFn(int64(length)*8, func(d *decode.D) {
+		switch {
+		case contentType == contentTypeChangeCipherSpec:
+			d.FieldU8("type", d.AssertU(1))
+			td.encrypted = true
+		case contentType == contentTypeApplicationData, td.encrypted:
+			d.FieldRawLen("encrypted_fragment", d.BitsLeft())
+		case contentType == contentTypeHandshake:
+			td.decodeHandshakeFragment(d)
+		case contentType == contentTypeAlert:
+			d.FieldStruct("alert", decodeAlert)
+		default:
+			d.FieldRawLen("fragment", d.BitsLeft())
+		}
+	})
+}
+
+func tlsDecode(d *decode.D, in interface{}) interface{} {
+	// TLS is used on lots of ports so look at first record header instead
+	if d.BitsLeft() < 5*8 {
+		d.Fatalf("too short")
+	}
+	header := d.PeekBytes(5)
+	if header[0] < contentTypeChangeCipherSpec || header[0] > contentTypeHeartbeat {
+		d.Fatalf("unknown content type")
+	}
+	if header[1] != tlsVersionMajor || header[2] > 0x04 {
+		d.Fatalf("not a TLS version")
+	}
+
+	td := &tlsDecoder{}
+	d.FieldStructArrayLoop("records", "record", d.NotEnd, td.decodeRecord)
+
+	return nil
+}
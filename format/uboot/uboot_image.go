@@ -0,0 +1,444 @@
+package uboot
+
+// https://source.denx.de/u-boot/u-boot/-/blob/master/include/image.h
+// https://source.denx.de/u-boot/u-boot/-/blob/master/doc/uImage.FIT/source_file_format.txt
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var dtbFormat decode.Group
+var probeFormat decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.UBOOT_IMAGE,
+		Description: "U-Boot image (legacy uImage and FIT)",
+		Groups:      []string{format.PROBE},
+		Magic: []decode.Magic{
+			{Bytes: []byte{0x27, 0x05, 0x19, 0x56}},
+			{Bytes: []byte{0xd0, 0x0d, 0xfe, 0xed}},
+		},
+		DecodeFn:      ubootImageDecode,
+		EmbeddedFiles: ubootImageEmbeddedFiles,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.DTB}, Group: &dtbFormat},
+			{Names: []string{format.PROBE}, Group: &probeFormat},
+		},
+	})
+}
+
+const (
+	legacyMagic = 0x27051956
+	fitMagic    = 0xd00dfeed
+)
+
+const legacyHeaderSize = 64
+
+// names are the same as used in FIT images
+var osNames = scalar.UToSymStr{
+	0:  "invalid",
+	1:  "openbsd",
+	2:  "netbsd",
+	3:  "freebsd",
+	4:  "4_4bsd",
+	5:  "linux",
+	6:  "svr4",
+	7:  "esix",
+	8:  "solaris",
+	9:  "irix",
+	10: "sco",
+	11: "dell",
+	12: "ncr",
+	13: "lynxos",
+	14: "vxworks",
+	15: "psos",
+	16: "qnx",
+	17: "u-boot",
+	18: "rtems",
+	19: "artos",
+	20: "unity",
+	21: "integrity",
+	22: "ose",
+	23: "plan9",
+	24: "openrtos",
+	25: "arm-trusted-firmware",
+	26: "tee",
+	27: "opensbi",
+	28: "efi",
+}
+
+var archNames = scalar.UToSymStr{
+	0:  "invalid",
+	1:  "alpha",
+	2:  "arm",
+	3:  "x86",
+	4:  "ia64",
+	5:  "mips",
+	6:  "mips64",
+	7:  "powerpc",
+	8:  "s390",
+	9:  "sh",
+	10: "sparc",
+	11: "sparc64",
+	12: "m68k",
+	13: "nios",
+	14: "microblaze",
+	15: "nios2",
+	16: "blackfin",
+	17: "avr32",
+	18: "st200",
+	19: "sandbox",
+	20: "nds32",
+	21: "or1k",
+	22: "arm64",
+	23: "arc",
+	24: "x86_64",
+	25: "xtensa",
+	26: "riscv",
+}
+
+const typeMulti = 4
+
+var typeNames = scalar.UToSymStr{
+	0:         "invalid",
+	1:         "standalone",
+	2:         "kernel",
+	3:         "ramdisk",
+	typeMulti: "multi",
+	5:         "firmware",
+	6:         "script",
+	7:         "filesystem",
+	8:         "flat_dt",
+	9:         "kwbimage",
+	10:        "imximage",
+	11:        "ublimage",
+	12:        "omapimage",
+	13:        "aisimage",
+	14:        "kernel_noload",
+}
+
+var compressionNames = scalar.UToSymStr{
+	0: "none",
+	1: "gzip",
+	2: "bzip2",
+	3: "lzma",
+	4: "lzo",
+	5: "lz4",
+	6: "zstd",
+}
+
+var unixTimeMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	uv, ok := s.Actual.(uint64)
+	if !ok || uv == 0 {
+		return s, nil
+	}
+	s.Description = time.Unix(int64(uv), 0).UTC().Format(time.RFC3339)
+	return s, nil
+})
+
+// decode data as probe format or raw if probe fails
+func fieldData(d *decode.D, name string, nBits int64) {
+	if dv, _, _ := d.TryFieldFormatLen(name, nBits, probeFormat, nil); dv == nil {
+		d.FieldRawLen(name, nBits)
+	}
+}
+
+func legacyDecode(d *decode.D) {
+	header := d.PeekBytes(legacyHeaderSize)
+	// header crc is calculated with the crc field as zero
+	zeroCRCHeader := append([]byte{}, header...)
+	copy(zeroCRCHeader[4:8], []byte{0, 0, 0, 0})
+	size := int64(binary.BigEndian.Uint32(header[12:16]))
+	if legacyHeaderSize*8+size*8 > d.Len() {
+		d.Fatalf("data size %d outside image", size)
+	}
+	dataCRC := crc32.ChecksumIEEE(d.BytesRange(legacyHeaderSize*8, int(size)))
+
+	var imageType uint64
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldU32("magic", d.AssertU(legacyMagic), scalar.Hex)
+		d.FieldChecksumU("header_crc", 32, "crc32", uint64(crc32.ChecksumIEEE(zeroCRCHeader)), scalar.Hex)
+		d.FieldU32("time", unixTimeMap)
+		d.FieldU32("size")
+		d.FieldU32("load_address", scalar.Hex)
+		d.FieldU32("entry_point", scalar.Hex)
+		d.FieldChecksumU("data_crc", 32, "crc32", uint64(dataCRC), scalar.Hex)
+		d.FieldU8("os", osNames)
+		d.FieldU8("arch", archNames)
+		imageType = d.FieldU8("type", typeNames)
+		d.FieldU8("compression", compressionNames)
+		d.FieldUTF8NullFixedLen("name", 32)
+	})
+
+	if imageType != typeMulti {
+		fieldData(d, "data", size*8)
+		return
+	}
+
+	// multi-file image, zero terminated list of sizes followed by images,
+	// all but last padded to 4 bytes
+	var sizes []uint64
+	d.FieldArray("image_sizes", func(d *decode.D) {
+		for {
+			s := d.FieldU32("size")
+			if s == 0 {
+				break
+			}
+			sizes = append(sizes, s)
+		}
+	})
+	d.FieldArray("images", func(d *decode.D) {
+		for i, s := range sizes {
+			d.FieldStruct("image", func(d *decode.D) {
+				fieldData(d, "data", int64(s)*8)
+				if n := d.AlignBits(32); n > 0 && i < len(sizes)-1 {
+					d.FieldRawLen("padding", int64(n), d.BitBufIsZero())
+				}
+			})
+		}
+	})
+}
+
+// properties of a devicetree node
+type fitNode map[string][]byte
+
+// null terminated printable string
+func (n fitNode) str(name string) (string, bool) {
+	b := n[name]
+	if len(b) == 0 || b[len(b)-1] != 0 {
+		return "", false
+	}
+	b = b[:len(b)-1]
+	for _, c := range b {
+		if c < 0x20 || c > 0x7e {
+			return "", false
+		}
+	}
+	return string(b), true
+}
+
+// one or two big endian cells
+func (n fitNode) u(name string) (uint64, bool) {
+	switch b := n[name]; len(b) {
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), true
+	case 8:
+		return binary.BigEndian.Uint64(b), true
+	default:
+		return 0, false
+	}
+}
+
+var fitHashFns = map[string]func() hash.Hash{
+	"crc32":  func() hash.Hash { return crc32.NewIEEE() },
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+func fitDecode(d *decode.D) {
+	totalSize := d.PeekBits(64) & 0xffff_ffff
+	if int64(totalSize)*8 > d.Len() {
+		d.Fatalf("fdt totalsize %d outside image", totalSize)
+	}
+	_, v := d.FieldFormatLen("fdt", int64(totalSize)*8, dtbFormat, nil)
+	dtbOut, ok := v.(format.DTBOut)
+	if !ok {
+		panic(fmt.Sprintf("expected DTBOut got %#+v", v))
+	}
+
+	nodes := map[string]fitNode{}
+	dataPos := map[string]int64{}
+	for _, p := range dtbOut.Properties {
+		n, ok := nodes[p.Path]
+		if !ok {
+			n = fitNode{}
+			nodes[p.Path] = n
+		}
+		n[p.Name] = p.Value
+		if p.Name == "data" {
+			dataPos[p.Path] = p.Pos
+		}
+	}
+	// direct child nodes of path in blob order
+	children := func(path string) []string {
+		var names []string
+		for _, p := range dtbOut.Properties {
+			if !strings.HasPrefix(p.Path, path+"/") {
+				continue
+			}
+			name := strings.TrimPrefix(p.Path, path+"/")
+			if strings.Contains(name, "/") || (len(names) > 0 && names[len(names)-1] == name) {
+				continue
+			}
+			names = append(names, name)
+		}
+		return names
+	}
+
+	imageNames := children("/images")
+	if len(imageNames) == 0 {
+		d.Fatalf("no images, not a FIT image")
+	}
+
+	root := nodes["/"]
+	if s, ok := root.str("description"); ok {
+		d.FieldValueStr("description", s)
+	}
+	if t, ok := root.u("timestamp"); ok {
+		d.FieldValueU("timestamp", t, unixTimeMap)
+	}
+
+	// external data offsets are relative to end of fdt aligned to 4 bytes
+	externalBase := int64((totalSize+3)&^3) * 8
+
+	d.FieldArray("images", func(d *decode.D) {
+		for _, name := range imageNames {
+			path := "/images/" + name
+			n := nodes[path]
+			d.FieldStruct("image", func(d *decode.D) {
+				d.FieldValueStr("name", name)
+				for _, p := range []string{"description", "type", "arch", "os", "compression"} {
+					if s, ok := n.str(p); ok {
+						d.FieldValueStr(p, s)
+					}
+				}
+				for _, p := range []string{"load", "entry"} {
+					if u, ok := n.u(p); ok {
+						d.FieldValueU(p, u, scalar.Hex)
+					}
+				}
+
+				var pos, nBits int64
+				var data []byte
+				if _, ok := n["data"]; ok {
+					pos = dataPos[path]
+					data = n["data"]
+					nBits = int64(len(data)) * 8
+				} else {
+					size, sizeOk := n.u("data-size")
+					offset, offsetOk := n.u("data-offset")
+					position, positionOk := n.u("data-position")
+					switch {
+					case sizeOk && offsetOk:
+						pos = externalBase + int64(offset)*8
+					case sizeOk && positionOk:
+						pos = int64(position) * 8
+					default:
+						d.Errorf("%s: no data", name)
+						return
+					}
+					nBits = int64(size) * 8
+					if pos+nBits > d.Len() {
+						d.Fatalf("%s: data outside image", name)
+					}
+					data = d.BytesRange(pos, int(size))
+				}
+
+				d.FieldArray("hashes", func(d *decode.D) {
+					for _, hashName := range children(path) {
+						hn := nodes[path+"/"+hashName]
+						algo, ok := hn.str("algo")
+						if !ok {
+							continue
+						}
+						d.FieldStruct("hash", func(d *decode.D) {
+							d.FieldValueStr("name", hashName)
+							d.FieldValueStr("algo", algo)
+							var sms []scalar.Mapper
+							if fn, ok := fitHashFns[algo]; ok {
+								h := fn()
+								h.Write(data)
+								sms = append(sms, d.ValidateStr(hex.EncodeToString(h.Sum(nil))))
+							}
+							d.FieldValueStr("value", hex.EncodeToString(hn["value"]), sms...)
+						})
+					}
+				})
+
+				d.RangeFn(pos, nBits, func(d *decode.D) {
+					fieldData(d, "data", nBits)
+				})
+			})
+		}
+	})
+
+	configNames := children("/configurations")
+	if len(configNames) == 0 {
+		return
+	}
+	d.FieldStruct("configurations", func(d *decode.D) {
+		if s, ok := nodes["/configurations"].str("default"); ok {
+			d.FieldValueStr("default", s)
+		}
+		d.FieldArray("configs", func(d *decode.D) {
+			for _, name := range configNames {
+				n := nodes["/configurations/"+name]
+				d.FieldStruct("config", func(d *decode.D) {
+					d.FieldValueStr("name", name)
+					var props []string
+					for p := range n {
+						props = append(props, p)
+					}
+					sort.Strings(props)
+					for _, p := range props {
+						if s, ok := n.str(p); ok {
+							d.FieldValueStr(p, s)
+						}
+					}
+				})
+			}
+		})
+	})
+}
+
+func ubootImageDecode(d *decode.D, in interface{}) interface{} {
+	switch magic := d.PeekBits(32); magic {
+	case legacyMagic:
+		legacyDecode(d)
+	case fitMagic:
+		fitDecode(d)
+	default:
+		d.Fatalf("unknown magic %x", magic)
+	}
+
+	return nil
+}
+
+func ubootImageEmbeddedFiles(v *decode.Value) ([]decode.EmbeddedFile, error) {
+	var efs []decode.EmbeddedFile
+	if dv := v.Child("data"); dv != nil {
+		return []decode.EmbeddedFile{{Name: "data", Range: dv.Range}}, nil
+	}
+	for i, iv := range v.Child("images").Children() {
+		name := fmt.Sprintf("image%d", i)
+		if n, ok := iv.Child("name").Scalar().Value().(string); ok {
+			name = n
+		}
+		ef := decode.EmbeddedFile{Name: name}
+		if dv := iv.Child("data"); dv != nil {
+			ef.Range = dv.Range
+		}
+		efs = append(efs, ef)
+	}
+	return efs, nil
+}
@@ -0,0 +1,237 @@
+package uf2
+
+// https://github.com/microsoft/uf2
+// https://github.com/microsoft/uf2/blob/master/utils/uf2families.json
+
+import (
+	"bytes"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.UF2,
+		Description: "USB Flashing Format firmware image",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte("UF2\nWQ]\x9e")}},
+		DecodeFn:    uf2Decode,
+	})
+}
+
+const (
+	magicStart0 = 0x0a324655
+	magicStart1 = 0x9e5d5157
+	magicEnd    = 0x0ab16f30
+)
+
+const (
+	blockBytes    = 512
+	dataAreaBytes = 476
+	md5AreaBytes  = 24
+)
+
+var familyIDNames = scalar.UToSymStr{
+	0x00ff6919: "stm32l4",
+	0x16573617: "atmega32",
+	0x1851780a: "saml21",
+	0x1b57745f: "nrf52",
+	0x1c5f21b0: "esp32",
+	0x2abc77ec: "lpc55",
+	0x300f5633: "stm32g0",
+	0x4fb2d5bd: "mimxrt10xx",
+	0x53b80f00: "stm32f7",
+	0x55114460: "samd51",
+	0x57755a57: "stm32f4",
+	0x5ee21072: "stm32f1",
+	0x647824b6: "stm32f0",
+	0x68ed2b88: "samd21",
+	0x6b846188: "stm32f3",
+	0x6db66082: "stm32h7",
+	0x70d16653: "stm32wb",
+	0x7eab61ed: "esp8266",
+	0xada52840: "nrf52840",
+	0xbfdd4eee: "esp32s2",
+	0xc47e5767: "esp32s3",
+	0xd42ba06c: "esp32c3",
+	0xe48bff56: "rp2040",
+}
+
+var extensionTagNames = scalar.UToSymStr{
+	0x9fc7bc: "version",
+	0x650d9d: "description",
+	0x0be9f7: "page_size",
+	0xb46db0: "sha2",
+	0xc8a729: "device_type_id",
+}
+
+type block struct {
+	notMainFlash bool
+	targetAddr   uint64
+	familyID     uint64
+	payload      *bitio.Buffer
+}
+
+func decodeBlock(d *decode.D) block {
+	var b block
+	var hasExtensionTags bool
+	var hasMD5 bool
+	var familyIDPresent bool
+	var fileContainer bool
+
+	d.FieldU32("magic_start0", d.AssertU(magicStart0), scalar.Hex)
+	d.FieldU32("magic_start1", d.AssertU(magicStart1), scalar.Hex)
+	d.FieldStruct("flags", func(d *decode.D) {
+		// 32LE flags
+		d.FieldU7("unused0")
+		b.notMainFlash = d.FieldBool("not_main_flash")
+		hasExtensionTags = d.FieldBool("extension_tags")
+		hasMD5 = d.FieldBool("md5_checksum")
+		familyIDPresent = d.FieldBool("family_id_present")
+		fileContainer = d.FieldBool("file_container")
+		d.FieldU4("unused1")
+		d.FieldU16("unused2")
+	})
+
+	b.targetAddr = d.FieldU32("target_addr", scalar.Hex)
+	payloadSize := d.FieldU32("payload_size", d.ValidateURange(0, dataAreaBytes))
+	d.FieldU32("block_no")
+	d.FieldU32("num_blocks")
+	switch {
+	case familyIDPresent:
+		b.familyID = d.FieldU32("family_id", familyIDNames, scalar.Hex)
+	case fileContainer:
+		d.FieldU32("file_size")
+	default:
+		d.FieldU32("reserved")
+	}
+
+	d.LenFn(dataAreaBytes*8, func(d *decode.D) {
+		if payloadSize > dataAreaBytes {
+			payloadSize = dataAreaBytes
+		}
+		b.payload = d.FieldRawLen("data", int64(payloadSize)*8)
+
+		if hasExtensionTags {
+			if n := d.AlignBits(32); n > 0 {
+				d.FieldRawLen("padding0", int64(n))
+			}
+			d.FieldArray("extension_tags", func(d *decode.D) {
+				for d.BitsLeft() >= 32 {
+					size := d.PeekBits(8)
+					if size == 0 {
+						break
+					}
+					d.FieldStruct("tag", func(d *decode.D) {
+						d.FieldU8("size", d.RequireURange(4, 255))
+						tagType := d.FieldU24("type", extensionTagNames, scalar.Hex)
+						switch tagType {
+						case 0x9fc7bc, 0x650d9d:
+							d.FieldUTF8NullFixedLen("value", int(size)-4)
+						case 0x0be9f7:
+							d.FieldU32("value")
+						case 0xc8a729:
+							d.FieldU("value", int(size-4)*8, scalar.Hex)
+						default:
+							d.FieldRawLen("value", int64(size-4)*8)
+						}
+						if n := d.AlignBits(32); n > 0 {
+							d.FieldRawLen("padding", int64(n))
+						}
+					})
+				}
+			})
+			if d.BitsLeft() >= 32 {
+				d.FieldU32("extension_tags_end", d.ValidateU(0))
+			}
+		}
+
+		if hasMD5 {
+			paddingBits := d.BitsLeft() - md5AreaBytes*8
+			if paddingBits > 0 {
+				d.FieldRawLen("padding1", paddingBits)
+			}
+			d.FieldStruct("md5", func(d *decode.D) {
+				d.FieldU32("address", scalar.Hex)
+				d.FieldU32("length")
+				d.FieldRawLen("checksum", 16*8, scalar.RawHex)
+			})
+		}
+
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("padding", d.BitsLeft())
+		}
+	})
+	d.FieldU32("magic_end", d.AssertU(magicEnd), scalar.Hex)
+
+	return b
+}
+
+func uf2Decode(d *decode.D, in interface{}) interface{} {
+	d.Endian = decode.LittleEndian
+
+	var blocks []block
+	d.FieldArray("blocks", func(d *decode.D) {
+		for d.BitsLeft() >= blockBytes*8 {
+			if !bytes.Equal(d.PeekBytes(4), []byte("UF2\n")) {
+				break
+			}
+			d.FieldStruct("block", func(d *decode.D) {
+				blocks = append(blocks, decodeBlock(d))
+			})
+		}
+	})
+	if len(blocks) == 0 {
+		d.Fatalf("no blocks found")
+	}
+
+	// reassemble main flash payload into runs of contiguous addresses
+	type payload struct {
+		familyID uint64
+		address  uint64
+		size     uint64
+		readers  []bitio.BitReadAtSeeker
+		nextAddr uint64
+	}
+	var payloads []*payload
+	var current *payload
+	for _, b := range blocks {
+		if b.notMainFlash {
+			continue
+		}
+		size := uint64(b.payload.Len() / 8)
+		if current == nil || current.familyID != b.familyID || current.nextAddr != b.targetAddr {
+			current = &payload{familyID: b.familyID, address: b.targetAddr, nextAddr: b.targetAddr}
+			payloads = append(payloads, current)
+		}
+		current.readers = append(current.readers, b.payload)
+		current.size += size
+		current.nextAddr += size
+	}
+
+	d.FieldArray("payloads", func(d *decode.D) {
+		for _, p := range payloads {
+			d.FieldStruct("payload", func(d *decode.D) {
+				d.FieldValueU("family_id", p.familyID, familyIDNames, scalar.Hex)
+				d.FieldValueU("address", p.address, scalar.Hex)
+				d.FieldValueU("size", p.size)
+
+				mbr, err := bitio.NewMultiBitReader(p.readers)
+				if err != nil {
+					d.IOPanic(err, "NewMultiBitReader")
+				}
+				bb, err := bitio.NewBufferFromBitReadSeeker(mbr)
+				if err != nil {
+					d.IOPanic(err, "NewBufferFromBitReadSeeker")
+				}
+				d.FieldRootBitBuf("data", bb)
+			})
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,278 @@
+package usb
+
+// https://www.usb.org/document-library/usb-20-specification chapter 9
+// https://www.usb.org/defined-class-codes
+
+import (
+	"fmt"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+const (
+	descriptorTypeDevice        = 0x01
+	descriptorTypeConfiguration = 0x02
+	descriptorTypeString        = 0x03
+	descriptorTypeInterface     = 0x04
+	descriptorTypeEndpoint      = 0x05
+	descriptorTypeQualifier     = 0x06
+	descriptorTypeOtherSpeed    = 0x07
+	descriptorTypeIAD           = 0x0b
+	descriptorTypeHID           = 0x21
+)
+
+var descriptorTypeNames = scalar.UToSymStr{
+	descriptorTypeDevice:        "device",
+	descriptorTypeConfiguration: "configuration",
+	descriptorTypeString:        "string",
+	descriptorTypeInterface:     "interface",
+	descriptorTypeEndpoint:      "endpoint",
+	descriptorTypeQualifier:     "device_qualifier",
+	descriptorTypeOtherSpeed:    "other_speed_configuration",
+	0x08:                        "interface_power",
+	0x09:                        "otg",
+	0x0a:                        "debug",
+	descriptorTypeIAD:           "interface_association",
+	0x0f:                        "bos",
+	0x10:                        "device_capability",
+	descriptorTypeHID:           "hid",
+	0x22:                        "hid_report",
+	0x24:                        "cs_interface",
+	0x25:                        "cs_endpoint",
+	0x29:                        "hub",
+	0x30:                        "superspeed_endpoint_companion",
+}
+
+var classCodeNames = scalar.UToSymStr{
+	0x00: "use_interface_descriptors",
+	0x01: "audio",
+	0x02: "cdc",
+	0x03: "hid",
+	0x05: "physical",
+	0x06: "image",
+	0x07: "printer",
+	0x08: "mass_storage",
+	0x09: "hub",
+	0x0a: "cdc_data",
+	0x0b: "smart_card",
+	0x0d: "content_security",
+	0x0e: "video",
+	0x0f: "personal_healthcare",
+	0x10: "audio_video",
+	0x11: "billboard",
+	0x12: "type_c_bridge",
+	0xdc: "diagnostic",
+	0xe0: "wireless_controller",
+	0xef: "miscellaneous",
+	0xfe: "application_specific",
+	0xff: "vendor_specific",
+}
+
+const (
+	requestGetDescriptor = 0x06
+	requestSetDescriptor = 0x07
+)
+
+var standardRequestNames = scalar.UToSymStr{
+	0x00:                 "get_status",
+	0x01:                 "clear_feature",
+	0x03:                 "set_feature",
+	0x05:                 "set_address",
+	requestGetDescriptor: "get_descriptor",
+	requestSetDescriptor: "set_descriptor",
+	0x08:                 "get_configuration",
+	0x09:                 "set_configuration",
+	0x0a:                 "get_interface",
+	0x0b:                 "set_interface",
+	0x0c:                 "synch_frame",
+}
+
+var directionNames = scalar.UToSymStr{
+	0: "out",
+	1: "in",
+}
+
+const requestTypeStandard = 0
+
+var requestTypeNames = scalar.UToSymStr{
+	requestTypeStandard: "standard",
+	1:                   "class",
+	2:                   "vendor",
+	3:                   "reserved",
+}
+
+var recipientNames = scalar.UToSymStr{
+	0: "device",
+	1: "interface",
+	2: "endpoint",
+	3: "other",
+}
+
+var endpointTransferTypeNames = scalar.UToSymStr{
+	0: "control",
+	1: "isochronous",
+	2: "bulk",
+	3: "interrupt",
+}
+
+var endpointSyncTypeNames = scalar.UToSymStr{
+	0: "no_synchronization",
+	1: "asynchronous",
+	2: "adaptive",
+	3: "synchronous",
+}
+
+var endpointUsageTypeNames = scalar.UToSymStr{
+	0: "data",
+	1: "feedback",
+	2: "implicit_feedback",
+	3: "reserved",
+}
+
+// max power is in 2 mA units
+var maxPowerMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	s.Description = fmt.Sprintf("%d mA", s.ActualU()*2)
+	return s, nil
+})
+
+func decodeSetup(d *decode.D) {
+	var requestType uint64
+	d.FieldStruct("bm_request_type", func(d *decode.D) {
+		d.FieldU1("direction", directionNames)
+		requestType = d.FieldU2("type", requestTypeNames)
+		d.FieldU5("recipient", recipientNames)
+	})
+	var request uint64
+	if requestType == requestTypeStandard {
+		request = d.FieldU8("b_request", standardRequestNames)
+	} else {
+		request = d.FieldU8("b_request")
+	}
+	if requestType == requestTypeStandard && (request == requestGetDescriptor || request == requestSetDescriptor) {
+		d.FieldStruct("w_value", func(d *decode.D) {
+			d.FieldU8("descriptor_index")
+			d.FieldU8("descriptor_type", descriptorTypeNames)
+		})
+	} else {
+		d.FieldU16("w_value", scalar.Hex)
+	}
+	d.FieldU16("w_index", scalar.Hex)
+	d.FieldU16("w_length")
+}
+
+func decodeEndpointAddress(d *decode.D) {
+	d.FieldU1("direction", directionNames)
+	d.FieldU3("reserved")
+	d.FieldU4("number")
+}
+
+func decodeDescriptor(d *decode.D) {
+	length := d.FieldU8("b_length")
+	descriptorType := d.FieldU8("b_descriptor_type", descriptorTypeNames)
+
+	d.LenFn(int64(length-2)*8, func(d *decode.D) {
+		switch descriptorType {
+		case descriptorTypeDevice,
+			descriptorTypeQualifier:
+			d.FieldU16("bcd_usb", scalar.Hex)
+			d.FieldU8("b_device_class", classCodeNames, scalar.Hex)
+			d.FieldU8("b_device_sub_class", scalar.Hex)
+			d.FieldU8("b_device_protocol", scalar.Hex)
+			d.FieldU8("b_max_packet_size0")
+			if descriptorType == descriptorTypeQualifier {
+				d.FieldU8("b_num_configurations")
+				d.FieldU8("b_reserved")
+				break
+			}
+			d.FieldU16("id_vendor", scalar.Hex)
+			d.FieldU16("id_product", scalar.Hex)
+			d.FieldU16("bcd_device", scalar.Hex)
+			d.FieldU8("i_manufacturer")
+			d.FieldU8("i_product")
+			d.FieldU8("i_serial_number")
+			d.FieldU8("b_num_configurations")
+		case descriptorTypeConfiguration,
+			descriptorTypeOtherSpeed:
+			d.FieldU16("w_total_length")
+			d.FieldU8("b_num_interfaces")
+			d.FieldU8("b_configuration_value")
+			d.FieldU8("i_configuration")
+			d.FieldStruct("bm_attributes", func(d *decode.D) {
+				d.FieldBool("reserved_one")
+				d.FieldBool("self_powered")
+				d.FieldBool("remote_wakeup")
+				d.FieldU5("reserved")
+			})
+			d.FieldU8("b_max_power", maxPowerMap)
+		case descriptorTypeString:
+			// string descriptor zero is a list of supported language IDs but
+			// it is not known here which index was requested
+			d.FieldUTF16LE("b_string", int(d.BitsLeft()/8))
+		case descriptorTypeInterface:
+			d.FieldU8("b_interface_number")
+			d.FieldU8("b_alternate_setting")
+			d.FieldU8("b_num_endpoints")
+			d.FieldU8("b_interface_class", classCodeNames, scalar.Hex)
+			d.FieldU8("b_interface_sub_class", scalar.Hex)
+			d.FieldU8("b_interface_protocol", scalar.Hex)
+			d.FieldU8("i_interface")
+		case descriptorTypeEndpoint:
+			d.FieldStruct("b_endpoint_address", decodeEndpointAddress)
+			d.FieldStruct("bm_attributes", func(d *decode.D) {
+				d.FieldU2("reserved")
+				d.FieldU2("usage_type", endpointUsageTypeNames)
+				d.FieldU2("synchronization_type", endpointSyncTypeNames)
+				d.FieldU2("transfer_type", endpointTransferTypeNames)
+			})
+			d.FieldU16("w_max_packet_size")
+			d.FieldU8("b_interval")
+		case descriptorTypeIAD:
+			d.FieldU8("b_first_interface")
+			d.FieldU8("b_interface_count")
+			d.FieldU8("b_function_class", classCodeNames, scalar.Hex)
+			d.FieldU8("b_function_sub_class", scalar.Hex)
+			d.FieldU8("b_function_protocol", scalar.Hex)
+			d.FieldU8("i_function")
+		case descriptorTypeHID:
+			d.FieldU16("bcd_hid", scalar.Hex)
+			d.FieldU8("b_country_code")
+			numDescriptors := d.FieldU8("b_num_descriptors")
+			d.FieldArray("descriptors", func(d *decode.D) {
+				for i := uint64(0); i < numDescriptors; i++ {
+					d.FieldStruct("descriptor", func(d *decode.D) {
+						d.FieldU8("b_descriptor_type", descriptorTypeNames)
+						d.FieldU16("w_descriptor_length")
+					})
+				}
+			})
+		}
+		if d.NotEnd() {
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+}
+
+// descriptors have a length and type header and a response can have several,
+// ex a configuration descriptor is followed by its interface and endpoint descriptors
+func isDescriptors(b []byte) bool {
+	if len(b) < 2 {
+		return false
+	}
+	for len(b) > 0 {
+		if len(b) < 2 || b[0] < 2 || int(b[0]) > len(b) {
+			return false
+		}
+		if _, ok := descriptorTypeNames[uint64(b[1])]; !ok {
+			return false
+		}
+		b = b[b[0]:]
+	}
+	return true
+}
+
+func decodeDescriptors(d *decode.D) {
+	for !d.End() {
+		d.FieldStruct("descriptor", decodeDescriptor)
+	}
+}
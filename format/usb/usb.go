@@ -0,0 +1,75 @@
+package usb
+
+// https://www.tcpdump.org/linktypes/LINKTYPE_USB_LINUX.html
+// https://www.tcpdump.org/linktypes/LINKTYPE_USB_LINUX_MMAPPED.html
+// https://www.tcpdump.org/linktypes/LINKTYPE_USBPCAP.html
+
+// TODO: decode class specific requests and payloads, ex HID reports and mass storage
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.USB_PACKET,
+		Description: "USB packet (Linux usbmon or USBPcap)",
+		Groups:      []string{format.LINK_FRAME},
+		DecodeFn:    decodeUSB,
+	})
+}
+
+// same numbering for usbmon and USBPcap
+const (
+	transferTypeIsochronous = 0
+	transferTypeInterrupt   = 1
+	transferTypeControl     = 2
+	transferTypeBulk        = 3
+)
+
+var transferTypeNames = scalar.UToSymStr{
+	transferTypeIsochronous: "isochronous",
+	transferTypeInterrupt:   "interrupt",
+	transferTypeControl:     "control",
+	transferTypeBulk:        "bulk",
+}
+
+// control transfer data from device is usually descriptors, decode if it looks like it
+func fieldData(d *decode.D, transferType uint64, directionIn bool, nBytes int64) {
+	if nBytes <= 0 {
+		return
+	}
+	if transferType == transferTypeControl && directionIn && isDescriptors(d.PeekBytes(int(nBytes))) {
+		d.FieldArray("descriptors", func(d *decode.D) {
+			d.LenFn(nBytes*8, decodeDescriptors)
+		})
+		return
+	}
+	d.FieldRawLen("data", nBytes*8)
+}
+
+func decodeUSB(d *decode.D, in interface{}) interface{} {
+	lfi, ok := in.(format.LinkFrameIn)
+	if !ok {
+		d.Fatalf("no link type")
+	}
+
+	// usbmon headers are in host byte order, assume little endian as most hosts
+	d.Endian = decode.LittleEndian
+
+	switch lfi.Type {
+	case format.LinkTypeUSB_LINUX:
+		decodeUSBMon(d, false)
+	case format.LinkTypeUSB_LINUX_MMAPPED:
+		decodeUSBMon(d, true)
+	case format.LinkTypeUSBPCAP:
+		decodeUSBPcap(d)
+	default:
+		d.Fatalf("wrong link type %d", lfi.Type)
+	}
+
+	return nil
+}
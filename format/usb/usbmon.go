@@ -0,0 +1,101 @@
+package usb
+
+// https://www.kernel.org/doc/Documentation/usb/usbmon.txt
+// https://github.com/the-tcpdump-group/libpcap/blob/master/pcap/usb.h
+
+import (
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var usbmonEventTypeNames = scalar.UToSymStr{
+	'S': "submission",
+	'C': "callback",
+	'E': "error",
+}
+
+// negative errno
+var usbmonStatusNames = scalar.SToSymStr{
+	0:    "success",
+	-2:   "enoent",
+	-18:  "exdev",
+	-32:  "epipe",
+	-71:  "eproto",
+	-75:  "eoverflow",
+	-104: "econnreset",
+	-108: "eshutdown",
+	-115: "einprogress",
+	-121: "eremoteio",
+}
+
+// setup_flag and data_flag are zero if setup packet or data is present, otherwise a character
+var usbmonFlagNames = scalar.UToSymStr{
+	0:   "present",
+	'-': "not_present",
+	'<': "incoming",
+	'>': "outgoing",
+	'Z': "zero_length",
+}
+
+func decodeUSBMon(d *decode.D, mmapped bool) {
+	d.FieldU64("id", scalar.Hex)
+	d.FieldU8("event_type", usbmonEventTypeNames)
+	transferType := d.FieldU8("transfer_type", transferTypeNames)
+	var directionIn bool
+	d.FieldStruct("endpoint", func(d *decode.D) {
+		directionIn = d.FieldU1("direction", directionNames) == 1
+		d.FieldU3("reserved")
+		d.FieldU4("number")
+	})
+	d.FieldU8("device_address")
+	d.FieldU16("bus_id")
+	setupFlag := d.FieldU8("setup_flag", usbmonFlagNames)
+	d.FieldU8("data_flag", usbmonFlagNames)
+	d.FieldS64("ts_sec")
+	d.FieldS32("ts_usec")
+	d.FieldS32("status", usbmonStatusNames)
+	d.FieldU32("urb_len")
+	dataLen := d.FieldU32("data_len")
+
+	switch {
+	case setupFlag == 0:
+		d.FieldStruct("setup", decodeSetup)
+	case transferType == transferTypeIsochronous:
+		d.FieldStruct("iso", func(d *decode.D) {
+			d.FieldS32("error_count")
+			d.FieldS32("numdesc")
+		})
+	default:
+		d.FieldRawLen("setup", 8*8)
+	}
+
+	if mmapped {
+		d.FieldS32("interval")
+		d.FieldS32("start_frame")
+		d.FieldU32("xfer_flags", scalar.Hex)
+		ndesc := d.FieldU32("ndesc")
+		// isochronous descriptors are before data and not included in data_len
+		if transferType == transferTypeIsochronous && ndesc > 0 {
+			d.FieldArray("iso_descriptors", func(d *decode.D) {
+				for i := uint64(0); i < ndesc && d.BitsLeft() >= 16*8; i++ {
+					d.FieldStruct("iso_descriptor", func(d *decode.D) {
+						d.FieldS32("status", usbmonStatusNames)
+						d.FieldU32("offset")
+						d.FieldU32("len")
+						d.FieldU32("pad")
+					})
+				}
+			})
+		}
+	}
+
+	// capture can be truncated
+	nBytes := int64(dataLen)
+	if left := d.BitsLeft() / 8; nBytes > left {
+		nBytes = left
+	}
+	fieldData(d, transferType, directionIn, nBytes)
+	if d.NotEnd() {
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+}
@@ -0,0 +1,112 @@
+package usb
+
+// https://desowin.org/usbpcap/captureformat.html
+
+import (
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+const usbpcapTransferTypeIRPInfo = 0xfe
+
+var usbpcapTransferTypeNames = scalar.UToSymStr{
+	transferTypeIsochronous:    "isochronous",
+	transferTypeInterrupt:      "interrupt",
+	transferTypeControl:        "control",
+	transferTypeBulk:           "bulk",
+	usbpcapTransferTypeIRPInfo: "irp_info",
+	0xff:                       "unknown",
+}
+
+var usbpcapStatusNames = scalar.UToSymStr{
+	0x00000000: "success",
+	0x40000000: "pending",
+	0xc0000004: "stall_pid",
+	0xc0000005: "dev_not_responding",
+	0xc0010000: "canceled",
+}
+
+var usbpcapFunctionNames = scalar.UToSymStr{
+	0x0000: "select_configuration",
+	0x0001: "select_interface",
+	0x0002: "abort_pipe",
+	0x0003: "take_frame_length_control",
+	0x0004: "release_frame_length_control",
+	0x0005: "get_frame_length",
+	0x0006: "set_frame_length",
+	0x0007: "get_current_frame_number",
+	0x0008: "control_transfer",
+	0x0009: "bulk_or_interrupt_transfer",
+	0x000a: "isoch_transfer",
+	0x000b: "get_descriptor_from_device",
+	0x000c: "set_descriptor_to_device",
+}
+
+const usbpcapStageSetup = 0
+
+var usbpcapStageNames = scalar.UToSymStr{
+	usbpcapStageSetup: "setup",
+	1:                 "data",
+	2:                 "status",
+	3:                 "complete",
+}
+
+func decodeUSBPcap(d *decode.D) {
+	headerLen := d.FieldU16("header_len")
+	d.FieldU64("irp_id", scalar.Hex)
+	d.FieldU32("status", usbpcapStatusNames, scalar.Hex)
+	d.FieldU16("function", usbpcapFunctionNames, scalar.Hex)
+	d.FieldStruct("info", func(d *decode.D) {
+		d.FieldU7("reserved")
+		d.FieldBool("pdo_to_fdo")
+	})
+	d.FieldU16("bus")
+	d.FieldU16("device")
+	var directionIn bool
+	d.FieldStruct("endpoint", func(d *decode.D) {
+		directionIn = d.FieldU1("direction", directionNames) == 1
+		d.FieldU3("reserved")
+		d.FieldU4("number")
+	})
+	transferType := d.FieldU8("transfer", usbpcapTransferTypeNames)
+	dataLength := d.FieldU32("data_length")
+
+	var stage uint64
+	// transfer specific header is rest of header
+	d.LenFn(int64(headerLen)*8-d.Pos(), func(d *decode.D) {
+		switch transferType {
+		case transferTypeControl:
+			stage = d.FieldU8("stage", usbpcapStageNames)
+		case transferTypeIsochronous:
+			d.FieldU32("start_frame")
+			numberOfPackets := d.FieldU32("number_of_packets")
+			d.FieldU32("error_count")
+			d.FieldArray("packets", func(d *decode.D) {
+				for i := uint64(0); i < numberOfPackets; i++ {
+					d.FieldStruct("packet", func(d *decode.D) {
+						d.FieldU32("offset")
+						d.FieldU32("length")
+						d.FieldU32("status", usbpcapStatusNames, scalar.Hex)
+					})
+				}
+			})
+		}
+		if d.NotEnd() {
+			d.FieldRawLen("unknown", d.BitsLeft())
+		}
+	})
+
+	// capture can be truncated
+	nBytes := int64(dataLength)
+	if left := d.BitsLeft() / 8; nBytes > left {
+		nBytes = left
+	}
+	if transferType == transferTypeControl && stage == usbpcapStageSetup && nBytes >= 8 {
+		d.FieldStruct("setup", decodeSetup)
+		nBytes -= 8
+	}
+	fieldData(d, transferType, directionIn, nBytes)
+	if d.NotEnd() {
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+}
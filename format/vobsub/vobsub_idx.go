@@ -0,0 +1,254 @@
+package vobsub
+
+// VobSub index file, timestamps and positions of subpictures in the .sub file
+// the .sub file is a MPEG program stream with subpictures and can be decoded using mpeg_pes
+// https://github.com/FFmpeg/FFmpeg/blob/master/libavformat/mpeg.c
+// https://sourceforge.net/p/guliverkli2/code/HEAD/tree/src/subtitles/VobSubFile.cpp
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/internal/lineparse"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.VOBSUB_IDX,
+		Description: "VobSub subtitle index",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte(headerMagic)}},
+		DecodeFn:    vobsubIdxDecode,
+	})
+}
+
+const headerMagic = "# VobSub index file, v"
+
+type line struct {
+	start int // byte offset in input
+	end   int // including newline
+	text  string
+	// for "key: value" lines
+	valueStart int
+	key        string
+	value      string
+}
+
+func readLine(b []byte, start int) line {
+	l := line{start: start, end: len(b)}
+	if i := bytes.IndexByte(b[start:], '\n'); i != -1 {
+		l.end = start + i + 1
+	}
+	l.text = strings.TrimRight(string(b[start:l.end]), "\r\n")
+	if i := strings.Index(l.text, ":"); i != -1 && !strings.HasPrefix(l.text, "#") {
+		l.key = strings.TrimSpace(l.text[0:i])
+		l.valueStart = start + i + 1
+		for l.valueStart < l.end && b[l.valueStart] == ' ' {
+			l.valueStart++
+		}
+		l.value = strings.TrimSpace(l.text[l.valueStart-start:])
+	}
+	return l
+}
+
+// splits line into comma separated parts, first part starts at line start and
+// last ends at line end so that fields for a line covers the whole line
+func (l line) split(b []byte) []lineparse.Token {
+	var spans []lineparse.Token
+	start := l.start
+	for {
+		end := l.end
+		if i := bytes.IndexByte(b[start:l.end], ','); i != -1 {
+			end = start + i + 1
+		}
+		text := strings.TrimSpace(strings.TrimRight(string(b[start:end]), ",\r\n"))
+		spans = append(spans, lineparse.Token{Start: start, End: end, Value: text})
+		if end == l.end {
+			break
+		}
+		start = end
+	}
+	return spans
+}
+
+// value of "key: value" part
+func keyValue(s string) string {
+	if i := strings.Index(s, ":"); i != -1 {
+		return strings.TrimSpace(s[i+1:])
+	}
+	return s
+}
+
+func fieldSpanU(d *decode.D, start int, end int, name string, value string, base int, sms ...scalar.Mapper) uint64 {
+	n, err := strconv.ParseUint(value, base, 64)
+	if err != nil {
+		d.Fatalf("%s: invalid number %q", name, value)
+	}
+	return lineparse.FieldU(d, start, end, name, n, sms...)
+}
+
+// parses "hh:mm:ss:mmm" with optional sign into milliseconds
+func parseTimestamp(s string) (int64, bool) {
+	sign := int64(1)
+	switch {
+	case strings.HasPrefix(s, "-"):
+		sign = -1
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) != 4 {
+		return 0, false
+	}
+	var n [4]int64
+	for i, p := range parts {
+		v, err := strconv.ParseInt(p, 10, 64)
+		if err != nil || v < 0 {
+			return 0, false
+		}
+		n[i] = v
+	}
+	return sign * (((n[0]*60+n[1])*60+n[2])*1000 + n[3]), true
+}
+
+func fieldTimestamp(d *decode.D, s lineparse.Token, name string) int64 {
+	v := keyValue(s.Value)
+	ms, ok := parseTimestamp(v)
+	if !ok {
+		d.Fatalf("%s: invalid timestamp %q", name, v)
+	}
+	lineparse.FieldStr(d, s.Start, s.End, name, v)
+	return ms
+}
+
+func fieldSetting(d *decode.D, b []byte, l line) {
+	d.FieldStruct("setting", func(d *decode.D) {
+		lineparse.FieldStr(d, l.start, l.valueStart, "key", l.key)
+		switch l.key {
+		case "size":
+			parts := strings.Split(l.value, "x")
+			if len(parts) != 2 {
+				d.Fatalf("size: invalid size %q", l.value)
+			}
+			i := strings.Index(string(b[l.valueStart:l.end]), "x")
+			fieldSpanU(d, l.valueStart, l.valueStart+i+1, "width", strings.TrimSpace(parts[0]), 10)
+			fieldSpanU(d, l.valueStart+i+1, l.end, "height", strings.TrimSpace(parts[1]), 10)
+		case "palette":
+			d.FieldArray("colors", func(d *decode.D) {
+				vl := l
+				vl.start = l.valueStart
+				for _, s := range vl.split(b) {
+					fieldSpanU(d, s.Start, s.End, "color", s.Value, 16, scalar.Hex)
+				}
+			})
+		case "langidx":
+			fieldSpanU(d, l.valueStart, l.end, "value", l.value, 10)
+		default:
+			lineparse.FieldStr(d, l.valueStart, l.end, "value", l.value)
+		}
+	})
+}
+
+type track struct {
+	line  line
+	lines []line
+}
+
+func vobsubIdxDecode(d *decode.D, in interface{}) interface{} {
+	b := d.BytesLen(int(d.Len() / 8))
+	d.SeekAbs(0)
+
+	header := readLine(b, 0)
+	if !strings.HasPrefix(header.text, headerMagic) {
+		d.Fatalf("no %s header", headerMagic)
+	}
+	version := strings.TrimSpace(header.text[len(headerMagic):])
+	if i := strings.IndexAny(version, " \t"); i != -1 {
+		version = version[0:i]
+	}
+
+	var comments []line
+	var settings []line
+	var tracks []*track
+	var current *track
+
+	for pos := header.end; pos < len(b); {
+		l := readLine(b, pos)
+		pos = l.end
+
+		switch {
+		case strings.TrimSpace(l.text) == "":
+			// empty line
+		case strings.HasPrefix(l.text, "#"):
+			comments = append(comments, l)
+		case l.key == "":
+			d.Fatalf("line without key/value %q", l.text)
+		case l.key == "id":
+			current = &track{line: l}
+			tracks = append(tracks, current)
+		case current != nil:
+			current.lines = append(current.lines, l)
+		default:
+			settings = append(settings, l)
+		}
+	}
+
+	lineparse.FieldSpan(d, 0, header.end, func(d *decode.D) {
+		d.FieldUTF8("header", header.end)
+	})
+	d.FieldValueStr("version", version)
+	if len(comments) > 0 {
+		d.FieldArray("comments", func(d *decode.D) {
+			for _, l := range comments {
+				lineparse.FieldStr(d, l.start, l.end, "comment", strings.TrimSpace(l.text[1:]))
+			}
+		})
+	}
+	d.FieldArray("settings", func(d *decode.D) {
+		for _, l := range settings {
+			fieldSetting(d, b, l)
+		}
+	})
+	d.FieldArray("tracks", func(d *decode.D) {
+		for _, t := range tracks {
+			d.FieldStruct("track", func(d *decode.D) {
+				spans := t.line.split(b)
+				lineparse.FieldStr(d, spans[0].Start, spans[0].End, "language", keyValue(spans[0].Value))
+				if len(spans) > 1 {
+					fieldSpanU(d, spans[1].Start, spans[1].End, "index", keyValue(spans[1].Value), 10)
+				}
+
+				// delay shifts all following timestamps
+				var delay int64
+				d.FieldArray("entries", func(d *decode.D) {
+					for _, l := range t.lines {
+						switch l.key {
+						case "delay":
+							delay += fieldTimestamp(d, lineparse.Token{Start: l.start, End: l.end, Value: l.text}, "delay")
+						case "timestamp":
+							d.FieldStruct("timestamp", func(d *decode.D) {
+								spans := l.split(b)
+								if len(spans) != 2 {
+									d.Fatalf("timestamp: invalid line %q", l.text)
+								}
+								ms := fieldTimestamp(d, spans[0], "timestamp")
+								d.FieldValueFloat("time", float64(ms+delay)/1000)
+								fieldSpanU(d, spans[1].Start, spans[1].End, "filepos", keyValue(spans[1].Value), 16, scalar.Hex)
+							})
+						default:
+							fieldSetting(d, b, l)
+						}
+					}
+				})
+			})
+		}
+	})
+
+	return nil
+}
@@ -23,6 +23,10 @@ func init() {
 	})
 }
 
+// METADATA_BLOCK_PICTURE value is a base64 encoded FLAC picture block
+// https://wiki.xiph.org/VorbisComment#METADATA_BLOCK_PICTURE
+const metadataBlockPictureKey = "METADATA_BLOCK_PICTURE"
+
 func commentDecode(d *decode.D, in interface{}) interface{} {
 	d.Endian = decode.LittleEndian
 
@@ -34,13 +38,14 @@ func commentDecode(d *decode.D, in interface{}) interface{} {
 		userCommentLength := d.FieldU32("length")
 		userCommentStart := d.Pos()
 		userComment := d.FieldUTF8("comment", int(userCommentLength))
-		var metadataBlockPicturePreix = "METADATA_BLOCK_PICTURE="
-		var metadataBlockPicturePrefixLower = "metadata_block_picture="
-
-		if strings.HasPrefix(userComment, metadataBlockPicturePreix) ||
-			strings.HasPrefix(userComment, metadataBlockPicturePrefixLower) {
 
-			base64Offset := int64(len(metadataBlockPicturePreix)) * 8
+		// field names are case-insensitive
+		key := userComment
+		if n := strings.IndexByte(userComment, '='); n != -1 {
+			key = userComment[0:n]
+		}
+		if len(key) < len(userComment) && strings.EqualFold(key, metadataBlockPictureKey) {
+			base64Offset := int64(len(key)+1) * 8
 			base64Len := int64(len(userComment))*8 - base64Offset
 			_, base64BB, dv, _, _ := d.TryFieldReaderRangeFormat(
 				"picture",
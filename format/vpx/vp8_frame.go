@@ -10,6 +10,7 @@ import (
 )
 
 // TODO: vpx frame?
+// TODO: token probability updates and rest of frame header
 
 func init() {
 	registry.MustRegister(decode.Format{
@@ -19,8 +20,161 @@ func init() {
 	})
 }
 
+// boolean entropy decoder, RFC 6386 section 7
+type vp8BoolDecoder struct {
+	buf      []byte
+	value    uint64
+	rng      uint64
+	bitCount int
+}
+
+func newVP8BoolDecoder(buf []byte) *vp8BoolDecoder {
+	bd := &vp8BoolDecoder{buf: buf, rng: 255}
+	bd.value = uint64(bd.nextByte())<<8 | uint64(bd.nextByte())
+	return bd
+}
+
+// past end of buffer reads as zeros
+func (bd *vp8BoolDecoder) nextByte() byte {
+	if len(bd.buf) == 0 {
+		return 0
+	}
+	b := bd.buf[0]
+	bd.buf = bd.buf[1:]
+	return b
+}
+
+func (bd *vp8BoolDecoder) bool(prob uint64) bool {
+	split := 1 + (((bd.rng - 1) * prob) >> 8)
+	bigSplit := split << 8
+	var v bool
+	if bd.value >= bigSplit {
+		v = true
+		bd.rng -= split
+		bd.value -= bigSplit
+	} else {
+		bd.rng = split
+	}
+	for bd.rng < 128 {
+		bd.value <<= 1
+		bd.rng <<= 1
+		bd.bitCount++
+		if bd.bitCount == 8 {
+			bd.bitCount = 0
+			bd.value |= uint64(bd.nextByte())
+		}
+	}
+	return v
+}
+
+// L(n) unsigned n bit literal
+func (bd *vp8BoolDecoder) literal(n int) uint64 {
+	var v uint64
+	for i := 0; i < n; i++ {
+		v <<= 1
+		if bd.bool(128) {
+			v |= 1
+		}
+	}
+	return v
+}
+
+// optional flag followed by n bit magnitude and sign
+func (bd *vp8BoolDecoder) fieldOptionalSigned(d *decode.D, name string, n int) {
+	if !bd.bool(128) {
+		d.FieldValueS(name, 0, scalar.Description("not updated"))
+		return
+	}
+	v := int64(bd.literal(n))
+	if bd.bool(128) {
+		v = -v
+	}
+	d.FieldValueS(name, v)
+}
+
+func vp8DecodeHeader(d *decode.D, bd *vp8BoolDecoder, isKeyFrame bool) {
+	if isKeyFrame {
+		d.FieldValueU("color_space", bd.literal(1))
+		d.FieldValueU("clamping_type", bd.literal(1))
+	}
+
+	segmentationEnabled := bd.literal(1) == 1
+	d.FieldValueBool("segmentation_enabled", segmentationEnabled)
+	if segmentationEnabled {
+		d.FieldStruct("update_segmentation", func(d *decode.D) {
+			updateMap := bd.literal(1) == 1
+			d.FieldValueBool("update_mb_segmentation_map", updateMap)
+			updateData := bd.literal(1) == 1
+			d.FieldValueBool("update_segment_feature_data", updateData)
+			if updateData {
+				d.FieldValueU("segment_feature_mode", bd.literal(1))
+				d.FieldArray("quantizer_update_values", func(d *decode.D) {
+					for i := 0; i < 4; i++ {
+						bd.fieldOptionalSigned(d, "quantizer_update_value", 7)
+					}
+				})
+				d.FieldArray("loop_filter_update_values", func(d *decode.D) {
+					for i := 0; i < 4; i++ {
+						bd.fieldOptionalSigned(d, "loop_filter_update_value", 6)
+					}
+				})
+			}
+			if updateMap {
+				d.FieldArray("segment_probs", func(d *decode.D) {
+					for i := 0; i < 3; i++ {
+						if bd.bool(128) {
+							d.FieldValueU("segment_prob", bd.literal(8))
+						} else {
+							d.FieldValueU("segment_prob", 255, scalar.Description("default"))
+						}
+					}
+				})
+			}
+		})
+	}
+
+	d.FieldValueU("filter_type", bd.literal(1))
+	d.FieldValueU("loop_filter_level", bd.literal(6))
+	d.FieldValueU("sharpness_level", bd.literal(3))
+
+	loopFilterAdjEnable := bd.literal(1) == 1
+	d.FieldValueBool("loop_filter_adj_enable", loopFilterAdjEnable)
+	if loopFilterAdjEnable {
+		modeRefLFDeltaUpdate := bd.literal(1) == 1
+		d.FieldValueBool("mode_ref_lf_delta_update", modeRefLFDeltaUpdate)
+		if modeRefLFDeltaUpdate {
+			d.FieldArray("ref_frame_deltas", func(d *decode.D) {
+				for i := 0; i < 4; i++ {
+					bd.fieldOptionalSigned(d, "delta", 6)
+				}
+			})
+			d.FieldArray("mb_mode_deltas", func(d *decode.D) {
+				for i := 0; i < 4; i++ {
+					bd.fieldOptionalSigned(d, "delta", 6)
+				}
+			})
+		}
+	}
+
+	d.FieldValueU("log2_nbr_of_dct_partitions", bd.literal(2))
+
+	d.FieldStruct("quant_indices", func(d *decode.D) {
+		d.FieldValueU("y_ac_qi", bd.literal(7))
+		bd.fieldOptionalSigned(d, "y_dc_delta", 4)
+		bd.fieldOptionalSigned(d, "y2_dc_delta", 4)
+		bd.fieldOptionalSigned(d, "y2_ac_delta", 4)
+		bd.fieldOptionalSigned(d, "uv_dc_delta", 4)
+		bd.fieldOptionalSigned(d, "uv_ac_delta", 4)
+	})
+
+	if isKeyFrame {
+		d.FieldValueBool("refresh_entropy_probs", bd.literal(1) == 1)
+	}
+}
+
 func vp8Decode(d *decode.D, in interface{}) interface{} {
 	var isKeyFrame bool
+	var firstPartSize uint64
 
 	versions := map[uint64]struct {
 		reconstruction string
@@ -40,7 +194,7 @@ func vp8Decode(d *decode.D, in interface{}) interface{} {
 		keyFrameV := d.FieldBool("frame_type", scalar.BoolToSymStr{true: "non_key_frame", false: "key_frame"})
 		firstPartSize1 := d.FieldU16LE("first_part_size1")
 
-		firstPartSize := firstPartSize0 | firstPartSize1<<3
+		firstPartSize = firstPartSize0 | firstPartSize1<<3
 		d.FieldValueU("first_part_size", firstPartSize)
 
 		isKeyFrame = !keyFrameV
@@ -65,6 +219,14 @@ func vp8Decode(d *decode.D, in interface{}) interface{} {
 		d.FieldValueU("height", height0|height1<<8)
 	}
 
+	// first partition is boolean entropy coded so fields are not bit aligned
+	if firstPartSize*8 <= uint64(d.BitsLeft()) {
+		bd := newVP8BoolDecoder(d.BytesRange(d.Pos(), int(firstPartSize)))
+		d.FieldStruct("header", func(d *decode.D) {
+			vp8DecodeHeader(d, bd, isKeyFrame)
+		})
+	}
+
 	d.FieldRawLen("data", d.BitsLeft())
 
 	return nil
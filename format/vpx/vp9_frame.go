@@ -9,8 +9,6 @@ import (
 	"github.com/wader/fq/pkg/scalar"
 )
 
-// TODO: vpx frame?
-
 const (
 	vp9FeatureProfile           = 1
 	vp9FeatureLevel             = 2
@@ -55,6 +53,35 @@ var vp9ProfilesMap = scalar.UToScalar{
 	3: {Description: "10–12 bit, chroma subsampling: 4:2:2, 4:4:0, 4:4:4"},
 }
 
+var vp9InterpolationFilterNames = scalar.UToSymStr{
+	0: "eighttap_smooth",
+	1: "eighttap",
+	2: "eighttap_sharp",
+	3: "bilinear",
+}
+
+var vp9RefFrameNames = scalar.UToSymStr{
+	0: "last",
+	1: "golden",
+	2: "altref",
+}
+
+const (
+	vp9MaxSegments         = 8
+	vp9MinTileWidthB64     = 4
+	vp9MaxTileWidthB64     = 64
+	vp9NumRefFrames        = 8
+	vp9RefsPerFrame        = 3
+	vp9MaxRefLFDeltas      = 4
+	vp9MaxModeLFDeltas     = 2
+	vp9SuperframeMarker    = 0b110
+	vp9SuperframeMinLength = 2
+)
+
+var vp9SegmentationFeatureNames = []string{"alt_q", "alt_l", "ref_frame", "skip"}
+var vp9SegmentationFeatureBits = []int{8, 6, 2, 0}
+var vp9SegmentationFeatureSigned = []bool{true, true, false, false}
+
 func init() {
 	registry.MustRegister(decode.Format{
 		Name:        format.VP9_FRAME,
@@ -63,6 +90,12 @@ func init() {
 	})
 }
 
+// reference frame slot sizes, zero if unknown
+type vp9State struct {
+	refFrameWidth  [vp9NumRefFrames]uint64
+	refFrameHeight [vp9NumRefFrames]uint64
+}
+
 func vp9DecodeFrameSyncCode(d *decode.D) {
 	d.FieldU8("frame_sync_byte_0")
 	d.FieldU8("frame_sync_byte_1")
@@ -102,15 +135,155 @@ func vp9DecodeColorConfig(d *decode.D, profile int) {
 	}
 }
 
-func vp9DecodeFrameSize(d *decode.D) {
-	d.FieldUFn("frame_width", func(d *decode.D) uint64 { return d.U16() + 1 })
-	d.FieldUFn("frame_height", func(d *decode.D) uint64 { return d.U16() + 1 })
+func vp9DecodeFrameSize(d *decode.D) (uint64, uint64) {
+	width := d.FieldUFn("frame_width", func(d *decode.D) uint64 { return d.U16() + 1 })
+	height := d.FieldUFn("frame_height", func(d *decode.D) uint64 { return d.U16() + 1 })
+	return width, height
 }
 
-func vp9Decode(d *decode.D, in interface{}) interface{} {
+func vp9DecodeRenderSize(d *decode.D) {
+	if d.FieldBool("render_and_frame_size_different") {
+		d.FieldUFn("render_width", func(d *decode.D) uint64 { return d.U16() + 1 })
+		d.FieldUFn("render_height", func(d *decode.D) uint64 { return d.U16() + 1 })
+	}
+}
+
+// su(n), magnitude followed by sign bit
+func vp9FieldSu(d *decode.D, name string, nBits int) int64 {
+	return d.FieldSFn(name, func(d *decode.D) int64 {
+		v := int64(d.U(nBits))
+		if d.Bool() {
+			return -v
+		}
+		return v
+	})
+}
+
+func vp9FieldProb(d *decode.D, name string) uint64 {
+	return d.FieldUFn(name, func(d *decode.D) uint64 {
+		if d.Bool() {
+			return d.U8()
+		}
+		return 255
+	})
+}
+
+func vp9DecodeLoopFilterParams(d *decode.D) {
+	d.FieldU6("level")
+	d.FieldU3("sharpness")
+	if !d.FieldBool("delta_enabled") {
+		return
+	}
+	if !d.FieldBool("delta_update") {
+		return
+	}
+	d.FieldArray("ref_deltas", func(d *decode.D) {
+		for i := 0; i < vp9MaxRefLFDeltas; i++ {
+			d.FieldStruct("ref_delta", func(d *decode.D) {
+				if d.FieldBool("update") {
+					vp9FieldSu(d, "delta", 6)
+				}
+			})
+		}
+	})
+	d.FieldArray("mode_deltas", func(d *decode.D) {
+		for i := 0; i < vp9MaxModeLFDeltas; i++ {
+			d.FieldStruct("mode_delta", func(d *decode.D) {
+				if d.FieldBool("update") {
+					vp9FieldSu(d, "delta", 6)
+				}
+			})
+		}
+	})
+}
+
+func vp9DecodeQuantizationParams(d *decode.D) {
+	baseQIdx := d.FieldU8("base_q_idx")
+	lossless := baseQIdx == 0
+	for _, name := range []string{"delta_q_y_dc", "delta_q_uv_dc", "delta_q_uv_ac"} {
+		var delta int64
+		if d.FieldBool(name + "_coded") {
+			delta = vp9FieldSu(d, name, 4)
+		}
+		lossless = lossless && delta == 0
+	}
+	d.FieldValueBool("lossless", lossless)
+}
+
+func vp9DecodeSegmentationParams(d *decode.D) {
+	if !d.FieldBool("enabled") {
+		return
+	}
+	if d.FieldBool("update_map") {
+		d.FieldArray("tree_probs", func(d *decode.D) {
+			for i := 0; i < 7; i++ {
+				vp9FieldProb(d, "tree_prob")
+			}
+		})
+		if d.FieldBool("temporal_update") {
+			d.FieldArray("pred_probs", func(d *decode.D) {
+				for i := 0; i < 3; i++ {
+					vp9FieldProb(d, "pred_prob")
+				}
+			})
+		}
+	}
+	if !d.FieldBool("update_data") {
+		return
+	}
+	d.FieldBool("abs_or_delta_update", scalar.BoolToSymStr{true: "abs", false: "delta"})
+	d.FieldArray("segments", func(d *decode.D) {
+		for i := 0; i < vp9MaxSegments; i++ {
+			d.FieldStruct("segment", func(d *decode.D) {
+				for j, name := range vp9SegmentationFeatureNames {
+					d.FieldStruct(name, func(d *decode.D) {
+						if !d.FieldBool("enabled") {
+							return
+						}
+						bits := vp9SegmentationFeatureBits[j]
+						switch {
+						case vp9SegmentationFeatureSigned[j]:
+							vp9FieldSu(d, "value", bits)
+						case bits > 0:
+							d.FieldU("value", bits)
+						}
+					})
+				}
+			})
+		}
+	})
+}
+
+func vp9DecodeTileInfo(d *decode.D, width uint64) {
+	miCols := (width + 7) >> 3
+	sb64Cols := (miCols + 7) >> 3
+	minLog2 := uint64(0)
+	for (vp9MaxTileWidthB64 << minLog2) < sb64Cols {
+		minLog2++
+	}
+	maxLog2 := uint64(1)
+	for (sb64Cols >> maxLog2) >= vp9MinTileWidthB64 {
+		maxLog2++
+	}
+	maxLog2--
 
-	// TODO: header_size at end? even for show_existing_frame?
+	d.FieldUFn("tile_cols_log2", func(d *decode.D) uint64 {
+		n := minLog2
+		for n < maxLog2 && d.Bool() {
+			n++
+		}
+		return n
+	})
+	d.FieldUFn("tile_rows_log2", func(d *decode.D) uint64 {
+		n := d.U1()
+		if n == 1 {
+			n += d.U1()
+		}
+		return n
+	})
+}
 
+func vp9DecodeFrame(d *decode.D, s *vp9State) {
 	d.FieldU2("frame_marker")
 	profileLowBit := d.FieldU1("profile_low_bit")
 	profileHighBit := d.FieldU1("profile_high_bit")
@@ -121,22 +294,187 @@ func vp9Decode(d *decode.D, in interface{}) interface{} {
 	}
 	showExistingFrame := d.FieldBool("show_existing_frame")
 	if showExistingFrame {
-		d.FieldU2("frame_to_show_map_idx")
-		return nil
+		d.FieldU3("frame_to_show_map_idx")
+		if d.Pos()%8 != 0 {
+			d.FieldU("trailing_bits", int(8-d.Pos()%8))
+		}
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+		return
 	}
 
 	frameType := d.FieldBool("frame_type", scalar.BoolToSymStr{true: "non_key_frame", false: "key_frame"})
-	d.FieldU1("show_frame")
-	d.FieldU1("error_resilient_mode")
+	showFrame := d.FieldBool("show_frame")
+	errorResilientMode := d.FieldBool("error_resilient_mode")
 
+	var width, height uint64
+	refreshFrameFlags := uint64(0xff)
 	if !frameType {
 		// is key frame
 		vp9DecodeFrameSyncCode(d)
 		vp9DecodeColorConfig(d, profile)
-		vp9DecodeFrameSize(d)
+		width, height = vp9DecodeFrameSize(d)
+		vp9DecodeRenderSize(d)
+	} else {
+		intraOnly := false
+		if !showFrame {
+			intraOnly = d.FieldBool("intra_only")
+		}
+		if !errorResilientMode {
+			d.FieldU2("reset_frame_context")
+		}
+		if intraOnly {
+			vp9DecodeFrameSyncCode(d)
+			if profile > 0 {
+				vp9DecodeColorConfig(d, profile)
+			} else {
+				d.FieldValueU("bit_depth", 8)
+				d.FieldValueU("color_space", CS_BT_601, vp9ColorSpaceNames)
+				d.FieldValueU("subsampling_x", 1)
+				d.FieldValueU("subsampling_y", 1)
+			}
+			refreshFrameFlags = d.FieldU8("refresh_frame_flags", scalar.Bin)
+			width, height = vp9DecodeFrameSize(d)
+			vp9DecodeRenderSize(d)
+		} else {
+			refreshFrameFlags = d.FieldU8("refresh_frame_flags", scalar.Bin)
+			var refFrameIdx [vp9RefsPerFrame]uint64
+			d.FieldArray("ref_frames", func(d *decode.D) {
+				for i := 0; i < vp9RefsPerFrame; i++ {
+					d.FieldStruct("ref_frame", func(d *decode.D) {
+						d.FieldValueU("ref_frame", uint64(i), vp9RefFrameNames)
+						refFrameIdx[i] = d.FieldU3("idx")
+						d.FieldBool("sign_bias")
+					})
+				}
+			})
+			foundRef := false
+			d.FieldArray("found_refs", func(d *decode.D) {
+				for i := 0; i < vp9RefsPerFrame; i++ {
+					if foundRef = d.FieldBool("found_ref"); foundRef {
+						width = s.refFrameWidth[refFrameIdx[i]]
+						height = s.refFrameHeight[refFrameIdx[i]]
+						break
+					}
+				}
+			})
+			if foundRef {
+				if width != 0 {
+					d.FieldValueU("frame_width", width)
+					d.FieldValueU("frame_height", height)
+				}
+			} else {
+				width, height = vp9DecodeFrameSize(d)
+			}
+			vp9DecodeRenderSize(d)
+			d.FieldBool("allow_high_precision_mv")
+			if !d.FieldBool("is_filter_switchable") {
+				d.FieldU2("raw_interpolation_filter", vp9InterpolationFilterNames)
+			}
+		}
+	}
+
+	for i := 0; i < vp9NumRefFrames; i++ {
+		if refreshFrameFlags&(1<<i) != 0 {
+			s.refFrameWidth[i] = width
+			s.refFrameHeight[i] = height
+		}
+	}
+
+	if !errorResilientMode {
+		d.FieldBool("refresh_frame_context")
+		d.FieldBool("frame_parallel_decoding_mode")
+	}
+	d.FieldU2("frame_context_idx")
+	d.FieldStruct("loop_filter", vp9DecodeLoopFilterParams)
+	d.FieldStruct("quantization", vp9DecodeQuantizationParams)
+	d.FieldStruct("segmentation", vp9DecodeSegmentationParams)
+
+	// tile info depends on frame width which is unknown if size is from an unknown reference frame
+	if width == 0 {
+		d.FieldRawLen("data", d.BitsLeft())
+		return
+	}
+	d.FieldStruct("tile_info", func(d *decode.D) { vp9DecodeTileInfo(d, width) })
+	headerSize := d.FieldU16("header_size_in_bytes")
+	if d.Pos()%8 != 0 {
+		d.FieldU("trailing_bits", int(8-d.Pos()%8))
 	}
+	d.FieldRawLen("compressed_header", int64(headerSize)*8)
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+}
+
+// returns frame sizes if buffer ends with a valid superframe index
+func vp9SuperframeSizes(d *decode.D) []uint64 {
+	length := d.Len() / 8
+	if length < vp9SuperframeMinLength {
+		return nil
+	}
+	marker := d.BytesRange((length-1)*8, 1)[0]
+	if marker>>5 != vp9SuperframeMarker {
+		return nil
+	}
+	bytesPerFrameSize := int64(marker>>3&0b11) + 1
+	frames := int64(marker&0b111) + 1
+	indexLen := vp9SuperframeMinLength + bytesPerFrameSize*frames
+	if length < indexLen {
+		return nil
+	}
+	index := d.BytesRange((length-indexLen)*8, int(indexLen))
+	if index[0] != marker {
+		return nil
+	}
+	var sizes []uint64
+	total := uint64(indexLen)
+	for i := int64(0); i < frames; i++ {
+		var size uint64
+		for j := bytesPerFrameSize - 1; j >= 0; j-- {
+			size = size<<8 | uint64(index[1+i*bytesPerFrameSize+j])
+		}
+		sizes = append(sizes, size)
+		total += size
+	}
+	if total != uint64(length) {
+		return nil
+	}
+	return sizes
+}
 
-	d.FieldRawLen("data", d.BitsLeft())
+func vp9Decode(d *decode.D, in interface{}) interface{} {
+	var s vp9State
+	if vi, ok := in.(format.VP9FrameIn); ok {
+		s.refFrameWidth = vi.RefFrameWidth
+		s.refFrameHeight = vi.RefFrameHeight
+	}
 
-	return nil
+	if sizes := vp9SuperframeSizes(d); sizes != nil {
+		d.FieldArray("frames", func(d *decode.D) {
+			for _, size := range sizes {
+				d.FieldStruct("frame", func(d *decode.D) {
+					d.LenFn(int64(size)*8, func(d *decode.D) { vp9DecodeFrame(d, &s) })
+				})
+			}
+		})
+		d.FieldStruct("superframe_index", func(d *decode.D) {
+			d.FieldU3("marker")
+			bytesPerFrameSize := d.FieldU2("bytes_per_framesize", scalar.UAdd(1))
+			frames := d.FieldU3("frames_in_superframe", scalar.UAdd(1))
+			d.FieldArray("frame_sizes", func(d *decode.D) {
+				for i := uint64(0); i < frames; i++ {
+					d.FieldUE("frame_size", int(bytesPerFrameSize)*8, decode.LittleEndian)
+				}
+			})
+			d.FieldU8("marker_end", scalar.Hex)
+		})
+	} else {
+		vp9DecodeFrame(d, &s)
+	}
+
+	return format.VP9FrameOut{
+		RefFrameWidth:  s.refFrameWidth,
+		RefFrameHeight: s.refFrameHeight,
+	}
 }
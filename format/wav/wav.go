@@ -8,6 +8,7 @@ package wav
 // TODO: default little endian
 
 import (
+	"embed"
 	"fmt"
 	"strings"
 
@@ -17,6 +18,9 @@ import (
 	"github.com/wader/fq/pkg/scalar"
 )
 
+//go:embed *.jq
+var wavFS embed.FS
+
 var headerFormat decode.Group
 var footerFormat decode.Group
 
@@ -31,6 +35,7 @@ func init() {
 			{Names: []string{format.ID3V2}, Group: &headerFormat},
 			{Names: []string{format.ID3V1, format.ID3V11}, Group: &footerFormat},
 		},
+		Files: wavFS,
 	})
 }
 
@@ -1,10 +1,11 @@
 package webp
 
 // https://developers.google.com/speed/webp/docs/riff_container
+// https://developers.google.com/speed/webp/docs/webp_lossless_bitstream_specification
 
-import (
-	"bytes"
+// TODO: VP8L transforms and image data
 
+import (
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/registry"
 	"github.com/wader/fq/pkg/decode"
@@ -12,33 +13,151 @@ import (
 )
 
 var vp8Frame decode.Group
+var iccProfileFormat decode.Group
+var exifFormat decode.Group
 
 func init() {
 	registry.MustRegister(decode.Format{
 		Name:        format.WEBP,
 		Description: "WebP image",
 		Groups:      []string{format.PROBE, format.IMAGE},
+		Magic:       []decode.Magic{{Offset: 8, Bytes: []byte("WEBP")}},
 		DecodeFn:    webpDecode,
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.VP8_FRAME}, Group: &vp8Frame},
+			{Names: []string{format.ICC_PROFILE}, Group: &iccProfileFormat},
+			{Names: []string{format.EXIF}, Group: &exifFormat},
 		},
 	})
 }
 
-func decodeChunk(d *decode.D, expectedChunkID string, fn func(d *decode.D)) bool { //nolint:unparam
-	trimChunkID := d.FieldUTF8("id", 4, scalar.TrimSpace)
-	if expectedChunkID != "" && trimChunkID != expectedChunkID {
-		return false
+const vp8lSignature = 0x2f
+
+var alphaCompressionNames = scalar.UToSymStr{
+	0: "none",
+	1: "lossless",
+}
+
+var alphaFilteringNames = scalar.UToSymStr{
+	0: "none",
+	1: "horizontal",
+	2: "vertical",
+	3: "gradient",
+}
+
+var alphaPreprocessingNames = scalar.UToSymStr{
+	0: "none",
+	1: "level_reduction",
+}
+
+var blendingMethodNames = scalar.BoolToSymStr{
+	false: "alpha_blending",
+	true:  "no_blending",
+}
+
+var disposalMethodNames = scalar.BoolToSymStr{
+	false: "none",
+	true:  "dispose_to_background",
+}
+
+var exifPrefix = []byte("Exif\x00\x00")
+
+// 24 bit value stored as value minus one
+func fieldU24Plus1(d *decode.D, name string) uint64 {
+	return d.FieldUFn(name, func(d *decode.D) uint64 { return d.U24() + 1 })
+}
+
+func decodeVP8L(d *decode.D) {
+	d.FieldU8("signature", d.AssertU(vp8lSignature), scalar.Hex)
+	// bits are packed least significant bit first
+	d.FieldStruct("header", func(d *decode.D) {
+		v := d.FieldU32("packed", scalar.Hex)
+		d.FieldValueU("width", (v&0x3fff)+1)
+		d.FieldValueU("height", ((v>>14)&0x3fff)+1)
+		d.FieldValueBool("alpha_is_used", (v>>28)&1 == 1)
+		d.FieldValueU("version", v>>29)
+	})
+	d.FieldRawLen("data", d.BitsLeft())
+}
+
+func decodeChunk(d *decode.D) {
+	chunks := map[string]func(d *decode.D){
+		"VP8": func(d *decode.D) {
+			d.FieldFormatLen("frame", d.BitsLeft(), vp8Frame, nil)
+		},
+		"VP8L": decodeVP8L,
+		"VP8X": func(d *decode.D) {
+			d.FieldStruct("flags", func(d *decode.D) {
+				d.FieldU2("reserved0")
+				d.FieldBool("icc_profile")
+				d.FieldBool("alpha")
+				d.FieldBool("exif_metadata")
+				d.FieldBool("xmp_metadata")
+				d.FieldBool("animation")
+				d.FieldU1("reserved1")
+			})
+			d.FieldU24("reserved")
+			fieldU24Plus1(d, "canvas_width")
+			fieldU24Plus1(d, "canvas_height")
+		},
+		"ALPH": func(d *decode.D) {
+			d.FieldU2("reserved")
+			d.FieldU2("preprocessing", alphaPreprocessingNames)
+			d.FieldU2("filtering_method", alphaFilteringNames)
+			d.FieldU2("compression_method", alphaCompressionNames)
+			d.FieldRawLen("data", d.BitsLeft())
+		},
+		"ANIM": func(d *decode.D) {
+			d.FieldStruct("background_color", func(d *decode.D) {
+				d.FieldU8("blue")
+				d.FieldU8("green")
+				d.FieldU8("red")
+				d.FieldU8("alpha")
+			})
+			d.FieldU16("loop_count", scalar.UToScalar{0: {Description: "infinite"}})
+		},
+		"ANMF": func(d *decode.D) {
+			d.FieldUFn("frame_x", func(d *decode.D) uint64 { return d.U24() * 2 })
+			d.FieldUFn("frame_y", func(d *decode.D) uint64 { return d.U24() * 2 })
+			fieldU24Plus1(d, "frame_width")
+			fieldU24Plus1(d, "frame_height")
+			d.FieldU24("frame_duration")
+			d.FieldU6("reserved")
+			d.FieldBool("blending_method", blendingMethodNames)
+			d.FieldBool("disposal_method", disposalMethodNames)
+			decodeChunks(d)
+		},
+		"ICCP": func(d *decode.D) {
+			d.FieldFormatLen("icc_profile", d.BitsLeft(), iccProfileFormat, nil)
+		},
+		"EXIF": func(d *decode.D) {
+			// some encoders include the JPEG APP1 prefix
+			if d.TryHasBytes(exifPrefix) {
+				d.FieldUTF8("exif_prefix", len(exifPrefix))
+			}
+			d.FieldFormatLen("exif", d.BitsLeft(), exifFormat, nil)
+		},
+		"XMP": func(d *decode.D) {
+			d.FieldUTF8("xmp", int(d.BitsLeft()/8))
+		},
 	}
+
+	trimChunkID := d.FieldUTF8("id", 4, scalar.TrimSpace)
 	chunkLen := int64(d.FieldU32("size"))
 
-	if fn != nil {
+	if fn, ok := chunks[trimChunkID]; ok {
 		d.LenFn(chunkLen*8, fn)
 	} else {
 		d.FieldRawLen("data", chunkLen*8)
 	}
 
-	return true
+	if chunkLen%2 != 0 {
+		d.FieldRawLen("align", 8)
+	}
+}
+
+func decodeChunks(d *decode.D) {
+	d.FieldStructArrayLoop("chunks", "chunk", d.NotEnd, decodeChunk)
 }
 
 func webpDecode(d *decode.D, in interface{}) interface{} {
@@ -49,26 +168,13 @@ func webpDecode(d *decode.D, in interface{}) interface{} {
 	d.FieldUTF8("webp_id", 4, d.AssertStr("WEBP"))
 
 	d.LenFn(int64(riffLength-4)*8, func(d *decode.D) {
-		p := d.PeekBytes(4)
-
-		// TODO: VP8X
-
-		switch {
-		case bytes.Equal(p, []byte("VP8 ")):
-			d.FieldStruct("image", func(d *decode.D) {
-				decodeChunk(d, "VP8", func(d *decode.D) {
-					d.Format(vp8Frame, nil)
-				})
-			})
-		case bytes.Equal(p, []byte("VP8L")):
-			d.FieldStruct("image", func(d *decode.D) {
-				decodeChunk(d, "VP8L", func(d *decode.D) {
-					// TODO
-				})
-			})
+		switch string(d.PeekBytes(4)) {
+		case "VP8 ", "VP8L", "VP8X":
 		default:
-			d.Fatalf("could not find VP8 or VP8L chunk")
+			d.Fatalf("could not find VP8, VP8L or VP8X chunk")
 		}
+
+		decodeChunks(d)
 	})
 
 	return nil
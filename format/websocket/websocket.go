@@ -0,0 +1,199 @@
+package websocket
+
+// https://datatracker.ietf.org/doc/html/rfc6455
+
+// TODO: permessage-deflate (RFC 7692), rsv1 set and usually context takeover
+// between messages
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.WEBSOCKET,
+		Description: "WebSocket frames",
+		Groups:      []string{format.TCP_STREAM},
+		DecodeFn:    websocketDecode,
+	})
+}
+
+const (
+	opcodeContinuation = 0x0
+	opcodeText         = 0x1
+	opcodeBinary       = 0x2
+	opcodeClose        = 0x8
+	opcodePing         = 0x9
+	opcodePong         = 0xa
+)
+
+var opcodeNames = scalar.UToSymStr{
+	opcodeContinuation: "continuation",
+	opcodeText:         "text",
+	opcodeBinary:       "binary",
+	opcodeClose:        "close",
+	opcodePing:         "ping",
+	opcodePong:         "pong",
+}
+
+const (
+	payloadLength16Bit = 126
+	payloadLength64Bit = 127
+)
+
+var closeStatusCodeNames = scalar.UToSymStr{
+	1000: "normal_closure",
+	1001: "going_away",
+	1002: "protocol_error",
+	1003: "unsupported_data",
+	1005: "no_status_received",
+	1006: "abnormal_closure",
+	1007: "invalid_frame_payload_data",
+	1008: "policy_violation",
+	1009: "message_too_big",
+	1010: "mandatory_extension",
+	1011: "internal_error",
+	1012: "service_restart",
+	1013: "try_again_later",
+	1014: "bad_gateway",
+	1015: "tls_handshake",
+}
+
+type websocketDecoder struct {
+	// payload of fragmented message waiting for a frame with fin
+	message []byte
+}
+
+func decodeClose(d *decode.D) {
+	if d.NotEnd() {
+		d.FieldU16("status_code", closeStatusCodeNames)
+	}
+	if d.NotEnd() {
+		d.FieldUTF8("reason", int(d.BitsLeft()/8))
+	}
+}
+
+func (wd *websocketDecoder) decodeFrame(d *decode.D) {
+	fin := d.FieldBool("fin")
+	d.FieldBool("rsv1")
+	d.FieldBool("rsv2")
+	d.FieldBool("rsv3")
+	opcode := d.FieldU4("opcode", opcodeNames)
+	masked := d.FieldBool("mask")
+	length := d.FieldU7("payload_length")
+	switch length {
+	case payloadLength16Bit:
+		length = d.FieldU16("extended_payload_length")
+	case payloadLength64Bit:
+		length = d.FieldU64("extended_payload_length")
+	}
+	var maskingKey []byte
+	if masked {
+		maskingKey = d.PeekBytes(4)
+		d.FieldU32("masking_key", scalar.Hex)
+	}
+
+	if length > uint64(d.BitsLeft()/8) {
+		d.Fatalf("payload length %d larger than input", length)
+	}
+	payload := d.PeekBytes(int(length))
+	if masked {
+		d.FieldRawLen("masked_payload", int64(length)*8)
+		unmasked := make([]byte, len(payload))
+		for i := range payload {
+			unmasked[i] = payload[i] ^ maskingKey[i%4]
+		}
+		payload = unmasked
+		bb := bitio.NewBufferFromBytes(payload, -1)
+		if opcode == opcodeClose {
+			d.FieldStructRootBitBufFn("payload", bb, decodeClose)
+		} else {
+			d.FieldRootBitBuf("payload", bb)
+		}
+	} else {
+		if opcode == opcodeClose {
+			d.FieldStruct("payload", func(d *decode.D) {
+				d.LenFn(int64(length)*8, decodeClose)
+			})
+		} else {
+			d.FieldRawLen("payload", int64(length)*8)
+		}
+	}
+
+	// control frames can be in between fragments of a message
+	if opcode >= opcodeClose {
+		return
+	}
+	if opcode != opcodeContinuation {
+		wd.message = nil
+		if fin {
+			return
+		}
+	}
+	wd.message = append(wd.message, payload...)
+	if fin {
+		d.FieldRootBitBuf("reassembled_payload", bitio.NewBufferFromBytes(wd.message, -1))
+		wd.message = nil
+	}
+}
+
+// opening handshake is a HTTP/1.1 upgrade request or response
+func isHandshake(d *decode.D) bool {
+	if d.BitsLeft() < 5*8 {
+		return false
+	}
+	prefix := string(d.PeekBytes(5))
+	return strings.HasPrefix(prefix, "GET ") || prefix == "HTTP/"
+}
+
+func decodeHandshake(d *decode.D) bool {
+	upgrade := false
+	d.FieldArray("lines", func(d *decode.D) {
+		for {
+			b := d.BytesRange(d.Pos(), int(d.BitsLeft()/8))
+			n := bytes.Index(b, []byte("\r\n"))
+			if n < 0 {
+				d.Fatalf("unterminated handshake line")
+			}
+			line := d.FieldUTF8("line", n+2, scalar.TrimSpace)
+			if line == "" {
+				break
+			}
+			parts := strings.SplitN(line, ":", 2)
+			if len(parts) == 2 &&
+				strings.EqualFold(strings.TrimSpace(parts[0]), "upgrade") &&
+				strings.EqualFold(strings.TrimSpace(parts[1]), "websocket") {
+				upgrade = true
+			}
+		}
+	})
+	return upgrade
+}
+
+func websocketDecode(d *decode.D, in interface{}) interface{} {
+	_, isTCPStream := in.(format.TCPStreamIn)
+	if isHandshake(d) {
+		var upgrade bool
+		d.FieldStruct("handshake", func(d *decode.D) {
+			upgrade = decodeHandshake(d)
+		})
+		if !upgrade {
+			d.Fatalf("no websocket upgrade header")
+		}
+	} else if isTCPStream {
+		// frames has no magic, require opening handshake
+		d.Fatalf("no opening handshake")
+	}
+
+	wd := &websocketDecoder{}
+	d.FieldStructArrayLoop("frames", "frame", d.NotEnd, wd.decodeFrame)
+
+	return nil
+}
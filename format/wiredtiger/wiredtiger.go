@@ -0,0 +1,384 @@
+package wiredtiger
+
+// https://github.com/wiredtiger/wiredtiger/blob/develop/src/include/block.h
+// https://github.com/wiredtiger/wiredtiger/blob/develop/src/include/btmem.h
+// https://github.com/wiredtiger/wiredtiger/blob/develop/src/include/cell.h
+// https://github.com/wiredtiger/wiredtiger/blob/develop/src/include/cell_inline.h
+// https://github.com/wiredtiger/wiredtiger/blob/develop/src/include/intpack_inline.h
+
+// TODO: compressed and encrypted pages, compressor is only known from WiredTiger.wt metadata
+// TODO: allocation size other than 4KB
+// TODO: column store fixed-length bitmaps and block manager extent lists
+
+import (
+	"hash/crc32"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var bsonFormat decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.WIREDTIGER,
+		Description: "WiredTiger B-tree file",
+		Groups:      []string{format.PROBE},
+		DecodeFn:    wiredTigerDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.BSON}, Group: &bsonFormat},
+		},
+	})
+}
+
+const (
+	blockMagic     = 120897
+	allocationSize = 4096
+	// page header is followed by block header
+	pageHeaderLen  = 28
+	blockHeaderLen = 12
+	// bytes not compressed and always included in checksum
+	compressSkip = 64
+
+	blockDataChecksum = 0x01
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+const (
+	pageBlockManager = 1
+	pageColFix       = 2
+	pageColInt       = 3
+	pageColVar       = 4
+	pageOverflow     = 5
+	pageRowInt       = 6
+	pageRowLeaf      = 7
+)
+
+var pageTypeNames = scalar.UToSymStr{
+	pageBlockManager: "block_manager",
+	pageColFix:       "col_fix",
+	pageColInt:       "col_int",
+	pageColVar:       "col_var",
+	pageOverflow:     "overflow",
+	pageRowInt:       "row_int",
+	pageRowLeaf:      "row_leaf",
+}
+
+const (
+	cellKeyShort    = 0x01
+	cellKeyShortPfx = 0x02
+	cellValueShort  = 0x03
+
+	cellSecondDesc = 0x08
+	cell64V        = 0x04
+
+	cellAddrDel       = 0 << 4
+	cellAddrInt       = 1 << 4
+	cellAddrLeaf      = 2 << 4
+	cellAddrLeafNo    = 3 << 4
+	cellDel           = 4 << 4
+	cellKey           = 5 << 4
+	cellKeyOvfl       = 6 << 4
+	cellKeyPfx        = 7 << 4
+	cellValue         = 8 << 4
+	cellValueCopy     = 9 << 4
+	cellValueOvfl     = 10 << 4
+	cellValueOvflRM   = 11 << 4
+	cellKeyOvflRM     = 12 << 4
+	cellSizeAdjust    = 64
+	cellShortTypeMask = 0x03
+)
+
+var cellShortTypeNames = scalar.UToSymStr{
+	cellKeyShort:    "key_short",
+	cellKeyShortPfx: "key_short_pfx",
+	cellValueShort:  "value_short",
+}
+
+var cellTypeNames = scalar.UToSymStr{
+	cellAddrDel >> 4:     "addr_del",
+	cellAddrInt >> 4:     "addr_int",
+	cellAddrLeaf >> 4:    "addr_leaf",
+	cellAddrLeafNo >> 4:  "addr_leaf_no",
+	cellDel >> 4:         "del",
+	cellKey >> 4:         "key",
+	cellKeyOvfl >> 4:     "key_ovfl",
+	cellKeyPfx >> 4:      "key_pfx",
+	cellValue >> 4:       "value",
+	cellValueCopy >> 4:   "value_copy",
+	cellValueOvfl >> 4:   "value_ovfl",
+	cellValueOvflRM >> 4: "value_ovfl_rm",
+	cellKeyOvflRM >> 4:   "key_ovfl_rm",
+}
+
+// packed unsigned integer
+func vuint(d *decode.D) uint64 {
+	b := d.U8()
+	switch {
+	case b&0xc0 == 0x80:
+		// 10xxxxxx
+		return b & 0x3f
+	case b&0xe0 == 0xc0:
+		// 110xxxxx xxxxxxxx
+		return ((b&0x1f)<<8 | d.U8()) + 64
+	case b&0xf0 == 0xe0:
+		// 1110llll followed by l bytes big endian
+		n := int(b & 0x0f)
+		if n > 8 {
+			d.Fatalf("invalid packed integer length %d", n)
+		}
+		var v uint64
+		for i := 0; i < n; i++ {
+			v = v<<8 | d.U8()
+		}
+		return v + 64 + 8192
+	default:
+		d.Fatalf("unsupported packed integer marker %x", b)
+	}
+	return 0
+}
+
+func fieldVuint(d *decode.D, name string, sms ...scalar.Mapper) uint64 {
+	return d.FieldUFn(name, vuint, sms...)
+}
+
+// validate CRC-32C checksum of buffer with checksum field zeroed
+func checksum(d *decode.D, firstBit int64, nBytes int, checksumOffset int) uint64 {
+	b := d.BytesRange(firstBit, nBytes)
+	copy(b[checksumOffset:checksumOffset+4], []byte{0, 0, 0, 0})
+	return uint64(crc32.Checksum(b, castagnoliTable))
+}
+
+func decodeDescription(d *decode.D) {
+	d.FieldU32("magic", d.AssertU(blockMagic))
+	d.FieldU16("major")
+	d.FieldU16("minor")
+	d.FieldChecksumU("checksum", 32, "crc32c", checksum(d, 0, allocationSize, 8), scalar.Hex)
+	d.FieldU32("unused")
+	d.FieldRawLen("padding", d.BitsLeft(), d.BitBufIsZero())
+}
+
+// time window and time aggregate flags, values follow in the order below
+var timeWindowFields = []struct {
+	flag uint64
+	name string
+}{
+	{0x08, "start_ts"},
+	{0x20, "start_txn"},
+	{0x02, "durable_start_ts_delta"},
+	{0x10, "stop_ts_delta"},
+	{0x40, "stop_txn_delta"},
+	{0x04, "durable_stop_ts_delta"},
+}
+
+func decodeTimeWindow(d *decode.D) {
+	var flags uint64
+	d.FieldStruct("time_window_flags", func(d *decode.D) {
+		flags = d.PeekBits(8)
+		d.FieldU1("unused")
+		d.FieldBool("txn_stop")
+		d.FieldBool("txn_start")
+		d.FieldBool("ts_stop")
+		d.FieldBool("ts_start")
+		d.FieldBool("ts_durable_stop")
+		d.FieldBool("ts_durable_start")
+		d.FieldBool("prepare")
+	})
+	for _, f := range timeWindowFields {
+		if flags&f.flag != 0 {
+			fieldVuint(d, f.name)
+		}
+	}
+}
+
+func decodeAddress(d *decode.D) {
+	// offset is in allocation units minus one, size in allocation units
+	d.FieldUFn("offset", func(d *decode.D) uint64 { return (vuint(d) + 1) * allocationSize })
+	d.FieldUFn("size", func(d *decode.D) uint64 { return vuint(d) * allocationSize })
+	d.FieldUFn("checksum", vuint, scalar.Hex)
+}
+
+func decodeCellData(d *decode.D, typ uint64, length int64) {
+	switch typ {
+	case cellAddrDel, cellAddrInt, cellAddrLeaf, cellAddrLeafNo,
+		cellKeyOvfl, cellKeyOvflRM, cellValueOvfl, cellValueOvflRM:
+		d.FieldStruct("address", func(d *decode.D) {
+			d.LenFn(length*8, decodeAddress)
+		})
+	case cellValue, cellValueShort:
+		if dv, _, _ := d.TryFieldFormatLen("data", length*8, bsonFormat, nil); dv == nil {
+			d.FieldRawLen("data", length*8)
+		}
+	default:
+		d.FieldRawLen("data", length*8)
+	}
+}
+
+func decodeCell(d *decode.D) {
+	desc := d.PeekBits(8)
+
+	if shortType := desc & cellShortTypeMask; shortType != 0 {
+		d.FieldStruct("descriptor", func(d *decode.D) {
+			d.FieldU6("length")
+			d.FieldU2("type", cellShortTypeNames)
+		})
+		if shortType == cellKeyShortPfx {
+			d.FieldU8("prefix")
+		}
+		decodeCellData(d, shortType, int64(desc>>2))
+		return
+	}
+
+	typ := desc & 0xf0
+	d.FieldStruct("descriptor", func(d *decode.D) {
+		d.FieldU4("type", cellTypeNames)
+		d.FieldBool("second_descriptor")
+		d.FieldBool("64v")
+		d.FieldU2("unused")
+	})
+	if typ == cellKeyPfx {
+		d.FieldU8("prefix")
+	}
+	if desc&cellSecondDesc != 0 {
+		decodeTimeWindow(d)
+	}
+	if desc&cell64V != 0 {
+		// RLE count or record number
+		fieldVuint(d, "v")
+	}
+
+	switch typ {
+	case cellDel:
+		return
+	case cellKey, cellKeyPfx:
+		length := fieldVuint(d, "length", scalar.UAdd(cellSizeAdjust))
+		decodeCellData(d, typ, int64(length))
+	case cellValue:
+		var sms []scalar.Mapper
+		// size is adjusted only when it was what prevented a short cell
+		if desc&(cellSecondDesc|cell64V) == 0 {
+			sms = append(sms, scalar.UAdd(cellSizeAdjust))
+		}
+		length := fieldVuint(d, "length", sms...)
+		decodeCellData(d, typ, int64(length))
+	default:
+		length := fieldVuint(d, "length")
+		decodeCellData(d, typ, int64(length))
+	}
+}
+
+func decodePage(d *decode.D) {
+	pageStart := d.Pos()
+	var typ uint64
+	var entries uint64
+	var compressed bool
+	var encrypted bool
+
+	d.FieldStruct("header", func(d *decode.D) {
+		d.FieldU64("recno")
+		d.FieldU64("write_gen")
+		d.FieldU32("mem_size")
+		entries = d.FieldU32("entries")
+		typ = d.FieldU8("type", pageTypeNames)
+		d.FieldStruct("flags", func(d *decode.D) {
+			d.FieldU2("unused")
+			d.FieldBool("ft_update")
+			d.FieldBool("unused1")
+			encrypted = d.FieldBool("encrypted")
+			d.FieldBool("empty_v_none")
+			d.FieldBool("empty_v_all")
+			compressed = d.FieldBool("compressed")
+		})
+		d.FieldU8("unused")
+		d.FieldU8("version")
+	})
+
+	d.FieldStruct("block_header", func(d *decode.D) {
+		diskSize := d.FieldU32("disk_size")
+		// checksum covers whole page if data checksum flag is set otherwise only the uncompressed prefix
+		checksumLen := compressSkip
+		if d.BytesRange(d.Pos()+4*8, 1)[0]&blockDataChecksum != 0 {
+			checksumLen = int(diskSize)
+		}
+		d.FieldChecksumU("checksum", 32, "crc32c", checksum(d, pageStart, checksumLen, pageHeaderLen+4), scalar.Hex)
+		d.FieldStruct("flags", func(d *decode.D) {
+			d.FieldU7("unused")
+			d.FieldBool("data_checksum")
+		})
+		d.FieldRawLen("unused", 3*8)
+	})
+
+	if compressed || encrypted {
+		d.FieldRawLen("data", d.BitsLeft())
+		return
+	}
+
+	switch typ {
+	case pageColInt, pageColVar, pageRowInt, pageRowLeaf:
+		d.FieldArray("cells", func(d *decode.D) {
+			for i := uint64(0); i < entries && d.NotEnd(); i++ {
+				d.FieldStruct("cell", decodeCell)
+			}
+		})
+	case pageOverflow:
+		// for overflow pages entries is data length
+		d.FieldRawLen("data", int64(entries)*8)
+	default:
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+	if d.NotEnd() {
+		d.FieldRawLen("padding", d.BitsLeft())
+	}
+}
+
+// returns disk size if page header type and block header disk size looks sane
+func peekPage(d *decode.D) (int64, bool) {
+	if d.BitsLeft() < (pageHeaderLen+blockHeaderLen)*8 {
+		return 0, false
+	}
+	b := d.PeekBytes(pageHeaderLen + blockHeaderLen)
+	typ := b[24]
+	diskSize := int64(b[28]) | int64(b[29])<<8 | int64(b[30])<<16 | int64(b[31])<<24
+	if typ < pageBlockManager || typ > pageRowLeaf ||
+		diskSize == 0 || diskSize%allocationSize != 0 || diskSize*8 > d.BitsLeft() {
+		return 0, false
+	}
+	return diskSize, true
+}
+
+func wiredTigerDecode(d *decode.D, in interface{}) interface{} {
+	d.Endian = decode.LittleEndian
+
+	d.FieldStruct("description", func(d *decode.D) {
+		d.LenFn(allocationSize*8, decodeDescription)
+	})
+
+	d.FieldArray("blocks", func(d *decode.D) {
+		for d.NotEnd() {
+			diskSize, ok := peekPage(d)
+			if !ok {
+				// skip free or unused allocation units until next page
+				freeStart := d.Pos()
+				for ok := false; d.NotEnd() && !ok; _, ok = peekPage(d) {
+					skipLen := int64(allocationSize * 8)
+					if d.BitsLeft() < skipLen {
+						skipLen = d.BitsLeft()
+					}
+					d.SeekRel(skipLen)
+				}
+				freeLen := d.Pos() - freeStart
+				d.SeekAbs(freeStart)
+				d.FieldRawLen("free", freeLen)
+				continue
+			}
+			d.FieldStruct("page", func(d *decode.D) {
+				d.LenFn(diskSize*8, decodePage)
+			})
+		}
+	})
+
+	return nil
+}
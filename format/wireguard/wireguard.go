@@ -0,0 +1,79 @@
+package wireguard
+
+// https://www.wireguard.com/protocol/
+// https://www.wireguard.com/papers/wireguard.pdf
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.WIREGUARD,
+		Description: "WireGuard message",
+		Groups:      []string{format.UDP_PAYLOAD},
+		DecodeFn:    wireguardDecode,
+	})
+}
+
+const (
+	messageHandshakeInitiation = 1
+	messageHandshakeResponse   = 2
+	messageCookieReply         = 3
+	messageTransportData       = 4
+)
+
+var messageTypeNames = scalar.UToSymStr{
+	messageHandshakeInitiation: "handshake_initiation",
+	messageHandshakeResponse:   "handshake_response",
+	messageCookieReply:         "cookie_reply",
+	messageTransportData:       "transport_data",
+}
+
+// sizes of AEAD encrypted fields includes the 16 byte poly1305 tag
+const aeadTagLen = 16
+
+func wireguardDecode(d *decode.D, in interface{}) interface{} {
+	if udi, ok := in.(format.UDPDatagramIn); ok {
+		if udi.DestinationPort != format.UDPPortWireGuard && udi.SourcePort != format.UDPPortWireGuard {
+			d.Fatalf("wrong port")
+		}
+	}
+
+	d.Endian = decode.LittleEndian
+
+	typ := d.FieldU8("type", messageTypeNames)
+	d.FieldU24("reserved", d.AssertU(0))
+
+	switch typ {
+	case messageHandshakeInitiation:
+		d.FieldU32("sender_index", scalar.Hex)
+		d.FieldRawLen("unencrypted_ephemeral", 32*8)
+		d.FieldRawLen("encrypted_static", (32+aeadTagLen)*8)
+		d.FieldRawLen("encrypted_timestamp", (12+aeadTagLen)*8)
+		d.FieldRawLen("mac1", 16*8)
+		d.FieldRawLen("mac2", 16*8)
+	case messageHandshakeResponse:
+		d.FieldU32("sender_index", scalar.Hex)
+		d.FieldU32("receiver_index", scalar.Hex)
+		d.FieldRawLen("unencrypted_ephemeral", 32*8)
+		d.FieldRawLen("encrypted_nothing", aeadTagLen*8)
+		d.FieldRawLen("mac1", 16*8)
+		d.FieldRawLen("mac2", 16*8)
+	case messageCookieReply:
+		d.FieldU32("receiver_index", scalar.Hex)
+		d.FieldRawLen("nonce", 24*8)
+		d.FieldRawLen("encrypted_cookie", (16+aeadTagLen)*8)
+	case messageTransportData:
+		d.FieldU32("receiver_index", scalar.Hex)
+		d.FieldU64("counter")
+		d.FieldRawLen("encrypted_encapsulated_packet", d.BitsLeft())
+	default:
+		d.Fatalf("unknown message type %d", typ)
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package woff
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+// sfntTable is a table with uncompressed and untransformed data
+type sfntTable struct {
+	tag      string
+	checksum uint32
+	data     []byte
+}
+
+func sfntChecksum(b []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(b); i += 4 {
+		var v [4]byte
+		copy(v[:], b[i:])
+		sum += binary.BigEndian.Uint32(v[:])
+	}
+	return sum
+}
+
+func pad4(n int) int {
+	return (n + 3) &^ 3
+}
+
+// buildSfnt builds a sfnt font file (TrueType/OpenType) from tables
+func buildSfnt(flavor uint32, tables []sfntTable) []byte {
+	const headerLen = 12
+	const tableRecordLen = 16
+
+	sorted := append([]sfntTable{}, tables...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].tag < sorted[j].tag })
+
+	numTables := len(sorted)
+	entrySelector := 0
+	for (2 << entrySelector) <= numTables {
+		entrySelector++
+	}
+	searchRange := (1 << entrySelector) * 16
+
+	size := headerLen + numTables*tableRecordLen
+	for _, t := range sorted {
+		size += pad4(len(t.data))
+	}
+	b := make([]byte, size)
+	binary.BigEndian.PutUint32(b[0:], flavor)
+	binary.BigEndian.PutUint16(b[4:], uint16(numTables))
+	binary.BigEndian.PutUint16(b[6:], uint16(searchRange))
+	binary.BigEndian.PutUint16(b[8:], uint16(entrySelector))
+	binary.BigEndian.PutUint16(b[10:], uint16(numTables*16-searchRange))
+
+	offset := headerLen + numTables*tableRecordLen
+	for i, t := range sorted {
+		rb := b[headerLen+i*tableRecordLen:]
+		copy(rb[0:4], t.tag)
+		binary.BigEndian.PutUint32(rb[4:], t.checksum)
+		binary.BigEndian.PutUint32(rb[8:], uint32(offset))
+		binary.BigEndian.PutUint32(rb[12:], uint32(len(t.data)))
+		copy(b[offset:], t.data)
+		offset += pad4(len(t.data))
+	}
+
+	return b
+}
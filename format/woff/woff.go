@@ -0,0 +1,164 @@
+package woff
+
+// https://www.w3.org/TR/WOFF/
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io/ioutil"
+	"sort"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var opentypeFormat decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.WOFF,
+		Description: "Web Open Font Format",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte("wOFF")}},
+		DecodeFn:    woffDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.OPENTYPE}, Group: &opentypeFormat},
+		},
+	})
+}
+
+const flavorCollection = 0x74746366 // "ttcf"
+
+var flavorNames = scalar.UToSymStr{
+	0x00010000:       "truetype",
+	0x4f54544f:       "cff",
+	0x74727565:       "truetype_apple",
+	flavorCollection: "collection",
+}
+
+type woffTableRecord struct {
+	tag          string
+	offset       int64
+	compLength   int64
+	origLength   int64
+	origChecksum uint32
+}
+
+func zlibDecompress(b []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(zr)
+}
+
+// metadata and private data blocks are shared between WOFF and WOFF2
+func fieldMetadataPrivateData(d *decode.D, metaOffset, metaLength, privOffset, privLength uint64, decompress func(b []byte) ([]byte, error)) {
+	if metaLength > 0 {
+		b := d.BytesRange(int64(metaOffset)*8, int(metaLength))
+		d.RangeFn(int64(metaOffset)*8, int64(metaLength)*8, func(d *decode.D) {
+			d.FieldStruct("metadata", func(d *decode.D) {
+				d.FieldRawLen("compressed", d.BitsLeft())
+				if ub, err := decompress(b); err == nil {
+					d.FieldRootBitBuf("uncompressed", bitio.NewBufferFromBytes(ub, -1))
+				}
+			})
+		})
+	}
+	if privLength > 0 {
+		d.RangeFn(int64(privOffset)*8, int64(privLength)*8, func(d *decode.D) {
+			d.FieldRawLen("private_data", d.BitsLeft())
+		})
+	}
+}
+
+func woffDecode(d *decode.D, in interface{}) interface{} {
+	d.FieldUTF8("signature", 4, d.AssertStr("wOFF"))
+	flavor := d.FieldU32("flavor", flavorNames, scalar.Hex)
+	d.FieldU32("length")
+	numTables := d.FieldU16("num_tables")
+	if numTables == 0 {
+		d.Fatalf("no tables")
+	}
+	d.FieldU16("reserved", d.AssertU(0))
+	d.FieldU32("total_sfnt_size")
+	d.FieldU16("major_version")
+	d.FieldU16("minor_version")
+	metaOffset := d.FieldU32("meta_offset")
+	metaLength := d.FieldU32("meta_length")
+	d.FieldU32("meta_orig_length")
+	privOffset := d.FieldU32("priv_offset")
+	privLength := d.FieldU32("priv_length")
+
+	var records []woffTableRecord
+	d.FieldArray("table_directory", func(d *decode.D) {
+		for i := uint64(0); i < numTables; i++ {
+			d.FieldStruct("table", func(d *decode.D) {
+				t := woffTableRecord{}
+				t.tag = d.FieldUTF8("tag", 4)
+				t.offset = int64(d.FieldU32("offset"))
+				t.compLength = int64(d.FieldU32("comp_length"))
+				t.origLength = int64(d.FieldU32("orig_length"))
+				t.origChecksum = uint32(d.FieldU32("orig_checksum", scalar.Hex))
+				if (t.offset+t.compLength)*8 > d.Len() {
+					d.Fatalf("table %q outside file", t.tag)
+				}
+				records = append(records, t)
+			})
+		}
+	})
+
+	var tables []sfntTable
+	sorted := append([]woffTableRecord{}, records...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].offset < sorted[j].offset })
+	d.FieldArray("tables", func(d *decode.D) {
+		for _, t := range sorted {
+			d.FieldStruct("table", func(d *decode.D) {
+				d.FieldValueStr("tag", t.tag)
+				b := d.BytesRange(t.offset*8, int(t.compLength))
+				d.RangeFn(t.offset*8, t.compLength*8, func(d *decode.D) {
+					d.FieldRawLen("data", d.BitsLeft())
+				})
+
+				// data is zlib compressed if smaller than original
+				if t.compLength < t.origLength {
+					ub, err := zlibDecompress(b)
+					if err != nil {
+						d.Fatalf("table %q: %s", t.tag, err)
+					}
+					b = ub
+				}
+				if int64(len(b)) != t.origLength {
+					d.Fatalf("table %q: length %d, expected %d", t.tag, len(b), t.origLength)
+				}
+				tables = append(tables, sfntTable{tag: t.tag, checksum: t.origChecksum, data: b})
+
+				// tables are 4 byte aligned
+				paddingStart := t.offset + t.compLength
+				paddingBytes := int64(pad4(int(paddingStart))) - paddingStart
+				if paddingStart+paddingBytes > d.Len()/8 {
+					paddingBytes = d.Len()/8 - paddingStart
+				}
+				if paddingBytes > 0 {
+					d.RangeFn(paddingStart*8, paddingBytes*8, func(d *decode.D) {
+						d.FieldRawLen("padding", paddingBytes*8, d.BitBufIsZero())
+					})
+				}
+			})
+		}
+	})
+
+	fieldMetadataPrivateData(d, metaOffset, metaLength, privOffset, privLength, zlibDecompress)
+
+	// TODO: collections
+	if flavor == flavorCollection {
+		return nil
+	}
+	sfnt := buildSfnt(uint32(flavor), tables)
+	_, _, _ = d.TryFieldFormatBitBuf("sfnt", bitio.NewBufferFromBytes(sfnt, -1), opentypeFormat, nil)
+
+	return nil
+}
@@ -0,0 +1,364 @@
+package woff
+
+// https://www.w3.org/TR/WOFF2/
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+
+	"github.com/andybalholm/brotli"
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.WOFF2,
+		Description: "Web Open Font Format 2",
+		Groups:      []string{format.PROBE},
+		Magic:       []decode.Magic{{Bytes: []byte("wOF2")}},
+		DecodeFn:    woff2Decode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.OPENTYPE}, Group: &opentypeFormat},
+		},
+	})
+}
+
+const tagIndexArbitrary = 63
+
+var knownTags = []string{
+	"cmap", "head", "hhea", "hmtx", "maxp", "name", "OS/2", "post",
+	"cvt ", "fpgm", "glyf", "loca", "prep", "CFF ", "VORG", "EBDT",
+	"EBLC", "gasp", "hdmx", "kern", "LTSH", "PCLT", "VDMX", "vhea",
+	"vmtx", "BASE", "GDEF", "GPOS", "GSUB", "EBSC", "JSTF", "MATH",
+	"CBDT", "CBLC", "COLR", "CPAL", "SVG ", "sbix", "acnt", "avar",
+	"bdat", "bloc", "bsln", "cvar", "fdsc", "feat", "fmtx", "fvar",
+	"gvar", "hsty", "just", "lcar", "mort", "morx", "opbd", "prop",
+	"trak", "Zapf", "Silf", "Glat", "Gloc", "Feat", "Sill",
+}
+
+var tagIndexNames = func() scalar.UToSymStr {
+	m := scalar.UToSymStr{tagIndexArbitrary: "arbitrary"}
+	for i, t := range knownTags {
+		m[uint64(i)] = t
+	}
+	return m
+}()
+
+var indexFormatNames = scalar.UToSymStr{
+	0: "short",
+	1: "long",
+}
+
+type woff2TableEntry struct {
+	tag             string
+	origLength      int64
+	transformed     bool
+	transformLength int64
+}
+
+// length in uncompressed stream
+func (t woff2TableEntry) length() int64 {
+	if t.transformed {
+		return t.transformLength
+	}
+	return t.origLength
+}
+
+// glyf and loca version 0 is transformed, 3 is null transform.
+// for other tables version 0 is null transform.
+func isTransformed(tag string, version uint64) bool {
+	if tag == "glyf" || tag == "loca" {
+		return version != 3
+	}
+	return version != 0
+}
+
+// UIntBase128, big endian base 128 with continuation bit, max 5 bytes
+func decodeUIntBase128(d *decode.D) uint64 {
+	var v uint64
+	for i := 0; i < 5; i++ {
+		b := d.U8()
+		if i == 0 && b == 0x80 {
+			d.Fatalf("UIntBase128 with leading zeros")
+		}
+		if v&0xfe00_0000 != 0 {
+			d.Fatalf("UIntBase128 overflow")
+		}
+		v = v<<7 | b&0x7f
+		if b&0x80 == 0 {
+			return v
+		}
+	}
+	d.Fatalf("UIntBase128 longer than 5 bytes")
+	return 0
+}
+
+// 255UInt16, variable length u16 optimized for small values
+func decode255UInt16(d *decode.D) uint64 {
+	switch code := d.U8(); code {
+	case wordCode:
+		return d.U16()
+	case oneMoreByteCode1:
+		return d.U8() + lowestUCode
+	case oneMoreByteCode2:
+		return d.U8() + lowestUCode*2
+	default:
+		return code
+	}
+}
+
+func decodeTransformedGlyf(d *decode.D) {
+	var h glyfTransformHeader
+	h.version = int(d.FieldU16("version"))
+	d.FieldStruct("option_flags", func(d *decode.D) {
+		d.FieldU15("reserved")
+		if d.FieldBool("overlap_simple_bitmap") {
+			h.optionFlags |= 1
+		}
+	})
+	h.numGlyphs = int(d.FieldU16("num_glyphs"))
+	h.indexFormat = int(d.FieldU16("index_format", indexFormatNames))
+	h.nContourStreamSize = int(d.FieldU32("n_contour_stream_size"))
+	h.nPointsStreamSize = int(d.FieldU32("n_points_stream_size"))
+	h.flagStreamSize = int(d.FieldU32("flag_stream_size"))
+	h.glyphStreamSize = int(d.FieldU32("glyph_stream_size"))
+	h.compositeStreamSize = int(d.FieldU32("composite_stream_size"))
+	h.bboxStreamSize = int(d.FieldU32("bbox_stream_size"))
+	h.instructionStreamSize = int(d.FieldU32("instruction_stream_size"))
+
+	d.FieldRawLen("n_contour_stream", int64(h.nContourStreamSize)*8)
+	d.FieldRawLen("n_points_stream", int64(h.nPointsStreamSize)*8)
+	d.FieldRawLen("flag_stream", int64(h.flagStreamSize)*8)
+	d.FieldRawLen("glyph_stream", int64(h.glyphStreamSize)*8)
+	d.FieldRawLen("composite_stream", int64(h.compositeStreamSize)*8)
+	d.FieldStruct("bbox_stream", func(d *decode.D) {
+		bitmapLen := int64(bboxBitmapLen(h.numGlyphs))
+		d.FieldRawLen("bbox_bitmap", bitmapLen*8)
+		d.FieldRawLen("bbox", (int64(h.bboxStreamSize)-bitmapLen)*8)
+	})
+	d.FieldRawLen("instruction_stream", int64(h.instructionStreamSize)*8)
+	if h.optionFlags&1 != 0 {
+		d.FieldRawLen("overlap_simple_bitmap", int64(overlapBitmapLen(h.numGlyphs))*8)
+	}
+}
+
+func decodeTransformedHmtx(d *decode.D, numGlyphs int, numHMetrics int) {
+	var noLSB, noMonospaceLSB bool
+	d.FieldStruct("flags", func(d *decode.D) {
+		d.FieldU6("reserved")
+		noMonospaceLSB = d.FieldBool("no_monospace_lsb")
+		noLSB = d.FieldBool("no_lsb")
+	})
+	d.FieldArray("advance_widths", func(d *decode.D) {
+		for i := 0; i < numHMetrics; i++ {
+			d.FieldU16("advance_width")
+		}
+	})
+	if !noLSB {
+		d.FieldArray("lsbs", func(d *decode.D) {
+			for i := 0; i < numHMetrics; i++ {
+				d.FieldS16("lsb")
+			}
+		})
+	}
+	if !noMonospaceLSB {
+		d.FieldArray("left_side_bearings", func(d *decode.D) {
+			for i := numHMetrics; i < numGlyphs; i++ {
+				d.FieldS16("left_side_bearing")
+			}
+		})
+	}
+}
+
+func brotliDecompress(b []byte) ([]byte, error) {
+	return ioutil.ReadAll(brotli.NewReader(bytes.NewReader(b)))
+}
+
+// peekU16 reads an u16 at offset in table data if it exists
+func peekU16(tables map[string][]byte, tag string, offset int) (int, bool) {
+	b, ok := tables[tag]
+	if !ok || offset+2 > len(b) {
+		return 0, false
+	}
+	return int(binary.BigEndian.Uint16(b[offset:])), true
+}
+
+// reconstructTables returns sfnt tables with glyf, loca and hmtx transforms reversed.
+// untransformed has the tables stored without transform and is updated with reconstructed tables.
+func reconstructTables(entries []woff2TableEntry, tableData [][]byte, untransformed map[string][]byte) ([]sfntTable, error) {
+	var xMins []int
+	for i, t := range entries {
+		if t.tag != "glyf" || !t.transformed {
+			continue
+		}
+		glyf, loca, glyfXMins, err := reconstructGlyfLoca(tableData[i])
+		if err != nil {
+			return nil, err
+		}
+		untransformed["glyf"] = glyf
+		untransformed["loca"] = loca
+		xMins = glyfXMins
+	}
+	for i, t := range entries {
+		if t.tag != "hmtx" || !t.transformed {
+			continue
+		}
+		numGlyphs, _ := peekU16(untransformed, "maxp", 4)
+		numHMetrics, _ := peekU16(untransformed, "hhea", 34)
+		hmtx, err := reconstructHmtx(tableData[i], numGlyphs, numHMetrics, xMins)
+		if err != nil {
+			return nil, err
+		}
+		untransformed["hmtx"] = hmtx
+	}
+
+	var tables []sfntTable
+	for _, t := range entries {
+		b, ok := untransformed[t.tag]
+		if !ok {
+			continue
+		}
+		tables = append(tables, sfntTable{tag: t.tag, checksum: sfntChecksum(b), data: b})
+	}
+	return tables, nil
+}
+
+func woff2Decode(d *decode.D, in interface{}) interface{} {
+	d.FieldUTF8("signature", 4, d.AssertStr("wOF2"))
+	flavor := d.FieldU32("flavor", flavorNames, scalar.Hex)
+	d.FieldU32("length")
+	numTables := d.FieldU16("num_tables")
+	if numTables == 0 {
+		d.Fatalf("no tables")
+	}
+	d.FieldU16("reserved", d.AssertU(0))
+	d.FieldU32("total_sfnt_size")
+	totalCompressedSize := d.FieldU32("total_compressed_size")
+	d.FieldU16("major_version")
+	d.FieldU16("minor_version")
+	metaOffset := d.FieldU32("meta_offset")
+	metaLength := d.FieldU32("meta_length")
+	d.FieldU32("meta_orig_length")
+	privOffset := d.FieldU32("priv_offset")
+	privLength := d.FieldU32("priv_length")
+
+	var entries []woff2TableEntry
+	d.FieldArray("table_directory", func(d *decode.D) {
+		for i := uint64(0); i < numTables; i++ {
+			d.FieldStruct("table", func(d *decode.D) {
+				var t woff2TableEntry
+				var transformVersion, tagIndex uint64
+				d.FieldStruct("flags", func(d *decode.D) {
+					transformVersion = d.FieldU2("transform_version")
+					tagIndex = d.FieldU6("tag_index", tagIndexNames)
+				})
+				if tagIndex == tagIndexArbitrary {
+					t.tag = d.FieldUTF8("tag", 4)
+				} else {
+					t.tag = knownTags[tagIndex]
+					d.FieldValueStr("tag", t.tag)
+				}
+				t.origLength = int64(d.FieldUFn("orig_length", decodeUIntBase128))
+				t.transformed = isTransformed(t.tag, transformVersion)
+				d.FieldValueBool("transformed", t.transformed)
+				if t.transformed {
+					t.transformLength = int64(d.FieldUFn("transform_length", decodeUIntBase128))
+				}
+				entries = append(entries, t)
+			})
+		}
+	})
+
+	if flavor == flavorCollection {
+		d.FieldStruct("collection_directory", func(d *decode.D) {
+			d.FieldU32("version", scalar.Hex)
+			numFonts := d.FieldUFn("num_fonts", decode255UInt16)
+			d.FieldArray("fonts", func(d *decode.D) {
+				for i := uint64(0); i < numFonts; i++ {
+					d.FieldStruct("font", func(d *decode.D) {
+						numTables := d.FieldUFn("num_tables", decode255UInt16)
+						d.FieldU32("flavor", flavorNames, scalar.Hex)
+						d.FieldArray("table_indices", func(d *decode.D) {
+							for j := uint64(0); j < numTables; j++ {
+								d.FieldUFn("table_index", decode255UInt16)
+							}
+						})
+					})
+				}
+			})
+		})
+	}
+
+	compressed := d.BytesLen(int(totalCompressedSize))
+	d.SeekRel(-int64(totalCompressedSize) * 8)
+	d.FieldRawLen("compressed_data", int64(totalCompressedSize)*8)
+	uncompressed, err := brotliDecompress(compressed)
+	if err != nil {
+		d.Fatalf("brotli: %s", err)
+	}
+
+	// tables are stored in directory order without padding
+	var tableData [][]byte
+	var uncompressedLen int64
+	for _, t := range entries {
+		if uncompressedLen+t.length() > int64(len(uncompressed)) {
+			d.Fatalf("table %q outside uncompressed data", t.tag)
+		}
+		tableData = append(tableData, uncompressed[uncompressedLen:uncompressedLen+t.length()])
+		uncompressedLen += t.length()
+	}
+
+	untransformed := map[string][]byte{}
+	for i, t := range entries {
+		if !t.transformed {
+			untransformed[t.tag] = tableData[i]
+		}
+	}
+	numGlyphs, _ := peekU16(untransformed, "maxp", 4)
+	numHMetrics, _ := peekU16(untransformed, "hhea", 34)
+
+	d.FieldStructRootBitBufFn("uncompressed", bitio.NewBufferFromBytes(uncompressed, -1), func(d *decode.D) {
+		d.FieldArray("tables", func(d *decode.D) {
+			for _, t := range entries {
+				d.FieldStruct("table", func(d *decode.D) {
+					d.FieldValueStr("tag", t.tag)
+					d.LenFn(t.length()*8, func(d *decode.D) {
+						switch {
+						case t.length() == 0:
+						case t.transformed && t.tag == "glyf":
+							decodeTransformedGlyf(d)
+						case t.transformed && t.tag == "hmtx":
+							decodeTransformedHmtx(d, numGlyphs, numHMetrics)
+						default:
+							d.FieldRawLen("data", d.BitsLeft())
+						}
+					})
+				})
+			}
+		})
+		if int64(len(uncompressed)) > uncompressedLen {
+			d.FieldRawLen("unknown", d.BitsLeft())
+		}
+	})
+
+	fieldMetadataPrivateData(d, metaOffset, metaLength, privOffset, privLength, brotliDecompress)
+
+	// TODO: collections
+	if flavor == flavorCollection {
+		return nil
+	}
+	tables, err := reconstructTables(entries, tableData, untransformed)
+	if err != nil {
+		d.Errorf("reconstruct: %s", err)
+		return nil
+	}
+	sfnt := buildSfnt(uint32(flavor), tables)
+	_, _, _ = d.TryFieldFormatBitBuf("sfnt", bitio.NewBufferFromBytes(sfnt, -1), opentypeFormat, nil)
+
+	return nil
+}
@@ -0,0 +1,455 @@
+package woff
+
+// reconstruction of transformed glyf, loca and hmtx tables
+// https://www.w3.org/TR/WOFF2/#glyf_table_format
+// https://www.w3.org/TR/WOFF2/#hmtx_table_format
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var errStreamEOF = errors.New("unexpected end of stream")
+
+// stream reads big endian values from a byte slice, first error is kept
+type stream struct {
+	b   []byte
+	pos int
+	err error
+}
+
+// bytes returns nil on error, n is from input so callers must check s.err
+func (s *stream) bytes(n int) []byte {
+	if s.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(s.b)-s.pos {
+		s.err = errStreamEOF
+		return nil
+	}
+	b := s.b[s.pos : s.pos+n]
+	s.pos += n
+	return b
+}
+
+// fixed is like bytes but returns zero bytes on error, n should be a small constant
+func (s *stream) fixed(n int) []byte {
+	if b := s.bytes(n); b != nil {
+		return b
+	}
+	return make([]byte, n)
+}
+
+func (s *stream) u8() int  { return int(s.fixed(1)[0]) }
+func (s *stream) u16() int { return int(binary.BigEndian.Uint16(s.fixed(2))) }
+func (s *stream) s16() int { return int(int16(binary.BigEndian.Uint16(s.fixed(2)))) }
+func (s *stream) u32() int { return int(binary.BigEndian.Uint32(s.fixed(4))) }
+func (s *stream) sub(n int) *stream {
+	return &stream{b: s.bytes(n), err: s.err}
+}
+
+func (s *stream) u255() int {
+	switch code := s.u8(); code {
+	case wordCode:
+		return s.u16()
+	case oneMoreByteCode1:
+		return s.u8() + lowestUCode
+	case oneMoreByteCode2:
+		return s.u8() + lowestUCode*2
+	default:
+		return code
+	}
+}
+
+// 255UInt16 codes
+const (
+	wordCode         = 253
+	oneMoreByteCode2 = 254
+	oneMoreByteCode1 = 255
+	lowestUCode      = 253
+)
+
+// composite glyph flags
+const (
+	arg1And2AreWords   = 0x0001
+	weHaveAScale       = 0x0008
+	moreComponents     = 0x0020
+	weHaveAnXAndYScale = 0x0040
+	weHaveATwoByTwo    = 0x0080
+	weHaveInstructions = 0x0100
+)
+
+// simple glyph flags
+const (
+	glyfOnCurve         = 0x01
+	glyfXShort          = 0x02
+	glyfYShort          = 0x04
+	glyfXSameOrPositive = 0x10
+	glyfYSameOrPositive = 0x20
+	glyfOverlapSimple   = 0x40
+)
+
+type glyfTransformHeader struct {
+	version               int
+	optionFlags           int
+	numGlyphs             int
+	indexFormat           int
+	nContourStreamSize    int
+	nPointsStreamSize     int
+	flagStreamSize        int
+	glyphStreamSize       int
+	compositeStreamSize   int
+	bboxStreamSize        int
+	instructionStreamSize int
+}
+
+const glyfTransformHeaderLen = 36
+
+func readGlyfTransformHeader(s *stream) glyfTransformHeader {
+	return glyfTransformHeader{
+		version:               s.u16(),
+		optionFlags:           s.u16(),
+		numGlyphs:             s.u16(),
+		indexFormat:           s.u16(),
+		nContourStreamSize:    s.u32(),
+		nPointsStreamSize:     s.u32(),
+		flagStreamSize:        s.u32(),
+		glyphStreamSize:       s.u32(),
+		compositeStreamSize:   s.u32(),
+		bboxStreamSize:        s.u32(),
+		instructionStreamSize: s.u32(),
+	}
+}
+
+func withSign(flag int, v int) int {
+	if flag&1 != 0 {
+		return v
+	}
+	return -v
+}
+
+// tripletDecode decodes point deltas, see https://www.w3.org/TR/WOFF2/#triplet_decoding
+func tripletDecode(flag int, s *stream) (int, int) {
+	var dx, dy int
+	switch {
+	case flag < 10:
+		dy = withSign(flag, ((flag&14)<<7)+s.u8())
+	case flag < 20:
+		dx = withSign(flag, (((flag-10)&14)<<7)+s.u8())
+	case flag < 84:
+		b0 := flag - 20
+		b1 := s.u8()
+		dx = withSign(flag, 1+(b0&0x30)+(b1>>4))
+		dy = withSign(flag>>1, 1+((b0&0x0c)<<2)+(b1&0x0f))
+	case flag < 120:
+		b0 := flag - 84
+		dx = withSign(flag, 1+((b0/12)<<8)+s.u8())
+		dy = withSign(flag>>1, 1+(((b0%12)>>2)<<8)+s.u8())
+	case flag < 124:
+		b1 := s.u8()
+		b2 := s.u8()
+		b3 := s.u8()
+		dx = withSign(flag, (b1<<4)+(b2>>4))
+		dy = withSign(flag>>1, ((b2&0x0f)<<8)+b3)
+	default:
+		dx = withSign(flag, s.u16())
+		dy = withSign(flag>>1, s.u16())
+	}
+	return dx, dy
+}
+
+type point struct {
+	x, y    int
+	onCurve bool
+}
+
+func appendU16(b []byte, v int) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+// encodeSimpleGlyph encodes points without repeat flags
+func encodeSimpleGlyph(endPts []int, points []point, instructions []byte, overlap bool) []byte {
+	xMin, yMin, xMax, yMax := bbox(points)
+	b := appendU16(nil, len(endPts))
+	b = appendU16(b, xMin)
+	b = appendU16(b, yMin)
+	b = appendU16(b, xMax)
+	b = appendU16(b, yMax)
+	for _, e := range endPts {
+		b = appendU16(b, e)
+	}
+	b = appendU16(b, len(instructions))
+	b = append(b, instructions...)
+
+	var flags, xs, ys []byte
+	lastX, lastY := 0, 0
+	for i, p := range points {
+		var flag byte
+		if p.onCurve {
+			flag |= glyfOnCurve
+		}
+		if i == 0 && overlap {
+			flag |= glyfOverlapSimple
+		}
+		dx, dy := p.x-lastX, p.y-lastY
+		lastX, lastY = p.x, p.y
+		switch {
+		case dx == 0:
+			flag |= glyfXSameOrPositive
+		case dx > -256 && dx < 256:
+			flag |= glyfXShort
+			if dx > 0 {
+				flag |= glyfXSameOrPositive
+			} else {
+				dx = -dx
+			}
+			xs = append(xs, byte(dx))
+		default:
+			xs = appendU16(xs, dx)
+		}
+		switch {
+		case dy == 0:
+			flag |= glyfYSameOrPositive
+		case dy > -256 && dy < 256:
+			flag |= glyfYShort
+			if dy > 0 {
+				flag |= glyfYSameOrPositive
+			} else {
+				dy = -dy
+			}
+			ys = append(ys, byte(dy))
+		default:
+			ys = appendU16(ys, dy)
+		}
+		flags = append(flags, flag)
+	}
+	b = append(b, flags...)
+	b = append(b, xs...)
+	b = append(b, ys...)
+
+	return b
+}
+
+func bbox(points []point) (int, int, int, int) {
+	if len(points) == 0 {
+		return 0, 0, 0, 0
+	}
+	xMin, yMin := math.MaxInt32, math.MaxInt32
+	xMax, yMax := math.MinInt32, math.MinInt32
+	for _, p := range points {
+		if p.x < xMin {
+			xMin = p.x
+		}
+		if p.x > xMax {
+			xMax = p.x
+		}
+		if p.y < yMin {
+			yMin = p.y
+		}
+		if p.y > yMax {
+			yMax = p.y
+		}
+	}
+	return xMin, yMin, xMax, yMax
+}
+
+// compositeGlyphLen returns length of composite glyph components and if it has instructions
+func compositeGlyphLen(b []byte) (int, bool, error) {
+	s := &stream{b: b}
+	haveInstructions := false
+	for {
+		flags := s.u16()
+		s.u16() // glyph index
+		n := 2
+		if flags&arg1And2AreWords != 0 {
+			n = 4
+		}
+		switch {
+		case flags&weHaveAScale != 0:
+			n += 2
+		case flags&weHaveAnXAndYScale != 0:
+			n += 4
+		case flags&weHaveATwoByTwo != 0:
+			n += 8
+		}
+		s.bytes(n)
+		if flags&weHaveInstructions != 0 {
+			haveInstructions = true
+		}
+		if s.err != nil {
+			return 0, false, s.err
+		}
+		if flags&moreComponents == 0 {
+			return s.pos, haveInstructions, nil
+		}
+	}
+}
+
+// reconstructGlyfLoca returns glyf and loca tables and xMin for each glyph
+func reconstructGlyfLoca(b []byte) ([]byte, []byte, []int, error) {
+	s := &stream{b: b}
+	h := readGlyfTransformHeader(s)
+	if s.err != nil {
+		return nil, nil, nil, s.err
+	}
+	nContourStream := s.sub(h.nContourStreamSize)
+	nPointsStream := s.sub(h.nPointsStreamSize)
+	flagStream := s.sub(h.flagStreamSize)
+	glyphStream := s.sub(h.glyphStreamSize)
+	compositeStream := s.sub(h.compositeStreamSize)
+	bboxStream := s.sub(h.bboxStreamSize)
+	instructionStream := s.sub(h.instructionStreamSize)
+	bboxBitmap := bboxStream.bytes(bboxBitmapLen(h.numGlyphs))
+	var overlapBitmap []byte
+	if h.optionFlags&1 != 0 {
+		overlapBitmap = s.bytes(overlapBitmapLen(h.numGlyphs))
+	}
+	if s.err != nil {
+		return nil, nil, nil, s.err
+	}
+	if bboxStream.err != nil {
+		return nil, nil, nil, bboxStream.err
+	}
+
+	var glyf []byte
+	offsets := make([]int, 0, h.numGlyphs+1)
+	xMins := make([]int, h.numGlyphs)
+	for i := 0; i < h.numGlyphs; i++ {
+		offsets = append(offsets, len(glyf))
+
+		hasBBox := bboxBitmap[i>>3]&(0x80>>(i&7)) != 0
+		readBBox := func() []byte {
+			bb := bboxStream.fixed(8)
+			xMins[i] = int(int16(binary.BigEndian.Uint16(bb)))
+			return bb
+		}
+
+		nContours := nContourStream.s16()
+		switch {
+		case nContours == 0:
+			if hasBBox {
+				return nil, nil, nil, errors.New("empty glyph with bbox")
+			}
+		case nContours < 0:
+			if !hasBBox {
+				return nil, nil, nil, errors.New("composite glyph without bbox")
+			}
+			n, haveInstructions, err := compositeGlyphLen(compositeStream.b[compositeStream.pos:])
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			glyf = appendU16(glyf, nContours)
+			glyf = append(glyf, readBBox()...)
+			glyf = append(glyf, compositeStream.bytes(n)...)
+			if haveInstructions {
+				instructionLen := glyphStream.u255()
+				glyf = appendU16(glyf, instructionLen)
+				glyf = append(glyf, instructionStream.bytes(instructionLen)...)
+			}
+		default:
+			var endPts []int
+			nPoints := 0
+			for j := 0; j < nContours; j++ {
+				nPoints += nPointsStream.u255()
+				endPts = append(endPts, nPoints-1)
+			}
+			// each point has a flag byte
+			if nPoints > len(flagStream.b)-flagStream.pos {
+				return nil, nil, nil, errStreamEOF
+			}
+			points := make([]point, nPoints)
+			x, y := 0, 0
+			for j := range points {
+				flag := flagStream.u8()
+				dx, dy := tripletDecode(flag&0x7f, glyphStream)
+				x += dx
+				y += dy
+				points[j] = point{x: x, y: y, onCurve: flag&0x80 == 0}
+			}
+			instructionLen := glyphStream.u255()
+			instructions := instructionStream.bytes(instructionLen)
+			overlap := overlapBitmap != nil && overlapBitmap[i>>3]&(0x80>>(i&7)) != 0
+			g := encodeSimpleGlyph(endPts, points, instructions, overlap)
+			if hasBBox {
+				copy(g[2:], readBBox())
+			} else {
+				xMins[i], _, _, _ = bbox(points)
+			}
+			glyf = append(glyf, g...)
+		}
+
+		for _, err := range []error{nContourStream.err, nPointsStream.err, flagStream.err, glyphStream.err, compositeStream.err, bboxStream.err, instructionStream.err} {
+			if err != nil {
+				return nil, nil, nil, err
+			}
+		}
+
+		// glyphs are 4 byte aligned
+		glyf = append(glyf, make([]byte, pad4(len(glyf))-len(glyf))...)
+	}
+	offsets = append(offsets, len(glyf))
+
+	var loca []byte
+	for _, o := range offsets {
+		if h.indexFormat == 0 {
+			loca = appendU16(loca, o/2)
+		} else {
+			loca = append(loca, byte(o>>24), byte(o>>16), byte(o>>8), byte(o))
+		}
+	}
+
+	return glyf, loca, xMins, nil
+}
+
+func bboxBitmapLen(numGlyphs int) int {
+	return ((numGlyphs + 31) >> 5) << 2
+}
+
+func overlapBitmapLen(numGlyphs int) int {
+	return (numGlyphs + 7) >> 3
+}
+
+const (
+	hmtxFlagNoLSB          = 0x01
+	hmtxFlagNoMonospaceLSB = 0x02
+)
+
+// reconstructHmtx returns hmtx table using glyph xMin for left side bearings not stored
+func reconstructHmtx(b []byte, numGlyphs int, numHMetrics int, xMins []int) ([]byte, error) {
+	if numHMetrics > numGlyphs || len(xMins) < numGlyphs {
+		return nil, errors.New("invalid number of metrics")
+	}
+	s := &stream{b: b}
+	flags := s.u8()
+	advances := make([]int, numHMetrics)
+	for i := range advances {
+		advances[i] = s.u16()
+	}
+	lsbs := make([]int, numGlyphs)
+	for i := range lsbs {
+		noLSB := (i < numHMetrics && flags&hmtxFlagNoLSB != 0) ||
+			(i >= numHMetrics && flags&hmtxFlagNoMonospaceLSB != 0)
+		if noLSB {
+			lsbs[i] = xMins[i]
+		}
+	}
+	for i := 0; i < numHMetrics && flags&hmtxFlagNoLSB == 0; i++ {
+		lsbs[i] = s.s16()
+	}
+	for i := numHMetrics; i < numGlyphs && flags&hmtxFlagNoMonospaceLSB == 0; i++ {
+		lsbs[i] = s.s16()
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	var hmtx []byte
+	for i := 0; i < numGlyphs; i++ {
+		if i < numHMetrics {
+			hmtx = appendU16(hmtx, advances[i])
+		}
+		hmtx = appendU16(hmtx, lsbs[i])
+	}
+	return hmtx, nil
+}
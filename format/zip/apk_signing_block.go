@@ -0,0 +1,189 @@
+package zip
+
+// https://source.android.com/docs/security/features/apksigning/v2
+// https://source.android.com/docs/security/features/apksigning/v3
+// https://android.googlesource.com/platform/tools/apksig/+/refs/heads/master/src/main/java/com/android/apksig/internal/apk/ApkSigningBlockUtils.java
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+const apkSigningBlockMagic = "APK Sig Block 42"
+
+const (
+	apkSignatureSchemeV2BlockID  = 0x7109871a
+	apkSignatureSchemeV3BlockID  = 0xf05368c0
+	apkSignatureSchemeV31BlockID = 0x1b93ad61
+)
+
+var apkSigningBlockIDMap = scalar.UToScalar{
+	apkSignatureSchemeV2BlockID:  {Sym: "signature_scheme_v2", Description: "APK Signature Scheme v2"},
+	apkSignatureSchemeV3BlockID:  {Sym: "signature_scheme_v3", Description: "APK Signature Scheme v3"},
+	apkSignatureSchemeV31BlockID: {Sym: "signature_scheme_v31", Description: "APK Signature Scheme v3.1"},
+	0x42726577:                   {Sym: "verity_padding", Description: "Padding to 4096 byte alignment"},
+	0x6dff800d:                   {Sym: "source_stamp_v2", Description: "Source stamp v2"},
+	0x2b09189e:                   {Sym: "source_stamp_v1", Description: "Source stamp v1"},
+	0x504b4453:                   {Sym: "dependency_info", Description: "Dependency metadata"},
+	0x2146444e:                   {Sym: "play_frosting", Description: "Google Play frosting"},
+}
+
+var apkSignatureAlgorithmMap = scalar.UToScalar{
+	0x0101: {Sym: "rsa_pss_sha256", Description: "RSASSA-PSS with SHA2-256 digest"},
+	0x0102: {Sym: "rsa_pss_sha512", Description: "RSASSA-PSS with SHA2-512 digest"},
+	0x0103: {Sym: "rsa_pkcs1_sha256", Description: "RSASSA-PKCS1-v1_5 with SHA2-256 digest"},
+	0x0104: {Sym: "rsa_pkcs1_sha512", Description: "RSASSA-PKCS1-v1_5 with SHA2-512 digest"},
+	0x0201: {Sym: "ecdsa_sha256", Description: "ECDSA with SHA2-256 digest"},
+	0x0202: {Sym: "ecdsa_sha512", Description: "ECDSA with SHA2-512 digest"},
+	0x0301: {Sym: "dsa_sha256", Description: "DSA with SHA2-256 digest"},
+	0x0421: {Sym: "verity_rsa_pkcs1_sha256", Description: "RSASSA-PKCS1-v1_5 with SHA2-256 verity digest"},
+	0x0423: {Sym: "verity_ecdsa_sha256", Description: "ECDSA with SHA2-256 verity digest"},
+	0x0425: {Sym: "verity_dsa_sha256", Description: "DSA with SHA2-256 verity digest"},
+}
+
+var apkAttributeIDMap = scalar.UToScalar{
+	0xbeeff00d: {Sym: "stripping_protection", Description: "Signature schemes used, stops downgrade to older scheme"},
+	0x3ba06f8c: {Sym: "proof_of_rotation", Description: "Signing certificate lineage"},
+	0x559f8b02: {Sym: "rotation_min_sdk_version", Description: "Min SDK version for rotated signer"},
+	0xc2a6b3ba: {Sym: "rotation_on_dev_release", Description: "Rotation targets development release"},
+}
+
+// apkSigningBlockRange returns byte offset and size of the signing block that ends
+// where central directory starts, ok is false if there is no block.
+// Layout is size, id-value pairs, size repeated and magic.
+func apkSigningBlockRange(d *decode.D, offsetCD uint64) (int64, int64, bool) {
+	const footerLen = 8 + len(apkSigningBlockMagic)
+	if offsetCD < uint64(footerLen) || int64(offsetCD)*8 > d.Len() {
+		return 0, 0, false
+	}
+	footer := d.BytesRange(int64(offsetCD-uint64(footerLen))*8, footerLen)
+	if string(footer[8:]) != apkSigningBlockMagic {
+		return 0, 0, false
+	}
+	size := binary.LittleEndian.Uint64(footer[0:8])
+	// size excludes the first size field
+	if size < uint64(footerLen) || size+8 > offsetCD {
+		return 0, 0, false
+	}
+	return int64(offsetCD - size - 8), int64(size + 8), true
+}
+
+// u32 length prefixed sequence of u32 length prefixed elements
+func fieldLengthPrefixedArray(d *decode.D, name string, elemName string, fn func(d *decode.D)) {
+	length := d.FieldU32(name + "_length")
+	d.FieldArray(name, func(d *decode.D) {
+		d.LenFn(int64(length)*8, func(d *decode.D) {
+			for !d.End() {
+				d.FieldStruct(elemName, func(d *decode.D) {
+					elemLength := d.FieldU32("length")
+					d.LenFn(int64(elemLength)*8, fn)
+				})
+			}
+		})
+	})
+}
+
+func fieldLengthPrefixedRaw(d *decode.D, name string, sms ...scalar.Mapper) int64 {
+	length := int64(d.FieldU32(name + "_length"))
+	d.FieldRawLen(name, length*8, sms...)
+	return length
+}
+
+func certificateDescription(b []byte) scalar.Mapper {
+	cert, err := x509.ParseCertificate(b)
+	if err != nil {
+		return scalar.Description("invalid certificate")
+	}
+	return scalar.Description(cert.Subject.String())
+}
+
+func publicKeyDescription(b []byte) scalar.Mapper {
+	key, err := x509.ParsePKIXPublicKey(b)
+	if err != nil {
+		return scalar.Description("invalid public key")
+	}
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return scalar.Description(fmt.Sprintf("RSA %d bits", k.N.BitLen()))
+	case *ecdsa.PublicKey:
+		return scalar.Description(fmt.Sprintf("ECDSA %s", k.Curve.Params().Name))
+	case ed25519.PublicKey:
+		return scalar.Description("Ed25519")
+	default:
+		return scalar.Description(fmt.Sprintf("%T", key))
+	}
+}
+
+func decodeAPKSigner(d *decode.D, v3 bool) {
+	d.FieldStruct("signed_data", func(d *decode.D) {
+		length := d.FieldU32("length")
+		d.LenFn(int64(length)*8, func(d *decode.D) {
+			fieldLengthPrefixedArray(d, "digests", "digest", func(d *decode.D) {
+				d.FieldU32("signature_algorithm_id", apkSignatureAlgorithmMap, scalar.Hex)
+				fieldLengthPrefixedRaw(d, "digest", scalar.RawHex)
+			})
+			fieldLengthPrefixedArray(d, "certificates", "certificate", func(d *decode.D) {
+				d.FieldRawLen("certificate", d.BitsLeft(), certificateDescription(d.PeekBytes(int(d.BitsLeft()/8))))
+			})
+			fieldLengthPrefixedArray(d, "additional_attributes", "additional_attribute", func(d *decode.D) {
+				d.FieldU32("id", apkAttributeIDMap, scalar.Hex)
+				d.FieldRawLen("value", d.BitsLeft())
+			})
+			if v3 {
+				d.FieldU32("min_sdk")
+				d.FieldU32("max_sdk")
+			}
+			if d.BitsLeft() > 0 {
+				d.FieldRawLen("unknown", d.BitsLeft())
+			}
+		})
+	})
+	if v3 {
+		d.FieldU32("min_sdk")
+		d.FieldU32("max_sdk")
+	}
+	fieldLengthPrefixedArray(d, "signatures", "signature", func(d *decode.D) {
+		d.FieldU32("signature_algorithm_id", apkSignatureAlgorithmMap, scalar.Hex)
+		fieldLengthPrefixedRaw(d, "signature")
+	})
+	publicKeyLength := d.FieldU32("public_key_length")
+	d.FieldRawLen("public_key", int64(publicKeyLength)*8, publicKeyDescription(d.PeekBytes(int(publicKeyLength))))
+}
+
+func decodeAPKSigningBlock(d *decode.D) {
+	size := d.FieldU64("size")
+	pairsLen := int64(size) - 8 - int64(len(apkSigningBlockMagic))
+	d.FieldArray("pairs", func(d *decode.D) {
+		d.LenFn(pairsLen*8, func(d *decode.D) {
+			for !d.End() {
+				d.FieldStruct("pair", func(d *decode.D) {
+					length := d.FieldU64("length")
+					if length < 4 {
+						d.Fatalf("pair length %d too small", length)
+					}
+					id := d.FieldU32("id", apkSigningBlockIDMap, scalar.Hex)
+					d.LenFn(int64(length-4)*8, func(d *decode.D) {
+						switch id {
+						case apkSignatureSchemeV2BlockID:
+							fieldLengthPrefixedArray(d, "signers", "signer", func(d *decode.D) { decodeAPKSigner(d, false) })
+						case apkSignatureSchemeV3BlockID,
+							apkSignatureSchemeV31BlockID:
+							fieldLengthPrefixedArray(d, "signers", "signer", func(d *decode.D) { decodeAPKSigner(d, true) })
+						default:
+							d.FieldRawLen("value", d.BitsLeft())
+						}
+					})
+				})
+			}
+		})
+	})
+	d.FieldU64("size_repeated", d.ValidateU(size))
+	d.FieldUTF8("magic", len(apkSigningBlockMagic), d.AssertStr(apkSigningBlockMagic))
+}
@@ -2,11 +2,14 @@ package zip
 
 // https://pkware.cachefly.net/webdocs/casestudies/APPNOTE.TXT
 // https://opensource.apple.com/source/zip/zip-6/unzip/unzip/proginfo/extra.fld
+// APK Signing Block, see apk_signing_block.go
 
 import (
 	"bytes"
 	"compress/flate"
+	"fmt"
 	"io"
+	"strings"
 
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/registry"
@@ -18,10 +21,11 @@ var probeFormat decode.Group
 
 func init() {
 	registry.MustRegister(decode.Format{
-		Name:        format.ZIP,
-		Description: "ZIP archive",
-		Groups:      []string{format.PROBE},
-		DecodeFn:    zipDecode,
+		Name:          format.ZIP,
+		Description:   "ZIP archive",
+		Groups:        []string{format.PROBE},
+		DecodeFn:      zipDecode,
+		EmbeddedFiles: zipEmbeddedFiles,
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.PROBE}, Group: &probeFormat},
 		},
@@ -322,5 +326,54 @@ func zipDecode(d *decode.D, in interface{}) interface{} {
 		}
 	})
 
+	if start, size, ok := apkSigningBlockRange(d, offsetCD); ok {
+		d.SeekAbs(start * 8)
+		d.FieldStruct("apk_signing_block", func(d *decode.D) {
+			d.LenFn(size*8, decodeAPKSigningBlock)
+		})
+	}
+
 	return nil
 }
+
+func zipEmbeddedFiles(v *decode.Value) ([]decode.EmbeddedFile, error) {
+	var efs []decode.EmbeddedFile
+	for _, lf := range v.Child("local_files").Children() {
+		name, _ := lf.Child("file_name").Scalar().Actual.(string)
+		if strings.HasSuffix(name, "/") {
+			efs = append(efs, decode.EmbeddedFile{Name: name, Dir: true})
+			continue
+		}
+
+		compressionMethod, _ := lf.Child("compression_method").Scalar().Actual.(uint64)
+		ef := decode.EmbeddedFile{Name: name}
+		// size is in data descriptor if streamed
+		if n, ok := lf.Child("uncompressed_size").Scalar().Actual.(uint64); ok {
+			ef.Size = int64(n)
+		}
+		if dv := lf.Child("data_indicator"); dv != nil {
+			if n, ok := dv.Child("uncompressed_size").Scalar().Actual.(uint64); ok {
+				ef.Size = int64(n)
+			}
+		}
+		switch compressionMethod {
+		case compressionMethodNone:
+			if dv := lf.Child("uncompressed"); dv != nil {
+				ef.Range = dv.Range
+			}
+		case compressionMethodDeflated:
+			ef.Decompress = func(r io.Reader) (io.Reader, error) { return flate.NewReader(r), nil }
+		default:
+			ef.Decompress = func(r io.Reader) (io.Reader, error) {
+				return nil, fmt.Errorf("unsupported compression method %d", compressionMethod)
+			}
+		}
+		if ef.Decompress != nil {
+			if dv := lf.Child("compressed"); dv != nil {
+				ef.Range = dv.Range
+			}
+		}
+		efs = append(efs, ef)
+	}
+	return efs, nil
+}
@@ -3,6 +3,10 @@ module github.com/wader/fq
 go 1.17
 
 require (
+	// bump: gomod-brotli /github\.com\/andybalholm\/brotli v(.*)/ https://github.com/andybalholm/brotli.git|^1
+	// bump: gomod-brotli command go get -d github.com/andybalholm/brotli@v$LATEST && go mod tidy
+	// bump: gomod-brotli link "Source diff $CURRENT..$LATEST" https://github.com/andybalholm/brotli/compare/v$CURRENT..v$LATEST
+	github.com/andybalholm/brotli v1.0.4
 	// bump: gomod-gopacket /github\.com\/google\/gopacket v(.*)/ https://github.com/google/gopacket.git|^1
 	// bump: gomod-gopacket command go get -d github.com/google/gopacket@v$LATEST && go mod tidy
 	// bump: gomod-gopacket link "Release notes" https://github.com/google/gopacket/releases/tag/v$LATEST
@@ -0,0 +1,122 @@
+// Package lineparse has helpers for decoding line based text formats where
+// fields are values parsed from byte ranges of the input
+package lineparse
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+type Token struct {
+	Start int // byte offset in input
+	End   int
+	Value string
+}
+
+type Line struct {
+	Start  int // byte offset in input
+	End    int // including newline
+	Value  string
+	Tokens []Token
+}
+
+// Span of field for token i, first token starts at beginning of line and last
+// ends at end of line so that fields for a line covers the whole line
+func (l Line) Span(i int) (int, int) {
+	start := l.Start
+	if i > 0 {
+		start = l.Tokens[i-1].End
+	}
+	end := l.Tokens[i].End
+	if i == len(l.Tokens)-1 {
+		end = l.End
+	}
+	return start, end
+}
+
+// Split splits b[start:end] without newline into at most n tokens separated
+// by space, last token is rest of line. n <= 0 means no limit.
+func Split(b []byte, start int, end int, n int) Line {
+	s := bytes.TrimRight(b[start:end], "\r\n")
+	l := Line{Start: start, End: end, Value: string(s)}
+	for i := 0; i < len(s); {
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+		if i >= len(s) {
+			break
+		}
+		j := bytes.IndexByte(s[i:], ' ')
+		if j == -1 || len(l.Tokens) == n-1 {
+			j = len(bytes.TrimRight(s[i:], " "))
+		}
+		l.Tokens = append(l.Tokens, Token{Start: start + i, End: start + i + j, Value: string(s[i : i+j])})
+		i += j
+	}
+	return l
+}
+
+// FieldSpan decodes fields using fn in range start to end and then seeks to end
+func FieldSpan(d *decode.D, start int, end int, fn func(d *decode.D)) {
+	d.RangeFn(int64(start)*8, int64(end-start)*8, fn)
+	// derived values after this field
+	d.SeekAbs(int64(end) * 8)
+}
+
+// FieldStr adds a string field with value covering start to end
+func FieldStr(d *decode.D, start int, end int, name string, value string, sms ...scalar.Mapper) string {
+	FieldSpan(d, start, end, func(d *decode.D) {
+		d.FieldStrFn(name, func(d *decode.D) string {
+			d.SeekRel(d.BitsLeft())
+			return value
+		}, sms...)
+	})
+	return value
+}
+
+// FieldU adds an unsigned integer field with value covering start to end
+func FieldU(d *decode.D, start int, end int, name string, value uint64, sms ...scalar.Mapper) uint64 {
+	FieldSpan(d, start, end, func(d *decode.D) {
+		d.FieldUFn(name, func(d *decode.D) uint64 {
+			d.SeekRel(d.BitsLeft())
+			return value
+		}, sms...)
+	})
+	return value
+}
+
+// FieldF adds a float field with value covering start to end
+func FieldF(d *decode.D, start int, end int, name string, value float64, sms ...scalar.Mapper) float64 {
+	FieldSpan(d, start, end, func(d *decode.D) {
+		d.FieldFFn(name, func(d *decode.D) float64 {
+			d.SeekRel(d.BitsLeft())
+			return value
+		}, sms...)
+	})
+	return value
+}
+
+// FieldToken adds a string field for token i of line
+func FieldToken(d *decode.D, l Line, i int, name string, sms ...scalar.Mapper) string {
+	if i >= len(l.Tokens) {
+		d.Fatalf("missing %s", name)
+	}
+	start, end := l.Span(i)
+	return FieldStr(d, start, end, name, l.Tokens[i].Value, sms...)
+}
+
+// FieldTokenU adds an unsigned integer field for decimal token i of line
+func FieldTokenU(d *decode.D, l Line, i int, name string, sms ...scalar.Mapper) uint64 {
+	if i >= len(l.Tokens) {
+		d.Fatalf("missing %s", name)
+	}
+	n, err := strconv.ParseUint(l.Tokens[i].Value, 10, 64)
+	if err != nil {
+		d.Fatalf("invalid %s %q", name, l.Tokens[i].Value)
+	}
+	start, end := l.Span(i)
+	return FieldU(d, start, end, name, n, sms...)
+}
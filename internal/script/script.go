@@ -2,7 +2,9 @@ package script
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -141,6 +143,52 @@ func (cr *CaseRun) ConfigDir() (string, error) { return "/config", nil }
 
 func (cr *CaseRun) FS() fs.FS { return cr.Case }
 
+// written files are kept in memory and can be opened by later runs in same case
+func (cr *CaseRun) MkdirAll(path string) error { return nil }
+
+func (cr *CaseRun) Create(name string) (io.WriteCloser, error) {
+	return &caseWriteFile{c: cr.Case, name: name}, nil
+}
+
+// temp files are written files with generated names
+func (cr *CaseRun) TempFile() (string, io.WriteCloser, error) {
+	cr.Case.tempFiles++
+	name := fmt.Sprintf("/tmp/fq-%d", cr.Case.tempFiles)
+	return name, &caseWriteFile{c: cr.Case, name: name}, nil
+}
+
+// fake commands, cat copies files or stdin to stdout, echo writes arguments
+// and false fails with stderr output
+func (cr *CaseRun) Exec(ctx context.Context, name string, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	switch name {
+	case "cat":
+		if len(args) == 0 && stdin != nil {
+			_, err := io.Copy(stdout, stdin)
+			return err
+		}
+		for _, a := range args {
+			f, err := cr.Case.Open(a)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(stdout, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case "echo":
+		_, err := fmt.Fprintln(stdout, strings.Join(args, " "))
+		return err
+	case "false":
+		fmt.Fprintln(stderr, "false: failed")
+		return errors.New("exit status 1")
+	default:
+		return fmt.Errorf("exec: %q: executable file not found in $PATH", name)
+	}
+}
+
 func (cr *CaseRun) Readline(prompt string, complete func(line string, pos int) (newLine []string, shared int)) (string, error) {
 	cr.ActualStdoutBuf.WriteString(prompt)
 	if cr.ReadlinesPos >= len(cr.Readlines) {
@@ -210,6 +258,20 @@ type caseFile struct {
 
 func (cf *caseFile) Line() int { return cf.lineNr }
 
+type caseWriteFile struct {
+	bytes.Buffer
+	c    *Case
+	name string
+}
+
+func (wf *caseWriteFile) Close() error {
+	if wf.c.written == nil {
+		wf.c.written = map[string][]byte{}
+	}
+	wf.c.written[wf.name] = wf.Bytes()
+	return nil
+}
+
 type caseComment struct {
 	lineNr  int
 	comment string
@@ -218,9 +280,12 @@ type caseComment struct {
 func (cc *caseComment) Line() int { return cc.lineNr }
 
 type Case struct {
-	Path   string
-	Parts  []part
-	WasRun bool
+	Path    string
+	Parts   []part
+	WasRun  bool
+	written map[string][]byte
+	// number of created temp files
+	tempFiles int
 }
 
 func (c *Case) ToActual() string {
@@ -285,18 +350,25 @@ func (c *Case) ToActual() string {
 }
 
 func (c *Case) Open(name string) (fs.File, error) {
+	newFileReader := func(data []byte) fs.File {
+		return interp.FileReader{
+			R: io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data))),
+			FileInfo: interp.FixedFileInfo{
+				FName: filepath.Base(name),
+				FSize: int64(len(data)),
+			},
+		}
+	}
+
 	for _, p := range c.Parts {
 		f, ok := p.(*caseFile)
 		if ok && f.name == name {
-			return interp.FileReader{
-				R: io.NewSectionReader(bytes.NewReader(f.data), 0, int64(len(f.data))),
-				FileInfo: interp.FixedFileInfo{
-					FName: filepath.Base(name),
-					FSize: int64(len(f.data)),
-				},
-			}, nil
+			return newFileReader(f.data), nil
 		}
 	}
+	if data, ok := c.written[name]; ok {
+		return newFileReader(data), nil
+	}
 	return os.Open(filepath.Join(filepath.Dir(c.Path), name))
 }
 
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io"
 	"strings"
+
+	"github.com/wader/fq/pkg/ranges"
 )
 
 type br interface {
@@ -99,6 +101,60 @@ func (b *Buffer) BitBufRange(firstBitOffset int64, nBits int64) (*Buffer, error)
 	}, nil
 }
 
+// SourceRanges returns the bit ranges in src that nBits bits starting at firstBitOffset in b
+// are read from, ex for a buffer reassembled from ranges of src.
+// ok is false if some bits are not read from src, ex decompressed data.
+func (b *Buffer) SourceRanges(src *Buffer, firstBitOffset int64, nBits int64) (rs []ranges.Range, ok bool) {
+	if b == src {
+		return []ranges.Range{{Start: firstBitOffset, Len: nBits}}, true
+	}
+	if !sourceRanges(b.br, src, firstBitOffset, nBits, &rs) {
+		return nil, false
+	}
+	return rs, true
+}
+
+func sourceRanges(r BitReaderAt, src *Buffer, firstBitOffset int64, nBits int64, rs *[]ranges.Range) bool {
+	if r == BitReaderAt(src) || r == BitReaderAt(src.br) {
+		// merge with previous range if continuous
+		if l := len(*rs); l > 0 && (*rs)[l-1].Stop() == firstBitOffset {
+			(*rs)[l-1].Len += nBits
+		} else {
+			*rs = append(*rs, ranges.Range{Start: firstBitOffset, Len: nBits})
+		}
+		return true
+	}
+
+	switch rr := r.(type) {
+	case *Buffer:
+		return sourceRanges(rr.br, src, firstBitOffset, nBits, rs)
+	case *SectionBitReader:
+		return sourceRanges(rr.r, src, rr.bitBase+firstBitOffset, nBits, rs)
+	case *MultiBitReader:
+		stop := firstBitOffset + nBits
+		var readerStart int64
+		for i, readerEnd := range rr.readerEnds {
+			if firstBitOffset < readerEnd && stop > readerStart {
+				start := firstBitOffset
+				if start < readerStart {
+					start = readerStart
+				}
+				end := stop
+				if end > readerEnd {
+					end = readerEnd
+				}
+				if !sourceRanges(rr.readers[i], src, start-readerStart, end-start, rs) {
+					return false
+				}
+			}
+			readerStart = readerEnd
+		}
+		return true
+	default:
+		return false
+	}
+}
+
 // Clone buffer and reset position to zero
 func (b *Buffer) Clone() *Buffer {
 	return &Buffer{
@@ -94,3 +94,43 @@ func TestInvalidBitString(t *testing.T) {
 	}()
 	bitio.NewBufferFromBitString("01invalid")
 }
+
+func TestBufferSourceRanges(t *testing.T) {
+	src := bitio.NewBufferFromBytes(make([]byte, 16), -1)
+	a, _ := src.BitBufRange(8, 16)
+	b, _ := src.BitBufRange(24, 8)
+	c, _ := src.BitBufRange(64, 32)
+	mb, _ := bitio.NewMultiBitReader([]bitio.BitReadAtSeeker{a, b, c})
+	bb, _ := bitio.NewBufferFromBitReadSeeker(mb)
+	subBb, _ := bb.BitBufRange(4, 40)
+
+	testCases := []struct {
+		bb       *bitio.Buffer
+		start    int64
+		len      int64
+		expected string
+	}{
+		{src, 3, 5, "[3:5]"},
+		{a, 0, 16, "[8:16]"},
+		{bb, 0, 56, "[8:24 64:32]"},
+		{bb, 20, 8, "[28:4 64:4]"},
+		{subBb, 0, 40, "[12:20 64:20]"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.expected, func(t *testing.T) {
+			rs, ok := tC.bb.SourceRanges(src, tC.start, tC.len)
+			if !ok {
+				t.Fatal("expected ok")
+			}
+			actual := fmt.Sprintf("%v", rs)
+			if tC.expected != actual {
+				t.Errorf("expected %s, got %s", tC.expected, actual)
+			}
+		})
+	}
+
+	other := bitio.NewBufferFromBytes(make([]byte, 16), -1)
+	if _, ok := bb.SourceRanges(other, 0, 8); ok {
+		t.Error("expected not ok for other buffer")
+	}
+}
@@ -0,0 +1,268 @@
+// Package bmpimage decodes uncompressed BMP images and registers itself with
+// the image package
+package bmpimage
+
+// http://www.ece.ualberta.ca/~elliott/ee552/studentAppNotes/2003_w/misc/bmp_file_format/bmp_file_format.htm
+// https://docs.microsoft.com/en-us/windows/win32/gdi/bitmap-header-types
+
+// TODO: RLE4 and RLE8 compression
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"math/bits"
+)
+
+var ErrUnsupported = errors.New("unsupported bmp")
+
+func init() {
+	image.RegisterFormat("bmp", "BM", Decode, DecodeConfig)
+}
+
+const (
+	compressionRGB       = 0
+	compressionBitfields = 3
+	compressionAlpha     = 6
+)
+
+const (
+	fileHeaderSize = 14
+	coreHeaderSize = 12
+	infoHeaderSize = 40
+)
+
+type header struct {
+	width        int
+	height       int
+	topDown      bool
+	bitsPerPixel int
+	compression  uint32
+	masks        [4]uint32 // r, g, b, a
+	palette      color.Palette
+	dataOffset   int
+}
+
+func readHeader(b []byte) (header, error) {
+	var h header
+	le := binary.LittleEndian
+
+	if len(b) < fileHeaderSize+4 || string(b[0:2]) != "BM" {
+		return h, fmt.Errorf("%w: not a bmp", ErrUnsupported)
+	}
+	h.dataOffset = int(le.Uint32(b[10:]))
+	dib := b[fileHeaderSize:]
+	dibSize := int(le.Uint32(dib))
+	if len(dib) < dibSize {
+		return h, io.ErrUnexpectedEOF
+	}
+
+	paletteEntrySize := 4
+	paletteColors := 0
+	switch {
+	case dibSize == coreHeaderSize:
+		h.width = int(le.Uint16(dib[4:]))
+		h.height = int(le.Uint16(dib[6:]))
+		h.bitsPerPixel = int(le.Uint16(dib[10:]))
+		paletteEntrySize = 3
+	case dibSize >= infoHeaderSize:
+		h.width = int(int32(le.Uint32(dib[4:])))
+		h.height = int(int32(le.Uint32(dib[8:])))
+		h.bitsPerPixel = int(le.Uint16(dib[14:]))
+		h.compression = le.Uint32(dib[16:])
+		paletteColors = int(le.Uint32(dib[32:]))
+	default:
+		return h, fmt.Errorf("%w: header size %d", ErrUnsupported, dibSize)
+	}
+	if h.height < 0 {
+		h.height = -h.height
+		h.topDown = true
+	}
+	if h.width <= 0 || h.height <= 0 {
+		return h, fmt.Errorf("%w: dimensions %dx%d", ErrUnsupported, h.width, h.height)
+	}
+
+	switch h.compression {
+	case compressionRGB:
+		switch h.bitsPerPixel {
+		case 16:
+			h.masks = [4]uint32{0x7c00, 0x03e0, 0x001f, 0}
+		case 24, 32:
+			h.masks = [4]uint32{0xff0000, 0x00ff00, 0x0000ff, 0}
+		}
+	case compressionBitfields, compressionAlpha:
+		if h.bitsPerPixel != 16 && h.bitsPerPixel != 32 {
+			return h, fmt.Errorf("%w: bitfields with %d bits per pixel", ErrUnsupported, h.bitsPerPixel)
+		}
+		// masks are part of v2+ headers or directly after info header
+		n := 3
+		if h.compression == compressionAlpha || dibSize >= infoHeaderSize+16 {
+			n = 4
+		}
+		mb := dib[infoHeaderSize:]
+		if len(mb) < n*4 {
+			return h, io.ErrUnexpectedEOF
+		}
+		for i := 0; i < n; i++ {
+			h.masks[i] = le.Uint32(mb[i*4:])
+		}
+		if dibSize == infoHeaderSize {
+			dibSize += n * 4
+		}
+	default:
+		return h, fmt.Errorf("%w: compression %d", ErrUnsupported, h.compression)
+	}
+
+	switch h.bitsPerPixel {
+	case 1, 2, 4, 8:
+		if paletteColors == 0 {
+			paletteColors = 1 << h.bitsPerPixel
+			// some encoders write a shorter palette than implied by bits per pixel
+			if n := (h.dataOffset - fileHeaderSize - dibSize) / paletteEntrySize; n > 0 && n < paletteColors {
+				paletteColors = n
+			}
+		}
+		pb := dib[dibSize:]
+		if len(pb) < paletteColors*paletteEntrySize {
+			return h, io.ErrUnexpectedEOF
+		}
+		for i := 0; i < paletteColors; i++ {
+			e := pb[i*paletteEntrySize:]
+			h.palette = append(h.palette, color.RGBA{R: e[2], G: e[1], B: e[0], A: 0xff})
+		}
+	case 16, 24, 32:
+	default:
+		return h, fmt.Errorf("%w: %d bits per pixel", ErrUnsupported, h.bitsPerPixel)
+	}
+
+	return h, nil
+}
+
+// scale masked value to 8 bits
+func maskValue(v uint32, mask uint32) uint8 {
+	if mask == 0 {
+		return 0
+	}
+	shift := bits.TrailingZeros32(mask)
+	n := bits.OnesCount32(mask)
+	x := (v & mask) >> shift
+	if n >= 8 {
+		return uint8(x >> (n - 8))
+	}
+	return uint8(x * 0xff / (1<<n - 1))
+}
+
+func (h header) colorModel() color.Model {
+	if h.palette != nil {
+		return h.palette
+	}
+	return color.NRGBAModel
+}
+
+// DecodeConfig returns color model and dimensions of a BMP image
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	// file header, largest info header and 256 entry palette
+	b := make([]byte, fileHeaderSize+124+256*4)
+	n, err := io.ReadFull(r, b)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return image.Config{}, err
+	}
+	h, err := readHeader(b[:n])
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: h.colorModel(), Width: h.width, Height: h.height}, nil
+}
+
+// Decode reads a BMP image, paletted images are decoded as *image.Paletted and
+// others as *image.NRGBA
+func Decode(r io.Reader) (image.Image, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	h, err := readHeader(b)
+	if err != nil {
+		return nil, err
+	}
+
+	stride := ((h.width*h.bitsPerPixel + 31) / 32) * 4
+	if h.dataOffset < 0 || h.dataOffset+stride*h.height > len(b) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	data := b[h.dataOffset:]
+	rect := image.Rect(0, 0, h.width, h.height)
+
+	// alpha mask for 32 bit images without bitfields are usually unused,
+	// treat all zero alpha as opaque
+	hasAlpha := h.masks[3] != 0
+	if hasAlpha {
+		hasAlpha = false
+		for y := 0; y < h.height && !hasAlpha; y++ {
+			row := data[y*stride:]
+			for x := 0; x < h.width; x++ {
+				if binary.LittleEndian.Uint32(row[x*4:])&h.masks[3] != 0 {
+					hasAlpha = true
+					break
+				}
+			}
+		}
+	}
+
+	var pimg *image.Paletted
+	var nimg *image.NRGBA
+	if h.palette != nil {
+		pimg = image.NewPaletted(rect, h.palette)
+	} else {
+		nimg = image.NewNRGBA(rect)
+	}
+
+	for y := 0; y < h.height; y++ {
+		row := data[y*stride : (y+1)*stride]
+		dy := h.height - 1 - y
+		if h.topDown {
+			dy = y
+		}
+		for x := 0; x < h.width; x++ {
+			switch h.bitsPerPixel {
+			case 1, 2, 4, 8:
+				bitPos := x * h.bitsPerPixel
+				shift := 8 - h.bitsPerPixel - bitPos%8
+				idx := (row[bitPos/8] >> shift) & (1<<h.bitsPerPixel - 1)
+				if int(idx) >= len(h.palette) {
+					return nil, fmt.Errorf("palette index %d out of range", idx)
+				}
+				pimg.SetColorIndex(x, dy, idx)
+			case 24:
+				p := row[x*3:]
+				nimg.SetNRGBA(x, dy, color.NRGBA{R: p[2], G: p[1], B: p[0], A: 0xff})
+			case 16, 32:
+				var v uint32
+				if h.bitsPerPixel == 16 {
+					v = uint32(binary.LittleEndian.Uint16(row[x*2:]))
+				} else {
+					v = binary.LittleEndian.Uint32(row[x*4:])
+				}
+				c := color.NRGBA{
+					R: maskValue(v, h.masks[0]),
+					G: maskValue(v, h.masks[1]),
+					B: maskValue(v, h.masks[2]),
+					A: 0xff,
+				}
+				if hasAlpha {
+					c.A = maskValue(v, h.masks[3])
+				}
+				nimg.SetNRGBA(x, dy, c)
+			}
+		}
+	}
+
+	if pimg != nil {
+		return pimg, nil
+	}
+	return nimg, nil
+}
@@ -0,0 +1,133 @@
+package bmpimage_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/wader/fq/pkg/bmpimage"
+)
+
+// 2x2 image with info header, optional masks and palette
+func makeBMP(bitsPerPixel int, height int, compression uint32, extra []byte, rows [][]byte) []byte {
+	var data []byte
+	for _, r := range rows {
+		data = append(data, r...)
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+	b := &bytes.Buffer{}
+	le := binary.LittleEndian
+	dataOffset := uint32(14 + 40 + len(extra))
+	b.WriteString("BM")
+	_ = binary.Write(b, le, []uint32{dataOffset + uint32(len(data)), 0, dataOffset})
+	_ = binary.Write(b, le, struct {
+		Size          uint32
+		Width, Height int32
+		Planes, BPP   uint16
+		Compression   uint32
+		SizeImage     uint32
+		XPPM, YPPM    int32
+		Used, Import  uint32
+	}{40, 2, int32(height), 1, uint16(bitsPerPixel), compression, uint32(len(data)), 0, 0, 0, 0})
+	b.Write(extra)
+	b.Write(data)
+	return b.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	red := color.NRGBA{R: 0xff, A: 0xff}
+	green := color.NRGBA{G: 0xff, A: 0xff}
+	blue := color.NRGBA{B: 0xff, A: 0xff}
+	white := color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	halfRed := color.NRGBA{R: 0xff, A: 0x80}
+
+	le32 := func(vs ...uint32) []byte {
+		b := make([]byte, len(vs)*4)
+		for i, v := range vs {
+			binary.LittleEndian.PutUint32(b[i*4:], v)
+		}
+		return b
+	}
+
+	testCases := []struct {
+		name     string
+		bmp      []byte
+		expected [2][2]color.NRGBA // top row first
+	}{
+		{
+			name: "24 bit bottom-up",
+			bmp: makeBMP(24, 2, 0, nil, [][]byte{
+				{0, 0, 0xff, 0, 0xff, 0},
+				{0xff, 0, 0, 0xff, 0xff, 0xff},
+			}),
+			expected: [2][2]color.NRGBA{{blue, white}, {red, green}},
+		},
+		{
+			name: "24 bit top-down",
+			bmp: makeBMP(24, -2, 0, nil, [][]byte{
+				{0, 0, 0xff, 0, 0xff, 0},
+				{0xff, 0, 0, 0xff, 0xff, 0xff},
+			}),
+			expected: [2][2]color.NRGBA{{red, green}, {blue, white}},
+		},
+		{
+			name: "32 bit bitfields with alpha",
+			bmp: makeBMP(32, -2, 6, le32(0x00ff0000, 0x0000ff00, 0x000000ff, 0xff000000), [][]byte{
+				le32(0x80ff0000, 0xff00ff00),
+				le32(0xff0000ff, 0xffffffff),
+			}),
+			expected: [2][2]color.NRGBA{{halfRed, green}, {blue, white}},
+		},
+		{
+			name: "16 bit 555",
+			bmp: makeBMP(16, -2, 0, nil, [][]byte{
+				{0x00, 0x7c, 0xe0, 0x03},
+				{0x1f, 0x00, 0xff, 0x7f},
+			}),
+			expected: [2][2]color.NRGBA{{red, green}, {blue, white}},
+		},
+		{
+			name: "4 bit palette",
+			bmp: makeBMP(4, -2, 0, le32(0x00ff0000, 0x0000ff00, 0x000000ff, 0x00ffffff), [][]byte{
+				{0x21},
+				{0x03},
+			}),
+			expected: [2][2]color.NRGBA{{blue, green}, {red, white}},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			img, err := bmpimage.Decode(bytes.NewReader(tc.bmp))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.Bounds() != image.Rect(0, 0, 2, 2) {
+				t.Fatalf("expected 2x2 got %v", img.Bounds())
+			}
+			for y := 0; y < 2; y++ {
+				for x := 0; x < 2; x++ {
+					actual := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+					if actual != tc.expected[y][x] {
+						t.Errorf("%d,%d: expected %v got %v", x, y, tc.expected[y][x], actual)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeConfig(t *testing.T) {
+	bmp := makeBMP(24, 2, 0, nil, [][]byte{make([]byte, 6), make([]byte, 6)})
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(bmp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "bmp" || cfg.Width != 2 || cfg.Height != 2 {
+		t.Errorf("unexpected %s %#v", format, cfg)
+	}
+}
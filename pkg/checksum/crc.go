@@ -78,3 +78,6 @@ func (c *CRC) Sum(b []byte) []byte {
 func (c *CRC) Reset()         { c.Current = 0 }
 func (c *CRC) Size() int      { return c.Bits / 8 }
 func (c *CRC) BlockSize() int { return c.Bits / 8 }
+
+// Sum64 returns current crc as an unsigned integer
+func (c *CRC) Sum64() uint64 { return uint64(c.Current) }
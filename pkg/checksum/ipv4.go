@@ -37,3 +37,9 @@ func (c *IPv4) Sum(b []byte) []byte {
 func (c *IPv4) Reset()         { c.sum = 0 }
 func (c *IPv4) Size() int      { return 2 }
 func (c *IPv4) BlockSize() int { return 2 }
+
+// Sum64 returns checksum as an unsigned integer
+func (c *IPv4) Sum64() uint64 {
+	b := c.Sum(nil)
+	return uint64(b[0])<<8 | uint64(b[1])
+}
@@ -9,6 +9,7 @@ import (
 	"io/fs"
 	"log"
 	"os"
+	"os/exec"
 	"os/signal"
 	"path/filepath"
 
@@ -37,6 +38,7 @@ type stdOS struct {
 	rl            *readline.Instance
 	closeChan     chan struct{}
 	interruptChan chan struct{}
+	tempDir       string
 }
 
 func newStandardOS() *stdOS {
@@ -148,8 +150,47 @@ type stdOSFS struct{}
 
 func (stdOSFS) Open(name string) (fs.File, error) { return os.Open(name) }
 
+func (stdOSFS) RealPath(name string) (string, error) {
+	p, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+	// symlinks can only be resolved if the file exists
+	if ep, err := filepath.EvalSymlinks(p); err == nil {
+		p = ep
+	}
+	return p, nil
+}
+
 func (*stdOS) FS() fs.FS { return stdOSFS{} }
 
+func (*stdOS) MkdirAll(path string) error { return os.MkdirAll(path, 0755) }
+
+func (*stdOS) Create(name string) (io.WriteCloser, error) { return os.Create(name) }
+
+func (o *stdOS) TempFile() (string, io.WriteCloser, error) {
+	if o.tempDir == "" {
+		d, err := os.MkdirTemp("", "fq-")
+		if err != nil {
+			return "", nil, err
+		}
+		o.tempDir = d
+	}
+	f, err := os.CreateTemp(o.tempDir, "tmp-")
+	if err != nil {
+		return "", nil, err
+	}
+	return f.Name(), f, nil
+}
+
+func (*stdOS) Exec(ctx context.Context, name string, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
 func (o *stdOS) Readline(prompt string, complete func(line string, pos int) (newLine []string, shared int)) (string, error) {
 	if o.rl == nil {
 		var err error
@@ -221,6 +262,9 @@ func (o *stdOS) Close() error {
 		o.rl.Close()
 	}
 	close(o.closeChan)
+	if o.tempDir != "" {
+		return os.RemoveAll(o.tempDir)
+	}
 	return nil
 }
 
@@ -0,0 +1,90 @@
+package decode
+
+import (
+	"bytes"
+
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+// Checksum is an expected checksum read from input and the checksum computed
+// from the data it covers. Unsigned integer checksums are stored as big endian bytes.
+type Checksum struct {
+	Algorithm string // ex crc32, adler32, md5
+	Expected  []byte
+	Computed  []byte
+}
+
+func (c *Checksum) Valid() bool { return bytes.Equal(c.Expected, c.Computed) }
+
+func uBytes(u uint64, nBits int64) []byte {
+	b := make([]byte, (nBits+7)/8)
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = byte(u)
+		u >>= 8
+	}
+	return b
+}
+
+func (d *D) lastChild() *Value {
+	c, ok := d.Value.V.(*Compound)
+	if !ok || len(c.Children) == 0 {
+		panic("no field added")
+	}
+	return c.Children[len(c.Children)-1]
+}
+
+// ValueChecksumU validates an already added unsigned integer field against computed and
+// registers it as a checksum, useful when the checksum is read before the data it covers.
+// Values that are not unsigned integer scalars are skipped.
+func (d *D) ValueChecksumU(v *Value, algorithm string, computed uint64) {
+	s, ok := v.V.(*scalar.S)
+	if !ok {
+		return
+	}
+	expected, ok := s.Actual.(uint64)
+	if !ok {
+		return
+	}
+	_ = v.TryScalarFn(d.ValidateU(computed))
+	v.Checksum = &Checksum{
+		Algorithm: algorithm,
+		Expected:  uBytes(expected, v.Range.Len),
+		Computed:  uBytes(computed, v.Range.Len),
+	}
+}
+
+// ValueChecksumRaw validates an already added raw field against computed and registers it as a checksum.
+// Values that are not raw scalars are skipped.
+func (d *D) ValueChecksumRaw(v *Value, algorithm string, computed []byte) {
+	s, ok := v.V.(*scalar.S)
+	if !ok {
+		return
+	}
+	bb, ok := s.Actual.(*bitio.Buffer)
+	if !ok {
+		return
+	}
+	_ = v.TryScalarFn(d.ValidateBitBuf(computed))
+	expected, _ := bb.Bytes()
+	v.Checksum = &Checksum{
+		Algorithm: algorithm,
+		Expected:  expected,
+		Computed:  computed,
+	}
+}
+
+// FieldChecksumU adds a nBits unsigned integer field in current endian with an expected
+// checksum and validates it against computed
+func (d *D) FieldChecksumU(name string, nBits int, algorithm string, computed uint64, sms ...scalar.Mapper) uint64 {
+	u := d.FieldU(name, nBits, sms...)
+	d.ValueChecksumU(d.lastChild(), algorithm, computed)
+	return u
+}
+
+// FieldChecksumRawLen adds a raw field with an expected checksum, ex md5 or sha1 digest,
+// and validates it against computed
+func (d *D) FieldChecksumRawLen(name string, nBits int64, algorithm string, computed []byte, sms ...scalar.Mapper) {
+	d.FieldRawLen(name, nBits, sms...)
+	d.ValueChecksumRaw(d.lastChild(), algorithm, computed)
+}
@@ -0,0 +1,171 @@
+package decode
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+// DiffError describes the first difference found by Compare
+type DiffError struct {
+	Path   string
+	Reason string
+}
+
+func (e DiffError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Reason)
+}
+
+// Compare returns a DiffError for the first difference between two decode trees
+// or nil if they are identical. Used to find decoders that are nondeterministic,
+// ex keep state that is shared between decodes.
+func Compare(a, b *Value) error {
+	return compareValue(".", a, b)
+}
+
+func compareBitBuf(a, b *bitio.Buffer) (bool, error) {
+	if a.Len() != b.Len() {
+		return false, nil
+	}
+	ab, err := a.Bytes()
+	if err != nil {
+		return false, err
+	}
+	bb, err := b.Bytes()
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(ab, bb), nil
+}
+
+func compareScalar(a, b scalar.S) (string, error) {
+	if abb, ok := a.Actual.(*bitio.Buffer); ok {
+		bbb, ok := b.Actual.(*bitio.Buffer)
+		if !ok {
+			return fmt.Sprintf("actual %T != %T", a.Actual, b.Actual), nil
+		}
+		equal, err := compareBitBuf(abb, bbb)
+		if err != nil {
+			return "", err
+		}
+		if !equal {
+			return "actual buffers differ", nil
+		}
+	} else if !reflect.DeepEqual(a.Actual, b.Actual) {
+		return fmt.Sprintf("actual %v != %v", a.Actual, b.Actual), nil
+	}
+
+	switch {
+	case !reflect.DeepEqual(a.Sym, b.Sym):
+		return fmt.Sprintf("sym %v != %v", a.Sym, b.Sym), nil
+	case a.Description != b.Description:
+		return fmt.Sprintf("description %q != %q", a.Description, b.Description), nil
+	case a.ActualDisplay != b.ActualDisplay, a.SymDisplay != b.SymDisplay:
+		return "display format differ", nil
+	case a.Unknown != b.Unknown:
+		return fmt.Sprintf("unknown %t != %t", a.Unknown, b.Unknown), nil
+	}
+
+	return "", nil
+}
+
+func compareCompound(path string, a, b *Compound) error {
+	diff := func(format string, args ...interface{}) error {
+		return DiffError{Path: path, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	formatName := func(c *Compound) string {
+		if c.Format == nil {
+			return ""
+		}
+		return c.Format.Name
+	}
+	errString := func(c *Compound) string {
+		if c.Err == nil {
+			return ""
+		}
+		return c.Err.Error()
+	}
+
+	switch {
+	case a.IsArray != b.IsArray:
+		return diff("is array %t != %t", a.IsArray, b.IsArray)
+	case a.Description != b.Description:
+		return diff("description %q != %q", a.Description, b.Description)
+	case formatName(a) != formatName(b):
+		return diff("format %q != %q", formatName(a), formatName(b))
+	case errString(a) != errString(b):
+		return diff("error %q != %q", errString(a), errString(b))
+	case len(a.Children) != len(b.Children):
+		return diff("%d children != %d", len(a.Children), len(b.Children))
+	}
+
+	for i, ac := range a.Children {
+		var childPath string
+		if a.IsArray {
+			childPath = path + "[" + strconv.Itoa(i) + "]"
+		} else if path == "." {
+			childPath = "." + ac.Name
+		} else {
+			childPath = path + "." + ac.Name
+		}
+		if err := compareValue(childPath, ac, b.Children[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func compareValue(path string, a, b *Value) error {
+	diff := func(format string, args ...interface{}) error {
+		return DiffError{Path: path, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	switch {
+	case a.Name != b.Name:
+		return diff("name %q != %q", a.Name, b.Name)
+	case a.Range != b.Range:
+		return diff("range %s != %s", a.Range, b.Range)
+	case a.IsRoot != b.IsRoot:
+		return diff("is root %t != %t", a.IsRoot, b.IsRoot)
+	}
+
+	if a.IsRoot {
+		equal, err := compareBitBuf(a.RootBitBuf, b.RootBitBuf)
+		if err != nil {
+			return err
+		}
+		if !equal {
+			return diff("root buffers differ")
+		}
+	}
+
+	switch av := a.V.(type) {
+	case *Compound:
+		bv, ok := b.V.(*Compound)
+		if !ok {
+			return diff("type %T != %T", a.V, b.V)
+		}
+		return compareCompound(path, av, bv)
+	case *scalar.S:
+		bv, ok := b.V.(*scalar.S)
+		if !ok {
+			return diff("type %T != %T", a.V, b.V)
+		}
+		reason, err := compareScalar(*av, *bv)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			return diff("%s", reason)
+		}
+		return nil
+	default:
+		return diff("unknown value type %T", a.V)
+	}
+}
@@ -0,0 +1,51 @@
+package decode_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+)
+
+func TestCompare(t *testing.T) {
+	// keeps state between decodes, second decode gets a different count
+	decodeCount := uint64(0)
+	statefulFormat := decode.Format{
+		Name: "stateful",
+		DecodeFn: func(d *decode.D, in interface{}) interface{} {
+			d.FieldU8("a")
+			d.FieldStruct("b", func(d *decode.D) {
+				d.FieldU8("c")
+				decodeCount++
+				d.FieldValueU("count", decodeCount)
+			})
+			return nil
+		},
+	}
+
+	decodeFn := func() *decode.Value {
+		bb := bitio.NewBufferFromBytes([]byte{1, 2}, -1)
+		dv, _, err := decode.Decode(context.Background(), bb, decode.Group{statefulFormat}, decode.Options{})
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return dv
+	}
+
+	dv1 := decodeFn()
+	if err := decode.Compare(dv1, dv1); err != nil {
+		t.Errorf("expected same value to be equal, got %v", err)
+	}
+
+	dv2 := decodeFn()
+	err := decode.Compare(dv1, dv2)
+	var diffErr decode.DiffError
+	if !errors.As(err, &diffErr) {
+		t.Fatalf("expected DiffError, got %v", err)
+	}
+	if diffErr.Path != ".b.count" || diffErr.Reason != "actual 1 != 2" {
+		t.Errorf("expected difference at .b.count actual 1 != 2, got %s", diffErr)
+	}
+}
@@ -3,12 +3,14 @@ package decode
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 
 	"github.com/wader/fq/internal/recoverfn"
 	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/logger"
 	"github.com/wader/fq/pkg/ranges"
 	"github.com/wader/fq/pkg/scalar"
 )
@@ -34,11 +36,22 @@ type Options struct {
 	FormatOptions map[string]interface{}
 	FormatInArg   interface{}
 	ReadBuf       *[]byte
+	Dedup         *Dedup
+	// names of formats to skip, also applies to sub decoders
+	ExcludeFormats map[string]bool
+	Stats          *Stats
+	Logger         *logger.Logger
+	// targeted decode, only applies to root decoder, see PathMatcher
+	Path []PathElem
 }
 
 // Decode try decode group and return first success and all other decoder errors
 func Decode(ctx context.Context, bb *bitio.Buffer, group Group, opts Options) (*Value, interface{}, error) {
-	return decode(ctx, bb, group, opts)
+	dv, v, err := decode(ctx, bb, group, opts)
+	if dv != nil {
+		opts.Dedup.Annotate(dv)
+	}
+	return dv, v, err
 }
 
 func decode(ctx context.Context, bb *bitio.Buffer, group Group, opts Options) (*Value, interface{}, error) {
@@ -53,7 +66,34 @@ func decode(ctx context.Context, bb *bitio.Buffer, group Group, opts Options) (*
 
 	formatsErr := FormatsError{}
 
-	for _, g := range group {
+	formats := group
+	// in arg can change how a format is decoded so only use magic when probing
+	if len(group) > 1 && !opts.Force && opts.FormatInArg == nil {
+		var magicErrs []FormatError
+		var err error
+		formats, magicErrs, err = magicOrder(bb, decodeRange, group)
+		if err != nil {
+			return nil, nil, err
+		}
+		formatsErr.Errs = append(formatsErr.Errs, magicErrs...)
+	}
+
+	for _, g := range formats {
+		if opts.ExcludeFormats[g.Name] {
+			formatsErr.Errs = append(formatsErr.Errs, FormatError{
+				Err:    errors.New("format excluded"),
+				Format: g,
+			})
+			continue
+		}
+		if len(opts.Path) > 0 && !g.SupportsPath {
+			formatsErr.Errs = append(formatsErr.Errs, FormatError{
+				Err:    errors.New("decode path not supported"),
+				Format: g,
+			})
+			continue
+		}
+
 		cbb, err := bb.BitBufRange(decodeRange.Start, decodeRange.Len)
 		if err != nil {
 			return nil, nil, IOError{Err: err, Op: "BitBufRange", ReadSize: decodeRange.Len, Pos: decodeRange.Start}
@@ -61,6 +101,24 @@ func decode(ctx context.Context, bb *bitio.Buffer, group Group, opts Options) (*
 
 		d := newDecoder(ctx, g, cbb, opts)
 
+		// other panics than decode errors, ex runtime errors, are bugs in the decoder.
+		// Turn them into errors so that one broken decoder does not stop everything.
+		panicErr := func(r recoverfn.Raw) PanicError {
+			pos, _ := d.bitBuf.Pos()
+			return PanicError{Format: g.Name, Pos: pos, Value: r.RecoverV}
+		}
+		addFormatErr := func(err error, r recoverfn.Raw) FormatError {
+			opts.Stats.add(g.Name, err)
+			opts.Logger.Debug("decode failed", "format", g.Name, "error", err)
+			formatErr := FormatError{
+				Err:        err,
+				Format:     g,
+				Stacktrace: r,
+			}
+			formatsErr.Errs = append(formatsErr.Errs, formatErr)
+			return formatErr
+		}
+
 		var decodeV interface{}
 		r, rOk := recoverfn.Run(func() {
 			decodeV = g.DecodeFn(d, opts.FormatInArg)
@@ -70,50 +128,87 @@ func decode(ctx context.Context, bb *bitio.Buffer, group Group, opts Options) (*
 			return nil, nil, ctx.Err()
 		}
 
+		decodeOk := rOk
 		if !rOk {
+			var decodeErr error
 			if re, ok := r.RecoverV.(RecoverableErrorer); ok && re.IsRecoverableError() {
-				panicErr, _ := re.(error)
-				formatErr := FormatError{
-					Err:        panicErr,
-					Format:     g,
-					Stacktrace: r,
-				}
-				formatsErr.Errs = append(formatsErr.Errs, formatErr)
+				decodeErr, _ = re.(error)
+			} else {
+				decodeErr = panicErr(r)
+			}
+			formatErr := addFormatErr(decodeErr, r)
 
-				switch vv := d.Value.V.(type) {
-				case *Compound:
-					// TODO: hack, changes V
-					vv.Err = formatErr
-					d.Value.V = vv
-				}
+			switch vv := d.Value.V.(type) {
+			case *Compound:
+				// TODO: hack, changes V
+				vv.Err = formatErr
+				d.Value.V = vv
+			}
 
-				if len(group) != 1 {
-					continue
-				}
-			} else {
-				r.RePanic()
+			if len(group) != 1 {
+				continue
+			}
+			// partial tree is only useful for decode errors
+			if _, ok := decodeErr.(PanicError); ok { //nolint:errorlint
+				return nil, nil, formatsErr
 			}
 		}
 
-		// TODO: maybe move to Format* funcs?
-		if opts.FillGaps {
-			d.FillGaps(ranges.Range{Start: 0, Len: decodeRange.Len}, "unknown")
-		}
+		// post decode steps walk the value tree and read gaps so they can also fail
+		// because of a broken decoder, ex a value with a range outside of the buffer
+		var walkErr error
+		r, rOk = recoverfn.Run(func() {
+			// TODO: maybe move to Format* funcs?
+			if opts.FillGaps {
+				d.FillGaps(ranges.Range{Start: 0, Len: decodeRange.Len}, "unknown")
+			}
 
-		var minMaxRange ranges.Range
-		if err := d.Value.WalkRootPreOrder(func(v *Value, rootV *Value, depth int, rootDepth int) error {
-			minMaxRange = ranges.MinMax(minMaxRange, v.Range)
-			v.Range.Start += decodeRange.Start
-			v.RootBitBuf = bb
-			return nil
-		}); err != nil {
-			return nil, nil, err
-		}
+			var minMaxRange ranges.Range
+			if walkErr = d.Value.WalkRootPreOrder(func(v *Value, rootV *Value, depth int, rootDepth int) error {
+				minMaxRange = ranges.MinMax(minMaxRange, v.Range)
+				v.Range.Start += decodeRange.Start
+				v.RootBitBuf = bb
+				return nil
+			}); walkErr != nil {
+				return
+			}
 
-		d.Value.Range = ranges.Range{Start: decodeRange.Start, Len: minMaxRange.Len}
+			d.Value.Range = ranges.Range{Start: decodeRange.Start, Len: minMaxRange.Len}
 
-		if opts.IsRoot {
-			d.Value.postProcess()
+			if opts.IsRoot {
+				d.Value.postProcess()
+			}
+		})
+		if walkErr != nil {
+			return nil, nil, walkErr
+		}
+		if !rOk {
+			if decodeOk {
+				addFormatErr(panicErr(r), r)
+			} else {
+				// already counted as a failed decode
+				formatsErr.Errs = append(formatsErr.Errs, FormatError{Err: panicErr(r), Format: g, Stacktrace: r})
+			}
+			if len(group) != 1 {
+				continue
+			}
+			return nil, nil, formatsErr
+		}
+		if decodeOk {
+			opts.Stats.add(g.Name, nil)
+		}
+		if len(opts.Path) > 0 {
+			matched := 0
+			if d.pathState != nil {
+				matched = d.pathState.matched
+			}
+			if matched < len(opts.Path) {
+				opts.Logger.Warn("decode path did not match",
+					"format", g.Name,
+					"path", PathString(opts.Path),
+					"matched", PathString(opts.Path[0:matched]),
+				)
+			}
 		}
 
 		if len(formatsErr.Errs) > 0 {
@@ -134,7 +229,11 @@ type D struct {
 
 	bitBuf *bitio.Buffer
 
-	readBuf *[]byte
+	readBuf   *[]byte
+	dedup     *Dedup
+	stats     *Stats
+	logger    *logger.Logger
+	pathState *pathState
 }
 
 // TODO: new struct decoder?
@@ -165,6 +264,9 @@ func newDecoder(ctx context.Context, format Format, bb *bitio.Buffer, opts Optio
 
 		bitBuf:  bb,
 		readBuf: opts.ReadBuf,
+		dedup:   opts.Dedup,
+		stats:   opts.Stats,
+		logger:  opts.Logger.With("format", format.Name),
 	}
 }
 
@@ -180,11 +282,18 @@ func (d *D) FieldDecoder(name string, bitBuf *bitio.Buffer, v interface{}) *D {
 		},
 		Options: d.Options,
 
-		bitBuf:  bitBuf,
-		readBuf: d.readBuf,
+		bitBuf:    bitBuf,
+		readBuf:   d.readBuf,
+		dedup:     d.dedup,
+		stats:     d.stats,
+		logger:    d.logger,
+		pathState: d.pathState,
 	}
 }
 
+// Logger returns logger for decoder, messages include format name
+func (d *D) Logger() *logger.Logger { return d.logger }
+
 func (d *D) Copy(r io.Writer, w io.Reader) (int64, error) {
 	// TODO: what size? now same as io.Copy
 	buf := d.SharedReadBuf(32 * 1024)
@@ -683,12 +792,16 @@ func (d *D) RangeFn(firstBit int64, nBits int64, fn func(d *D)) {
 
 func (d *D) Format(group Group, inArg interface{}) interface{} {
 	dv, v, err := decode(d.Ctx, d.bitBuf, group, Options{
-		Force:       d.Options.Force,
-		FillGaps:    false,
-		IsRoot:      false,
-		Range:       ranges.Range{Start: d.Pos(), Len: d.BitsLeft()},
-		FormatInArg: inArg,
-		ReadBuf:     d.readBuf,
+		Force:          d.Options.Force,
+		FillGaps:       false,
+		IsRoot:         false,
+		Range:          ranges.Range{Start: d.Pos(), Len: d.BitsLeft()},
+		FormatInArg:    inArg,
+		ReadBuf:        d.readBuf,
+		Dedup:          d.dedup,
+		Stats:          d.stats,
+		Logger:         d.Options.Logger,
+		ExcludeFormats: d.Options.ExcludeFormats,
 	})
 	if dv == nil || dv.Errors() != nil {
 		d.IOPanic(err, "Format: decode")
@@ -712,13 +825,17 @@ func (d *D) Format(group Group, inArg interface{}) interface{} {
 
 func (d *D) TryFieldFormat(name string, group Group, inArg interface{}) (*Value, interface{}, error) {
 	dv, v, err := decode(d.Ctx, d.bitBuf, group, Options{
-		Name:        name,
-		Force:       d.Options.Force,
-		FillGaps:    false,
-		IsRoot:      false,
-		Range:       ranges.Range{Start: d.Pos(), Len: d.BitsLeft()},
-		FormatInArg: inArg,
-		ReadBuf:     d.readBuf,
+		Name:           name,
+		Force:          d.Options.Force,
+		FillGaps:       false,
+		IsRoot:         false,
+		Range:          ranges.Range{Start: d.Pos(), Len: d.BitsLeft()},
+		FormatInArg:    inArg,
+		ReadBuf:        d.readBuf,
+		Dedup:          d.dedup,
+		Stats:          d.stats,
+		Logger:         d.Options.Logger,
+		ExcludeFormats: d.Options.ExcludeFormats,
 	})
 	if dv == nil || dv.Errors() != nil {
 		return nil, nil, err
@@ -742,13 +859,17 @@ func (d *D) FieldFormat(name string, group Group, inArg interface{}) (*Value, in
 
 func (d *D) TryFieldFormatLen(name string, nBits int64, group Group, inArg interface{}) (*Value, interface{}, error) {
 	dv, v, err := decode(d.Ctx, d.bitBuf, group, Options{
-		Name:        name,
-		Force:       d.Options.Force,
-		FillGaps:    true,
-		IsRoot:      false,
-		Range:       ranges.Range{Start: d.Pos(), Len: nBits},
-		FormatInArg: inArg,
-		ReadBuf:     d.readBuf,
+		Name:           name,
+		Force:          d.Options.Force,
+		FillGaps:       true,
+		IsRoot:         false,
+		Range:          ranges.Range{Start: d.Pos(), Len: nBits},
+		FormatInArg:    inArg,
+		ReadBuf:        d.readBuf,
+		Dedup:          d.dedup,
+		Stats:          d.stats,
+		Logger:         d.Options.Logger,
+		ExcludeFormats: d.Options.ExcludeFormats,
 	})
 	if dv == nil || dv.Errors() != nil {
 		return nil, nil, err
@@ -773,13 +894,17 @@ func (d *D) FieldFormatLen(name string, nBits int64, group Group, inArg interfac
 // TODO: return decooder?
 func (d *D) TryFieldFormatRange(name string, firstBit int64, nBits int64, group Group, inArg interface{}) (*Value, interface{}, error) {
 	dv, v, err := decode(d.Ctx, d.bitBuf, group, Options{
-		Name:        name,
-		Force:       d.Options.Force,
-		FillGaps:    true,
-		IsRoot:      false,
-		Range:       ranges.Range{Start: firstBit, Len: nBits},
-		FormatInArg: inArg,
-		ReadBuf:     d.readBuf,
+		Name:           name,
+		Force:          d.Options.Force,
+		FillGaps:       true,
+		IsRoot:         false,
+		Range:          ranges.Range{Start: firstBit, Len: nBits},
+		FormatInArg:    inArg,
+		ReadBuf:        d.readBuf,
+		Dedup:          d.dedup,
+		Stats:          d.stats,
+		Logger:         d.Options.Logger,
+		ExcludeFormats: d.Options.ExcludeFormats,
 	})
 	if dv == nil || dv.Errors() != nil {
 		return nil, nil, err
@@ -800,13 +925,18 @@ func (d *D) FieldFormatRange(name string, firstBit int64, nBits int64, group Gro
 }
 
 func (d *D) TryFieldFormatBitBuf(name string, bb *bitio.Buffer, group Group, inArg interface{}) (*Value, interface{}, error) {
+	bb = d.dedup.bitBuf(d, bb)
 	dv, v, err := decode(d.Ctx, bb, group, Options{
-		Name:        name,
-		Force:       d.Options.Force,
-		FillGaps:    true,
-		IsRoot:      true,
-		FormatInArg: inArg,
-		ReadBuf:     d.readBuf,
+		Name:           name,
+		Force:          d.Options.Force,
+		FillGaps:       true,
+		IsRoot:         true,
+		FormatInArg:    inArg,
+		ReadBuf:        d.readBuf,
+		Dedup:          d.dedup,
+		Stats:          d.stats,
+		Logger:         d.Options.Logger,
+		ExcludeFormats: d.Options.ExcludeFormats,
 	})
 	if dv == nil || dv.Errors() != nil {
 		return nil, nil, err
@@ -830,6 +960,7 @@ func (d *D) FieldFormatBitBuf(name string, bb *bitio.Buffer, group Group, inArg
 
 // TODO: rethink this
 func (d *D) FieldRootBitBuf(name string, bb *bitio.Buffer) *Value {
+	bb = d.dedup.bitBuf(d, bb)
 	v := &Value{}
 	v.V = &scalar.S{Actual: bb}
 	v.Name = name
@@ -842,6 +973,7 @@ func (d *D) FieldRootBitBuf(name string, bb *bitio.Buffer) *Value {
 }
 
 func (d *D) FieldStructRootBitBufFn(name string, bb *bitio.Buffer, fn func(d *D)) *Value {
+	bb = d.dedup.bitBuf(d, bb)
 	cd := d.FieldDecoder(name, bb, &Compound{})
 	cd.Value.IsRoot = true
 	d.AddChild(cd.Value)
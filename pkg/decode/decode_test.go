@@ -0,0 +1,199 @@
+package decode_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/ranges"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func TestPanicIsolation(t *testing.T) {
+	panicFormat := decode.Format{
+		Name: "panic",
+		DecodeFn: func(d *decode.D, in interface{}) interface{} {
+			d.FieldU8("a")
+			var m map[string]int
+			m["b"] = 1
+			return nil
+		},
+	}
+	okFormat := decode.Format{
+		Name: "ok",
+		DecodeFn: func(d *decode.D, in interface{}) interface{} {
+			d.FieldU16("a")
+			return nil
+		},
+	}
+
+	stats := decode.NewStats()
+	bb := bitio.NewBufferFromBytes([]byte{1, 2}, -1)
+	dv, _, err := decode.Decode(context.Background(), bb, decode.Group{panicFormat, okFormat}, decode.Options{Stats: stats})
+	if dv == nil {
+		t.Fatalf("expected ok format to decode, got %v", err)
+	}
+
+	var fsErr decode.FormatsError
+	if !errors.As(err, &fsErr) || len(fsErr.Errs) != 1 {
+		t.Fatalf("expected one format error, got %v", err)
+	}
+	var panicErr decode.PanicError
+	if !errors.As(fsErr.Errs[0].Err, &panicErr) {
+		t.Fatalf("expected panic error, got %v", fsErr.Errs[0].Err)
+	}
+	if panicErr.Format != "panic" || panicErr.Pos != 8 {
+		t.Errorf("expected panic in format panic at bit 8, got %s at %d", panicErr.Format, panicErr.Pos)
+	}
+
+	expected := map[string]decode.FormatStats{
+		"panic": {Decodes: 1, Errors: 1, Panics: 1},
+		"ok":    {Decodes: 1},
+	}
+	for name, e := range expected {
+		if a := stats.Formats[name]; a == nil || *a != e {
+			t.Errorf("%s: expected %+v, got %+v", name, e, a)
+		}
+	}
+}
+
+func TestPanicIsolationPostDecode(t *testing.T) {
+	// decoder leaving a value outside of the buffer makes filling gaps fail
+	outOfRangeFormat := decode.Format{
+		Name: "out_of_range",
+		DecodeFn: func(d *decode.D, in interface{}) interface{} {
+			d.FieldU8("a")
+			d.AddChild(&decode.Value{Name: "b", V: &scalar.S{Actual: uint64(0)}, Range: ranges.Range{Start: 64, Len: 8}})
+			return nil
+		},
+	}
+	runtimePanicFormat := decode.Format{
+		Name: "runtime_panic",
+		DecodeFn: func(d *decode.D, in interface{}) interface{} {
+			d.FieldU8("a")
+			var s []int
+			_ = s[1]
+			return nil
+		},
+	}
+	okFormat := decode.Format{
+		Name: "ok",
+		DecodeFn: func(d *decode.D, in interface{}) interface{} {
+			d.FieldU16("a")
+			return nil
+		},
+	}
+
+	panicFormatErr := func(t *testing.T, err error, name string) {
+		t.Helper()
+		var fsErr decode.FormatsError
+		if !errors.As(err, &fsErr) || len(fsErr.Errs) != 1 {
+			t.Fatalf("expected one format error, got %v", err)
+		}
+		var panicErr decode.PanicError
+		if !errors.As(fsErr.Errs[0].Err, &panicErr) || panicErr.Format != name {
+			t.Fatalf("expected panic error in %s, got %v", name, fsErr.Errs[0].Err)
+		}
+	}
+
+	opts := decode.Options{FillGaps: true, IsRoot: true}
+
+	bb := bitio.NewBufferFromBytes([]byte{1, 2}, -1)
+	dv, _, err := decode.Decode(context.Background(), bb, decode.Group{outOfRangeFormat, okFormat}, opts)
+	if dv == nil {
+		t.Fatalf("expected ok format to decode, got %v", err)
+	}
+	panicFormatErr(t, err, "out_of_range")
+
+	for _, f := range []decode.Format{outOfRangeFormat, runtimePanicFormat} {
+		dv, _, err := decode.Decode(context.Background(), bb, decode.Group{f}, opts)
+		if dv != nil {
+			t.Errorf("%s: expected no value", f.Name)
+		}
+		panicFormatErr(t, err, f.Name)
+	}
+}
+
+func TestPathMatcher(t *testing.T) {
+	path, err := decode.ParsePath(".a.b[1].c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seen []string
+	format := decode.Format{
+		Name:         "test",
+		SupportsPath: true,
+		DecodeFn: func(d *decode.D, in interface{}) interface{} {
+			var walk func(m *decode.PathMatcher, prefix string, depth int)
+			walk = func(m *decode.PathMatcher, prefix string, depth int) {
+				if depth == 3 {
+					return
+				}
+				for _, name := range []string{"a", "b", "b", "c"} {
+					cm, ok := m.Match(name)
+					if !ok {
+						continue
+					}
+					seen = append(seen, prefix+"."+name)
+					if cm != nil {
+						walk(cm, prefix+"."+name, depth+1)
+					}
+				}
+			}
+			walk(d.PathMatcher(), "", 0)
+			d.FieldU8("a")
+			return nil
+		},
+	}
+
+	bb := bitio.NewBufferFromBytes([]byte{1}, -1)
+	if _, _, err := decode.Decode(context.Background(), bb, decode.Group{format}, decode.Options{Path: path}); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{".a", ".a.b", ".a.b.c"}
+	if len(seen) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, seen)
+	}
+	for i := range expected {
+		if seen[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, seen)
+		}
+	}
+
+	format.SupportsPath = false
+	if _, _, err := decode.Decode(context.Background(), bb, decode.Group{format}, decode.Options{Path: path}); err == nil {
+		t.Fatal("expected error for format not supporting path")
+	}
+
+	for _, s := range []string{"a", ".", ".a[", ".a[x]", ".a[-1]"} {
+		if _, err := decode.ParsePath(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestValueChecksumNonScalar(t *testing.T) {
+	format := decode.Format{
+		Name: "checksum",
+		DecodeFn: func(d *decode.D, in interface{}) interface{} {
+			d.FieldStruct("a", func(d *decode.D) { d.FieldU8("b") })
+			d.ValueChecksumU(d.FieldMustGet("a"), "crc8", 1)
+			d.FieldUTF8("c", 1)
+			d.ValueChecksumRaw(d.FieldMustGet("c"), "md5", []byte{1})
+			return nil
+		},
+	}
+
+	bb := bitio.NewBufferFromBytes([]byte{1, 'c'}, -1)
+	dv, _, err := decode.Decode(context.Background(), bb, decode.Group{format}, decode.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "c"} {
+		if v := dv.Child(name); v == nil || v.Checksum != nil {
+			t.Errorf("%s: expected no checksum", name)
+		}
+	}
+}
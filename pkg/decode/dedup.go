@@ -0,0 +1,115 @@
+package decode
+
+import (
+	"crypto/sha256"
+
+	"github.com/wader/fq/pkg/bitio"
+)
+
+type dedupKey struct {
+	sum    [sha256.Size]byte
+	bitLen int64
+}
+
+// Dedup makes root buffers with identical content created while decoding,
+// ex decompressed or reassembled data, share one backing buffer.
+// Shared between all nested decoders of one decode. Buffers are only hashed
+// when there is more than one buffer with the same length.
+type Dedup struct {
+	// first buffer for a length that has not been hashed yet, nil if
+	// all buffers with the length has been hashed
+	unhashed map[int64]*bitio.Buffer
+	first    map[dedupKey]*bitio.Buffer
+	keys     map[*bitio.Buffer]dedupKey
+}
+
+func NewDedup() *Dedup {
+	return &Dedup{
+		unhashed: map[int64]*bitio.Buffer{},
+		first:    map[dedupKey]*bitio.Buffer{},
+		keys:     map[*bitio.Buffer]dedupKey{},
+	}
+}
+
+func (dd *Dedup) key(d *D, bb *bitio.Buffer) (dedupKey, bool) {
+	h := sha256.New()
+	if _, err := d.Copy(h, bb.Clone()); err != nil {
+		return dedupKey{}, false
+	}
+	k := dedupKey{bitLen: bb.Len()}
+	copy(k.sum[:], h.Sum(nil))
+	return k, true
+}
+
+// bitBuf returns bb or a clone of a previous buffer with same content
+func (dd *Dedup) bitBuf(d *D, bb *bitio.Buffer) *bitio.Buffer {
+	if dd == nil {
+		return bb
+	}
+
+	l := bb.Len()
+	fbb, ok := dd.unhashed[l]
+	if !ok {
+		// first buffer with this length, can't be a duplicate
+		dd.unhashed[l] = bb
+		return bb
+	}
+	if fbb != nil {
+		// another buffer with same length, hash the first one now
+		dd.unhashed[l] = nil
+		if fk, ok := dd.key(d, fbb); ok {
+			dd.first[fk] = fbb
+			dd.keys[fbb] = fk
+		}
+	}
+
+	k, ok := dd.key(d, bb)
+	if !ok {
+		return bb
+	}
+
+	// buffer only reads from the buffer being decoded, ex reassembled from parts of it,
+	// keep it to not lose where it was read from
+	if _, ok := bb.SourceRanges(d.bitBuf, 0, bb.Len()); ok {
+		if _, ok := dd.first[k]; !ok {
+			dd.first[k] = bb
+		}
+		dd.keys[bb] = k
+		return bb
+	}
+
+	if fbb, ok := dd.first[k]; ok {
+		// clone as buffers have a read position
+		bb = fbb.Clone()
+	} else {
+		dd.first[k] = bb
+	}
+	dd.keys[bb] = k
+
+	return bb
+}
+
+// Annotate sets DupOf for root values that uses a buffer with same content as
+// a root value before it in pre-order
+func (dd *Dedup) Annotate(v *Value) {
+	if dd == nil {
+		return
+	}
+
+	seen := map[dedupKey]*Value{}
+	_ = v.WalkPreOrder(func(v *Value, rootV *Value, depth int, rootDepth int) error {
+		if !v.IsRoot {
+			return nil
+		}
+		k, ok := dd.keys[v.RootBitBuf]
+		if !ok {
+			return nil
+		}
+		if fv, ok := seen[k]; ok {
+			v.DupOf = fv
+		} else {
+			seen[k] = v
+		}
+		return nil
+	})
+}
@@ -88,3 +88,16 @@ func (e DecoderError) Error() string {
 }
 
 func (DecoderError) IsRecoverableError() bool { return true }
+
+// PanicError is a non-decode error panic in a decoder, ex a runtime error
+type PanicError struct {
+	Format string
+	Pos    int64
+	Value  interface{}
+}
+
+func (e PanicError) Error() string {
+	return fmt.Sprintf("%s: panic at position %s: %v", e.Format, num.Bits(e.Pos).StringByteBits(16), e.Value)
+}
+
+func (PanicError) IsRecoverableError() bool { return true }
@@ -1,6 +1,14 @@
 package decode
 
-import "io/fs"
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/ranges"
+)
 
 type Group []Format
 
@@ -10,8 +18,11 @@ type Dependency struct {
 }
 
 type Format struct {
-	Name         string
-	ProbeOrder   int // probe order is from low to hi value then by name
+	Name       string
+	ProbeOrder int // probe order is from low to hi value then by name
+	// Magic signatures, when probing formats with a matching magic are tried first
+	// and formats with magic that don't match are skipped
+	Magic        []Magic
 	Description  string
 	Groups       []string
 	DecodeFn     func(d *D, in interface{}) interface{}
@@ -19,6 +30,53 @@ type Format struct {
 	RootName     string
 	Dependencies []Dependency
 	Files        fs.ReadDirFS
+	// EmbeddedFiles enumerates files stored in a decoded format root value, ex
+	// archive members, used by embedded_files, extract_all, probe_files and display
+	EmbeddedFiles func(v *Value) ([]EmbeddedFile, error)
+	// SupportsPath is true if decoder uses PathMatcher for targeted decode, see Options.Path
+	SupportsPath bool
+}
+
+// MaxEmbeddedFileSize limits how much is decompressed for embedded files with unknown size
+const MaxEmbeddedFileSize = 1 << 30
+
+// EmbeddedFile is a file stored inside a format. Range is the stored data in
+// the buffer of the format root value and Decompress, if not nil, is used to
+// read file data from stored data. Size, if not zero, is the file size according
+// to the format and limits how much is decompressed.
+type EmbeddedFile struct {
+	Name       string
+	Dir        bool
+	Range      ranges.Range
+	Size       int64
+	Decompress func(r io.Reader) (io.Reader, error)
+}
+
+// BitBuf returns file data from root buffer bb, decompressed if needed
+func (ef EmbeddedFile) BitBuf(bb *bitio.Buffer) (*bitio.Buffer, error) {
+	sbb, err := bb.BitBufRange(ef.Range.Start, ef.Range.Len)
+	if err != nil {
+		return nil, err
+	}
+	if ef.Decompress == nil {
+		return sbb, nil
+	}
+	r, err := ef.Decompress(sbb)
+	if err != nil {
+		return nil, err
+	}
+	limit := int64(MaxEmbeddedFileSize)
+	if ef.Size > 0 {
+		limit = ef.Size
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > limit {
+		return nil, fmt.Errorf("decompressed size larger than %d bytes", limit)
+	}
+	return bitio.NewBufferFromBytes(b, -1), nil
 }
 
 func FormatFn(d func(d *D, in interface{}) interface{}) Group {
@@ -0,0 +1,92 @@
+package decode
+
+import (
+	"errors"
+
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/ranges"
+)
+
+// Magic is a signature at a byte offset from start of input used to skip formats
+// when probing. If Mask is not nil input bytes are and:ed with it before compare
+// and it should be same length as Bytes.
+type Magic struct {
+	Offset int64
+	Bytes  []byte
+	Mask   []byte
+}
+
+func (m Magic) end() int64 { return m.Offset + int64(len(m.Bytes)) }
+
+func (m Magic) match(b []byte) bool {
+	if m.end() > int64(len(b)) {
+		return false
+	}
+	for i, v := range m.Bytes {
+		c := b[m.Offset+int64(i)]
+		if m.Mask != nil {
+			c &= m.Mask[i]
+		}
+		if c != v {
+			return false
+		}
+	}
+	return true
+}
+
+var errNoMagicMatch = errors.New("no magic match")
+
+// magicOrder returns formats in group with a matching magic first and then formats
+// without magic, each in group order. Formats with magic that don't match are
+// returned as errors.
+func magicOrder(bb *bitio.Buffer, r ranges.Range, group Group) (Group, []FormatError, error) {
+	var maxEnd int64
+	for _, f := range group {
+		for _, m := range f.Magic {
+			if e := m.end(); e > maxEnd {
+				maxEnd = e
+			}
+		}
+	}
+	if maxEnd == 0 {
+		return group, nil, nil
+	}
+
+	// read prefix once for all formats
+	nBytes := maxEnd
+	if r.Len/8 < nBytes {
+		nBytes = r.Len / 8
+	}
+	pbb, err := bb.BitBufRange(r.Start, nBytes*8)
+	if err != nil {
+		return nil, nil, IOError{Err: err, Op: "BitBufRange", ReadSize: nBytes * 8, Pos: r.Start}
+	}
+	prefix, err := pbb.Bytes()
+	if err != nil {
+		return nil, nil, IOError{Err: err, Op: "Bytes", ReadSize: nBytes * 8, Pos: r.Start}
+	}
+
+	var matched Group
+	var noMagic Group
+	var errs []FormatError
+	for _, f := range group {
+		if len(f.Magic) == 0 {
+			noMagic = append(noMagic, f)
+			continue
+		}
+		found := false
+		for _, m := range f.Magic {
+			if m.match(prefix) {
+				found = true
+				break
+			}
+		}
+		if found {
+			matched = append(matched, f)
+		} else {
+			errs = append(errs, FormatError{Err: errNoMagicMatch, Format: f})
+		}
+	}
+
+	return append(matched, noMagic...), errs, nil
+}
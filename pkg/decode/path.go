@@ -0,0 +1,113 @@
+package decode
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PathElem is one step in a targeted decode path, ex trak[1] is {Name: "trak", Index: 1}
+type PathElem struct {
+	Name  string
+	Index int
+}
+
+func (pe PathElem) String() string {
+	return fmt.Sprintf(".%s[%d]", pe.Name, pe.Index)
+}
+
+// PathString returns path as a string like .moov[0].trak[1]
+func PathString(path []PathElem) string {
+	var sb strings.Builder
+	for _, pe := range path {
+		sb.WriteString(pe.String())
+	}
+	return sb.String()
+}
+
+// ParsePath parses a path like .moov.trak[1].mdia, name without index means index 0
+func ParsePath(s string) ([]PathElem, error) {
+	var path []PathElem
+	rest := s
+	for rest != "" {
+		if rest[0] != '.' {
+			return nil, fmt.Errorf("%s: expected . at %q", s, rest)
+		}
+		rest = rest[1:]
+		n := strings.IndexAny(rest, ".[")
+		if n == -1 {
+			n = len(rest)
+		}
+		pe := PathElem{Name: rest[0:n]}
+		if pe.Name == "" {
+			return nil, fmt.Errorf("%s: empty name", s)
+		}
+		rest = rest[n:]
+		if rest != "" && rest[0] == '[' {
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("%s: missing ]", s)
+			}
+			i, err := strconv.Atoi(rest[1:end])
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("%s: invalid index %q", s, rest[1:end])
+			}
+			pe.Index = i
+			rest = rest[end+1:]
+		}
+		path = append(path, pe)
+	}
+
+	return path, nil
+}
+
+// pathState is shared by all matchers for a decode and keeps track of how many
+// path elements matched
+type pathState struct {
+	matched int
+}
+
+// PathMatcher tells a container decoder which children are on the targeted path.
+// Children not on path can be skipped using size fields without decoding them.
+// A nil matcher matches everything.
+type PathMatcher struct {
+	path   []PathElem
+	depth  int
+	state  *pathState
+	counts map[string]int
+}
+
+func newPathMatcher(path []PathElem, depth int, state *pathState) *PathMatcher {
+	if len(path) == depth {
+		return nil
+	}
+	return &PathMatcher{path: path, depth: depth, state: state, counts: map[string]int{}}
+}
+
+// PathMatcher returns matcher for top level children, nil if whole buffer should be decoded
+func (d *D) PathMatcher() *PathMatcher {
+	if d.pathState == nil {
+		d.pathState = &pathState{}
+	}
+	return newPathMatcher(d.Options.Path, 0, d.pathState)
+}
+
+// Match should be called for each child in decode order. Returns if the child should
+// be decoded and a matcher to use for its children.
+func (m *PathMatcher) Match(name string) (*PathMatcher, bool) {
+	if m == nil {
+		return nil, true
+	}
+
+	i := m.counts[name]
+	m.counts[name] = i + 1
+	if pe := m.path[m.depth]; pe.Name != name || pe.Index != i {
+		return nil, false
+	}
+	if m.depth+1 > m.state.matched {
+		m.state.matched = m.depth + 1
+	}
+
+	// nil if last element, decode everything below target
+	return newPathMatcher(m.path, m.depth+1, m.state), true
+}
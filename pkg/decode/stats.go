@@ -0,0 +1,39 @@
+package decode
+
+// FormatStats counts decoder invocations for one format
+type FormatStats struct {
+	Decodes int
+	Errors  int
+	Panics  int
+}
+
+// Stats counts decoder invocations per format name.
+// Shared between all nested decoders and can be reused for many decodes.
+type Stats struct {
+	Formats map[string]*FormatStats
+}
+
+func NewStats() *Stats {
+	return &Stats{
+		Formats: map[string]*FormatStats{},
+	}
+}
+
+func (s *Stats) add(name string, err error) {
+	if s == nil {
+		return
+	}
+
+	fs, ok := s.Formats[name]
+	if !ok {
+		fs = &FormatStats{}
+		s.Formats[name] = fs
+	}
+	fs.Decodes++
+	if err != nil {
+		fs.Errors++
+		if _, ok := err.(PanicError); ok { //nolint:errorlint
+			fs.Panics++
+		}
+	}
+}
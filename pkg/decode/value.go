@@ -9,6 +9,7 @@ import (
 
 	"github.com/wader/fq/pkg/bitio"
 	"github.com/wader/fq/pkg/ranges"
+	"github.com/wader/fq/pkg/scalar"
 )
 
 type Compound struct {
@@ -27,7 +28,10 @@ type Value struct {
 	Index      int         // index in parent array/struct
 	Range      ranges.Range
 	RootBitBuf *bitio.Buffer
-	IsRoot     bool // TODO: rework?
+	IsRoot     bool      // TODO: rework?
+	DupOf      *Value    // root value with same buffer content, see Dedup
+	Checksum   *Checksum // set if value is an expected checksum, see FieldChecksumU
+	Warnings   []Warning // non-fatal issues, see FieldWarnf
 }
 
 type WalkFn func(v *Value, rootV *Value, depth int, rootDepth int) error
@@ -163,6 +167,43 @@ func (v *Value) Root() *Value       { return v.root(false, false) }
 func (v *Value) BufferRoot() *Value { return v.root(true, false) }
 func (v *Value) FormatRoot() *Value { return v.root(true, true) }
 
+// Child returns child with name of a struct value or nil
+func (v *Value) Child(name string) *Value {
+	if v == nil {
+		return nil
+	}
+	if c, ok := v.V.(*Compound); ok && !c.IsArray {
+		for _, cv := range c.Children {
+			if cv.Name == name {
+				return cv
+			}
+		}
+	}
+	return nil
+}
+
+// Children returns children of a array or struct value, nil if not compound
+func (v *Value) Children() []*Value {
+	if v == nil {
+		return nil
+	}
+	if c, ok := v.V.(*Compound); ok {
+		return c.Children
+	}
+	return nil
+}
+
+// Scalar returns scalar of a value, zero scalar if not a scalar
+func (v *Value) Scalar() scalar.S {
+	if v == nil {
+		return scalar.S{}
+	}
+	if s, ok := v.V.(*scalar.S); ok {
+		return *s
+	}
+	return scalar.S{}
+}
+
 func (v *Value) Errors() []error {
 	var errs []error
 	_ = v.WalkPreOrder(func(v *Value, rootV *Value, depth int, rootDepth int) error {
@@ -184,6 +225,14 @@ func (v *Value) InnerRange() ranges.Range {
 	return v.Range
 }
 
+// RootRanges returns the ranges in the root buffer the value is read from, ex for a value in
+// a buffer reassembled from parts of the root buffer.
+// ok is false if not derivable, ex value in decompressed data.
+func (v *Value) RootRanges() ([]ranges.Range, bool) {
+	r := v.InnerRange()
+	return v.RootBitBuf.SourceRanges(v.Root().RootBitBuf, r.Start, r.Len)
+}
+
 func (v *Value) postProcess() {
 	if err := v.WalkRootPostOrder(func(v *Value, rootV *Value, depth int, rootDepth int) error {
 		switch vv := v.V.(type) {
@@ -0,0 +1,42 @@
+package decode
+
+import "fmt"
+
+// WarningKind is the kind of spec-compliance issue a decoder noticed but could decode past
+type WarningKind string
+
+const (
+	// WarningUnknownVersion is a version newer than what the decoder knows about,
+	// fields might be decoded using the latest known layout
+	WarningUnknownVersion WarningKind = "unknown_version"
+	// WarningDeprecated is a field or structure that the spec says should not be used anymore
+	WarningDeprecated WarningKind = "deprecated"
+	// WarningChecksumMismatch is a checksum that does not match the data it covers
+	// reported by decoders that continue past corrupt data
+	WarningChecksumMismatch WarningKind = "checksum_mismatch"
+	// WarningTruncated is a structure that continues past end of input
+	WarningTruncated WarningKind = "truncated"
+	// WarningTrailingData is data past the size the structure describes
+	WarningTrailingData WarningKind = "trailing_data"
+)
+
+// Warning is a non-fatal issue attached to the value it concerns
+type Warning struct {
+	Kind    WarningKind
+	Message string
+}
+
+// ValueWarnf attaches a warning to an already added value
+func (d *D) ValueWarnf(v *Value, kind WarningKind, format string, a ...interface{}) {
+	v.Warnings = append(v.Warnings, Warning{Kind: kind, Message: fmt.Sprintf(format, a...)})
+}
+
+// FieldWarnf attaches a warning to an already added field in current struct
+func (d *D) FieldWarnf(name string, kind WarningKind, format string, a ...interface{}) {
+	d.ValueWarnf(d.FieldMustGet(name), kind, format, a...)
+}
+
+// Warnf attaches a warning to current struct or array
+func (d *D) Warnf(kind WarningKind, format string, a ...interface{}) {
+	d.ValueWarnf(d.Value, kind, format, a...)
+}
@@ -0,0 +1,74 @@
+package fuzzyhash_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/wader/fq/pkg/fuzzyhash"
+)
+
+func TestSSDeep(t *testing.T) {
+	testCases := []struct {
+		input    []byte
+		expected string
+	}{
+		{[]byte(""), "3::"},
+		{[]byte("abc"), "3:uG:uG"},
+		{bytes.Repeat([]byte("abcdefgh"), 1000), "48:tjLjLjLjLjLjLjLjLjLjLjLjLjLjLjLjLjLjLjLjLjLjLjLjLjLjLjLjLjLjLjLN:n"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.expected, func(t *testing.T) {
+			actual := fuzzyhash.SSDeep(tC.input)
+			if tC.expected != actual {
+				t.Errorf("expected %s, got %s", tC.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSSDeepCompare(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"3:uG:uG", "3:uG:uG", 100},
+		{"96:abcdefghijklmnop:abcdefgh", "96:abcdefghijklmnoq:abcdefgx", 94},
+		{"96:abcdefghijklmnop:abcdefgh", "192:abcdefgh:xyz", 100},
+		{"96:abcdefghijklmnop:abcdefgh", "384:abcdefghijklmnop:abcdefgh", 0},
+		// sequences longer than three are eliminated before comparing
+		{"96:aaaaaaaabcdefgh:", "96:aaabcdefgh:", 100},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.a+" "+tC.b, func(t *testing.T) {
+			actual, err := fuzzyhash.SSDeepCompare(tC.a, tC.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tC.expected != actual {
+				t.Errorf("expected %d, got %d", tC.expected, actual)
+			}
+		})
+	}
+}
+
+func TestTLSHDistance(t *testing.T) {
+	a := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog "), 20)
+	b := bytes.Replace(a, []byte("lazy"), []byte("busy"), 1)
+	ha, err := fuzzyhash.TLSH(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hb, err := fuzzyhash.TLSH(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := fuzzyhash.TLSHDistance(ha, ha); d != 0 {
+		t.Errorf("expected 0 distance to itself, got %d", d)
+	}
+	if d, _ := fuzzyhash.TLSHDistance(ha, hb); d == 0 || d > 50 {
+		t.Errorf("expected small non-zero distance, got %d", d)
+	}
+	if _, err := fuzzyhash.TLSH(a[0:40]); err != fuzzyhash.ErrTLSHTooShort {
+		t.Errorf("expected too short error, got %v", err)
+	}
+}
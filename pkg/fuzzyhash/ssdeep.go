@@ -0,0 +1,278 @@
+// Package fuzzyhash calculates similarity digests that can be compared to find
+// near-duplicate data
+package fuzzyhash
+
+// https://ssdeep-project.github.io/ssdeep/
+// https://dfrws.org/sites/default/files/session-files/paper-identifying_almost_identical_files_using_context_triggered_piecewise_hashing.pdf
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	ssdeepRollingWindow  = 7
+	ssdeepMinBlockSize   = 3
+	ssdeepSpamSumLength  = 64
+	ssdeepNumBlockHashes = 31
+	ssdeepHashPrime      = 0x01000193
+	ssdeepHashInit       = 0x28021967
+	ssdeepB64            = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+)
+
+// ErrInvalidSSDeep is returned when comparing a malformed ssdeep digest
+var ErrInvalidSSDeep = errors.New("invalid ssdeep digest")
+
+// rolling hash over the last few bytes, decides piece boundaries
+type ssdeepRoll struct {
+	window     [ssdeepRollingWindow]byte
+	h1, h2, h3 uint32
+	n          uint32
+}
+
+func (r *ssdeepRoll) hash(c byte) {
+	r.h2 -= r.h1
+	r.h2 += ssdeepRollingWindow * uint32(c)
+	r.h1 += uint32(c)
+	r.h1 -= uint32(r.window[r.n%ssdeepRollingWindow])
+	r.window[r.n%ssdeepRollingWindow] = c
+	r.n++
+	r.h3 <<= 5
+	r.h3 ^= uint32(c)
+}
+
+func (r *ssdeepRoll) sum() uint32 { return r.h1 + r.h2 + r.h3 }
+
+// FNV based hash of current piece, h is full and halfH is for the second,
+// half length, part of the digest
+type ssdeepBlockHash struct {
+	h, halfH uint32
+	digest   []byte
+	// last digest character when digest is full
+	last byte
+}
+
+func ssdeepBlockSize(i int) uint64 { return ssdeepMinBlockSize << i }
+
+// SSDeep is the context triggered piecewise hash of b in the form
+// "blocksize:digest:digest", same as ssdeep without the file name
+func SSDeep(b []byte) string {
+	// guess block size from length so that digest is about full length, only
+	// it and one larger are needed
+	guess := 0
+	for ssdeepBlockSize(guess)*ssdeepSpamSumLength < uint64(len(b)) && guess < ssdeepNumBlockHashes-1 {
+		guess++
+	}
+	numBlockHashes := guess + 2
+	if numBlockHashes > ssdeepNumBlockHashes {
+		numBlockHashes = ssdeepNumBlockHashes
+	}
+
+	var roll ssdeepRoll
+	bhs := make([]ssdeepBlockHash, numBlockHashes)
+	for i := range bhs {
+		bhs[i].h = ssdeepHashInit
+		bhs[i].halfH = ssdeepHashInit
+	}
+	// block size n+1 is only used if block size n has been triggered, same as
+	// ssdeep that starts with one block size and adds one when needed
+	bhEnd := 1
+
+	for _, c := range b {
+		roll.hash(c)
+		rh := uint64(roll.sum())
+		for i := range bhs {
+			bhs[i].h = bhs[i].h*ssdeepHashPrime ^ uint32(c)
+			bhs[i].halfH = bhs[i].halfH*ssdeepHashPrime ^ uint32(c)
+		}
+
+		for i := 0; i < bhEnd; i++ {
+			bs := ssdeepBlockSize(i)
+			// block sizes are doubling so no larger will trigger either
+			if rh%bs != bs-1 {
+				break
+			}
+			bh := &bhs[i]
+			if len(bh.digest) == 0 && bhEnd < numBlockHashes {
+				bhEnd++
+			}
+			if len(bh.digest) < ssdeepSpamSumLength-1 {
+				bh.digest = append(bh.digest, ssdeepB64[bh.h%64])
+				bh.h = ssdeepHashInit
+				if len(bh.digest) < ssdeepSpamSumLength/2 {
+					bh.halfH = ssdeepHashInit
+				}
+			} else {
+				bh.last = ssdeepB64[bh.h%64]
+			}
+		}
+	}
+
+	bi := guess
+	if bi >= bhEnd {
+		bi = bhEnd - 1
+	}
+	for bi > 0 && len(bhs[bi].digest) < ssdeepSpamSumLength/2 {
+		bi--
+	}
+
+	// a trailing piece that did not end at a trigger point is only included if
+	// the rolling hash is non-zero
+	rh := roll.sum()
+	bh1 := bhs[bi]
+	digest1 := string(bh1.digest)
+	if rh != 0 {
+		digest1 += string(ssdeepB64[bh1.h%64])
+	} else if bh1.last != 0 {
+		digest1 += string(bh1.last)
+	}
+
+	var digest2 string
+	if bi < bhEnd-1 {
+		bh2 := bhs[bi+1]
+		n := ssdeepSpamSumLength/2 - 1
+		if n > len(bh2.digest) {
+			n = len(bh2.digest)
+		}
+		digest2 = string(bh2.digest[0:n])
+		if rh != 0 {
+			digest2 += string(ssdeepB64[bh2.halfH%64])
+		} else if n < len(bh2.digest) {
+			digest2 += string(bh2.digest[n])
+		}
+	} else if rh != 0 {
+		digest2 = string(ssdeepB64[bh1.h%64])
+	}
+
+	return fmt.Sprintf("%d:%s:%s", ssdeepBlockSize(bi), digest1, digest2)
+}
+
+func parseSSDeep(s string) (uint64, string, string, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, "", "", ErrInvalidSSDeep
+	}
+	bs, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil || bs == 0 {
+		return 0, "", "", ErrInvalidSSDeep
+	}
+	for _, p := range parts[1:] {
+		if len(p) > ssdeepSpamSumLength {
+			return 0, "", "", ErrInvalidSSDeep
+		}
+	}
+	return bs, ssdeepEliminateSequences(parts[1]), ssdeepEliminateSequences(parts[2]), nil
+}
+
+// runs of more than three same characters carry little information
+func ssdeepEliminateSequences(s string) string {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if i >= 3 && s[i] == s[i-1] && s[i] == s[i-2] && s[i] == s[i-3] {
+			continue
+		}
+		b = append(b, s[i])
+	}
+	return string(b)
+}
+
+// digests need a common substring of at least rolling window length to be
+// considered related at all
+func ssdeepHasCommonSubstring(s1, s2 string) bool {
+	if len(s1) < ssdeepRollingWindow || len(s2) < ssdeepRollingWindow {
+		return false
+	}
+	for i := 0; i+ssdeepRollingWindow <= len(s1); i++ {
+		if strings.Contains(s2, s1[i:i+ssdeepRollingWindow]) {
+			return true
+		}
+	}
+	return false
+}
+
+// edit distance with insert and remove cost 1 and replace cost 2
+func ssdeepEditDistance(s1, s2 string) int {
+	prev := make([]int, len(s2)+1)
+	cur := make([]int, len(s2)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s1); i++ {
+		cur[0] = i
+		for j := 1; j <= len(s2); j++ {
+			cost := prev[j-1]
+			if s1[i-1] != s2[j-1] {
+				cost += 2
+			}
+			if prev[j]+1 < cost {
+				cost = prev[j] + 1
+			}
+			if cur[j-1]+1 < cost {
+				cost = cur[j-1] + 1
+			}
+			cur[j] = cost
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(s2)]
+}
+
+func ssdeepScoreStrings(s1, s2 string, bs uint64) int {
+	if !ssdeepHasCommonSubstring(s1, s2) {
+		return 0
+	}
+	score := ssdeepEditDistance(s1, s2)
+	score = score * ssdeepSpamSumLength / (len(s1) + len(s2))
+	score = 100 * score / ssdeepSpamSumLength
+	if score >= 100 {
+		return 0
+	}
+	score = 100 - score
+	// small block sizes can't match well enough to be sure, cap score
+	if bs >= (99+ssdeepRollingWindow)/ssdeepRollingWindow*ssdeepMinBlockSize {
+		return score
+	}
+	minLen := len(s1)
+	if len(s2) < minLen {
+		minLen = len(s2)
+	}
+	if maxScore := int(bs) / ssdeepMinBlockSize * minLen; score > maxScore {
+		score = maxScore
+	}
+	return score
+}
+
+// SSDeepCompare is the similarity between two ssdeep digests, 0 no similarity
+// to 100 very similar or identical
+func SSDeepCompare(a, b string) (int, error) {
+	bs1, s1b1, s1b2, err := parseSSDeep(a)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", err, a)
+	}
+	bs2, s2b1, s2b2, err := parseSSDeep(b)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", err, b)
+	}
+
+	// only digests with same or double block size can be compared
+	switch {
+	case bs1 == bs2:
+		if s1b1 == s2b1 {
+			return 100, nil
+		}
+		score1 := ssdeepScoreStrings(s1b1, s2b1, bs1)
+		score2 := ssdeepScoreStrings(s1b2, s2b2, bs1*2)
+		if score2 > score1 {
+			return score2, nil
+		}
+		return score1, nil
+	case bs1 == bs2*2:
+		return ssdeepScoreStrings(s1b1, s2b2, bs1), nil
+	case bs2 == bs1*2:
+		return ssdeepScoreStrings(s1b2, s2b1, bs2), nil
+	default:
+		return 0, nil
+	}
+}
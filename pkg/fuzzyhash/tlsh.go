@@ -0,0 +1,209 @@
+package fuzzyhash
+
+// https://github.com/trendmicro/tlsh
+// https://tlsh.org/papers.html
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	tlshWindowSize   = 5
+	tlshBuckets      = 256
+	tlshEffBuckets   = 128
+	tlshCodeSize     = tlshEffBuckets * 2 / 8
+	tlshMinLength    = 50
+	tlshVersion      = "T1"
+	tlshLength       = 1 + 1 + 1 + tlshCodeSize
+	tlshQRatioRange  = 16
+	tlshLValueRange  = 256
+	tlshDiffMultiply = 12
+)
+
+var (
+	// ErrTLSHTooShort is returned when input is too short or too uniform
+	ErrTLSHTooShort = errors.New("not enough data or variation for tlsh")
+	// ErrInvalidTLSH is returned when comparing a malformed TLSH digest
+	ErrInvalidTLSH = errors.New("invalid tlsh digest")
+)
+
+// pearson hash permutation table
+var tlshVTable = [256]byte{
+	1, 87, 49, 12, 176, 178, 102, 166, 121, 193, 6, 84, 249, 230, 44, 163,
+	14, 197, 213, 181, 161, 85, 218, 80, 64, 239, 24, 226, 236, 142, 38, 200,
+	110, 177, 104, 103, 141, 253, 255, 50, 77, 101, 81, 18, 45, 96, 31, 222,
+	25, 107, 190, 70, 86, 237, 240, 34, 72, 242, 20, 214, 244, 227, 149, 235,
+	97, 234, 57, 22, 60, 250, 82, 175, 208, 5, 127, 199, 111, 62, 135, 248,
+	174, 169, 211, 58, 66, 154, 106, 195, 245, 171, 17, 187, 182, 179, 0, 243,
+	132, 56, 148, 75, 128, 133, 158, 100, 130, 126, 91, 13, 153, 246, 216, 219,
+	119, 68, 223, 78, 83, 88, 201, 99, 122, 11, 92, 32, 136, 114, 52, 10,
+	138, 30, 48, 183, 156, 35, 61, 26, 143, 74, 251, 94, 129, 162, 63, 152,
+	170, 7, 115, 167, 241, 206, 3, 150, 55, 59, 151, 220, 90, 53, 23, 131,
+	125, 173, 15, 238, 79, 95, 89, 16, 105, 137, 225, 224, 217, 160, 37, 123,
+	118, 73, 2, 157, 46, 116, 9, 145, 134, 228, 207, 212, 202, 215, 69, 229,
+	27, 188, 67, 124, 168, 252, 42, 4, 29, 108, 21, 247, 19, 205, 39, 203,
+	233, 40, 186, 147, 198, 192, 155, 33, 164, 191, 98, 204, 165, 180, 117, 76,
+	140, 36, 210, 172, 41, 54, 159, 8, 185, 232, 113, 196, 231, 47, 146, 120,
+	51, 65, 28, 144, 254, 221, 93, 189, 194, 139, 112, 43, 71, 109, 184, 209,
+}
+
+func tlshPearson(salt, i, j, k byte) byte {
+	return tlshVTable[tlshVTable[tlshVTable[tlshVTable[salt]^i]^j]^k]
+}
+
+// log scale length, more precise for short lengths
+func tlshLValue(n int) byte {
+	l := math.Log(float64(n))
+	var v float64
+	switch {
+	case n <= 656:
+		v = math.Floor(l / 0.4054651)
+	case n <= 3199:
+		v = math.Floor(l/0.26236426 - 8.72777)
+	default:
+		v = math.Floor(l/0.095310180 - 62.5472)
+	}
+	return byte(int(v) & 0xff)
+}
+
+func swapNibbles(b byte) byte { return b<<4 | b>>4 }
+
+// TLSH is the trend micro locality sensitive hash of b as a "T1" prefixed hex
+// string. Input has to be at least 50 bytes with some variation.
+func TLSH(b []byte) (string, error) {
+	if len(b) < tlshMinLength {
+		return "", ErrTLSHTooShort
+	}
+
+	var buckets [tlshBuckets]uint32
+	var checksum byte
+	for i := tlshWindowSize - 1; i < len(b); i++ {
+		c0, c1, c2, c3, c4 := b[i], b[i-1], b[i-2], b[i-3], b[i-4]
+		checksum = tlshPearson(0, c0, c1, checksum)
+		buckets[tlshPearson(2, c0, c1, c2)]++
+		buckets[tlshPearson(3, c0, c1, c3)]++
+		buckets[tlshPearson(5, c0, c2, c3)]++
+		buckets[tlshPearson(7, c0, c2, c4)]++
+		buckets[tlshPearson(11, c0, c1, c4)]++
+		buckets[tlshPearson(13, c0, c3, c4)]++
+	}
+
+	sorted := make([]uint32, tlshEffBuckets)
+	copy(sorted, buckets[0:tlshEffBuckets])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	q1 := sorted[tlshEffBuckets/4-1]
+	q2 := sorted[tlshEffBuckets/2-1]
+	q3 := sorted[tlshEffBuckets*3/4-1]
+	if q3 == 0 {
+		return "", ErrTLSHTooShort
+	}
+	nonZero := 0
+	for _, n := range buckets[0:tlshEffBuckets] {
+		if n > 0 {
+			nonZero++
+		}
+	}
+	if nonZero <= tlshEffBuckets/2 {
+		return "", ErrTLSHTooShort
+	}
+
+	// header is checksum, length and quartile ratios with nibbles swapped
+	// followed by 2 bits per bucket, last bucket first
+	h := make([]byte, tlshLength)
+	h[0] = swapNibbles(checksum)
+	h[1] = swapNibbles(tlshLValue(len(b)))
+	q1Ratio := byte(q1 * 100 / q3 % tlshQRatioRange)
+	q2Ratio := byte(q2 * 100 / q3 % tlshQRatioRange)
+	h[2] = q1Ratio<<4 | q2Ratio
+	for i := 0; i < tlshCodeSize; i++ {
+		var c byte
+		for j := 0; j < 4; j++ {
+			n := buckets[4*i+j]
+			switch {
+			case n > q3:
+				c |= 3 << (j * 2)
+			case n > q2:
+				c |= 2 << (j * 2)
+			case n > q1:
+				c |= 1 << (j * 2)
+			}
+		}
+		h[3+tlshCodeSize-1-i] = c
+	}
+
+	return tlshVersion + strings.ToUpper(hex.EncodeToString(h)), nil
+}
+
+func parseTLSH(s string) ([]byte, error) {
+	s = strings.TrimPrefix(s, tlshVersion)
+	h, err := hex.DecodeString(s)
+	if err != nil || len(h) != tlshLength {
+		return nil, ErrInvalidTLSH
+	}
+	return h, nil
+}
+
+// distance between x and y in a circular range
+func tlshModDiff(x, y, r int) int {
+	d := x - y
+	if d < 0 {
+		d = -d
+	}
+	if r-d < d {
+		return r - d
+	}
+	return d
+}
+
+// TLSHDistance is the distance between two TLSH digests including length
+// difference, 0 is identical and larger is less similar
+func TLSHDistance(a, b string) (int, error) {
+	h1, err := parseTLSH(a)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", err, a)
+	}
+	h2, err := parseTLSH(b)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", err, b)
+	}
+
+	diff := 0
+	lDiff := tlshModDiff(int(swapNibbles(h1[1])), int(swapNibbles(h2[1])), tlshLValueRange)
+	if lDiff <= 1 {
+		diff += lDiff
+	} else {
+		diff += lDiff * tlshDiffMultiply
+	}
+	for _, shift := range []int{4, 0} {
+		qDiff := tlshModDiff(int(h1[2]>>shift&0xf), int(h2[2]>>shift&0xf), tlshQRatioRange)
+		if qDiff <= 1 {
+			diff += qDiff
+		} else {
+			diff += (qDiff - 1) * tlshDiffMultiply
+		}
+	}
+	if h1[0] != h2[0] {
+		diff++
+	}
+	for i := 3; i < tlshLength; i++ {
+		x, y := h1[i], h2[i]
+		for j := 0; j < 4; j++ {
+			d := int(x>>(j*2)&3) - int(y>>(j*2)&3)
+			if d < 0 {
+				d = -d
+			}
+			// opposite ends of quartile range counts extra
+			if d == 3 {
+				d = 6
+			}
+			diff += d
+		}
+	}
+
+	return diff, nil
+}
@@ -0,0 +1,123 @@
+// Package imagehash calculates perceptual image hashes that can be compared
+// using hamming distance to find similar images
+package imagehash
+
+// https://www.hackerfactor.com/blog/index.php?/archives/432-Looks-Like-It.html
+// https://www.hackerfactor.com/blog/index.php?/archives/529-Kind-of-Like-That.html
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// Hash is a 64 bit image hash, first bit is most significant
+type Hash uint64
+
+// Distance is number of differing bits
+func (h Hash) Distance(o Hash) int {
+	return bits.OnesCount64(uint64(h ^ o))
+}
+
+// grayscale image resized to w*h using average of covered source pixels
+func grayResize(img image.Image, w int, h int) []float64 {
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	out := make([]float64, w*h)
+	if sw == 0 || sh == 0 {
+		return out
+	}
+
+	for ty := 0; ty < h; ty++ {
+		y0 := ty * sh / h
+		y1 := (ty + 1) * sh / h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for tx := 0; tx < w; tx++ {
+			x0 := tx * sw / w
+			x1 := (tx + 1) * sw / w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var sum float64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					g := color.GrayModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.Gray)
+					sum += float64(g.Y)
+				}
+			}
+			out[ty*w+tx] = sum / float64((y1-y0)*(x1-x0))
+		}
+	}
+
+	return out
+}
+
+// DHash is a difference hash, image is reduced to 9x8 grayscale and a bit is
+// set if a pixel is brighter than the one to the left of it
+func DHash(img image.Image) Hash {
+	const w, h = 9, 8
+	px := grayResize(img, w, h)
+	var hash Hash
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			hash <<= 1
+			if px[y*w+x+1] > px[y*w+x] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// PHash is a DCT based perceptual hash, image is reduced to 32x32 grayscale and
+// a bit is set for each of the lowest 8x8 frequencies above median
+func PHash(img image.Image) Hash {
+	const n, m = 32, 8
+	px := grayResize(img, n, n)
+
+	// only the lowest m frequencies in each direction are needed
+	var cos [m][n]float64
+	for u := 0; u < m; u++ {
+		for x := 0; x < n; x++ {
+			cos[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * n))
+		}
+	}
+	// rows then columns
+	var rows [n][m]float64
+	for y := 0; y < n; y++ {
+		for u := 0; u < m; u++ {
+			var s float64
+			for x := 0; x < n; x++ {
+				s += px[y*n+x] * cos[u][x]
+			}
+			rows[y][u] = s
+		}
+	}
+	coefs := make([]float64, 0, m*m)
+	for v := 0; v < m; v++ {
+		for u := 0; u < m; u++ {
+			var s float64
+			for y := 0; y < n; y++ {
+				s += rows[y][u] * cos[v][y]
+			}
+			coefs = append(coefs, s)
+		}
+	}
+
+	sorted := append([]float64(nil), coefs...)
+	sort.Float64s(sorted)
+	median := (sorted[m*m/2-1] + sorted[m*m/2]) / 2
+
+	var hash Hash
+	for _, c := range coefs {
+		hash <<= 1
+		if c > median {
+			hash |= 1
+		}
+	}
+	return hash
+}
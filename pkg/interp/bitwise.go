@@ -0,0 +1,164 @@
+package interp
+
+import (
+	"fmt"
+
+	"github.com/wader/fq/pkg/bitio"
+)
+
+// band, bor, bxor and bnot are reserved operator keywords in the gojq fork
+// (ex: 1 band 3) and can't be used as function names, so use bit prefix.
+// bshift and brotate are aliases for bitshift and bitrotate.
+
+func init() {
+	functionRegisterFns = append(functionRegisterFns, func(i *Interp) []Function {
+		return []Function{
+			{"bitand", 1, 1, i.bitand, nil},
+			{"bitor", 1, 1, i.bitor, nil},
+			{"bitxor", 1, 1, i.bitxor, nil},
+			{"bitnot", 0, 0, i.bitnot, nil},
+			{"bitshift", 1, 2, i.bitshift, nil},
+			{"bitrotate", 1, 2, i.bitrotate, nil},
+			{"bshift", 1, 2, i.bitshift, nil},
+			{"brotate", 1, 2, i.bitrotate, nil},
+		}
+	})
+}
+
+// bytes with bits left aligned in last byte and number of bits
+func toBitBytes(v interface{}, inArray bool) ([]byte, int64, error) {
+	bb, err := toBitBufEx(v, inArray)
+	if err != nil {
+		return nil, 0, err
+	}
+	b, err := bb.Bytes()
+	if err != nil {
+		return nil, 0, err
+	}
+	return b, bb.Len(), nil
+}
+
+func bitBytesGet(b []byte, i int64) byte {
+	return b[i/8] >> (7 - i%8) & 1
+}
+
+func bitBytesSet(b []byte, i int64, v byte) {
+	b[i/8] |= v << (7 - i%8)
+}
+
+func bitBytesBuffer(b []byte, nBits int64) Buffer {
+	return newBufferFromBuffer(bitio.NewBufferFromBytes(b, nBits), 8)
+}
+
+// apply op bit by bit between input and key, key is repeated if shorter than input
+func bitwiseOp(c interface{}, a []interface{}, op func(a, b byte) byte) interface{} {
+	b, nBits, err := toBitBytes(c, false)
+	if err != nil {
+		return err
+	}
+	// numbers and arrays are bytes, ex: bitxor(32) or bitxor([1, 2])
+	key, keyBits, err := toBitBytes(a[0], true)
+	if err != nil {
+		return err
+	}
+	if keyBits == 0 {
+		return fmt.Errorf("key can't be empty")
+	}
+
+	out := make([]byte, len(b))
+	if keyBits%8 == 0 {
+		keyLen := len(key)
+		for i := range b {
+			out[i] = op(b[i], key[i%keyLen])
+		}
+		// clear bits after end
+		if nBits%8 != 0 {
+			out[len(out)-1] &= 0xff << (8 - nBits%8)
+		}
+	} else {
+		for i := int64(0); i < nBits; i++ {
+			bitBytesSet(out, i, op(bitBytesGet(b, i), bitBytesGet(key, i%keyBits))&1)
+		}
+	}
+
+	return bitBytesBuffer(out, nBits)
+}
+
+func (i *Interp) bitand(c interface{}, a []interface{}) interface{} {
+	return bitwiseOp(c, a, func(a, b byte) byte { return a & b })
+}
+
+func (i *Interp) bitor(c interface{}, a []interface{}) interface{} {
+	return bitwiseOp(c, a, func(a, b byte) byte { return a | b })
+}
+
+func (i *Interp) bitxor(c interface{}, a []interface{}) interface{} {
+	return bitwiseOp(c, a, func(a, b byte) byte { return a ^ b })
+}
+
+func (i *Interp) bitnot(c interface{}, a []interface{}) interface{} {
+	return bitwiseOp(c, []interface{}{[]interface{}{0xff}}, func(a, b byte) byte { return a ^ b })
+}
+
+// move bits n steps towards start in each unit of width bits, all bits if no width.
+// Bits shifted in are zero or if rotate the bits shifted out.
+func bitwiseShift(c interface{}, a []interface{}, rotate bool) interface{} {
+	b, nBits, err := toBitBytes(c, false)
+	if err != nil {
+		return err
+	}
+	nBI, err := toBigInt(a[0])
+	if err != nil {
+		return err
+	}
+	if !nBI.IsInt64() {
+		return fmt.Errorf("shift amount out of range")
+	}
+	n := nBI.Int64()
+	width := nBits
+	if len(a) == 2 {
+		widthBI, err := toBigInt(a[1])
+		if err != nil {
+			return err
+		}
+		if !widthBI.IsInt64() || widthBI.Int64() <= 0 {
+			return fmt.Errorf("width must be positive")
+		}
+		width = widthBI.Int64()
+		if nBits%width != 0 {
+			return fmt.Errorf("length %d bits is not a multiple of width %d", nBits, width)
+		}
+	}
+
+	out := make([]byte, len(b))
+	if width == 0 {
+		return bitBytesBuffer(out, nBits)
+	}
+	if rotate {
+		n %= width
+		if n < 0 {
+			n += width
+		}
+	}
+	for u := int64(0); u < nBits; u += width {
+		for j := int64(0); j < width; j++ {
+			src := j + n
+			if rotate {
+				src %= width
+			} else if src < 0 || src >= width {
+				continue
+			}
+			bitBytesSet(out, u+j, bitBytesGet(b, u+src))
+		}
+	}
+
+	return bitBytesBuffer(out, nBits)
+}
+
+func (i *Interp) bitshift(c interface{}, a []interface{}) interface{} {
+	return bitwiseShift(c, a, false)
+}
+
+func (i *Interp) bitrotate(c interface{}, a []interface{}) interface{} {
+	return bitwiseShift(c, a, true)
+}
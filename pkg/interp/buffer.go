@@ -22,7 +22,7 @@ func init() {
 		return []Function{
 			{"_tobitsrange", 0, 2, i._toBitsRange, nil},
 			{"_is_buffer", 0, 0, i._isBuffer, nil},
-			{"open", 0, 0, i._open, nil},
+			{"_open", 0, 0, i._open, nil},
 		}
 	})
 }
@@ -171,8 +171,10 @@ func (of *openFile) ToBuffer() (Buffer, error) {
 	return newBufferFromBuffer(of.bb, 8), nil
 }
 
-// def open: #:: string| => buffer
-// opens a file for reading from filesystem
+// def _open: #:: string| => buffer
+// opens a file for reading from filesystem, null input is stdin. If open_paths
+// was set on the command line only files below those directories or files from
+// command line arguments can be opened
 // TODO: when to close? when bb loses all refs? need to use finalizer somehow?
 func (i *Interp) _open(c interface{}, a []interface{}) interface{} {
 	var err error
@@ -188,7 +190,11 @@ func (i *Interp) _open(c interface{}, a []interface{}) interface{} {
 		if err != nil {
 			return fmt.Errorf("%s: %w", path, err)
 		}
-		f, err = i.os.FS().Open(path)
+		fsys := i.os.FS()
+		if !i.sandbox.openAllowed(fsys, path) {
+			return fmt.Errorf("open %s: outside of allowed paths (open_paths option)", path)
+		}
+		f, err = fsys.Open(path)
 		if err != nil {
 			return err
 		}
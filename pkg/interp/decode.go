@@ -2,6 +2,7 @@ package interp
 
 import (
 	"bytes"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -15,6 +16,7 @@ import (
 	"github.com/wader/fq/internal/ioextra"
 	"github.com/wader/fq/pkg/bitio"
 	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/logger"
 	"github.com/wader/fq/pkg/scalar"
 
 	"github.com/wader/gojq"
@@ -27,6 +29,7 @@ func init() {
 			{"_tovalue", 1, 1, i._toValue, nil},
 			{"_decode", 2, 2, i._decode, nil},
 			{"_is_decode_value", 0, 0, i._isDecodeValue, nil},
+			{"_decode_stats", 0, 0, i._decodeStats, nil},
 		}
 	})
 }
@@ -70,11 +73,12 @@ func (i *Interp) _registry(c interface{}, a []interface{}) interface{} {
 
 	for _, f := range uniqueFormats {
 		vf := map[string]interface{}{
-			"name":        f.Name,
-			"description": f.Description,
-			"probe_order": f.ProbeOrder,
-			"root_name":   f.RootName,
-			"root_array":  f.RootArray,
+			"name":           f.Name,
+			"description":    f.Description,
+			"probe_order":    f.ProbeOrder,
+			"root_name":      f.RootName,
+			"root_array":     f.RootArray,
+			"embedded_files": f.EmbeddedFiles != nil,
 		}
 
 		var dependenciesVs []interface{}
@@ -138,10 +142,21 @@ func (i *Interp) _toValue(c interface{}, a []interface{}) interface{} {
 
 func (i *Interp) _decode(c interface{}, a []interface{}) interface{} {
 	var opts struct {
-		Filename string                 `mapstructure:"filename"`
-		Force    bool                   `mapstructure:"force"`
-		Progress string                 `mapstructure:"_progress"`
-		Remain   map[string]interface{} `mapstructure:",remain"`
+		Filename string `mapstructure:"filename"`
+		Force    bool   `mapstructure:"force"`
+		Dedup    bool   `mapstructure:"dedup"`
+		Stats    bool   `mapstructure:"decode_stats"`
+		// TODO: vary scheduling or chunk sizes if decode gets parallel
+		DeterminismCheck bool                   `mapstructure:"determinism_check"`
+		IncludeFormats   []string               `mapstructure:"include_formats"`
+		ExcludeFormats   []string               `mapstructure:"exclude_formats"`
+		IncludeGroups    []string               `mapstructure:"include_groups"`
+		ExcludeGroups    []string               `mapstructure:"exclude_groups"`
+		Progress         string                 `mapstructure:"_progress"`
+		LogLevel         string                 `mapstructure:"log_level"`
+		LogJSON          bool                   `mapstructure:"log_json"`
+		Path             string                 `mapstructure:"decode_path"`
+		Remain           map[string]interface{} `mapstructure:",remain"`
 	}
 	_ = mapstructure.Decode(a[1], &opts)
 
@@ -199,17 +214,79 @@ func (i *Interp) _decode(c interface{}, a []interface{}) interface{} {
 	if err != nil {
 		return err
 	}
+	excludeFormats, err := i.excludeFormats(opts.IncludeFormats, opts.IncludeGroups, opts.ExcludeFormats, opts.ExcludeGroups)
+	if err != nil {
+		return err
+	}
+	// explicitly requested format is never excluded, ex -d mp4 --exclude-group image
+	if len(decodeFormat) == 1 && decodeFormat[0].Name == formatName {
+		delete(excludeFormats, formatName)
+	}
+	decodeLogger, err := i.newLogger(opts.LogLevel, opts.LogJSON)
+	if err != nil {
+		return err
+	}
+	decodePath, err := decode.ParsePath(opts.Path)
+	if err != nil {
+		return fmt.Errorf("decode_path: %w", err)
+	}
+	if len(decodePath) > 0 {
+		supportsPath := false
+		for _, f := range decodeFormat {
+			supportsPath = supportsPath || f.SupportsPath
+		}
+		if !supportsPath {
+			return errors.New("decode_path: not supported by format")
+		}
+	}
 
-	dv, _, err := decode.Decode(i.evalContext.ctx, bv.bb, decodeFormat,
-		decode.Options{
-			IsRoot:        true,
-			FillGaps:      true,
-			Force:         opts.Force,
-			Range:         bv.r,
-			Description:   opts.Filename,
-			FormatOptions: opts.Remain,
-		},
-	)
+	var stats *decode.Stats
+	if opts.Stats {
+		stats = i.decodeStats
+	}
+
+	decodeFn := func(stats *decode.Stats, l *logger.Logger) (*decode.Value, error) {
+		var dedup *decode.Dedup
+		if opts.Dedup {
+			dedup = decode.NewDedup()
+		}
+
+		dv, _, err := decode.Decode(i.evalContext.ctx, bv.bb, decodeFormat,
+			decode.Options{
+				IsRoot:         true,
+				FillGaps:       true,
+				Force:          opts.Force,
+				Range:          bv.r,
+				Description:    opts.Filename,
+				FormatOptions:  opts.Remain,
+				Dedup:          dedup,
+				ExcludeFormats: excludeFormats,
+				Stats:          stats,
+				Logger:         l,
+				Path:           decodePath,
+			},
+		)
+		return dv, err
+	}
+
+	dv, err := decodeFn(stats, decodeLogger)
+	if dv != nil && opts.DeterminismCheck {
+		// decode again and make sure decoders did not keep any state between decodes
+		// that changed the result. Own stats and discarded log so that nothing is
+		// counted or logged twice
+		var checkStats *decode.Stats
+		if stats != nil {
+			checkStats = decode.NewStats()
+		}
+		checkLogger, _ := newLoggerWriter(io.Discard, opts.LogLevel, opts.LogJSON)
+		dv2, err2 := decodeFn(checkStats, checkLogger)
+		if dv2 == nil {
+			return fmt.Errorf("nondeterministic decode: second decode failed: %w", err2)
+		}
+		if err := decode.Compare(dv, dv2); err != nil {
+			return fmt.Errorf("nondeterministic decode: %w", err)
+		}
+	}
 	if dv == nil {
 		var decodeFormatsErr decode.FormatsError
 		if errors.As(err, &decodeFormatsErr) {
@@ -227,6 +304,64 @@ func (i *Interp) _decode(c interface{}, a []interface{}) interface{} {
 	return makeDecodeValue(dv)
 }
 
+func (i *Interp) _decodeStats(c interface{}, a []interface{}) interface{} {
+	formats := map[string]interface{}{}
+	for name, fs := range i.decodeStats.Formats {
+		formats[name] = map[string]interface{}{
+			"decodes": fs.Decodes,
+			"errors":  fs.Errors,
+			"panics":  fs.Panics,
+		}
+	}
+	return formats
+}
+
+// formatNames resolves format and group names into a set of format names
+func (i *Interp) formatNames(formats []string, groups []string) (map[string]bool, error) {
+	names := map[string]bool{}
+	for _, n := range formats {
+		g, err := i.registry.Group(n)
+		if err != nil || len(g) != 1 || g[0].Name != n {
+			return nil, fmt.Errorf("%s: format not found", n)
+		}
+		names[n] = true
+	}
+	for _, n := range groups {
+		g, err := i.registry.Group(n)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", n, err)
+		}
+		for _, f := range g {
+			names[f.Name] = true
+		}
+	}
+	return names, nil
+}
+
+// excludeFormats returns formats to skip when decoding, if something is included
+// only those formats are used, excludes are then removed from that set
+func (i *Interp) excludeFormats(includeFormats, includeGroups, excludeFormats, excludeGroups []string) (map[string]bool, error) {
+	included, err := i.formatNames(includeFormats, includeGroups)
+	if err != nil {
+		return nil, err
+	}
+	excluded, err := i.formatNames(excludeFormats, excludeGroups)
+	if err != nil {
+		return nil, err
+	}
+	if len(included) > 0 {
+		for _, f := range i.registry.MustAll() {
+			if !included[f.Name] {
+				excluded[f.Name] = true
+			}
+		}
+	}
+	if len(excluded) == 0 {
+		return nil, nil
+	}
+	return excluded, nil
+}
+
 func (i *Interp) _isDecodeValue(c interface{}, a []interface{}) interface{} {
 	_, ok := c.(DecodeValue)
 	return ok
@@ -362,11 +497,13 @@ func (dvb decodeValueBase) ExtKeys() []string {
 		"_start",
 		"_stop",
 		"_len",
+		"_root_ranges",
 		"_name",
 		"_root",
 		"_buffer_root",
 		"_format_root",
 		"_parent",
+		"_dup_of",
 		"_actual",
 		"_sym",
 		"_description",
@@ -375,6 +512,8 @@ func (dvb decodeValueBase) ExtKeys() []string {
 		"_bytes",
 		"_unknown",
 		"_index", // TODO: only if parent is array?
+		"_checksum",
+		"_warnings",
 	}
 
 	if _, ok := dvb.dv.V.(*decode.Compound); ok {
@@ -401,6 +540,20 @@ func (dvb decodeValueBase) JQValueKey(name string) interface{} {
 		return big.NewInt(dv.Range.Stop())
 	case "_len":
 		return big.NewInt(dv.Range.Len)
+	case "_root_ranges":
+		rs, ok := dv.RootRanges()
+		if !ok {
+			return nil
+		}
+		vs := []interface{}{}
+		for _, r := range rs {
+			vs = append(vs, map[string]interface{}{
+				"start": big.NewInt(r.Start),
+				"stop":  big.NewInt(r.Stop()),
+				"len":   big.NewInt(r.Len),
+			})
+		}
+		return vs
 	case "_name":
 		return dv.Name
 	case "_root":
@@ -416,6 +569,11 @@ func (dvb decodeValueBase) JQValueKey(name string) interface{} {
 			return nil
 		}
 		return makeDecodeValue(dv.Parent)
+	case "_dup_of":
+		if dv.DupOf == nil {
+			return nil
+		}
+		return makeDecodeValue(dv.DupOf)
 	case "_actual":
 		switch vv := dv.V.(type) {
 		case *scalar.S:
@@ -455,6 +613,29 @@ func (dvb decodeValueBase) JQValueKey(name string) interface{} {
 		}
 	case "_path":
 		return valuePath(dv)
+	case "_checksum":
+		if dv.Checksum == nil {
+			return nil
+		}
+		return map[string]interface{}{
+			"algorithm": dv.Checksum.Algorithm,
+			"expected":  hex.EncodeToString(dv.Checksum.Expected),
+			"computed":  hex.EncodeToString(dv.Checksum.Computed),
+			"valid":     dv.Checksum.Valid(),
+		}
+	case "_warnings":
+		ws := []interface{}{}
+		_ = dv.WalkPreOrder(func(wv *decode.Value, rootV *decode.Value, depth int, rootDepth int) error {
+			for _, w := range wv.Warnings {
+				ws = append(ws, map[string]interface{}{
+					"path":    valuePathDecorated(wv, Decorator{}),
+					"kind":    string(w.Kind),
+					"message": w.Message,
+				})
+			}
+			return nil
+		})
+		return ws
 	case "_error":
 		switch vv := dv.V.(type) {
 		case *decode.Compound:
@@ -1,7 +1,7 @@
 package interp
 
 import (
-	"log"
+	"fmt"
 	"strconv"
 	"strings"
 
@@ -121,8 +121,7 @@ func decoratorFromOptions(opts Options) Decorator {
 				// TODO: clean up number types
 				return d.Number
 			default:
-				log.Printf("v: %#+v\n", v)
-				panic("unreachable")
+				panic(fmt.Sprintf("unreachable %#+v", v))
 			}
 		}
 		byteDefaultColor := ansi.FromString("")
@@ -174,10 +174,25 @@ func dumpEx(v *decode.Value, buf []byte, cw *columnwriter.Writer, depth int, roo
 	if opts.Verbose {
 		cfmt(colField, " %s (%s)",
 			num.BitRange(innerRange).StringByteBits(opts.AddrBase), num.Bits(innerRange.Len).StringByteBits(opts.SizeBase))
+		// value in a nested buffer, show where it is in the root buffer if known
+		if opts.RootRanges && rootV.RootBitBuf != v.Root().RootBitBuf {
+			if rs, ok := v.RootRanges(); ok && len(rs) > 0 {
+				var rss []string
+				for _, r := range rs {
+					rss = append(rss, num.BitRange(r).StringByteBits(opts.AddrBase))
+				}
+				cfmt(colField, " (root %s)", strings.Join(rss, ", "))
+			}
+		}
 	}
 
 	cprint(colField, "\n")
 
+	for _, w := range v.Warnings {
+		columns()
+		cfmt(colField, "%s  %s: %s: %s\n", indent, deco.Error.F("warning"), w.Kind, w.Message)
+	}
+
 	if valueErr != nil {
 		var printErrs func(depth int, err error)
 		printErrs = func(depth int, err error) {
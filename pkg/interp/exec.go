@@ -0,0 +1,104 @@
+package interp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/wader/fq/pkg/bitio"
+)
+
+func init() {
+	functionRegisterFns = append(functionRegisterFns, func(i *Interp) []Function {
+		return []Function{
+			{"tempfile", 0, 0, i.tempfile, nil},
+			{"_exec", 2, 2, i._exec, nil},
+		}
+	})
+}
+
+// OS used for tempfile and exec, error if not supported
+func (i *Interp) osExec() (OSExec, error) {
+	e, ok := i.os.(OSExec)
+	if !ok {
+		return nil, fmt.Errorf("exec not supported")
+	}
+	return e, nil
+}
+
+// buffer | tempfile -> path to temp file with buffer content
+func (i *Interp) tempfile(c interface{}, a []interface{}) interface{} {
+	// only useful for exec and writes to disk so require same option
+	if !i.sandbox.allowExec {
+		return fmt.Errorf("tempfile not allowed, use --allow-exec or -o allow_exec=true")
+	}
+	bb, err := toBitBuf(c)
+	if err != nil {
+		return err
+	}
+	e, err := i.osExec()
+	if err != nil {
+		return err
+	}
+	name, f, err := e.TempFile()
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, bb); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return name
+}
+
+// null or buffer | _exec($name; $args) -> stdout buffer
+func (i *Interp) _exec(c interface{}, a []interface{}) interface{} {
+	if !i.sandbox.allowExec {
+		return fmt.Errorf("exec not allowed, use --allow-exec or -o allow_exec=true")
+	}
+	name, err := toString(a[0])
+	if err != nil {
+		return fmt.Errorf("name: %w", err)
+	}
+	argsAny, ok := a[1].([]interface{})
+	if !ok {
+		return fmt.Errorf("args: %v: value is not an array", a[1])
+	}
+	var args []string
+	for _, argAny := range argsAny {
+		arg, err := toString(argAny)
+		if err != nil {
+			return fmt.Errorf("args: %w", err)
+		}
+		args = append(args, arg)
+	}
+
+	var stdin io.Reader
+	if c != nil {
+		bb, err := toBitBuf(c)
+		if err != nil {
+			return err
+		}
+		stdin = bb
+	}
+
+	e, err := i.osExec()
+	if err != nil {
+		return err
+	}
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	if err := e.Exec(i.evalContext.ctx, name, args, stdin, stdout, stderr); err != nil {
+		if s := strings.TrimSpace(stderr.String()); s != "" {
+			return fmt.Errorf("%s: %w: %s", name, err, s)
+		}
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	return newBufferFromBuffer(bitio.NewBufferFromBytes(stdout.Bytes(), -1), 8)
+}
@@ -0,0 +1,146 @@
+package interp
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/gojq"
+)
+
+func init() {
+	functionRegisterFns = append(functionRegisterFns, func(i *Interp) []Function {
+		return []Function{
+			{"embedded_files", 0, 0, nil, i.embeddedFiles},
+			{"_extract_write", 1, 1, i._extractWrite, nil},
+		}
+	})
+}
+
+// format root value and its embedded files, error if format has no enumerator
+func formatEmbeddedFiles(dv *decode.Value) (*decode.Value, []decode.EmbeddedFile, error) {
+	rootV := dv.FormatRoot()
+	c, ok := rootV.V.(*decode.Compound)
+	if !ok || c.Format == nil {
+		return nil, nil, fmt.Errorf("value has no format")
+	}
+	if c.Format.EmbeddedFiles == nil {
+		return nil, nil, fmt.Errorf("%s: no embedded files", c.Format.Name)
+	}
+	efs, err := c.Format.EmbeddedFiles(rootV)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rootV, efs, nil
+}
+
+// decode value | embedded_files -> {name: "a/b", dir: false, data: <buffer>}, {name: "a/", dir: true}, ...
+func (i *Interp) embeddedFiles(c interface{}, a []interface{}) gojq.Iter {
+	dv, ok := c.(DecodeValue)
+	if !ok {
+		return gojq.NewIter(fmt.Errorf("%v: value is not a decode value", c))
+	}
+	rootV, efs, err := formatEmbeddedFiles(dv.DecodeValue())
+	if err != nil {
+		return gojq.NewIter(err)
+	}
+
+	return iterFn(func() (interface{}, bool) {
+		if len(efs) == 0 {
+			return nil, false
+		}
+		ef := efs[0]
+		efs = efs[1:]
+
+		if ef.Dir {
+			return map[string]interface{}{"name": ef.Name, "dir": true}, true
+		}
+		bb, err := ef.BitBuf(rootV.RootBitBuf)
+		if err != nil {
+			return fmt.Errorf("%s: %w", ef.Name, err), true
+		}
+		return map[string]interface{}{
+			"name": ef.Name,
+			"dir":  false,
+			"data": newBufferFromBuffer(bb, 8),
+		}, true
+	})
+}
+
+// OS used for writing files, error if not supported
+func (i *Interp) osWriter() (OSWriter, error) {
+	w, ok := i.os.(OSWriter)
+	if !ok {
+		return nil, fmt.Errorf("writing files not supported")
+	}
+	return w, nil
+}
+
+// archive paths are slash separated, make relative and make sure they stay inside dir.
+// fs.ValidPath allows backslash and colon which on windows are separators and volume names
+func extractPath(dir string, p string) (string, error) {
+	cp := path.Clean(strings.TrimLeft(p, "/"))
+	if cp == "." || !fs.ValidPath(cp) || strings.ContainsAny(cp, `\:`) {
+		return "", fmt.Errorf("%q: unsafe path", p)
+	}
+	return filepath.Join(dir, filepath.FromSlash(cp)), nil
+}
+
+// embedded file | _extract_write($dir) -> written path
+func (i *Interp) _extractWrite(c interface{}, a []interface{}) interface{} {
+	if err := i.sandbox.writeAllowed(); err != nil {
+		return err
+	}
+	entry, ok := c.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("entry is not an object")
+	}
+	dir, err := toString(a[0])
+	if err != nil {
+		return err
+	}
+	name, err := toString(entry["name"])
+	if err != nil {
+		return fmt.Errorf("name: %w", err)
+	}
+	p, err := extractPath(dir, name)
+	if err != nil {
+		return err
+	}
+	w, err := i.osWriter()
+	if err != nil {
+		return err
+	}
+
+	if isDir, _ := entry["dir"].(bool); isDir {
+		if err := w.MkdirAll(p); err != nil {
+			return err
+		}
+		return p
+	}
+
+	bb, err := toBitBuf(entry["data"])
+	if err != nil {
+		return fmt.Errorf("%s: data: %w", name, err)
+	}
+	if err := w.MkdirAll(filepath.Dir(p)); err != nil {
+		return err
+	}
+	f, err := w.Create(p)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, bb); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return p
+}
@@ -6,14 +6,27 @@ import (
 	"crypto/cipher"
 	"crypto/md5"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"hash"
+	"image"
+	"image/color"
+	// image formats supported by image functions
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
 	"io"
+	"math"
 	"net/url"
+	"strconv"
 
 	"github.com/wader/fq/pkg/bitio"
+	// bmp support for image functions
+	_ "github.com/wader/fq/pkg/bmpimage"
 	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/imagehash"
+	"github.com/wader/fq/pkg/qrcode"
 
 	"github.com/wader/gojq"
 )
@@ -53,6 +66,15 @@ func init() {
 			{"path_escape", 0, 0, i.pathEscape, nil},
 			{"path_unescape", 0, 0, i.pathUnescape, nil},
 			{"aes_ctr", 1, 2, i.aesCtr, nil},
+			{"qrcode", 0, 0, i.qrcode, nil},
+			{"bitplane", 2, 2, i.bitplane, nil},
+			{"palette_stats", 0, 0, i.paletteStats, nil},
+			{"toimage", 0, 0, i.toimage, nil},
+			{"dhash", 0, 0, makeImageHashFn(imagehash.DHash), nil},
+			{"phash", 0, 0, makeImageHashFn(imagehash.PHash), nil},
+			{"hash_distance", 1, 1, i.hashDistance, nil},
+			{"topng", 3, 3, i.topng, nil},
+			{"towav", 3, 3, i.towav, nil},
 		}
 	})
 }
@@ -237,6 +259,392 @@ func (i *Interp) aesCtr(c interface{}, a []interface{}) interface{} {
 	return newBufferFromBuffer(bitio.NewBufferFromBytes(buf.Bytes(), -1), 8)
 }
 
+// max width*height of decoded images, header of a small crafted image can
+// otherwise cause huge allocations
+const maxImagePixels = 100_000_000
+
+func decodeImage(bb *bitio.Buffer) (image.Image, string, error) {
+	cfg, _, err := image.DecodeConfig(bb.Clone())
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxImagePixels {
+		return nil, "", fmt.Errorf("image size %dx%d not supported", cfg.Width, cfg.Height)
+	}
+	return image.Decode(bb)
+}
+
+func toImage(v interface{}) (image.Image, error) {
+	bb, err := toBitBuf(v)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := decodeImage(bb)
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// decode image and output payload of first found QR code or DataMatrix symbol
+func (i *Interp) qrcode(c interface{}, a []interface{}) interface{} {
+	img, err := toImage(c)
+	if err != nil {
+		return err
+	}
+	payload, err := qrcode.Decode(img)
+	if err != nil {
+		return err
+	}
+
+	return newBufferFromBuffer(bitio.NewBufferFromBytes(payload, -1), 8)
+}
+
+// extract one bit per pixel from a channel, rows top to bottom and pixels left
+// to right packed with first pixel as most significant bit
+func (i *Interp) bitplane(c interface{}, a []interface{}) interface{} {
+	channel, err := toString(a[0])
+	if err != nil {
+		return err
+	}
+	bitBI, err := toBigInt(a[1])
+	if err != nil {
+		return err
+	}
+	bit := bitBI.Int64()
+	if bit < 0 || bit > 7 {
+		return fmt.Errorf("bit should be 0-7, is %d", bit)
+	}
+
+	img, err := toImage(c)
+	if err != nil {
+		return err
+	}
+
+	var channelFn func(x, y int) uint8
+	switch channel {
+	case "r", "g", "b", "a":
+		channelFn = func(x, y int) uint8 {
+			// non-alpha-premultiplied so bits are as stored for 8 bit images
+			c, _ := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			switch channel {
+			case "r":
+				return c.R
+			case "g":
+				return c.G
+			case "b":
+				return c.B
+			default:
+				return c.A
+			}
+		}
+	case "index":
+		pimg, ok := img.(*image.Paletted)
+		if !ok {
+			return fmt.Errorf("index channel requires a paletted image")
+		}
+		channelFn = func(x, y int) uint8 { return pimg.ColorIndexAt(x, y) }
+	default:
+		return fmt.Errorf("unknown channel %q, should be r, g, b, a or index", channel)
+	}
+
+	bounds := img.Bounds()
+	nBits := int64(bounds.Dx()) * int64(bounds.Dy())
+	buf := make([]byte, (nBits+7)/8)
+	n := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if channelFn(x, y)>>bit&1 != 0 {
+				buf[n/8] |= 0x80 >> (n % 8)
+			}
+			n++
+		}
+	}
+
+	return newBufferFromBuffer(bitio.NewBufferFromBytes(buf, nBits), 8)
+}
+
+// palette entries with usage count, unused and duplicate entries are common
+// signs of palette based steganography
+func (i *Interp) paletteStats(c interface{}, a []interface{}) interface{} {
+	img, err := toImage(c)
+	if err != nil {
+		return err
+	}
+	pimg, ok := img.(*image.Paletted)
+	if !ok {
+		return fmt.Errorf("image has no palette")
+	}
+
+	counts := make([]int, len(pimg.Palette))
+	bounds := pimg.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			idx := int(pimg.ColorIndexAt(x, y))
+			// index outside palette is decoded as is by some decoders
+			if idx < len(counts) {
+				counts[idx]++
+			}
+		}
+	}
+
+	firstIndex := map[color.NRGBA]int{}
+	var entries []interface{}
+	used := 0
+	duplicates := 0
+	uniqueColors := map[color.NRGBA]struct{}{}
+	for idx, pc := range pimg.Palette {
+		c, _ := color.NRGBAModel.Convert(pc).(color.NRGBA)
+		entry := map[string]interface{}{
+			"index": idx,
+			"r":     int(c.R),
+			"g":     int(c.G),
+			"b":     int(c.B),
+			"a":     int(c.A),
+			"count": counts[idx],
+		}
+		if first, ok := firstIndex[c]; ok {
+			entry["duplicate_of"] = first
+			duplicates++
+		} else {
+			firstIndex[c] = idx
+		}
+		if counts[idx] > 0 {
+			used++
+			uniqueColors[c] = struct{}{}
+		}
+		entries = append(entries, entry)
+	}
+
+	return map[string]interface{}{
+		"palette_size":  len(pimg.Palette),
+		"used":          used,
+		"unused":        len(pimg.Palette) - used,
+		"duplicates":    duplicates,
+		"unique_colors": len(uniqueColors),
+		"entries":       entries,
+	}
+}
+
+// decode image into format, dimensions and rows of non-alpha-premultiplied
+// [r, g, b, a] pixels
+func (i *Interp) toimage(c interface{}, a []interface{}) interface{} {
+	bb, err := toBitBuf(c)
+	if err != nil {
+		return err
+	}
+	img, imgFormat, err := decodeImage(bb)
+	if err != nil {
+		return err
+	}
+
+	b := img.Bounds()
+	rows := make([]interface{}, 0, b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := make([]interface{}, 0, b.Dx())
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			row = append(row, []interface{}{int(c.R), int(c.G), int(c.B), int(c.A)})
+		}
+		rows = append(rows, row)
+	}
+
+	return map[string]interface{}{
+		"format": imgFormat,
+		"width":  b.Dx(),
+		"height": b.Dy(),
+		"pixels": rows,
+	}
+}
+
+// image hash as 16 character hex string
+func makeImageHashFn(fn func(img image.Image) imagehash.Hash) func(c interface{}, a []interface{}) interface{} {
+	return func(c interface{}, a []interface{}) interface{} {
+		img, err := toImage(c)
+		if err != nil {
+			return err
+		}
+		return fmt.Sprintf("%016x", uint64(fn(img)))
+	}
+}
+
+// number of differing bits between two hex string image hashes
+func (i *Interp) hashDistance(c interface{}, a []interface{}) interface{} {
+	var hs [2]imagehash.Hash
+	for j, v := range []interface{}{c, a[0]} {
+		s, err := toString(v)
+		if err != nil {
+			return err
+		}
+		n, err := strconv.ParseUint(s, 16, 64)
+		if err != nil {
+			return fmt.Errorf("invalid hash %q", s)
+		}
+		hs[j] = imagehash.Hash(n)
+	}
+	return hs[0].Distance(hs[1])
+}
+
+// encode raw pixels, rows top to bottom without padding, as a PNG image
+func (i *Interp) topng(c interface{}, a []interface{}) interface{} {
+	var dims [2]int
+	for j, v := range a[0:2] {
+		bi, err := toBigInt(v)
+		if err != nil {
+			return err
+		}
+		if !bi.IsInt64() || bi.Int64() <= 0 || bi.Int64() > 1<<16 {
+			return fmt.Errorf("invalid dimension %s", bi)
+		}
+		dims[j] = int(bi.Int64())
+	}
+	width, height := dims[0], dims[1]
+	pixelFormat, err := toString(a[2])
+	if err != nil {
+		return err
+	}
+
+	var bytesPerPixel int
+	switch pixelFormat {
+	case "gray":
+		bytesPerPixel = 1
+	case "gray16":
+		bytesPerPixel = 2
+	case "rgb", "bgr":
+		bytesPerPixel = 3
+	case "rgba", "bgra":
+		bytesPerPixel = 4
+	default:
+		return fmt.Errorf("unknown pixel format %q, should be gray, gray16, rgb, bgr, rgba or bgra", pixelFormat)
+	}
+
+	bs, err := toBytes(c)
+	if err != nil {
+		return err
+	}
+	if l := width * height * bytesPerPixel; len(bs) < l {
+		return fmt.Errorf("%dx%d %s image needs %d bytes, has %d", width, height, pixelFormat, l, len(bs))
+	}
+
+	rect := image.Rect(0, 0, width, height)
+	var img image.Image
+	switch pixelFormat {
+	case "gray":
+		gimg := image.NewGray(rect)
+		copy(gimg.Pix, bs)
+		img = gimg
+	case "gray16":
+		// big endian as in PNG
+		gimg := image.NewGray16(rect)
+		copy(gimg.Pix, bs)
+		img = gimg
+	default:
+		nimg := image.NewNRGBA(rect)
+		for j := 0; j < width*height; j++ {
+			p := bs[j*bytesPerPixel:]
+			o := nimg.Pix[j*4:]
+			switch pixelFormat {
+			case "bgr", "bgra":
+				o[0], o[1], o[2] = p[2], p[1], p[0]
+			default:
+				o[0], o[1], o[2] = p[0], p[1], p[2]
+			}
+			o[3] = 0xff
+			if bytesPerPixel == 4 {
+				o[3] = p[3]
+			}
+		}
+		img = nimg
+	}
+
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		return err
+	}
+
+	return newBufferFromBuffer(bitio.NewBufferFromBytes(buf.Bytes(), -1), 8)
+}
+
+// wrap raw little endian PCM samples, unsigned for 8 bit, in a WAV file
+func (i *Interp) towav(c interface{}, a []interface{}) interface{} {
+	var args [3]int64
+	for j, v := range a {
+		bi, err := toBigInt(v)
+		if err != nil {
+			return err
+		}
+		if !bi.IsInt64() {
+			return fmt.Errorf("invalid argument %s", bi)
+		}
+		args[j] = bi.Int64()
+	}
+	rate, channels, bitsPerSample := args[0], args[1], args[2]
+	if rate <= 0 || rate > math.MaxUint32 {
+		return fmt.Errorf("invalid sample rate %d", rate)
+	}
+	if channels <= 0 || channels > math.MaxUint16 {
+		return fmt.Errorf("invalid number of channels %d", channels)
+	}
+	switch bitsPerSample {
+	case 8, 16, 24, 32:
+	default:
+		return fmt.Errorf("bits per sample should be 8, 16, 24 or 32, is %d", bitsPerSample)
+	}
+
+	blockAlign := channels * bitsPerSample / 8
+	if blockAlign > math.MaxUint16 {
+		return fmt.Errorf("block size %d too large for wav", blockAlign)
+	}
+	if rate*blockAlign > math.MaxUint32 {
+		return fmt.Errorf("byte rate %d too large for wav", rate*blockAlign)
+	}
+
+	bs, err := toBytes(c)
+	if err != nil {
+		return err
+	}
+	if int64(len(bs))%blockAlign != 0 {
+		return fmt.Errorf("data length %d is not a multiple of block size %d", len(bs), blockAlign)
+	}
+	dataLen := int64(len(bs))
+	padLen := dataLen & 1
+	if 4+(8+16)+(8+dataLen+padLen) > math.MaxUint32 {
+		return fmt.Errorf("data too large for wav")
+	}
+
+	buf := &bytes.Buffer{}
+	le := binary.LittleEndian
+	buf.WriteString("RIFF")
+	_ = binary.Write(buf, le, uint32(4+(8+16)+(8+dataLen+padLen)))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	_ = binary.Write(buf, le, struct {
+		Size          uint32
+		AudioFormat   uint16
+		NumChannels   uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+	}{
+		Size:          16,
+		AudioFormat:   1, // PCM
+		NumChannels:   uint16(channels),
+		SampleRate:    uint32(rate),
+		ByteRate:      uint32(rate * blockAlign),
+		BlockAlign:    uint16(blockAlign),
+		BitsPerSample: uint16(bitsPerSample),
+	})
+	buf.WriteString("data")
+	_ = binary.Write(buf, le, uint32(dataLen))
+	buf.Write(bs)
+	if padLen != 0 {
+		buf.WriteByte(0)
+	}
+
+	return newBufferFromBuffer(bitio.NewBufferFromBytes(buf.Bytes(), -1), 8)
+}
+
 func (i *Interp) _hexdump(c interface{}, a []interface{}) gojq.Iter {
 	opts := i.Options(a[0])
 	bv, err := toBuffer(c)
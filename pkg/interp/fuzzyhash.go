@@ -0,0 +1,61 @@
+package interp
+
+import (
+	"github.com/wader/fq/pkg/fuzzyhash"
+)
+
+func init() {
+	functionRegisterFns = append(functionRegisterFns, func(i *Interp) []Function {
+		return []Function{
+			{"ssdeep", 0, 0, i.ssdeep, nil},
+			{"tlsh", 0, 0, i.tlsh, nil},
+			{"ssdeep_compare", 1, 1, i.ssdeepCompare, nil},
+			{"tlsh_distance", 1, 1, i.tlshDistance, nil},
+		}
+	})
+}
+
+func (i *Interp) ssdeep(c interface{}, a []interface{}) interface{} {
+	b, err := toBytes(c)
+	if err != nil {
+		return err
+	}
+	return fuzzyhash.SSDeep(b)
+}
+
+func (i *Interp) tlsh(c interface{}, a []interface{}) interface{} {
+	b, err := toBytes(c)
+	if err != nil {
+		return err
+	}
+	h, err := fuzzyhash.TLSH(b)
+	if err != nil {
+		return err
+	}
+	return h
+}
+
+// compare input and argument digest strings
+func fuzzyHashCompare(c interface{}, a []interface{}, fn func(a, b string) (int, error)) interface{} {
+	var hs [2]string
+	for j, v := range []interface{}{c, a[0]} {
+		s, err := toString(v)
+		if err != nil {
+			return err
+		}
+		hs[j] = s
+	}
+	n, err := fn(hs[0], hs[1])
+	if err != nil {
+		return err
+	}
+	return n
+}
+
+func (i *Interp) ssdeepCompare(c interface{}, a []interface{}) interface{} {
+	return fuzzyHashCompare(c, a, fuzzyhash.SSDeepCompare)
+}
+
+func (i *Interp) tlshDistance(c interface{}, a []interface{}) interface{} {
+	return fuzzyHashCompare(c, a, fuzzyhash.TLSHDistance)
+}
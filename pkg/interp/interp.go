@@ -21,11 +21,13 @@ import (
 	"github.com/wader/fq/internal/ansi"
 	"github.com/wader/fq/internal/colorjson"
 	"github.com/wader/fq/internal/ctxstack"
+	"github.com/wader/fq/internal/gojqextra"
 	"github.com/wader/fq/internal/ioextra"
 	"github.com/wader/fq/internal/num"
 	"github.com/wader/fq/internal/pos"
 	"github.com/wader/fq/pkg/bitio"
 	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/logger"
 	"github.com/wader/fq/pkg/registry"
 
 	"github.com/wader/gojq"
@@ -43,6 +45,12 @@ import (
 //go:embed query.jq
 //go:embed repl.jq
 //go:embed formats.jq
+//go:embed pcm.jq
+//go:embed repr.jq
+//go:embed schema.jq
+//go:embed extract.jq
+//go:embed timecode.jq
+//go:embed testcorpus.jq
 var builtinFS embed.FS
 
 var initSource = `include "@builtin/interp";`
@@ -62,8 +70,7 @@ func init() {
 			{"_global_state", 0, 1, i.makeStateFn(i.state), nil},
 			{"history", 0, 0, i.history, nil},
 			{"_display", 1, 1, nil, i._display},
-			{"_can_display", 0, 0, i._canDisplay, nil},
-			{"_print_color_json", 0, 1, nil, i._printColorJSON},
+			{"_log_level_check", 0, 0, i._logLevelCheck, nil},
 		}
 	})
 }
@@ -141,6 +148,29 @@ type OS interface {
 	History() ([]string, error)
 }
 
+// OSWriter can optionally be implemented by OS to support writing files, ex extract_all
+type OSWriter interface {
+	MkdirAll(path string) error
+	Create(name string) (io.WriteCloser, error)
+}
+
+// OSExec can optionally be implemented by OS to support tempfile and exec
+type OSExec interface {
+	// TempFile creates a new file in a temporary directory private to the OS
+	// instance and returns its path, files are removed when the OS is closed
+	TempFile() (string, io.WriteCloser, error)
+	// Exec runs a command, only used if --allow-exec was used
+	Exec(ctx context.Context, name string, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error
+}
+
+// RealPathFS can optionally be implemented by the fs.FS returned by OS.FS() to
+// resolve a name to an absolute path with symlinks resolved. Used to check if a
+// file is inside the directories of the open_paths option.
+type RealPathFS interface {
+	fs.FS
+	RealPath(name string) (string, error)
+}
+
 type FixedFileInfo struct {
 	FName    string
 	FSize    int64
@@ -260,6 +290,20 @@ func toBigInt(v interface{}) (*big.Int, error) {
 	}
 }
 
+func toFloat(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f, nil
+	default:
+		return 0, fmt.Errorf("value is not a number")
+	}
+}
+
 func toBytes(v interface{}) ([]byte, error) {
 	switch v := v.(type) {
 	default:
@@ -322,6 +366,10 @@ type Interp struct {
 	interruptStack *ctxstack.Stack
 	// global state, is ref as Interp i cloned per eval
 	state *interface{}
+	// decoder counters for all decodes, only updated if decode_stats option is set
+	decodeStats *decode.Stats
+	// set once from command line arguments, shared by all clones
+	sandbox *sandbox
 
 	// new for each run, other values are copied by value
 	evalContext evalContext
@@ -350,6 +398,8 @@ func New(os OS, registry *registry.Registry) (*Interp, error) {
 		}
 	})
 	i.state = new(interface{})
+	i.decodeStats = decode.NewStats()
+	i.sandbox = &sandbox{}
 
 	return i, nil
 }
@@ -528,6 +578,18 @@ func (i *Interp) _extType(c interface{}, a []interface{}) interface{} {
 	return nil
 }
 
+// used to validate log level when parsing options, returns input if valid
+func (i *Interp) _logLevelCheck(c interface{}, a []interface{}) interface{} {
+	s, ok := c.(string)
+	if !ok {
+		return gojqextra.FuncTypeNameError{Name: "_log_level_check", Typ: "string"}
+	}
+	if _, err := logger.ParseLevel(s); err != nil {
+		return err
+	}
+	return s
+}
+
 func (i *Interp) makeStateFn(state *interface{}) func(c interface{}, a []interface{}) interface{} {
 	return func(c interface{}, a []interface{}) interface{} {
 		if len(a) > 0 {
@@ -574,34 +636,26 @@ func (i *Interp) history(c interface{}, a []interface{}) interface{} {
 func (i *Interp) _display(c interface{}, a []interface{}) gojq.Iter {
 	opts := i.Options(a[0])
 
-	switch v := c.(type) {
-	case Display:
-		if err := v.Display(i.evalContext.output, opts); err != nil {
-			return gojq.NewIter(err)
-		}
-		return gojq.NewIter()
-	default:
-		return gojq.NewIter(fmt.Errorf("%+#v: not displayable", c))
-	}
-}
-
-func (i *Interp) _printColorJSON(c interface{}, a []interface{}) gojq.Iter {
-	opts := i.Options(a[0])
-
-	cj, err := i.NewColorJSON(opts)
-	if err != nil {
+	if err := outputWrite(i.evalContext.output, c, opts); err != nil {
 		return gojq.NewIter(err)
 	}
-	if err := cj.Marshal(c, i.evalContext.output); err != nil {
-		return gojq.NewIter(err)
-	}
-
 	return gojq.NewIter()
 }
 
-func (i *Interp) _canDisplay(c interface{}, a []interface{}) interface{} {
-	_, ok := c.(Display)
-	return ok
+// logger writing to stderr, empty level means default warn level
+func (i *Interp) newLogger(level string, json bool) (*logger.Logger, error) {
+	return newLoggerWriter(i.os.Stderr(), level, json)
+}
+
+func newLoggerWriter(w io.Writer, level string, json bool) (*logger.Logger, error) {
+	l := logger.LevelWarn
+	if level != "" {
+		var err error
+		if l, err = logger.ParseLevel(level); err != nil {
+			return nil, err
+		}
+	}
+	return logger.New(w, l, json), nil
 }
 
 func (i *Interp) Eval(ctx context.Context, c interface{}, src string, srcFilename string, output io.Writer) (gojq.Iter, error) {
@@ -873,6 +927,7 @@ type Options struct {
 	Depth          int    `mapstructure:"depth"`
 	ArrayTruncate  int    `mapstructure:"array_truncate"`
 	Verbose        bool   `mapstructure:"verbose"`
+	RootRanges     bool   `mapstructure:"root_ranges"`
 	DecodeProgress bool   `mapstructure:"decode_progress"`
 	Color          bool   `mapstructure:"color"`
 	Colors         string `mapstructure:"colors"`
@@ -886,6 +941,9 @@ type Options struct {
 	BitsFormat     string `mapstructure:"bits_format"`
 	LineBytes      int    `mapstructure:"line_bytes"`
 	DisplayBytes   int    `mapstructure:"display_bytes"`
+	Output         string `mapstructure:"output"`
+	LogLevel       string `mapstructure:"log_level"`
+	LogJSON        bool   `mapstructure:"log_json"`
 	AddrBase       int    `mapstructure:"addrbase"`
 	SizeBase       int    `mapstructure:"sizebase"`
 
@@ -986,6 +1044,10 @@ func (i *Interp) Options(v interface{}) Options {
 }
 
 func (i *Interp) NewColorJSON(opts Options) (*colorjson.Encoder, error) {
+	return newColorJSON(opts)
+}
+
+func newColorJSON(opts Options) (*colorjson.Encoder, error) {
 	indent := 2
 	if opts.Compact {
 		indent = 0
@@ -0,0 +1,103 @@
+package interp
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// OutputWriter writes a value to w, it is used by display and is selected with
+// the output option.
+type OutputWriter func(w io.Writer, v interface{}, opts Options) error
+
+var outputWriters = map[string]OutputWriter{}
+
+// RegisterOutputWriter adds, or replaces, a named output writer
+func RegisterOutputWriter(name string, ow OutputWriter) {
+	outputWriters[name] = ow
+}
+
+func outputWriterNames() []string {
+	var names []string
+	for n := range outputWriters {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterOutputWriter("dump", dumpOutputWriter)
+	RegisterOutputWriter("json", jsonOutputWriter)
+	RegisterOutputWriter("hexdump", hexdumpOutputWriter)
+}
+
+// decode values are dumped, buffers hexdumped or copied as is if raw output and the rest as JSON
+func dumpOutputWriter(w io.Writer, v interface{}, opts Options) error {
+	if d, ok := v.(Display); ok {
+		return d.Display(w, opts)
+	}
+	return jsonOutputWriter(w, v, opts)
+}
+
+func jsonOutputWriter(w io.Writer, v interface{}, opts Options) error {
+	if s, ok := rawString(v, opts); ok {
+		if _, err := io.WriteString(w, s); err != nil {
+			return err
+		}
+	} else {
+		cj, err := newColorJSON(opts)
+		if err != nil {
+			return err
+		}
+		if err := cj.Marshal(v, w); err != nil {
+			return err
+		}
+	}
+	if opts.JoinString != "" {
+		if _, err := io.WriteString(w, opts.JoinString); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rawString(v interface{}, opts Options) (string, bool) {
+	if !opts.RawString {
+		return "", false
+	}
+	gv, ok := toValue(func() Options { return opts }, v)
+	if !ok {
+		return "", false
+	}
+	s, ok := gv.(string)
+	return s, ok
+}
+
+// values that can be turned into binary are hexdumped in full, rest as JSON
+func hexdumpOutputWriter(w io.Writer, v interface{}, opts Options) error {
+	switch v.(type) {
+	case ToBuffer, string:
+	default:
+		return jsonOutputWriter(w, v, opts)
+	}
+	bv, err := toBuffer(v)
+	if err != nil {
+		return err
+	}
+	opts.DisplayBytes = 0
+	return hexdump(w, bv, opts)
+}
+
+func outputWrite(w io.Writer, v interface{}, opts Options) error {
+	name := opts.Output
+	if name == "" {
+		name = "dump"
+	}
+	ow, ok := outputWriters[name]
+	if !ok {
+		return fmt.Errorf("%s: unknown output writer, available: %s", name, strings.Join(outputWriterNames(), ", "))
+	}
+	return ow(w, v, opts)
+}
@@ -0,0 +1,384 @@
+package interp
+
+// format string syntax similar to python struct module
+// https://docs.python.org/3/library/struct.html
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/wader/fq/pkg/bitio"
+)
+
+func init() {
+	functionRegisterFns = append(functionRegisterFns, func(i *Interp) []Function {
+		return []Function{
+			{"unpack", 1, 1, i.unpack, nil},
+			{"pack", 1, 2, i.pack, nil},
+		}
+	})
+}
+
+type packItem struct {
+	code  byte
+	count int
+	size  int // size of one item, for s and p total size
+}
+
+type packFormat struct {
+	order binary.ByteOrder
+	align bool
+	items []packItem
+}
+
+var packCodeSizes = map[byte]int{
+	'x': 1, 'c': 1, 'b': 1, 'B': 1, '?': 1,
+	'h': 2, 'H': 2, 'e': 2,
+	'i': 4, 'I': 4, 'l': 4, 'L': 4, 'f': 4,
+	'q': 8, 'Q': 8, 'd': 8,
+	's': 1, 'p': 1,
+}
+
+// limit size of formats as pack allocates the whole result
+const maxPackSize = 64 * 1024 * 1024
+
+func parsePackFormat(s string) (packFormat, error) {
+	// native byte order, standard sizes and natural alignment by default
+	pf := packFormat{order: binary.LittleEndian, align: true}
+	if len(s) > 0 {
+		switch s[0] {
+		case '@':
+			s = s[1:]
+		case '=':
+			pf.align = false
+			s = s[1:]
+		case '<':
+			pf.align = false
+			s = s[1:]
+		case '>', '!':
+			pf.order = binary.BigEndian
+			pf.align = false
+			s = s[1:]
+		}
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c == ' ' || c == '\t' || c == '\n' {
+			i++
+			continue
+		}
+		count := -1
+		for ; i < len(s) && s[i] >= '0' && s[i] <= '9'; i++ {
+			if count == -1 {
+				count = 0
+			}
+			count = count*10 + int(s[i]-'0')
+			if count > math.MaxInt32 {
+				return packFormat{}, fmt.Errorf("repeat count too large")
+			}
+		}
+		if i >= len(s) {
+			return packFormat{}, fmt.Errorf("repeat count without format character")
+		}
+		c = s[i]
+		i++
+		size, ok := packCodeSizes[c]
+		if !ok {
+			return packFormat{}, fmt.Errorf("bad format character %q", c)
+		}
+		if count == -1 {
+			count = 1
+		}
+		// s and p are one value with count as length
+		if c == 's' || c == 'p' {
+			pf.items = append(pf.items, packItem{code: c, count: 1, size: count})
+			continue
+		}
+		pf.items = append(pf.items, packItem{code: c, count: count, size: size})
+	}
+	if n := pf.size(); n > maxPackSize {
+		return packFormat{}, fmt.Errorf("format size %d larger than %d bytes", n, maxPackSize)
+	}
+
+	return pf, nil
+}
+
+// offset of item aligned to its size if alignment is used
+func (pf packFormat) alignOffset(offset int, it packItem) int {
+	if !pf.align || it.code == 's' || it.code == 'p' || it.size <= 1 {
+		return offset
+	}
+	return (offset + it.size - 1) / it.size * it.size
+}
+
+func (pf packFormat) size() int {
+	n := 0
+	for _, it := range pf.items {
+		n = pf.alignOffset(n, it) + it.count*it.size
+	}
+	return n
+}
+
+// number of values, pad bytes have no value
+func (pf packFormat) values() int {
+	n := 0
+	for _, it := range pf.items {
+		if it.code != 'x' {
+			n += it.count
+		}
+	}
+	return n
+}
+
+func float16ToFloat64(v uint16) float64 {
+	sign := 1.0
+	if v&0x8000 != 0 {
+		sign = -1
+	}
+	exp := int(v >> 10 & 0x1f)
+	frac := float64(v & 0x3ff)
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(frac, -24)
+	case 0x1f:
+		if frac != 0 {
+			return math.NaN()
+		}
+		return math.Inf(int(sign))
+	default:
+		return sign * math.Ldexp(1+frac/1024, exp-15)
+	}
+}
+
+func float64ToFloat16(f float64) uint16 {
+	var sign uint16
+	if math.Signbit(f) {
+		sign = 0x8000
+		f = -f
+	}
+	switch {
+	case math.IsNaN(f):
+		return 0x7e00
+	case math.IsInf(f, 0), f >= 65520:
+		return sign | 0x7c00
+	case f < math.Ldexp(1, -14):
+		// subnormal
+		return sign | uint16(math.RoundToEven(math.Ldexp(f, 24)))
+	}
+	frac, exp := math.Frexp(f)
+	// f = frac * 2^exp with frac in [0.5, 1), round mantissa to 10 bits
+	m := uint16(math.RoundToEven((frac*2 - 1) * 1024))
+	e := uint16(exp - 1 + 15)
+	if m == 1024 {
+		m = 0
+		e++
+	}
+	return sign | e<<10 | m
+}
+
+// unpack binary input into an array of values
+func (i *Interp) unpack(c interface{}, a []interface{}) interface{} {
+	fmtStr, err := toString(a[0])
+	if err != nil {
+		return err
+	}
+	pf, err := parsePackFormat(fmtStr)
+	if err != nil {
+		return err
+	}
+	b, err := toBytes(c)
+	if err != nil {
+		return err
+	}
+	if n := pf.size(); len(b) < n {
+		return fmt.Errorf("unpack requires %d bytes, has %d", n, len(b))
+	}
+
+	vs := []interface{}{}
+	offset := 0
+	for _, it := range pf.items {
+		offset = pf.alignOffset(offset, it)
+		for j := 0; j < it.count; j++ {
+			p := b[offset : offset+it.size]
+			offset += it.size
+
+			switch it.code {
+			case 'x':
+				continue
+			case 'c':
+				vs = append(vs, string(p))
+			case 's':
+				vs = append(vs, string(p))
+			case 'p':
+				// first byte is length, capped by field size
+				l := 0
+				if len(p) > 0 {
+					l = int(p[0])
+					if l > len(p)-1 {
+						l = len(p) - 1
+					}
+					p = p[1 : 1+l]
+				}
+				vs = append(vs, string(p))
+			case '?':
+				vs = append(vs, p[0] != 0)
+			case 'b':
+				vs = append(vs, int(int8(p[0])))
+			case 'B':
+				vs = append(vs, int(p[0]))
+			case 'h':
+				vs = append(vs, int(int16(pf.order.Uint16(p))))
+			case 'H':
+				vs = append(vs, int(pf.order.Uint16(p)))
+			case 'i', 'l':
+				vs = append(vs, int(int32(pf.order.Uint32(p))))
+			case 'I', 'L':
+				vs = append(vs, int(pf.order.Uint32(p)))
+			case 'q':
+				vs = append(vs, new(big.Int).SetInt64(int64(pf.order.Uint64(p))))
+			case 'Q':
+				vs = append(vs, new(big.Int).SetUint64(pf.order.Uint64(p)))
+			case 'e':
+				vs = append(vs, float16ToFloat64(pf.order.Uint16(p)))
+			case 'f':
+				vs = append(vs, float64(math.Float32frombits(pf.order.Uint32(p))))
+			case 'd':
+				vs = append(vs, math.Float64frombits(pf.order.Uint64(p)))
+			}
+		}
+	}
+
+	return vs
+}
+
+func packInt(v interface{}, code byte, min *big.Int, max *big.Int) (*big.Int, error) {
+	bi, err := toBigInt(v)
+	if err != nil {
+		return nil, fmt.Errorf("%c: %w", code, err)
+	}
+	if bi.Cmp(min) < 0 || bi.Cmp(max) > 0 {
+		return nil, fmt.Errorf("%c: %s out of range %s-%s", code, bi, min, max)
+	}
+	return bi, nil
+}
+
+var packIntRanges = map[byte][2]*big.Int{
+	'b': {big.NewInt(math.MinInt8), big.NewInt(math.MaxInt8)},
+	'B': {big.NewInt(0), big.NewInt(math.MaxUint8)},
+	'h': {big.NewInt(math.MinInt16), big.NewInt(math.MaxInt16)},
+	'H': {big.NewInt(0), big.NewInt(math.MaxUint16)},
+	'i': {big.NewInt(math.MinInt32), big.NewInt(math.MaxInt32)},
+	'I': {big.NewInt(0), big.NewInt(math.MaxUint32)},
+	'l': {big.NewInt(math.MinInt32), big.NewInt(math.MaxInt32)},
+	'L': {big.NewInt(0), big.NewInt(math.MaxUint32)},
+	'q': {big.NewInt(math.MinInt64), big.NewInt(math.MaxInt64)},
+	'Q': {big.NewInt(0), new(big.Int).SetUint64(math.MaxUint64)},
+}
+
+// pack array of values, input or second argument, into a binary
+func (i *Interp) pack(c interface{}, a []interface{}) interface{} {
+	fmtStr, err := toString(a[0])
+	if err != nil {
+		return err
+	}
+	pf, err := parsePackFormat(fmtStr)
+	if err != nil {
+		return err
+	}
+	valuesV := c
+	if len(a) == 2 {
+		valuesV = a[1]
+	}
+	values, ok := valuesV.([]interface{})
+	if !ok {
+		return fmt.Errorf("values should be an array")
+	}
+	if n := pf.values(); len(values) != n {
+		return fmt.Errorf("pack requires %d values, got %d", n, len(values))
+	}
+
+	b := make([]byte, pf.size())
+	offset := 0
+	vi := 0
+	for _, it := range pf.items {
+		offset = pf.alignOffset(offset, it)
+		for j := 0; j < it.count; j++ {
+			p := b[offset : offset+it.size]
+			offset += it.size
+			if it.code == 'x' {
+				continue
+			}
+			v := values[vi]
+			vi++
+
+			switch it.code {
+			case 'c', 's', 'p':
+				s, err := toString(v)
+				if err != nil {
+					return fmt.Errorf("%c: %w", it.code, err)
+				}
+				switch it.code {
+				case 'c':
+					if len(s) != 1 {
+						return fmt.Errorf("c: requires a string of length 1")
+					}
+					copy(p, s)
+				case 's':
+					copy(p, s)
+				case 'p':
+					if len(p) > 0 {
+						// length byte limits data to 255 bytes, rest is zero padding
+						if len(s) > 255 {
+							s = s[:255]
+						}
+						p[0] = byte(copy(p[1:], s))
+					}
+				}
+			case '?':
+				if bv, ok := v.(bool); ok && bv {
+					p[0] = 1
+				} else if !ok && v != nil {
+					return fmt.Errorf("?: value should be a boolean")
+				}
+			case 'e', 'f', 'd':
+				f, err := toFloat(v)
+				if err != nil {
+					return fmt.Errorf("%c: %w", it.code, err)
+				}
+				switch it.code {
+				case 'e':
+					pf.order.PutUint16(p, float64ToFloat16(f))
+				case 'f':
+					pf.order.PutUint32(p, math.Float32bits(float32(f)))
+				case 'd':
+					pf.order.PutUint64(p, math.Float64bits(f))
+				}
+			default:
+				r := packIntRanges[it.code]
+				bi, err := packInt(v, it.code, r[0], r[1])
+				if err != nil {
+					return err
+				}
+				// two's complement for negative values
+				u := new(big.Int).Set(bi)
+				if u.Sign() < 0 {
+					u.Add(u, new(big.Int).Lsh(big.NewInt(1), uint(it.size*8)))
+				}
+				switch it.size {
+				case 1:
+					p[0] = byte(u.Uint64())
+				case 2:
+					pf.order.PutUint16(p, uint16(u.Uint64()))
+				case 4:
+					pf.order.PutUint32(p, uint32(u.Uint64()))
+				case 8:
+					pf.order.PutUint64(p, u.Uint64())
+				}
+			}
+		}
+	}
+	return newBufferFromBuffer(bitio.NewBufferFromBytes(b, -1), 8)
+}
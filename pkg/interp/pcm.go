@@ -0,0 +1,271 @@
+package interp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/wader/gojq"
+)
+
+func init() {
+	functionRegisterFns = append(functionRegisterFns, func(i *Interp) []Function {
+		return []Function{
+			{"_pcm_samples", 1, 1, nil, i._pcmSamples},
+			{"_pcm_stats", 1, 1, i._pcmStats, nil},
+			{"_pcm_silence", 1, 1, i._pcmSilence, nil},
+		}
+	})
+}
+
+type pcmOptions struct {
+	Bits       int     `mapstructure:"bits"`
+	Channels   int     `mapstructure:"channels"`
+	SampleRate float64 `mapstructure:"sample_rate"`
+	Unsigned   bool    `mapstructure:"unsigned"`
+	BigEndian  bool    `mapstructure:"big_endian"`
+	Float      bool    `mapstructure:"float"`
+	// silence detection
+	Threshold   float64 `mapstructure:"threshold"`
+	MinDuration float64 `mapstructure:"min_duration"`
+}
+
+// interleaved PCM samples
+type pcm struct {
+	opts           pcmOptions
+	b              []byte
+	bytesPerSample int
+	frames         int
+}
+
+func newPCM(c interface{}, optsV interface{}) (*pcm, error) {
+	var opts pcmOptions
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result: &opts,
+		// numbers from decode values are big ints
+		DecodeHook: func(_ reflect.Type, _ reflect.Type, v interface{}) (interface{}, error) {
+			if bi, ok := v.(*big.Int); ok {
+				return bi.Int64(), nil
+			}
+			return v, nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := dec.Decode(optsV); err != nil {
+		return nil, err
+	}
+	switch {
+	case opts.Float && (opts.Bits == 32 || opts.Bits == 64):
+	case !opts.Float && opts.Bits >= 8 && opts.Bits <= 32 && opts.Bits%8 == 0:
+	default:
+		return nil, fmt.Errorf("unsupported sample size %d bits", opts.Bits)
+	}
+	if opts.Channels <= 0 {
+		return nil, fmt.Errorf("invalid number of channels %d", opts.Channels)
+	}
+	b, err := toBytes(c)
+	if err != nil {
+		return nil, err
+	}
+	bytesPerSample := opts.Bits / 8
+
+	return &pcm{
+		opts:           opts,
+		b:              b,
+		bytesPerSample: bytesPerSample,
+		frames:         len(b) / (bytesPerSample * opts.Channels),
+	}, nil
+}
+
+// raw sample value, integers are sign extended and unsigned ones centered at zero
+func (p *pcm) sample(frame int, channel int) float64 {
+	o := (frame*p.opts.Channels + channel) * p.bytesPerSample
+	b := p.b[o : o+p.bytesPerSample]
+	var bo binary.ByteOrder = binary.LittleEndian
+	if p.opts.BigEndian {
+		bo = binary.BigEndian
+	}
+
+	if p.opts.Float {
+		if p.opts.Bits == 32 {
+			return float64(math.Float32frombits(bo.Uint32(b)))
+		}
+		return math.Float64frombits(bo.Uint64(b))
+	}
+
+	var u uint64
+	for i := 0; i < len(b); i++ {
+		if p.opts.BigEndian {
+			u = u<<8 | uint64(b[i])
+		} else {
+			u |= uint64(b[i]) << (8 * i)
+		}
+	}
+	if p.opts.Unsigned {
+		return float64(int64(u) - int64(1)<<(p.opts.Bits-1))
+	}
+	shift := 64 - p.opts.Bits
+	return float64(int64(u<<shift) >> shift)
+}
+
+// full scale magnitude used to normalize sample values to -1..1
+func (p *pcm) fullScale() float64 {
+	if p.opts.Float {
+		return 1
+	}
+	return float64(int64(1) << (p.opts.Bits - 1))
+}
+
+func toDB(v float64) float64 {
+	if v == 0 {
+		return math.Inf(-1)
+	}
+	return 20 * math.Log10(v)
+}
+
+// -inf is not valid JSON
+func dbValue(v float64) interface{} {
+	if math.IsInf(v, -1) {
+		return nil
+	}
+	return v
+}
+
+func (i *Interp) _pcmSamples(c interface{}, a []interface{}) gojq.Iter {
+	p, err := newPCM(c, a[0])
+	if err != nil {
+		return gojq.NewIter(err)
+	}
+
+	frame := 0
+	return iterFn(func() (interface{}, bool) {
+		if frame >= p.frames {
+			return nil, false
+		}
+		vs := make([]interface{}, p.opts.Channels)
+		for ch := 0; ch < p.opts.Channels; ch++ {
+			s := p.sample(frame, ch)
+			if p.opts.Float {
+				vs[ch] = s
+			} else {
+				vs[ch] = int(s)
+			}
+		}
+		frame++
+		return vs, true
+	})
+}
+
+func (i *Interp) _pcmStats(c interface{}, a []interface{}) interface{} {
+	p, err := newPCM(c, a[0])
+	if err != nil {
+		return err
+	}
+
+	fullScale := p.fullScale()
+	var channels []interface{}
+	for ch := 0; ch < p.opts.Channels; ch++ {
+		var peak float64
+		var sum float64
+		var sumSquares float64
+		clipped := 0
+		for f := 0; f < p.frames; f++ {
+			s := p.sample(f, ch) / fullScale
+			if math.Abs(s) > peak {
+				peak = math.Abs(s)
+			}
+			sum += s
+			sumSquares += s * s
+			// integer samples at most negative or positive value, float at or over full scale
+			if s >= 1 || s <= -1 || (!p.opts.Float && s >= (fullScale-1)/fullScale) {
+				clipped++
+			}
+		}
+		var rms, dcOffset float64
+		if p.frames > 0 {
+			rms = math.Sqrt(sumSquares / float64(p.frames))
+			dcOffset = sum / float64(p.frames)
+		}
+		channels = append(channels, map[string]interface{}{
+			"peak":      peak,
+			"peak_db":   dbValue(toDB(peak)),
+			"rms":       rms,
+			"rms_db":    dbValue(toDB(rms)),
+			"dc_offset": dcOffset,
+			"clipped":   clipped,
+		})
+	}
+
+	r := map[string]interface{}{
+		"frames":   p.frames,
+		"channels": channels,
+	}
+	if p.opts.SampleRate > 0 {
+		r["duration"] = float64(p.frames) / p.opts.SampleRate
+	}
+
+	return r
+}
+
+func (i *Interp) _pcmSilence(c interface{}, a []interface{}) interface{} {
+	p, err := newPCM(c, a[0])
+	if err != nil {
+		return err
+	}
+
+	threshold := math.Pow(10, p.opts.Threshold/20) * p.fullScale()
+	minFrames := int(p.opts.MinDuration)
+	if p.opts.SampleRate > 0 {
+		minFrames = int(p.opts.MinDuration * p.opts.SampleRate)
+	}
+	if minFrames < 1 {
+		minFrames = 1
+	}
+
+	var ranges []interface{}
+	addRange := func(start, stop int) {
+		if stop-start < minFrames {
+			return
+		}
+		r := map[string]interface{}{
+			"start": start,
+			"stop":  stop,
+		}
+		if p.opts.SampleRate > 0 {
+			r["start_time"] = float64(start) / p.opts.SampleRate
+			r["stop_time"] = float64(stop) / p.opts.SampleRate
+		}
+		ranges = append(ranges, r)
+	}
+
+	start := -1
+	for f := 0; f < p.frames; f++ {
+		silent := true
+		for ch := 0; ch < p.opts.Channels; ch++ {
+			if math.Abs(p.sample(f, ch)) > threshold {
+				silent = false
+				break
+			}
+		}
+		switch {
+		case silent && start == -1:
+			start = f
+		case !silent && start != -1:
+			addRange(start, f)
+			start = -1
+		}
+	}
+	if start != -1 {
+		addRange(start, p.frames)
+	}
+
+	if ranges == nil {
+		return []interface{}{}
+	}
+	return ranges
+}
@@ -0,0 +1,101 @@
+package interp
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	functionRegisterFns = append(functionRegisterFns, func(i *Interp) []Function {
+		return []Function{
+			{"_sandbox_set", 1, 1, i._sandboxSet, nil},
+		}
+	})
+}
+
+// sandbox restricts what queries are allowed to do. It is set once by _main from
+// command line arguments before any query is evaluated and can't be changed
+// after that, so it is not affected by options set by queries.
+type sandbox struct {
+	set        bool
+	allowExec  bool
+	allowWrite bool
+	// directories separated by os.PathListSeparator, nil means no restriction
+	openPaths *string
+	// files from command line arguments are not restricted by openPaths
+	argPaths map[string]bool
+}
+
+// openAllowed returns true if path can be opened using fsys
+func (sb *sandbox) openAllowed(fsys fs.FS, path string) bool {
+	if sb.openPaths == nil || sb.argPaths[path] {
+		return true
+	}
+	return pathAllowed(fsys, path, *sb.openPaths)
+}
+
+// writeAllowed returns an error if queries are not allowed to write files
+func (sb *sandbox) writeAllowed() error {
+	if !sb.allowWrite {
+		return fmt.Errorf("write not allowed, use --allow-write or -o allow_write=true")
+	}
+	return nil
+}
+
+// pathAllowed returns true if path is below one of the directories in
+// allowedPaths, a list separated by os.PathListSeparator. If fsys implements
+// RealPathFS paths are resolved by it so that symlinks can't be used to escape,
+// otherwise paths are only cleaned.
+func pathAllowed(fsys fs.FS, path string, allowedPaths string) bool {
+	resolve := func(p string) string {
+		if rfs, ok := fsys.(RealPathFS); ok {
+			if rp, err := rfs.RealPath(p); err == nil {
+				return rp
+			}
+		}
+		return filepath.Clean(p)
+	}
+
+	p := resolve(path)
+	for _, dir := range filepath.SplitList(allowedPaths) {
+		rel, err := filepath.Rel(resolve(dir), p)
+		if err != nil {
+			continue
+		}
+		if rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// {allow_exec: bool, allow_write: bool, open_paths: string, arg_paths: [string]} | _sandbox_set -> null
+func (i *Interp) _sandboxSet(c interface{}, a []interface{}) interface{} {
+	if i.sandbox.set {
+		return fmt.Errorf("sandbox already set")
+	}
+	i.sandbox.set = true
+
+	m, ok := a[0].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%v: value is not an object", a[0])
+	}
+	i.sandbox.allowExec, _ = m["allow_exec"].(bool)
+	i.sandbox.allowWrite, _ = m["allow_write"].(bool)
+	if openPaths, ok := m["open_paths"].(string); ok {
+		i.sandbox.openPaths = &openPaths
+	}
+	i.sandbox.argPaths = map[string]bool{}
+	if argPaths, ok := m["arg_paths"].([]interface{}); ok {
+		for _, ap := range argPaths {
+			if s, ok := ap.(string); ok {
+				i.sandbox.argPaths[s] = true
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package interp
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+
+	"github.com/wader/gojq"
+)
+
+func init() {
+	functionRegisterFns = append(functionRegisterFns, func(i *Interp) []Function {
+		return []Function{
+			{"_dir_files", 1, 1, nil, i._dirFiles},
+		}
+	})
+}
+
+// _dir_files($dir) -> "a", "b/c", ...
+// recursively lists regular files in $dir in lexical order as slash separated
+// paths relative to $dir. Files outside of open_paths are skipped.
+func (i *Interp) _dirFiles(c interface{}, a []interface{}) gojq.Iter {
+	dir, err := toString(a[0])
+	if err != nil {
+		return gojq.NewIter(fmt.Errorf("dir: %w", err))
+	}
+	dir = path.Clean(dir)
+	fsys := i.os.FS()
+	if !i.sandbox.openAllowed(fsys, dir) {
+		return gojq.NewIter(fmt.Errorf("open %s: outside of allowed paths (open_paths option)", dir))
+	}
+
+	var names []interface{}
+	if err := fs.WalkDir(fsys, dir, func(p string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !de.Type().IsRegular() || !i.sandbox.openAllowed(fsys, p) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	}); err != nil {
+		return gojq.NewIter(err)
+	}
+
+	return gojq.NewIter(names...)
+}
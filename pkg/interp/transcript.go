@@ -0,0 +1,101 @@
+package interp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+func init() {
+	functionRegisterFns = append(functionRegisterFns, func(i *Interp) []Function {
+		return []Function{
+			{"_transcript_display", 2, 2, i._transcriptDisplay, nil},
+			{"_transcript_write", 1, 1, i._transcriptWrite, nil},
+		}
+	})
+}
+
+// transcriptWriter keeps the first maxLines lines written to it without ANSI
+// escape sequences and counts the rest
+type transcriptWriter struct {
+	maxLines int
+	lines    int
+	midLine  bool
+	inANSI   bool
+	buf      bytes.Buffer
+}
+
+func (tw *transcriptWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		switch {
+		case tw.inANSI:
+			tw.inANSI = b != 'm'
+		case b == '\x1b':
+			tw.inANSI = true
+		default:
+			if !tw.midLine {
+				tw.lines++
+			}
+			tw.midLine = b != '\n'
+			if tw.lines <= tw.maxLines {
+				tw.buf.WriteByte(b)
+			}
+		}
+	}
+	return len(p), nil
+}
+
+func (tw *transcriptWriter) String() string {
+	if tw.lines > tw.maxLines {
+		return tw.buf.String() + fmt.Sprintf("... (%d more lines)\n", tw.lines-tw.maxLines)
+	}
+	return tw.buf.String()
+}
+
+// value | _transcript_display($opts; $max_lines) -> display value and return
+// output as string without color truncated to $max_lines lines
+func (i *Interp) _transcriptDisplay(c interface{}, a []interface{}) interface{} {
+	opts := i.Options(a[0])
+	maxLines, err := toFloat(a[1])
+	if err != nil {
+		return err
+	}
+	tw := &transcriptWriter{maxLines: int(maxLines)}
+	if err := outputWrite(io.MultiWriter(i.evalContext.output, tw), c, opts); err != nil {
+		return err
+	}
+
+	return tw.String()
+}
+
+// string | _transcript_write($path) -> $path
+func (i *Interp) _transcriptWrite(c interface{}, a []interface{}) interface{} {
+	if err := i.sandbox.writeAllowed(); err != nil {
+		return err
+	}
+	s, err := toString(c)
+	if err != nil {
+		return err
+	}
+	p, err := toString(a[0])
+	if err != nil {
+		return err
+	}
+	w, err := i.osWriter()
+	if err != nil {
+		return err
+	}
+	f, err := w.Create(p)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, s); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return p
+}
@@ -0,0 +1,154 @@
+// Package logger is a small leveled logger with key/value fields that writes
+// either logfmt style text or JSON lines.
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelOff
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+	LevelOff:   "off",
+}
+
+func (l Level) String() string {
+	if s, ok := levelNames[l]; ok {
+		return s
+	}
+	return strconv.Itoa(int(l))
+}
+
+func ParseLevel(s string) (Level, error) {
+	for l, n := range levelNames {
+		if strings.EqualFold(s, n) {
+			return l, nil
+		}
+	}
+	return LevelOff, fmt.Errorf("%s: unknown log level, valid: debug, info, warn, error, off", s)
+}
+
+// Logger writes one line per log call if level is enabled.
+// A nil *Logger is valid and logs nothing.
+type Logger struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	level  Level
+	json   bool
+	fields []interface{}
+}
+
+func New(w io.Writer, level Level, json bool) *Logger {
+	return &Logger{
+		mu:    &sync.Mutex{},
+		w:     w,
+		level: level,
+		json:  json,
+	}
+}
+
+// With returns a logger that adds key/value pairs to all messages
+func (l *Logger) With(kvs ...interface{}) *Logger {
+	if l == nil {
+		return nil
+	}
+	nl := *l
+	nl.fields = append(append([]interface{}{}, l.fields...), kvs...)
+	return &nl
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	return l != nil && level != LevelOff && level >= l.level
+}
+
+func (l *Logger) Debug(msg string, kvs ...interface{}) { l.Log(LevelDebug, msg, kvs...) }
+func (l *Logger) Info(msg string, kvs ...interface{})  { l.Log(LevelInfo, msg, kvs...) }
+func (l *Logger) Warn(msg string, kvs ...interface{})  { l.Log(LevelWarn, msg, kvs...) }
+func (l *Logger) Error(msg string, kvs ...interface{}) { l.Log(LevelError, msg, kvs...) }
+
+func (l *Logger) Log(level Level, msg string, kvs ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	all := append([]interface{}{"level", level.String(), "msg", msg}, l.fields...)
+	all = append(all, kvs...)
+	// odd number of arguments, last key has no value
+	if len(all)%2 != 0 {
+		all = append(all, nil)
+	}
+
+	b := &bytes.Buffer{}
+	if l.json {
+		writeJSON(b, all)
+	} else {
+		writeText(b, all)
+	}
+	b.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.w.Write(b.Bytes())
+}
+
+func toSimple(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return v
+	}
+}
+
+func writeText(b *bytes.Buffer, kvs []interface{}) {
+	for i := 0; i < len(kvs); i += 2 {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprint(b, kvs[i])
+		b.WriteByte('=')
+		s := fmt.Sprint(toSimple(kvs[i+1]))
+		if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+			s = strconv.Quote(s)
+		}
+		b.WriteString(s)
+	}
+}
+
+func writeJSON(b *bytes.Buffer, kvs []interface{}) {
+	b.WriteByte('{')
+	for i := 0; i < len(kvs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		kb, _ := json.Marshal(fmt.Sprint(kvs[i]))
+		b.Write(kb)
+		b.WriteByte(':')
+		vb, err := json.Marshal(toSimple(kvs[i+1]))
+		if err != nil {
+			vb, _ = json.Marshal(fmt.Sprint(kvs[i+1]))
+		}
+		b.Write(vb)
+	}
+	b.WriteByte('}')
+}
@@ -0,0 +1,55 @@
+package logger_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/wader/fq/pkg/logger"
+)
+
+func TestLogger(t *testing.T) {
+	testCases := []struct {
+		level    logger.Level
+		json     bool
+		expected string
+	}{
+		{logger.LevelDebug, false, "" +
+			"level=debug msg=a format=test n=1\n" +
+			"level=warn msg=\"b c\" format=test err=\"some error\" s=\"\"\n"},
+		{logger.LevelWarn, false, "" +
+			"level=warn msg=\"b c\" format=test err=\"some error\" s=\"\"\n"},
+		{logger.LevelWarn, true, "" +
+			`{"level":"warn","msg":"b c","format":"test","err":"some error","s":""}` + "\n"},
+		{logger.LevelOff, false, ""},
+	}
+	for _, tC := range testCases {
+		tC := tC
+		t.Run(tC.level.String(), func(t *testing.T) {
+			b := &bytes.Buffer{}
+			l := logger.New(b, tC.level, tC.json).With("format", "test")
+			l.Debug("a", "n", 1)
+			l.Warn("b c", "err", errors.New("some error"), "s", "")
+			if b.String() != tC.expected {
+				t.Errorf("expected %q got %q", tC.expected, b.String())
+			}
+		})
+	}
+}
+
+func TestNilLogger(t *testing.T) {
+	var l *logger.Logger
+	l.With("a", 1).Error("b")
+	if l.Enabled(logger.LevelError) {
+		t.Error("expected nil logger to be disabled")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if l, err := logger.ParseLevel("DEBUG"); err != nil || l != logger.LevelDebug {
+		t.Errorf("expected debug got %v %v", l, err)
+	}
+	if _, err := logger.ParseLevel("bad"); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,609 @@
+package qrcode
+
+// ECC200 DataMatrix
+// https://en.wikipedia.org/wiki/Data_Matrix
+// ISO/IEC 16022:2006
+// https://github.com/dmtx/libdmtx
+
+// TODO: perspective correction and non-right angle rotations
+// TODO: ECC000-140 symbols
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+)
+
+type dataMatrixSymbol struct {
+	rows, cols             int // including finder and alignment patterns
+	regionRows, regionCols int // size of each data region
+	dataCodewords          int
+	eccCodewords           int
+	blocks                 int
+}
+
+var dataMatrixSymbols = []dataMatrixSymbol{
+	{10, 10, 8, 8, 3, 5, 1},
+	{12, 12, 10, 10, 5, 7, 1},
+	{14, 14, 12, 12, 8, 10, 1},
+	{16, 16, 14, 14, 12, 12, 1},
+	{18, 18, 16, 16, 18, 14, 1},
+	{20, 20, 18, 18, 22, 18, 1},
+	{22, 22, 20, 20, 30, 20, 1},
+	{24, 24, 22, 22, 36, 24, 1},
+	{26, 26, 24, 24, 44, 28, 1},
+	{32, 32, 14, 14, 62, 36, 1},
+	{36, 36, 16, 16, 86, 42, 1},
+	{40, 40, 18, 18, 114, 48, 1},
+	{44, 44, 20, 20, 144, 56, 1},
+	{48, 48, 22, 22, 174, 68, 1},
+	{52, 52, 24, 24, 204, 84, 2},
+	{64, 64, 14, 14, 280, 112, 2},
+	{72, 72, 16, 16, 368, 144, 4},
+	{80, 80, 18, 18, 456, 192, 4},
+	{88, 88, 20, 20, 576, 224, 4},
+	{96, 96, 22, 22, 696, 272, 4},
+	{104, 104, 24, 24, 816, 336, 6},
+	{120, 120, 18, 18, 1050, 408, 6},
+	{132, 132, 20, 20, 1304, 496, 8},
+	{144, 144, 22, 22, 1558, 620, 10},
+	{8, 18, 6, 16, 5, 7, 1},
+	{8, 32, 6, 14, 10, 11, 1},
+	{12, 26, 10, 24, 16, 14, 1},
+	{12, 36, 10, 16, 22, 18, 1},
+	{16, 36, 14, 16, 32, 24, 1},
+	{16, 48, 14, 22, 49, 28, 1},
+}
+
+func findDataMatrixSymbol(rows, cols int) (dataMatrixSymbol, bool) {
+	for _, s := range dataMatrixSymbols {
+		if s.rows == rows && s.cols == cols {
+			return s, true
+		}
+	}
+	return dataMatrixSymbol{}, false
+}
+
+// dataMatrixPlacement returns bit positions for each module in the mapping
+// matrix (symbol without finder and alignment patterns) using the "utah"
+// placement algorithm. Values are codeword<<3|bit where bit 0 is the most
+// significant, -1 is a fixed module not used for data.
+func dataMatrixPlacement(nrow, ncol int) []int {
+	m := make([]int, nrow*ncol)
+	for i := range m {
+		m[i] = -2
+	}
+	module := func(row, col, chr, bit int) {
+		if row < 0 {
+			row += nrow
+			col += 4 - ((nrow + 4) % 8)
+		}
+		if col < 0 {
+			col += ncol
+			row += 4 - ((ncol + 4) % 8)
+		}
+		m[row*ncol+col] = chr<<3 | bit
+	}
+	utah := func(row, col, chr int) {
+		module(row-2, col-2, chr, 0)
+		module(row-2, col-1, chr, 1)
+		module(row-1, col-2, chr, 2)
+		module(row-1, col-1, chr, 3)
+		module(row-1, col, chr, 4)
+		module(row, col-2, chr, 5)
+		module(row, col-1, chr, 6)
+		module(row, col, chr, 7)
+	}
+	corner := func(chr int, positions [8][2]int) {
+		for bit, p := range positions {
+			module(p[0], p[1], chr, bit)
+		}
+	}
+	isSet := func(row, col int) bool { return m[row*ncol+col] != -2 }
+
+	chr := 0
+	row, col := 4, 0
+	for row < nrow || col < ncol {
+		if row == nrow && col == 0 {
+			corner(chr, [8][2]int{{nrow - 1, 0}, {nrow - 1, 1}, {nrow - 1, 2}, {0, ncol - 2}, {0, ncol - 1}, {1, ncol - 1}, {2, ncol - 1}, {3, ncol - 1}})
+			chr++
+		}
+		if row == nrow-2 && col == 0 && ncol%4 != 0 {
+			corner(chr, [8][2]int{{nrow - 3, 0}, {nrow - 2, 0}, {nrow - 1, 0}, {0, ncol - 4}, {0, ncol - 3}, {0, ncol - 2}, {0, ncol - 1}, {1, ncol - 1}})
+			chr++
+		}
+		if row == nrow-2 && col == 0 && ncol%8 == 4 {
+			corner(chr, [8][2]int{{nrow - 3, 0}, {nrow - 2, 0}, {nrow - 1, 0}, {0, ncol - 2}, {0, ncol - 1}, {1, ncol - 1}, {2, ncol - 1}, {3, ncol - 1}})
+			chr++
+		}
+		if row == nrow+4 && col == 2 && ncol%8 == 0 {
+			corner(chr, [8][2]int{{nrow - 1, 0}, {nrow - 1, ncol - 1}, {0, ncol - 3}, {0, ncol - 2}, {0, ncol - 1}, {1, ncol - 3}, {1, ncol - 2}, {1, ncol - 1}})
+			chr++
+		}
+		// sweep up right
+		for {
+			if row < nrow && col >= 0 && !isSet(row, col) {
+				utah(row, col, chr)
+				chr++
+			}
+			row -= 2
+			col += 2
+			if row < 0 || col >= ncol {
+				break
+			}
+		}
+		row++
+		col += 3
+		// sweep down left
+		for {
+			if row >= 0 && col < ncol && !isSet(row, col) {
+				utah(row, col, chr)
+				chr++
+			}
+			row += 2
+			col -= 2
+			if row >= nrow || col < 0 {
+				break
+			}
+		}
+		row += 3
+		col++
+	}
+	// unused bottom right corner is a fixed pattern
+	for i := range m {
+		if m[i] == -2 {
+			m[i] = -1
+		}
+	}
+
+	return m
+}
+
+// dmGrid is a sampled DataMatrix symbol, true is dark
+type dmGrid struct {
+	rows, cols int
+	modules    [][]bool
+}
+
+func newDMGrid(rows, cols int) dmGrid {
+	g := dmGrid{rows: rows, cols: cols, modules: make([][]bool, rows)}
+	for y := range g.modules {
+		g.modules[y] = make([]bool, cols)
+	}
+	return g
+}
+
+// rotate 90 degrees clockwise
+func (g dmGrid) rotate() dmGrid {
+	r := newDMGrid(g.cols, g.rows)
+	for y := 0; y < r.rows; y++ {
+		for x := 0; x < r.cols; x++ {
+			r.modules[y][x] = g.modules[g.rows-1-x][y]
+		}
+	}
+	return r
+}
+
+// finderScore is the fraction of border modules that match the solid left and
+// bottom edges and the alternating top and right edges
+func (g dmGrid) finderScore() float64 {
+	match, total := 0, 0
+	check := func(b bool) {
+		total++
+		if b {
+			match++
+		}
+	}
+	for y := 0; y < g.rows; y++ {
+		check(g.modules[y][0])
+		check(g.modules[y][g.cols-1] == (y%2 == 1))
+	}
+	for x := 0; x < g.cols; x++ {
+		check(g.modules[g.rows-1][x])
+		check(g.modules[0][x] == (x%2 == 0))
+	}
+	return float64(match) / float64(total)
+}
+
+func (g dmGrid) decode() ([]byte, error) {
+	sym, ok := findDataMatrixSymbol(g.rows, g.cols)
+	if !ok {
+		return nil, fmt.Errorf("invalid DataMatrix size %dx%d", g.rows, g.cols)
+	}
+
+	// mapping matrix is the data regions without their finder and alignment patterns
+	nrow := g.rows / (sym.regionRows + 2) * sym.regionRows
+	ncol := g.cols / (sym.regionCols + 2) * sym.regionCols
+	placement := dataMatrixPlacement(nrow, ncol)
+	numCodewords := sym.dataCodewords + sym.eccCodewords
+	raw := make([]byte, numCodewords)
+	for row := 0; row < nrow; row++ {
+		for col := 0; col < ncol; col++ {
+			p := placement[row*ncol+col]
+			if p < 0 || p>>3 >= numCodewords {
+				continue
+			}
+			y := row + 2*(row/sym.regionRows) + 1
+			x := col + 2*(col/sym.regionCols) + 1
+			if g.modules[y][x] {
+				raw[p>>3] |= 0x80 >> (p & 7)
+			}
+		}
+	}
+
+	// blocks are interleaved codeword by codeword, data and error correction
+	// separately. For 144x144 the first blocks have one more data codeword.
+	numECC := sym.eccCodewords / sym.blocks
+	blocks := make([][]byte, sym.blocks)
+	for i := 0; i < sym.dataCodewords; i++ {
+		blocks[i%sym.blocks] = append(blocks[i%sym.blocks], raw[i])
+	}
+	for i := 0; i < sym.eccCodewords; i++ {
+		blocks[i%sym.blocks] = append(blocks[i%sym.blocks], raw[sym.dataCodewords+i])
+	}
+	for _, b := range blocks {
+		if _, err := dataMatrixField.rsCorrect(b, numECC, 1); err != nil {
+			return nil, err
+		}
+	}
+	data := make([]byte, sym.dataCodewords)
+	for i := range data {
+		data[i] = blocks[i%sym.blocks][i/sym.blocks]
+	}
+
+	return decodeDataMatrixCodewords(data)
+}
+
+var errDataMatrixTruncated = errors.New("truncated DataMatrix data")
+
+const (
+	dmEncodationASCII = iota
+	dmEncodationC40
+	dmEncodationText
+	dmEncodationX12
+	dmEncodationEDIFACT
+	dmEncodationBase256
+)
+
+var dmC40Shift2 = []byte("!\"#$%&'()*+,-./:;<=>?@[\\]^_")
+
+// decodeDataMatrixCodewords decodes data codewords into payload bytes
+func decodeDataMatrixCodewords(data []byte) ([]byte, error) {
+	var out []byte
+	var trailer []byte
+	upperShift := false
+	emit := func(c byte) {
+		if upperShift {
+			c += 128
+			upperShift = false
+		}
+		out = append(out, c)
+	}
+
+	mode := dmEncodationASCII
+	i := 0
+	for i < len(data) {
+		switch mode {
+		case dmEncodationASCII:
+			c := data[i]
+			i++
+			switch {
+			case c >= 1 && c <= 128:
+				emit(c - 1)
+			case c == 129:
+				// pad, rest is randomized padding
+				return append(out, trailer...), nil
+			case c >= 130 && c <= 229:
+				v := c - 130
+				emit('0' + v/10)
+				emit('0' + v%10)
+			case c == 230:
+				mode = dmEncodationC40
+			case c == 231:
+				mode = dmEncodationBase256
+			case c == 232:
+				// FNC1, first position means GS1 and is not part of the data
+				if i > 1 {
+					emit(0x1d)
+				}
+			case c == 233:
+				// structured append, symbol sequence and file identification
+				i += 3
+			case c == 234:
+				// reader programming
+			case c == 235:
+				upperShift = true
+			case c == 236, c == 237:
+				header := "[)>\x1e05\x1d"
+				if c == 237 {
+					header = "[)>\x1e06\x1d"
+				}
+				out = append(out, header...)
+				trailer = []byte("\x1e\x04")
+			case c == 238:
+				mode = dmEncodationX12
+			case c == 239:
+				mode = dmEncodationText
+			case c == 240:
+				mode = dmEncodationEDIFACT
+			case c == 241:
+				// ECI designator, 1 to 3 codewords
+				if i >= len(data) {
+					return nil, errDataMatrixTruncated
+				}
+				switch {
+				case data[i] <= 127:
+					i++
+				case data[i] <= 191:
+					i += 2
+				default:
+					i += 3
+				}
+			default:
+				return nil, fmt.Errorf("invalid DataMatrix ASCII codeword %d", c)
+			}
+
+		case dmEncodationC40, dmEncodationText:
+			shift := 0
+			for mode != dmEncodationASCII && i < len(data) {
+				if data[i] == 254 {
+					i++
+					mode = dmEncodationASCII
+					break
+				}
+				if i+1 >= len(data) {
+					return nil, errDataMatrixTruncated
+				}
+				v := int(data[i])<<8 | int(data[i+1])
+				v--
+				i += 2
+				for _, u := range [3]int{v / 1600, v / 40 % 40, v % 40} {
+					switch shift {
+					case 0:
+						switch {
+						case u <= 2:
+							shift = u + 1
+						case u == 3:
+							emit(' ')
+						case u <= 13:
+							emit(byte('0' + u - 4))
+						case u <= 39:
+							if mode == dmEncodationC40 {
+								emit(byte('A' + u - 14))
+							} else {
+								emit(byte('a' + u - 14))
+							}
+						}
+						continue
+					case 1:
+						emit(byte(u))
+					case 2:
+						switch {
+						case u < len(dmC40Shift2):
+							emit(dmC40Shift2[u])
+						case u == 27:
+							emit(0x1d)
+						case u == 30:
+							upperShift = true
+						default:
+							return nil, fmt.Errorf("invalid DataMatrix C40 shift 2 value %d", u)
+						}
+					case 3:
+						switch {
+						case mode == dmEncodationC40:
+							emit(byte(96 + u))
+						case u == 0:
+							emit('`')
+						case u <= 26:
+							emit(byte('A' + u - 1))
+						default:
+							emit(byte('{' + u - 27))
+						}
+					}
+					shift = 0
+				}
+			}
+
+		case dmEncodationX12:
+			for mode != dmEncodationASCII && i < len(data) {
+				if data[i] == 254 {
+					i++
+					mode = dmEncodationASCII
+					break
+				}
+				if i+1 >= len(data) {
+					return nil, errDataMatrixTruncated
+				}
+				v := int(data[i])<<8 | int(data[i+1])
+				v--
+				i += 2
+				for _, u := range [3]int{v / 1600, v / 40 % 40, v % 40} {
+					switch {
+					case u == 0:
+						emit('\r')
+					case u == 1:
+						emit('*')
+					case u == 2:
+						emit('>')
+					case u == 3:
+						emit(' ')
+					case u <= 13:
+						emit(byte('0' + u - 4))
+					default:
+						emit(byte('A' + u - 14))
+					}
+				}
+			}
+
+		case dmEncodationEDIFACT:
+			// four 6 bit values per three codewords, unlatch realigns to codeword boundary
+			var bits uint32
+			nbits := 0
+			for mode != dmEncodationASCII && i < len(data) {
+				bits = bits<<8 | uint32(data[i])
+				nbits += 8
+				i++
+				for nbits >= 6 {
+					nbits -= 6
+					v := byte(bits>>nbits) & 0x3f
+					if v == 0x1f {
+						mode = dmEncodationASCII
+						break
+					}
+					if v&0x20 == 0 {
+						v |= 0x40
+					}
+					emit(v)
+				}
+				bits &= 1<<nbits - 1
+			}
+
+		case dmEncodationBase256:
+			// length and data are randomized with 255-state algorithm using
+			// 1-based codeword position
+			unrandomize := func() byte {
+				pos := i + 1
+				i++
+				return byte(int(data[i-1]) - (149*pos%255 + 1))
+			}
+			n := int(unrandomize())
+			switch {
+			case n == 0:
+				n = len(data) - i
+			case n >= 250:
+				if i >= len(data) {
+					return nil, errDataMatrixTruncated
+				}
+				n = 250*(n-249) + int(unrandomize())
+			}
+			if i+n > len(data) {
+				return nil, errDataMatrixTruncated
+			}
+			for j := 0; j < n; j++ {
+				emit(unrandomize())
+			}
+			mode = dmEncodationASCII
+		}
+	}
+
+	return append(out, trailer...), nil
+}
+
+// largestComponentBounds returns bounds of the largest 8-connected group of dark pixels
+func (b bitmap) largestComponentBounds() (image.Rectangle, bool) {
+	seen := make([]bool, len(b.bits))
+	var best image.Rectangle
+	bestCount := 0
+	var stack []int
+	for start, dark := range b.bits {
+		if !dark || seen[start] {
+			continue
+		}
+		r := image.Rect(start%b.w, start/b.w, start%b.w+1, start/b.w+1)
+		count := 0
+		seen[start] = true
+		stack = append(stack[:0], start)
+		for len(stack) > 0 {
+			p := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			x, y := p%b.w, p/b.w
+			count++
+			r = r.Union(image.Rect(x, y, x+1, y+1))
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := x+dx, y+dy
+					if !b.at(nx, ny) || seen[ny*b.w+nx] {
+						continue
+					}
+					seen[ny*b.w+nx] = true
+					stack = append(stack, ny*b.w+nx)
+				}
+			}
+		}
+		if count > bestCount {
+			best = r
+			bestCount = count
+		}
+	}
+	return best, bestCount > 0
+}
+
+// runs counts color changes plus one along a line of n pixels
+func (b bitmap) runs(x, y, dx, dy, n int) int {
+	runs := 1
+	prev := b.at(x, y)
+	for j := 1; j < n; j++ {
+		v := b.at(x+j*dx, y+j*dy)
+		if v != prev {
+			runs++
+			prev = v
+		}
+	}
+	return runs
+}
+
+// sampleDataMatrix samples a DataMatrix symbol that is roughly axis aligned,
+// the solid finder edges can be on any side. Timing patterns on the edges give
+// the number of rows and columns.
+func (b bitmap) sampleDataMatrix() (dmGrid, error) {
+	r, ok := b.largestComponentBounds()
+	if !ok {
+		return dmGrid{}, ErrNotFound
+	}
+	w, h := r.Dx(), r.Dy()
+	if w < 8 || h < 8 {
+		return dmGrid{}, ErrNotFound
+	}
+
+	// first count runs on the outermost pixels to estimate module size, then
+	// recount at half a module inside the edges to avoid blurred borders
+	edgeRuns := func(insetX, insetY int) (top, bottom, left, right int) {
+		top = b.runs(r.Min.X, r.Min.Y+insetY, 1, 0, w)
+		bottom = b.runs(r.Min.X, r.Max.Y-1-insetY, 1, 0, w)
+		left = b.runs(r.Min.X+insetX, r.Min.Y, 0, 1, h)
+		right = b.runs(r.Max.X-1-insetX, r.Min.Y, 0, 1, h)
+		return top, bottom, left, right
+	}
+	maxInt := func(a, b int) int {
+		if a > b {
+			return a
+		}
+		return b
+	}
+	top, bottom, left, right := edgeRuns(0, 0)
+	cols := maxInt(top, bottom)
+	rows := maxInt(left, right)
+	top, bottom, left, right = edgeRuns(w/cols/2, h/rows/2)
+	cols = maxInt(top, bottom)
+	rows = maxInt(left, right)
+	if cols < 8 || rows < 8 {
+		return dmGrid{}, ErrNotFound
+	}
+
+	g := newDMGrid(rows, cols)
+	mw := float64(w) / float64(cols)
+	mh := float64(h) / float64(rows)
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			px := float64(r.Min.X) + (float64(x)+0.5)*mw
+			py := float64(r.Min.Y) + (float64(y)+0.5)*mh
+			g.modules[y][x] = b.at(int(math.Floor(px)), int(math.Floor(py)))
+		}
+	}
+
+	// rotate so that the solid edges are left and bottom
+	best := g
+	bestScore := g.finderScore()
+	for i := 0; i < 3; i++ {
+		g = g.rotate()
+		if s := g.finderScore(); s > bestScore {
+			best, bestScore = g, s
+		}
+	}
+	if bestScore < 0.9 {
+		return dmGrid{}, ErrNotFound
+	}
+
+	return best, nil
+}
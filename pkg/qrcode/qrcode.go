@@ -0,0 +1,636 @@
+// Package qrcode locates and decodes QR codes and DataMatrix symbols in images
+package qrcode
+
+// https://www.nayuki.io/page/creating-a-qr-code-step-by-step
+// https://www.thonky.com/qr-code-tutorial/
+
+// TODO: perspective correction using alignment patterns
+// TODO: multiple codes in one image
+// TODO: micro QR
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"sort"
+)
+
+var ErrNotFound = errors.New("no QR code or DataMatrix found")
+
+type ecLevel int
+
+const (
+	ecLevelL ecLevel = iota
+	ecLevelM
+	ecLevelQ
+	ecLevelH
+)
+
+// indexed by error correction level and version
+var eccCodewordsPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+var numErrorCorrectionBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// error correction level as stored in format information
+var formatECLevels = [4]ecLevel{ecLevelM, ecLevelL, ecLevelH, ecLevelQ}
+
+func numRawDataModules(version int) int {
+	n := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		n -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			n -= 36
+		}
+	}
+	return n
+}
+
+func alignmentPatternPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	size := version*4 + 17
+	numAlign := version/7 + 2
+	step := 26
+	if version != 32 {
+		step = (version*4 + numAlign*2 + 1) / (numAlign*2 - 2) * 2
+	}
+	positions := make([]int, numAlign)
+	positions[0] = 6
+	for i, pos := numAlign-1, size-7; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+func formatBits(ecl int, mask int) int {
+	data := ecl<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+func versionBits(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1f25)
+	}
+	return version<<12 | rem
+}
+
+func bitCount(n int) int {
+	c := 0
+	for ; n != 0; n &= n - 1 {
+		c++
+	}
+	return c
+}
+
+func maskBit(mask int, x int, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+// grid of sampled modules, true is dark
+type grid struct {
+	size    int
+	modules [][]bool
+}
+
+func (g grid) at(x, y int) bool { return g.modules[y][x] }
+
+func (g grid) readFormat() (ecLevel, int, error) {
+	var bits1, bits2 int
+	for i := 0; i <= 5; i++ {
+		bits1 |= b2i(g.at(8, i)) << i
+	}
+	bits1 |= b2i(g.at(8, 7)) << 6
+	bits1 |= b2i(g.at(8, 8)) << 7
+	bits1 |= b2i(g.at(7, 8)) << 8
+	for i := 9; i < 15; i++ {
+		bits1 |= b2i(g.at(14-i, 8)) << i
+	}
+	for i := 0; i < 8; i++ {
+		bits2 |= b2i(g.at(g.size-1-i, 8)) << i
+	}
+	for i := 8; i < 15; i++ {
+		bits2 |= b2i(g.at(8, g.size-15+i)) << i
+	}
+
+	bestDist := 16
+	bestECL, bestMask := 0, 0
+	for ecl := 0; ecl < 4; ecl++ {
+		for mask := 0; mask < 8; mask++ {
+			f := formatBits(ecl, mask)
+			for _, bits := range []int{bits1, bits2} {
+				if d := bitCount(f ^ bits); d < bestDist {
+					bestDist, bestECL, bestMask = d, ecl, mask
+				}
+			}
+		}
+	}
+	// BCH(15,5) can correct 3 errors
+	if bestDist > 3 {
+		return 0, 0, errors.New("invalid format information")
+	}
+	return formatECLevels[bestECL], bestMask, nil
+}
+
+func (g grid) readVersion() (int, error) {
+	var bits1, bits2 int
+	for i := 0; i < 18; i++ {
+		a, b := g.size-11+i%3, i/3
+		bits1 |= b2i(g.at(a, b)) << i
+		bits2 |= b2i(g.at(b, a)) << i
+	}
+	bestDist := 19
+	bestVersion := 0
+	for v := 7; v <= 40; v++ {
+		vb := versionBits(v)
+		for _, bits := range []int{bits1, bits2} {
+			if d := bitCount(vb ^ bits); d < bestDist {
+				bestDist, bestVersion = d, v
+			}
+		}
+	}
+	if bestDist > 3 {
+		return 0, errors.New("invalid version information")
+	}
+	return bestVersion, nil
+}
+
+func functionModules(version int) [][]bool {
+	size := version*4 + 17
+	m := make([][]bool, size)
+	for i := range m {
+		m[i] = make([]bool, size)
+	}
+	fill := func(x, y, w, h int) {
+		for j := y; j < y+h; j++ {
+			for i := x; i < x+w; i++ {
+				if i >= 0 && j >= 0 && i < size && j < size {
+					m[j][i] = true
+				}
+			}
+		}
+	}
+	// finder patterns with separators and format information
+	fill(0, 0, 9, 9)
+	fill(size-8, 0, 8, 9)
+	fill(0, size-8, 9, 8)
+	// timing patterns
+	fill(6, 0, 1, size)
+	fill(0, 6, size, 1)
+	ap := alignmentPatternPositions(version)
+	for i, x := range ap {
+		for j, y := range ap {
+			if (i == 0 && j == 0) || (i == 0 && j == len(ap)-1) || (i == len(ap)-1 && j == 0) {
+				continue
+			}
+			fill(x-2, y-2, 5, 5)
+		}
+	}
+	if version >= 7 {
+		fill(size-11, 0, 3, 6)
+		fill(0, size-11, 6, 3)
+	}
+	return m
+}
+
+func (g grid) decode() ([]byte, error) {
+	if (g.size-17)%4 != 0 {
+		return nil, fmt.Errorf("invalid size %d", g.size)
+	}
+	version := (g.size - 17) / 4
+	if version < 1 || version > 40 {
+		return nil, fmt.Errorf("invalid version %d", version)
+	}
+	if version >= 7 {
+		v, err := g.readVersion()
+		if err != nil {
+			return nil, err
+		}
+		if v != version {
+			return nil, fmt.Errorf("version %d does not match size %d", v, g.size)
+		}
+	}
+	ecl, mask, err := g.readFormat()
+	if err != nil {
+		return nil, err
+	}
+
+	// read codewords in zigzag order from bottom right
+	isFunction := functionModules(version)
+	numCodewords := numRawDataModules(version) / 8
+	raw := make([]byte, numCodewords)
+	i := 0
+	for right := g.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < g.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = g.size - 1 - vert
+				}
+				if isFunction[y][x] || i >= numCodewords*8 {
+					continue
+				}
+				if g.at(x, y) != maskBit(mask, x, y) {
+					raw[i>>3] |= 1 << (7 - i&7)
+				}
+				i++
+			}
+		}
+	}
+
+	// de-interleave blocks, short blocks have one less data codeword
+	numBlocks := numErrorCorrectionBlocks[ecl][version]
+	numECC := eccCodewordsPerBlock[ecl][version]
+	numShortBlocks := numBlocks - numCodewords%numBlocks
+	shortBlockLen := numCodewords / numBlocks
+	blocks := make([][]byte, numBlocks)
+	for b := range blocks {
+		n := shortBlockLen
+		if b >= numShortBlocks {
+			n++
+		}
+		blocks[b] = make([]byte, n)
+	}
+	k := 0
+	for c := 0; c < shortBlockLen+1; c++ {
+		for b := range blocks {
+			dataLen := len(blocks[b]) - numECC
+			if c < dataLen {
+				blocks[b][c] = raw[k]
+				k++
+			}
+		}
+	}
+	for c := 0; c < numECC; c++ {
+		for b := range blocks {
+			blocks[b][len(blocks[b])-numECC+c] = raw[k]
+			k++
+		}
+	}
+
+	var data []byte
+	for _, b := range blocks {
+		if _, err := qrField.rsCorrect(b, numECC, 0); err != nil {
+			return nil, err
+		}
+		data = append(data, b[:len(b)-numECC]...)
+	}
+
+	return decodeSegments(data, version)
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type point struct{ x, y float64 }
+
+func (p point) sub(o point) point         { return point{p.x - o.x, p.y - o.y} }
+func (p point) add(o point) point         { return point{p.x + o.x, p.y + o.y} }
+func (p point) scale(f float64) point     { return point{p.x * f, p.y * f} }
+func (p point) dist(o point) float64      { return math.Hypot(p.x-o.x, p.y-o.y) }
+func (p point) cross(o point) float64     { return p.x*o.y - p.y*o.x }
+func (p point) dot(o point) float64       { return p.x*o.x + p.y*o.y }
+func (p point) length() float64           { return math.Hypot(p.x, p.y) }
+func (p point) String() string            { return fmt.Sprintf("%.1f,%.1f", p.x, p.y) }
+func newPoint(x float64, y float64) point { return point{x, y} }
+
+// binarized image, true is dark
+type bitmap struct {
+	w, h int
+	bits []bool
+}
+
+func (b bitmap) at(x, y int) bool {
+	if x < 0 || y < 0 || x >= b.w || y >= b.h {
+		return false
+	}
+	return b.bits[y*b.w+x]
+}
+
+// binarize using Otsu's method on luminance
+func binarize(img image.Image) bitmap {
+	r := img.Bounds()
+	w, h := r.Dx(), r.Dy()
+	lum := make([]uint8, w*h)
+	var hist [256]int
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			cr, cg, cb, ca := img.At(r.Min.X+x, r.Min.Y+y).RGBA()
+			// transparent is treated as white
+			l := (299*cr + 587*cg + 114*cb) / 1000
+			l = (l*ca + 0xffff*(0xffff-ca)) / 0xffff
+			v := uint8(l >> 8)
+			lum[y*w+x] = v
+			hist[v]++
+		}
+	}
+
+	total := w * h
+	var sum float64
+	for i, c := range hist {
+		sum += float64(i * c)
+	}
+	var sumB float64
+	var wB int
+	var best float64
+	threshold := 127
+	for t := 0; t < 256; t++ {
+		wB += hist[t]
+		if wB == 0 {
+			continue
+		}
+		wF := total - wB
+		if wF == 0 {
+			break
+		}
+		sumB += float64(t * hist[t])
+		mB := sumB / float64(wB)
+		mF := (sum - sumB) / float64(wF)
+		between := float64(wB) * float64(wF) * (mB - mF) * (mB - mF)
+		if between > best {
+			best = between
+			threshold = t
+		}
+	}
+
+	b := bitmap{w: w, h: h, bits: make([]bool, w*h)}
+	for i, v := range lum {
+		b.bits[i] = int(v) <= threshold
+	}
+	return b
+}
+
+// check 1:1:3:1:1 ratio
+func finderRatio(runs [5]int) bool {
+	total := 0
+	for _, r := range runs {
+		if r == 0 {
+			return false
+		}
+		total += r
+	}
+	if total < 7 {
+		return false
+	}
+	unit := float64(total) / 7
+	tolerance := unit / 2
+	return math.Abs(unit-float64(runs[0])) < tolerance &&
+		math.Abs(unit-float64(runs[1])) < tolerance &&
+		math.Abs(3*unit-float64(runs[2])) < 3*tolerance &&
+		math.Abs(unit-float64(runs[3])) < tolerance &&
+		math.Abs(unit-float64(runs[4])) < tolerance
+}
+
+// count runs from center outwards along direction, returns center offset and total length
+func (b bitmap) crossCheck(cx, cy int, dx, dy int) (float64, int, bool) {
+	if !b.at(cx, cy) {
+		return 0, 0, false
+	}
+	var runs [5]int
+	// center and backwards
+	x, y := cx, cy
+	for b.at(x, y) && runs[2] < b.w+b.h {
+		runs[2]++
+		x, y = x-dx, y-dy
+	}
+	back := runs[2]
+	for !b.at(x, y) && inBounds(b, x, y) {
+		runs[1]++
+		x, y = x-dx, y-dy
+	}
+	for b.at(x, y) {
+		runs[0]++
+		x, y = x-dx, y-dy
+	}
+	// forwards
+	x, y = cx+dx, cy+dy
+	for b.at(x, y) {
+		runs[2]++
+		x, y = x+dx, y+dy
+	}
+	for !b.at(x, y) && inBounds(b, x, y) {
+		runs[3]++
+		x, y = x+dx, y+dy
+	}
+	for b.at(x, y) {
+		runs[4]++
+		x, y = x+dx, y+dy
+	}
+	if !finderRatio(runs) {
+		return 0, 0, false
+	}
+	// offset from cx,cy to center of center run
+	offset := float64(runs[2])/2 - float64(back) + 0.5
+	return offset, runs[0] + runs[1] + runs[2] + runs[3] + runs[4], true
+}
+
+func inBounds(b bitmap, x, y int) bool {
+	return x >= 0 && y >= 0 && x < b.w && y < b.h
+}
+
+type finder struct {
+	p          point
+	moduleSize float64
+	count      int
+}
+
+func (b bitmap) findFinders() []finder {
+	var finders []finder
+	add := func(p point, moduleSize float64) {
+		for i := range finders {
+			f := &finders[i]
+			if f.p.dist(p) < f.moduleSize*2 && math.Abs(f.moduleSize-moduleSize) < f.moduleSize {
+				n := float64(f.count)
+				f.p = f.p.scale(n).add(p).scale(1 / (n + 1))
+				f.moduleSize = (f.moduleSize*n + moduleSize) / (n + 1)
+				f.count++
+				return
+			}
+		}
+		finders = append(finders, finder{p: p, moduleSize: moduleSize, count: 1})
+	}
+
+	for y := 0; y < b.h; y++ {
+		// run lengths of alternating colors starting with first dark
+		var runs []int
+		var starts []int
+		x := 0
+		for x < b.w && !b.at(x, y) {
+			x++
+		}
+		for x < b.w {
+			c := b.at(x, y)
+			start := x
+			for x < b.w && b.at(x, y) == c {
+				x++
+			}
+			runs = append(runs, x-start)
+			starts = append(starts, start)
+		}
+		// dark runs are at even indexes
+		for i := 0; i+4 < len(runs); i += 2 {
+			var r [5]int
+			copy(r[:], runs[i:i+5])
+			if !finderRatio(r) {
+				continue
+			}
+			cx := starts[i+2] + runs[i+2]/2
+			yOffset, vTotal, ok := b.crossCheck(cx, y, 0, 1)
+			if !ok {
+				continue
+			}
+			cy := int(float64(y) + yOffset)
+			xOffset, hTotal, ok := b.crossCheck(cx, cy, 1, 0)
+			if !ok {
+				continue
+			}
+			// diagonal check removes false positives in data area
+			if _, _, ok := b.crossCheck(int(float64(cx)+xOffset), cy, 1, 1); !ok {
+				continue
+			}
+			moduleSize := float64(vTotal+hTotal) / 14
+			add(newPoint(float64(cx)+xOffset, float64(y)+yOffset), moduleSize)
+		}
+	}
+
+	sort.SliceStable(finders, func(i, j int) bool { return finders[i].count > finders[j].count })
+	return finders
+}
+
+// order as top left, top right and bottom left
+func orderFinders(a, b, c finder) (finder, finder, finder) {
+	ab, bc, ac := a.p.dist(b.p), b.p.dist(c.p), a.p.dist(c.p)
+	// longest distance is between top right and bottom left
+	switch {
+	case bc >= ab && bc >= ac:
+		// a is top left
+	case ac >= ab && ac >= bc:
+		a, b = b, a
+	default:
+		a, c = c, a
+	}
+	// y axis points down so clockwise order gives positive cross product
+	if b.p.sub(a.p).cross(c.p.sub(a.p)) < 0 {
+		b, c = c, b
+	}
+	return a, b, c
+}
+
+// sample grid using affine transform from finder centers
+func (b bitmap) sample(tl, tr, bl finder) (grid, error) {
+	moduleSize := (tl.moduleSize + tr.moduleSize + bl.moduleSize) / 3
+	d := (tl.p.dist(tr.p) + tl.p.dist(bl.p)) / (2 * moduleSize)
+	size := int(math.Round(d)) + 7
+	switch size % 4 {
+	case 0:
+		size++
+	case 2:
+		size--
+	case 3:
+		size -= 2
+	}
+	if size < 21 || size > 177 {
+		return grid{}, fmt.Errorf("invalid size %d", size)
+	}
+
+	// finder centers are at module 3.5 from the edges
+	ux := tr.p.sub(tl.p).scale(1 / float64(size-7))
+	uy := bl.p.sub(tl.p).scale(1 / float64(size-7))
+	origin := tl.p.sub(ux.scale(3.5)).sub(uy.scale(3.5))
+
+	g := grid{size: size, modules: make([][]bool, size)}
+	for y := 0; y < size; y++ {
+		g.modules[y] = make([]bool, size)
+		for x := 0; x < size; x++ {
+			p := origin.add(ux.scale(float64(x) + 0.5)).add(uy.scale(float64(y) + 0.5))
+			g.modules[y][x] = b.at(int(math.Floor(p.x)), int(math.Floor(p.y)))
+		}
+	}
+	return g, nil
+}
+
+// Decode locates a QR code or DataMatrix symbol in image and returns its payload
+func Decode(img image.Image) ([]byte, error) {
+	b := binarize(img)
+	finders := b.findFinders()
+	if len(finders) > 8 {
+		finders = finders[:8]
+	}
+
+	var lastErr error = ErrNotFound
+	for i := 0; i < len(finders); i++ {
+		for j := i + 1; j < len(finders); j++ {
+			for k := j + 1; k < len(finders); k++ {
+				tl, tr, bl := orderFinders(finders[i], finders[j], finders[k])
+				// should be an isosceles right triangle
+				v1, v2 := tr.p.sub(tl.p), bl.p.sub(tl.p)
+				if math.Abs(v1.dot(v2)) > 0.2*v1.length()*v2.length() ||
+					math.Abs(v1.length()-v2.length()) > 0.2*v1.length() {
+					continue
+				}
+				g, err := b.sample(tl, tr, bl)
+				if err != nil {
+					lastErr = err
+					continue
+				}
+				payload, err := g.decode()
+				if err != nil {
+					lastErr = err
+					continue
+				}
+				return payload, nil
+			}
+		}
+	}
+
+	g, err := b.sampleDataMatrix()
+	if err != nil {
+		if lastErr != ErrNotFound {
+			return nil, lastErr
+		}
+		return nil, err
+	}
+	return g.decode()
+}
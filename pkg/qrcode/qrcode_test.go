@@ -0,0 +1,99 @@
+package qrcode_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/wader/fq/pkg/qrcode"
+)
+
+func decodeFile(t *testing.T, path string) []byte {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := qrcode.Decode(img)
+	if err != nil {
+		t.Fatalf("%s: %s", path, err)
+	}
+	return payload
+}
+
+func TestDecode(t *testing.T) {
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{"testdata/url.png", "https://github.com/wader/fq"},
+		{"testdata/url.jpg", "https://github.com/wader/fq"},
+		{"testdata/mixed_errors.png", "FQ QR0123456789 mixed"},
+		{"testdata/dm_url.png", "https://github.com/wader/fq"},
+		{"testdata/dm_mixed_rotated.png", "FQ DATAMATRIX 2hello world!  X12*ABC>0EDIFACT!2026\xe9"},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.path, func(t *testing.T) {
+			actual := string(decodeFile(t, tc.path))
+			if tc.expected != actual {
+				t.Errorf("expected %q, got %q", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestDecodeBinary(t *testing.T) {
+	payload := decodeFile(t, "testdata/gzip_rotated.png")
+	zr, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "hello from a qr code\n"; string(b) != expected {
+		t.Errorf("expected %q, got %q", expected, b)
+	}
+}
+
+func TestDecodeDataMatrixBinary(t *testing.T) {
+	payload := decodeFile(t, "testdata/dm_base256.png")
+	// gzip is followed by padding to get a symbol with multiple regions and blocks
+	var padding []byte
+	for i := 0; i < 130; i++ {
+		padding = append(padding, byte(i))
+	}
+	if !bytes.HasSuffix(payload, padding) {
+		t.Errorf("expected payload to end with padding, got %x", payload)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr.Multistream(false)
+	b, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "hello from a data matrix\n"; string(b) != expected {
+		t.Errorf("expected %q, got %q", expected, b)
+	}
+}
+
+func TestDecodeNotFound(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 64, 64))
+	if _, err := qrcode.Decode(img); err == nil {
+		t.Error("expected error")
+	}
+}
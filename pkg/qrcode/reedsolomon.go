@@ -0,0 +1,162 @@
+package qrcode
+
+import "errors"
+
+// GF(256) defined by a primitive polynomial
+type galoisField struct {
+	exp [512]byte
+	log [256]int
+}
+
+func newGaloisField(poly int) *galoisField {
+	gf := &galoisField{}
+	x := 1
+	for i := 0; i < 255; i++ {
+		gf.exp[i] = byte(x)
+		gf.log[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= poly
+		}
+	}
+	for i := 255; i < len(gf.exp); i++ {
+		gf.exp[i] = gf.exp[i-255]
+	}
+	return gf
+}
+
+// x^8+x^4+x^3+x^2+1 as used by QR codes
+var qrField = newGaloisField(0x11d)
+
+// x^8+x^5+x^3+x^2+1 as used by DataMatrix ECC200
+var dataMatrixField = newGaloisField(0x12d)
+
+func (gf *galoisField) mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gf.exp[gf.log[a]+gf.log[b]]
+}
+
+func (gf *galoisField) div(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gf.exp[gf.log[a]+255-gf.log[b]]
+}
+
+// evaluate polynomial with highest degree first
+func (gf *galoisField) polyEval(p []byte, x byte) byte {
+	var y byte
+	for _, c := range p {
+		y = gf.mul(y, x) ^ c
+	}
+	return y
+}
+
+var errTooManyErrors = errors.New("too many errors")
+
+// rsCorrect corrects codeword in place, last numECC bytes are error correction
+// codewords and the generator polynomial roots are alpha^fcr...alpha^(fcr+numECC-1).
+// Returns number of corrected bytes.
+func (gf *galoisField) rsCorrect(codeword []byte, numECC int, fcr int) (int, error) {
+	syndromes := make([]byte, numECC)
+	hasErrors := false
+	for i := range syndromes {
+		syndromes[i] = gf.polyEval(codeword, gf.exp[i+fcr])
+		if syndromes[i] != 0 {
+			hasErrors = true
+		}
+	}
+	if !hasErrors {
+		return 0, nil
+	}
+
+	// Berlekamp-Massey, polynomials with lowest degree first
+	sigma := []byte{1}
+	prev := []byte{1}
+	l := 0
+	m := 1
+	var b byte = 1
+	for n := 0; n < numECC; n++ {
+		d := syndromes[n]
+		for i := 1; i <= l && i < len(sigma); i++ {
+			d ^= gf.mul(sigma[i], syndromes[n-i])
+		}
+		if d == 0 {
+			m++
+			continue
+		}
+		coef := gf.div(d, b)
+		next := make([]byte, len(sigma))
+		copy(next, sigma)
+		for len(next) < len(prev)+m {
+			next = append(next, 0)
+		}
+		for i, p := range prev {
+			next[i+m] ^= gf.mul(coef, p)
+		}
+		if 2*l <= n {
+			l = n + 1 - l
+			prev = sigma
+			b = d
+			m = 1
+		} else {
+			m++
+		}
+		sigma = next
+	}
+	if l*2 > numECC {
+		return 0, errTooManyErrors
+	}
+
+	// Chien search, error at position i from the end has locator alpha^i
+	n := len(codeword)
+	var positions []int
+	for i := 0; i < n; i++ {
+		xInv := gf.exp[(255-i)%255]
+		var v byte
+		for j := len(sigma) - 1; j >= 0; j-- {
+			v = gf.mul(v, xInv) ^ sigma[j]
+		}
+		if v == 0 {
+			positions = append(positions, i)
+		}
+	}
+	if len(positions) != l {
+		return 0, errTooManyErrors
+	}
+
+	// Forney, error evaluator omega = syndromes * sigma mod x^numECC
+	omega := make([]byte, numECC)
+	for i := 0; i < numECC; i++ {
+		for j := 0; j <= i && j < len(sigma); j++ {
+			omega[i] ^= gf.mul(sigma[j], syndromes[i-j])
+		}
+	}
+	for _, i := range positions {
+		xInv := gf.exp[(255-i)%255]
+		var num byte
+		for j := len(omega) - 1; j >= 0; j-- {
+			num = gf.mul(num, xInv) ^ omega[j]
+		}
+		// formal derivative of sigma, only odd powers remain
+		var den byte
+		for j := 1; j < len(sigma); j += 2 {
+			den ^= gf.mul(sigma[j], gf.exp[(gf.log[xInv]*(j-1))%255])
+		}
+		if den == 0 {
+			return 0, errTooManyErrors
+		}
+		// magnitude is X^(1-fcr)*omega/sigma'
+		codeword[n-1-i] ^= gf.mul(gf.exp[(i*(1-fcr)%255+255)%255], gf.div(num, den))
+	}
+
+	for i := range syndromes {
+		if gf.polyEval(codeword, gf.exp[i+fcr]) != 0 {
+			return 0, errTooManyErrors
+		}
+	}
+
+	return len(positions), nil
+}
@@ -0,0 +1,187 @@
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	modeTerminator      = 0b0000
+	modeNumeric         = 0b0001
+	modeAlphanumeric    = 0b0010
+	modeStructuredApp   = 0b0011
+	modeByte            = 0b0100
+	modeFNC1First       = 0b0101
+	modeECI             = 0b0111
+	modeKanji           = 0b1000
+	modeFNC1Second      = 0b1001
+	alphanumericCharset = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+)
+
+var errEndOfData = errors.New("unexpected end of data")
+
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReader) left() int { return len(r.data)*8 - r.pos }
+
+func (r *bitReader) read(n int) (int, error) {
+	if n > r.left() {
+		return 0, errEndOfData
+	}
+	v := 0
+	for i := 0; i < n; i++ {
+		v = v<<1 | int(r.data[r.pos>>3]>>(7-r.pos&7)&1)
+		r.pos++
+	}
+	return v, nil
+}
+
+// character count bits for version ranges 1-9, 10-26 and 27-40
+func countBits(mode int, version int) int {
+	i := 0
+	switch {
+	case version >= 27:
+		i = 2
+	case version >= 10:
+		i = 1
+	}
+	switch mode {
+	case modeNumeric:
+		return [3]int{10, 12, 14}[i]
+	case modeAlphanumeric:
+		return [3]int{9, 11, 13}[i]
+	case modeByte:
+		return [3]int{8, 16, 16}[i]
+	default:
+		return [3]int{8, 10, 12}[i]
+	}
+}
+
+// decodeSegments decodes data segments. Kanji is output as Shift JIS and ECI
+// designators are skipped so payload is the raw bytes.
+func decodeSegments(data []byte, version int) ([]byte, error) {
+	r := &bitReader{data: data}
+	var out []byte
+	for r.left() >= 4 {
+		mode, _ := r.read(4)
+		switch mode {
+		case modeTerminator:
+			return out, nil
+		case modeNumeric:
+			count, err := r.read(countBits(mode, version))
+			if err != nil {
+				return nil, err
+			}
+			for ; count >= 3; count -= 3 {
+				v, err := r.read(10)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, []byte(fmt.Sprintf("%03d", v))...)
+			}
+			switch count {
+			case 2:
+				v, err := r.read(7)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, []byte(fmt.Sprintf("%02d", v))...)
+			case 1:
+				v, err := r.read(4)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, []byte(fmt.Sprintf("%d", v))...)
+			}
+		case modeAlphanumeric:
+			count, err := r.read(countBits(mode, version))
+			if err != nil {
+				return nil, err
+			}
+			for ; count >= 2; count -= 2 {
+				v, err := r.read(11)
+				if err != nil {
+					return nil, err
+				}
+				if v/45 >= len(alphanumericCharset) {
+					return nil, fmt.Errorf("invalid alphanumeric value %d", v)
+				}
+				out = append(out, alphanumericCharset[v/45], alphanumericCharset[v%45])
+			}
+			if count == 1 {
+				v, err := r.read(6)
+				if err != nil {
+					return nil, err
+				}
+				if v >= len(alphanumericCharset) {
+					return nil, fmt.Errorf("invalid alphanumeric value %d", v)
+				}
+				out = append(out, alphanumericCharset[v])
+			}
+		case modeByte:
+			count, err := r.read(countBits(mode, version))
+			if err != nil {
+				return nil, err
+			}
+			for i := 0; i < count; i++ {
+				v, err := r.read(8)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, byte(v))
+			}
+		case modeKanji:
+			count, err := r.read(countBits(mode, version))
+			if err != nil {
+				return nil, err
+			}
+			for i := 0; i < count; i++ {
+				v, err := r.read(13)
+				if err != nil {
+					return nil, err
+				}
+				sjis := (v/0xc0)<<8 | v%0xc0
+				if sjis < 0x1f00 {
+					sjis += 0x8140
+				} else {
+					sjis += 0xc140
+				}
+				out = append(out, byte(sjis>>8), byte(sjis))
+			}
+		case modeECI:
+			// designator is 1, 2 or 3 bytes with length in leading bits
+			v, err := r.read(8)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case v&0x80 == 0:
+			case v&0xc0 == 0x80:
+				_, err = r.read(8)
+			default:
+				_, err = r.read(16)
+			}
+			if err != nil {
+				return nil, err
+			}
+		case modeStructuredApp:
+			// sequence, total and parity
+			if _, err := r.read(16); err != nil {
+				return nil, err
+			}
+		case modeFNC1First:
+		case modeFNC1Second:
+			// application indicator
+			if _, err := r.read(8); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unknown mode %d", mode)
+		}
+	}
+
+	return out, nil
+}